@@ -0,0 +1,69 @@
+// Package adapter builds Migrate instances from the database handles of an
+// application, a *sql.DB or a GORM database, reusing its connection pool
+// instead of opening another one from a database URL, e.g.
+//
+//	m, err := adapter.FromGORM(db, "postgres", http.Dir("."), "migrations")
+//	if err != nil {
+//		return err
+//	}
+//	defer m.Close()
+//	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+//		return err
+//	}
+//
+// Closing the Migrate instance doesn't close the handle, which stays owned by
+// the application. The database driver, e.g. database/postgres, must be
+// imported and implement database.SQLInstancer.
+package adapter
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+)
+
+// FromSQL returns a Migrate instance applying the migrations in directory path
+// of fs with database driver driverName, e.g. "postgres", using db.
+func FromSQL(db *sql.DB, driverName string, fs http.FileSystem, path string) (*migrate.Migrate, error) {
+	src, err := httpfs.New(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	dbDrv, err := database.WithSQLInstance(driverName, db)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("httpfs", src, driverName, dbDrv)
+	if err != nil {
+		src.Close()
+		dbDrv.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// FromGORM is FromSQL for the *sql.DB of db, a *gorm.DB of either
+// github.com/jinzhu/gorm or gorm.io/gorm.
+func FromGORM(db interface{}, driverName string, fs http.FileSystem, path string) (*migrate.Migrate, error) {
+	var sqlDB *sql.DB
+	switch db := db.(type) {
+	case interface{ DB() *sql.DB }:
+		sqlDB = db.DB()
+	case interface{ DB() (*sql.DB, error) }:
+		var err error
+		if sqlDB, err = db.DB(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%T isn't a GORM database", db)
+	}
+	if sqlDB == nil {
+		return nil, fmt.Errorf("GORM database has no *sql.DB")
+	}
+	return FromSQL(sqlDB, driverName, fs, path)
+}
@@ -0,0 +1,82 @@
+package adapter
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+// gormV1 and gormV2 have the DB methods of the *gorm.DB of both GORM versions
+type gormV1 struct {
+	db *sql.DB
+}
+
+func (g *gormV1) DB() *sql.DB {
+	return g.db
+}
+
+type gormV2 struct {
+	db  *sql.DB
+	err error
+}
+
+func (g *gormV2) DB() (*sql.DB, error) {
+	return g.db, g.err
+}
+
+func TestFromGORM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "migrations"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "migrations", "1_users.up.sql"),
+		[]byte("CREATE TABLE users (id INTEGER PRIMARY KEY);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, gormDB := range []interface{}{&gormV1{db}, &gormV2{db: db}} {
+		m, err := FromGORM(gormDB, "sqlite3", http.Dir(dir), "migrations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+			t.Fatal(err)
+		}
+		if v, dirty, err := m.Version(); err != nil || v != 1 || dirty {
+			t.Fatalf("expected clean version 1, got %v, %v, %v", v, dirty, err)
+		}
+		if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
+			t.Fatal(srcErr, dbErr)
+		}
+		// the pool of the application stays open
+		if err := db.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := FromGORM(&gormV2{err: errors.New("closed")}, "sqlite3", http.Dir(dir), "migrations"); err == nil {
+		t.Error("expected error of DB()")
+	}
+	if _, err := FromGORM(db, "sqlite3", http.Dir(dir), "migrations"); err == nil {
+		t.Error("expected error for *sql.DB")
+	}
+	if _, err := FromSQL(db, "stub", http.Dir(dir), "migrations"); err == nil {
+		t.Error("expected error for unknown driver")
+	}
+}
@@ -0,0 +1,183 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// BackfillPlaceholder is replaced by the condition selecting the rows of a
+// batch in the statement of a backfill migration.
+const BackfillPlaceholder = "{batch}"
+
+// ErrBackfillStopped is returned if a backfill is stopped by GracefulStop
+// between two batches. The version is set back to the one before the
+// migration, not dirty, so running the migration again resumes it.
+var ErrBackfillStopped = errors.New("backfill stopped, run the migration again to resume")
+
+// backfillSpec is the value of a backfill pragma, e.g.
+// `table=users batch=5000 sleep=100ms key=id`
+type backfillSpec struct {
+	table string
+	key   string
+	batch int
+	sleep time.Duration
+}
+
+func parseBackfillSpec(spec string) (backfillSpec, error) {
+	b := backfillSpec{key: "id", batch: 1000}
+	for _, field := range strings.Fields(spec) {
+		i := strings.Index(field, "=")
+		if i < 1 {
+			return b, fmt.Errorf("expected name=value, got %q", field)
+		}
+		value := field[i+1:]
+		var err error
+		switch field[:i] {
+		case "table":
+			b.table = value
+		case "key":
+			b.key = value
+		case "batch":
+			if b.batch, err = strconv.Atoi(value); err == nil && b.batch < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "sleep":
+			b.sleep, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return b, fmt.Errorf("%v: %v", field, err)
+		}
+	}
+	if b.table == "" {
+		return b, fmt.Errorf("missing table=TABLE")
+	}
+	return b, nil
+}
+
+// backfill runs a migration with the `backfill` pragma, e.g.
+//  -- migrate:backfill table=users batch=5000 sleep=100ms
+//  UPDATE users SET email_lower = lower(email) WHERE {batch}
+// The statement following the pragmas is run for batches of rows of table,
+// paginated by their key (default id), with {batch} replaced by the
+// condition selecting the batch, sleeping in between. The progress is kept
+// in database.DefaultBackfillTable, so that a failed or stopped backfill
+// resumes after the last completed batch.
+func (m *Migrate) backfill(migr *Migration, spec string, body io.Reader) error {
+	b, err := parseBackfillSpec(spec)
+	if err != nil {
+		return fmt.Errorf("%v: invalid backfill pragma %q: %v", migr.LogString(), spec, err)
+	}
+	stmt, err := ioutil.ReadAll(pragma.Body(body))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(stmt), BackfillPlaceholder) {
+		return fmt.Errorf("%v: the backfill statement must contain %v", migr.LogString(), BackfillPlaceholder)
+	}
+
+	q := m.databaseDrv.(database.Querier)
+	progress := &database.BackfillTable{Driver: m.databaseDrv, Table: database.DefaultBackfillTable}
+	last, err := progress.Last(migr.Version)
+	if err != nil {
+		return err
+	}
+	if last != "" {
+		m.logPrintf("%v: resuming backfill of %v after %v %v\n", migr.LogString(), b.table, b.key, last)
+	}
+
+	var total int64
+	for batch := 1; ; batch++ {
+		// the key of the last row of the batch, none for the last batch
+		query := "SELECT " + b.key + " FROM " + b.table
+		if last != "" {
+			query += " WHERE " + b.key + " > " + last
+		}
+		query += " ORDER BY " + b.key + " LIMIT 1 OFFSET " + strconv.Itoa(b.batch-1)
+		rows, err := q.Query(query)
+		if err != nil {
+			return err
+		}
+		var conditions []string
+		if last != "" {
+			conditions = append(conditions, b.key+" > "+last)
+		}
+		upper := ""
+		if len(rows) > 0 {
+			// the only column, whose name may differ from a quoted key
+			for _, v := range rows[0] {
+				if upper, err = sqlLiteral(v); err != nil {
+					return fmt.Errorf("%v: %v", migr.LogString(), err)
+				}
+			}
+			conditions = append(conditions, b.key+" <= "+upper)
+		}
+		condition := "1 = 1"
+		if len(conditions) > 0 {
+			condition = strings.Join(conditions, " AND ")
+		}
+
+		n, err := q.Exec(strings.Replace(string(stmt), BackfillPlaceholder, "("+condition+")", -1))
+		if err != nil {
+			return err
+		}
+		total += n
+		m.logVerbosePrintf("%v: batch %v, %v rows\n", migr.LogString(), batch, n)
+		if upper == "" {
+			break
+		}
+		if err := progress.Save(migr.Version, upper); err != nil {
+			return err
+		}
+		last = upper
+		if m.stop() {
+			return ErrBackfillStopped
+		}
+		time.Sleep(b.sleep)
+	}
+	m.logPrintf("%v: backfilled %v rows of %v\n", migr.LogString(), total, b.table)
+	return progress.Clear(migr.Version)
+}
+
+// backfillStopped sets the version back to the one before migr, whose
+// backfill was stopped, so that the next run resumes the backfill rather
+// than failing with ErrDirty.
+func (m *Migrate) backfillStopped(migr *Migration) error {
+	from := int(migr.Version)
+	if migr.TargetVersion == int(migr.Version) {
+		prev, err := m.sourceDrv.Prev(migr.Version)
+		if os.IsNotExist(err) {
+			from = database.NilVersion
+		} else if err != nil {
+			return err
+		} else {
+			from = int(prev)
+		}
+	}
+	return m.state().SetVersion(from, false)
+}
+
+// sqlLiteral returns v, a value of a database.Row, as SQL literal
+func sqlLiteral(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'", nil
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999999") + "'", nil
+	}
+	return "", fmt.Errorf("unsupported backfill key %v of type %T", v, v)
+}
@@ -0,0 +1,51 @@
+package migrate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBackfillSpec(t *testing.T) {
+	cases := []struct {
+		spec      string
+		expected  backfillSpec
+		expectErr bool
+	}{
+		{spec: "table=users", expected: backfillSpec{table: "users", key: "id", batch: 1000}},
+		{spec: "table=users batch=5000 sleep=100ms key=user_id",
+			expected: backfillSpec{table: "users", key: "user_id", batch: 5000, sleep: 100 * time.Millisecond}},
+		{spec: "batch=5000", expectErr: true},
+		{spec: "table=users batch=0", expectErr: true},
+		{spec: "table=users sleep=soon", expectErr: true},
+		{spec: "table=users order=desc", expectErr: true},
+		{spec: "users", expectErr: true},
+	}
+	for _, c := range cases {
+		b, err := parseBackfillSpec(c.spec)
+		if (err != nil) != c.expectErr {
+			t.Errorf("%q: expected error %v, got %v", c.spec, c.expectErr, err)
+		} else if err == nil && b != c.expected {
+			t.Errorf("%q: expected %+v, got %+v", c.spec, c.expected, b)
+		}
+	}
+}
+
+func TestSQLLiteral(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		expected string
+	}{
+		{int64(42), "42"},
+		{1.5, "1.5"},
+		{"O'Brien", "'O''Brien'"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "'2020-01-02 03:04:05'"},
+	}
+	for _, c := range cases {
+		if literal, err := sqlLiteral(c.value); err != nil || literal != c.expected {
+			t.Errorf("%v: expected %v, got %v, %v", c.value, c.expected, literal, err)
+		}
+	}
+	if _, err := sqlLiteral(nil); err == nil {
+		t.Error("expected NULL key to fail")
+	}
+}
@@ -0,0 +1,198 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// ErrNoChangeScript is returned by ApplyChangeScript for a script without
+// the header written by WriteChangeScript.
+var ErrNoChangeScript = errors.New("not a change script, the change-script-from and change-script-checksum pragmas are missing")
+
+// ErrChangeScriptModified is returned by ApplyChangeScript if the script
+// was modified after it was written.
+var ErrChangeScriptModified = errors.New("change script was modified after it was written, its checksum doesn't match")
+
+// ErrChangeScriptOutdated is returned by ApplyChangeScript if the version
+// of the database isn't the one the script was written for, e.g. because
+// migrations were applied in the meantime.
+var ErrChangeScriptOutdated = errors.New("database version changed since the change script was written, write it again")
+
+// changeScriptFromNone is the change-script-from of a database without
+// version.
+const changeScriptFromNone = "none"
+
+// changeScriptMigration heads a migration in a change script, see writePlan.
+var changeScriptMigration = regexp.MustCompile(`^-- (\d+)/u (.*)$`)
+
+// WriteChangeScript writes the SQL of all pending migrations to w, like Up
+// with Plan, for a review before ApplyChangeScript runs it. The script is
+// headed by the current version and the checksum of the SQL, e.g.
+//  -- migrate:change-script-from 42
+//  -- migrate:change-script-checksum 9f86d0...
+// Migrations which aren't SQL, e.g. exec migrations, can't be part of a
+// change script. It returns ErrNoChange if no migration is pending.
+func (m *Migrate) WriteChangeScript(w io.Writer) error {
+	version, dirty, err := m.state().Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return ErrDirty{version}
+	}
+	from := changeScriptFromNone
+	if version != database.NilVersion {
+		from = strconv.Itoa(version)
+	}
+
+	var body bytes.Buffer
+	plan, sqlOnly := m.Plan, m.planSQLOnly
+	m.Plan, m.planSQLOnly = &body, true
+	err = m.Up()
+	m.Plan, m.planSQLOnly = plan, sqlOnly
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "-- %v%v %v\n-- %v%v %v\n\n", pragma.Prefix, pragma.ChangeScriptFrom, from,
+		pragma.Prefix, pragma.ChangeScriptChecksum, manifest.Checksum(body.Bytes())); err != nil {
+		return err
+	}
+	_, err = body.WriteTo(w)
+	return err
+}
+
+// changeScriptSection is a migration of a change script
+type changeScriptSection struct {
+	version    uint
+	identifier string
+	sql        []byte
+}
+
+// ApplyChangeScript runs a change script written by WriteChangeScript, e.g.
+// after it was reviewed. It fails with ErrChangeScriptModified if the script
+// was modified, and with ErrChangeScriptOutdated if the version of the
+// database isn't the one the script was written for. Every migration of the
+// script sets the version, like a migration of the source.
+func (m *Migrate) ApplyChangeScript(r io.Reader) (err error) {
+	script, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	pragmas := pragma.Parse(script)
+	from, okFrom := pragmas.Get(pragma.ChangeScriptFrom)
+	checksum, okChecksum := pragmas.Get(pragma.ChangeScriptChecksum)
+	i := bytes.Index(script, []byte("\n\n"))
+	if !okFrom || !okChecksum || i < 0 {
+		return ErrNoChangeScript
+	}
+	body := script[i+2:]
+	if manifest.Checksum(body) != checksum {
+		return ErrChangeScriptModified
+	}
+	sections, err := parseChangeScript(body)
+	if err != nil {
+		return err
+	}
+
+	defer m.audit("apply-script", from, time.Now(), &err)
+	defer m.fingerprint(&err)
+
+	if err := m.lock(); err != nil {
+		return err
+	}
+	version, dirty, err := m.state().Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if dirty {
+		return m.unlockErr(ErrDirty{version})
+	}
+	current := changeScriptFromNone
+	if version != database.NilVersion {
+		current = strconv.Itoa(version)
+	}
+	if current != from {
+		return m.unlockErr(ErrChangeScriptOutdated)
+	}
+
+	if err := m.createHistoryTable(); err != nil {
+		return m.unlockErr(err)
+	}
+	for _, s := range sections {
+		if err := m.applyChangeScriptSection(s); err != nil {
+			return m.unlockErr(err)
+		}
+	}
+	return m.unlock()
+}
+
+func (m *Migrate) applyChangeScriptSection(s changeScriptSection) error {
+	migr := &Migration{Version: s.version, TargetVersion: int(s.version), Identifier: s.identifier}
+	started := time.Now()
+	if err := m.state().SetVersion(migr.TargetVersion, true); err != nil {
+		return err
+	}
+	// skipped migrations and those without file only set the version
+	if len(multistmt.Split(s.sql, multistmt.DefaultDelimiter)) > 0 {
+		if err := m.databaseDrv.Run(bytes.NewReader(s.sql)); err != nil {
+			return err
+		}
+	}
+	if err := m.state().SetVersion(migr.TargetVersion, false); err != nil {
+		return err
+	}
+	m.logPrintf("%v (%v)\n", migr.LogString(), time.Since(started))
+	if err := m.recordHistory(migr, time.Since(started)); err != nil {
+		return err
+	}
+	if m.OnApplied != nil {
+		m.OnApplied(migr)
+	}
+	return nil
+}
+
+// parseChangeScript splits the body of a change script into its
+// migrations, which start with a heading comment after an empty line.
+func parseChangeScript(body []byte) ([]changeScriptSection, error) {
+	var sections []changeScriptSection
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	previous := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		heading := changeScriptMigration.FindStringSubmatch(line)
+		if heading != nil && previous == "" {
+			version, err := strconv.ParseUint(heading[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version in change script: %v", err)
+			}
+			sections = append(sections, changeScriptSection{version: uint(version), identifier: heading[2]})
+		} else if len(sections) > 0 {
+			s := &sections[len(sections)-1]
+			s.sql = append(append(s.sql, line...), '\n')
+		} else if line != "" {
+			return nil, errors.New("change script doesn't start with a migration")
+		}
+		previous = line
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(sections) == 0 {
+		return nil, errors.New("change script contains no migration")
+	}
+	return sections, nil
+}
@@ -0,0 +1,75 @@
+package migrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestChangeScript(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2; INSERT 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "-- migrate:exec ./seed.sh"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+	db := dbDrv.(*dStub.Stub)
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var script bytes.Buffer
+	if err := m.WriteChangeScript(&script); err == nil || !strings.Contains(err.Error(), "not SQL") {
+		t.Fatalf("expected error for the exec migration, got %v", err)
+	}
+	if err := m.Migrate(1); err != nil {
+		t.Fatal(err)
+	}
+	script.Reset()
+	// without the exec migration
+	migrations = source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2; INSERT 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	if err := m.WriteChangeScript(&script); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(script.String(), "-- migrate:change-script-from 1\n-- migrate:change-script-checksum ") {
+		t.Fatalf("expected header, got\n%v", script.String())
+	}
+	if v, _, _ := m.Version(); v != 1 {
+		t.Fatalf("expected version 1 after writing the script, got %v", v)
+	}
+
+	if err := m.ApplyChangeScript(strings.NewReader(strings.Replace(script.String(), "INSERT 2", "DELETE 2", 1))); err != ErrChangeScriptModified {
+		t.Errorf("expected ErrChangeScriptModified, got %v", err)
+	}
+	if err := m.ApplyChangeScript(strings.NewReader("CREATE 2")); err != ErrNoChangeScript {
+		t.Errorf("expected ErrNoChangeScript, got %v", err)
+	}
+
+	ran := len(db.MigrationSequence)
+	if err := m.ApplyChangeScript(bytes.NewReader(script.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if v, dirty, _ := m.Version(); v != 3 || dirty {
+		t.Errorf("expected clean version 3, got %v, %v", v, dirty)
+	}
+	// 3 has no up migration and only sets the version
+	expected := []string{"CREATE 2;\nINSERT 2;\n\n"}
+	if got := db.MigrationSequence[ran:]; len(got) != 1 || got[0] != expected[0] {
+		t.Errorf("expected migrations %q, got %q", expected, got)
+	}
+
+	if err := m.ApplyChangeScript(bytes.NewReader(script.Bytes())); err != ErrChangeScriptOutdated {
+		t.Errorf("expected ErrChangeScriptOutdated, got %v", err)
+	}
+}
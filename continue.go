@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// ErrContinueTx is returned if ContinueOnError is set along with
+// AtomicBatch or DryRun, whose transaction is aborted by a failure.
+var ErrContinueTx = errors.New("a run can't continue on errors within the transaction of an atomic batch or dry run")
+
+// ErrContinueNoHistory is returned if ContinueOnError is set without
+// HistoryTable, which records the failed migrations for ApplySkipped.
+var ErrContinueNoHistory = errors.New("a run can't continue on errors without a history table to record the failures in")
+
+// MigrationFailure is a migration which failed in a run with
+// ContinueOnError.
+type MigrationFailure struct {
+	// Migration is the migration as logged, e.g. 3/u add_users
+	Migration string
+	Err       error
+}
+
+// ErrMigrationsFailed is returned with ContinueOnError if migrations
+// failed, once the others have been applied.
+type ErrMigrationsFailed struct {
+	Failures []MigrationFailure
+}
+
+func (e *ErrMigrationsFailed) Error() string {
+	lines := make([]string, 0, len(e.Failures)+1)
+	if len(e.Failures) == 1 {
+		lines = append(lines, "1 migration failed:")
+	} else {
+		lines = append(lines, fmt.Sprintf("%v migrations failed:", len(e.Failures)))
+	}
+	for _, f := range e.Failures {
+		lines = append(lines, fmt.Sprintf("\t* %v: %v", f.Migration, f.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkContinue returns ErrContinueNoHistory if ContinueOnError can't record
+// failures. Runs check it before they lock, as the version of a failed
+// migration is only set clean once it's recorded.
+func (m *Migrate) checkContinue() error {
+	if m.ContinueOnError && m.HistoryTable == "" {
+		return ErrContinueNoHistory
+	}
+	return nil
+}
+
+// skipFailed lets a run with ContinueOnError go on after migr failed with
+// err: the rest of its body is discarded, it is recorded as failed in
+// HistoryTable, so ApplySkipped retries it, and its version is set clean.
+func (m *Migrate) skipFailed(migr *Migration, body io.Reader, err error) error {
+	m.logPrintf("Failed %v, continuing: %v\n", migr.LogString(), err)
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return err
+	}
+	direction := source.Up
+	if migr.down() {
+		direction = source.Down
+	}
+	checksum, err := m.ranChecksum(migr, direction)
+	if err != nil {
+		return err
+	}
+	if err := m.record(migr, database.HistoryFailed, checksum, 0); err != nil {
+		return err
+	}
+	return m.state().SetVersion(migr.TargetVersion, false)
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestContinueOnError(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+	db := &failStub{Stub: dbDrv.(*dStub.Stub), failAfter: map[string]int{"CREATE 3": 0, "CREATE 7": 0}}
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ContinueOnError = true
+	if err := m.Up(); err != ErrContinueNoHistory {
+		t.Fatalf("expected ErrContinueNoHistory, got %v", err)
+	}
+	if len(db.MigrationSequence) != 0 {
+		t.Fatalf("expected no migrations applied, got %v", db.MigrationSequence)
+	}
+	m.HistoryTable = database.DefaultHistoryTable
+
+	err = m.Up()
+	failed, ok := err.(*ErrMigrationsFailed)
+	if !ok {
+		t.Fatalf("expected ErrMigrationsFailed, got %v", err)
+	}
+	var versions []string
+	for _, f := range failed.Failures {
+		versions = append(versions, f.Migration)
+	}
+	if expected := []string{"3/u 3.up.stub", "7/u 7.up.stub"}; !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected failures %v, got %v", expected, versions)
+	}
+	if expected := "2 migrations failed:\n\t* 3/u 3.up.stub: failed CREATE 3\n\t* 7/u 7.up.stub: failed CREATE 7"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+	if expected := []string{"CREATE 1", "CREATE 4"}; !reflect.DeepEqual(db.MigrationSequence, expected) {
+		t.Errorf("expected %v applied, got %v", expected, db.MigrationSequence)
+	}
+	if v, dirty, err := m.Version(); err != nil || v != 7 || dirty {
+		t.Errorf("expected clean version 7, got %v, %v, %v", v, dirty, err)
+	}
+	var recorded int
+	for _, query := range db.history {
+		if strings.Contains(query, "'"+database.HistoryFailed+"'") {
+			recorded++
+		}
+	}
+	if recorded != 2 {
+		t.Errorf("expected 2 failures recorded, got %v", db.history)
+	}
+
+	m.AtomicBatch = true
+	if err := m.Down(); err != ErrContinueTx {
+		t.Errorf("expected ErrContinueTx, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAuditTable is the conventional table of an AuditTable.
+var DefaultAuditTable = "schema_migrations_audit"
+
+// maxAuditLength limits the length of the string columns of an AuditTable.
+const maxAuditLength = 1024
+
+// AuditRecord describes a run of migrate.
+type AuditRecord struct {
+	User     string
+	Hostname string
+	// Client is the program running migrations, e.g. its name and version.
+	Client string
+	// Source identifies the migrations, e.g. the source URL without credentials.
+	Source  string
+	Command string
+	Target  string
+	// Result is "ok", "no change" or the error of the run.
+	Result   string
+	Started  time.Time
+	Duration time.Duration
+}
+
+// AuditTable records AuditRecords as rows of a table, for SQL databases.
+type AuditTable struct {
+	Driver Driver
+	Table  string
+}
+
+// Record creates the audit table if necessary and inserts r.
+func (a *AuditTable) Record(r AuditRecord) error {
+	if err := createTable(a.Driver, a.Table, "username VARCHAR(255), hostname VARCHAR(255), client VARCHAR(255), "+
+		"source VARCHAR(1024), command VARCHAR(32), target VARCHAR(32), result VARCHAR(1024), started_at VARCHAR(32), "+
+		"duration_ms BIGINT"); err != nil {
+		return err
+	}
+
+	values := []string{r.User, r.Hostname, r.Client, r.Source, r.Command, r.Target, r.Result, r.Started.UTC().Format(time.RFC3339)}
+	for i, v := range values {
+		if len(v) > maxAuditLength {
+			v = v[:maxAuditLength]
+		}
+		values[i] = quote(v)
+	}
+	query := "INSERT INTO " + quotedTable(a.Driver, a.Table) + " (username, hostname, client, source, command, target, result, started_at, duration_ms) " +
+		"VALUES (" + strings.Join(values, ", ") + ", " + strconv.FormatInt(int64(r.Duration/time.Millisecond), 10) + ")"
+	if err := a.Driver.Run(strings.NewReader(query)); err != nil {
+		return &Error{OrigErr: err, Err: "audit failed", Query: []byte(query)}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultBackfillTable is the conventional table of a BackfillTable.
+var DefaultBackfillTable = "schema_migrations_backfill"
+
+// BackfillTable keeps the progress of backfill migrations as rows of a
+// table, for SQL databases, so that a failed backfill resumes after the
+// last completed batch. The driver must implement Querier.
+type BackfillTable struct {
+	Driver Driver
+	Table  string
+}
+
+// Create creates the backfill table unless it exists. Last creates it.
+func (b *BackfillTable) Create() error {
+	return createTable(b.Driver, b.Table, "version BIGINT, last_key VARCHAR(1024)")
+}
+
+// Last returns the key, as SQL literal, up to which the backfill of version
+// completed, or "" if it didn't start.
+func (b *BackfillTable) Last(version uint) (string, error) {
+	q, ok := b.Driver.(Querier)
+	if !ok {
+		return "", fmt.Errorf("database driver can't query the backfill table")
+	}
+	// once per backfill, Save runs within its transaction
+	if err := b.Create(); err != nil {
+		return "", err
+	}
+	rows, err := q.Query("SELECT last_key FROM " + quotedTable(b.Driver, b.Table) + " WHERE version = " + strconv.FormatUint(uint64(version), 10))
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	return fmt.Sprint(rows[0]["last_key"]), nil
+}
+
+// Save records that the backfill of version completed up to the key last,
+// an SQL literal. The table must exist, see Create.
+func (b *BackfillTable) Save(version uint, last string) error {
+	if err := b.Clear(version); err != nil {
+		return err
+	}
+	query := "INSERT INTO " + quotedTable(b.Driver, b.Table) + " (version, last_key) VALUES (" + strconv.FormatUint(uint64(version), 10) + ", " + quote(last) + ")"
+	if err := b.Driver.Run(strings.NewReader(query)); err != nil {
+		return &Error{OrigErr: err, Err: "backfill progress failed", Query: []byte(query)}
+	}
+	return nil
+}
+
+// Clear removes the progress of the backfill of version, e.g. once it
+// completed.
+func (b *BackfillTable) Clear(version uint) error {
+	return b.Driver.Run(strings.NewReader("DELETE FROM " + quotedTable(b.Driver, b.Table) + " WHERE version = " + strconv.FormatUint(uint64(version), 10)))
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/gocql/gocql"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
 	"github.com/hashicorp/go-multierror"
 )
 
@@ -173,15 +174,10 @@ func (c *Cassandra) Run(migration io.Reader) error {
 	query := string(migr[:])
 
 	if c.config.MultiStatementEnabled {
-		// split query by semi-colon
-		queries := strings.Split(query, ";")
-
-		for _, q := range queries {
-			tq := strings.TrimSpace(q)
-			if tq == "" {
-				continue
-			}
-			if err := c.session.Query(tq).Exec(); err != nil {
+		// split query by semi-colon or the delimiter pragma
+		delimiter := multistmt.Delimiter(migr, multistmt.DefaultDelimiter)
+		for _, q := range multistmt.Split(migr, delimiter) {
+			if err := c.session.Query(string(q)).Exec(); err != nil {
 				// TODO: cast to Cassandra error and get line number
 				return database.Error{OrigErr: err, Err: "migration failed", Query: migr}
 			}
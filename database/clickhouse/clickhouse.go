@@ -6,11 +6,14 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
-	"strings"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
 	"github.com/hashicorp/go-multierror"
 )
 
@@ -18,6 +21,9 @@ var DefaultMigrationsTable = "schema_migrations"
 
 var ErrNilConfig = fmt.Errorf("no config")
 
+// tlsConfigs numbers the TLS configs registered for x-tls- queries
+var tlsConfigs int64
+
 type Config struct {
 	DatabaseName          string
 	MigrationsTable       string
@@ -52,6 +58,20 @@ func WithInstance(conn *sql.DB, config *Config) (database.Driver, error) {
 type ClickHouse struct {
 	conn   *sql.DB
 	config *Config
+
+	// sharedDB is set by WithSQLInstance, conn is owned by the caller then
+	sharedDB bool
+}
+
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (ch *ClickHouse) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*ClickHouse).sharedDB = true
+	return d, nil
 }
 
 func (ch *ClickHouse) Open(dsn string) (database.Driver, error) {
@@ -59,12 +79,43 @@ func (ch *ClickHouse) Open(dsn string) (database.Driver, error) {
 	if err != nil {
 		return nil, err
 	}
+	params, err := database.ParseConnParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	tlsParams, err := database.ParseTLSParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
 	q := migrate.FilterCustomQuery(purl)
 	q.Scheme = "tcp"
+	values := q.Query()
+	if params.ConnectTimeout > 0 {
+		values.Set("timeout", strconv.FormatFloat(params.ConnectTimeout.Seconds(), 'f', -1, 64))
+	}
+	if params.ReadTimeout > 0 {
+		values.Set("read_timeout", strconv.FormatFloat(params.ReadTimeout.Seconds(), 'f', -1, 64))
+	}
+	if tlsParams.IsSet() {
+		tlsConfig, err := tlsParams.Config()
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("migrate-tls-%d", atomic.AddInt64(&tlsConfigs, 1))
+		if err := clickhouse.RegisterTLSConfig(name, tlsConfig); err != nil {
+			return nil, err
+		}
+		values.Set("tls_config", name)
+		values.Set("secure", "true")
+		// the driver overrides InsecureSkipVerify of the config with skip_verify
+		values.Set("skip_verify", strconv.FormatBool(tlsParams.InsecureSkipVerify))
+	}
+	q.RawQuery = values.Encode()
 	conn, err := sql.Open("clickhouse", q.String())
 	if err != nil {
 		return nil, err
 	}
+	params.Apply(conn)
 
 	ch = &ClickHouse{
 		conn: conn,
@@ -103,15 +154,11 @@ func (ch *ClickHouse) Run(r io.Reader) error {
 	}
 
 	if ch.config.MultiStatementEnabled {
-		// split query by semi-colon
-		queries := strings.Split(string(migration), ";")
-		for _, q := range queries {
-			tq := strings.TrimSpace(q)
-			if tq == "" {
-				continue
-			}
-			if _, err := ch.conn.Exec(q); err != nil {
-				return database.Error{OrigErr: err, Err: "migration failed", Query: []byte(q)}
+		// split query by semi-colon or the delimiter pragma
+		delimiter := multistmt.Delimiter(migration, multistmt.DefaultDelimiter)
+		for _, q := range multistmt.Split(migration, delimiter) {
+			if _, err := ch.conn.Exec(string(q)); err != nil {
+				return database.Error{OrigErr: err, Err: "migration failed", Query: q}
 			}
 		}
 		return nil
@@ -233,4 +280,9 @@ func (ch *ClickHouse) Drop() (err error) {
 
 func (ch *ClickHouse) Lock() error   { return nil }
 func (ch *ClickHouse) Unlock() error { return nil }
-func (ch *ClickHouse) Close() error  { return ch.conn.Close() }
+func (ch *ClickHouse) Close() error {
+	if ch.sharedDB {
+		return nil
+	}
+	return ch.conn.Close()
+}
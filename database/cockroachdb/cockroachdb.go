@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	nurl "net/url"
-	"regexp"
 	"strconv"
 )
 
@@ -20,6 +18,7 @@ import (
 import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
 )
 
 func init() {
@@ -50,6 +49,9 @@ type CockroachDb struct {
 
 	// Open and WithInstance need to guarantee that config is never nil
 	config *Config
+
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
 }
 
 func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
@@ -100,18 +102,34 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	return px, nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (c *CockroachDb) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*CockroachDb).sharedDB = true
+	return d, nil
+}
+
 func (c *CockroachDb) Open(url string) (database.Driver, error) {
-	purl, err := nurl.Parse(url)
+	purl, err := postgres.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := database.ParseConnParams(purl.Query())
 	if err != nil {
 		return nil, err
 	}
 
 	// As Cockroach uses the postgres protocol, and 'postgres' is already a registered database, we need to replace the
 	// connect prefix, with the actual protocol, so that the library can differentiate between the implementations
-	re := regexp.MustCompile("^(cockroach(db)?|crdb-postgres)")
-	connectString := re.ReplaceAllString(migrate.FilterCustomQuery(purl).String(), "postgres")
+	connURL := migrate.FilterCustomQuery(purl)
+	connURL.Scheme = "postgres"
 
-	db, err := sql.Open("postgres", connectString)
+	db, err := postgres.OpenDB(connURL, params)
 	if err != nil {
 		return nil, err
 	}
@@ -146,6 +164,9 @@ func (c *CockroachDb) Open(url string) (database.Driver, error) {
 }
 
 func (c *CockroachDb) Close() error {
+	if c.sharedDB {
+		return nil
+	}
 	return c.db.Close()
 }
 
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	nurl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/proxy"
+)
+
+// URL parameters tuning the connection pool and timeouts of SQL drivers.
+// Durations use Go syntax, e.g. 30s or 5m.
+const (
+	ParamMaxOpenConns    = "x-max-open-conns"
+	ParamConnMaxLifetime = "x-conn-max-lifetime"
+	ParamConnectTimeout  = "x-connect-timeout"
+	ParamReadTimeout     = "x-read-timeout"
+)
+
+// ErrTimeoutUnsupported is returned by drivers which can't apply
+// x-connect-timeout or x-read-timeout, e.g. embedded databases.
+var ErrTimeoutUnsupported = errors.New("connect and read timeouts are not supported by this driver")
+
+// ConnParams are the connection pool and timeout settings given as URL
+// parameters. Zero values keep the defaults of database/sql and the driver.
+type ConnParams struct {
+	MaxOpenConns    int
+	ConnMaxLifetime time.Duration
+
+	// ConnectTimeout bounds dialing and the handshake of new connections.
+	ConnectTimeout time.Duration
+
+	// ReadTimeout bounds every read from the server, so a connection closed
+	// silently by the server fails instead of blocking forever.
+	ReadTimeout time.Duration
+}
+
+// ParseConnParams reads the connection parameters from the query of a URL.
+func ParseConnParams(q nurl.Values) (ConnParams, error) {
+	var p ConnParams
+	if s := q.Get(ParamMaxOpenConns); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid %v %q: expected a non-negative integer", ParamMaxOpenConns, s)
+		}
+		p.MaxOpenConns = n
+	}
+	durations := []struct {
+		param string
+		d     *time.Duration
+	}{
+		{ParamConnMaxLifetime, &p.ConnMaxLifetime},
+		{ParamConnectTimeout, &p.ConnectTimeout},
+		{ParamReadTimeout, &p.ReadTimeout},
+	}
+	for _, v := range durations {
+		s := q.Get(v.param)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return p, fmt.Errorf("invalid %v %q: expected a duration like 30s", v.param, s)
+		}
+		*v.d = d
+	}
+	return p, nil
+}
+
+// ParseTimeout parses a statement timeout, given either as a number of
+// milliseconds or as a duration like 30s.
+func ParseTimeout(s string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(s); err == nil && ms >= 0 {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q: expected milliseconds or a duration like 30s", s)
+	}
+	return d, nil
+}
+
+// HasTimeouts reports whether ConnectTimeout or ReadTimeout is set.
+func (p ConnParams) HasTimeouts() bool {
+	return p.ConnectTimeout > 0 || p.ReadTimeout > 0
+}
+
+// Apply sets the pool settings on db.
+func (p ConnParams) Apply(db *sql.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+}
+
+// Seconds rounds d up to whole seconds, for drivers taking timeouts in
+// seconds. It returns "" for zero.
+func Seconds(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// Dialer dials TCP connections through the proxy in effect, see package
+// proxy, and unix connections, and applies ReadTimeout to every read. It
+// satisfies the dialer interfaces of lib/pq.
+type Dialer struct {
+	ReadTimeout time.Duration
+}
+
+// Dial implements pq.Dialer.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout implements pq.Dialer.
+func (d *Dialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+// DialContext implements pq.DialerContext.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := proxy.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if d.ReadTimeout <= 0 {
+		return c, nil
+	}
+	return &readTimeoutConn{Conn: c, timeout: d.ReadTimeout}, nil
+}
+
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// OpenDB returns a *sql.DB of drv whose connections are opened by open, e.g.
+// a driver's dial function bound to a Dialer and a DSN.
+func OpenDB(drv driver.Driver, open func() (driver.Conn, error)) *sql.DB {
+	return sql.OpenDB(&funcConnector{drv: drv, open: open})
+}
+
+type funcConnector struct {
+	drv  driver.Driver
+	open func() (driver.Conn, error)
+}
+
+func (c *funcConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.open()
+}
+
+func (c *funcConnector) Driver() driver.Driver {
+	return c.drv
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"net"
+	nurl "net/url"
+	"testing"
+	"time"
+)
+
+func TestParseConnParams(t *testing.T) {
+	cases := []struct {
+		query string
+		want  ConnParams
+		err   bool
+	}{
+		{"", ConnParams{}, false},
+		{"x-max-open-conns=4&x-conn-max-lifetime=5m", ConnParams{MaxOpenConns: 4, ConnMaxLifetime: 5 * time.Minute}, false},
+		{"x-connect-timeout=10s&x-read-timeout=1m30s", ConnParams{ConnectTimeout: 10 * time.Second, ReadTimeout: 90 * time.Second}, false},
+		{"x-max-open-conns=many", ConnParams{}, true},
+		{"x-max-open-conns=-1", ConnParams{}, true},
+		{"x-read-timeout=30", ConnParams{}, true},
+		{"x-connect-timeout=-1s", ConnParams{}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			q, err := nurl.ParseQuery(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := ParseConnParams(q)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p != c.want {
+				t.Fatalf("expected %+v, got %+v", c.want, p)
+			}
+		})
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"0":     0,
+		"1500":  1500 * time.Millisecond,
+		"30s":   30 * time.Second,
+		"1m30s": 90 * time.Second,
+	}
+	for s, want := range cases {
+		got, err := ParseTimeout(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("ParseTimeout(%q): expected %v, got %v", s, want, got)
+		}
+	}
+	for _, s := range []string{"", "-1", "-1s", "soon"} {
+		if _, err := ParseTimeout(s); err == nil {
+			t.Errorf("ParseTimeout(%q): expected error", s)
+		}
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                       "",
+		time.Second:             "1",
+		1500 * time.Millisecond: "2",
+		time.Minute:             "60",
+	}
+	for d, want := range cases {
+		if got := Seconds(d); got != want {
+			t.Errorf("Seconds(%v): expected %q, got %q", d, want, got)
+		}
+	}
+}
+
+func TestDialerReadTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// accept without ever writing, like a server which dropped the connection
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second)
+	}()
+
+	d := &Dialer{ReadTimeout: 50 * time.Millisecond}
+	conn, err := d.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Read(make([]byte, 1))
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
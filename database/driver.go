@@ -5,9 +5,14 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 	"io"
+	nurl "net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	iurl "github.com/golang-migrate/migrate/v4/internal/url"
 )
@@ -15,8 +20,21 @@ import (
 var (
 	ErrLocked    = fmt.Errorf("can't acquire lock")
 	ErrNotLocked = fmt.Errorf("can't unlock, as not currently locked")
+	ErrInTx      = fmt.Errorf("transaction already in progress")
+	ErrNotInTx   = fmt.Errorf("no transaction in progress")
+
+	// ErrNoTransaction is returned by Run for a migration which must not run
+	// within a transaction, while a transaction is in progress.
+	ErrNoTransaction = fmt.Errorf("migration can't run within a transaction")
+
+	// ErrReadOnly is returned by Lock of a driver opened read-only.
+	ErrReadOnly = fmt.Errorf("database opened read-only")
 )
 
+// ParamReadOnly, set to true in the URL, opens a driver read-only, see
+// ReadOnlyDriver. Drivers which don't implement it fail to open.
+const ParamReadOnly = "x-read-only"
+
 const NilVersion int = -1
 
 var driversMu sync.RWMutex
@@ -26,9 +44,11 @@ var drivers = make(map[string]Driver)
 //
 // How to implement a database driver?
 //   1. Implement this interface.
-//   2. Optionally, add a function named `WithInstance`.
-//      This function should accept an existing DB instance and a Config{} struct
-//      and return a driver instance.
+//   2. Add a function named `WithInstance`.
+//      This function should accept an existing DB instance (e.g. *sql.DB, or
+//      the client of the database's Go driver) and a Config{} struct
+//      and return a driver instance. Drivers using *sql.DB also implement
+//      SQLInstancer, see database/testing.go:TestWithSQLInstance().
 //   3. Add a test that calls database/testing.go:Test()
 //   4. Add own tests for Open(), WithInstance() (when provided) and Close().
 //      All other functions are tested by tests in database/testing.
@@ -81,6 +101,82 @@ type Driver interface {
 	Drop() error
 }
 
+// TableCreator is an optional interface a driver can implement if it can
+// create a table unless it exists without failing, e.g. with CREATE TABLE IF
+// NOT EXISTS. migrate creates its own tables, e.g. HistoryTable, with it:
+// a failed CREATE TABLE would abort the transaction of a run on databases
+// like Postgres.
+type TableCreator interface {
+	// CreateTable creates table with the column definitions columns,
+	// unless it exists.
+	CreateTable(table, columns string) error
+}
+
+// IdentifierQuoter is an optional interface a driver can implement to quote
+// the names of migrate's own tables, e.g. HistoryTable, in the statements
+// migrate runs on them, see QuoteTable.
+type IdentifierQuoter interface {
+	// QuoteIdentifier returns name quoted as an identifier.
+	QuoteIdentifier(name string) string
+}
+
+// LagChecker is an optional interface a driver can implement to report the
+// replication lag of the database. Migrate uses it to throttle between
+// migrations, see migrate.Migrate.ReplicationLagQuery.
+type LagChecker interface {
+	// ReplicationLag runs the user supplied query, which must return a single
+	// numeric value: the current replication lag in seconds.
+	// A NULL value is treated as no lag.
+	ReplicationLag(query string) (time.Duration, error)
+}
+
+// Transactional is an optional interface a driver can implement if the
+// database supports transactional DDL. Migrate uses it to apply several
+// migrations within a single transaction, see migrate.Migrate.AtomicBatch.
+type Transactional interface {
+	// Begin starts a transaction. All calls to Run and SetVersion are part
+	// of this transaction until Commit or Rollback is called.
+	Begin() error
+
+	// Commit commits the transaction started with Begin.
+	Commit() error
+
+	// Rollback aborts the transaction started with Begin.
+	Rollback() error
+}
+
+// SQLInstancer is an optional interface a registered driver can implement to
+// create driver instances from an existing *sql.DB, see WithSQLInstance.
+type SQLInstancer interface {
+	// WithSQLInstance returns a new driver instance using instance with the
+	// default config. Closing the driver instance must not close instance,
+	// which stays owned by the caller.
+	WithSQLInstance(instance *sql.DB) (Driver, error)
+}
+
+// ReadOnlyDriver is an optional interface a driver can implement if it can be
+// opened with ParamReadOnly, for accounts with read-only credentials. Opened
+// read-only, a driver doesn't create its version table, Lock returns
+// ErrReadOnly and, where the database supports it, its session rejects
+// writes. Version returns NilVersion if the version table doesn't exist.
+type ReadOnlyDriver interface {
+	// ReadOnly reports whether the driver instance was opened read-only.
+	ReadOnly() bool
+}
+
+// ParseReadOnly reads ParamReadOnly from the query of a URL.
+func ParseReadOnly(q nurl.Values) (bool, error) {
+	s := q.Get(ParamReadOnly)
+	if s == "" {
+		return false, nil
+	}
+	readOnly, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid %v %q: %v", ParamReadOnly, s, err)
+	}
+	return readOnly, nil
+}
+
 // Open returns a new driver instance.
 func Open(url string) (Driver, error) {
 	scheme, err := iurl.SchemeFromURL(url)
@@ -95,9 +191,38 @@ func Open(url string) (Driver, error) {
 		return nil, fmt.Errorf("database driver: unknown driver %v (forgotten import?)", scheme)
 	}
 
+	// checked before Open, which may write, e.g. create the version table.
+	// Only the query is parsed, not every driver URL is a valid net/url URL.
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		q, _ := nurl.ParseQuery(url[i+1:])
+		readOnly, err := ParseReadOnly(q)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := d.(ReadOnlyDriver); readOnly && !ok {
+			return nil, fmt.Errorf("database driver: %v can't be opened read-only", scheme)
+		}
+	}
+
 	return d.Open(url)
 }
 
+// WithSQLInstance returns a new instance of the registered driver name using
+// the existing instance, e.g. the connection pool of an application.
+func WithSQLInstance(name string, instance *sql.DB) (Driver, error) {
+	driversMu.RLock()
+	d, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("database driver: unknown driver %v (forgotten import?)", name)
+	}
+	instancer, ok := d.(SQLInstancer)
+	if !ok {
+		return nil, fmt.Errorf("database driver: %v can't use an existing *sql.DB", name)
+	}
+	return instancer.WithSQLInstance(instance)
+}
+
 // Register globally registers a driver.
 func Register(name string, driver Driver) {
 	driversMu.Lock()
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"io"
+	"strings"
+)
+
+// Dumper is an optional interface a driver can implement to write the schema
+// of the database as SQL statements, see migrate.Migrate.DumpSchema. The dump
+// is canonical: the same schema always results in the same dump, independent
+// of the data, so dumps can be diffed and reviewed.
+type Dumper interface {
+	// DumpSchema writes the statements creating the tables, indexes and,
+	// where supported, views of the database to w, each terminated by a
+	// semicolon and an empty line. The version table and the tables in exclude are left out.
+	DumpSchema(w io.Writer, exclude []string) error
+}
+
+// WriteStatements writes stmts to w in the format of Dumper.DumpSchema.
+func WriteStatements(w io.Writer, stmts []string) error {
+	for _, s := range stmts {
+		s = strings.TrimRight(strings.TrimSpace(s), ";")
+		if _, err := io.WriteString(w, s+";\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFingerprintTable is the conventional table of a FingerprintTable.
+var DefaultFingerprintTable = "schema_migrations_fingerprint"
+
+// ErrNoFingerprint is returned by FingerprintTable.Load if no fingerprint
+// was stored yet.
+var ErrNoFingerprint = fmt.Errorf("no schema fingerprint stored")
+
+// SchemaObject is a column or an index of a table.
+type SchemaObject struct {
+	Table string
+	// Kind is "column" or "index"
+	Kind string
+	Name string
+	// Definition is the type, nullability and default of a column,
+	// or the definition of an index.
+	Definition string
+}
+
+func (o SchemaObject) String() string {
+	return o.Table + " " + o.Kind + " " + o.Name + " " + o.Definition
+}
+
+// Introspector is an optional interface a driver can implement to describe
+// the schema of the database, for schema drift detection, see
+// migrate.Migrate.FingerprintTable.
+type Introspector interface {
+	// Schema returns the columns and indexes of the tables of the database,
+	// except those of the version table.
+	Schema() ([]SchemaObject, error)
+}
+
+// Fingerprint hashes the schema objects, except those of the tables in
+// exclude, e.g. migrate's own tables. The order of objects doesn't matter.
+func Fingerprint(objects []SchemaObject, exclude ...string) string {
+	skip := make(map[string]bool, len(exclude))
+	for _, t := range exclude {
+		skip[strings.ToLower(t)] = true
+	}
+	lines := make([]string, 0, len(objects))
+	for _, o := range objects {
+		if !skip[strings.ToLower(o.Table)] {
+			lines = append(lines, o.String())
+		}
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// StoredFingerprint is the fingerprint of the schema after a run of migrate.
+type StoredFingerprint struct {
+	Fingerprint string
+	Version     int
+	Created     time.Time
+}
+
+// FingerprintTable stores the fingerprint of the latest run in a table, for
+// SQL databases. Load requires a driver implementing Querier.
+type FingerprintTable struct {
+	Driver Driver
+	Table  string
+}
+
+// Store creates the fingerprint table if necessary and replaces the stored
+// fingerprint with f.
+func (t *FingerprintTable) Store(f StoredFingerprint) error {
+	if err := createTable(t.Driver, t.Table, "fingerprint VARCHAR(64), version BIGINT, created_at VARCHAR(32)"); err != nil {
+		return err
+	}
+
+	query := "DELETE FROM " + quotedTable(t.Driver, t.Table)
+	if err := t.Driver.Run(strings.NewReader(query)); err != nil {
+		return &Error{OrigErr: err, Err: "fingerprint failed", Query: []byte(query)}
+	}
+	query = "INSERT INTO " + quotedTable(t.Driver, t.Table) + " (fingerprint, version, created_at) VALUES (" + quote(f.Fingerprint) + ", " +
+		strconv.Itoa(f.Version) + ", " + quote(f.Created.UTC().Format(time.RFC3339)) + ")"
+	if err := t.Driver.Run(strings.NewReader(query)); err != nil {
+		return &Error{OrigErr: err, Err: "fingerprint failed", Query: []byte(query)}
+	}
+	return nil
+}
+
+// Load returns the stored fingerprint, or ErrNoFingerprint. A missing table
+// is an error of the database.
+func (t *FingerprintTable) Load() (*StoredFingerprint, error) {
+	q, ok := t.Driver.(Querier)
+	if !ok {
+		return nil, fmt.Errorf("database driver can't query the fingerprint table")
+	}
+	rows, err := q.Query("SELECT fingerprint, version, created_at FROM " + quotedTable(t.Driver, t.Table))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNoFingerprint
+	}
+	f := &StoredFingerprint{
+		Fingerprint: fmt.Sprint(rows[0]["fingerprint"]),
+	}
+	if f.Version, err = strconv.Atoi(fmt.Sprint(rows[0]["version"])); err != nil {
+		return nil, fmt.Errorf("invalid version in %v: %v", t.Table, err)
+	}
+	if f.Created, err = time.Parse(time.RFC3339, fmt.Sprint(rows[0]["created_at"])); err != nil {
+		return nil, fmt.Errorf("invalid created_at in %v: %v", t.Table, err)
+	}
+	return f, nil
+}
+
+// QuerySchema implements Introspector.Schema for database/sql based drivers.
+// query must return the table, the name and the definition of objects of
+// kind.
+func QuerySchema(q SQLQueryer, kind string, query string, args ...interface{}) ([]SchemaObject, error) {
+	rows, err := q.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, &Error{OrigErr: err, Query: []byte(query)}
+	}
+	defer rows.Close()
+
+	objects := make([]SchemaObject, 0)
+	for rows.Next() {
+		o := SchemaObject{Kind: kind}
+		if err := rows.Scan(&o.Table, &o.Name, &o.Definition); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &Error{OrigErr: err, Query: []byte(query)}
+	}
+	return objects, nil
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	objects := []SchemaObject{
+		{Table: "pets", Kind: "column", Name: "name", Definition: "text NOT NULL"},
+		{Table: "pets", Kind: "index", Name: "pets_name", Definition: "CREATE INDEX pets_name ON pets (name)"},
+		{Table: "schema_lock", Kind: "column", Name: "lock_id", Definition: "integer NOT NULL"},
+	}
+	reordered := []SchemaObject{objects[2], objects[1], objects[0]}
+	fingerprint := Fingerprint(objects)
+	if f := Fingerprint(reordered); f != fingerprint {
+		t.Errorf("expected the order not to matter, got %v and %v", fingerprint, f)
+	}
+
+	if f := Fingerprint(objects, "SCHEMA_LOCK"); f != Fingerprint(objects[:2]) {
+		t.Error("expected excluded tables not to be hashed")
+	}
+
+	changed := append([]SchemaObject{}, objects...)
+	changed[0].Definition = "text"
+	if f := Fingerprint(changed); f == fingerprint {
+		t.Error("expected a changed column to change the fingerprint")
+	}
+}
@@ -40,6 +40,9 @@ type Firebird struct {
 
 	// Open and WithInstance need to guarantee that config is never nil
 	config *Config
+
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
 }
 
 func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
@@ -73,16 +76,36 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	return fb, nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (f *Firebird) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*Firebird).sharedDB = true
+	return d, nil
+}
+
 func (f *Firebird) Open(dsn string) (database.Driver, error) {
 	purl, err := nurl.Parse(dsn)
 	if err != nil {
 		return nil, err
 	}
 
+	params, err := database.ParseConnParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	if params.HasTimeouts() {
+		return nil, database.ErrTimeoutUnsupported
+	}
+
 	db, err := sql.Open("firebirdsql", migrate.FilterCustomQuery(purl).String())
 	if err != nil {
 		return nil, err
 	}
+	params.Apply(db)
 
 	px, err := WithInstance(db, &Config{
 		MigrationsTable: purl.Query().Get("x-migrations-table"),
@@ -98,6 +121,9 @@ func (f *Firebird) Open(dsn string) (database.Driver, error) {
 
 func (f *Firebird) Close() error {
 	connErr := f.conn.Close()
+	if f.sharedDB {
+		return connErr
+	}
 	dbErr := f.db.Close()
 	if connErr != nil || dbErr != nil {
 		return fmt.Errorf("conn: %v, db: %v", connErr, dbErr)
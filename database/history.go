@@ -0,0 +1,107 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHistoryTable is the conventional table of a HistoryTable.
+var DefaultHistoryTable = "schema_migrations_history"
+
+// HistoryRecord describes an applied migration.
+type HistoryRecord struct {
+	Version uint
+	// Direction is "up" or "down", HistorySkip or HistoryFailed.
+	Direction  string
+	Identifier string
+	// Checksum is the SHA-256 of the migration file, see manifest.Checksum,
+	// or empty for a version without migration file.
+	Checksum string
+	User     string
+	Hostname string
+	Applied  time.Time
+	Duration time.Duration
+}
+
+// HistorySkip is the Direction of a migration which was skipped as its
+// tags weren't selected, see migrate.Migrate.SelectTags.
+const HistorySkip = "skip"
+
+// HistoryFailed is the Direction of a migration which failed in a run
+// which continued, see migrate.Migrate.ContinueOnError.
+const HistoryFailed = "failed"
+
+// historyTimeFormat has a fixed width, so that applied_at sorts in order.
+const historyTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// HistoryTable records HistoryRecords as rows of a table, for SQL databases.
+// List needs a driver implementing Querier.
+type HistoryTable struct {
+	Driver Driver
+	Table  string
+}
+
+// Create creates the history table unless it exists. A run creates it once
+// before its transaction, as Record runs within it.
+func (h *HistoryTable) Create() error {
+	return createTable(h.Driver, h.Table, "version BIGINT, direction VARCHAR(4), identifier VARCHAR(1024), "+
+		"checksum VARCHAR(64), username VARCHAR(255), hostname VARCHAR(255), applied_at VARCHAR(32), duration_ms BIGINT")
+}
+
+// Record inserts r into the history table, see Create.
+func (h *HistoryTable) Record(r HistoryRecord) error {
+	values := []string{r.Direction, r.Identifier, r.Checksum, r.User, r.Hostname, r.Applied.UTC().Format(historyTimeFormat)}
+	for i, v := range values {
+		if len(v) > maxAuditLength {
+			v = v[:maxAuditLength]
+		}
+		values[i] = quote(v)
+	}
+	query := "INSERT INTO " + quotedTable(h.Driver, h.Table) + " (version, direction, identifier, checksum, username, hostname, applied_at, duration_ms) " +
+		"VALUES (" + strconv.FormatUint(uint64(r.Version), 10) + ", " + strings.Join(values, ", ") + ", " +
+		strconv.FormatInt(int64(r.Duration/time.Millisecond), 10) + ")"
+	if err := h.Driver.Run(strings.NewReader(query)); err != nil {
+		return &Error{OrigErr: err, Err: "history failed", Query: []byte(query)}
+	}
+	return nil
+}
+
+// List returns the records in the order the migrations were applied.
+func (h *HistoryTable) List() ([]HistoryRecord, error) {
+	q, ok := h.Driver.(Querier)
+	if !ok {
+		return nil, fmt.Errorf("database driver can't query the history table")
+	}
+	rows, err := q.Query("SELECT version, direction, identifier, checksum, username, hostname, applied_at, duration_ms FROM " +
+		quotedTable(h.Driver, h.Table) + " ORDER BY applied_at")
+	if err != nil {
+		return nil, err
+	}
+	records := make([]HistoryRecord, 0, len(rows))
+	for _, row := range rows {
+		r := HistoryRecord{
+			Direction:  fmt.Sprint(row["direction"]),
+			Identifier: fmt.Sprint(row["identifier"]),
+			Checksum:   fmt.Sprint(row["checksum"]),
+			User:       fmt.Sprint(row["username"]),
+			Hostname:   fmt.Sprint(row["hostname"]),
+		}
+		version, err := strconv.ParseUint(fmt.Sprint(row["version"]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version in %v: %v", h.Table, err)
+		}
+		r.Version = uint(version)
+		if r.Applied, err = time.Parse(time.RFC3339, fmt.Sprint(row["applied_at"])); err != nil {
+			return nil, fmt.Errorf("invalid applied_at in %v: %v", h.Table, err)
+		}
+		ms, err := strconv.ParseInt(fmt.Sprint(row["duration_ms"]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration_ms in %v: %v", h.Table, err)
+		}
+		r.Duration = time.Duration(ms) * time.Millisecond
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Loader is an optional interface a driver can implement to bulk load rows
+// into a table, e.g. for migrations with the `load` pragma.
+type Loader interface {
+	// Load inserts the rows returned by next into columns of table until next
+	// returns io.EOF, and returns the number of loaded rows. Values are nil,
+	// bool, int64, float64 or string.
+	Load(table string, columns []string, next func() ([]interface{}, error)) (int64, error)
+}
+
+// MaxInsertArgs limits the number of arguments of the statements of InsertRows.
+var MaxInsertArgs = 999
+
+// MaxInsertRows limits the number of rows inserted by one statement of InsertRows.
+var MaxInsertRows = 500
+
+// Placeholder returns the placeholder of argument i, counting from 1.
+type Placeholder func(i int) string
+
+// QuestionMark is the Placeholder of e.g. MySQL and SQLite.
+func QuestionMark(i int) string {
+	return "?"
+}
+
+// Dollar is the Placeholder of PostgreSQL, e.g. $1.
+func Dollar(i int) string {
+	return "$" + strconv.Itoa(i)
+}
+
+// InsertRows implements Loader.Load for database/sql based drivers with
+// batched multi-row INSERT statements. quoteIdent quotes the names of columns.
+func InsertRows(q SQLQueryer, table string, columns []string, next func() ([]interface{}, error), quoteIdent func(name string) string, placeholder Placeholder) (int64, error) {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = quoteIdent(c)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %v (%v) VALUES ", table, strings.Join(quoted, ", "))
+
+	batch := MaxInsertArgs / len(columns)
+	if batch > MaxInsertRows {
+		batch = MaxInsertRows
+	}
+	if batch < 1 {
+		batch = 1
+	}
+
+	var loaded int64
+	args := make([]interface{}, 0, batch*len(columns))
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		rows := len(args) / len(columns)
+		var query strings.Builder
+		query.WriteString(prefix)
+		for i := range args {
+			switch {
+			case i%len(columns) == 0 && i > 0:
+				query.WriteString("), (")
+			case i%len(columns) == 0:
+				query.WriteString("(")
+			default:
+				query.WriteString(", ")
+			}
+			query.WriteString(placeholder(i + 1))
+		}
+		query.WriteString(")")
+		if _, err := ExecRows(q, query.String(), args...); err != nil {
+			return err
+		}
+		loaded += int64(rows)
+		args = args[:0]
+		return nil
+	}
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return loaded, err
+		}
+		if len(row) != len(columns) {
+			return loaded, fmt.Errorf("got %v values, want %v", len(row), len(columns))
+		}
+		args = append(args, row...)
+		if len(args) == batch*len(columns) {
+			if err := flush(); err != nil {
+				return loaded, err
+			}
+		}
+	}
+	return loaded, flush()
+}
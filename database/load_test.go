@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// recordingQueryer records the statements and arguments it executes
+type recordingQueryer struct {
+	statements []string
+}
+
+func (r *recordingQueryer) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (r *recordingQueryer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.statements = append(r.statements, fmt.Sprint(query, args))
+	return driver.RowsAffected(len(args)), nil
+}
+
+func TestInsertRows(t *testing.T) {
+	defer func(rows int) { MaxInsertRows = rows }(MaxInsertRows)
+	MaxInsertRows = 2
+
+	rows := [][]interface{}{{1, "a"}, {2, nil}, {3, "c"}}
+	next := func() ([]interface{}, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}
+	q := &recordingQueryer{}
+	quote := func(name string) string { return `"` + name + `"` }
+	loaded, err := InsertRows(q, "t", []string{"id", "name"}, next, quote, Dollar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != 3 {
+		t.Errorf("expected 3 loaded rows, got %v", loaded)
+	}
+	expected := []string{
+		`INSERT INTO t ("id", "name") VALUES ($1, $2), ($3, $4)[1 a 2 <nil>]`,
+		`INSERT INTO t ("id", "name") VALUES ($1, $2)[3 c]`,
+	}
+	if !reflect.DeepEqual(q.statements, expected) {
+		t.Errorf("expected %q, got %q", expected, q.statements)
+	}
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lock strategies, see NewLocker.
+const (
+	// LockAdvisory uses the locking of the driver, e.g. advisory locks.
+	LockAdvisory = "advisory"
+	// LockTable uses a TableLock.
+	LockTable = "table"
+	// LockNone doesn't lock at all.
+	LockNone = "none"
+)
+
+// DefaultLockTable is the table of a TableLock created by NewLocker.
+var DefaultLockTable = "schema_lock"
+
+// Locker acquires and releases the migration lock.
+// Every Driver is a Locker using its own locking.
+type Locker interface {
+	// Lock should acquire a lock, or return ErrLocked if it is held by someone else.
+	Lock() error
+
+	// Unlock should release the lock.
+	Unlock() error
+}
+
+// LockInfo describes the holder of a lock.
+type LockInfo struct {
+	Hostname string    `json:"hostname"`
+	PID      int       `json:"pid"`
+	User     string    `json:"user"`
+	Since    time.Time `json:"since"`
+}
+
+// NewLockInfo returns the LockInfo of this process, locking now.
+func NewLockInfo() LockInfo {
+	info := LockInfo{PID: os.Getpid(), Since: time.Now().UTC().Truncate(time.Second)}
+	info.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		info.User = u.Username
+	} else {
+		info.User = os.Getenv("USER")
+	}
+	return info
+}
+
+func (i LockInfo) String() string {
+	s := fmt.Sprintf("%v@%v (pid %v)", i.User, i.Hostname, i.PID)
+	if !i.Since.IsZero() {
+		s += " since " + i.Since.Format(time.RFC3339)
+	}
+	return s
+}
+
+// LockReporter is an optional interface a Locker can implement
+// to report who holds the lock, see migrate.Migrate.LockStatus.
+type LockReporter interface {
+	// LockHolder returns the holder of the lock, or nil if it isn't held.
+	LockHolder() (*LockInfo, error)
+}
+
+// ForceUnlocker is an optional interface a Locker can implement to release
+// a lock held by someone else, e.g. a crashed process. See migrate.Migrate.ForceUnlock.
+type ForceUnlocker interface {
+	// ForceUnlock releases the lock, regardless of who holds it.
+	ForceUnlock() error
+}
+
+// NewLocker returns the Locker of strategy, one of the Lock constants,
+// for driver. An empty strategy is LockAdvisory.
+func NewLocker(strategy string, driver Driver) (Locker, error) {
+	switch strategy {
+	case "", LockAdvisory:
+		return driver, nil
+	case LockTable:
+		return &TableLock{Driver: driver, Table: DefaultLockTable}, nil
+	case LockNone:
+		return noLock{}, nil
+	default:
+		return nil, fmt.Errorf("unknown lock strategy %q", strategy)
+	}
+}
+
+// TableLock locks by inserting a row into a table, for SQL databases whose
+// driver doesn't lock across processes. Concurrent inserts are prevented by
+// the primary key of the table, so the database must enforce primary keys.
+// The row records the LockInfo of the holder.
+type TableLock struct {
+	Driver Driver
+	Table  string
+	// Timeout is how long Lock waits for the lock held by someone else,
+	// see migrate.Migrate.LockTimeout. Zero tries only once.
+	Timeout time.Duration
+
+	holder *LockInfo
+}
+
+// tableLockRetry is how often TableLock.Lock tries to insert the lock row
+// while it is held.
+var tableLockRetry = 100 * time.Millisecond
+
+// Lock creates the lock table if necessary and inserts the lock row. While
+// the row is held by someone else, it retries until Timeout, like the
+// advisory locks of the drivers wait, and then returns ErrLocked.
+func (l *TableLock) Lock() error {
+	if err := l.create(); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(l.Timeout)
+	for {
+		info := NewLockInfo()
+		query := "INSERT INTO " + quotedTable(l.Driver, l.Table) + " (lock_id, hostname, pid, username, locked_at) VALUES (1, " +
+			quote(info.Hostname) + ", " + strconv.Itoa(info.PID) + ", " + quote(info.User) + ", " +
+			quote(info.Since.Format(time.RFC3339)) + ")"
+		err := l.Driver.Run(strings.NewReader(query))
+		if err == nil {
+			l.holder = &info
+			return nil
+		}
+		held, errHeld := l.held()
+		if errHeld != nil {
+			return &Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+		} else if !held {
+			return &Error{OrigErr: err, Query: []byte(query)}
+		}
+		if !time.Now().Before(deadline) {
+			return ErrLocked
+		}
+		time.Sleep(tableLockRetry)
+	}
+}
+
+// held returns true if the lock row exists, or, if the driver can't be
+// queried, assumes the failed insert of the row was due to it.
+func (l *TableLock) held() (bool, error) {
+	q, ok := l.Driver.(Querier)
+	if !ok {
+		return true, nil
+	}
+	rows, err := q.Query("SELECT lock_id FROM " + quotedTable(l.Driver, l.Table))
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// Unlock deletes the lock row, if it was inserted by this TableLock.
+func (l *TableLock) Unlock() error {
+	if l.holder == nil {
+		return nil
+	}
+	err := l.delete(" WHERE hostname = " + quote(l.holder.Hostname) + " AND pid = " + strconv.Itoa(l.holder.PID) +
+		" AND locked_at = " + quote(l.holder.Since.Format(time.RFC3339)))
+	if err == nil {
+		l.holder = nil
+	}
+	return err
+}
+
+// ForceUnlock deletes the lock row.
+func (l *TableLock) ForceUnlock() error {
+	l.holder = nil
+	if err := l.create(); err != nil {
+		return err
+	}
+	return l.delete("")
+}
+
+func (l *TableLock) create() error {
+	return createTable(l.Driver, l.Table, "lock_id INTEGER NOT NULL PRIMARY KEY, hostname VARCHAR(255), pid INTEGER, "+
+		"username VARCHAR(255), locked_at VARCHAR(32)")
+}
+
+func (l *TableLock) delete(where string) error {
+	query := "DELETE FROM " + quotedTable(l.Driver, l.Table) + where
+	if err := l.Driver.Run(strings.NewReader(query)); err != nil {
+		return &Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// quote returns s as SQL string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+type noLock struct{}
+
+func (noLock) Lock() error   { return nil }
+func (noLock) Unlock() error { return nil }
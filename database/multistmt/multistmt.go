@@ -0,0 +1,376 @@
+// Package multistmt splits a migration into its individual statements,
+// for databases or modes that can't execute several statements at once.
+//
+// Delimiters are only recognized outside of quoted strings and identifiers
+// ('...', "...", `...`, E'...'), line and block comments (--, /* */) and
+// Postgres dollar-quoted bodies ($$...$$, $tag$...$tag$).
+package multistmt
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// DefaultDelimiter separates two statements.
+var DefaultDelimiter = []byte(";")
+
+// Delimiter returns the delimiter set with the `migrate:delimiter` pragma
+// of migration. If there is none, def is returned.
+func Delimiter(migration []byte, def []byte) []byte {
+	if d, ok := pragma.Parse(migration).Get(pragma.Delimiter); ok && d != "" {
+		return []byte(d)
+	}
+	return def
+}
+
+var delimiterDirective = regexp.MustCompile(`(?im)^[ \t]*DELIMITER[ \t]+\S+`)
+
+// Split splits migration into statements separated by delimiter.
+// Statements are trimmed and statements consisting only of whitespace
+// and comments are omitted. The delimiter itself is not part of the
+// returned statements.
+func Split(migration []byte, delimiter []byte) [][]byte {
+	return splitter{dollarQuotes: true}.split(migration, delimiter)
+}
+
+// SplitMySQL is like Split, but follows the MySQL dialect: quotes within
+// strings can be escaped with a backslash, # starts a comment to the end of
+// the line like --, and MySQL client style
+// `DELIMITER //` directives change the delimiter for all following statements.
+// A directive must be on a line of its own at the start of a statement and is
+// not part of the returned statements. Dollar quoting is not recognized.
+func SplitMySQL(migration []byte, delimiter []byte) [][]byte {
+	return splitter{backslash: true, hashComments: true, directives: true}.split(migration, delimiter)
+}
+
+// HasDelimiterDirective returns true if migration contains
+// a `DELIMITER` directive, see SplitMySQL.
+func HasDelimiterDirective(migration []byte) bool {
+	return delimiterDirective.Match(migration)
+}
+
+// scanAhead is how many bytes Scanner reads ahead of a token, enough for
+// the longest delimiter or dollar quote tag.
+const scanAhead = 128
+
+// scanChunk is how many bytes Scanner reads at once.
+const scanChunk = 64 << 10
+
+// Scanner reads the statements of a migration one by one, like Split,
+// without reading the whole migration into memory. Only the statement
+// being read is held in memory.
+type Scanner struct {
+	r         io.Reader
+	delimiter []byte
+	s         splitter
+
+	buf []byte
+	// pos is where scanning buf continues, the start of a token
+	pos  int
+	eof  bool
+	stmt []byte
+	err  error
+}
+
+// NewScanner returns a Scanner of the statements read from r, separated
+// by delimiter.
+func NewScanner(r io.Reader, delimiter []byte) *Scanner {
+	if len(delimiter) == 0 {
+		delimiter = DefaultDelimiter
+	}
+	return &Scanner{r: r, delimiter: delimiter, s: splitter{dollarQuotes: true}}
+}
+
+// Scan advances to the next statement, which is then available through
+// Statement. It returns false at the end of the migration or on an error.
+func (sc *Scanner) Scan() bool {
+	for sc.err == nil {
+		if end, ok := sc.find(); ok {
+			stmt := sc.buf[:sc.pos]
+			sc.buf = sc.buf[end:]
+			sc.pos = 0
+			if sc.setStatement(stmt) {
+				return true
+			}
+			continue
+		}
+		if sc.eof {
+			stmt := sc.buf
+			sc.buf, sc.pos = nil, 0
+			return sc.setStatement(stmt)
+		}
+		sc.fill()
+	}
+	return false
+}
+
+// Statement returns the statement read by the last call to Scan. It is
+// only valid until the next call to Scan.
+func (sc *Scanner) Statement() []byte {
+	return sc.stmt
+}
+
+// Err returns the first error reading the migration.
+func (sc *Scanner) Err() error {
+	return sc.err
+}
+
+// find scans buf for a delimiter, leaving pos at its position. It returns
+// the position after the delimiter or false if more of the migration
+// needs to be read, as a token may continue past the end of buf.
+func (sc *Scanner) find() (int, bool) {
+	for sc.pos < len(sc.buf) {
+		if !sc.eof && len(sc.buf)-sc.pos < scanAhead {
+			return 0, false
+		}
+		if bytes.HasPrefix(sc.buf[sc.pos:], sc.delimiter) {
+			return sc.pos + len(sc.delimiter), true
+		}
+		next := sc.s.skip(sc.buf, sc.pos)
+		if next == len(sc.buf) && !sc.eof {
+			return 0, false
+		}
+		sc.pos = next
+	}
+	return 0, false
+}
+
+func (sc *Scanner) fill() {
+	if cap(sc.buf)-len(sc.buf) < scanChunk {
+		buf := make([]byte, len(sc.buf), 2*cap(sc.buf)+scanChunk)
+		copy(buf, sc.buf)
+		sc.buf = buf
+	}
+	// filling the whole buffer, which grows geometrically, keeps
+	// rescanning long tokens cheap
+	n, err := io.ReadFull(sc.r, sc.buf[len(sc.buf):cap(sc.buf)])
+	sc.buf = sc.buf[:len(sc.buf)+n]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		sc.eof = true
+	} else if err != nil {
+		sc.err = err
+	}
+}
+
+func (sc *Scanner) setStatement(stmt []byte) bool {
+	stmts := sc.s.appendStatement(nil, stmt)
+	if len(stmts) == 0 {
+		return false
+	}
+	sc.stmt = stmts[0]
+	return true
+}
+
+type splitter struct {
+	// backslash escapes quotes within strings
+	backslash bool
+
+	// hashComments starts a comment to the end of the line with #
+	hashComments bool
+
+	// directives enables DELIMITER directives
+	directives bool
+
+	// dollarQuotes enables Postgres dollar quoting and E'' strings
+	dollarQuotes bool
+}
+
+func (s splitter) split(migration []byte, delimiter []byte) [][]byte {
+	if len(delimiter) == 0 {
+		delimiter = DefaultDelimiter
+	}
+	stmts := make([][]byte, 0)
+	start := 0
+	for i := 0; i < len(migration); {
+		if s.directives && atLineStart(migration, i) && s.isEmpty(migration[start:i]) {
+			if d, end, ok := parseDirective(migration, i); ok {
+				stmts = s.appendStatement(stmts, migration[start:i])
+				delimiter = d
+				i = end
+				start = i
+				continue
+			}
+		}
+		if bytes.HasPrefix(migration[i:], delimiter) {
+			stmts = s.appendStatement(stmts, migration[start:i])
+			i += len(delimiter)
+			start = i
+			continue
+		}
+		i = s.skip(migration, i)
+	}
+	return s.appendStatement(stmts, migration[start:])
+}
+
+func (s splitter) appendStatement(stmts [][]byte, stmt []byte) [][]byte {
+	stmt = bytes.TrimSpace(stmt)
+	if s.isEmpty(stmt) {
+		return stmts
+	}
+	return append(stmts, stmt)
+}
+
+// isEmpty returns true if b consists only of whitespace and comments.
+func (s splitter) isEmpty(b []byte) bool {
+	for i := 0; i < len(b); {
+		switch {
+		case isSpace(b[i]):
+			i++
+		case s.isComment(b, i):
+			i = s.skip(b, i)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// skip returns the position right after the token starting at position i.
+// A token is either a quoted string or identifier, a comment,
+// a dollar-quoted body or a single byte.
+func (s splitter) skip(b []byte, i int) int {
+	switch c := b[i]; {
+	case c == '\'' || c == '"':
+		return skipQuoted(b, i, c, s.backslash)
+
+	case c == '`':
+		return skipQuoted(b, i, c, false)
+
+	case s.dollarQuotes && (c == 'E' || c == 'e') && i+1 < len(b) && b[i+1] == '\'' && !isIdentBefore(b, i):
+		// Postgres string constant with C-style escapes
+		return skipQuoted(b, i+1, '\'', true)
+
+	case bytes.HasPrefix(b[i:], []byte("--")) || s.hashComments && c == '#':
+		if end := bytes.IndexByte(b[i:], '\n'); end >= 0 {
+			return i + end + 1
+		}
+		return len(b)
+
+	case bytes.HasPrefix(b[i:], []byte("/*")):
+		return skipBlockComment(b, i)
+
+	case s.dollarQuotes && c == '$' && !isIdentBefore(b, i):
+		if tag := dollarTag(b[i:]); tag != nil {
+			if end := bytes.Index(b[i+len(tag):], tag); end >= 0 {
+				return i + len(tag) + end + len(tag)
+			}
+			return len(b)
+		}
+	}
+	return i + 1
+}
+
+// skipQuoted skips a quoted token starting at position i. The quote
+// character is escaped by doubling it, or with a backslash if backslash
+// is true. Unterminated tokens extend to the end of b.
+func skipQuoted(b []byte, i int, quote byte, backslash bool) int {
+	for j := i + 1; j < len(b); j++ {
+		switch {
+		case backslash && b[j] == '\\':
+			j++
+		case b[j] == quote:
+			if j+1 < len(b) && b[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(b)
+}
+
+// skipBlockComment skips a, possibly nested, block comment
+// starting at position i.
+func skipBlockComment(b []byte, i int) int {
+	depth := 0
+	for j := i; j < len(b); {
+		switch {
+		case bytes.HasPrefix(b[j:], []byte("/*")):
+			depth++
+			j += 2
+		case bytes.HasPrefix(b[j:], []byte("*/")):
+			depth--
+			j += 2
+			if depth == 0 {
+				return j
+			}
+		default:
+			j++
+		}
+	}
+	return len(b)
+}
+
+// parseDirective parses a DELIMITER directive starting at position i.
+// It returns the new delimiter and the position after the directive.
+func parseDirective(b []byte, i int) (delimiter []byte, end int, ok bool) {
+	loc := delimiterDirective.FindIndex(b[i:])
+	if loc == nil || loc[0] != 0 {
+		return nil, 0, false
+	}
+	end = len(b)
+	if nl := bytes.IndexByte(b[i:], '\n'); nl >= 0 {
+		end = i + nl + 1
+	}
+	fields := bytes.Fields(b[i:end])
+	if len(fields) != 2 {
+		return nil, 0, false
+	}
+	return fields[1], end, true
+}
+
+// atLineStart returns true if only spaces or tabs precede position i
+// on its line.
+func atLineStart(b []byte, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch b[j] {
+		case '\n':
+			return true
+		case ' ', '\t':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// dollarTag returns the dollar quote tag ($$ or $tag$) b starts with, if any.
+func dollarTag(b []byte) []byte {
+	for j := 1; j < len(b); j++ {
+		switch {
+		case b[j] == '$':
+			return b[:j+1]
+		case isIdent(b[j]) && !(j == 1 && isDigit(b[j])):
+			continue
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s splitter) isComment(b []byte, i int) bool {
+	return bytes.HasPrefix(b[i:], []byte("--")) || bytes.HasPrefix(b[i:], []byte("/*")) || s.hashComments && b[i] == '#'
+}
+
+// isIdentBefore returns true if the byte before position i
+// is part of an identifier.
+func isIdentBefore(b []byte, i int) bool {
+	return i > 0 && (isIdent(b[i-1]) || b[i-1] == '$')
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,175 @@
+package multistmt
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var splitTests = []struct {
+	name      string
+	migration string
+	delimiter string
+	expected  []string
+}{
+	{"empty", "", "", []string{}},
+	{"single", "SELECT 1", "", []string{"SELECT 1"}},
+	{"multiple", "SELECT 1; SELECT 2;\n", "", []string{"SELECT 1", "SELECT 2"}},
+	{"empty statements", ";;SELECT 1;  ;", ";", []string{"SELECT 1"}},
+	{"custom delimiter", "SELECT 1; SELECT 2 $$ SELECT 3", "$$", []string{"SELECT 1; SELECT 2", "SELECT 3"}},
+	{"single quotes", "SELECT ';'; SELECT 'it''s;'", "", []string{"SELECT ';'", "SELECT 'it''s;'"}},
+	{"escape string", `SELECT E'\';'; SELECT 2`, "", []string{`SELECT E'\';'`, "SELECT 2"}},
+	{"double quotes", `SELECT 1 AS "a;b"; SELECT 2`, "", []string{`SELECT 1 AS "a;b"`, "SELECT 2"}},
+	{"backticks", "SELECT 1 AS `a;b`; SELECT 2", "", []string{"SELECT 1 AS `a;b`", "SELECT 2"}},
+	{"line comment", "SELECT 1; -- drop;\nSELECT 2", "", []string{"SELECT 1", "-- drop;\nSELECT 2"}},
+	{"block comment", "SELECT 1 /* ; /* ; */ ; */; SELECT 2", "", []string{"SELECT 1 /* ; /* ; */ ; */", "SELECT 2"}},
+	{"comment only statements", "-- migrate:no-transaction\nSELECT 1;\n-- the end\n", "", []string{"-- migrate:no-transaction\nSELECT 1"}},
+	{"dollar quoting", "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT 2", "",
+		[]string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT 2"}},
+	{"tagged dollar quoting", "DO $body$ BEGIN PERFORM 1; $$; END $body$; SELECT 2", "",
+		[]string{"DO $body$ BEGIN PERFORM 1; $$; END $body$", "SELECT 2"}},
+	{"positional parameter", "PREPARE p AS SELECT $1; SELECT 2", "", []string{"PREPARE p AS SELECT $1", "SELECT 2"}},
+	{"identifier with dollar", "SELECT a$b; SELECT b$", "", []string{"SELECT a$b", "SELECT b$"}},
+	{"dollar delimiter", "SELECT 1; SELECT 2 $$ SELECT 3 $$", "$$", []string{"SELECT 1; SELECT 2", "SELECT 3"}},
+	{"unterminated string", "SELECT 1; SELECT ';", "", []string{"SELECT 1", "SELECT ';"}},
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range splitTests {
+		t.Run(tc.name, func(t *testing.T) {
+			stmts := Split([]byte(tc.migration), []byte(tc.delimiter))
+			got := make([]string, 0, len(stmts))
+			for _, s := range stmts {
+				got = append(got, string(s))
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanner(t *testing.T) {
+	for _, tc := range splitTests {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := NewScanner(strings.NewReader(tc.migration), []byte(tc.delimiter))
+			got := make([]string, 0)
+			for sc.Scan() {
+				got = append(got, string(sc.Statement()))
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("large", func(t *testing.T) {
+		// tokens longer than the chunks read, delimiters and tokens
+		// across reads
+		var migration strings.Builder
+		statement := func(i int) string {
+			long := strings.Repeat("a;", scanChunk-i*500)
+			return fmt.Sprintf("-- row %v;\nINSERT INTO t VALUES (%v, '%v', $$;%v;$$)", i, i, long, i)
+		}
+		for i := 0; i < 100; i++ {
+			migration.WriteString(statement(i) + ";\n")
+		}
+		sc := NewScanner(iotest.HalfReader(strings.NewReader(migration.String())), nil)
+		n := 0
+		for sc.Scan() {
+			if string(sc.Statement()) != statement(n) {
+				t.Fatalf("statement %v differs", n)
+			}
+			n++
+		}
+		if err := sc.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n != 100 {
+			t.Fatalf("expected 100 statements, got %v", n)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		sc := NewScanner(iotest.TimeoutReader(strings.NewReader(strings.Repeat("SELECT 1;", scanChunk))), nil)
+		for sc.Scan() {
+		}
+		if sc.Err() != iotest.ErrTimeout {
+			t.Fatalf("expected %v, got %v", iotest.ErrTimeout, sc.Err())
+		}
+	})
+}
+
+func TestDelimiter(t *testing.T) {
+	tt := []struct {
+		name      string
+		migration string
+		expected  string
+	}{
+		{"default", "SELECT 1;", ";"},
+		{"pragma", "-- migrate:delimiter $$\nSELECT 1$$", "$$"},
+		{"empty pragma", "-- migrate:delimiter\nSELECT 1;", ";"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if d := Delimiter([]byte(tc.migration), DefaultDelimiter); string(d) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, d)
+			}
+		})
+	}
+}
+
+func TestSplitMySQL(t *testing.T) {
+	tt := []struct {
+		name      string
+		migration string
+		expected  []string
+	}{
+		{"no directive", "SELECT 1; SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"backslash escape", `SELECT 'it\'s;'; SELECT 2`, []string{`SELECT 'it\'s;'`, "SELECT 2"}},
+		{"directive", `DELIMITER //
+CREATE PROCEDURE p()
+BEGIN
+  SELECT 1;
+  SELECT 2;
+END //
+DELIMITER ;
+SELECT 3;`, []string{"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND", "SELECT 3"}},
+		{"lower case directive", "delimiter $$\nSELECT 1; $$\ndelimiter ;\nSELECT 2;",
+			[]string{"SELECT 1;", "SELECT 2"}},
+		{"not at statement start", "CREATE TABLE t (\n  delimiter VARCHAR(10)\n);",
+			[]string{"CREATE TABLE t (\n  delimiter VARCHAR(10)\n)"}},
+		{"dollar signs", "SELECT $$a$$; SELECT 2", []string{"SELECT $$a$$", "SELECT 2"}},
+		{"hash comment", "# don't do this\nCREATE TABLE a (x int);\nCREATE TABLE b (y int);",
+			[]string{"# don't do this\nCREATE TABLE a (x int)", "CREATE TABLE b (y int)"}},
+		{"only hash comment", "SELECT 1; # it's done\n", []string{"SELECT 1"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			stmts := SplitMySQL([]byte(tc.migration), nil)
+			got := make([]string, 0, len(stmts))
+			for _, s := range stmts {
+				got = append(got, string(s))
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestHasDelimiterDirective(t *testing.T) {
+	if HasDelimiterDirective([]byte("SELECT 1;")) {
+		t.Error("expected no directive")
+	}
+	if !HasDelimiterDirective([]byte("SELECT 1;\n  DELIMITER //\n")) {
+		t.Error("expected directive")
+	}
+}
@@ -4,15 +4,18 @@ package mysql
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"database/sql"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	nurl "net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 import (
@@ -22,25 +25,46 @@ import (
 
 import (
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/proxy"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
 )
 
 func init() {
 	database.Register("mysql", &Mysql{})
+	mysql.RegisterDialContext(proxyNet, func(ctx context.Context, addr string) (net.Conn, error) {
+		return proxy.DialContext(ctx, "tcp", addr)
+	})
 }
 
+// proxyNet is the network of TCP connections dialed through package proxy
+const proxyNet = "migrate-proxy"
+
 var DefaultMigrationsTable = "schema_migrations"
 
 var (
 	ErrDatabaseDirty    = fmt.Errorf("database is dirty")
 	ErrNilConfig        = fmt.Errorf("no config")
 	ErrNoDatabaseName   = fmt.Errorf("no database name")
-	ErrAppendPEM        = fmt.Errorf("failed to append PEM")
-	ErrTLSCertKeyConfig = fmt.Errorf("To use TLS client authentication, both x-tls-cert and x-tls-key must not be empty")
+	ErrAppendPEM        = database.ErrAppendPEM
+	ErrTLSCertKeyConfig = database.ErrTLSCertKeyConfig
 )
 
 type Config struct {
-	MigrationsTable string
-	DatabaseName    string
+	MigrationsTable  string
+	DatabaseName     string
+	StatementTimeout time.Duration
+
+	// ReadOnly opens the driver read-only, see database.ReadOnlyDriver.
+	ReadOnly bool
+
+	// VersionTable, if set, replaces the layout of the version table,
+	// see database.VersionTable.
+	VersionTable *database.VersionTable
+
+	// OnlineDDL, if set, runs the ALTER TABLE statements of migrations
+	// with an online schema change tool, see OnlineDDL.
+	OnlineDDL *OnlineDDL
 }
 
 type Mysql struct {
@@ -50,7 +74,16 @@ type Mysql struct {
 	db       *sql.DB
 	isLocked bool
 
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
+
 	config *Config
+
+	// killAfter is the statement timeout the server doesn't enforce, so
+	// the driver kills statements running longer, see setStatementTimeout
+	killAfter time.Duration
+	// connID is the connection id of conn, to kill its statements
+	connID int64
 }
 
 // instance must have `multiStatements` set to true
@@ -78,7 +111,7 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	}
 
 	if len(config.MigrationsTable) == 0 {
-		config.MigrationsTable = DefaultMigrationsTable
+		config.MigrationsTable = config.VersionTable.DefaultTable(DefaultMigrationsTable)
 	}
 
 	conn, err := instance.Conn(context.Background())
@@ -86,10 +119,31 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 		return nil, err
 	}
 
+	var killAfter time.Duration
+	if config.StatementTimeout > 0 {
+		if killAfter, err = setStatementTimeout(conn, config.StatementTimeout); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if config.ReadOnly {
+		query := "SET SESSION TRANSACTION READ ONLY"
+		if _, err := conn.ExecContext(context.Background(), query); err != nil {
+			conn.Close()
+			return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
 	mx := &Mysql{
-		conn:   conn,
-		db:     instance,
-		config: config,
+		conn:      conn,
+		db:        instance,
+		config:    config,
+		killAfter: killAfter,
+	}
+
+	if config.ReadOnly {
+		return mx, nil
 	}
 
 	if err := mx.ensureVersionTable(); err != nil {
@@ -116,6 +170,17 @@ func extractCustomQueryParams(c *mysql.Config) (map[string]string, error) {
 	return customQueryParams, nil
 }
 
+// tlsConfigs numbers the TLS configs registered for x-tls- queries
+var tlsConfigs int64
+
+func paramValues(params map[string]string) nurl.Values {
+	q := make(nurl.Values, len(params))
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	return q
+}
+
 func urlToMySQLConfig(url string) (*mysql.Config, error) {
 	config, err := mysql.ParseDSN(strings.TrimPrefix(url, "mysql://"))
 	if err != nil {
@@ -123,6 +188,9 @@ func urlToMySQLConfig(url string) (*mysql.Config, error) {
 	}
 
 	config.MultiStatements = true
+	if config.Net == "tcp" && proxy.Enabled() {
+		config.Net = proxyNet
+	}
 
 	// Keep backwards compatibility from when we used net/url.Parse() to parse the DSN.
 	// net/url.Parse() would automatically unescape it for us.
@@ -140,46 +208,22 @@ func urlToMySQLConfig(url string) (*mysql.Config, error) {
 	config.Passwd = password
 
 	// use custom TLS?
+	tlsParams, err := database.ParseTLSParams(paramValues(config.Params))
+	if err != nil {
+		return nil, err
+	}
 	ctls := config.TLSConfig
+	if len(ctls) == 0 && tlsParams.IsSet() {
+		ctls = fmt.Sprintf("migrate-tls-%d", atomic.AddInt64(&tlsConfigs, 1))
+		config.TLSConfig = ctls
+	}
 	if len(ctls) > 0 {
 		if _, isBool := readBool(ctls); !isBool && strings.ToLower(ctls) != "skip-verify" {
-			rootCertPool := x509.NewCertPool()
-			pem, err := ioutil.ReadFile(config.Params["x-tls-ca"])
+			tlsConfig, err := tlsParams.Config()
 			if err != nil {
 				return nil, err
 			}
-
-			if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
-				return nil, ErrAppendPEM
-			}
-
-			clientCert := make([]tls.Certificate, 0, 1)
-			if ccert, ckey := config.Params["x-tls-cert"], config.Params["x-tls-key"]; ccert != "" || ckey != "" {
-				if ccert == "" || ckey == "" {
-					return nil, ErrTLSCertKeyConfig
-				}
-				certs, err := tls.LoadX509KeyPair(ccert, ckey)
-				if err != nil {
-					return nil, err
-				}
-				clientCert = append(clientCert, certs)
-			}
-
-			insecureSkipVerify := false
-			if len(config.Params["x-tls-insecure-skip-verify"]) > 0 {
-				x, err := strconv.ParseBool(config.Params["x-tls-insecure-skip-verify"])
-				if err != nil {
-					return nil, err
-				}
-				insecureSkipVerify = x
-			}
-
-			err = mysql.RegisterTLSConfig(ctls, &tls.Config{
-				RootCAs:            rootCertPool,
-				Certificates:       clientCert,
-				InsecureSkipVerify: insecureSkipVerify,
-			})
-			if err != nil {
+			if err := mysql.RegisterTLSConfig(ctls, tlsConfig); err != nil {
 				return nil, err
 			}
 		}
@@ -188,6 +232,17 @@ func urlToMySQLConfig(url string) (*mysql.Config, error) {
 	return config, nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (m *Mysql) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*Mysql).sharedDB = true
+	return d, nil
+}
+
 func (m *Mysql) Open(url string) (database.Driver, error) {
 	config, err := urlToMySQLConfig(url)
 	if err != nil {
@@ -199,14 +254,50 @@ func (m *Mysql) Open(url string) (database.Driver, error) {
 		return nil, err
 	}
 
+	params, err := database.ParseConnParams(paramValues(customParams))
+	if err != nil {
+		return nil, err
+	}
+	if params.ConnectTimeout > 0 {
+		config.Timeout = params.ConnectTimeout
+	}
+	if params.ReadTimeout > 0 {
+		config.ReadTimeout = params.ReadTimeout
+	}
+
 	db, err := sql.Open("mysql", config.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
+	params.Apply(db)
+
+	var statementTimeout time.Duration
+	if s := customParams["x-statement-timeout"]; s != "" {
+		if statementTimeout, err = database.ParseTimeout(s); err != nil {
+			return nil, err
+		}
+	}
+
+	readOnly, err := database.ParseReadOnly(paramValues(customParams))
+	if err != nil {
+		return nil, err
+	}
+	versionTable, err := database.ParseVersionTable(paramValues(customParams))
+	if err != nil {
+		return nil, err
+	}
+	onlineDDL, err := parseOnlineDDL(customParams, config)
+	if err != nil {
+		return nil, err
+	}
 
 	mx, err := WithInstance(db, &Config{
-		DatabaseName:    config.DBName,
-		MigrationsTable: customParams["x-migrations-table"],
+		DatabaseName:     config.DBName,
+		MigrationsTable:  customParams["x-migrations-table"],
+		StatementTimeout: statementTimeout,
+		ReadOnly:         readOnly,
+		VersionTable:     versionTable,
+		OnlineDDL:        onlineDDL,
 	})
 	if err != nil {
 		return nil, err
@@ -215,8 +306,37 @@ func (m *Mysql) Open(url string) (database.Driver, error) {
 	return mx, nil
 }
 
+// Ping connects to the database without accessing the version table.
+func (m *Mysql) Ping(ctx context.Context, url string) error {
+	config, err := urlToMySQLConfig(url)
+	if err != nil {
+		return err
+	}
+	if _, err := extractCustomQueryParams(config); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		// ER_DBACCESS_DENIED_ERROR, ER_ACCESS_DENIED_ERROR
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == 1044 || e.Number == 1045) {
+			return &database.PingError{Kind: database.PingAuth, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
 func (m *Mysql) Close() error {
 	connErr := m.conn.Close()
+	if m.sharedDB {
+		return connErr
+	}
 	dbErr := m.db.Close()
 	if connErr != nil || dbErr != nil {
 		return fmt.Errorf("conn: %v, db: %v", connErr, dbErr)
@@ -225,6 +345,9 @@ func (m *Mysql) Close() error {
 }
 
 func (m *Mysql) Lock() error {
+	if m.config.ReadOnly {
+		return database.ErrReadOnly
+	}
 	if m.isLocked {
 		return database.ErrLocked
 	}
@@ -249,6 +372,11 @@ func (m *Mysql) Lock() error {
 	return database.ErrLocked
 }
 
+// ReadOnly implements database.ReadOnlyDriver.
+func (m *Mysql) ReadOnly() bool {
+	return m.config.ReadOnly
+}
+
 func (m *Mysql) Unlock() error {
 	if !m.isLocked {
 		return nil
@@ -273,26 +401,367 @@ func (m *Mysql) Unlock() error {
 	return nil
 }
 
-func (m *Mysql) Run(migration io.Reader) error {
-	migr, err := ioutil.ReadAll(migration)
+// LockHolder returns the connection holding the lock. Its PID is the
+// connection id, the time the lock was acquired is unknown.
+func (m *Mysql) LockHolder() (*database.LockInfo, error) {
+	aid, err := database.GenerateAdvisoryLockId(
+		fmt.Sprintf("%s:%s", m.config.DatabaseName, m.config.MigrationsTable))
 	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.ID, p.HOST, p.USER FROM information_schema.PROCESSLIST p WHERE p.ID = IS_USED_LOCK(?)`
+	info := &database.LockInfo{}
+	err = m.conn.QueryRowContext(context.Background(), query, aid).Scan(&info.PID, &info.Hostname, &info.User)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return info, nil
+}
+
+// ForceUnlock kills the connection holding the lock, which releases it.
+func (m *Mysql) ForceUnlock() error {
+	if m.isLocked {
+		return m.Unlock()
+	}
+	holder, err := m.LockHolder()
+	if err != nil || holder == nil {
 		return err
 	}
 
-	query := string(migr[:])
+	query := "KILL " + strconv.Itoa(holder.PID)
 	if _, err := m.conn.ExecContext(context.Background(), query); err != nil {
-		return database.Error{OrigErr: err, Err: "migration failed", Query: migr}
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+func (m *Mysql) Run(migration io.Reader) (err error) {
+	migr, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	pragmas := pragma.Parse(migr)
+	if v, ok := pragmas.Get(pragma.StatementTimeout); ok {
+		timeout, err := database.ParseTimeout(v)
+		if err != nil {
+			return err
+		}
+		killAfter, err := setStatementTimeout(m.conn, timeout)
+		if err != nil {
+			return err
+		}
+		restore := m.killAfter
+		m.killAfter = killAfter
+		defer func() {
+			killAfter, errRestore := setStatementTimeout(m.conn, m.config.StatementTimeout)
+			if errRestore != nil {
+				killAfter = restore
+				if err == nil {
+					err = errRestore
+				}
+			}
+			m.killAfter = killAfter
+		}()
+	}
+	if m.killAfter > 0 && m.connID == 0 {
+		query := `SELECT CONNECTION_ID()`
+		if err := m.conn.QueryRowContext(context.Background(), query).Scan(&m.connID); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
+	// migrations with DELIMITER directives or a delimiter pragma are
+	// split into statements, everything else is sent as is, unless its
+	// ALTER TABLE statements are run by an online schema change tool
+	stmts := [][]byte{migr}
+	if multistmt.HasDelimiterDirective(migr) || pragmas.Has(pragma.Delimiter) || m.config.OnlineDDL != nil {
+		stmts = multistmt.SplitMySQL(migr, multistmt.Delimiter(migr, multistmt.DefaultDelimiter))
+	}
+
+	// DDL statements cause an implicit commit in MySQL, so migrations only
+	// run within a transaction if explicitly asked for
+	if pragmas.Has(pragma.Transaction) {
+		if m.config.OnlineDDL != nil {
+			return ErrOnlineDDLTransaction
+		}
+		tx, err := m.conn.BeginTx(context.Background(), &sql.TxOptions{})
+		if err != nil {
+			return &database.Error{OrigErr: err, Err: "transaction start failed"}
+		}
+		if err := m.runStatements(tx, stmts); err != nil {
+			if errRollback := tx.Rollback(); errRollback != nil {
+				return multierror.Append(err, errRollback)
+			}
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+		}
+		return nil
+	}
+
+	if m.config.OnlineDDL != nil {
+		return m.runOnlineDDL(stmts)
+	}
+	return m.runStatements(m.conn, stmts)
+}
+
+// runOnlineDDL runs the ALTER TABLE statements of stmts with OnlineDDL and
+// the others on the connection, in order
+func (m *Mysql) runOnlineDDL(stmts [][]byte) error {
+	for _, stmt := range stmts {
+		if table, alter, ok := parseAlterTable(stmt); ok {
+			if err := m.config.OnlineDDL.run(m.config.DatabaseName, table, alter); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := m.runStatements(m.conn, [][]byte{stmt}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// setStatementTimeout limits the execution time of the statements of the
+// session, zero disables the limit, with MariaDB's max_statement_time.
+// MySQL's max_execution_time only limits SELECT statements, so on MySQL the
+// returned timeout is left to the driver, which kills longer statements.
+func setStatementTimeout(ex execer, timeout time.Duration) (time.Duration, error) {
+	query := `SET SESSION max_statement_time = ` + strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)
+	_, err := ex.ExecContext(context.Background(), query)
+	// ER_UNKNOWN_SYSTEM_VARIABLE: not MariaDB
+	if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1193 {
+		return timeout, nil
 	}
+	if err != nil {
+		return 0, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return 0, nil
+}
 
+func (m *Mysql) runStatements(ex execer, stmts [][]byte) error {
+	for _, stmt := range stmts {
+		if err := m.exec(ex, stmt); err != nil {
+			return database.Error{OrigErr: err, Err: "migration failed", Query: stmt}
+		}
+	}
 	return nil
 }
 
+// exec runs stmt, killing it with KILL QUERY from another connection of
+// the pool once it runs longer than killAfter.
+func (m *Mysql) exec(ex execer, stmt []byte) error {
+	if m.killAfter <= 0 {
+		_, err := ex.ExecContext(context.Background(), string(stmt))
+		return err
+	}
+
+	// the kill holds mu, so that it can't hit the next statement, and is
+	// canceled once the statement is done, e.g. waiting for a connection
+	var mu sync.Mutex
+	done, killed := false, false
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(m.killAfter, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		killed = true
+		query := "KILL QUERY " + strconv.FormatInt(m.connID, 10)
+		// a failed kill leaves the statement running, like without a timeout
+		_, _ = m.db.ExecContext(ctx, query)
+	})
+	_, err := ex.ExecContext(context.Background(), string(stmt))
+	timer.Stop()
+	cancel()
+	mu.Lock()
+	done = true
+	mu.Unlock()
+
+	if err != nil && killed {
+		return fmt.Errorf("statement timeout of %v exceeded: %v", m.killAfter, err)
+	}
+	return err
+}
+
+// Query implements database.Querier.
+func (m *Mysql) Query(query string, args ...interface{}) ([]database.Row, error) {
+	return database.QueryRows(m.conn, query, args...)
+}
+
+// Schema implements database.Introspector.
+func (m *Mysql) Schema() ([]database.SchemaObject, error) {
+	query := `SELECT table_name, column_name, CONCAT_WS(' ', column_type, IF(is_nullable = 'NO', 'NOT NULL', NULL), CONCAT('DEFAULT ', column_default))
+		FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name <> ?`
+	columns, err := database.QuerySchema(m.conn, "column", query, m.config.MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	query = `SELECT table_name, index_name, CONCAT(IF(non_unique = 0, 'UNIQUE ', ''), GROUP_CONCAT(column_name ORDER BY seq_in_index))
+		FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name <> ?
+		GROUP BY table_name, index_name, non_unique`
+	indexes, err := database.QuerySchema(m.conn, "index", query, m.config.MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	return append(columns, indexes...), nil
+}
+
+// autoIncrement matches the AUTO_INCREMENT table option, which depends on
+// the data.
+var autoIncrement = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+// DumpSchema implements database.Dumper with SHOW CREATE TABLE. Views are
+// left out, their definition depends on the user creating them.
+func (m *Mysql) DumpSchema(w io.Writer, exclude []string) error {
+	skip := map[string]bool{m.config.MigrationsTable: true}
+	for _, t := range exclude {
+		skip[t] = true
+	}
+	query := `SELECT table_name AS name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'
+		ORDER BY table_name`
+	tables, err := database.QueryRows(m.conn, query)
+	if err != nil {
+		return err
+	}
+	stmts := make([]string, 0, len(tables))
+	for _, t := range tables {
+		table := t["name"].(string)
+		if skip[table] {
+			continue
+		}
+		query := "SHOW CREATE TABLE `" + table + "`"
+		var name, stmt string
+		if err := m.conn.QueryRowContext(context.Background(), query).Scan(&name, &stmt); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+		stmts = append(stmts, autoIncrement.ReplaceAllString(stmt, ""))
+	}
+	return database.WriteStatements(w, stmts)
+}
+
+func (m *Mysql) Exec(query string, args ...interface{}) (int64, error) {
+	return database.ExecRows(m.conn, query, args...)
+}
+
+// CreateTable implements database.TableCreator.
+func (m *Mysql) CreateTable(table, columns string) error {
+	_, err := m.Exec("CREATE TABLE IF NOT EXISTS " + database.QuoteTable(table, m.QuoteIdentifier) + " (" + columns + ")")
+	return err
+}
+
+// QuoteIdentifier implements database.IdentifierQuoter.
+func (m *Mysql) QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// loads numbers the readers registered by Load
+var loads int64
+
+// Load implements database.Loader with LOAD DATA LOCAL INFILE, which needs
+// local_infile to be enabled on the server.
+func (m *Mysql) Load(table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	name := fmt.Sprintf("migrate-load-%d", atomic.AddInt64(&loads, 1))
+	r, w := io.Pipe()
+	mysql.RegisterReaderHandler(name, func() io.Reader { return r })
+	defer mysql.DeregisterReaderHandler(name)
+
+	go func() {
+		w.CloseWithError(writeLoadData(w, next))
+	}()
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = m.QuoteIdentifier(c)
+	}
+	query := fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%v' INTO TABLE %v CHARACTER SET utf8mb4 "+
+		`FIELDS TERMINATED BY ',' ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n' (%v)`,
+		name, table, strings.Join(quoted, ", "))
+	result, err := m.conn.ExecContext(context.Background(), query)
+	// unblock the writer if the server stopped reading
+	r.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return 0, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return result.RowsAffected()
+}
+
+// writeLoadData writes the rows returned by next as input of LOAD DATA:
+// NULL unquoted, all other values quoted, quotes doubled.
+func writeLoadData(w io.Writer, next func() ([]interface{}, error)) error {
+	var line strings.Builder
+	for {
+		row, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line.Reset()
+		for i, v := range row {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			switch v := v.(type) {
+			case nil:
+				line.WriteString("NULL")
+			case bool:
+				if v {
+					line.WriteString(`"1"`)
+				} else {
+					line.WriteString(`"0"`)
+				}
+			default:
+				line.WriteString(`"` + strings.Replace(fmt.Sprint(v), `"`, `""`, -1) + `"`)
+			}
+		}
+		line.WriteByte('\n')
+		if _, err := io.WriteString(w, line.String()); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplicationLag implements database.LagChecker.
+func (m *Mysql) ReplicationLag(query string) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	if err := m.conn.QueryRowContext(context.Background(), query).Scan(&seconds); err != nil {
+		return 0, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
 func (m *Mysql) SetVersion(version int, dirty bool) error {
 	tx, err := m.conn.BeginTx(context.Background(), &sql.TxOptions{})
 	if err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction start failed"}
 	}
 
+	if m.config.VersionTable != nil {
+		if err := m.config.VersionTable.SetVersion(tx, "`"+m.config.MigrationsTable+"`", version, dirty); err != nil {
+			if errRollback := tx.Rollback(); errRollback != nil {
+				return multierror.Append(err, errRollback)
+			}
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+		}
+		return nil
+	}
+
 	query := "TRUNCATE `" + m.config.MigrationsTable + "`"
 	if _, err := tx.ExecContext(context.Background(), query); err != nil {
 		if errRollback := tx.Rollback(); errRollback != nil {
@@ -319,6 +788,14 @@ func (m *Mysql) SetVersion(version int, dirty bool) error {
 }
 
 func (m *Mysql) Version() (version int, dirty bool, err error) {
+	if m.config.VersionTable != nil {
+		version, dirty, err = m.config.VersionTable.Version(m.conn, "`"+m.config.MigrationsTable+"`")
+		if e, ok := err.(*database.Error); ok && isNoSuchTable(e.OrigErr) {
+			return database.NilVersion, false, nil
+		}
+		return version, dirty, err
+	}
+
 	query := "SELECT version, dirty FROM `" + m.config.MigrationsTable + "` LIMIT 1"
 	err = m.conn.QueryRowContext(context.Background(), query).Scan(&version, &dirty)
 	switch {
@@ -326,10 +803,8 @@ func (m *Mysql) Version() (version int, dirty bool, err error) {
 		return database.NilVersion, false, nil
 
 	case err != nil:
-		if e, ok := err.(*mysql.MySQLError); ok {
-			if e.Number == 0 {
-				return database.NilVersion, false, nil
-			}
+		if isNoSuchTable(err) {
+			return database.NilVersion, false, nil
 		}
 		return 0, false, &database.Error{OrigErr: err, Query: []byte(query)}
 
@@ -338,6 +813,13 @@ func (m *Mysql) Version() (version int, dirty bool, err error) {
 	}
 }
 
+// isNoSuchTable reports ER_NO_SUCH_TABLE, read-only drivers don't create
+// the version table.
+func isNoSuchTable(err error) bool {
+	e, ok := err.(*mysql.MySQLError)
+	return ok && (e.Number == 0 || e.Number == 1146)
+}
+
 func (m *Mysql) Drop() (err error) {
 	// select all tables
 	query := `SHOW TABLES LIKE '%'`
@@ -405,6 +887,10 @@ func (m *Mysql) ensureVersionTable() (err error) {
 		}
 	}()
 
+	if m.config.VersionTable != nil {
+		return m.config.VersionTable.Create(m.conn, "`"+m.config.MigrationsTable+"`", "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY")
+	}
+
 	// check if migration table exists
 	var result string
 	query := `SHOW TABLES LIKE "` + m.config.MigrationsTable + `"`
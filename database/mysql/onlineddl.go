@@ -0,0 +1,153 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// Online schema change tools of OnlineDDL
+const (
+	GhOst = "gh-ost"
+	PtOSC = "pt-osc"
+)
+
+var ErrOnlineDDLTransaction = fmt.Errorf("online DDL can't run within a transaction")
+
+// OnlineDDL delegates the ALTER TABLE statements of migrations to an online
+// schema change tool, gh-ost or pt-online-schema-change, which copies the
+// table in the background instead of locking it. The migration fails, and
+// its version isn't recorded, unless the tool succeeds.
+type OnlineDDL struct {
+	// Tool is GhOst or PtOSC
+	Tool string
+	// Command is the executable of Tool, gh-ost or pt-online-schema-change
+	// in PATH by default
+	Command string
+	// Flags are passed to Tool in addition, e.g. --max-load=Threads_running=25
+	Flags []string
+
+	// Host, Port, User and Password connect Tool to the database
+	Host     string
+	Port     string
+	User     string
+	Password string
+
+	// Output receives the output of Tool, os.Stderr by default
+	Output io.Writer
+}
+
+// parseOnlineDDL returns the OnlineDDL of the x-online-ddl queries, or nil
+func parseOnlineDDL(params map[string]string, config *mysql.Config) (*OnlineDDL, error) {
+	tool := params["x-online-ddl"]
+	if tool == "" {
+		return nil, nil
+	}
+	if tool != GhOst && tool != PtOSC {
+		return nil, fmt.Errorf("unknown x-online-ddl %q, expected %v or %v", tool, GhOst, PtOSC)
+	}
+	if config.Net != "tcp" && config.Net != proxyNet {
+		return nil, fmt.Errorf("x-online-ddl needs a tcp connection, got %v", config.Net)
+	}
+	host, port, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &OnlineDDL{
+		Tool:     tool,
+		Command:  params["x-online-ddl-command"],
+		Flags:    strings.Fields(params["x-online-ddl-flags"]),
+		Host:     host,
+		Port:     port,
+		User:     config.User,
+		Password: config.Passwd,
+	}, nil
+}
+
+// alterTable matches ALTER TABLE statements, with the table and the
+// alterations
+var alterTable = regexp.MustCompile("(?is)^\\s*ALTER\\s+TABLE\\s+([\\w`.]+)\\s+(.*?)[\\s;]*$")
+
+// parseAlterTable returns the table and alterations of an ALTER TABLE
+// statement, ok is false for other statements
+func parseAlterTable(stmt []byte) (table, alter string, ok bool) {
+	m := alterTable.FindSubmatch(stripComments(stmt))
+	if m == nil {
+		return "", "", false
+	}
+	return strings.Replace(string(m[1]), "`", "", -1), string(m[2]), true
+}
+
+var comments = regexp.MustCompile(`(?m)^\s*(--|#).*$`)
+
+// stripComments removes the comment lines of stmt, e.g. pragmas heading a
+// migration
+func stripComments(stmt []byte) []byte {
+	return comments.ReplaceAll(stmt, nil)
+}
+
+// args returns the command line of Tool altering table of databaseName,
+// with the credentials in the defaults file defaults
+func (o *OnlineDDL) args(databaseName, table, alter, defaults string) []string {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		databaseName, table = table[:i], table[i+1:]
+	}
+	var args []string
+	switch o.Tool {
+	case GhOst:
+		args = []string{"--conf=" + defaults, "--host=" + o.Host, "--port=" + o.Port,
+			"--database=" + databaseName, "--table=" + table, "--alter=" + alter, "--execute"}
+	case PtOSC:
+		args = []string{"--alter=" + alter, "--execute",
+			fmt.Sprintf("F=%v,h=%v,P=%v,D=%v,t=%v", defaults, o.Host, o.Port, databaseName, table)}
+	}
+	return append(args, o.Flags...)
+}
+
+// command returns the executable of Tool
+func (o *OnlineDDL) command() string {
+	if o.Command != "" {
+		return o.Command
+	}
+	if o.Tool == PtOSC {
+		return "pt-online-schema-change"
+	}
+	return o.Tool
+}
+
+// run alters table with Tool. The credentials are passed in a temporary
+// defaults file, so that they don't show up in the process list.
+func (o *OnlineDDL) run(databaseName, table, alter string) error {
+	f, err := ioutil.TempFile("", "migrate-online-ddl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprintf(f, "[client]\nuser=%v\npassword=%v\n", o.User, o.Password)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+
+	args := o.args(databaseName, table, alter, f.Name())
+	cmd := exec.Command(o.command(), args...)
+	cmd.Stdout, cmd.Stderr = o.Output, o.Output
+	if o.Output == nil {
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return &database.Error{OrigErr: err, Err: o.Tool + " failed", Query: []byte("ALTER TABLE " + table + " " + alter)}
+	}
+	return nil
+}
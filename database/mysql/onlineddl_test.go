@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestParseAlterTable(t *testing.T) {
+	cases := []struct {
+		stmt  string
+		table string
+		alter string
+		ok    bool
+	}{
+		{stmt: "ALTER TABLE users ADD COLUMN email text", table: "users", alter: "ADD COLUMN email text", ok: true},
+		{stmt: "-- migrate:statement-timeout 0\nalter table `shop`.`orders`\n  ADD INDEX created (created_at),\n  DROP COLUMN note;",
+			table: "shop.orders", alter: "ADD INDEX created (created_at),\n  DROP COLUMN note", ok: true},
+		{stmt: "CREATE TABLE users (id int)"},
+		{stmt: "UPDATE users SET note = 'ALTER TABLE x'"},
+	}
+	for _, c := range cases {
+		table, alter, ok := parseAlterTable([]byte(c.stmt))
+		if table != c.table || alter != c.alter || ok != c.ok {
+			t.Errorf("%q: expected %q, %q, %v, got %q, %q, %v", c.stmt, c.table, c.alter, c.ok, table, alter, ok)
+		}
+	}
+}
+
+func TestOnlineDDLArgs(t *testing.T) {
+	o := &OnlineDDL{Tool: GhOst, Host: "db", Port: "3306", Flags: []string{"--allow-on-master"}}
+	expected := []string{"--conf=my.cnf", "--host=db", "--port=3306", "--database=shop", "--table=users",
+		"--alter=ADD COLUMN email text", "--execute", "--allow-on-master"}
+	if args := o.args("shop", "users", "ADD COLUMN email text", "my.cnf"); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+	if o.command() != "gh-ost" {
+		t.Errorf("expected gh-ost, got %v", o.command())
+	}
+
+	o = &OnlineDDL{Tool: PtOSC, Host: "db", Port: "3306"}
+	expected = []string{"--alter=ADD COLUMN email text", "--execute", "F=my.cnf,h=db,P=3306,D=other,t=users"}
+	if args := o.args("shop", "other.users", "ADD COLUMN email text", "my.cnf"); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+	if o.command() != "pt-online-schema-change" {
+		t.Errorf("expected pt-online-schema-change, got %v", o.command())
+	}
+}
+
+func TestParseOnlineDDL(t *testing.T) {
+	config := &mysql.Config{Net: "tcp", Addr: "db:3306", User: "root", Passwd: "secret"}
+	o, err := parseOnlineDDL(map[string]string{"x-online-ddl": "gh-ost", "x-online-ddl-flags": "--chunk-size=500  --allow-on-master"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &OnlineDDL{Tool: GhOst, Flags: []string{"--chunk-size=500", "--allow-on-master"},
+		Host: "db", Port: "3306", User: "root", Password: "secret"}
+	if !reflect.DeepEqual(o, expected) {
+		t.Errorf("expected %+v, got %+v", expected, o)
+	}
+
+	if o, err := parseOnlineDDL(map[string]string{}, config); o != nil || err != nil {
+		t.Errorf("expected no online DDL, got %v, %v", o, err)
+	}
+	if _, err := parseOnlineDDL(map[string]string{"x-online-ddl": "osc"}, config); err == nil {
+		t.Error("expected unknown tool to fail")
+	}
+	unix := &mysql.Config{Net: "unix", Addr: "/tmp/mysql.sock"}
+	if _, err := parseOnlineDDL(map[string]string{"x-online-ddl": "pt-osc"}, unix); err == nil {
+		t.Error("expected unix socket to fail")
+	}
+}
+
+func TestOnlineDDLRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "online-ddl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the fake tool prints the credentials of --conf and fails for DROP
+	tool := filepath.Join(dir, "gh-ost")
+	script := "#!/bin/sh\ncat ${1#--conf=}\ncase \"$*\" in *DROP*) exit 1;; esac\n"
+	if err := ioutil.WriteFile(tool, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	o := &OnlineDDL{Tool: GhOst, Command: tool, Host: "db", Port: "3306", User: "root", Password: "secret", Output: &output}
+	if err := o.run("shop", "users", "ADD COLUMN email text"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[client]\nuser=root\npassword=secret\n"; output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+	if err := o.run("shop", "users", "DROP COLUMN email"); err == nil {
+		t.Error("expected failing tool to fail")
+	}
+}
@@ -2,7 +2,6 @@ package neo4j
 
 import (
 	"C" // import C so that we can't compile with CGO_ENABLED=0
-	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,6 +10,7 @@ import (
 	"sync/atomic"
 
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
 	"github.com/hashicorp/go-multierror"
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 )
@@ -53,8 +53,18 @@ func WithInstance(config *Config) (database.Driver, error) {
 		return nil, err
 	}
 
+	return WithDriver(neoDriver, config)
+}
+
+// WithDriver returns a database instance using an already created neo4j driver,
+// config.URL and config.AuthToken are ignored.
+func WithDriver(instance neo4j.Driver, config *Config) (database.Driver, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+
 	driver := &Neo4j{
-		driver: neoDriver,
+		driver: instance,
 		config: config,
 	}
 
@@ -129,14 +139,10 @@ func (n *Neo4j) Run(migration io.Reader) (err error) {
 	}()
 
 	if n.config.MultiStatement {
-		statements := bytes.Split(body, StatementSeparator)
+		statements := multistmt.Split(body, multistmt.Delimiter(body, StatementSeparator))
 		_, err = session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 			for _, stmt := range statements {
-				trimStmt := bytes.TrimSpace(stmt)
-				if len(trimStmt) == 0 {
-					continue
-				}
-				result, err := transaction.Run(string(trimStmt[:]), nil)
+				result, err := transaction.Run(string(stmt[:]), nil)
 				if _, err := neo4j.Collect(result, err); err != nil {
 					return nil, err
 				}
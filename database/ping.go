@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	nurl "net/url"
+	"strings"
+
+	iurl "github.com/golang-migrate/migrate/v4/internal/url"
+	"github.com/golang-migrate/migrate/v4/proxy"
+)
+
+// Kinds of PingError
+const (
+	PingDNS     = "dns"
+	PingTLS     = "tls"
+	PingAuth    = "auth"
+	PingNetwork = "network"
+	PingTimeout = "timeout"
+	PingOther   = "other"
+)
+
+// PingError classifies why Ping failed.
+type PingError struct {
+	// Kind is one of PingDNS, PingTLS, PingAuth, PingNetwork, PingTimeout or PingOther
+	Kind string
+	Err  error
+}
+
+func (e *PingError) Error() string {
+	if e.Kind == PingOther {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v error: %v", e.Kind, e.Err)
+}
+
+// Pinger is an optional interface a driver can implement to check that the
+// database accepts connections, without accessing the version table like Open.
+// Authentication failures should be returned as a PingError of kind PingAuth.
+type Pinger interface {
+	Ping(ctx context.Context, url string) error
+}
+
+// Ping connects to the database at url with the registered driver, without
+// accessing the version table. Errors are returned as PingError. Drivers not
+// implementing Pinger are checked by dialing the host of the url.
+func Ping(ctx context.Context, url string) error {
+	scheme, err := iurl.SchemeFromURL(url)
+	if err != nil {
+		return &PingError{Kind: PingOther, Err: err}
+	}
+
+	driversMu.RLock()
+	d, ok := drivers[scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return &PingError{Kind: PingOther, Err: fmt.Errorf("database driver: unknown driver %v (forgotten import?)", scheme)}
+	}
+
+	if p, ok := d.(Pinger); ok {
+		err = p.Ping(ctx, url)
+	} else {
+		err = dial(ctx, url)
+	}
+	if err == nil {
+		return nil
+	}
+	if pe, ok := err.(*PingError); ok {
+		return pe
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return &PingError{Kind: PingTimeout, Err: err}
+	}
+	return &PingError{Kind: classify(err), Err: err}
+}
+
+// dial opens a TCP connection to the host of url, through the proxy in effect
+func dial(ctx context.Context, url string) error {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return err
+	}
+	if u.Port() == "" {
+		return fmt.Errorf("database driver %v can't be pinged without a port in the url", u.Scheme)
+	}
+	conn, err := proxy.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// classify returns the kind of a network related error
+func classify(err error) string {
+	for {
+		switch e := err.(type) {
+		case *net.DNSError:
+			return PingDNS
+		case tls.RecordHeaderError, x509.UnknownAuthorityError, x509.HostnameError,
+			x509.CertificateInvalidError, *x509.UnknownAuthorityError, *x509.HostnameError,
+			*x509.CertificateInvalidError:
+			return PingTLS
+		case *nurl.Error:
+			err = e.Err
+		case *net.OpError:
+			if _, ok := e.Err.(*net.DNSError); ok {
+				return PingDNS
+			}
+			if e.Timeout() {
+				return PingTimeout
+			}
+			return PingNetwork
+		case net.Error:
+			if e.Timeout() {
+				return PingTimeout
+			}
+			return PingNetwork
+		default:
+			// tls alerts and driver specific TLS errors aren't exported
+			msg := err.Error()
+			if strings.Contains(msg, "tls:") || strings.Contains(msg, "x509:") || strings.Contains(msg, "SSL") {
+				return PingTLS
+			}
+			return PingOther
+		}
+	}
+}
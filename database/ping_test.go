@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	Register("mockping", &mockDriver{})
+	defer func() {
+		driversMu.Lock()
+		delete(drivers, "mockping")
+		driversMu.Unlock()
+	}()
+
+	cases := []struct {
+		url  string
+		kind string
+	}{
+		{"mockping://" + l.Addr().String() + "/db", ""},
+		{"mockping://localhost/db", PingOther},
+		{"unknown://localhost/db", PingOther},
+		{"mockping://nonexistent.invalid:5432/db", PingDNS},
+	}
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			err := Ping(context.Background(), c.url)
+			if c.kind == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			pe, ok := err.(*PingError)
+			if !ok {
+				t.Fatalf("expected PingError, got %v", err)
+			}
+			if pe.Kind != c.kind {
+				t.Errorf("expected kind %v, got %v", c.kind, pe)
+			}
+		})
+	}
+}
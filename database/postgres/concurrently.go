@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+)
+
+// DefaultConcurrentIndexRetries is the ConcurrentIndexRetries of Open.
+var DefaultConcurrentIndexRetries = 1
+
+var (
+	mentionsConcurrently = regexp.MustCompile(`(?i)\bCONCURRENTLY\b`)
+	leadingComments      = regexp.MustCompile(`^(?s:\s*(?:--[^\n]*|/\*.*?\*/))*\s*`)
+
+	// concurrently matches the statements which can't run inside a
+	// transaction block because of CONCURRENTLY
+	concurrently = regexp.MustCompile(`(?is)^(?:CREATE\s+(?:UNIQUE\s+)?INDEX|DROP\s+INDEX|REINDEX|ALTER\s+TABLE\s.*\bDETACH\s+PARTITION)\b.*?\bCONCURRENTLY\b`)
+
+	identifier = `(?:"(?:[^"]|"")+"|[\w$]+)`
+	// concurrentIndex matches CREATE INDEX CONCURRENTLY with the name of
+	// the index and the schema of the table
+	concurrentIndex = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\s+(?:IF\s+NOT\s+EXISTS\s+)?(` +
+		identifier + `)\s+ON\s+(?:ONLY\s+)?(?:(` + identifier + `)\.)?` + identifier)
+)
+
+// isConcurrently returns true if stmt can't run inside a transaction block
+// because of CONCURRENTLY, e.g. CREATE INDEX CONCURRENTLY.
+func isConcurrently(stmt []byte) bool {
+	return concurrently.Match(leadingComments.ReplaceAll(stmt, nil))
+}
+
+// concurrentIndexName returns the name of the index created by a CREATE
+// INDEX CONCURRENTLY statement, qualified by the schema of its table, or ""
+// for other statements and unnamed indexes.
+func concurrentIndexName(stmt []byte) string {
+	m := concurrentIndex.FindSubmatch(leadingComments.ReplaceAll(stmt, nil))
+	if m == nil {
+		return ""
+	}
+	if len(m[2]) > 0 {
+		return string(m[2]) + "." + string(m[1])
+	}
+	return string(m[1])
+}
+
+// splitConcurrently returns the statements of migr if one of them can't run
+// inside a transaction block because of CONCURRENTLY, or nil.
+func splitConcurrently(migr []byte) [][]byte {
+	if !mentionsConcurrently.Match(migr) {
+		return nil
+	}
+	stmts := multistmt.Split(migr, multistmt.Delimiter(migr, multistmt.DefaultDelimiter))
+	for _, stmt := range stmts {
+		if isConcurrently(stmt) {
+			return stmts
+		}
+	}
+	return nil
+}
+
+// runOutsideTransaction runs each statement on its own, so that none of
+// them ends up in the implicit transaction of a multi-statement query.
+// Indexes created concurrently are verified. A statement which ran into
+// DDLLockTimeout is retried.
+func (p *Postgres) runOutsideTransaction(ctx context.Context, stmts [][]byte) error {
+	for _, stmt := range stmts {
+		stmt := stmt
+		err := p.retryLocked(func() error {
+			if index := concurrentIndexName(stmt); index != "" {
+				return p.createIndexConcurrently(ctx, stmt, index)
+			}
+			return p.runStatement(ctx, p.conn, stmt)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexConcurrently runs the CREATE INDEX CONCURRENTLY stmt of index
+// and checks that the index is valid. A failed build, e.g. by a deadlock,
+// leaves an invalid index behind, which is dropped and built again up to
+// ConcurrentIndexRetries times.
+func (p *Postgres) createIndexConcurrently(ctx context.Context, stmt []byte, index string) error {
+	for attempt := 0; ; attempt++ {
+		// an invalid index of an earlier attempt or run would fail the
+		// build, or be kept by IF NOT EXISTS
+		if err := p.dropInvalidIndex(ctx, index); err != nil {
+			return err
+		}
+		err := p.runStatement(ctx, p.conn, stmt)
+		if err == nil {
+			valid, errValid := p.indexValid(ctx, index)
+			if errValid != nil || valid {
+				return errValid
+			}
+			err = database.Error{Err: fmt.Sprintf("index %v is invalid after building it concurrently", index), Query: stmt}
+		}
+		if attempt >= p.config.ConcurrentIndexRetries {
+			return err
+		}
+	}
+}
+
+// indexValid returns false if index exists but is invalid
+func (p *Postgres) indexValid(ctx context.Context, index string) (bool, error) {
+	query := `SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`
+	var valid bool
+	err := p.conn.QueryRowContext(ctx, query, index).Scan(&valid)
+	if err == sql.ErrNoRows {
+		return true, nil
+	} else if err != nil {
+		return false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return valid, nil
+}
+
+func (p *Postgres) dropInvalidIndex(ctx context.Context, index string) error {
+	valid, err := p.indexValid(ctx, index)
+	if err != nil || valid {
+		return err
+	}
+	query := `DROP INDEX CONCURRENTLY IF EXISTS ` + index
+	if _, err := p.conn.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestConcurrently(t *testing.T) {
+	cases := []struct {
+		stmt         string
+		concurrently bool
+		index        string
+	}{
+		{stmt: "CREATE INDEX CONCURRENTLY users_email ON users (email)", concurrently: true, index: "users_email"},
+		{stmt: "-- migrate:statement-timeout 0\n/* big */ create unique index concurrently if not exists \"Users_Email\" on app.users (email)",
+			concurrently: true, index: `app."Users_Email"`},
+		{stmt: "CREATE INDEX CONCURRENTLY ON users (email)", concurrently: true},
+		{stmt: "DROP INDEX CONCURRENTLY users_email", concurrently: true},
+		{stmt: "REINDEX INDEX CONCURRENTLY users_email", concurrently: true},
+		{stmt: "ALTER TABLE measurements DETACH PARTITION measurements_2020 CONCURRENTLY", concurrently: true},
+		{stmt: "CREATE INDEX users_email ON users (email)"},
+		{stmt: "REFRESH MATERIALIZED VIEW CONCURRENTLY stats"},
+		{stmt: "COMMENT ON INDEX users_email IS 'built CONCURRENTLY'"},
+	}
+	for _, c := range cases {
+		if concurrently := isConcurrently([]byte(c.stmt)); concurrently != c.concurrently {
+			t.Errorf("%q: expected concurrently %v, got %v", c.stmt, c.concurrently, concurrently)
+		}
+		if index := concurrentIndexName([]byte(c.stmt)); index != c.index {
+			t.Errorf("%q: expected index %q, got %q", c.stmt, c.index, index)
+		}
+	}
+}
+
+func TestSplitConcurrently(t *testing.T) {
+	if stmts := splitConcurrently([]byte("CREATE TABLE users (email text); CREATE INDEX users_email ON users (email);")); stmts != nil {
+		t.Errorf("expected no split, got %q", stmts)
+	}
+	stmts := splitConcurrently([]byte("CREATE TABLE users (email text);\nCREATE INDEX CONCURRENTLY users_email ON users (email);"))
+	if len(stmts) != 2 {
+		t.Errorf("expected 2 statements, got %q", stmts)
+	}
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// Defaults of Open for the retries of statements which ran into
+// DDLLockTimeout.
+var (
+	DefaultDDLRetries      = 5
+	DefaultDDLRetryBackoff = time.Second
+)
+
+// lockNotAvailable is the code of the error of an exceeded lock_timeout
+const lockNotAvailable = "55P03"
+
+// sleep is replaced by tests
+var sleep = time.Sleep
+
+func setLockTimeout(ctx context.Context, ex execer, timeout time.Duration) error {
+	query := `SET lock_timeout = ` + strconv.FormatInt(int64(timeout/time.Millisecond), 10)
+	if _, err := ex.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// resetLockTimeout restores lock_timeout of the session, e.g. the one
+// configured for the role
+func resetLockTimeout(ctx context.Context, ex execer) error {
+	query := `RESET lock_timeout`
+	if _, err := ex.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// isLockTimeout returns true if err is caused by an exceeded lock_timeout
+func isLockTimeout(err error) bool {
+	switch e := err.(type) {
+	case database.Error:
+		err = e.OrigErr
+	case *database.Error:
+		err = e.OrigErr
+	}
+	pgErr, ok := err.(*pq.Error)
+	return ok && pgErr.Code == lockNotAvailable
+}
+
+// retryLockTimeout runs f, which must be safe to repeat after a failure,
+// e.g. a statement or transaction. As long as it fails because of an
+// exceeded lock_timeout, it is retried up to retries times, waiting
+// backoff, doubled on every retry, in between.
+func retryLockTimeout(retries int, backoff time.Duration, f func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if attempt >= retries || !isLockTimeout(err) {
+			return err
+		}
+		sleep(backoff << uint(attempt))
+	}
+}
+
+// retryLocked runs f with the retries of DDLLockTimeout, if it is set
+func (p *Postgres) retryLocked(f func() error) error {
+	if p.config.DDLLockTimeout <= 0 {
+		return f()
+	}
+	return retryLockTimeout(p.config.DDLRetries, p.config.DDLRetryBackoff, f)
+}
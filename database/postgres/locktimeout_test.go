@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+func TestRetryLockTimeout(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) {
+		slept = append(slept, d)
+	}
+	defer func() {
+		sleep = time.Sleep
+	}()
+
+	lockTimeout := database.Error{OrigErr: &pq.Error{Code: lockNotAvailable}, Err: "migration failed"}
+	other := errors.New("syntax error")
+
+	cases := []struct {
+		name     string
+		errs     []error
+		expected error
+		slept    []time.Duration
+	}{
+		{name: "success", errs: []error{nil}},
+		{name: "other error", errs: []error{other}, expected: other},
+		{name: "retried", errs: []error{lockTimeout, &lockTimeout, nil}, slept: []time.Duration{time.Second, 2 * time.Second}},
+		{name: "exhausted", errs: []error{lockTimeout, lockTimeout, lockTimeout, lockTimeout}, expected: lockTimeout,
+			slept: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			slept = nil
+			calls := 0
+			err := retryLockTimeout(3, time.Second, func() error {
+				calls++
+				return c.errs[calls-1]
+			})
+			if !reflect.DeepEqual(err, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, err)
+			}
+			if calls != len(c.errs) {
+				t.Errorf("expected %v calls, got %v", len(c.errs), calls)
+			}
+			if !reflect.DeepEqual(slept, c.slept) {
+				t.Errorf("expected to sleep %v, got %v", c.slept, slept)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// Package pgxpool creates postgres driver instances from an existing
+// *pgxpool.Pool of github.com/jackc/pgx/v5, keeping the settings of the pool,
+// e.g. its size, connection hooks and tracers.
+package pgxpool
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+)
+
+// WithPool returns a postgres driver instance using connections of pool.
+// Closing the driver instance returns its connections to the pool, but
+// doesn't close the pool, which stays owned by the caller.
+func WithPool(pool *pgxpool.Pool, config *postgres.Config) (database.Driver, error) {
+	db := stdlib.OpenDBFromPool(pool)
+	d, err := postgres.WithInstance(db, config)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
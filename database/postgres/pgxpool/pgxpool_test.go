@@ -0,0 +1,70 @@
+package pgxpool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dhui/dktest"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	dt "github.com/golang-migrate/migrate/v4/database/testing"
+	"github.com/golang-migrate/migrate/v4/dktesting"
+)
+
+const pgPassword = "postgres"
+
+var (
+	opts = dktest.Options{
+		Env:          map[string]string{"POSTGRES_PASSWORD": pgPassword},
+		PortRequired: true, ReadyFunc: isReady}
+	specs = []dktesting.ContainerSpec{
+		{ImageName: "postgres:12", Options: opts},
+	}
+)
+
+func pgConnectionString(host, port string) string {
+	return fmt.Sprintf("postgres://postgres:%s@%s:%s/postgres?sslmode=disable", pgPassword, host, port)
+}
+
+func isReady(ctx context.Context, c dktest.ContainerInfo) bool {
+	ip, port, err := c.FirstPort()
+	if err != nil {
+		return false
+	}
+	pool, err := pgxpool.New(ctx, pgConnectionString(ip, port))
+	if err != nil {
+		return false
+	}
+	defer pool.Close()
+	return pool.Ping(ctx) == nil
+}
+
+func Test(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pool, err := pgxpool.New(context.Background(), pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.Close()
+
+		d, err := WithPool(pool, &postgres.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dt.Test(t, d, []byte("SELECT 1"))
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// the pool stays open
+		if err := pool.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
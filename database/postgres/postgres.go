@@ -5,9 +5,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io"
-	"io/ioutil"
 	nurl "net/url"
 	"strconv"
 	"strings"
@@ -15,6 +15,9 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/proxy"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/lib/pq"
 )
@@ -39,6 +42,37 @@ type Config struct {
 	DatabaseName     string
 	SchemaName       string
 	StatementTimeout time.Duration
+
+	// ReadOnly opens the driver read-only, see database.ReadOnlyDriver.
+	ReadOnly bool
+
+	// VersionTable, if set, replaces the layout of the version table,
+	// see database.VersionTable.
+	VersionTable *database.VersionTable
+
+	// ConcurrentIndexRetries is how often an index left invalid by a
+	// failed CREATE INDEX CONCURRENTLY is dropped and built again.
+	ConcurrentIndexRetries int
+
+	// DDLLockTimeout, if set, is the lock_timeout of the statements of
+	// migrations, so that they fail rather than block the queries of
+	// the application queued behind them while they wait for a lock.
+	// They are retried up to DDLRetries times, waiting DDLRetryBackoff,
+	// doubled on every retry, in between.
+	DDLLockTimeout  time.Duration
+	DDLRetries      int
+	DDLRetryBackoff time.Duration
+
+	// StreamThreshold is the size of migrations in bytes above which they
+	// run statement by statement while they are read, rather than being
+	// read into memory, see database.ReadMigration.
+	StreamThreshold int64
+
+	// Savepoints, if set, runs the statements of migrations one by one
+	// with a savepoint before each, SavepointsReport or SavepointsResume.
+	// Streamed migrations and migrations running outside of a transaction
+	// aren't affected.
+	Savepoints string
 }
 
 type Postgres struct {
@@ -47,6 +81,12 @@ type Postgres struct {
 	db       *sql.DB
 	isLocked bool
 
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
+
+	// tx is set while a transaction started with Begin is in progress
+	tx *sql.Tx
+
 	// Open and WithInstance need to guarantee that config is never nil
 	config *Config
 }
@@ -89,7 +129,7 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	}
 
 	if len(config.MigrationsTable) == 0 {
-		config.MigrationsTable = DefaultMigrationsTable
+		config.MigrationsTable = config.VersionTable.DefaultTable(DefaultMigrationsTable)
 	}
 
 	conn, err := instance.Conn(context.Background())
@@ -98,12 +138,33 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 		return nil, err
 	}
 
+	// set per session, so the server cancels runaway statements even if
+	// the client stops waiting
+	if config.StatementTimeout > 0 {
+		if err := setStatementTimeout(context.Background(), conn, config.StatementTimeout); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if config.ReadOnly {
+		query := `SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY`
+		if _, err := conn.ExecContext(context.Background(), query); err != nil {
+			conn.Close()
+			return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
 	px := &Postgres{
 		conn:   conn,
 		db:     instance,
 		config: config,
 	}
 
+	if config.ReadOnly {
+		return px, nil
+	}
+
 	if err := px.ensureVersionTable(); err != nil {
 		return nil, err
 	}
@@ -111,31 +172,98 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	return px, nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (p *Postgres) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*Postgres).sharedDB = true
+	return d, nil
+}
+
 func (p *Postgres) Open(url string) (database.Driver, error) {
-	purl, err := nurl.Parse(url)
+	purl, err := ParseURL(url)
 	if err != nil {
 		return nil, err
 	}
 
-	db, err := sql.Open("postgres", migrate.FilterCustomQuery(purl).String())
+	params, err := database.ParseConnParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	connURL, err := pqURL(purl)
+	if err != nil {
+		return nil, err
+	}
+	db, err := OpenDB(connURL, params)
 	if err != nil {
 		return nil, err
 	}
 
 	migrationsTable := purl.Query().Get("x-migrations-table")
-	statementTimeoutString := purl.Query().Get("x-statement-timeout")
-	statementTimeout := 0
-	if statementTimeoutString != "" {
-		statementTimeout, err = strconv.Atoi(statementTimeoutString)
-		if err != nil {
+	var statementTimeout time.Duration
+	if s := purl.Query().Get("x-statement-timeout"); s != "" {
+		if statementTimeout, err = database.ParseTimeout(s); err != nil {
 			return nil, err
 		}
 	}
+	readOnly, err := database.ParseReadOnly(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	versionTable, err := database.ParseVersionTable(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	concurrentIndexRetries := DefaultConcurrentIndexRetries
+	if s := purl.Query().Get("x-concurrent-index-retries"); s != "" {
+		if concurrentIndexRetries, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("invalid x-concurrent-index-retries %q: %v", s, err)
+		}
+	}
+	var ddlLockTimeout time.Duration
+	if s := purl.Query().Get("x-ddl-lock-timeout"); s != "" {
+		if ddlLockTimeout, err = database.ParseTimeout(s); err != nil {
+			return nil, err
+		}
+	}
+	ddlRetries := DefaultDDLRetries
+	if s := purl.Query().Get("x-ddl-retries"); s != "" {
+		if ddlRetries, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("invalid x-ddl-retries %q: %v", s, err)
+		}
+	}
+	ddlRetryBackoff := DefaultDDLRetryBackoff
+	if s := purl.Query().Get("x-ddl-retry-backoff"); s != "" {
+		if ddlRetryBackoff, err = database.ParseTimeout(s); err != nil {
+			return nil, err
+		}
+	}
+	streamThreshold, err := database.ParseStreamThreshold(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	savepoints := purl.Query().Get("x-savepoints")
+	switch savepoints {
+	case "", SavepointsReport, SavepointsResume:
+	default:
+		return nil, fmt.Errorf("invalid x-savepoints %q, expected %v or %v", savepoints, SavepointsReport, SavepointsResume)
+	}
 
 	px, err := WithInstance(db, &Config{
-		DatabaseName:     purl.Path,
-		MigrationsTable:  migrationsTable,
-		StatementTimeout: time.Duration(statementTimeout) * time.Millisecond,
+		DatabaseName:           purl.Path,
+		MigrationsTable:        migrationsTable,
+		StatementTimeout:       statementTimeout,
+		ReadOnly:               readOnly,
+		VersionTable:           versionTable,
+		ConcurrentIndexRetries: concurrentIndexRetries,
+		DDLLockTimeout:         ddlLockTimeout,
+		DDLRetries:             ddlRetries,
+		DDLRetryBackoff:        ddlRetryBackoff,
+		StreamThreshold:        streamThreshold,
+		Savepoints:             savepoints,
 	})
 
 	if err != nil {
@@ -145,8 +273,147 @@ func (p *Postgres) Open(url string) (database.Driver, error) {
 	return px, nil
 }
 
+// ParseURL parses a postgres URL. Like libpq, it accepts the directory of a
+// unix socket as percent-encoded host, e.g.
+// postgres://user@%2Fvar%2Frun%2Fpostgresql/db, which net/url rejects. The
+// directory is moved to the host parameter, where lib/pq expects it.
+func ParseURL(url string) (*nurl.URL, error) {
+	u, err := nurl.Parse(url)
+	if err == nil {
+		return u, nil
+	}
+
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return nil, err
+	}
+	rest := url[i+len("://"):]
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	userinfo, host := "", rest[:end]
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		userinfo, host = host[:at+1], host[at+1:]
+	}
+	if !strings.HasPrefix(strings.ToUpper(host), "%2F") {
+		return nil, err
+	}
+	var port string
+	if c := strings.LastIndex(host, ":"); c >= 0 {
+		host, port = host[:c], host[c+1:]
+	}
+	dir, errDir := nurl.PathUnescape(host)
+	if errDir != nil {
+		return nil, err
+	}
+
+	u, errURL := nurl.Parse(url[:i+len("://")] + userinfo + rest[end:])
+	if errURL != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("host", dir)
+	if port != "" {
+		q.Set("port", port)
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// pqURL returns purl without x- parameters, the x-tls- parameters are
+// translated to the ssl parameters of lib/pq.
+func pqURL(purl *nurl.URL) (*nurl.URL, error) {
+	tlsParams, err := database.ParseTLSParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	u := migrate.FilterCustomQuery(purl)
+	if !tlsParams.IsSet() {
+		return u, nil
+	}
+
+	q := u.Query()
+	if q.Get("sslmode") == "" {
+		switch {
+		case tlsParams.InsecureSkipVerify:
+			q.Set("sslmode", "require")
+		case tlsParams.CA != "":
+			q.Set("sslmode", "verify-full")
+		}
+	}
+	// lib/pq verifies the server with sslrootcert even for sslmode=require
+	if tlsParams.CA != "" && !tlsParams.InsecureSkipVerify {
+		q.Set("sslrootcert", tlsParams.CA)
+	}
+	if tlsParams.Cert != "" {
+		q.Set("sslcert", tlsParams.Cert)
+		q.Set("sslkey", tlsParams.Key)
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// OpenDB opens a lib/pq connection pool for purl, which must not contain
+// x- parameters, with the connection settings of params applied.
+func OpenDB(purl *nurl.URL, params database.ConnParams) (*sql.DB, error) {
+	if timeout := database.Seconds(params.ConnectTimeout); timeout != "" {
+		q := purl.Query()
+		q.Set("connect_timeout", timeout)
+		u := *purl
+		u.RawQuery = q.Encode()
+		purl = &u
+	}
+	dsn := purl.String()
+
+	var db *sql.DB
+	if params.ReadTimeout > 0 || proxy.Enabled() {
+		dialer := &database.Dialer{ReadTimeout: params.ReadTimeout}
+		db = database.OpenDB(&pq.Driver{}, func() (driver.Conn, error) {
+			return pq.DialOpen(dialer, dsn)
+		})
+	} else {
+		var err error
+		if db, err = sql.Open("postgres", dsn); err != nil {
+			return nil, err
+		}
+	}
+	params.Apply(db)
+	return db, nil
+}
+
+// Ping connects to the database without accessing the version table.
+func (p *Postgres) Ping(ctx context.Context, url string) error {
+	purl, err := ParseURL(url)
+	if err != nil {
+		return err
+	}
+
+	connURL, err := pqURL(purl)
+	if err != nil {
+		return err
+	}
+	db, err := OpenDB(connURL, database.ConnParams{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		// class 28: invalid authorization specification
+		if e, ok := err.(*pq.Error); ok && e.Code.Class() == "28" {
+			return &database.PingError{Kind: database.PingAuth, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
 func (p *Postgres) Close() error {
 	connErr := p.conn.Close()
+	if p.sharedDB {
+		return connErr
+	}
 	dbErr := p.db.Close()
 	if connErr != nil || dbErr != nil {
 		return fmt.Errorf("conn: %v, db: %v", connErr, dbErr)
@@ -156,6 +423,9 @@ func (p *Postgres) Close() error {
 
 // https://www.postgresql.org/docs/9.6/static/explicit-locking.html#ADVISORY-LOCKS
 func (p *Postgres) Lock() error {
+	if p.config.ReadOnly {
+		return database.ErrReadOnly
+	}
 	if p.isLocked {
 		return database.ErrLocked
 	}
@@ -175,6 +445,11 @@ func (p *Postgres) Lock() error {
 	return nil
 }
 
+// ReadOnly implements database.ReadOnlyDriver.
+func (p *Postgres) ReadOnly() bool {
+	return p.config.ReadOnly
+}
+
 func (p *Postgres) Unlock() error {
 	if !p.isLocked {
 		return nil
@@ -193,20 +468,162 @@ func (p *Postgres) Unlock() error {
 	return nil
 }
 
-func (p *Postgres) Run(migration io.Reader) error {
-	migr, err := ioutil.ReadAll(migration)
+// LockHolder returns the session holding the advisory lock. Its PID is the
+// one of the server process, Since the start of the session.
+func (p *Postgres) LockHolder() (*database.LockInfo, error) {
+	aid, err := database.GenerateAdvisoryLockId(p.config.DatabaseName, p.config.SchemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT a.pid, COALESCE(a.client_hostname, host(a.client_addr), ''), COALESCE(a.usename, ''), a.backend_start
+		FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted AND l.classid = 0 AND l.objid = $1 AND l.objsubid = 1`
+	info := &database.LockInfo{}
+	err = p.conn.QueryRowContext(context.Background(), query, aid).Scan(&info.PID, &info.Hostname, &info.User, &info.Since)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return info, nil
+}
+
+// ForceUnlock terminates the session holding the advisory lock, which releases it.
+func (p *Postgres) ForceUnlock() error {
+	if p.isLocked {
+		return p.Unlock()
+	}
+	aid, err := database.GenerateAdvisoryLockId(p.config.DatabaseName, p.config.SchemaName)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT pg_terminate_backend(pid) FROM pg_locks
+		WHERE locktype = 'advisory' AND granted AND classid = 0 AND objid = $1 AND objsubid = 1`
+	if _, err := p.conn.ExecContext(context.Background(), query, aid); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+func (p *Postgres) Run(migration io.Reader) (err error) {
+	migr, stream, err := database.ReadMigration(migration, p.config.StreamThreshold)
 	if err != nil {
 		return err
 	}
 	ctx := context.Background()
-	if p.config.StatementTimeout != 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, p.config.StatementTimeout)
-		defer cancel()
+
+	pragmas := pragma.Parse(migr)
+	if v, ok := pragmas.Get(pragma.StatementTimeout); ok {
+		timeout, err := database.ParseTimeout(v)
+		if err != nil {
+			return err
+		}
+		ex := p.execer()
+		if err := setStatementTimeout(ctx, ex, timeout); err != nil {
+			return err
+		}
+		defer func() {
+			// a failed migration aborts an open transaction, whose
+			// rollback restores the timeout anyway
+			if errRestore := restoreStatementTimeout(ctx, ex, p.config.StatementTimeout); errRestore != nil && err == nil {
+				err = errRestore
+			}
+		}()
+	}
+
+	if p.config.DDLLockTimeout > 0 {
+		ex := p.execer()
+		if err := setLockTimeout(ctx, ex, p.config.DDLLockTimeout); err != nil {
+			return err
+		}
+		defer func() {
+			if errRestore := resetLockTimeout(ctx, ex); errRestore != nil && err == nil {
+				err = errRestore
+			}
+		}()
+	}
+
+	if stream != nil {
+		return p.runStream(ctx, pragmas, multistmt.NewScanner(stream, multistmt.Delimiter(migr, multistmt.DefaultDelimiter)))
 	}
-	// run migration
+
+	switch {
+	case pragmas.Has(pragma.NoTransaction):
+		// run each statement on its own, so that none of them
+		// ends up in the implicit transaction of a multi-statement query
+		if p.tx != nil {
+			return database.ErrNoTransaction
+		}
+		return p.runOutsideTransaction(ctx, multistmt.Split(migr, multistmt.Delimiter(migr, multistmt.DefaultDelimiter)))
+
+	case p.config.Savepoints != "" && (p.tx != nil || splitConcurrently(migr) == nil):
+		return p.runSavepoints(ctx, migr)
+
+	case pragmas.Has(pragma.Transaction) && p.tx == nil:
+		return p.retryLocked(func() error {
+			tx, err := p.conn.BeginTx(ctx, &sql.TxOptions{})
+			if err != nil {
+				return &database.Error{OrigErr: err, Err: "transaction start failed"}
+			}
+			if err := p.runStatement(ctx, tx, migr); err != nil {
+				if errRollback := tx.Rollback(); errRollback != nil {
+					return multierror.Append(err, errRollback)
+				}
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+			}
+			return nil
+		})
+
+	default:
+		// statements with CONCURRENTLY refuse to run inside a transaction
+		// block, so the migration runs like with the no-transaction pragma
+		if stmts := splitConcurrently(migr); stmts != nil && p.tx == nil {
+			return p.runOutsideTransaction(ctx, stmts)
+		}
+		if p.tx != nil {
+			// the transaction is aborted by a failure, so it can't be
+			// retried
+			return p.runStatement(ctx, p.tx, migr)
+		}
+		// the implicit transaction of the statements is rolled back by a
+		// failure, so it can be retried
+		return p.retryLocked(func() error {
+			return p.runStatement(ctx, p.conn, migr)
+		})
+	}
+}
+
+// setStatementTimeout sets statement_timeout of the session, zero disables it.
+func setStatementTimeout(ctx context.Context, ex execer, timeout time.Duration) error {
+	query := `SET statement_timeout = ` + strconv.FormatInt(int64(timeout/time.Millisecond), 10)
+	if _, err := ex.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// restoreStatementTimeout sets statement_timeout of the session back to
+// timeout, or to the default of the server or role if timeout is zero.
+func restoreStatementTimeout(ctx context.Context, ex execer, timeout time.Duration) error {
+	if timeout > 0 {
+		return setStatementTimeout(ctx, ex, timeout)
+	}
+	query := `RESET statement_timeout`
+	if _, err := ex.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+func (p *Postgres) runStatement(ctx context.Context, ex execer, migr []byte) error {
 	query := string(migr[:])
-	if _, err := p.conn.ExecContext(ctx, query); err != nil {
+	if _, err := ex.ExecContext(ctx, query); err != nil {
 		if pgErr, ok := err.(*pq.Error); ok {
 			var line uint
 			var col uint
@@ -266,38 +683,333 @@ func runesLastIndex(input []rune, target rune) int {
 	return -1
 }
 
+// ReplicationLag implements database.LagChecker.
+func (p *Postgres) ReplicationLag(query string) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	if err := p.conn.QueryRowContext(context.Background(), query).Scan(&seconds); err != nil {
+		return 0, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+// Query implements database.Querier.
+func (p *Postgres) Query(query string, args ...interface{}) ([]database.Row, error) {
+	return database.QueryRows(p.queryer(), query, args...)
+}
+
+func (p *Postgres) Exec(query string, args ...interface{}) (int64, error) {
+	return database.ExecRows(p.queryer(), query, args...)
+}
+
+// CreateTable implements database.TableCreator.
+func (p *Postgres) CreateTable(table, columns string) error {
+	_, err := p.Exec("CREATE TABLE IF NOT EXISTS " + database.QuoteTable(table, pq.QuoteIdentifier) + " (" + columns + ")")
+	return err
+}
+
+// QuoteIdentifier implements database.IdentifierQuoter.
+func (p *Postgres) QuoteIdentifier(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+// Load implements database.Loader with COPY FROM STDIN, or with batched
+// inserts if the *sql.DB doesn't use lib/pq, e.g. a pgxpool.Pool.
+// table may be qualified by its schema, e.g. `public.countries`.
+func (p *Postgres) Load(table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	if p.tx != nil {
+		return p.copyIn(p.tx, table, columns, next)
+	}
+
+	tx, err := p.conn.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return 0, &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	loaded, err := p.copyIn(tx, table, columns, next)
+	if err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			err = multierror.Append(err, errRollback)
+		}
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return loaded, nil
+}
+
+func (p *Postgres) copyIn(tx *sql.Tx, table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	if _, ok := p.db.Driver().(*pq.Driver); !ok {
+		return database.InsertRows(tx, table, columns, next, pq.QuoteIdentifier, database.Dollar)
+	}
+
+	query := pq.CopyIn(table, columns...)
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		query = pq.CopyInSchema(table[:i], table[i+1:], columns...)
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return 0, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	defer stmt.Close()
+
+	var loaded int64
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return loaded, err
+		}
+		if _, err := stmt.Exec(row...); err != nil {
+			return loaded, &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+		loaded++
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return loaded, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return loaded, nil
+}
+
+// Schema implements database.Introspector for the current schema.
+func (p *Postgres) Schema() ([]database.SchemaObject, error) {
+	query := `SELECT table_name, column_name, concat_ws(' ', data_type, CASE WHEN is_nullable = 'NO' THEN 'NOT NULL' END, 'DEFAULT ' || column_default)
+		FROM information_schema.columns WHERE table_schema = current_schema() AND table_name <> $1`
+	columns, err := database.QuerySchema(p.conn, "column", query, p.config.MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	query = `SELECT tablename, indexname, indexdef FROM pg_indexes WHERE schemaname = current_schema() AND tablename <> $1`
+	indexes, err := database.QuerySchema(p.conn, "index", query, p.config.MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	return append(columns, indexes...), nil
+}
+
+// DumpSchema implements database.Dumper for the current schema, from the
+// system catalogs. Foreign keys are added last, after all tables exist.
+func (p *Postgres) DumpSchema(w io.Writer, exclude []string) error {
+	skip := map[string]bool{p.config.MigrationsTable: true}
+	for _, t := range exclude {
+		skip[t] = true
+	}
+
+	// sequences of identity columns are created by the columns
+	query := `SELECT format('CREATE SEQUENCE %I AS %s INCREMENT BY %s MINVALUE %s MAXVALUE %s START WITH %s%s',
+		s.sequencename, s.data_type, s.increment_by, s.min_value, s.max_value, s.start_value,
+		CASE WHEN s.cycle THEN ' CYCLE' ELSE '' END) AS def
+		FROM pg_sequences s WHERE s.schemaname = current_schema() AND NOT EXISTS (SELECT 1 FROM pg_depend d
+		WHERE d.objid = format('%I.%I', s.schemaname, s.sequencename)::regclass AND d.deptype = 'i')
+		ORDER BY s.sequencename`
+	sequences, err := database.QueryRows(p.conn, query)
+	if err != nil {
+		return err
+	}
+	stmts := make([]string, 0)
+	for _, s := range sequences {
+		stmts = append(stmts, s["def"].(string))
+	}
+
+	query = `SELECT c.relname AS table, a.attname AS column, format_type(a.atttypid, a.atttypmod) AS type,
+		a.attnotnull AS not_null, pg_get_expr(d.adbin, d.adrelid) AS default, a.attidentity AS identity
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		LEFT JOIN pg_attrdef d ON d.adrelid = c.oid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p')
+		ORDER BY c.relname, a.attnum`
+	columns, err := database.QueryRows(p.conn, query)
+	if err != nil {
+		return err
+	}
+	var table string
+	var defs []string
+	flush := func() {
+		if table != "" && !skip[table] {
+			stmts = append(stmts, "CREATE TABLE "+pq.QuoteIdentifier(table)+" (\n    "+strings.Join(defs, ",\n    ")+"\n)")
+		}
+	}
+	for _, c := range columns {
+		if t := c["table"].(string); t != table {
+			flush()
+			table, defs = t, nil
+		}
+		def := pq.QuoteIdentifier(c["column"].(string)) + " " + c["type"].(string)
+		if c["not_null"].(bool) {
+			def += " NOT NULL"
+		}
+		if d, ok := c["default"].(string); ok {
+			def += " DEFAULT " + d
+		}
+		switch c["identity"] {
+		case "a":
+			def += " GENERATED ALWAYS AS IDENTITY"
+		case "d":
+			def += " GENERATED BY DEFAULT AS IDENTITY"
+		}
+		defs = append(defs, def)
+	}
+	flush()
+
+	// NOT NULL constraints, contype n since PostgreSQL 18, are part of the columns
+	query = `SELECT c.relname AS table, con.conname AS name, pg_get_constraintdef(con.oid) AS def
+		FROM pg_constraint con JOIN pg_class c ON c.oid = con.conrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND con.contype <> 'n'
+		ORDER BY con.contype = 'f', c.relname, con.conname`
+	constraints, err := database.QueryRows(p.conn, query)
+	if err != nil {
+		return err
+	}
+	for _, c := range constraints {
+		if t := c["table"].(string); !skip[t] {
+			stmts = append(stmts, "ALTER TABLE "+pq.QuoteIdentifier(t)+" ADD CONSTRAINT "+
+				pq.QuoteIdentifier(c["name"].(string))+" "+c["def"].(string))
+		}
+	}
+
+	// indexes of constraints are created by the constraints
+	query = `SELECT c.relname AS table, pg_get_indexdef(i.indexrelid) AS def
+		FROM pg_index i JOIN pg_class c ON c.oid = i.indrelid JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid)
+		ORDER BY c.relname, ic.relname`
+	indexes, err := database.QueryRows(p.conn, query)
+	if err != nil {
+		return err
+	}
+	for _, i := range indexes {
+		if !skip[i["table"].(string)] {
+			stmts = append(stmts, i["def"].(string))
+		}
+	}
+
+	query = `SELECT viewname AS name, definition AS def FROM pg_views WHERE schemaname = current_schema() ORDER BY viewname`
+	views, err := database.QueryRows(p.conn, query)
+	if err != nil {
+		return err
+	}
+	for _, v := range views {
+		stmts = append(stmts, "CREATE VIEW "+pq.QuoteIdentifier(v["name"].(string))+" AS\n"+v["def"].(string))
+	}
+	return database.WriteStatements(w, stmts)
+}
+
+// queryer returns the transaction in progress, or the connection
+func (p *Postgres) queryer() database.SQLQueryer {
+	if p.tx != nil {
+		return p.tx
+	}
+	return p.conn
+}
+
 func (p *Postgres) SetVersion(version int, dirty bool) error {
+	if p.tx != nil {
+		return p.setVersion(p.tx, version, dirty)
+	}
+
 	tx, err := p.conn.BeginTx(context.Background(), &sql.TxOptions{})
 	if err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction start failed"}
 	}
 
-	query := `TRUNCATE ` + pq.QuoteIdentifier(p.config.MigrationsTable)
-	if _, err := tx.Exec(query); err != nil {
+	if err := p.setVersion(tx, version, dirty); err != nil {
 		if errRollback := tx.Rollback(); errRollback != nil {
-			err = multierror.Append(err, errRollback)
+			return multierror.Append(err, errRollback)
 		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+
+	return nil
+}
+
+func (p *Postgres) setVersion(tx *sql.Tx, version int, dirty bool) error {
+	if p.config.VersionTable != nil {
+		return p.config.VersionTable.SetVersion(tx, pq.QuoteIdentifier(p.config.MigrationsTable), version, dirty)
+	}
+
+	query := `TRUNCATE ` + pq.QuoteIdentifier(p.config.MigrationsTable)
+	if _, err := tx.Exec(query); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
 	}
 
 	if version >= 0 {
 		query = `INSERT INTO ` + pq.QuoteIdentifier(p.config.MigrationsTable) + ` (version, dirty) VALUES ($1, $2)`
 		if _, err := tx.Exec(query, version, dirty); err != nil {
-			if errRollback := tx.Rollback(); errRollback != nil {
-				err = multierror.Append(err, errRollback)
-			}
 			return &database.Error{OrigErr: err, Query: []byte(query)}
 		}
 	}
 
+	return nil
+}
+
+// Begin implements database.Transactional.
+func (p *Postgres) Begin() error {
+	if p.tx != nil {
+		return database.ErrInTx
+	}
+	tx, err := p.conn.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	p.tx = tx
+	return nil
+}
+
+// Commit implements database.Transactional.
+func (p *Postgres) Commit() error {
+	if p.tx == nil {
+		return database.ErrNotInTx
+	}
+	tx := p.tx
+	p.tx = nil
 	if err := tx.Commit(); err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
 	}
+	return nil
+}
 
+// Rollback implements database.Transactional.
+func (p *Postgres) Rollback() error {
+	if p.tx == nil {
+		return database.ErrNotInTx
+	}
+	tx := p.tx
+	p.tx = nil
+	if err := tx.Rollback(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction rollback failed"}
+	}
 	return nil
 }
 
+// execer returns the transaction started with Begin, if any,
+// and the connection otherwise.
+func (p *Postgres) execer() execer {
+	if p.tx != nil {
+		return p.tx
+	}
+	return p.conn
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
 func (p *Postgres) Version() (version int, dirty bool, err error) {
+	if p.config.VersionTable != nil {
+		version, dirty, err = p.config.VersionTable.Version(p.conn, pq.QuoteIdentifier(p.config.MigrationsTable))
+		if e, ok := err.(*database.Error); ok {
+			if pe, ok := e.OrigErr.(*pq.Error); ok && pe.Code.Name() == "undefined_table" {
+				return database.NilVersion, false, nil
+			}
+		}
+		return version, dirty, err
+	}
+
 	query := `SELECT version, dirty FROM ` + pq.QuoteIdentifier(p.config.MigrationsTable) + ` LIMIT 1`
 	err = p.conn.QueryRowContext(context.Background(), query).Scan(&version, &dirty)
 	switch {
@@ -373,6 +1085,10 @@ func (p *Postgres) ensureVersionTable() (err error) {
 		}
 	}()
 
+	if p.config.VersionTable != nil {
+		return p.config.VersionTable.Create(p.conn, pq.QuoteIdentifier(p.config.MigrationsTable), "SERIAL NOT NULL PRIMARY KEY")
+	}
+
 	query := `CREATE TABLE IF NOT EXISTS ` + pq.QuoteIdentifier(p.config.MigrationsTable) + ` (version bigint not null primary key, dirty boolean not null)`
 	if _, err = p.conn.ExecContext(context.Background(), query); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
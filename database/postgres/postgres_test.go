@@ -11,13 +11,20 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"io"
+	"io/ioutil"
+	"net"
+	nurl "net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/dhui/dktest"
 
+	"github.com/golang-migrate/migrate/v4/database"
 	dt "github.com/golang-migrate/migrate/v4/database/testing"
 	"github.com/golang-migrate/migrate/v4/dktesting"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -121,6 +128,26 @@ func TestMigrate(t *testing.T) {
 	})
 }
 
+func TestWithSQLInstance(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("postgres", pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		dt.TestWithSQLInstance(t, "postgres", db)
+	})
+}
+
 func TestMultiStatement(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -154,6 +181,254 @@ func TestMultiStatement(t *testing.T) {
 	})
 }
 
+func TestStatementTimeout(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port) + "&x-statement-timeout=100ms"
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		if err := d.Run(strings.NewReader("SELECT pg_sleep(1)")); err == nil {
+			t.Fatal("expected statement timeout error")
+		}
+		if err := d.Run(strings.NewReader("-- migrate:statement-timeout 5s\nSELECT pg_sleep(1)")); err != nil {
+			t.Fatal(err)
+		}
+
+		// the session timeout is restored after the migration
+		var timeout string
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SHOW statement_timeout").Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if timeout != "100ms" {
+			t.Fatalf("expected statement_timeout 100ms, got %v", timeout)
+		}
+
+		// without x-statement-timeout, the default of the server is restored
+		d2, err := p.Open(pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d2.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		if err := d2.Run(strings.NewReader("-- migrate:statement-timeout 5s\nSELECT 1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := d2.(*Postgres).conn.QueryRowContext(context.Background(), "SHOW statement_timeout").Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if timeout != "0" {
+			t.Fatalf("expected default statement_timeout 0, got %v", timeout)
+		}
+	})
+}
+
+func TestCreateIndexConcurrently(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port)
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		// the duplicates fail the build, which leaves an invalid index
+		migr := "CREATE TABLE users (email text); INSERT INTO users VALUES ('a'), ('a');\n" +
+			"CREATE UNIQUE INDEX CONCURRENTLY users_email ON users (email);"
+		if err := d.Run(strings.NewReader(migr)); err == nil {
+			t.Fatal("expected unique violation error")
+		}
+		valid, err := d.(*Postgres).indexValid(context.Background(), "users_email")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if valid {
+			t.Fatal("expected invalid index")
+		}
+
+		// the invalid index is dropped and built again
+		migr = "DELETE FROM users; CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS users_email ON users (email);"
+		if err := d.Run(strings.NewReader(migr)); err != nil {
+			t.Fatal(err)
+		}
+		if valid, err = d.(*Postgres).indexValid(context.Background(), "users_email"); err != nil {
+			t.Fatal(err)
+		}
+		if !valid {
+			t.Fatal("expected valid index")
+		}
+	})
+}
+
+func TestDDLLockTimeout(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port) + "&x-ddl-lock-timeout=100ms&x-ddl-retries=3&x-ddl-retry-backoff=200ms"
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		if err := d.Run(strings.NewReader("CREATE TABLE foo (foo text)")); err != nil {
+			t.Fatal(err)
+		}
+
+		// another session holds a lock on foo for a while
+		db, err := sql.Open("postgres", pgConnectionString(ip, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec("LOCK TABLE foo"); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			_ = tx.Rollback()
+		}()
+
+		if err := d.Run(strings.NewReader("ALTER TABLE foo ADD COLUMN bar text")); err != nil {
+			t.Fatalf("expected the retries to get the lock, got %v", err)
+		}
+
+		// lock_timeout is reset after the migration
+		var timeout string
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SHOW lock_timeout").Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if timeout != "0" {
+			t.Fatalf("expected lock_timeout 0, got %v", timeout)
+		}
+	})
+}
+
+func TestStreamThreshold(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port) + "&x-stream-threshold=64"
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		var migr strings.Builder
+		migr.WriteString("CREATE TABLE foo (id int, name text);\n")
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&migr, "INSERT INTO foo VALUES (%v, 'row;%v');\n", i, i)
+		}
+		if err := d.Run(strings.NewReader(migr.String())); err != nil {
+			t.Fatal(err)
+		}
+
+		// a failed statement rolls back the whole migration
+		if err := d.Run(strings.NewReader("DELETE FROM foo;\n" + strings.Repeat("-- padding\n", 10) + "INSERT INTO missing VALUES (1);")); err == nil {
+			t.Fatal("expected an error")
+		}
+		var count int
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SELECT count(*) FROM foo").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 100 {
+			t.Fatalf("expected 100 rows, got %v", count)
+		}
+	})
+}
+
+func TestSavepoints(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr := pgConnectionString(ip, port) + "&x-savepoints=resume"
+		p := &Postgres{}
+		d, err := p.Open(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		migr := "CREATE TABLE foo (id int);\nINSERT INTO foo VALUES (1);\n\nINSERT INTO missing VALUES (1);"
+		err = d.Run(strings.NewReader(migr))
+		e, ok := err.(database.Error)
+		if !ok || e.Line != 4 || !strings.Contains(e.Err, "in statement 3 of 3") {
+			t.Fatalf("expected statement 3 in line 4 to fail, got %v", err)
+		}
+		var count int
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SELECT count(*) FROM foo").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("expected the statements before the failure to be committed, got %v rows", count)
+		}
+
+		// the committed statements are skipped
+		migr = strings.Replace(migr, "missing", "foo", 1)
+		if err := d.Run(strings.NewReader(migr)); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.(*Postgres).conn.QueryRowContext(context.Background(), "SELECT count(*) FROM foo").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 {
+			t.Fatalf("expected 2 rows, got %v", count)
+		}
+	})
+}
+
 func TestErrorParsing(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -205,6 +480,98 @@ func TestFilterCustomQuery(t *testing.T) {
 	})
 }
 
+func TestParseURL(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"postgres://user@localhost:5432/db?sslmode=disable", "postgres://user@localhost:5432/db?sslmode=disable"},
+		{"postgres://user@/db?host=/var/run/postgresql", "postgres://user@/db?host=/var/run/postgresql"},
+		{"postgres://user:pw@%2Fvar%2Frun%2Fpostgresql/db", "postgres://user:pw@/db?host=%2Fvar%2Frun%2Fpostgresql"},
+		{"postgres://%2Ftmp:5433/db?sslmode=disable", "postgres:///db?host=%2Ftmp&port=5433&sslmode=disable"},
+		{"postgres://user@%2Fcloudsql%2Fproject%3Aregion%3Ainstance/db", "postgres://user@/db?host=%2Fcloudsql%2Fproject%3Aregion%3Ainstance"},
+	}
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			u, err := ParseURL(c.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.String() != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, u)
+			}
+		})
+	}
+
+	if _, err := ParseURL("postgres://user@%zz/db"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "postgres-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, ".s.PGSQL.5433"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+		close(accepted)
+	}()
+
+	// the fake server hangs up, so only the dialed socket matters
+	url := "postgres://user@" + nurl.PathEscape(dir) + ":5433/db"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := (&Postgres{}).Ping(ctx, url); err == nil {
+		t.Fatal("expected error from the fake server")
+	}
+	select {
+	case <-accepted:
+	case <-ctx.Done():
+		t.Fatal("expected a connection on the unix socket")
+	}
+}
+
+func TestPqURL(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"postgres://host/db?x-migrations-table=m", "postgres://host/db"},
+		{"postgres://host/db?x-tls-ca=ca.pem", "postgres://host/db?sslmode=verify-full&sslrootcert=ca.pem"},
+		{"postgres://host/db?sslmode=verify-ca&x-tls-ca=ca.pem", "postgres://host/db?sslmode=verify-ca&sslrootcert=ca.pem"},
+		{"postgres://host/db?x-tls-ca=ca.pem&x-tls-insecure-skip-verify=true", "postgres://host/db?sslmode=require"},
+		{"postgres://host/db?x-tls-cert=c.pem&x-tls-key=c.key", "postgres://host/db?sslcert=c.pem&sslkey=c.key"},
+	}
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			purl, err := nurl.Parse(c.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := pqURL(purl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.String() != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, u)
+			}
+		})
+	}
+}
+
 func TestWithSchema(t *testing.T) {
 	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
 		ip, port, err := c.FirstPort()
@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// Modes of Config.Savepoints.
+const (
+	// SavepointsReport runs the statements of a migration one by one in a
+	// transaction, each after a savepoint, so that a failure names the
+	// failed statement and its line. The transaction is rolled back as a
+	// whole, as without savepoints.
+	SavepointsReport = "report"
+
+	// SavepointsResume is like SavepointsReport, but a failure only rolls
+	// back to the savepoint before the failed statement and commits the
+	// statements before it, recording them in the progress table. Once the
+	// version is forced to the one before the migration, running it again
+	// skips them, if they are unchanged.
+	SavepointsResume = "resume"
+)
+
+// progressTable returns the table recording the statements committed by
+// SavepointsResume.
+func (p *Postgres) progressTable() string {
+	return pq.QuoteIdentifier(p.config.MigrationsTable + "_progress")
+}
+
+// runSavepoints runs the statements of migr with a savepoint before each,
+// see Config.Savepoints. Within a transaction started with Begin, a failure
+// can't be resumed, as the statements before it can't be committed.
+func (p *Postgres) runSavepoints(ctx context.Context, migr []byte) error {
+	stmts := multistmt.Split(migr, multistmt.Delimiter(migr, multistmt.DefaultDelimiter))
+	resume := p.config.Savepoints == SavepointsResume && p.tx == nil
+	if resume {
+		query := `CREATE TABLE IF NOT EXISTS ` + p.progressTable() + ` (statements integer not null, checksum text not null)`
+		if _, err := p.conn.ExecContext(ctx, query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
+	tx := p.tx
+	if tx == nil {
+		var err error
+		if tx, err = p.conn.BeginTx(ctx, &sql.TxOptions{}); err != nil {
+			return &database.Error{OrigErr: err, Err: "transaction start failed"}
+		}
+	}
+	rollback := func(err error) error {
+		if p.tx != nil {
+			return err
+		}
+		if errRollback := tx.Rollback(); errRollback != nil {
+			return multierror.Append(err, errRollback)
+		}
+		return err
+	}
+
+	skip := 0
+	if resume {
+		var err error
+		if skip, err = p.committedStatements(ctx, tx, stmts); err != nil {
+			return rollback(err)
+		}
+	}
+	for i := skip; i < len(stmts); i++ {
+		savepoint := fmt.Sprintf("migrate_statement_%d", i+1)
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT `+savepoint); err != nil {
+			return rollback(&database.Error{OrigErr: err, Err: "savepoint failed", Query: []byte(`SAVEPOINT ` + savepoint)})
+		}
+		// a statement which ran into DDLLockTimeout is retried from its
+		// savepoint, the transaction is aborted otherwise
+		err := p.retryLocked(func() error {
+			err := p.runStatement(ctx, tx, stmts[i])
+			if err != nil && isLockTimeout(err) {
+				if _, errRollback := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT `+savepoint); errRollback != nil {
+					return multierror.Append(err, errRollback)
+				}
+			}
+			return err
+		})
+		if err == nil {
+			continue
+		}
+		err = statementError(err, migr, stmts, i)
+		if !resume || i == skip {
+			return rollback(err)
+		}
+		if errResume := p.commitProgress(ctx, tx, savepoint, stmts[:i]); errResume != nil {
+			return rollback(multierror.Append(err, errResume))
+		}
+		if e, ok := err.(database.Error); ok {
+			e.Err = fmt.Sprintf("%v, the %v statements before it are committed and skipped when the migration runs again", e.Err, i)
+			return e
+		}
+		return err
+	}
+
+	if resume {
+		query := `DELETE FROM ` + p.progressTable()
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return rollback(&database.Error{OrigErr: err, Query: []byte(query)})
+		}
+	}
+	if p.tx != nil {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+// committedStatements returns how many statements of stmts were committed
+// by an earlier run with SavepointsResume. A record of statements which
+// changed since, e.g. of another migration, is ignored.
+func (p *Postgres) committedStatements(ctx context.Context, tx *sql.Tx, stmts [][]byte) (int, error) {
+	query := `SELECT statements, checksum FROM ` + p.progressTable() + ` LIMIT 1`
+	var n int
+	var checksum string
+	err := tx.QueryRowContext(ctx, query).Scan(&n, &checksum)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	if n > len(stmts) || statementsChecksum(stmts[:n]) != checksum {
+		return 0, nil
+	}
+	return n, nil
+}
+
+// commitProgress rolls back to savepoint, records committed as the
+// statements committed by SavepointsResume and commits tx.
+func (p *Postgres) commitProgress(ctx context.Context, tx *sql.Tx, savepoint string, committed [][]byte) error {
+	queries := []string{`ROLLBACK TO SAVEPOINT ` + savepoint, `DELETE FROM ` + p.progressTable()}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+	query := `INSERT INTO ` + p.progressTable() + ` (statements, checksum) VALUES ($1, $2)`
+	if _, err := tx.ExecContext(ctx, query, len(committed), statementsChecksum(committed)); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+// statementsChecksum returns the SHA-256 checksum of stmts.
+func statementsChecksum(stmts [][]byte) string {
+	h := sha256.New()
+	for _, stmt := range stmts {
+		h.Write(stmt)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// statementError names the statement i of stmts, split from migr, in err,
+// and makes its line relative to migr.
+func statementError(err error, migr []byte, stmts [][]byte, i int) error {
+	e, ok := err.(database.Error)
+	if !ok {
+		return err
+	}
+	// the statements are slices of migr in order
+	offset := 0
+	for j := 0; j <= i; j++ {
+		if k := bytes.Index(migr[offset:], stmts[j]); k >= 0 {
+			offset += k
+		}
+		if j < i {
+			offset += len(stmts[j])
+		}
+	}
+	line := uint(bytes.Count(migr[:offset], []byte("\n")) + 1)
+	if e.Line > 0 {
+		line += e.Line - 1
+	}
+	e.Line = line
+	e.Err = fmt.Sprintf("%v in statement %v of %v", e.Err, i+1, len(stmts))
+	return e
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+)
+
+func TestStatementError(t *testing.T) {
+	migr := []byte("-- users\nCREATE TABLE users (id int);\n\nINSERT INTO users\n  VALUES ('x');\nSELECT 1;")
+	stmts := multistmt.Split(migr, multistmt.DefaultDelimiter)
+
+	err := statementError(database.Error{Err: "migration failed", Query: stmts[1], Line: 2}, migr, stmts, 1)
+	expected := database.Error{Err: "migration failed in statement 2 of 3", Query: stmts[1], Line: 5}
+	if e, ok := err.(database.Error); !ok || e.Err != expected.Err || e.Line != expected.Line {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+
+	// without position, the line of the statement
+	err = statementError(database.Error{Err: "migration failed", Query: stmts[2]}, migr, stmts, 2)
+	if e, ok := err.(database.Error); !ok || e.Line != 6 {
+		t.Errorf("expected line 6, got %v", err)
+	}
+
+	other := errors.New("connection reset")
+	if err := statementError(other, migr, stmts, 0); err != other {
+		t.Errorf("expected %v, got %v", other, err)
+	}
+}
+
+func TestStatementsChecksum(t *testing.T) {
+	stmts := [][]byte{[]byte("CREATE TABLE a (id int)"), []byte("INSERT INTO a VALUES (1)")}
+	if statementsChecksum(stmts) == statementsChecksum([][]byte{[]byte("CREATE TABLE a (id int)INSERT INTO a VALUES (1)")}) {
+		t.Error("expected the checksum to separate statements")
+	}
+	if statementsChecksum(stmts[:1]) != statementsChecksum([][]byte{[]byte("CREATE TABLE a (id int)")}) {
+		t.Error("expected equal statements to have equal checksums")
+	}
+}
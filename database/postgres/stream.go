@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// runStream runs a migration larger than StreamThreshold statement by
+// statement while reading it, see database.ReadMigration. As the
+// statements can't be read again, only migrations with the no-transaction
+// pragma are retried after DDLLockTimeout, one statement at a time, and
+// CONCURRENTLY needs the no-transaction pragma.
+func (p *Postgres) runStream(ctx context.Context, pragmas pragma.Pragmas, statements *multistmt.Scanner) error {
+	if pragmas.Has(pragma.NoTransaction) {
+		if p.tx != nil {
+			return database.ErrNoTransaction
+		}
+		for statements.Scan() {
+			if err := p.runOutsideTransaction(ctx, [][]byte{statements.Statement()}); err != nil {
+				return err
+			}
+		}
+		return statements.Err()
+	}
+	if p.tx != nil {
+		return p.runStatements(ctx, p.tx, statements)
+	}
+
+	tx, err := p.conn.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	if err := p.runStatements(ctx, tx, statements); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			return multierror.Append(err, errRollback)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+func (p *Postgres) runStatements(ctx context.Context, ex execer, statements *multistmt.Scanner) error {
+	for statements.Scan() {
+		if err := p.runStatement(ctx, ex, statements.Statement()); err != nil {
+			return err
+		}
+	}
+	return statements.Err()
+}
@@ -37,6 +37,9 @@ type Ql struct {
 	isLocked bool
 
 	config *Config
+
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
 }
 
 func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
@@ -99,16 +102,36 @@ func (m *Ql) ensureVersionTable() (err error) {
 	return nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (m *Ql) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*Ql).sharedDB = true
+	return d, nil
+}
+
 func (m *Ql) Open(url string) (database.Driver, error) {
 	purl, err := nurl.Parse(url)
 	if err != nil {
 		return nil, err
 	}
+	params, err := database.ParseConnParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	if params.HasTimeouts() {
+		return nil, database.ErrTimeoutUnsupported
+	}
+
 	dbfile := strings.Replace(migrate.FilterCustomQuery(purl).String(), "ql://", "", 1)
 	db, err := sql.Open("ql", dbfile)
 	if err != nil {
 		return nil, err
 	}
+	params.Apply(db)
 	migrationsTable := purl.Query().Get("x-migrations-table")
 	if len(migrationsTable) == 0 {
 		migrationsTable = DefaultMigrationsTable
@@ -123,6 +146,9 @@ func (m *Ql) Open(url string) (database.Driver, error) {
 	return mx, nil
 }
 func (m *Ql) Close() error {
+	if m.sharedDB {
+		return nil
+	}
 	return m.db.Close()
 }
 func (m *Ql) Drop() (err error) {
@@ -79,3 +79,26 @@ func TestMigrate(t *testing.T) {
 	}
 	dt.TestMigrate(t, m)
 }
+
+func TestWithSQLInstance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ql-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	db, err := sql.Open("ql", filepath.Join(dir, "ql.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	dt.TestWithSQLInstance(t, "ql", db)
+}
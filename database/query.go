@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Row maps the column names of a row to its values.
+type Row map[string]interface{}
+
+// Querier is an optional interface a driver can implement to run queries with
+// arguments and return their rows, e.g. for scripted migrations. Placeholders
+// of arguments are those of the database, e.g. $1 or ?.
+type Querier interface {
+	// Query returns all rows of query.
+	Query(query string, args ...interface{}) ([]Row, error)
+
+	// Exec runs a statement and returns the number of affected rows.
+	Exec(query string, args ...interface{}) (int64, error)
+}
+
+// SQLQueryer is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type SQLQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// QueryRows implements Querier.Query for database/sql based drivers.
+// []byte values are returned as strings.
+func QueryRows(q SQLQueryer, query string, args ...interface{}) ([]Row, error) {
+	rows, err := q.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, &Error{OrigErr: err, Query: []byte(query)}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Row, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(Row, len(columns))
+		for i, c := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[c] = string(b)
+			} else {
+				row[c] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &Error{OrigErr: err, Query: []byte(query)}
+	}
+	return result, nil
+}
+
+// ExecRows implements Querier.Exec for database/sql based drivers.
+func ExecRows(q SQLQueryer, query string, args ...interface{}) (int64, error) {
+	result, err := q.ExecContext(context.Background(), query, args...)
+	if err != nil {
+		return 0, &Error{OrigErr: err, Query: []byte(query)}
+	}
+	return result.RowsAffected()
+}
@@ -8,12 +8,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	nurl "net/url"
 	"strconv"
 	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/hashicorp/go-multierror"
 	"github.com/lib/pq"
 )
@@ -42,6 +42,9 @@ type Redshift struct {
 
 	// Open and WithInstance need to guarantee that config is never nil
 	config *Config
+
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
 }
 
 func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
@@ -90,14 +93,29 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	return px, nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (p *Redshift) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*Redshift).sharedDB = true
+	return d, nil
+}
+
 func (p *Redshift) Open(url string) (database.Driver, error) {
-	purl, err := nurl.Parse(url)
+	purl, err := postgres.ParseURL(url)
 	if err != nil {
 		return nil, err
 	}
 	purl.Scheme = "postgres"
 
-	db, err := sql.Open("postgres", migrate.FilterCustomQuery(purl).String())
+	params, err := database.ParseConnParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	db, err := postgres.OpenDB(migrate.FilterCustomQuery(purl), params)
 	if err != nil {
 		return nil, err
 	}
@@ -117,6 +135,9 @@ func (p *Redshift) Open(url string) (database.Driver, error) {
 
 func (p *Redshift) Close() error {
 	connErr := p.conn.Close()
+	if p.sharedDB {
+		return connErr
+	}
 	dbErr := p.db.Close()
 	if connErr != nil || dbErr != nil {
 		return fmt.Errorf("conn: %v, db: %v", connErr, dbErr)
@@ -16,6 +16,7 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
 
 	"github.com/hashicorp/go-multierror"
 	"google.golang.org/api/iterator"
@@ -303,16 +304,11 @@ func (s *Spanner) ensureVersionTable() (err error) {
 }
 
 func migrationStatements(migration []byte) []string {
-	migrationString := string(migration[:])
-	migrationString = strings.TrimSpace(migrationString)
-
-	allStatements := strings.Split(migrationString, ";")
-	nonEmptyStatements := allStatements[:0]
-	for _, s := range allStatements {
-		s = strings.TrimSpace(s)
-		if s != "" {
-			nonEmptyStatements = append(nonEmptyStatements, s)
-		}
+	delimiter := multistmt.Delimiter(migration, multistmt.DefaultDelimiter)
+	stmts := multistmt.Split(migration, delimiter)
+	nonEmptyStatements := make([]string, 0, len(stmts))
+	for _, s := range stmts {
+		nonEmptyStatements = append(nonEmptyStatements, string(s))
 	}
 	return nonEmptyStatements
 }
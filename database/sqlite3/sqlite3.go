@@ -4,12 +4,13 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
-	"io/ioutil"
 	nurl "net/url"
 	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
 	"github.com/hashicorp/go-multierror"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -28,12 +29,30 @@ var (
 type Config struct {
 	MigrationsTable string
 	DatabaseName    string
+
+	// ReadOnly opens the driver read-only, see database.ReadOnlyDriver.
+	ReadOnly bool
+
+	// VersionTable, if set, replaces the layout of the version table,
+	// see database.VersionTable.
+	VersionTable *database.VersionTable
+
+	// StreamThreshold is the size of migrations in bytes above which they
+	// run statement by statement while they are read, rather than being
+	// read into memory, see database.ReadMigration.
+	StreamThreshold int64
 }
 
 type Sqlite struct {
 	db       *sql.DB
 	isLocked bool
 
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
+
+	// tx is set while a transaction started with Begin is in progress
+	tx *sql.Tx
+
 	config *Config
 }
 
@@ -47,13 +66,16 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	}
 
 	if len(config.MigrationsTable) == 0 {
-		config.MigrationsTable = DefaultMigrationsTable
+		config.MigrationsTable = config.VersionTable.DefaultTable(DefaultMigrationsTable)
 	}
 
 	mx := &Sqlite{
 		db:     instance,
 		config: config,
 	}
+	if config.ReadOnly {
+		return mx, nil
+	}
 	if err := mx.ensureVersionTable(); err != nil {
 		return nil, err
 	}
@@ -78,6 +100,10 @@ func (m *Sqlite) ensureVersionTable() (err error) {
 		}
 	}()
 
+	if m.config.VersionTable != nil {
+		return m.config.VersionTable.Create(m.db, m.config.MigrationsTable, "INTEGER PRIMARY KEY AUTOINCREMENT")
+	}
+
 	query := fmt.Sprintf(`
 	CREATE TABLE IF NOT EXISTS %s (version uint64,dirty bool);
   CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON %s (version);
@@ -89,24 +115,69 @@ func (m *Sqlite) ensureVersionTable() (err error) {
 	return nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (m *Sqlite) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*Sqlite).sharedDB = true
+	return d, nil
+}
+
 func (m *Sqlite) Open(url string) (database.Driver, error) {
 	purl, err := nurl.Parse(url)
 	if err != nil {
 		return nil, err
 	}
-	dbfile := strings.Replace(migrate.FilterCustomQuery(purl).String(), "sqlite3://", "", 1)
+	params, err := database.ParseConnParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	if params.HasTimeouts() {
+		return nil, database.ErrTimeoutUnsupported
+	}
+
+	readOnly, err := database.ParseReadOnly(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	versionTable, err := database.ParseVersionTable(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	streamThreshold, err := database.ParseStreamThreshold(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	dbURL := migrate.FilterCustomQuery(purl)
+	dbfile := strings.Replace(dbURL.String(), "sqlite3://", "", 1)
+	if readOnly {
+		// mode=ro needs a URI filename, it doesn't create a missing file
+		q := dbURL.Query()
+		q.Set("mode", "ro")
+		q.Set("_query_only", "true")
+		dbURL.RawQuery = q.Encode()
+		dbfile = strings.Replace(dbURL.String(), "sqlite3://", "file:", 1)
+	}
 	db, err := sql.Open("sqlite3", dbfile)
 	if err != nil {
 		return nil, err
 	}
+	params.Apply(db)
 
 	migrationsTable := purl.Query().Get("x-migrations-table")
 	if len(migrationsTable) == 0 {
-		migrationsTable = DefaultMigrationsTable
+		migrationsTable = versionTable.DefaultTable(DefaultMigrationsTable)
 	}
 	mx, err := WithInstance(db, &Config{
 		DatabaseName:    purl.Path,
 		MigrationsTable: migrationsTable,
+		ReadOnly:        readOnly,
+		VersionTable:    versionTable,
+		StreamThreshold: streamThreshold,
 	})
 	if err != nil {
 		return nil, err
@@ -115,6 +186,9 @@ func (m *Sqlite) Open(url string) (database.Driver, error) {
 }
 
 func (m *Sqlite) Close() error {
+	if m.sharedDB {
+		return nil
+	}
 	return m.db.Close()
 }
 
@@ -158,6 +232,9 @@ func (m *Sqlite) Drop() (err error) {
 }
 
 func (m *Sqlite) Lock() error {
+	if m.config.ReadOnly {
+		return database.ErrReadOnly
+	}
 	if m.isLocked {
 		return database.ErrLocked
 	}
@@ -165,6 +242,11 @@ func (m *Sqlite) Lock() error {
 	return nil
 }
 
+// ReadOnly implements database.ReadOnlyDriver.
+func (m *Sqlite) ReadOnly() bool {
+	return m.config.ReadOnly
+}
+
 func (m *Sqlite) Unlock() error {
 	if !m.isLocked {
 		return nil
@@ -174,16 +256,77 @@ func (m *Sqlite) Unlock() error {
 }
 
 func (m *Sqlite) Run(migration io.Reader) error {
-	migr, err := ioutil.ReadAll(migration)
+	migr, stream, err := database.ReadMigration(migration, m.config.StreamThreshold)
 	if err != nil {
 		return err
 	}
+	if stream != nil {
+		return m.runStream(migr, stream)
+	}
 	query := string(migr[:])
 
+	if pragma.Parse(migr).Has(pragma.NoTransaction) {
+		if m.tx != nil {
+			return database.ErrNoTransaction
+		}
+		if _, err := m.db.Exec(query); err != nil {
+			return &database.Error{OrigErr: err, Query: migr}
+		}
+		return nil
+	}
+
 	return m.executeQuery(query)
 }
 
+// runStream runs a migration larger than StreamThreshold statement by
+// statement while reading it from stream. head holds its pragmas.
+func (m *Sqlite) runStream(head []byte, stream io.Reader) error {
+	statements := multistmt.NewScanner(stream, multistmt.Delimiter(head, multistmt.DefaultDelimiter))
+	if pragma.Parse(head).Has(pragma.NoTransaction) {
+		if m.tx != nil {
+			return database.ErrNoTransaction
+		}
+		return runStatements(m.db, statements)
+	}
+	if m.tx != nil {
+		return runStatements(m.tx, statements)
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	if err := runStatements(tx, statements); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			err = multierror.Append(err, errRollback)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+func runStatements(ex interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, statements *multistmt.Scanner) error {
+	for statements.Scan() {
+		if _, err := ex.Exec(string(statements.Statement())); err != nil {
+			return &database.Error{OrigErr: err, Query: statements.Statement()}
+		}
+	}
+	return statements.Err()
+}
+
 func (m *Sqlite) executeQuery(query string) error {
+	if m.tx != nil {
+		if _, err := m.tx.Exec(query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+		return nil
+	}
+
 	tx, err := m.db.Begin()
 	if err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction start failed"}
@@ -201,11 +344,34 @@ func (m *Sqlite) executeQuery(query string) error {
 }
 
 func (m *Sqlite) SetVersion(version int, dirty bool) error {
+	if m.tx != nil {
+		return m.setVersion(m.tx, version, dirty)
+	}
+
 	tx, err := m.db.Begin()
 	if err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction start failed"}
 	}
 
+	if err := m.setVersion(tx, version, dirty); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			return multierror.Append(err, errRollback)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+
+	return nil
+}
+
+func (m *Sqlite) setVersion(tx *sql.Tx, version int, dirty bool) error {
+	if m.config.VersionTable != nil {
+		return m.config.VersionTable.SetVersion(tx, m.config.MigrationsTable, version, dirty)
+	}
+
 	query := "DELETE FROM " + m.config.MigrationsTable
 	if _, err := tx.Exec(query); err != nil {
 		return &database.Error{OrigErr: err, Query: []byte(query)}
@@ -214,21 +380,146 @@ func (m *Sqlite) SetVersion(version int, dirty bool) error {
 	if version >= 0 {
 		query := fmt.Sprintf(`INSERT INTO %s (version, dirty) VALUES (?, ?)`, m.config.MigrationsTable)
 		if _, err := tx.Exec(query, version, dirty); err != nil {
-			if errRollback := tx.Rollback(); errRollback != nil {
-				err = multierror.Append(err, errRollback)
-			}
 			return &database.Error{OrigErr: err, Query: []byte(query)}
 		}
 	}
 
+	return nil
+}
+
+// Query implements database.Querier.
+func (m *Sqlite) Query(query string, args ...interface{}) ([]database.Row, error) {
+	return database.QueryRows(m.queryer(), query, args...)
+}
+
+// Schema implements database.Introspector.
+func (m *Sqlite) Schema() ([]database.SchemaObject, error) {
+	query := `SELECT t.name, c.name, c.type || CASE WHEN c."notnull" THEN ' NOT NULL' ELSE '' END || COALESCE(' DEFAULT ' || c.dflt_value, '')
+		FROM sqlite_master t, pragma_table_info(t.name) c WHERE t.type = 'table' AND t.name NOT LIKE 'sqlite_%' AND t.name <> ?`
+	columns, err := database.QuerySchema(m.queryer(), "column", query, m.config.MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	query = `SELECT tbl_name, name, COALESCE(sql, '') FROM sqlite_master WHERE type = 'index' AND tbl_name <> ?`
+	indexes, err := database.QuerySchema(m.queryer(), "index", query, m.config.MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	return append(columns, indexes...), nil
+}
+
+// DumpSchema implements database.Dumper with the statements stored in
+// sqlite_master.
+func (m *Sqlite) DumpSchema(w io.Writer, exclude []string) error {
+	skip := map[string]bool{m.config.MigrationsTable: true}
+	for _, t := range exclude {
+		skip[t] = true
+	}
+	// tables first, as the other objects refer to them
+	query := `SELECT tbl_name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY type <> 'table', type, name`
+	rows, err := database.QueryRows(m.queryer(), query)
+	if err != nil {
+		return err
+	}
+	stmts := make([]string, 0, len(rows))
+	for _, r := range rows {
+		if !skip[r["tbl_name"].(string)] {
+			stmts = append(stmts, r["sql"].(string))
+		}
+	}
+	return database.WriteStatements(w, stmts)
+}
+
+func (m *Sqlite) Exec(query string, args ...interface{}) (int64, error) {
+	return database.ExecRows(m.queryer(), query, args...)
+}
+
+// CreateTable implements database.TableCreator.
+func (m *Sqlite) CreateTable(table, columns string) error {
+	_, err := m.Exec("CREATE TABLE IF NOT EXISTS " + database.QuoteTable(table, m.QuoteIdentifier) + " (" + columns + ")")
+	return err
+}
+
+// QuoteIdentifier implements database.IdentifierQuoter.
+func (m *Sqlite) QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Load implements database.Loader with batched inserts.
+func (m *Sqlite) Load(table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	if m.tx != nil {
+		return database.InsertRows(m.tx, table, columns, next, m.QuoteIdentifier, database.QuestionMark)
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	loaded, err := database.InsertRows(tx, table, columns, next, m.QuoteIdentifier, database.QuestionMark)
+	if err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			err = multierror.Append(err, errRollback)
+		}
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return loaded, nil
+}
+
+// queryer returns the transaction in progress, or the database
+func (m *Sqlite) queryer() database.SQLQueryer {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.db
+}
+
+// Begin implements database.Transactional.
+func (m *Sqlite) Begin() error {
+	if m.tx != nil {
+		return database.ErrInTx
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	m.tx = tx
+	return nil
+}
+
+// Commit implements database.Transactional.
+func (m *Sqlite) Commit() error {
+	if m.tx == nil {
+		return database.ErrNotInTx
+	}
+	tx := m.tx
+	m.tx = nil
 	if err := tx.Commit(); err != nil {
 		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
 	}
+	return nil
+}
 
+// Rollback implements database.Transactional.
+func (m *Sqlite) Rollback() error {
+	if m.tx == nil {
+		return database.ErrNotInTx
+	}
+	tx := m.tx
+	m.tx = nil
+	if err := tx.Rollback(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction rollback failed"}
+	}
 	return nil
 }
 
 func (m *Sqlite) Version() (version int, dirty bool, err error) {
+	if m.config.VersionTable != nil {
+		return m.config.VersionTable.Version(m.db, m.config.MigrationsTable)
+	}
 	query := "SELECT version, dirty FROM " + m.config.MigrationsTable + " LIMIT 1"
 	err = m.db.QueryRow(query).Scan(&version, &dirty)
 	if err != nil {
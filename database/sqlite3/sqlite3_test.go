@@ -3,12 +3,16 @@ package sqlite3
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	dt "github.com/golang-migrate/migrate/v4/database/testing"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/mattn/go-sqlite3"
@@ -116,3 +120,942 @@ func TestMigrationTable(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestNoTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test-no-transaction")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	p := &Sqlite{}
+	d, err := p.Open(fmt.Sprintf("sqlite3://%s", filepath.Join(dir, "sqlite3.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	migr := "-- migrate:no-transaction\nCREATE TABLE t (Qty int, Name string);"
+
+	tx := d.(database.Transactional)
+	if err := tx.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(strings.NewReader(migr)); err != database.ErrNoTransaction {
+		t.Errorf("expected ErrNoTransaction, got %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Run(strings.NewReader(migr)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamThreshold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test-stream-threshold")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	p := &Sqlite{}
+	d, err := p.Open(fmt.Sprintf("sqlite3://%s?x-stream-threshold=64", filepath.Join(dir, "sqlite3.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var migr strings.Builder
+	migr.WriteString("CREATE TABLE t (id int, name text);\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&migr, "INSERT INTO t VALUES (%v, 'row;%v');\n", i, i)
+	}
+	if err := d.Run(strings.NewReader(migr.String())); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := d.(*Sqlite).db.QueryRow("SELECT count(*) FROM t WHERE name LIKE 'row;%'").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 100 {
+		t.Fatalf("expected 100 rows, got %v", count)
+	}
+
+	// a failed statement rolls back the whole migration
+	if err := d.Run(strings.NewReader("DELETE FROM t;\n" + strings.Repeat("-- padding\n", 10) + "INSERT INTO missing VALUES (1);")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := d.(*Sqlite).db.QueryRow("SELECT count(*) FROM t").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 100 {
+		t.Fatalf("expected the migration to be rolled back, got %v rows", count)
+	}
+}
+
+func TestTableLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	addr := fmt.Sprintf("sqlite3://%s", filepath.Join(dir, "sqlite3.db"))
+	p := &Sqlite{}
+	d1, err := p.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d1.Close()
+	d2, err := p.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+
+	l1, err := database.NewLocker(database.LockTable, d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := database.NewLocker(database.LockTable, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Lock(); err == nil {
+		t.Fatal("expected lock to be held")
+	}
+	if err := l1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	// must not release the lock of l2
+	if err := l1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Lock(); err == nil {
+		t.Fatal("expected lock to be held")
+	}
+
+	// waits for the lock and gives up after the timeout
+	l1.(*database.TableLock).Timeout = 300 * time.Millisecond
+	started := time.Now()
+	if err := l1.Lock(); err != database.ErrLocked {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if waited := time.Since(started); waited < 300*time.Millisecond {
+		t.Errorf("expected to wait for the timeout, waited %v", waited)
+	}
+	released := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		released <- l2.Unlock()
+	}()
+	l1.(*database.TableLock).Timeout = 5 * time.Second
+	if err := l1.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-released; err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lock left behind by l2
+	if err := l1.(database.ForceUnlocker).ForceUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	p := &Sqlite{}
+	d, err := p.Open(fmt.Sprintf("sqlite3://%s", filepath.Join(dir, "sqlite3.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	audit := &database.AuditTable{Driver: d, Table: database.DefaultAuditTable}
+	for _, result := range []string{"ok", "it's broken"} {
+		if err := audit.Record(database.AuditRecord{Command: "up", Result: result, Started: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var count int
+	query := "SELECT COUNT(*) FROM " + database.DefaultAuditTable + " WHERE command = 'up'"
+	if err := d.(*Sqlite).db.QueryRow(query).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 audit rows, got %v", count)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	p := &Sqlite{}
+	d, err := p.Open(fmt.Sprintf("sqlite3://%s", filepath.Join(dir, "sqlite3.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	s := d.(*Sqlite)
+	if _, err := s.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, "the name" TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// batches of 3 rows
+	defer func(rows int) { database.MaxInsertRows = rows }(database.MaxInsertRows)
+	database.MaxInsertRows = 3
+	var id int64
+	next := func() ([]interface{}, error) {
+		if id == 10 {
+			return nil, io.EOF
+		}
+		id++
+		if id == 5 {
+			return []interface{}{id, nil}, nil
+		}
+		return []interface{}{id, fmt.Sprint("name ", id)}, nil
+	}
+	loaded, err := s.Load("t", []string{"id", "the name"}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != 10 {
+		t.Errorf("expected 10 loaded rows, got %v", loaded)
+	}
+	rows, err := s.Query(`SELECT COUNT(*) AS n, COUNT("the name") AS names FROM t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0]["n"] != int64(10) || rows[0]["names"] != int64(9) {
+		t.Errorf("expected 10 rows with 9 names, got %v", rows)
+	}
+
+	// a failing load inserts nothing
+	id = 0
+	if _, err := s.Load("t", []string{"id", "the name"}, next); err == nil {
+		t.Fatal("expected error for duplicate ids")
+	}
+	if rows, err := s.Query("SELECT COUNT(*) AS n FROM t"); err != nil || rows[0]["n"] != int64(10) {
+		t.Errorf("expected 10 rows, got %v, %v", rows, err)
+	}
+}
+
+func TestWithSQLInstance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	dt.TestWithSQLInstance(t, "sqlite3", db)
+}
+
+func TestConnParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	addr := fmt.Sprintf("sqlite3://%s", filepath.Join(dir, "sqlite3.db"))
+
+	p := &Sqlite{}
+	d, err := p.Open(addr + "?x-max-open-conns=1&x-conn-max-lifetime=1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := d.(*Sqlite).db.Stats().MaxOpenConnections; n != 1 {
+		t.Fatalf("expected 1 max open connection, got %v", n)
+	}
+	if err := d.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := p.Open(addr + "?x-read-timeout=30s"); err != database.ErrTimeoutUnsupported {
+		t.Fatalf("expected %v, got %v", database.ErrTimeoutUnsupported, err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	path := filepath.Join(dir, "sqlite3.db")
+	addr := fmt.Sprintf("sqlite3://%s?x-read-only=true", path)
+
+	if _, err := database.Open(addr); err == nil {
+		t.Fatal("expected an error opening a missing database read-only")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the database not to be created, got %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if _, err := db.Exec("CREATE TABLE pets (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := database.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.(database.ReadOnlyDriver).ReadOnly() {
+		t.Error("expected a read-only driver")
+	}
+	if err := d.Lock(); err != database.ErrReadOnly {
+		t.Errorf("expected %v, got %v", database.ErrReadOnly, err)
+	}
+	if err := d.Run(strings.NewReader("INSERT INTO pets (name) VALUES ('rex')")); err == nil {
+		t.Error("expected the read-only session to reject writes")
+	}
+
+	m, err := migrate.NewWithDatabaseInstance("file://./examples/migrations", "sqlite3", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := m.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if _, _, err := m.Version(); err != migrate.ErrNilVersion {
+		t.Errorf("expected %v, got %v", migrate.ErrNilVersion, err)
+	}
+	if err := m.Up(); err != migrate.ErrReadOnly {
+		t.Errorf("expected %v, got %v", migrate.ErrReadOnly, err)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", DefaultMigrationsTable).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("expected the version table not to be created")
+	}
+}
+
+func TestDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	driver, err := WithInstance(db, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://./examples/migrations", "sqlite3", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.FingerprintTable = database.DefaultFingerprintTable
+	m.AuditTable = database.DefaultAuditTable
+
+	if _, err := m.Drift(); err == nil {
+		t.Fatal("expected an error without stored fingerprint")
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	drift, err := m.Drift()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.Drifted() || drift.Stored.Version != 44 {
+		t.Fatalf("expected no drift at version 44, got %+v", drift)
+	}
+
+	if _, err := db.Exec("CREATE INDEX pets_name ON pets (name)"); err != nil {
+		t.Fatal(err)
+	}
+	if drift, err = m.Drift(); err != nil {
+		t.Fatal(err)
+	}
+	if !drift.Drifted() {
+		t.Error("expected drift after a manual change")
+	}
+}
+
+func TestDumpSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	m, err := migrate.New("file://./examples/migrations", fmt.Sprintf("sqlite3://%s", filepath.Join(dir, "sqlite3.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := m.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	m.AuditTable = database.DefaultAuditTable
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if err := m.DumpSchema(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "-- migrate:snapshot-version 44\n\n" +
+		"CREATE TABLE pets (\n  name string\n, predator bool);\n\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestReset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	driver, err := WithInstance(db, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://./examples/migrations", "sqlite3", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := m.Reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+	if v, _, err := m.Version(); err != nil || v != 44 {
+		t.Fatalf("expected version 44, got %v, %v", v, err)
+	}
+
+	// created by hand, not reverted by any down migration
+	if _, err := db.Exec("CREATE TABLE owners (name string)"); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = m.Reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Problem != migrate.LeftoverObjects || problems[0].Err.Error() != "owners" {
+		t.Errorf("expected owners to be left, got %v", problems)
+	}
+}
+
+func TestTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	m, err := migrate.New("file://./examples/migrations", "sqlite3://"+filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Tag("v1"); err != migrate.ErrNilVersion {
+		t.Fatalf("expected ErrNilVersion, got %v", err)
+	}
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Tag("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Tag("v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Tag("v2"); err != database.ErrTagExists {
+		t.Fatalf("expected ErrTagExists, got %v", err)
+	}
+
+	tags, err := m.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Name != "v1" || tags[0].Version != 33 || tags[1].Name != "v2" || tags[1].Version != 44 {
+		t.Fatalf("unexpected tags %+v", tags)
+	}
+
+	if err := m.RollbackToTag("v3"); err != database.ErrTagNotFound {
+		t.Fatalf("expected ErrTagNotFound, got %v", err)
+	}
+	if err := m.RollbackToTag("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := m.Version(); err != nil || v != 33 {
+		t.Fatalf("expected version 33, got %v, %v", v, err)
+	}
+	if err := m.RollbackToTag("v2"); err != migrate.ErrTagAhead {
+		t.Fatalf("expected ErrTagAhead, got %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	m, err := migrate.New("file://./examples/migrations", "sqlite3://"+filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.HistoryTable = database.DefaultHistoryTable
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		version   uint
+		direction string
+	}{{33, "up"}, {44, "up"}, {44, "down"}}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %v records, got %+v", len(expected), history)
+	}
+	for i, e := range expected {
+		r := history[i]
+		if r.Version != e.version || r.Direction != e.direction || len(r.Checksum) != 64 || r.Applied.IsZero() {
+			t.Errorf("expected version %v %v, got %+v", e.version, e.direction, r)
+		}
+	}
+}
+
+func TestSelectTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	migrations := map[string]string{
+		"1_users.up.sql":    "CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT);",
+		"2_backfill.up.sql": "-- migrate:tags billing,slow\nCREATE TABLE backfilled (id INTEGER);",
+		"3_orders.up.sql":   "-- migrate:tags billing\nCREATE TABLE orders (id INTEGER);",
+	}
+	for name, body := range migrations {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := migrate.New("file://"+dir, "sqlite3://"+filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.HistoryTable = database.DefaultHistoryTable
+	m.SelectTags = "!slow"
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := m.Version(); err != nil || v != 3 {
+		t.Fatalf("expected version 3, got %v, %v", v, err)
+	}
+	d, err := (&Sqlite{}).Open("sqlite3://" + filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	tables := func() []database.Row {
+		rows, err := d.(database.Querier).Query("SELECT name FROM sqlite_master WHERE name IN ('backfilled', 'orders') ORDER BY name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	if rows := tables(); len(rows) != 1 || rows[0]["name"] != "orders" {
+		t.Fatalf("expected only orders created, got %v", rows)
+	}
+	if skipped, err := m.Skipped(); err != nil || len(skipped) != 1 || skipped[0] != 2 {
+		t.Fatalf("expected 2 skipped, got %v, %v", skipped, err)
+	}
+
+	// still not selected
+	if err := m.ApplySkipped(); err != nil {
+		t.Fatal(err)
+	}
+	if rows := tables(); len(rows) != 1 {
+		t.Fatalf("expected backfilled still skipped, got %v", rows)
+	}
+
+	m.SelectTags = ""
+	if err := m.ApplySkipped(); err != nil {
+		t.Fatal(err)
+	}
+	if rows := tables(); len(rows) != 2 {
+		t.Fatalf("expected backfilled created, got %v", rows)
+	}
+	if v, dirty, err := m.Version(); err != nil || v != 3 || dirty {
+		t.Fatalf("expected clean version 3, got %v, %v, %v", v, dirty, err)
+	}
+	if err := m.ApplySkipped(); err != migrate.ErrNoChange {
+		t.Fatalf("expected ErrNoChange, got %v", err)
+	}
+
+	history, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var directions []string
+	for _, r := range history {
+		directions = append(directions, fmt.Sprintf("%v %v", r.Version, r.Direction))
+	}
+	if expected := "1 up, 2 skip, 3 up, 2 up"; strings.Join(directions, ", ") != expected {
+		t.Errorf("expected history %v, got %v", expected, directions)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	migrations := map[string]string{
+		"1_users.up.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, email_lower TEXT);\n" +
+			"WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 10) " +
+			"INSERT INTO users (id, email) SELECT i, 'User' || i || '@Example.com' FROM n;",
+		"2_email_lower.up.sql": "-- migrate:backfill table=users batch=3\nUPDATE users SET email_lower = lower(email) WHERE {batch};",
+	}
+	for name, body := range migrations {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := migrate.New("file://"+dir, "sqlite3://"+filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	d, err := (&Sqlite{}).Open("sqlite3://" + filepath.Join(dir, "sqlite3.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// resume after a previous run completed the batches up to id 6
+	progress := &database.BackfillTable{Driver: d, Table: database.DefaultBackfillTable}
+	if err := progress.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := progress.Save(2, "6"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := d.(*Sqlite).Query("SELECT id FROM users WHERE email_lower = lower(email) ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0]["id"] != int64(7) {
+		t.Errorf("expected ids 7 to 10 backfilled, got %v", rows)
+	}
+	if last, err := progress.Last(2); err != nil || last != "" {
+		t.Errorf("expected the progress to be cleared, got %q, %v", last, err)
+	}
+
+	// a complete run
+	if _, err := d.(*Sqlite).Exec("UPDATE users SET email_lower = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Force(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err = d.(*Sqlite).Query("SELECT id FROM users WHERE email_lower = lower(email)"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 10 {
+		t.Errorf("expected 10 rows backfilled, got %v", len(rows))
+	}
+}
+
+func TestBackfillStopped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	migrations := map[string]string{
+		"1_users.up.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, email_lower TEXT);\n" +
+			"WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 10) " +
+			"INSERT INTO users (id, email) SELECT i, 'User' || i || '@Example.com' FROM n;",
+		"2_email_lower.up.sql": "-- migrate:backfill table=users batch=3\nUPDATE users SET email_lower = lower(email) WHERE {batch};",
+	}
+	for name, body := range migrations {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbURL := "sqlite3://" + filepath.Join(dir, "sqlite3.db")
+	m, err := migrate.New("file://"+dir, dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stops after the first batch
+	m.OnStart = func(migr *migrate.Migration) {
+		if migr.Version == 2 {
+			m.GracefulStop <- true
+		}
+	}
+	if err := m.Up(); err != migrate.ErrBackfillStopped {
+		t.Fatalf("expected ErrBackfillStopped, got %v", err)
+	}
+	if version, dirty, err := m.Version(); err != nil || version != 1 || dirty {
+		t.Errorf("expected version 1 not dirty, got %v, %v, %v", version, dirty, err)
+	}
+
+	// the next run resumes the backfill
+	m, err = migrate.New("file://"+dir, dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := (&Sqlite{}).Open(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	rows, err := d.(*Sqlite).Query("SELECT id FROM users WHERE email_lower = lower(email)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 10 {
+		t.Errorf("expected 10 rows backfilled, got %v", len(rows))
+	}
+	if version, dirty, err := m.Version(); err != nil || version != 2 || dirty {
+		t.Errorf("expected version 2, got %v, %v, %v", version, dirty, err)
+	}
+}
+
+func TestVersionTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite3-driver-test")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	tt := []struct {
+		name  string
+		query string
+		// check selects the version the table holds at version 33
+		check string
+		want  int
+	}{
+		{"custom columns", "x-migrations-table=versions&x-version-column=v&x-dirty-column=d&x-static-columns=service_name=billing",
+			"SELECT v FROM versions WHERE service_name = 'billing' AND d = FALSE", 33},
+		{"flyway", "x-version-layout=flyway",
+			"SELECT MAX(CAST(version AS INTEGER)) FROM flyway_schema_history WHERE success = TRUE", 33},
+		// goose records the rollback of 44
+		{"goose", "x-version-layout=goose",
+			"SELECT version_id FROM goose_db_version WHERE is_applied = FALSE ORDER BY id DESC LIMIT 1", 44},
+	}
+	for i, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("sqlite3-%v.db", i))
+			m, err := migrate.New("file://./examples/migrations", "sqlite3://"+path+"?"+tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			if err := m.Up(); err != nil {
+				t.Fatal(err)
+			}
+			if v, dirty, err := m.Version(); err != nil || v != 44 || dirty {
+				t.Fatalf("expected clean version 44, got %v, %v, %v", v, dirty, err)
+			}
+			if err := m.Steps(-1); err != nil {
+				t.Fatal(err)
+			}
+			if v, dirty, err := m.Version(); err != nil || v != 33 || dirty {
+				t.Fatalf("expected clean version 33, got %v, %v, %v", v, dirty, err)
+			}
+
+			db, err := sql.Open("sqlite3", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var v int
+			if err := db.QueryRow(tc.check).Scan(&v); err != nil || v != tc.want {
+				t.Errorf("expected %v, got %v, %v", tc.want, v, err)
+			}
+
+			if err := m.Down(); err != nil {
+				t.Fatal(err)
+			}
+			if v, _, err := m.Version(); err != migrate.ErrNilVersion {
+				t.Fatalf("expected ErrNilVersion, got %v, %v", v, err)
+			}
+		})
+	}
+}
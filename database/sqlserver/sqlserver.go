@@ -7,10 +7,12 @@ import (
 	"io"
 	"io/ioutil"
 	nurl "net/url"
+	"time"
 
 	mssql "github.com/denisenkom/go-mssqldb" // mssql support
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
 	"github.com/hashicorp/go-multierror"
 )
 
@@ -26,6 +28,7 @@ var (
 	ErrNoDatabaseName = fmt.Errorf("no database name")
 	ErrNoSchema       = fmt.Errorf("no schema")
 	ErrDatabaseDirty  = fmt.Errorf("database is dirty")
+	ErrTLSClientCert  = fmt.Errorf("x-tls-cert and x-tls-key are not supported by sqlserver")
 )
 
 var lockErrorMap = map[mssql.ReturnStatus]string{
@@ -40,6 +43,10 @@ type Config struct {
 	MigrationsTable string
 	DatabaseName    string
 	SchemaName      string
+
+	// StatementTimeout cancels migrations running longer. SQL Server has
+	// no server side limit, the driver asks the server to abort the batch.
+	StatementTimeout time.Duration
 }
 
 // SQL Server connection
@@ -49,6 +56,9 @@ type SQLServer struct {
 	db       *sql.DB
 	isLocked bool
 
+	// sharedDB is set by WithSQLInstance, db is owned by the caller then
+	sharedDB bool
+
 	// Open and WithInstance need to garantuee that config is never nil
 	config *Config
 }
@@ -116,6 +126,17 @@ func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
 	return ss, nil
 }
 
+// WithSQLInstance implements database.SQLInstancer. Closing the
+// returned driver doesn't close instance.
+func (ss *SQLServer) WithSQLInstance(instance *sql.DB) (database.Driver, error) {
+	d, err := WithInstance(instance, &Config{})
+	if err != nil {
+		return nil, err
+	}
+	d.(*SQLServer).sharedDB = true
+	return d, nil
+}
+
 // Open a connection to the database
 func (ss *SQLServer) Open(url string) (database.Driver, error) {
 	purl, err := nurl.Parse(url)
@@ -123,16 +144,49 @@ func (ss *SQLServer) Open(url string) (database.Driver, error) {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlserver", migrate.FilterCustomQuery(purl).String())
+	params, err := database.ParseConnParams(purl.Query())
 	if err != nil {
 		return nil, err
 	}
+	tlsParams, err := database.ParseTLSParams(purl.Query())
+	if err != nil {
+		return nil, err
+	}
+	connURL := migrate.FilterCustomQuery(purl)
+	q := connURL.Query()
+	if tlsParams.IsSet() {
+		if err := setTLSQuery(q, tlsParams); err != nil {
+			return nil, err
+		}
+	}
+	if timeout := database.Seconds(params.ConnectTimeout); timeout != "" {
+		q.Set("dial timeout", timeout)
+	}
+	// go-mssqldb applies its connection timeout to every read and write
+	if timeout := database.Seconds(params.ReadTimeout); timeout != "" {
+		q.Set("connection timeout", timeout)
+	}
+	connURL.RawQuery = q.Encode()
+
+	db, err := sql.Open("sqlserver", connURL.String())
+	if err != nil {
+		return nil, err
+	}
+	params.Apply(db)
 
 	migrationsTable := purl.Query().Get("x-migrations-table")
 
+	var statementTimeout time.Duration
+	if s := purl.Query().Get("x-statement-timeout"); s != "" {
+		if statementTimeout, err = database.ParseTimeout(s); err != nil {
+			return nil, err
+		}
+	}
+
 	px, err := WithInstance(db, &Config{
-		DatabaseName:    purl.Path,
-		MigrationsTable: migrationsTable,
+		DatabaseName:     purl.Path,
+		MigrationsTable:  migrationsTable,
+		StatementTimeout: statementTimeout,
 	})
 
 	if err != nil {
@@ -142,9 +196,28 @@ func (ss *SQLServer) Open(url string) (database.Driver, error) {
 	return px, nil
 }
 
+// setTLSQuery translates the x-tls- parameters to the parameters of
+// go-mssqldb, which doesn't support client certificates.
+func setTLSQuery(q nurl.Values, p database.TLSParams) error {
+	if p.Cert != "" {
+		return ErrTLSClientCert
+	}
+	q.Set("encrypt", "true")
+	if p.CA != "" {
+		q.Set("certificate", p.CA)
+	}
+	if p.InsecureSkipVerify {
+		q.Set("TrustServerCertificate", "true")
+	}
+	return nil
+}
+
 // Close the database connection
 func (ss *SQLServer) Close() error {
 	connErr := ss.conn.Close()
+	if ss.sharedDB {
+		return connErr
+	}
 	dbErr := ss.db.Close()
 	if connErr != nil || dbErr != nil {
 		return fmt.Errorf("conn: %v, db: %v", connErr, dbErr)
@@ -207,9 +280,22 @@ func (ss *SQLServer) Run(migration io.Reader) error {
 		return err
 	}
 
+	ctx := context.Background()
+	timeout := ss.config.StatementTimeout
+	if v, ok := pragma.Parse(migr).Get(pragma.StatementTimeout); ok {
+		if timeout, err = database.ParseTimeout(v); err != nil {
+			return err
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	// run migration
 	query := string(migr[:])
-	if _, err := ss.conn.ExecContext(context.Background(), query); err != nil {
+	if _, err := ss.conn.ExecContext(ctx, query); err != nil {
 		if msErr, ok := err.(mssql.Error); ok {
 			message := fmt.Sprintf("migration failed: %s", msErr.Message)
 			if msErr.ProcName != "" {
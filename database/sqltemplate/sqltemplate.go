@@ -0,0 +1,101 @@
+// Package sqltemplate renders migrations written once for multiple databases.
+// Migrations are Go templates (see text/template) with functions expanding
+// to the SQL of the target dialect, e.g.
+//  CREATE TABLE users (
+//    id {{ autoincrement }},
+//    name {{ text_type }} NOT NULL,
+//    created_at TIMESTAMP NOT NULL DEFAULT {{ now_func }}
+//  );
+// Template data are the variables of the migration, e.g. {{ .env }}.
+package sqltemplate
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// Dialect holds the SQL snippets of a database dialect.
+type Dialect struct {
+	// Autoincrement is the type of an auto incrementing integer primary key column.
+	Autoincrement string
+	// NowFunc returns the current timestamp.
+	NowFunc string
+	// TextType is the type of a text column of unlimited length.
+	TextType string
+}
+
+// Dialects holds the snippets of the supported dialects by name,
+// see source.Dialects. Add a dialect to support it.
+var Dialects = map[string]Dialect{
+	"postgres": {
+		Autoincrement: "SERIAL PRIMARY KEY",
+		NowFunc:       "NOW()",
+		TextType:      "TEXT",
+	},
+	"cockroachdb": {
+		Autoincrement: "SERIAL PRIMARY KEY",
+		NowFunc:       "NOW()",
+		TextType:      "STRING",
+	},
+	"redshift": {
+		Autoincrement: "INTEGER IDENTITY(1,1) PRIMARY KEY",
+		NowFunc:       "GETDATE()",
+		TextType:      "VARCHAR(MAX)",
+	},
+	"mysql": {
+		Autoincrement: "INTEGER PRIMARY KEY AUTO_INCREMENT",
+		NowFunc:       "NOW()",
+		TextType:      "LONGTEXT",
+	},
+	"sqlite3": {
+		Autoincrement: "INTEGER PRIMARY KEY AUTOINCREMENT",
+		NowFunc:       "CURRENT_TIMESTAMP",
+		TextType:      "TEXT",
+	},
+	"sqlserver": {
+		Autoincrement: "INT IDENTITY(1,1) PRIMARY KEY",
+		NowFunc:       "GETDATE()",
+		TextType:      "NVARCHAR(MAX)",
+	},
+}
+
+// ErrUnknownDialect is returned when rendering for a dialect missing from Dialects.
+type ErrUnknownDialect struct {
+	Dialect string
+}
+
+func (e ErrUnknownDialect) Error() string {
+	return fmt.Sprintf("sqltemplate: unknown dialect %q", e.Dialect)
+}
+
+// Funcs returns the template functions of dialect.
+func Funcs(dialect string) (template.FuncMap, error) {
+	d, ok := Dialects[dialect]
+	if !ok {
+		return nil, ErrUnknownDialect{dialect}
+	}
+	return template.FuncMap{
+		"autoincrement": func() string { return d.Autoincrement },
+		"now_func":      func() string { return d.NowFunc },
+		"text_type":     func() string { return d.TextType },
+		"dialect":       func() string { return dialect },
+	}, nil
+}
+
+// Render renders the migration body for dialect.
+func Render(body []byte, dialect string, vars map[string]string) ([]byte, error) {
+	funcs, err := Funcs(dialect)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("migration").Funcs(funcs).Option("missingkey=zero").Parse(string(body))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
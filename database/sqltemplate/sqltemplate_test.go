@@ -0,0 +1,51 @@
+package sqltemplate
+
+import (
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	const body = `CREATE TABLE users (id {{ autoincrement }}, name {{ text_type }}, created_at TIMESTAMP DEFAULT {{ now_func }});
+-- {{ dialect }} {{ .env }}{{ .missing }}`
+
+	tt := []struct {
+		dialect   string
+		expected  string
+		expectErr error
+	}{
+		{
+			dialect:  "postgres",
+			expected: "CREATE TABLE users (id SERIAL PRIMARY KEY, name TEXT, created_at TIMESTAMP DEFAULT NOW());\n-- postgres dev",
+		},
+		{
+			dialect:  "mysql",
+			expected: "CREATE TABLE users (id INTEGER PRIMARY KEY AUTO_INCREMENT, name LONGTEXT, created_at TIMESTAMP DEFAULT NOW());\n-- mysql dev",
+		},
+		{
+			dialect:  "sqlite3",
+			expected: "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);\n-- sqlite3 dev",
+		},
+		{
+			dialect:   "oracle",
+			expectErr: ErrUnknownDialect{"oracle"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.dialect, func(t *testing.T) {
+			got, err := Render([]byte(body), tc.dialect, map[string]string{"env": "dev"})
+			if err != tc.expectErr {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderSyntaxError(t *testing.T) {
+	if _, err := Render([]byte("SELECT {{ autoincrement"), "postgres", nil); err == nil {
+		t.Error("expected syntax error")
+	}
+}
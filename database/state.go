@@ -0,0 +1,13 @@
+package database
+
+// StateStore keeps the version of a database, see migrate.Migrate.State.
+// Every Driver is a StateStore, stores outside of databases are provided by
+// package state, e.g. for databases without reliable transactional tables.
+type StateStore interface {
+	// Version returns the current version and whether it is dirty,
+	// or NilVersion if no version was set.
+	Version() (version int, dirty bool, err error)
+
+	// SetVersion records version, or NilVersion, and whether it is dirty.
+	SetVersion(version int, dirty bool) error
+}
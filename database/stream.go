@@ -0,0 +1,74 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// ParamStreamThreshold is the URL query parameter of the StreamThreshold
+// of the drivers which stream large migrations, see ReadMigration.
+const ParamStreamThreshold = "x-stream-threshold"
+
+// DefaultStreamThreshold is the size in bytes above which ReadMigration
+// streams a migration.
+var DefaultStreamThreshold int64 = 16 << 20
+
+// streamHead is how much of a streamed migration ReadMigration reads
+// ahead, enough for its pragmas.
+const streamHead = 64 << 10
+
+// ReadMigration reads a migration into body, unless it is larger than
+// threshold bytes. Then body holds the head of the migration, enough to
+// parse its pragmas, and stream reads the whole migration, so that the
+// driver can run it statement by statement without reading it into memory,
+// see multistmt.Scanner. A threshold of zero is DefaultStreamThreshold,
+// a negative threshold never streams.
+//
+// The size hint of migration, see source.Size, saves reading ahead up to
+// threshold bytes to tell large migrations.
+func ReadMigration(migration io.Reader, threshold int64) (body []byte, stream io.Reader, err error) {
+	if threshold == 0 {
+		threshold = DefaultStreamThreshold
+	}
+	var buf bytes.Buffer
+	if threshold < 0 {
+		_, err := buf.ReadFrom(migration)
+		return buf.Bytes(), nil, err
+	}
+
+	limit := threshold
+	size := source.Size(migration)
+	if size > threshold {
+		limit = streamHead
+	} else if size >= 0 {
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+	n, err := buf.ReadFrom(io.LimitReader(migration, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if n <= limit {
+		return buf.Bytes(), nil, nil
+	}
+	head := buf.Bytes()
+	return head, io.MultiReader(bytes.NewReader(head), migration), nil
+}
+
+// ParseStreamThreshold reads ParamStreamThreshold, in bytes, from the query
+// of a URL.
+func ParseStreamThreshold(q nurl.Values) (int64, error) {
+	s := q.Get(ParamStreamThreshold)
+	if s == "" {
+		return 0, nil
+	}
+	threshold, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v %q: %v", ParamStreamThreshold, s, err)
+	}
+	return threshold, nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func TestReadMigration(t *testing.T) {
+	migration := "-- migrate:no-transaction\nSELECT 1;\nSELECT 2;\n"
+	cases := []struct {
+		name      string
+		threshold int64
+		size      int64
+		stream    bool
+	}{
+		{"small", 1024, -1, false},
+		{"exact", int64(len(migration)), -1, false},
+		{"large", 16, -1, true},
+		{"never", -1, -1, false},
+		{"small size hint", 1024, int64(len(migration)), false},
+		{"large size hint", 16, int64(len(migration)), false},
+		{"wrong size hint", 16, 1, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := ioutil.NopCloser(strings.NewReader(migration))
+			if c.size >= 0 {
+				r = source.WithSize(r, c.size)
+			}
+			body, stream, err := ReadMigration(r, c.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (stream != nil) != c.stream {
+				t.Fatalf("expected streaming %v, got %v", c.stream, stream != nil)
+			}
+			if stream == nil {
+				if string(body) != migration {
+					t.Fatalf("expected %q, got %q", migration, body)
+				}
+				return
+			}
+			if !strings.HasPrefix(migration, string(body)) {
+				t.Fatalf("expected a head of the migration, got %q", body)
+			}
+			all, err := ioutil.ReadAll(stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(all) != migration {
+				t.Fatalf("expected %q, got %q", migration, all)
+			}
+		})
+	}
+}
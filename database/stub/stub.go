@@ -1,9 +1,11 @@
 package stub
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"reflect"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4/database"
 )
@@ -20,6 +22,14 @@ type Stub struct {
 	LastRunMigration  []byte // todo: make []string
 	IsDirty           bool
 	IsLocked          bool
+	Lag               time.Duration
+	LagQueries        []string
+	IsInTx            bool
+
+	// state saved by Begin, restored by Rollback
+	txVersion  int
+	txDirty    bool
+	txSequence int
 
 	Config *Config
 }
@@ -44,6 +54,10 @@ func WithInstance(instance interface{}, config *Config) (database.Driver, error)
 	}, nil
 }
 
+func (s *Stub) Ping(ctx context.Context, url string) error {
+	return nil
+}
+
 func (s *Stub) Close() error {
 	return nil
 }
@@ -61,6 +75,19 @@ func (s *Stub) Unlock() error {
 	return nil
 }
 
+func (s *Stub) LockHolder() (*database.LockInfo, error) {
+	if !s.IsLocked {
+		return nil, nil
+	}
+	info := database.NewLockInfo()
+	return &info, nil
+}
+
+func (s *Stub) ForceUnlock() error {
+	s.IsLocked = false
+	return nil
+}
+
 func (s *Stub) Run(migration io.Reader) error {
 	m, err := ioutil.ReadAll(migration)
 	if err != nil {
@@ -81,6 +108,41 @@ func (s *Stub) Version() (version int, dirty bool, err error) {
 	return s.CurrentVersion, s.IsDirty, nil
 }
 
+func (s *Stub) ReplicationLag(query string) (time.Duration, error) {
+	s.LagQueries = append(s.LagQueries, query)
+	return s.Lag, nil
+}
+
+func (s *Stub) Begin() error {
+	if s.IsInTx {
+		return database.ErrInTx
+	}
+	s.IsInTx = true
+	s.txVersion = s.CurrentVersion
+	s.txDirty = s.IsDirty
+	s.txSequence = len(s.MigrationSequence)
+	return nil
+}
+
+func (s *Stub) Commit() error {
+	if !s.IsInTx {
+		return database.ErrNotInTx
+	}
+	s.IsInTx = false
+	return nil
+}
+
+func (s *Stub) Rollback() error {
+	if !s.IsInTx {
+		return database.ErrNotInTx
+	}
+	s.IsInTx = false
+	s.CurrentVersion = s.txVersion
+	s.IsDirty = s.txDirty
+	s.MigrationSequence = s.MigrationSequence[:s.txSequence]
+	return nil
+}
+
 const DROP = "DROP"
 
 func (s *Stub) Drop() error {
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTagTable is the conventional table of a TagTable.
+var DefaultTagTable = "schema_migrations_tags"
+
+// ErrTagNotFound is returned by TagTable.Get for an unknown tag.
+var ErrTagNotFound = fmt.Errorf("tag not found")
+
+// ErrTagExists is returned by TagTable.Add for a tag which exists already.
+var ErrTagExists = fmt.Errorf("tag exists already")
+
+// maxTagLength limits the length of tag names.
+const maxTagLength = 255
+
+// Tag names a version, e.g. that of a release of the application.
+type Tag struct {
+	Name    string
+	Version int
+	Created time.Time
+}
+
+// TagTable stores Tags as rows of a table, for SQL databases. The driver
+// must implement Querier.
+type TagTable struct {
+	Driver Driver
+	Table  string
+}
+
+// Add creates the tag table if necessary and inserts t. Tags can't be
+// moved, adding an existing tag fails with ErrTagExists.
+func (tt *TagTable) Add(t Tag) error {
+	if t.Name == "" || len(t.Name) > maxTagLength {
+		return fmt.Errorf("invalid tag %q: must have 1 to %v characters", t.Name, maxTagLength)
+	}
+	if err := createTable(tt.Driver, tt.Table, "tag VARCHAR(255) NOT NULL PRIMARY KEY, version BIGINT, created_at VARCHAR(32)"); err != nil {
+		return err
+	}
+
+	if _, err := tt.Get(t.Name); err == nil {
+		return ErrTagExists
+	} else if err != ErrTagNotFound {
+		return err
+	}
+	query := "INSERT INTO " + quotedTable(tt.Driver, tt.Table) + " (tag, version, created_at) VALUES (" + quote(t.Name) + ", " +
+		strconv.Itoa(t.Version) + ", " + quote(t.Created.UTC().Format(time.RFC3339)) + ")"
+	if err := tt.Driver.Run(strings.NewReader(query)); err != nil {
+		return &Error{OrigErr: err, Err: "tag failed", Query: []byte(query)}
+	}
+	return nil
+}
+
+// Get returns the tag name, or ErrTagNotFound.
+func (tt *TagTable) Get(name string) (*Tag, error) {
+	tags, err := tt.query(" WHERE tag = " + quote(name))
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, ErrTagNotFound
+	}
+	return &tags[0], nil
+}
+
+// List returns all tags, ordered by version.
+func (tt *TagTable) List() ([]Tag, error) {
+	return tt.query(" ORDER BY version, created_at")
+}
+
+func (tt *TagTable) query(clauses string) ([]Tag, error) {
+	q, ok := tt.Driver.(Querier)
+	if !ok {
+		return nil, fmt.Errorf("database driver can't query the tag table")
+	}
+	rows, err := q.Query("SELECT tag, version, created_at FROM " + quotedTable(tt.Driver, tt.Table) + clauses)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]Tag, 0, len(rows))
+	for _, r := range rows {
+		t := Tag{Name: fmt.Sprint(r["tag"])}
+		if t.Version, err = strconv.Atoi(fmt.Sprint(r["version"])); err != nil {
+			return nil, fmt.Errorf("invalid version in %v: %v", tt.Table, err)
+		}
+		if t.Created, err = time.Parse(time.RFC3339, fmt.Sprint(r["created_at"])); err != nil {
+			return nil, fmt.Errorf("invalid created_at in %v: %v", tt.Table, err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
@@ -5,6 +5,7 @@ package testing
 
 import (
 	"bytes"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
@@ -156,3 +157,21 @@ func TestSetVersion(t *testing.T, d database.Driver) {
 		t.Fatal("expected version to be 2")
 	}
 }
+
+// TestWithSQLInstance tests that the registered driver name can be created
+// from instance, and that closing it leaves instance open.
+func TestWithSQLInstance(t *testing.T, name string, instance *sql.DB) {
+	d, err := database.WithSQLInstance(name, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.Ping(); err != nil {
+		t.Fatalf("expected instance to stay open, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	nurl "net/url"
+	"strconv"
+)
+
+// URL parameters configuring TLS, understood by the SQL drivers which
+// connect over the network.
+const (
+	ParamTLSCA                 = "x-tls-ca"
+	ParamTLSCert               = "x-tls-cert"
+	ParamTLSKey                = "x-tls-key"
+	ParamTLSInsecureSkipVerify = "x-tls-insecure-skip-verify"
+)
+
+var (
+	ErrAppendPEM        = fmt.Errorf("failed to append PEM")
+	ErrTLSCertKeyConfig = fmt.Errorf("To use TLS client authentication, both x-tls-cert and x-tls-key must not be empty")
+)
+
+// TLSParams are the TLS settings given as URL parameters.
+type TLSParams struct {
+	// CA is the file with the PEM encoded certificate authorities to verify
+	// the server with, the system pool is used if empty.
+	CA string
+
+	// Cert and Key are the files of the client certificate, either both or
+	// none are set.
+	Cert string
+	Key  string
+
+	InsecureSkipVerify bool
+}
+
+// ParseTLSParams reads the TLS parameters from the query of a URL.
+func ParseTLSParams(q nurl.Values) (TLSParams, error) {
+	p := TLSParams{
+		CA:   q.Get(ParamTLSCA),
+		Cert: q.Get(ParamTLSCert),
+		Key:  q.Get(ParamTLSKey),
+	}
+	if (p.Cert == "") != (p.Key == "") {
+		return p, ErrTLSCertKeyConfig
+	}
+	if s := q.Get(ParamTLSInsecureSkipVerify); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return p, fmt.Errorf("invalid %v %q: %v", ParamTLSInsecureSkipVerify, s, err)
+		}
+		p.InsecureSkipVerify = v
+	}
+	return p, nil
+}
+
+// IsSet reports whether any TLS parameter was given.
+func (p TLSParams) IsSet() bool {
+	return p != TLSParams{}
+}
+
+// Config loads the certificates into a tls.Config.
+func (p TLSParams) Config() (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: p.InsecureSkipVerify}
+	if p.CA != "" {
+		pem, err := ioutil.ReadFile(p.CA)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if ok := c.RootCAs.AppendCertsFromPEM(pem); !ok {
+			return nil, ErrAppendPEM
+		}
+	}
+	if p.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(p.Cert, p.Key)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
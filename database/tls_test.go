@@ -0,0 +1,58 @@
+package database
+
+import (
+	"io/ioutil"
+	nurl "net/url"
+	"os"
+	"testing"
+)
+
+func TestParseTLSParams(t *testing.T) {
+	q, err := nurl.ParseQuery("x-tls-ca=ca.pem&x-tls-cert=client.pem&x-tls-key=client.key&x-tls-insecure-skip-verify=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParseTLSParams(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := TLSParams{CA: "ca.pem", Cert: "client.pem", Key: "client.key", InsecureSkipVerify: true}
+	if p != expected {
+		t.Fatalf("expected %+v, got %+v", expected, p)
+	}
+
+	if p, _ := ParseTLSParams(nurl.Values{}); p.IsSet() {
+		t.Fatal("expected no TLS params")
+	}
+	if _, err := ParseTLSParams(nurl.Values{ParamTLSCert: {"client.pem"}}); err != ErrTLSCertKeyConfig {
+		t.Fatalf("expected %v, got %v", ErrTLSCertKeyConfig, err)
+	}
+	if _, err := ParseTLSParams(nurl.Values{ParamTLSInsecureSkipVerify: {"maybe"}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTLSParamsConfig(t *testing.T) {
+	c, err := TLSParams{InsecureSkipVerify: true}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.InsecureSkipVerify || c.RootCAs != nil || len(c.Certificates) != 0 {
+		t.Fatalf("unexpected config %+v", c)
+	}
+
+	f, err := ioutil.TempFile("", "ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("not a certificate"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (TLSParams{CA: f.Name()}).Config(); err != ErrAppendPEM {
+		t.Fatalf("expected %v, got %v", ErrAppendPEM, err)
+	}
+}
@@ -3,11 +3,51 @@ package database
 import (
 	"fmt"
 	"hash/crc32"
+	"regexp"
 	"strings"
 )
 
 const advisoryLockIDSalt uint = 1486364155
 
+// createTable creates one of migrate's own tables with the column
+// definitions columns, unless it exists, see TableCreator. For other drivers
+// it runs CREATE TABLE and ignores only the error of an existing table, as
+// not every database supports IF NOT EXISTS.
+func createTable(d Driver, table, columns string) error {
+	if c, ok := d.(TableCreator); ok {
+		return c.CreateTable(table, columns)
+	}
+	query := "CREATE TABLE " + quotedTable(d, table) + " (" + columns + ")"
+	if err := d.Run(strings.NewReader(query)); err != nil && !tableExists.MatchString(err.Error()) {
+		return &Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// tableExists matches the errors of databases for a table which exists
+// already, e.g. "table history already exists" or SQL Server's "There is
+// already an object named 'history' in the database."
+var tableExists = regexp.MustCompile(`(?i)\bexists\b|already an object named|already existing|duplicate name`)
+
+// quotedTable returns table quoted by the driver, if it is an
+// IdentifierQuoter, or else as is.
+func quotedTable(d Driver, table string) string {
+	if q, ok := d.(IdentifierQuoter); ok {
+		return QuoteTable(table, q.QuoteIdentifier)
+	}
+	return table
+}
+
+// QuoteTable quotes the name of a table with quoteIdent, part by part if it
+// is qualified by its schema, e.g. public.history.
+func QuoteTable(table string, quoteIdent func(name string) string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdent(part)
+	}
+	return strings.Join(parts, ".")
+}
+
 // GenerateAdvisoryLockId inspired by rails migrations, see https://goo.gl/8o9bCT
 func GenerateAdvisoryLockId(databaseName string, additionalNames ...string) (string, error) { // nolint: golint
 	if len(additionalNames) > 0 {
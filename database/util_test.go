@@ -1,6 +1,11 @@
 package database
 
 import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -45,3 +50,103 @@ func TestGenerateAdvisoryLockId(t *testing.T) {
 		})
 	}
 }
+
+// runDriver records the statements run
+type runDriver struct {
+	mockDriver
+	statements []string
+}
+
+func (d *runDriver) Run(migration io.Reader) error {
+	b, err := ioutil.ReadAll(migration)
+	d.statements = append(d.statements, string(b))
+	return err
+}
+
+// tableCreatorDriver implements TableCreator
+type tableCreatorDriver struct {
+	runDriver
+	created []string
+}
+
+func (d *tableCreatorDriver) CreateTable(table, columns string) error {
+	d.created = append(d.created, table)
+	return nil
+}
+
+func TestCreateTable(t *testing.T) {
+	d := &runDriver{}
+	h := &HistoryTable{Driver: d, Table: "history"}
+	if err := h.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.statements) != 1 || !strings.HasPrefix(d.statements[0], "CREATE TABLE history (") {
+		t.Errorf("expected CREATE TABLE, got %v", d.statements)
+	}
+
+	// records don't create the table, which would abort a transaction
+	if err := h.Record(HistoryRecord{Version: 1, Direction: "up"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.statements) != 2 || !strings.HasPrefix(d.statements[1], "INSERT INTO history ") {
+		t.Errorf("expected only an INSERT, got %v", d.statements[1:])
+	}
+
+	c := &tableCreatorDriver{}
+	if err := (&HistoryTable{Driver: c, Table: "history"}).Create(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.statements) != 0 || !reflect.DeepEqual(c.created, []string{"history"}) {
+		t.Errorf("expected the table created by the driver, got %v and %v", c.statements, c.created)
+	}
+}
+
+// failingDriver fails every statement with err
+type failingDriver struct {
+	mockDriver
+	err error
+}
+
+func (d *failingDriver) Run(migration io.Reader) error {
+	return d.err
+}
+
+func TestCreateTableErrors(t *testing.T) {
+	exists := []string{
+		"table history already exists",
+		"There is already an object named 'history' in the database.",
+		"CREATE TABLE: table history exists",
+	}
+	for _, msg := range exists {
+		if err := createTable(&failingDriver{err: errors.New(msg)}, "history", "version BIGINT"); err != nil {
+			t.Errorf("expected %q to be ignored, got %v", msg, err)
+		}
+	}
+	if err := createTable(&failingDriver{err: errors.New("permission denied for schema public")}, "history", "version BIGINT"); err == nil {
+		t.Error("expected the error of CREATE TABLE")
+	}
+}
+
+// quotingDriver quotes identifiers like ANSI SQL
+type quotingDriver struct {
+	runDriver
+}
+
+func (d *quotingDriver) QuoteIdentifier(name string) string {
+	return `"` + name + `"`
+}
+
+func TestQuotedTable(t *testing.T) {
+	d := &quotingDriver{}
+	h := &HistoryTable{Driver: d, Table: "audit.History"}
+	if err := h.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Record(HistoryRecord{Version: 1, Direction: "up"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.statements) != 2 || !strings.HasPrefix(d.statements[0], `CREATE TABLE "audit"."History" (`) ||
+		!strings.HasPrefix(d.statements[1], `INSERT INTO "audit"."History" `) {
+		t.Errorf("expected the table quoted by the driver, got %v", d.statements)
+	}
+}
@@ -0,0 +1,379 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	nurl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Layouts of the version table, see VersionTable.
+const (
+	// LayoutMigrate is a single row holding the version and the dirty flag.
+	LayoutMigrate = "migrate"
+	// LayoutFlyway is the history table of Flyway, flyway_schema_history.
+	LayoutFlyway = "flyway"
+	// LayoutGoose is the history table of goose, goose_db_version.
+	LayoutGoose = "goose"
+)
+
+// URL parameters customizing the version table of SQL drivers.
+const (
+	ParamVersionLayout = "x-version-layout"
+	ParamVersionColumn = "x-version-column"
+	ParamDirtyColumn   = "x-dirty-column"
+	// ParamStaticColumns are comma separated name=value pairs,
+	// e.g. service_name=billing.
+	ParamStaticColumns = "x-static-columns"
+)
+
+// StaticColumn is a column of the version table holding the same value in
+// every row written, e.g. the name of a service sharing the table with
+// others.
+type StaticColumn struct {
+	Name  string
+	Value string
+}
+
+// VersionTable is a version table with custom columns or the layout of
+// another migration tool, so that teams coming from Flyway or goose can keep
+// their history. SQL drivers use it instead of their own version table if
+// it is set. Column names aren't quoted.
+type VersionTable struct {
+	// Layout is LayoutMigrate, LayoutFlyway or LayoutGoose.
+	Layout string
+
+	// VersionColumn and DirtyColumn name the columns of LayoutMigrate,
+	// version and dirty by default.
+	VersionColumn string
+	DirtyColumn   string
+
+	// Static columns of LayoutMigrate scope the version, rows with other
+	// values are neither read nor written.
+	Static []StaticColumn
+}
+
+// ParseVersionTable reads the version table parameters from the query of a
+// URL. It returns nil if none is set, drivers use their own version table
+// then.
+func ParseVersionTable(q nurl.Values) (*VersionTable, error) {
+	layout := q.Get(ParamVersionLayout)
+	versionColumn := q.Get(ParamVersionColumn)
+	dirtyColumn := q.Get(ParamDirtyColumn)
+	static := q.Get(ParamStaticColumns)
+	if layout == "" && versionColumn == "" && dirtyColumn == "" && static == "" {
+		return nil, nil
+	}
+
+	t := &VersionTable{Layout: layout, VersionColumn: versionColumn, DirtyColumn: dirtyColumn}
+	if static != "" {
+		for _, pair := range strings.Split(static, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid %v %q: expected name=value pairs", ParamStaticColumns, static)
+			}
+			t.Static = append(t.Static, StaticColumn{Name: kv[0], Value: kv[1]})
+		}
+	}
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// init sets the defaults and validates the table.
+func (t *VersionTable) init() error {
+	switch t.Layout {
+	case "", LayoutMigrate:
+		t.Layout = LayoutMigrate
+		if t.VersionColumn == "" {
+			t.VersionColumn = "version"
+		}
+		if t.DirtyColumn == "" {
+			t.DirtyColumn = "dirty"
+		}
+	case LayoutFlyway, LayoutGoose:
+		if t.VersionColumn != "" || t.DirtyColumn != "" || len(t.Static) > 0 {
+			return fmt.Errorf("the columns of the %v layout can't be customized", t.Layout)
+		}
+	default:
+		return fmt.Errorf("invalid %v %q: expected %v, %v or %v", ParamVersionLayout, t.Layout,
+			LayoutMigrate, LayoutFlyway, LayoutGoose)
+	}
+	return nil
+}
+
+// DefaultTable returns the conventional name of the table of the layout,
+// or table for LayoutMigrate. t may be nil.
+func (t *VersionTable) DefaultTable(table string) string {
+	if t == nil {
+		return table
+	}
+	switch t.Layout {
+	case LayoutFlyway:
+		return "flyway_schema_history"
+	case LayoutGoose:
+		return "goose_db_version"
+	}
+	return table
+}
+
+// Create creates the version table, unless it exists. table is quoted
+// already, serial is the type of an auto-incrementing primary key column,
+// e.g. SERIAL PRIMARY KEY, which the goose layout needs.
+func (t *VersionTable) Create(q SQLQueryer, table string, serial string) error {
+	var query string
+	switch t.Layout {
+	case LayoutFlyway:
+		query = "CREATE TABLE IF NOT EXISTS " + table + " (installed_rank INT NOT NULL PRIMARY KEY, " +
+			"version VARCHAR(50), description VARCHAR(200) NOT NULL, type VARCHAR(20) NOT NULL, " +
+			"script VARCHAR(1000) NOT NULL, checksum INT, installed_by VARCHAR(100) NOT NULL, " +
+			"installed_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, execution_time INT NOT NULL, " +
+			"success BOOLEAN NOT NULL)"
+	case LayoutGoose:
+		query = "CREATE TABLE IF NOT EXISTS " + table + " (id " + serial + ", version_id BIGINT NOT NULL, " +
+			"is_applied BOOLEAN NOT NULL, tstamp TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP)"
+	default:
+		columns := make([]string, 0, len(t.Static)+2)
+		key := make([]string, 0, len(t.Static)+1)
+		for _, c := range t.Static {
+			columns = append(columns, c.Name+" VARCHAR(255) NOT NULL")
+			key = append(key, c.Name)
+		}
+		columns = append(columns, t.VersionColumn+" BIGINT NOT NULL", t.DirtyColumn+" BOOLEAN NOT NULL")
+		key = append(key, t.VersionColumn)
+		query = "CREATE TABLE IF NOT EXISTS " + table + " (" + strings.Join(columns, ", ") +
+			", PRIMARY KEY (" + strings.Join(key, ", ") + "))"
+	}
+	if err := exec(q, query); err != nil {
+		return err
+	}
+
+	if t.Layout == LayoutGoose {
+		// goose starts its history with version 0
+		applied, _, err := t.gooseHistory(q, table)
+		if err != nil {
+			return err
+		}
+		if applied == nil {
+			return exec(q, "INSERT INTO "+table+" (version_id, is_applied) VALUES (0, TRUE)")
+		}
+	}
+	return nil
+}
+
+// Version returns the current version and whether it is dirty.
+// table is quoted already.
+func (t *VersionTable) Version(q SQLQueryer, table string) (version int, dirty bool, err error) {
+	switch t.Layout {
+	case LayoutFlyway:
+		// repeatable migrations have no version
+		rows, err := QueryRows(q, "SELECT version, success FROM "+table+" WHERE version IS NOT NULL ORDER BY installed_rank DESC LIMIT 1")
+		if err != nil || len(rows) == 0 {
+			return NilVersion, false, err
+		}
+		if version, err = flywayVersion(fmt.Sprint(rows[0]["version"])); err != nil {
+			return 0, false, err
+		}
+		success, err := strconv.ParseBool(fmt.Sprint(rows[0]["success"]))
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid success in %v: %v", table, err)
+		}
+		return version, !success, nil
+
+	case LayoutGoose:
+		_, version, err := t.gooseHistory(q, table)
+		if err != nil {
+			return 0, false, err
+		}
+		if version == 0 {
+			return NilVersion, false, nil
+		}
+		return version, false, nil
+
+	default:
+		rows, err := QueryRows(q, "SELECT "+t.VersionColumn+" AS version, "+t.DirtyColumn+" AS dirty FROM "+table+t.where()+" LIMIT 1")
+		if err != nil || len(rows) == 0 {
+			return NilVersion, false, err
+		}
+		if version, err = strconv.Atoi(fmt.Sprint(rows[0]["version"])); err != nil {
+			return 0, false, fmt.Errorf("invalid %v in %v: %v", t.VersionColumn, table, err)
+		}
+		if dirty, err = strconv.ParseBool(fmt.Sprint(rows[0]["dirty"])); err != nil {
+			return 0, false, fmt.Errorf("invalid %v in %v: %v", t.DirtyColumn, table, err)
+		}
+		return version, dirty, nil
+	}
+}
+
+// SetVersion records version, or NilVersion, as current version. q should be
+// a transaction, table is quoted already.
+//
+// The history of Flyway and goose is kept: rows of versions above version
+// are removed (Flyway) or marked as not applied (goose). goose's table has
+// no dirty flag, so dirty versions aren't recorded there.
+func (t *VersionTable) SetVersion(q SQLQueryer, table string, version int, dirty bool) error {
+	switch t.Layout {
+	case LayoutFlyway:
+		return t.setFlywayVersion(q, table, version, dirty)
+	case LayoutGoose:
+		if dirty {
+			return nil
+		}
+		return t.setGooseVersion(q, table, version)
+	}
+
+	if err := exec(q, "DELETE FROM "+table+t.where()); err != nil {
+		return err
+	}
+	if version < 0 {
+		return nil
+	}
+	columns := make([]string, 0, len(t.Static)+2)
+	values := make([]string, 0, len(t.Static)+2)
+	for _, c := range t.Static {
+		columns = append(columns, c.Name)
+		values = append(values, quote(c.Value))
+	}
+	columns = append(columns, t.VersionColumn, t.DirtyColumn)
+	values = append(values, strconv.Itoa(version), boolLiteral(dirty))
+	return exec(q, "INSERT INTO "+table+" ("+strings.Join(columns, ", ")+") VALUES ("+strings.Join(values, ", ")+")")
+}
+
+func (t *VersionTable) setFlywayVersion(q SQLQueryer, table string, version int, dirty bool) error {
+	rows, err := QueryRows(q, "SELECT installed_rank, version FROM "+table)
+	if err != nil {
+		return err
+	}
+	maxRank, current := 0, -1
+	var rolledBack []string
+	for _, r := range rows {
+		rank, err := strconv.Atoi(fmt.Sprint(r["installed_rank"]))
+		if err != nil {
+			return fmt.Errorf("invalid installed_rank in %v: %v", table, err)
+		}
+		if rank > maxRank {
+			maxRank = rank
+		}
+		if r["version"] == nil {
+			continue
+		}
+		v, err := flywayVersion(fmt.Sprint(r["version"]))
+		if err != nil {
+			return err
+		}
+		if v > version {
+			rolledBack = append(rolledBack, strconv.Itoa(rank))
+		} else if v == version {
+			current = rank
+		}
+	}
+
+	if len(rolledBack) > 0 {
+		if err := exec(q, "DELETE FROM "+table+" WHERE installed_rank IN ("+strings.Join(rolledBack, ", ")+")"); err != nil {
+			return err
+		}
+	}
+	if version < 0 {
+		return nil
+	}
+	if current >= 0 {
+		return exec(q, "UPDATE "+table+" SET success = "+boolLiteral(!dirty)+" WHERE installed_rank = "+strconv.Itoa(current))
+	}
+	return exec(q, "INSERT INTO "+table+" (installed_rank, version, description, type, script, installed_by, "+
+		"execution_time, success) VALUES ("+strconv.Itoa(maxRank+1)+", "+quote(strconv.Itoa(version))+
+		", 'migrate', 'SQL', '', 'migrate', 0, "+boolLiteral(!dirty)+")")
+}
+
+func (t *VersionTable) setGooseVersion(q SQLQueryer, table string, version int) error {
+	applied, _, err := t.gooseHistory(q, table)
+	if err != nil {
+		return err
+	}
+	versions := make([]int, 0, len(applied))
+	for v, ok := range applied {
+		if ok && v > version && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	// goose marks rolled back versions as not applied, latest first
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	for _, v := range versions {
+		if err := exec(q, "INSERT INTO "+table+" (version_id, is_applied) VALUES ("+strconv.Itoa(v)+", FALSE)"); err != nil {
+			return err
+		}
+	}
+	if version > 0 && !applied[version] {
+		return exec(q, "INSERT INTO "+table+" (version_id, is_applied) VALUES ("+strconv.Itoa(version)+", TRUE)")
+	}
+	return nil
+}
+
+// gooseHistory replays the history of goose. It returns whether each version
+// is applied, nil if there is no history, and the current version like goose
+// determines it: the latest applied version which wasn't rolled back since.
+func (t *VersionTable) gooseHistory(q SQLQueryer, table string) (map[int]bool, int, error) {
+	rows, err := QueryRows(q, "SELECT version_id, is_applied FROM "+table+" ORDER BY id")
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(rows) == 0 {
+		return nil, 0, nil
+	}
+	applied := make(map[int]bool)
+	order := make([]int, 0, len(rows))
+	for _, r := range rows {
+		v, err := strconv.Atoi(fmt.Sprint(r["version_id"]))
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid version_id in %v: %v", table, err)
+		}
+		isApplied, err := strconv.ParseBool(fmt.Sprint(r["is_applied"]))
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid is_applied in %v: %v", table, err)
+		}
+		applied[v] = isApplied
+		order = append(order, v)
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		if applied[order[i]] {
+			return applied, order[i], nil
+		}
+	}
+	return applied, 0, nil
+}
+
+// where restricts the rows of LayoutMigrate to those of the static columns.
+func (t *VersionTable) where() string {
+	if len(t.Static) == 0 {
+		return ""
+	}
+	conditions := make([]string, 0, len(t.Static))
+	for _, c := range t.Static {
+		conditions = append(conditions, c.Name+" = "+quote(c.Value))
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func flywayVersion(v string) (int, error) {
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("flyway version %q isn't an integer", v)
+	}
+	return version, nil
+}
+
+func boolLiteral(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func exec(q SQLQueryer, query string) error {
+	if _, err := q.ExecContext(context.Background(), query); err != nil {
+		return &Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
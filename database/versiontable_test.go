@@ -0,0 +1,47 @@
+package database
+
+import (
+	nurl "net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseVersionTable(t *testing.T) {
+	cases := []struct {
+		query string
+		want  *VersionTable
+		err   bool
+	}{
+		{"", nil, false},
+		{"x-version-column=v", &VersionTable{Layout: LayoutMigrate, VersionColumn: "v", DirtyColumn: "dirty"}, false},
+		{"x-static-columns=service_name=billing,team=core", &VersionTable{Layout: LayoutMigrate,
+			VersionColumn: "version", DirtyColumn: "dirty",
+			Static: []StaticColumn{{"service_name", "billing"}, {"team", "core"}}}, false},
+		{"x-version-layout=flyway", &VersionTable{Layout: LayoutFlyway}, false},
+		{"x-version-layout=goose", &VersionTable{Layout: LayoutGoose}, false},
+		{"x-version-layout=liquibase", nil, true},
+		{"x-version-layout=goose&x-version-column=v", nil, true},
+		{"x-static-columns=service_name", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			q, err := nurl.ParseQuery(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vt, err := ParseVersionTable(q)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", vt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(vt, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, vt)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// ErrIntrospectUnsupported is returned if FingerprintTable is set or Drift is
+// called, but the database driver doesn't implement database.Introspector.
+var ErrIntrospectUnsupported = errors.New("database driver can't describe the schema")
+
+// SchemaDrift compares the schema with the fingerprint stored after the
+// last run, see Drift.
+type SchemaDrift struct {
+	// Stored is the fingerprint stored after the last run.
+	Stored database.StoredFingerprint
+	// Current is the fingerprint of the schema now.
+	Current string
+}
+
+// Drifted reports whether the schema was changed since the last run,
+// e.g. by hand.
+func (d *SchemaDrift) Drifted() bool {
+	return d.Stored.Fingerprint != d.Current
+}
+
+// Drift recomputes the fingerprint of the schema and compares it with the
+// one stored in FingerprintTable, or database.DefaultFingerprintTable if
+// it isn't set. It returns database.ErrNoFingerprint if no fingerprint was
+// stored yet.
+func (m *Migrate) Drift() (*SchemaDrift, error) {
+	current, err := m.schemaFingerprint()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := m.fingerprintTable().Load()
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaDrift{Stored: *stored, Current: current}, nil
+}
+
+// fingerprint stores the fingerprint of the schema in FingerprintTable, if
+// it is set, Migrate isn't read-only or a dry run and the run succeeded. err is the
+// result of the run, it is set if storing fails.
+func (m *Migrate) fingerprint(err *error) {
+	if m.FingerprintTable == "" || m.readOnly() || m.DryRun || *err != nil {
+		return
+	}
+	if fpErr := m.storeFingerprint(); fpErr != nil {
+		m.logErr(fpErr)
+		*err = fpErr
+	}
+}
+
+func (m *Migrate) storeFingerprint() error {
+	fingerprint, err := m.schemaFingerprint()
+	if err != nil {
+		return err
+	}
+	version, _, err := m.state().Version()
+	if err != nil {
+		return err
+	}
+	return m.fingerprintTable().Store(database.StoredFingerprint{
+		Fingerprint: fingerprint,
+		Version:     version,
+		Created:     time.Now(),
+	})
+}
+
+// schemaFingerprint hashes the schema without migrate's own tables.
+func (m *Migrate) schemaFingerprint() (string, error) {
+	objects, err := m.schema()
+	if err != nil {
+		return "", err
+	}
+	return database.Fingerprint(objects), nil
+}
+
+// schema returns the schema objects without those of migrate's own tables.
+func (m *Migrate) schema() ([]database.SchemaObject, error) {
+	introspector, ok := m.databaseDrv.(database.Introspector)
+	if !ok {
+		return nil, ErrIntrospectUnsupported
+	}
+	objects, err := introspector.Schema()
+	if err != nil {
+		return nil, err
+	}
+	own := make(map[string]bool)
+	for _, t := range m.ownTables() {
+		own[strings.ToLower(t)] = true
+	}
+	schema := make([]database.SchemaObject, 0, len(objects))
+	for _, o := range objects {
+		if !own[strings.ToLower(o.Table)] {
+			schema = append(schema, o)
+		}
+	}
+	return schema, nil
+}
+
+// ownTables returns migrate's tables besides the version table, which
+// aren't part of the schema.
+func (m *Migrate) ownTables() []string {
+	tables := []string{m.fingerprintTable().Table, database.DefaultFingerprintTable,
+		m.tagTable().Table, database.DefaultTagTable, database.DefaultAuditTable, database.DefaultHistoryTable, database.DefaultLockTable}
+	if m.AuditTable != "" {
+		tables = append(tables, m.AuditTable)
+	}
+	if m.HistoryTable != "" {
+		tables = append(tables, m.HistoryTable)
+	}
+	return tables
+}
+
+func (m *Migrate) fingerprintTable() *database.FingerprintTable {
+	table := m.FingerprintTable
+	if table == "" {
+		table = database.DefaultFingerprintTable
+	}
+	return &database.FingerprintTable{Driver: m.stateDriver(), Table: table}
+}
@@ -0,0 +1,58 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// ErrEmptyMigration is returned with StrictEmpty for a migration which is
+// empty or consists of comments only, e.g. a truncated download or a
+// template rendered without content.
+type ErrEmptyMigration struct {
+	// Migration is the migration as logged, e.g. 3/u add_users
+	Migration string
+}
+
+func (e ErrEmptyMigration) Error() string {
+	return "migration " + e.Migration + " is empty"
+}
+
+// peekEmpty returns true if body is empty or consists of comments only,
+// without consuming it. Bodies longer than pragmaPeekSize are never empty.
+func peekEmpty(body *bufio.Reader) (bool, error) {
+	head, err := body.Peek(pragmaPeekSize)
+	if err == bufio.ErrBufferFull || len(head) == pragmaPeekSize {
+		return false, nil
+	} else if err != nil && err != io.EOF {
+		return false, err
+	}
+	return isEmpty(head), nil
+}
+
+// isEmpty returns true if body holds nothing but whitespace, -- comments and
+// /* */ comments.
+func isEmpty(body []byte) bool {
+	for {
+		body = bytes.TrimSpace(body)
+		switch {
+		case len(body) == 0:
+			return true
+		case bytes.HasPrefix(body, []byte("--")):
+			i := bytes.IndexByte(body, '\n')
+			if i < 0 {
+				return true
+			}
+			body = body[i+1:]
+		case bytes.HasPrefix(body, []byte("/*")):
+			i := bytes.Index(body[2:], []byte("*/"))
+			if i < 0 {
+				// an unterminated comment is left to the database
+				return false
+			}
+			body = body[i+4:]
+		default:
+			return false
+		}
+	}
+}
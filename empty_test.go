@@ -0,0 +1,59 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestIsEmpty(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected bool
+	}{
+		{"", true},
+		{" \n\t", true},
+		{"-- nothing to do", true},
+		{"-- migrate:tags seed\n/* irreversible\n */\n", true},
+		{"/* unterminated", false},
+		{"-- drop\nDROP TABLE users;", false},
+		{"/* x */ SELECT 1", false},
+	}
+	for _, c := range cases {
+		if empty := isEmpty([]byte(c.body)); empty != c.expected {
+			t.Errorf("expected %q empty %v, got %v", c.body, c.expected, empty)
+		}
+	}
+}
+
+func TestEmptyMigration(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "-- CREATE 2\n"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.StrictEmpty = true
+	if err := m.Up(); err != (ErrEmptyMigration{Migration: "2/u 2.up.stub"}) {
+		t.Fatalf("expected ErrEmptyMigration, got %v", err)
+	}
+	if v, dirty, err := m.Version(); err != nil || v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v, %v, %v", v, dirty, err)
+	}
+
+	m.StrictEmpty = false
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := m.Version(); err != nil || v != 3 {
+		t.Fatalf("expected version 3, got %v, %v", v, err)
+	}
+	expected := []string{"CREATE 1", "CREATE 3"}
+	if seq := m.databaseDrv.(*dStub.Stub).MigrationSequence; !reflect.DeepEqual(seq, expected) {
+		t.Errorf("expected %q, got %q", expected, seq)
+	}
+}
@@ -0,0 +1,285 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// Supported encodings of migration files, see Migrate.Encoding.
+const (
+	EncodingAuto    = ""
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin1"
+)
+
+// gzipMagic starts every gzip compressed migration.
+var gzipMagic = []byte{0x1F, 0x8B}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// ErrUnknownEncoding is returned for an unsupported Migrate.Encoding.
+type ErrUnknownEncoding struct {
+	Encoding string
+}
+
+func (e ErrUnknownEncoding) Error() string {
+	return fmt.Sprintf("unknown encoding %q", e.Encoding)
+}
+
+// encodingFromURL returns the `x-encoding` query of a source URL.
+func encodingFromURL(url string) (string, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	return normalizeEncoding(u.Query().Get("x-encoding"))
+}
+
+// normalizeEncoding maps the accepted spellings of an encoding name
+// to one of the Encoding constants.
+func normalizeEncoding(encoding string) (string, error) {
+	switch strings.ToLower(strings.Replace(encoding, "_", "-", -1)) {
+	case "", "auto":
+		return EncodingAuto, nil
+	case "utf-8", "utf8":
+		return EncodingUTF8, nil
+	case "utf-16le", "utf16le", "utf-16", "utf16":
+		return EncodingUTF16LE, nil
+	case "utf-16be", "utf16be":
+		return EncodingUTF16BE, nil
+	case "latin1", "latin-1", "iso-8859-1", "iso8859-1":
+		return EncodingLatin1, nil
+	default:
+		return "", ErrUnknownEncoding{encoding}
+	}
+}
+
+// decodingReader decrypts and decompresses migration bodies, transcodes
+// them to UTF-8 and strips byte order marks. Encryption, compression and
+// encoding are detected on the first Read, so that creating a decodingReader
+// doesn't start reading the body.
+type decodingReader struct {
+	body      io.ReadCloser
+	decrypter Decrypter
+	gz        *gzip.Reader
+	encoding  string
+	r         *bufio.Reader
+	decode    func(r *bufio.Reader) (rune, error)
+	pending   []byte
+}
+
+func newDecodingReader(body io.ReadCloser, encoding string, decrypter Decrypter) (io.ReadCloser, error) {
+	encoding, err := normalizeEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &decodingReader{body: body, encoding: encoding, decrypter: decrypter}, nil
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.r == nil {
+		if err := d.decompress(); err != nil {
+			return 0, err
+		}
+		if err := d.detect(); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.decode == nil {
+		return d.r.Read(p)
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	for n < len(p) {
+		c, err := d.decode(d.r)
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		var buf [utf8.UTFMax]byte
+		size := utf8.EncodeRune(buf[:], c)
+		copied := copy(p[n:], buf[:size])
+		d.pending = append(d.pending, buf[copied:size]...)
+		n += copied
+	}
+	return n, nil
+}
+
+// Size returns the size hint of the body before decoding, see source.Size.
+func (d *decodingReader) Size() int64 {
+	return source.Size(d.body)
+}
+
+func (d *decodingReader) Close() error {
+	if d.gz != nil {
+		if err := d.gz.Close(); err != nil {
+			return multierror.Append(err, d.body.Close())
+		}
+	}
+	return d.body.Close()
+}
+
+// decompress sets up reading the body, decrypting it if it is encrypted
+// and decompressing it if it starts with the gzip magic number.
+func (d *decodingReader) decompress() error {
+	br, err := decrypt(bufio.NewReader(d.body), d.decrypter)
+	if err != nil {
+		return err
+	}
+	head, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Equal(head, gzipMagic) {
+		d.r = br
+		return nil
+	}
+
+	d.gz, err = gzip.NewReader(br)
+	if err != nil {
+		return err
+	}
+	d.r = bufio.NewReader(d.gz)
+	return nil
+}
+
+// detect strips a byte order mark and picks the decoder
+// for the configured or detected encoding.
+func (d *decodingReader) detect() error {
+	head, err := d.r.Peek(512)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	err = nil
+
+	// WebAssembly modules are binary
+	if isWasm(head) {
+		return nil
+	}
+
+	encoding := d.encoding
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		if encoding == EncodingAuto {
+			encoding = EncodingUTF8
+		}
+		if encoding == EncodingUTF8 {
+			_, err = d.r.Discard(len(bomUTF8))
+		}
+	case bytes.HasPrefix(head, bomUTF16LE) && (encoding == EncodingAuto || encoding == EncodingUTF16LE):
+		encoding = EncodingUTF16LE
+		_, err = d.r.Discard(len(bomUTF16LE))
+	case bytes.HasPrefix(head, bomUTF16BE) && (encoding == EncodingAuto || encoding == EncodingUTF16BE):
+		encoding = EncodingUTF16BE
+		_, err = d.r.Discard(len(bomUTF16BE))
+	case encoding == EncodingAuto:
+		encoding = guessUTF16(head)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch encoding {
+	case EncodingUTF16LE:
+		d.decode = decodeUTF16(func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 })
+	case EncodingUTF16BE:
+		d.decode = decodeUTF16(func(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) })
+	case EncodingLatin1:
+		d.decode = decodeLatin1
+	}
+	return nil
+}
+
+// guessUTF16 detects UTF-16 without byte order mark by the NUL bytes
+// of ASCII characters, which make up most of a migration.
+func guessUTF16(head []byte) string {
+	if len(head) < 2 || utf8.Valid(head) && bytes.IndexByte(head, 0) < 0 {
+		return EncodingAuto
+	}
+	var even, odd int
+	for i, b := range head {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	half := len(head) / 4
+	switch {
+	case odd > half && even == 0:
+		return EncodingUTF16LE
+	case even > half && odd == 0:
+		return EncodingUTF16BE
+	default:
+		return EncodingAuto
+	}
+}
+
+func decodeLatin1(r *bufio.Reader) (rune, error) {
+	b, err := r.ReadByte()
+	return rune(b), err
+}
+
+func decodeUTF16(unit func(b []byte) uint16) func(r *bufio.Reader) (rune, error) {
+	var buf [2]byte
+	read := func(r *bufio.Reader) (uint16, error) {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return utf8.RuneError, nil
+			}
+			return 0, err
+		}
+		return unit(buf[:]), nil
+	}
+
+	return func(r *bufio.Reader) (rune, error) {
+		u, err := read(r)
+		if err != nil {
+			return 0, err
+		}
+		if !utf16.IsSurrogate(rune(u)) {
+			return rune(u), nil
+		}
+		// a high surrogate pairs with the following low surrogate, an
+		// unpaired surrogate is U+FFFD and the following unit is left for
+		// the next rune
+		next, err := r.Peek(len(buf))
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if len(next) < len(buf) {
+			return utf8.RuneError, nil
+		}
+		decoded := utf16.DecodeRune(rune(u), rune(unit(next)))
+		if decoded != utf8.RuneError {
+			if _, err := r.Discard(len(buf)); err != nil {
+				return 0, err
+			}
+		}
+		return decoded, nil
+	}
+}
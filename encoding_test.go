@@ -0,0 +1,168 @@
+package migrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func utf16le(s string) []byte {
+	b := make([]byte, 0)
+	for _, r := range s {
+		b = append(b, byte(r), byte(r>>8))
+	}
+	return b
+}
+
+func utf16be(s string) []byte {
+	b := make([]byte, 0)
+	for _, r := range s {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return b
+}
+
+func TestDecodingReader(t *testing.T) {
+	const sql = "SELECT 'Grüße';"
+	tt := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"plain", "", []byte(sql)},
+		{"utf-8 bom", "", append([]byte{0xEF, 0xBB, 0xBF}, sql...)},
+		{"explicit utf-8 bom", "utf8", append([]byte{0xEF, 0xBB, 0xBF}, sql...)},
+		{"utf-16le bom", "", append([]byte{0xFF, 0xFE}, utf16le(sql)...)},
+		{"utf-16be bom", "", append([]byte{0xFE, 0xFF}, utf16be(sql)...)},
+		{"utf-16le no bom", "", utf16le(sql)},
+		{"utf-16be no bom", "", utf16be(sql)},
+		{"explicit utf-16", "UTF-16", utf16le(sql)},
+		{"latin1", "iso-8859-1", []byte("SELECT 'Gr\xfc\xdfe';")},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newDecodingReader(ioutil.NopCloser(bytes.NewReader(tc.body)), tc.encoding, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(iotest.OneByteReader(r))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != sql {
+				t.Errorf("expected %q, got %q", sql, got)
+			}
+		})
+	}
+}
+
+func TestDecodingReaderSurrogates(t *testing.T) {
+	tt := []struct {
+		name     string
+		body     []byte
+		expected string
+	}{
+		{"pair", []byte{0x3D, 0xD8, 0x00, 0xDE}, "\U0001F600"},
+		{"unpaired high", []byte{0x3D, 0xD8, 'A', 0x00}, "\uFFFDA"},
+		{"unpaired low", []byte{0x00, 0xDE, 'A', 0x00}, "\uFFFDA"},
+		{"high at the end", []byte{'A', 0x00, 0x3D, 0xD8}, "A\uFFFD"},
+		{"two high", []byte{0x3D, 0xD8, 0x3D, 0xD8, 0x00, 0xDE}, "\uFFFD\U0001F600"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newDecodingReader(ioutil.NopCloser(bytes.NewReader(tc.body)), EncodingUTF16LE, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// checksums are those of the file as stored, before it is decoded, so they
+// match the ones computed of the file by other tools
+func TestChecksumOfStoredFile(t *testing.T) {
+	stored := append([]byte{0xFF, 0xFE}, utf16le("CREATE 1")...)
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: string(stored)})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	mf, err := manifest.Build(m.sourceDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := mf.Entry(1); e.Up != manifest.Checksum(stored) {
+		t.Fatalf("expected manifest checksum of the stored file, got %v", e.Up)
+	}
+	m.Manifest = mf
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{mr("CREATE 1")}, m.databaseDrv.(*dStub.Stub))
+	info, err := m.Show(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Up.Checksum != manifest.Checksum(stored) || string(info.Up.Body) != "CREATE 1" {
+		t.Errorf("expected the checksum of the stored file and the decoded body, got %+v", info.Up)
+	}
+}
+
+func TestDecodingReaderGzip(t *testing.T) {
+	const sql = "SELECT 1;"
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(utf16le(sql)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newDecodingReader(ioutil.NopCloser(&buf), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != sql {
+		t.Errorf("expected %q, got %q", sql, got)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodingReaderUnknownEncoding(t *testing.T) {
+	_, err := newDecodingReader(ioutil.NopCloser(bytes.NewReader(nil)), "ebcdic", nil)
+	if _, ok := err.(ErrUnknownEncoding); !ok {
+		t.Fatalf("expected ErrUnknownEncoding, got %v", err)
+	}
+}
+
+func TestEncodingFromURL(t *testing.T) {
+	e, err := encodingFromURL("file:///migrations?x-encoding=latin-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != EncodingLatin1 {
+		t.Errorf("expected %v, got %v", EncodingLatin1, e)
+	}
+}
@@ -0,0 +1,54 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Headers of age encrypted migrations, binary and ASCII armored.
+var (
+	ageHeader        = []byte("age-encryption.org/v1\n")
+	ageArmoredHeader = []byte("-----BEGIN AGE ENCRYPTED FILE-----")
+)
+
+// ErrNoDecrypter is returned when reading an encrypted migration
+// while Migrate.Decrypter isn't set.
+var ErrNoDecrypter = errors.New("migration is encrypted, but no decrypter is set")
+
+// Decrypter decrypts encrypted migrations in memory before they are run.
+//
+// Migrations encrypted with age (https://age-encryption.org) are detected
+// by their header, in binary or ASCII armored form. Envelope encryption with
+// a cloud KMS is supported by age identities that unwrap the file key with
+// the KMS, so a Decrypter is typically a thin wrapper around age.Decrypt.
+type Decrypter interface {
+	// Decrypt returns the plaintext of an encrypted migration.
+	Decrypt(ciphertext io.Reader) (io.Reader, error)
+}
+
+// isEncrypted reports whether a migration starting with head is encrypted.
+func isEncrypted(head []byte) bool {
+	return bytes.HasPrefix(head, ageHeader) || bytes.HasPrefix(head, ageArmoredHeader)
+}
+
+// decrypt returns a reader of the plaintext of r, or r itself
+// if it isn't encrypted.
+func decrypt(r *bufio.Reader, decrypter Decrypter) (*bufio.Reader, error) {
+	head, err := r.Peek(len(ageArmoredHeader))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !isEncrypted(head) {
+		return r, nil
+	}
+	if decrypter == nil {
+		return nil, ErrNoDecrypter
+	}
+	plain, err := decrypter.Decrypt(r)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(plain), nil
+}
@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// xorDecrypter "decrypts" bodies that are the age header
+// followed by the plaintext xor'ed with key.
+type xorDecrypter struct {
+	key   byte
+	calls int
+}
+
+func (d *xorDecrypter) Decrypt(ciphertext io.Reader) (io.Reader, error) {
+	d.calls++
+	b, err := ioutil.ReadAll(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimPrefix(b, ageHeader)
+	for i := range b {
+		b[i] ^= d.key
+	}
+	return bytes.NewReader(b), nil
+}
+
+func xorEncrypt(plain string, key byte) []byte {
+	b := append([]byte{}, ageHeader...)
+	for i := 0; i < len(plain); i++ {
+		b = append(b, plain[i]^key)
+	}
+	return b
+}
+
+func TestDecodingReaderDecrypt(t *testing.T) {
+	const sql = "INSERT INTO secrets VALUES ('s3cr3t');"
+	tt := []struct {
+		name      string
+		body      []byte
+		decrypter *xorDecrypter
+		calls     int
+		expectErr error
+	}{
+		{"encrypted", xorEncrypt(sql, 0x5A), &xorDecrypter{key: 0x5A}, 1, nil},
+		{"plain", []byte(sql), &xorDecrypter{key: 0x5A}, 0, nil},
+		{"no decrypter", xorEncrypt(sql, 0x5A), nil, 0, ErrNoDecrypter},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var decrypter Decrypter
+			if tc.decrypter != nil {
+				decrypter = tc.decrypter
+			}
+			r, err := newDecodingReader(ioutil.NopCloser(bytes.NewReader(tc.body)), "", decrypter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != tc.expectErr {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if string(got) != sql {
+				t.Errorf("expected %q, got %q", sql, got)
+			}
+			if tc.decrypter.calls != tc.calls {
+				t.Errorf("expected %v Decrypt calls, got %v", tc.calls, tc.decrypter.calls)
+			}
+		})
+	}
+}
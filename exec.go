@@ -0,0 +1,110 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// ErrExecNotAllowed is returned when running a migration with the `exec`
+// pragma while Migrate.AllowExec isn't set.
+var ErrExecNotAllowed = errors.New("migration runs a command, but exec migrations aren't allowed")
+
+// Environment variables passed to the commands of exec migrations,
+// in addition to the environment of the migrate process.
+const (
+	EnvDatabaseURL   = "MIGRATE_DATABASE_URL"
+	EnvVersion       = "MIGRATE_VERSION"
+	EnvTargetVersion = "MIGRATE_TARGET_VERSION"
+	EnvDirection     = "MIGRATE_DIRECTION"
+)
+
+// exec runs a migration with the `exec` pragma as a subprocess.
+// With a command, e.g. `-- migrate:exec gh-ost --execute ...`, the command
+// is run by sh and gets the migration body on stdin. Without, the body itself
+// is the script: run directly if it starts with a shebang, else by sh.
+// The output of the subprocess is logged line by line.
+func (m *Migrate) exec(migr *Migration, command string, body io.Reader) error {
+	var cmd *exec.Cmd
+	if command != "" {
+		cmd = exec.Command("sh", "-c", command)
+		cmd.Stdin = body
+	} else {
+		script, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		f, err := ioutil.TempFile("", "migrate-exec")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.Write(script); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if bytes.HasPrefix(script, []byte("#!")) {
+			if err := os.Chmod(f.Name(), 0700); err != nil {
+				return err
+			}
+			cmd = exec.Command(f.Name())
+		} else {
+			cmd = exec.Command("sh", f.Name())
+		}
+	}
+
+	direction := "up"
+	if migr.down() {
+		direction = "down"
+	}
+	cmd.Env = append(os.Environ(),
+		EnvDatabaseURL+"="+m.DatabaseURL,
+		EnvVersion+"="+strconv.FormatUint(uint64(migr.Version), 10),
+		EnvTargetVersion+"="+strconv.Itoa(migr.TargetVersion),
+		EnvDirection+"="+direction,
+	)
+
+	output := &logWriter{m: m}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+	output.flush()
+	if err != nil {
+		return fmt.Errorf("exec %v: %v", migr.LogString(), err)
+	}
+	return nil
+}
+
+// logWriter logs what is written to it line by line.
+type logWriter struct {
+	m    *Migrate
+	line bytes.Buffer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.line.Write(p)
+	for {
+		i := bytes.IndexByte(w.line.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := w.line.Next(i + 1)
+		w.m.logPrintf("%s", line)
+	}
+}
+
+// flush logs an incomplete last line.
+func (w *logWriter) flush() {
+	if w.line.Len() > 0 {
+		w.m.logPrintf("%s\n", w.line.Bytes())
+		w.line.Reset()
+	}
+}
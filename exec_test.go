@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestExecMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up,
+		Identifier: "#!/bin/sh\n# migrate:exec\necho \"$MIGRATE_VERSION $MIGRATE_DIRECTION $MIGRATE_DATABASE_URL\" >> " + out})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down,
+		Identifier: "# migrate:exec cat >> " + out + "\nstdin"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "# migrate:exec\nexit 3"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(2); err != ErrExecNotAllowed {
+		t.Fatalf("expected ErrExecNotAllowed, got %v", err)
+	}
+	if v, dirty, _ := m.Version(); v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v, %v", v, dirty)
+	}
+
+	m.AllowExec = true
+	m.DatabaseURL = "stub://db"
+	m.AtomicBatch = true
+	if err := m.Steps(1); err != ErrExecAtomicBatch {
+		t.Fatalf("expected ErrExecAtomicBatch, got %v", err)
+	}
+	if v, dirty, _ := m.Version(); v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v, %v", v, dirty)
+	}
+	m.AtomicBatch = false
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+	// the exec migrations don't reach the database
+	equalDbSeq(t, 0, migrationSequence{mr("CREATE 1")}, dbDrv.(*dStub.Stub))
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "2 up stub://db\n# migrate:exec cat >> " + out + "\nstdin"
+	if string(b) != expected {
+		t.Errorf("expected output %q, got %q", expected, b)
+	}
+
+	// a failing command leaves the database dirty
+	if err := m.Steps(2); err == nil {
+		t.Fatal("expected error for failing command")
+	}
+	if v, dirty, _ := m.Version(); v != 3 || !dirty {
+		t.Errorf("expected dirty version 3, got %v, %v", v, dirty)
+	}
+}
@@ -0,0 +1,181 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/hashicorp/go-multierror"
+)
+
+// DefaultFixturesDir is the directory holding the fixture sets, see LoadFixtures.
+const DefaultFixturesDir = "fixtures"
+
+// fixtureOrder is the optional prefix of fixture files ordering them, e.g. 01_users.csv
+var fixtureOrder = regexp.MustCompile(`^[0-9]+_`)
+
+// fixture is a file of a fixture set
+type fixture struct {
+	path   string
+	table  string
+	format string
+}
+
+// LoadFixtures loads the fixture set named set, the directory set within dir,
+// e.g. fixtures/minimal, into the migrated database. The set holds a file per
+// table, TABLE.csv or TABLE.jsonl (see the `load` pragma), whose rows replace
+// the rows of the table, and optionally SQL files, which are run as they are.
+// Files are loaded in order of their names, which may have a numeric prefix
+// for that purpose, e.g. 01_users.csv and 02_orders.csv. Tables are emptied
+// in reverse order, so referencing tables go after the tables they reference.
+// With a transactional database driver, the set is loaded in one transaction.
+// With Plan, the statements are written instead, see Plan.
+func (m *Migrate) LoadFixtures(dir, set string) (err error) {
+	// a plan changes nothing
+	if m.Plan == nil {
+		defer m.audit("fixtures", set, time.Now(), &err)
+	}
+
+	if _, ok := m.databaseDrv.(database.Querier); !ok {
+		return ErrQueryUnsupported
+	}
+	if _, ok := m.databaseDrv.(database.Loader); !ok {
+		return ErrLoadUnsupported
+	}
+	fixtures, err := readFixtures(filepath.Join(dir, set))
+	if err != nil {
+		return err
+	}
+	if m.Plan != nil {
+		return writeFixturesPlan(m.Plan, fixtures)
+	}
+
+	if err := m.lock(); err != nil {
+		return err
+	}
+	curVersion, dirty, err := m.state().Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if dirty {
+		return m.unlockErr(ErrDirty{curVersion})
+	}
+
+	tx, transactional := m.databaseDrv.(database.Transactional)
+	if transactional {
+		if err := tx.Begin(); err != nil {
+			return m.unlockErr(err)
+		}
+	}
+	if err := m.loadFixtures(fixtures); err != nil {
+		if transactional {
+			if errRollback := tx.Rollback(); errRollback != nil {
+				err = multierror.Append(err, errRollback)
+			}
+		}
+		return m.unlockErr(err)
+	}
+	if transactional {
+		if err := tx.Commit(); err != nil {
+			return m.unlockErr(err)
+		}
+	}
+	return m.unlock()
+}
+
+func (m *Migrate) loadFixtures(fixtures []fixture) error {
+	querier := m.databaseDrv.(database.Querier)
+	for i := len(fixtures) - 1; i >= 0; i-- {
+		if fixtures[i].table == "" {
+			continue
+		}
+		if _, err := querier.Exec("DELETE FROM " + fixtures[i].table); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fixtures {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		if f.table == "" {
+			m.logVerbosePrintf("Run %v\n", f.path)
+			err = m.databaseDrv.Run(file)
+		} else {
+			err = m.loadTable(f.path, f.table, f.format, file)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFixturesPlan writes the statements loading fixtures would run to
+// w, see Plan. The rows of tables are described by a comment.
+func writeFixturesPlan(w io.Writer, fixtures []fixture) error {
+	for i := len(fixtures) - 1; i >= 0; i-- {
+		if fixtures[i].table == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "DELETE FROM %v;\n", fixtures[i].table); err != nil {
+			return err
+		}
+	}
+	for _, f := range fixtures {
+		if f.table != "" {
+			if _, err := fmt.Fprintf(w, "-- loads data into %v, only inserts rows\n", f.table); err != nil {
+				return err
+			}
+			continue
+		}
+		body, err := ioutil.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFixtures returns the fixtures in directory set in order of their names.
+// SQL files have no table.
+func readFixtures(set string) ([]fixture, error) {
+	files, err := ioutil.ReadDir(set)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("fixture set %v doesn't exist", set)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fixtures := make([]fixture, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(file.Name())
+		f := fixture{path: filepath.Join(set, file.Name()), format: strings.TrimPrefix(ext, ".")}
+		switch f.format {
+		case "csv", "jsonl":
+			f.table = fixtureOrder.ReplaceAllString(strings.TrimSuffix(file.Name(), ext), "")
+		case "sql":
+		default:
+			continue
+		}
+		fixtures = append(fixtures, f)
+	}
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("fixture set %v has no CSV, JSON lines or SQL files", set)
+	}
+	return fixtures, nil
+}
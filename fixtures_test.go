@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+)
+
+// fixtureStub is a stub database implementing database.Querier and database.Loader
+type fixtureStub struct {
+	*dStub.Stub
+}
+
+func (f *fixtureStub) Query(query string, args ...interface{}) ([]database.Row, error) {
+	return (&queryStub{f.Stub}).Query(query, args...)
+}
+
+func (f *fixtureStub) Exec(query string, args ...interface{}) (int64, error) {
+	return (&queryStub{f.Stub}).Exec(query, args...)
+}
+
+func (f *fixtureStub) Load(table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	return (&loadStub{f.Stub}).Load(table, columns, next)
+}
+
+func TestLoadFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "minimal"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"01_users.csv":    "id,name\n1,ann\n",
+		"02_orders.jsonl": "{\"id\": 7, \"user_id\": 1}\n",
+		"03_counts.sql":   "UPDATE 3",
+		"README.md":       "not a fixture",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, "minimal", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, _ := New("stub://", "stub://")
+	if err := m.LoadFixtures(dir, "minimal"); err != ErrQueryUnsupported {
+		t.Fatalf("expected ErrQueryUnsupported, got %v", err)
+	}
+
+	db := &fixtureStub{Stub: m.databaseDrv.(*dStub.Stub)}
+	m.databaseDrv = db
+	if err := m.LoadFixtures(dir, "full"); err == nil {
+		t.Fatal("expected error for missing fixture set")
+	}
+	if err := m.LoadFixtures(dir, "minimal"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"DELETE FROM orders",
+		"DELETE FROM users",
+		"users[id name] [1 ann]",
+		"orders[id user_id] [7 1]",
+		"UPDATE 3",
+	}
+	if !reflect.DeepEqual(db.MigrationSequence, expected) {
+		t.Errorf("expected %q, got %q", expected, db.MigrationSequence)
+	}
+
+	var plan bytes.Buffer
+	m.Plan = &plan
+	if err := m.LoadFixtures(dir, "minimal"); err != nil {
+		t.Fatal(err)
+	}
+	m.Plan = nil
+	expectedPlan := "DELETE FROM orders;\nDELETE FROM users;\n" +
+		"-- loads data into users, only inserts rows\n-- loads data into orders, only inserts rows\nUPDATE 3\n"
+	if plan.String() != expectedPlan {
+		t.Errorf("expected plan %q, got %q", expectedPlan, plan.String())
+	}
+	if len(db.MigrationSequence) != len(expected) {
+		t.Errorf("expected nothing run by the plan, got %q", db.MigrationSequence)
+	}
+
+	if err := db.SetVersion(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LoadFixtures(dir, "minimal"); err != (ErrDirty{1}) {
+		t.Errorf("expected ErrDirty, got %v", err)
+	}
+}
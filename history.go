@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// History returns the migrations recorded in HistoryTable, in the order
+// they were applied. The database driver must implement database.Querier.
+func (m *Migrate) History() ([]database.HistoryRecord, error) {
+	return m.historyTable().List()
+}
+
+// recordHistory records the applied migr in HistoryTable, if it is set.
+func (m *Migrate) recordHistory(migr *Migration, duration time.Duration) error {
+	if m.HistoryTable == "" {
+		return nil
+	}
+	direction := source.Up
+	if migr.TargetVersion != int(migr.Version) && !migr.late {
+		direction = source.Down
+	}
+	checksum, err := m.ranChecksum(migr, direction)
+	if err != nil {
+		return err
+	}
+	return m.record(migr, string(direction), checksum, duration)
+}
+
+// recordSkipped records migr, which was skipped as its tags aren't
+// selected, in HistoryTable, if it is set. See ApplySkipped.
+func (m *Migrate) recordSkipped(migr *Migration) error {
+	if m.HistoryTable == "" {
+		return nil
+	}
+	direction := source.Up
+	if migr.TargetVersion != int(migr.Version) {
+		direction = source.Down
+	}
+	checksum, err := m.checksum(migr.Version, direction)
+	if err != nil {
+		return err
+	}
+	return m.record(migr, database.HistorySkip, checksum, 0)
+}
+
+func (m *Migrate) record(migr *Migration, direction string, checksum string, duration time.Duration) error {
+	info := database.NewLockInfo()
+	return m.historyTable().Record(database.HistoryRecord{
+		Version:    migr.Version,
+		Direction:  direction,
+		Identifier: migr.Identifier,
+		Checksum:   checksum,
+		User:       info.User,
+		Hostname:   info.Hostname,
+		Applied:    time.Now(),
+		Duration:   duration,
+	})
+}
+
+// ranChecksum returns the checksum of the body of migr which ran, or that
+// of the migration file if migr wasn't read from the source.
+func (m *Migrate) ranChecksum(migr *Migration, direction source.Direction) (string, error) {
+	if migr.checksum != nil {
+		return migr.checksum(), nil
+	}
+	return m.checksum(migr.Version, direction)
+}
+
+// checksum returns the checksum of the migration file of version in
+// direction, see source.Describe, or "" if there is none.
+func (m *Migrate) checksum(version uint, direction source.Direction) (string, error) {
+	meta, err := source.Describe(m.sourceDrv, version, direction)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return meta.Checksum, nil
+}
+
+// createHistoryTable creates HistoryTable, if it is set, before a run
+// records migrations in it.
+func (m *Migrate) createHistoryTable() error {
+	if m.HistoryTable == "" {
+		return nil
+	}
+	return m.historyTable().Create()
+}
+
+func (m *Migrate) historyTable() *database.HistoryTable {
+	table := m.HistoryTable
+	if table == "" {
+		table = database.DefaultHistoryTable
+	}
+	return &database.HistoryTable{Driver: m.stateDriver(), Table: table}
+}
+
+// checksumReader is a migration body read from the source, whose checksum
+// is computed while it is read, see source.Checksum. The history records
+// the checksum of the body which ran, rather than reading it again.
+type checksumReader struct {
+	io.ReadCloser
+	h hash.Hash
+}
+
+func newChecksumReader(r io.ReadCloser) *checksumReader {
+	return &checksumReader{ReadCloser: r, h: sha256.New()}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.h.Write(p[:n])
+	return n, err
+}
+
+// Checksum returns the checksum of the body read so far, all of it once
+// the migration ran.
+func (r *checksumReader) Checksum() string {
+	return hex.EncodeToString(r.h.Sum(nil))
+}
@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+// rewrittenSource is a stub source whose migrations change once they were
+// read, like files edited during a run
+type rewrittenSource struct {
+	*sStub.Stub
+	read map[uint]bool
+}
+
+func (s *rewrittenSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	r, identifier, err := s.Stub.ReadUp(version)
+	if err != nil || !s.read[version] {
+		s.read[version] = true
+		return r, identifier, err
+	}
+	r.Close()
+	return ioutil.NopCloser(strings.NewReader("CHANGED")), identifier, nil
+}
+
+func TestRecordHistoryChecksum(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+	db := &failStub{Stub: dbDrv.(*dStub.Stub)}
+
+	m, err := NewWithInstance("stub", &rewrittenSource{Stub: srcDrv.(*sStub.Stub), read: make(map[uint]bool)}, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.HistoryTable = database.DefaultHistoryTable
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the checksum is the one of the body which ran, not of the changed file
+	var recorded bool
+	for _, query := range db.history {
+		if strings.Contains(query, manifest.Checksum([]byte("CHANGED"))) {
+			t.Fatalf("expected the checksum of the body which ran, got %v", query)
+		}
+		recorded = recorded || strings.Contains(query, manifest.Checksum([]byte("CREATE 1")))
+	}
+	if !recorded {
+		t.Errorf("expected the checksum of CREATE 1 recorded, got %v", db.history)
+	}
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// apiError is the body of a failed API request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// statusRecorder records the status of a response for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// api returns the handler of the REST API of the serve command:
+//
+//	GET  /api/v1/status    the version, whether it is dirty and the pending migrations
+//	GET  /api/v1/plan?n=N  the SQL up would run, see migrate.Migrate.Plan
+//	POST /api/v1/up?n=N    apply all or N pending migrations, returning the summary of the run
+//
+// Clients authenticate with the token as bearer token or, with -client-ca,
+// a verified client certificate. Every request is logged with its client.
+// Requests fail with 409 Conflict while a run is in progress.
+func (s *server) api() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/status", s.apiMethod(http.MethodGet, s.apiStatus))
+	mux.HandleFunc("/api/v1/plan", s.apiMethod(http.MethodGet, s.apiPlan))
+	mux.HandleFunc("/api/v1/up", s.apiMethod(http.MethodPost, s.apiUp))
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPI(w, http.StatusNotFound, apiError{Error: "not found"})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := s.apiClient(r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			log.Printf("api: %v %v %v by %v from %v\n", r.Method, r.URL.RequestURI(), rec.status, client, r.RemoteAddr)
+		}()
+		switch {
+		case ok:
+		case s.token == "" && !s.certAuth:
+			writeAPI(rec, http.StatusForbidden, apiError{Error: "the API is disabled, set $" + serveTokenEnv + " or -client-ca"})
+			return
+		default:
+			rec.Header().Set("WWW-Authenticate", `Bearer realm="migrate"`)
+			writeAPI(rec, http.StatusUnauthorized, apiError{Error: "unauthorized"})
+			return
+		}
+		mux.ServeHTTP(rec, r)
+	})
+}
+
+// apiClient authenticates the client of r, and names it for the log
+func (s *server) apiClient(r *http.Request) (string, bool) {
+	if s.certAuth && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return "certificate " + r.TLS.PeerCertificates[0].Subject.CommonName, true
+	}
+	auth := r.Header.Get("Authorization")
+	if s.token != "" && strings.HasPrefix(auth, "Bearer ") &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.token)) == 1 {
+		return "token", true
+	}
+	return "anonymous", false
+}
+
+// apiMethod allows only method for handle, which may use m
+func (s *server) apiMethod(method string, handle http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeAPI(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+			return
+		}
+		if method == http.MethodPost {
+			if !s.tryRun() {
+				writeAPI(w, http.StatusConflict, apiError{Error: "a run is already in progress"})
+				return
+			}
+			defer s.endRun()
+		} else if atomic.LoadInt32(&s.running) == 1 {
+			writeAPI(w, http.StatusConflict, apiError{Error: "a run is in progress"})
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handle(w, r)
+	}
+}
+
+func (s *server) apiStatus(w http.ResponseWriter, r *http.Request) {
+	state, err := newSchemaState(s.m, 0)
+	if err != nil {
+		writeAPI(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	writeAPI(w, http.StatusOK, state)
+}
+
+func (s *server) apiPlan(w http.ResponseWriter, r *http.Request) {
+	up, err := apiUpRun(s.m, r)
+	if err != nil {
+		writeAPI(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	var plan bytes.Buffer
+	s.m.Plan = &plan
+	err = up()
+	s.m.Plan = nil
+	if err != nil && err != migrate.ErrNoChange {
+		writeAPI(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write(plan.Bytes()); err != nil {
+		log.Println("error:", err)
+	}
+}
+
+func (s *server) apiUp(w http.ResponseWriter, r *http.Request) {
+	up, err := apiUpRun(s.m, r)
+	if err != nil {
+		writeAPI(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	blocked, err := s.guards.blocked(s.m, up)
+	if err != nil {
+		writeAPI(w, http.StatusForbidden, apiError{
+			Error: "the statements can't be checked against the guard rules: " + err.Error(),
+		})
+		return
+	}
+	if len(blocked) > 0 {
+		writeAPI(w, http.StatusForbidden, apiError{
+			Error: "blocked on this database by guard rules: " + strings.Join(blocked, "; "),
+		})
+		return
+	}
+
+	// the audit records the client of the run
+	client, _ := s.apiClient(r)
+	auditClient := s.m.AuditClient
+	s.m.AuditClient = strings.TrimSpace(auditClient + " API " + client)
+	err = up()
+	s.m.AuditClient = auditClient
+
+	status := http.StatusOK
+	if err != nil && err != migrate.ErrNoChange {
+		status = http.StatusInternalServerError
+	}
+	writeAPI(w, status, newRunReport(s.m, err))
+}
+
+// apiUpRun returns the run of up with the optional limit n of r
+func apiUpRun(m *migrate.Migrate, r *http.Request) (func() error, error) {
+	n := r.URL.Query().Get("n")
+	if n == "" {
+		return m.Up, nil
+	}
+	limit, err := strconv.ParseUint(n, 10, 31)
+	if err != nil {
+		return nil, fmt.Errorf("n: %v", err)
+	}
+	return func() error {
+		return m.Steps(int(limit))
+	}, nil
+}
+
+// writeAPI writes v as JSON response with status
+func writeAPI(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("error:", err)
+	}
+}
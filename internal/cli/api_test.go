@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	s, closeServer := newTestServer(t)
+	defer closeServer()
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+	do := func(method, path, token string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	// without token or client CA, the API is disabled
+	if code, body := do("GET", "/api/v1/status", ""); code != http.StatusForbidden {
+		t.Errorf("expected 403, got %v: %v", code, body)
+	}
+
+	s.token = "secret"
+	for _, token := range []string{"", "wrong"} {
+		if code, _ := do("GET", "/api/v1/status", token); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 with token %q, got %v", token, code)
+		}
+	}
+	cases := []struct {
+		method   string
+		path     string
+		code     int
+		expected string
+	}{
+		{"GET", "/api/v1/status", http.StatusOK, `{"version":null,"dirty":false,"pending":[1,2],"ok":false}`},
+		{"GET", "/api/v1/plan?n=1", http.StatusOK, "CREATE 1"},
+		{"GET", "/api/v1/plan?n=-1", http.StatusBadRequest, `"error":"n: `},
+		{"GET", "/api/v1/up", http.StatusMethodNotAllowed, "method not allowed"},
+		{"GET", "/api/v1/down", http.StatusNotFound, "not found"},
+		{"POST", "/api/v1/up", http.StatusOK, `"applied":[{"version":1,"direction":"up","identifier":"init"`},
+		{"GET", "/api/v1/status", http.StatusOK, `{"version":2,"dirty":false,"pending":[],"ok":true}`},
+		{"GET", "/api/v1/plan", http.StatusOK, ""},
+		{"POST", "/api/v1/up", http.StatusOK, `"error":"no change"`},
+	}
+	for _, c := range cases {
+		code, body := do(c.method, c.path, "secret")
+		if code != c.code || !strings.Contains(body, c.expected) {
+			t.Errorf("%v %v: expected %v with %q, got %v: %v", c.method, c.path, c.code, c.expected, code, body)
+		}
+	}
+	var report runReport
+	if _, body := do("POST", "/api/v1/up", "secret"); json.Unmarshal([]byte(body), &report) != nil ||
+		report.Version == nil || *report.Version != 2 {
+		t.Errorf("expected a report of version 2, got %v", body)
+	}
+
+	// a run is in progress
+	s.running = 1
+	for _, method := range []string{"GET", "POST"} {
+		path := map[string]string{"GET": "/api/v1/status", "POST": "/api/v1/up"}[method]
+		if code, _ := do(method, path, "secret"); code != http.StatusConflict {
+			t.Errorf("expected 409 for %v %v during a run, got %v", method, path, code)
+		}
+	}
+}
+
+func TestAPIClient(t *testing.T) {
+	s := &server{token: "secret"}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "deployer"}}
+	verified := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	cases := []struct {
+		name     string
+		certAuth bool
+		tls      *tls.ConnectionState
+		auth     string
+		client   string
+		ok       bool
+	}{
+		{"token", false, nil, "Bearer secret", "token", true},
+		{"wrong token", false, nil, "Bearer secrets", "anonymous", false},
+		{"basic", false, nil, "Basic secret", "anonymous", false},
+		{"certificate", true, verified, "", "certificate deployer", true},
+		{"certificate without client CA", false, verified, "", "anonymous", false},
+		{"unverified certificate", true, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, "", "anonymous", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s.certAuth = c.certAuth
+			r := httptest.NewRequest("GET", "/api/v1/status", nil)
+			r.TLS = c.tls
+			if c.auth != "" {
+				r.Header.Set("Authorization", c.auth)
+			}
+			if client, ok := s.apiClient(r); client != c.client || ok != c.ok {
+				t.Errorf("expected %v, %v, got %v, %v", c.client, c.ok, client, ok)
+			}
+		})
+	}
+}
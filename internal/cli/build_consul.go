@@ -0,0 +1,7 @@
+// +build consul
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/state/consul"
+)
@@ -0,0 +1,8 @@
+// +build dynamodb
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/lock/dynamodb"
+	_ "github.com/golang-migrate/migrate/v4/state/dynamodb"
+)
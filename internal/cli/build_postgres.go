@@ -4,4 +4,5 @@ package cli
 
 import (
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/state/postgres"
 )
@@ -0,0 +1,7 @@
+// +build redis
+
+package cli
+
+import (
+	_ "github.com/golang-migrate/migrate/v4/lock/redis"
+)
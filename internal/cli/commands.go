@@ -1,16 +1,34 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	_ "github.com/golang-migrate/migrate/v4/database/stub" // TODO remove again
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/approval"
+	"github.com/golang-migrate/migrate/v4/source/bundle"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/graph"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	nurl "net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 func nextSeq(matches []string, dir string, seqDigits int) (string, error) {
@@ -49,6 +67,141 @@ func nextSeq(matches []string, dir string, seqDigits int) (string, error) {
 	return nextSeqStr, nil
 }
 
+// semverRelease matches the release given to create -semver
+var semverRelease = regexp.MustCompile(`^v?([0-9]+)\.([0-9]+)\.([0-9]+)$`)
+
+// nextSemver returns the prefix of the next migration of release, e.g.
+// v1.4.2_003 if the migrations of v1.4.2 in matches end at index 2.
+func nextSemver(matches []string, release string) (string, error) {
+	m := semverRelease.FindStringSubmatch(release)
+	if m == nil {
+		return "", fmt.Errorf("Malformed release %v, expected e.g. v1.4.2", release)
+	}
+	parts := make([]uint64, 3)
+	for i := range parts {
+		n, err := strconv.ParseUint(m[i+1], 10, 64)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = n
+	}
+	release = fmt.Sprintf("v%v.%v.%v", parts[0], parts[1], parts[2])
+
+	var index uint64
+	for _, match := range matches {
+		sm := source.SemverRegex.FindStringSubmatch(filepath.Base(match))
+		if sm == nil || fmt.Sprintf("v%v.%v.%v", trimZeros(sm[1]), trimZeros(sm[2]), trimZeros(sm[3])) != release {
+			continue
+		}
+		n, err := strconv.ParseUint(sm[4], 10, 64)
+		if err != nil {
+			return "", err
+		}
+		if n > index {
+			index = n
+		}
+	}
+	index++
+	if _, err := source.SemverVersion(parts[0], parts[1], parts[2], index); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v_%03d", release, index), nil
+}
+
+// trimZeros removes the leading zeros of a number
+func trimZeros(n string) string {
+	if t := strings.TrimLeft(n, "0"); t != "" {
+		return t
+	}
+	return "0"
+}
+
+// namingConvention is how the versions of migrations are generated
+type namingConvention struct {
+	seq       bool
+	seqDigits int
+	format    string
+}
+
+// detectNaming returns the naming convention of the migrations in dir with
+// extension ext, which are either all sequential with the same width or all
+// timestamps. Without migrations, the default convention is returned.
+func detectNaming(dir string, ext string, defaults namingConvention) (namingConvention, error) {
+	matches, err := filepath.Glob(dir + "*" + ext)
+	if err != nil {
+		return defaults, err
+	}
+	versions := make([]string, 0, len(matches))
+	for _, match := range matches {
+		name := filepath.Base(match)
+		if idx := strings.Index(name, "_"); idx > 0 {
+			if _, err := strconv.ParseUint(name[:idx], 10, 64); err == nil {
+				versions = append(versions, name[:idx])
+			}
+		}
+	}
+	return detectConvention(versions, defaults)
+}
+
+// detectConvention returns the naming convention of versions
+func detectConvention(versions []string, defaults namingConvention) (namingConvention, error) {
+	if len(versions) == 0 {
+		return defaults, nil
+	}
+
+	formats := make(map[string]bool)
+	padded := make(map[int]bool)
+	unpadded := make(map[int]bool)
+	var max uint64
+	for _, v := range versions {
+		switch {
+		case len(v) == len(defaultTimeFormat) && isTime(v, defaultTimeFormat):
+			formats[defaultTimeFormat] = true
+		case len(v) == 10 && v[0] != '0' && v >= "1000000000":
+			formats["unix"] = true
+		case len(v) == 19 && v[0] != '0':
+			formats["unixNano"] = true
+		case len(v) > 1 && v[0] == '0':
+			padded[len(v)] = true
+		default:
+			unpadded[len(v)] = true
+			if n, _ := strconv.ParseUint(v, 10, 64); n > max {
+				max = n
+			}
+		}
+	}
+
+	ambiguous := errors.New("Can't detect the naming convention of mixed versions, use -seq, -digits or -format")
+	switch {
+	case len(formats) > 0:
+		if len(formats) > 1 || len(padded) > 0 || len(unpadded) > 0 {
+			return defaults, ambiguous
+		}
+		for format := range formats {
+			return namingConvention{format: format, seqDigits: defaults.seqDigits}, nil
+		}
+	case len(padded) > 1:
+		return defaults, ambiguous
+	case len(padded) == 1:
+		for digits := range padded {
+			// versions without leading zeros of the same width are fine
+			for width := range unpadded {
+				if width != digits {
+					return defaults, ambiguous
+				}
+			}
+			return namingConvention{seq: true, seqDigits: digits, format: defaultTimeFormat}, nil
+		}
+	}
+	// sequence without padding, use as many digits as the next version needs
+	return namingConvention{seq: true, seqDigits: len(strconv.FormatUint(max+1, 10)), format: defaultTimeFormat}, nil
+}
+
+func isTime(v string, format string) bool {
+	_, err := time.Parse(format, v)
+	return err == nil
+}
+
 // cleanDir normalizes the provided directory
 func cleanDir(dir string) string {
 	dir = filepath.Clean(dir)
@@ -62,14 +215,174 @@ func cleanDir(dir string) string {
 	}
 }
 
+// normalizeName turns the name of a migration into a slug which is safe
+// to use in file names and shells: whitespace becomes underscores and
+// all characters other than letters, digits, '_' and '-' are stripped
+func normalizeName(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case unicode.IsSpace(r) || r == '_':
+			underscore = true
+			continue
+		case r == '-' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		default:
+			continue
+		}
+		if underscore && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		underscore = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// checkName returns an error if a migration titled name already exists in dir
+func checkName(dir string, name string) error {
+	matches, err := filepath.Glob(dir + "*_" + name + ".*")
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		m, err := source.Parse(filepath.Base(match))
+		if err == nil && m.Identifier == name {
+			return fmt.Errorf("Migration %v already exists: %v", name, match)
+		}
+	}
+	return nil
+}
+
+// filePolicy controls which files of a migration pair are created
+type filePolicy struct {
+	up   bool
+	down bool
+	// requireDown refuses to create a migration with an empty down body
+	requireDown bool
+	// downTemplate is written into the down migration
+	downTemplate []byte
+}
+
+func (p filePolicy) validate() error {
+	if !p.up && !p.down {
+		return errors.New("The up-only and down-only options are mutually exclusive")
+	}
+	if p.requireDown && !p.down {
+		return errors.New("The up-only and require-down options are mutually exclusive")
+	}
+	return nil
+}
+
+// createFiles creates the migration files base+"up"+ext and base+"down"+ext
+// according to policy and passes them to edit, if set. All files are removed
+// again if the policy is violated.
+func createFiles(base string, ext string, policy filePolicy, edit func(files []string) error) ([]string, error) {
+	var files []string
+	remove := func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+
+	if policy.up {
+		fname := base + "up" + ext
+		if err := ioutil.WriteFile(fname, nil, 0666); err != nil {
+			return nil, err
+		}
+		files = append(files, fname)
+	}
+	if policy.down {
+		fname := base + "down" + ext
+		if err := ioutil.WriteFile(fname, policy.downTemplate, 0666); err != nil {
+			remove()
+			return nil, err
+		}
+		files = append(files, fname)
+	}
+
+	if edit != nil {
+		if err := edit(files); err != nil {
+			return files, err
+		}
+	}
+
+	if policy.requireDown {
+		body, err := ioutil.ReadFile(base + "down" + ext)
+		if err != nil {
+			remove()
+			return nil, err
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			remove()
+			return nil, errors.New("The down migration must not be empty, use -down-template to provide its body")
+		}
+	}
+	return files, nil
+}
+
+// editor returns the command line of the editor to open created migrations
+// with: the named editor, $VISUAL, $EDITOR or vi
+func editor(name string) []string {
+	for _, e := range []string{name, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if args := strings.Fields(e); len(args) > 0 {
+			return args
+		}
+	}
+	return []string{"vi"}
+}
+
+// editFiles opens files in the editor and waits until it is closed
+func editFiles(editor []string) func(files []string) error {
+	return func(files []string) error {
+		cmd := exec.Command(editor[0], append(editor[1:], files...)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+}
+
 // createCmd (meant to be called via a CLI command) creates a new migration
-func createCmd(dir string, startTime time.Time, format string, name string, ext string, seq bool, seqDigits int) {
+func createCmd(dir string, startTime time.Time, format string, name string, ext string, seq bool, seqDigits int, semver string, ulid bool, maxLength int, policy filePolicy, edit func(files []string) error) {
 	dir = cleanDir(dir)
+	name = normalizeName(name)
+	if name == "" {
+		log.fatalErr(errors.New("Name must contain letters or digits"))
+	}
+	if err := checkName(dir, name); err != nil {
+		log.fatalErr(err)
+	}
 	var base string
 	if seq && format != defaultTimeFormat {
 		log.fatalErr(errors.New("The seq and format options are mutually exclusive"))
 	}
-	if seq {
+	if semver != "" && (seq || format != defaultTimeFormat) {
+		log.fatalErr(errors.New("The semver option excludes the seq and format options"))
+	}
+	if ulid && (seq || format != defaultTimeFormat || semver != "") {
+		log.fatalErr(errors.New("The ulid option excludes the seq, format and semver options"))
+	}
+	if err := policy.validate(); err != nil {
+		log.fatalErr(err)
+	}
+	if ulid {
+		id, err := source.NewULID(startTime, rand.Reader)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		base = fmt.Sprintf("%v%v_%v.", dir, id, name)
+	} else if semver != "" {
+		matches, err := filepath.Glob(dir + "v*" + ext)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		prefix, err := nextSemver(matches, semver)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		base = fmt.Sprintf("%v%v_%v.", dir, prefix, name)
+	} else if seq {
 		if seqDigits <= 0 {
 			log.fatalErr(errors.New("Digits must be positive"))
 		}
@@ -95,92 +408,693 @@ func createCmd(dir string, startTime time.Time, format string, name string, ext
 		}
 	}
 
+	// the down migration has the longest file name
+	if fname := strings.TrimPrefix(base, dir) + "down" + ext; maxLength > 0 && len(fname) > maxLength {
+		log.fatalErr(fmt.Errorf("File name %v is longer than %v characters", fname, maxLength))
+	}
+
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		log.fatalErr(err)
 	}
 
-	createFile(base + "up" + ext)
-	createFile(base + "down" + ext)
+	if _, err := createFiles(base, ext, policy, edit); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+func gotoCmd(m *migrate.Migrate, v uint, format string) {
+	runCmd(m, format, func() error {
+		return m.Migrate(v)
+	})
+}
+
+func upCmd(m *migrate.Migrate, limit int, format string) {
+	runCmd(m, format, func() error {
+		if limit >= 0 {
+			return m.Steps(limit)
+		}
+		return m.Up()
+	})
+}
+
+// applySkippedCmd applies the migrations skipped by an earlier -tags,
+// see migrate.Migrate.ApplySkipped.
+func applySkippedCmd(m *migrate.Migrate, format string) {
+	runCmd(m, format, m.ApplySkipped)
+}
+
+func downCmd(m *migrate.Migrate, limit int, format string) {
+	runCmd(m, format, func() error {
+		if limit >= 0 {
+			return m.Steps(-limit)
+		}
+		return m.Down()
+	})
+}
+
+func dropCmd(m *migrate.Migrate) {
+	if err := m.Drop(); err != nil {
+		log.fatalErr(err)
+	}
 }
 
-func createFile(fname string) {
-	if _, err := os.Create(fname); err != nil {
+func freshCmd(m *migrate.Migrate) {
+	started := time.Now()
+	applied := 0
+	onApplied := m.OnApplied
+	m.OnApplied = func(migr *migrate.Migration) {
+		applied++
+		if onApplied != nil {
+			onApplied(migr)
+		}
+	}
+	if err := m.Fresh(); err != nil && err != migrate.ErrNoChange {
 		log.fatalErr(err)
 	}
+
+	version := "none"
+	if v, _, err := m.Version(); err == nil {
+		version = strconv.FormatUint(uint64(v), 10)
+	} else if err != migrate.ErrNilVersion {
+		log.fatalErr(err)
+	}
+	log.Printf("Dropped everything and applied %v migrations in %v, version: %v\n",
+		applied, time.Since(started).Round(time.Millisecond), version)
 }
 
-func gotoCmd(m *migrate.Migrate, v uint) {
-	if err := m.Migrate(v); err != nil {
-		if err != migrate.ErrNoChange {
+func forceCmd(m *migrate.Migrate, v int) {
+	if err := m.Force(v); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+func versionCmd(m *migrate.Migrate) {
+	v, dirty, err := m.Version()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if dirty {
+		log.Printf("%v (dirty)\n", v)
+	} else {
+		log.Println(v)
+	}
+}
+
+// schemaState is the state of the database reported by checkCmd
+type schemaState struct {
+	// Version is nil if no migration has been applied
+	Version *uint  `json:"version"`
+	Dirty   bool   `json:"dirty"`
+	Pending []uint `json:"pending"`
+	OK      bool   `json:"ok"`
+}
+
+// newSchemaState reads the state of the database, which is OK unless it
+// is dirty or more than maxPending migrations are pending
+func newSchemaState(m *migrate.Migrate, maxPending int) (schemaState, error) {
+	var state schemaState
+	v, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return state, err
+	}
+	if err == nil {
+		state.Version = &v
+	}
+	state.Dirty = dirty
+	if state.Pending, err = m.Pending(); err != nil {
+		return state, err
+	}
+	state.OK = !state.Dirty && len(state.Pending) <= maxPending
+	return state, nil
+}
+
+// checkCmd (meant to be called via a CLI command) fails if the database
+// is dirty or more than maxPending migrations are pending
+func checkCmd(m *migrate.Migrate, maxPending int, asJSON bool) {
+	state, err := newSchemaState(m, maxPending)
+	if err != nil {
+		log.fatalErr(err)
+	}
+
+	if asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(state); err != nil {
 			log.fatalErr(err)
+		}
+	} else {
+		if state.Version == nil {
+			fmt.Println("version: none")
+		} else if state.Dirty {
+			fmt.Printf("version: %v (dirty)\n", *state.Version)
 		} else {
-			log.Println(err)
+			fmt.Printf("version: %v\n", *state.Version)
+		}
+		versions := make([]string, 0, len(state.Pending))
+		for _, p := range state.Pending {
+			versions = append(versions, strconv.FormatUint(uint64(p), 10))
+		}
+		if len(versions) == 0 {
+			fmt.Println("pending: none")
+		} else {
+			fmt.Printf("pending: %v\n", strings.Join(versions, ", "))
 		}
 	}
+
+	if state.Dirty {
+		log.fatal("error: database is dirty")
+	}
+	if len(state.Pending) > maxPending {
+		log.fatal(fmt.Sprintf("error: %v migrations pending, at most %v allowed", len(state.Pending), maxPending))
+	}
 }
 
-func upCmd(m *migrate.Migrate, limit int) {
-	if limit >= 0 {
-		if err := m.Steps(limit); err != nil {
-			if err != migrate.ErrNoChange {
-				log.fatalErr(err)
-			} else {
-				log.Println(err)
-			}
+// loadSnapshotCmd loads the snapshot in file path into a fresh database,
+// unless guards block its statements
+func loadSnapshotCmd(m *migrate.Migrate, path string, guards *guard) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	// the snapshot is only loaded into a database without version
+	if _, _, err := m.Version(); err != nil {
+		guards.body(m, "up", "snapshot "+path, body)
+	}
+	if err := m.LoadSnapshot(bytes.NewReader(body)); err == migrate.ErrNotFresh {
+		log.Println("Database isn't fresh, ignoring snapshot", path)
+	} else if err != nil {
+		log.fatalErr(err)
+	}
+}
+
+// scriptCmd (meant to be called via a CLI command) writes the change script
+// of the pending migrations to file out, or stdout if empty
+func scriptCmd(m *migrate.Migrate, out string) {
+	var buf bytes.Buffer
+	if err := m.WriteChangeScript(&buf); err == migrate.ErrNoChange {
+		log.Println(err)
+		return
+	} else if err != nil {
+		log.fatalErr(err)
+	}
+	if out == "" {
+		if _, err := buf.WriteTo(os.Stdout); err != nil {
+			log.fatalErr(err)
 		}
-	} else {
-		if err := m.Up(); err != nil {
-			if err != migrate.ErrNoChange {
-				log.fatalErr(err)
-			} else {
-				log.Println(err)
-			}
+		return
+	}
+	if err := ioutil.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		log.fatalErr(err)
+	}
+	log.Println("Wrote the change script to " + out + ", run it with apply-script after the review")
+}
+
+// applyScriptCmd (meant to be called via a CLI command) runs the change
+// script of file path
+func applyScriptCmd(m *migrate.Migrate, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	defer f.Close()
+	if err := m.ApplyChangeScript(f); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+func snapshotCmd(m *migrate.Migrate, out string) {
+	if out == "" {
+		if err := m.DumpSchema(os.Stdout); err != nil {
+			log.fatalErr(err)
 		}
+		return
+	}
+	var buf bytes.Buffer
+	if err := m.DumpSchema(&buf); err != nil {
+		log.fatalErr(err)
+	}
+	if err := ioutil.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		log.fatalErr(err)
+	}
+	if log.verbose {
+		log.Println("Wrote", out)
 	}
 }
 
-func downCmd(m *migrate.Migrate, limit int) {
-	if limit >= 0 {
-		if err := m.Steps(-limit); err != nil {
-			if err != migrate.ErrNoChange {
-				log.fatalErr(err)
-			} else {
-				log.Println(err)
-			}
+func driftCmd(m *migrate.Migrate) {
+	drift, err := m.Drift()
+	if err == database.ErrNoFingerprint {
+		log.fatal("error: no fingerprint stored, run migrations with -fingerprint first")
+	}
+	if err != nil {
+		log.fatalErr(err)
+	}
+	fmt.Printf("stored:  %v (version %v, %v)\n", drift.Stored.Fingerprint, drift.Stored.Version, drift.Stored.Created.Format(time.RFC3339))
+	fmt.Printf("current: %v\n", drift.Current)
+	if drift.Drifted() {
+		log.fatal("error: the schema was changed since the last run")
+	}
+}
+
+// lockStatusCmd (meant to be called via a CLI command) prints who holds the lock
+func lockStatusCmd(m *migrate.Migrate) {
+	holder, err := m.LockStatus()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if holder == nil {
+		fmt.Println("unlocked")
+		return
+	}
+	fmt.Printf("locked by %v\n", holder)
+}
+
+// testCmd (meant to be called via a CLI command) checks whether the
+// migrations can be reverted and applied again on a scratch database
+func testCmd(m *migrate.Migrate, drop bool) {
+	problems, err := m.CheckReversibility()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if drop {
+		if err := m.Drop(); err != nil {
+			log.fatalErr(err)
+		}
+	}
+	if len(problems) == 0 {
+		log.Println("All migrations can be reverted and applied again")
+		return
+	}
+	for _, p := range problems {
+		log.Println(p)
+	}
+	log.fatal("error: migrations aren't reversible")
+}
+
+func resetCmd(m *migrate.Migrate) {
+	problems, err := m.Reset()
+	for _, p := range problems {
+		log.Println(p)
+	}
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if len(problems) > 0 {
+		log.fatal("error: migrations aren't reversible")
+	}
+	log.Println("All migrations were reverted and applied again")
+}
+
+func tagCmd(m *migrate.Migrate, name string) {
+	if name != "" {
+		if err := m.Tag(name); err != nil {
+			log.fatalErr(err)
+		}
+		return
+	}
+	tags, err := m.Tags()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	for _, t := range tags {
+		fmt.Printf("%v\t%v\t%v\n", t.Name, t.Version, t.Created.Format(time.RFC3339))
+	}
+}
+
+func rollbackCmd(m *migrate.Migrate, tag string) {
+	if err := m.RollbackToTag(tag); err != nil {
+		if err != migrate.ErrNoChange {
+			log.fatalErr(err)
 		}
+		log.Println(err)
+	}
+}
+
+// fixturesLoadCmd (meant to be called via a CLI command) loads the
+// fixture set named set in directory dir
+func fixturesLoadCmd(m *migrate.Migrate, dir, set string) {
+	if err := m.LoadFixtures(dir, set); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+// unlockCmd (meant to be called via a CLI command) releases the lock,
+// even if it is held by someone else
+func unlockCmd(m *migrate.Migrate) {
+	holder, err := m.LockStatus()
+	if err != nil && err != migrate.ErrLockStatusUnsupported {
+		log.fatalErr(err)
+	}
+	if err := m.ForceUnlock(); err != nil {
+		log.fatalErr(err)
+	}
+	if holder != nil {
+		log.Printf("Released lock held by %v\n", holder)
 	} else {
-		if err := m.Down(); err != nil {
-			if err != migrate.ErrNoChange {
-				log.fatalErr(err)
-			} else {
-				log.Println(err)
-			}
+		log.Println("Released lock")
+	}
+}
+
+// pingCmd (meant to be called via a CLI command) connects to the database
+// without accessing the version table
+func pingCmd(databaseURL string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := database.Ping(ctx, databaseURL); err != nil {
+		log.fatalErr(err)
+	}
+	log.Println("Database is reachable")
+}
+
+// waitForDBCmd (meant to be called via a CLI command) retries connecting
+// to the database until it succeeds or timeout passes
+func waitForDBCmd(databaseURL string, timeout time.Duration, interval time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := waitFor(ctx, interval, func(ctx context.Context) error {
+		return database.Ping(ctx, databaseURL)
+	}); err != nil {
+		log.fatalErr(err)
+	}
+	log.Println("Database is reachable")
+}
+
+// waitFor calls ping every interval until it succeeds or ctx is done.
+// The error of the last attempt is returned.
+func waitFor(ctx context.Context, interval time.Duration, ping func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := ping(ctx)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Attempt %v: %v\n", attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
 		}
 	}
 }
 
-func dropCmd(m *migrate.Migrate) {
-	if err := m.Drop(); err != nil {
+// signCmd (meant to be called via a CLI command) writes the manifest
+// of all migrations of the source, signed with the SSH private key in keyFile
+func signCmd(src source.Driver, keyFile string, manifestFile string) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		log.fatalErr(err)
+	}
+
+	m, err := manifest.Build(src)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if err := m.Sign(signer); err != nil {
 		log.fatalErr(err)
 	}
+
+	writeManifest(m, manifestFile)
+	log.Printf("Signed %v versions in %v\n", len(m.Entries), manifestFile)
 }
 
-func forceCmd(m *migrate.Migrate, v int) {
-	if err := m.Force(v); err != nil {
+func writeManifest(m *manifest.Manifest, fname string) {
+	f, err := os.Create(fname)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if _, err := m.WriteTo(f); err != nil {
+		f.Close()
+		log.fatalErr(err)
+	}
+	if err := f.Close(); err != nil {
 		log.fatalErr(err)
 	}
 }
 
-func versionCmd(m *migrate.Migrate) {
-	v, dirty, err := m.Version()
+// readSignedManifest reads manifestFile and verifies its signature
+// with the SSH public key (in authorized_keys format) in keyFile
+func readSignedManifest(manifestFile string, keyFile string) (*manifest.Manifest, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := manifest.Read(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.VerifySignature(pub); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// approveCmd (meant to be called via a CLI command) writes the approval of
+// the up migration of version to dir, signed with the SSH private key in
+// keyFile
+func approveCmd(src source.Driver, version uint, keyFile string, dir string) {
+	key, err := ioutil.ReadFile(keyFile)
 	if err != nil {
 		log.fatalErr(err)
 	}
-	if dirty {
-		log.Printf("%v (dirty)\n", v)
-	} else {
-		log.Println(v)
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		log.fatalErr(err)
+	}
+
+	r, identifier, err := src.ReadUp(version)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	body, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	info := database.NewLockInfo()
+	a := approval.New(version, body, info.User+"@"+info.Hostname)
+	if err := a.Sign(signer); err != nil {
+		log.fatalErr(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := a.WriteTo(&buf); err != nil {
+		log.fatalErr(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.fatalErr(err)
+	}
+	path := approval.Path(dir, version)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		log.fatalErr(err)
+	}
+	log.Printf("Approved %v %v as %v in %v\n", version, identifier, a.Approver, path)
+}
+
+// bundleCmd (meant to be called via a CLI command) writes all migrations
+// of the source along with their manifest, signed with the SSH private key
+// in keyFile, as bundle to outFile
+func bundleCmd(src source.Driver, keyFile string, outFile string, name string, creator string) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(outFile), filepath.Ext(outFile))
+	}
+
+	f, err := os.Create(outFile)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	meta := bundle.Metadata{Name: name, Created: time.Now().UTC(), Creator: creator}
+	if err := bundle.Write(f, src, meta, signer); err != nil {
+		f.Close()
+		log.fatalErr(err)
+	}
+	if err := f.Close(); err != nil {
+		log.fatalErr(err)
+	}
+	log.Printf("Bundled migrations as %v in %v\n", name, outFile)
+}
+
+// checksumWriteCmd (meant to be called via a CLI command) writes
+// the checksums of all migrations of the source to lockFile
+func checksumWriteCmd(src source.Driver, lockFile string) {
+	m, err := manifest.Build(src)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	writeManifest(m, lockFile)
+	log.Printf("Wrote %v versions to %v\n", len(m.Entries), lockFile)
+}
+
+// checksumVerifyCmd (meant to be called via a CLI command) fails
+// if the migrations of the source differ from lockFile
+func checksumVerifyCmd(src source.Driver, lockFile string) {
+	f, err := os.Open(lockFile)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	locked, err := manifest.Read(f)
+	f.Close()
+	if err != nil {
+		log.fatalErr(err)
+	}
+
+	m, err := manifest.Build(src)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	diffs := manifest.Diff(locked, m)
+	if len(diffs) == 0 {
+		log.Printf("Migrations match %v\n", lockFile)
+		return
+	}
+	for _, d := range diffs {
+		log.Println(d)
+	}
+	log.fatal(fmt.Sprintf("error: migrations differ from %v", lockFile))
+}
+
+// graphCmd (meant to be called via a CLI command) prints the migrations
+// in the order they are applied along with their dependencies,
+// or the dependency graph in Graphviz DOT format
+func graphCmd(src source.Driver, dot bool) {
+	g, err := graph.New(src)
+	if err != nil {
+		log.fatalErr(err)
+	}
+
+	if dot {
+		fmt.Println("digraph migrations {")
+		for _, v := range g.Order() {
+			fmt.Printf("  \"%v\";\n", v)
+			for _, dep := range g.Dependencies(v) {
+				fmt.Printf("  \"%v\" -> \"%v\";\n", dep, v)
+			}
+		}
+		fmt.Println("}")
+		return
+	}
+
+	for _, v := range g.Order() {
+		deps := g.Dependencies(v)
+		if len(deps) == 0 {
+			fmt.Println(v)
+			continue
+		}
+		versions := make([]string, 0, len(deps))
+		for _, dep := range deps {
+			versions = append(versions, strconv.FormatUint(uint64(dep), 10))
+		}
+		fmt.Printf("%v depends on %v\n", v, strings.Join(versions, ", "))
+	}
+}
+
+// setQuery returns url with the query parameter key set to value
+func setQuery(url string, key string, value string) (string, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// addQuery adds key=value to the query of url without parsing it, as not
+// every database URL is a valid net/url URL, e.g. mysql://tcp(host:3306)/db.
+// It precedes a value of key already in url.
+func addQuery(url string, key string, value string) string {
+	kv := nurl.QueryEscape(key) + "=" + nurl.QueryEscape(value)
+	i := strings.IndexByte(url, '?')
+	if i < 0 {
+		return url + "?" + kv
+	}
+	if i == len(url)-1 {
+		return url + kv
+	}
+	return url[:i+1] + kv + "&" + url[i+1:]
+}
+
+var namespaceName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// namespaceSource appends the directory of namespace ns to the path of
+// source url, e.g. file://migrations/billing.
+func namespaceSource(url string, ns string) string {
+	i := strings.IndexAny(url, "?#")
+	if i < 0 {
+		i = len(url)
+	}
+	return strings.TrimSuffix(url[:i], "/") + "/" + ns + url[i:]
+}
+
+// namespaceDatabase suffixes the version table of database url, the
+// default one or the one set in url, with namespace ns,
+// e.g. schema_migrations_billing.
+func namespaceDatabase(url string, ns string) (string, error) {
+	param, table := "x-migrations-table", "schema_migrations"
+	switch {
+	case strings.HasPrefix(url, "mongodb://"), strings.HasPrefix(url, "mongodb+srv://"):
+		param = "x-migrations-collection"
+	case strings.HasPrefix(url, "spanner://"):
+		table = "SchemaMigrations"
+	case strings.HasPrefix(url, "neo4j://"):
+		return "", errors.New("namespaces aren't supported by neo4j")
+	}
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		q, err := nurl.ParseQuery(url[i+1:])
+		if err != nil {
+			return "", err
+		}
+		vt, err := database.ParseVersionTable(q)
+		if err != nil {
+			return "", err
+		}
+		table = vt.DefaultTable(table)
+		if t := q.Get(param); t != "" {
+			table = t
+		}
 	}
+	return addQuery(url, param, table+"_"+ns), nil
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references in s with the value of the
+// environment variable NAME. Unset variables are an error, so that a
+// missing secret doesn't turn into an empty password.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %v is not set", name)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
 }
 
 // numDownMigrationsFromArgs returns an int for number of migrations to apply
@@ -207,3 +1121,60 @@ func numDownMigrationsFromArgs(applyAll bool, args []string) (int, bool, error)
 		return 0, false, errors.New("too many arguments")
 	}
 }
+
+// showCmd (meant to be called via a CLI command) prints the up and down
+// migration of version with their pragmas and checksums, and whether
+// version is applied
+func showCmd(m *migrate.Migrate, version uint) {
+	info, err := m.Show(version)
+	if os.IsNotExist(err) {
+		log.fatal(fmt.Sprintf("error: no migration of version %v", version))
+	} else if err != nil {
+		log.fatalErr(err)
+	}
+	state := "pending"
+	if info.Dirty {
+		state = "dirty"
+	} else if info.Applied {
+		state = "applied"
+	}
+	fmt.Printf("version:  %v\nstate:    %v\n", info.Version, state)
+	for _, f := range []struct {
+		direction source.Direction
+		file      *migrate.MigrationFile
+	}{{source.Up, info.Up}, {source.Down, info.Down}} {
+		if f.file == nil {
+			fmt.Printf("\n== %v: none\n", f.direction)
+			continue
+		}
+		fmt.Printf("\n== %v: %v\nchecksum: %v\n", f.direction, f.file.Name, f.file.Checksum)
+		for i, p := range f.file.Pragmas {
+			label := "pragmas:"
+			if i > 0 {
+				label = ""
+			}
+			fmt.Printf("%-9v %v%v %v\n", label, pragma.Prefix, p.Name, p.Value)
+		}
+		if f.file.Skipped {
+			fmt.Println("skipped:  the if pragma isn't met, only the version would be set")
+		}
+		fmt.Println(strings.TrimRight(string(f.file.Body), "\n"))
+	}
+}
+
+// planCmd (meant to be called via a CLI command) makes m write the SQL it
+// would run to file out instead of running it, see migrate.Migrate.Plan.
+// The returned func closes the file.
+func planCmd(m *migrate.Migrate, out string) func() {
+	f, err := os.Create(out)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	m.Plan = f
+	return func() {
+		if err := f.Close(); err != nil {
+			log.fatalErr(err)
+		}
+		log.Println("Wrote the SQL to", out, "without running it")
+	}
+}
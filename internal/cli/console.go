@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+const consoleHelp = `Commands:
+  status               Print the version and the pending migrations
+  list                 List all migrations, marking the applied ones
+  up [V]               Apply the migrations up to version V, selected with the arrow keys without V
+  down [V]             Revert the migrations after version V, selected with the arrow keys without V
+  show V [up|down]     Print the up (default) or down migration of version V
+  force V              Set version V without running a migration
+  help                 Print this help
+  exit                 Leave the console (or Ctrl+D)
+`
+
+// errExit ends the console
+var errExit = errors.New("exit")
+
+// console is the prompt of the console command. Migrate and the source
+// stay open between commands.
+type console struct {
+	m      *migrate.Migrate
+	guards *guard
+	in     *os.File
+	out    io.Writer
+
+	// terminal edits lines and keeps the history, if in is a terminal
+	terminal *term.Terminal
+	lines    *bufio.Scanner
+}
+
+func consoleCmd(m *migrate.Migrate, guards *guard) {
+	c := &console{m: m, guards: guards, in: os.Stdin, out: os.Stdout}
+	if term.IsTerminal(int(c.in.Fd())) {
+		c.terminal = term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{c.in, c.out}, "migrate> ")
+	} else {
+		c.lines = bufio.NewScanner(c.in)
+	}
+	fmt.Fprint(c.out, `Type "help" for the commands.`+"\n")
+	if err := c.run(); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+// run executes commands until exit or the end of the input
+func (c *console) run() error {
+	for {
+		line, err := c.readLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		err = c.exec(strings.Fields(line))
+		if err == errExit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintln(c.out, "error:", err)
+		}
+	}
+}
+
+func (c *console) readLine() (string, error) {
+	if c.terminal == nil {
+		if !c.lines.Scan() {
+			if err := c.lines.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return c.lines.Text(), nil
+	}
+	// the terminal is raw only while reading, so that the output of
+	// commands isn't garbled
+	state, err := term.MakeRaw(int(c.in.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(int(c.in.Fd()), state)
+	return c.terminal.ReadLine()
+}
+
+func (c *console) exec(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	switch args[0] {
+	case "status":
+		return c.status()
+	case "list":
+		return c.list()
+	case "up", "down":
+		return c.migrate(args[0], args[1:])
+	case "show":
+		return c.show(args[1:])
+	case "force":
+		if len(args) != 2 {
+			return errors.New("usage: force V")
+		}
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			alias, err := c.m.ResolveVersion(args[1])
+			if err != nil {
+				return err
+			}
+			v = int64(alias)
+		}
+		if err := c.guards.checkCommand(c.m, "force"); err != nil {
+			return err
+		}
+		return c.m.Force(int(v))
+	case "help":
+		fmt.Fprint(c.out, consoleHelp)
+		return nil
+	case "exit", "quit":
+		return errExit
+	}
+	return fmt.Errorf("unknown command %v, see help", args[0])
+}
+
+func (c *console) status() error {
+	version, dirty, err := c.m.Version()
+	switch {
+	case err == migrate.ErrNilVersion:
+		fmt.Fprintln(c.out, "version: none")
+	case err != nil:
+		return err
+	case dirty:
+		fmt.Fprintf(c.out, "version: %v (dirty)\n", version)
+	default:
+		fmt.Fprintf(c.out, "version: %v\n", version)
+	}
+	pending, err := c.m.Pending()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "pending: %v\n", len(pending))
+	return nil
+}
+
+// migration is a version of the source with the name of its up migration
+type migration struct {
+	version uint
+	name    string
+	applied bool
+}
+
+func (mig migration) String() string {
+	return fmt.Sprintf("%v %v", mig.version, mig.name)
+}
+
+// listMigrations returns the migrations of m in the order it applies them,
+// marking the applied ones, see migrate.Migrate.Migrations
+func listMigrations(m *migrate.Migrate) ([]migration, error) {
+	states, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]migration, len(states))
+	for i, state := range states {
+		migrations[i] = migration{version: state.Version, name: state.Identifier, applied: state.Applied}
+	}
+	return migrations, nil
+}
+
+func (c *console) list() error {
+	migrations, err := listMigrations(c.m)
+	if err != nil {
+		return err
+	}
+	for _, mig := range migrations {
+		mark := " "
+		if mig.applied {
+			mark = "*"
+		}
+		fmt.Fprintf(c.out, "%v %v\n", mark, mig)
+	}
+	return nil
+}
+
+// migrate runs up or down to the version in args, or the one selected
+func (c *console) migrate(direction string, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %v [V]", direction)
+	}
+	if len(args) == 1 {
+		v, err := c.m.ResolveVersion(args[0])
+		if err != nil {
+			return err
+		}
+		return c.guarded(direction, func() error {
+			return c.m.Migrate(v)
+		})
+	}
+
+	migrations, err := listMigrations(c.m)
+	if err != nil {
+		return err
+	}
+	var options []string
+	var targets []migration
+	for _, mig := range migrations {
+		if mig.applied == (direction == "down") {
+			options = append(options, mig.String())
+			targets = append(targets, mig)
+		}
+	}
+	if direction == "down" {
+		if len(targets) == 0 {
+			return migrate.ErrNoChange
+		}
+		// the last applied migration is the current version, which
+		// would be no change
+		targets = targets[:len(targets)-1]
+		options = append([]string{"none (revert all)"}, options[:len(options)-1]...)
+		targets = append([]migration{{}}, targets...)
+	} else if len(targets) == 0 {
+		return migrate.ErrNoChange
+	}
+
+	title := "Apply up to and including"
+	if direction == "down" {
+		title = "Revert everything after"
+	}
+	i, err := c.choose(title, options)
+	if err != nil || i < 0 {
+		return err
+	}
+	if direction == "down" && i == 0 {
+		return c.guarded(direction, c.m.Down)
+	}
+	return c.guarded(direction, func() error {
+		return c.m.Migrate(targets[i].version)
+	})
+}
+
+// guarded runs the migrations of command unless guard rules block them
+func (c *console) guarded(command string, run func() error) error {
+	if err := c.guards.check(c.m, command, run); err != nil {
+		return err
+	}
+	return run()
+}
+
+// choose lets the user select one of options with the arrow keys and
+// returns its index, or -1 if cancelled
+func (c *console) choose(title string, options []string) (int, error) {
+	if c.terminal == nil {
+		return -1, errors.New("selecting needs a terminal, give the version")
+	}
+	fd := int(c.in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return -1, err
+	}
+	defer term.Restore(fd, state)
+
+	selected := len(options) - 1
+	draw := func() {
+		for i, o := range options {
+			cursor := "  "
+			if i == selected {
+				cursor = "> "
+			}
+			fmt.Fprintf(c.out, "\r\x1b[2K%v%v\r\n", cursor, o)
+		}
+	}
+	fmt.Fprintf(c.out, "%v (arrow keys and enter, q to cancel):\r\n", title)
+	draw()
+	buf := make([]byte, 3)
+	for {
+		n, err := c.in.Read(buf)
+		if err != nil {
+			return -1, err
+		}
+		key := string(buf[:n])
+		switch key {
+		case "\x1b[A", "k":
+			if selected > 0 {
+				selected--
+			}
+		case "\x1b[B", "j":
+			if selected < len(options)-1 {
+				selected++
+			}
+		case "\r", "\n":
+			return selected, nil
+		case "q", "\x1b", "\x03":
+			return -1, nil
+		default:
+			continue
+		}
+		// move back to the first option and redraw
+		fmt.Fprintf(c.out, "\x1b[%dA", len(options))
+		draw()
+	}
+}
+
+func (c *console) show(args []string) error {
+	if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "up" && args[1] != "down") {
+		return errors.New("usage: show V [up|down]")
+	}
+	v, err := c.m.ResolveVersion(args[0])
+	if err != nil {
+		return err
+	}
+	info, err := c.m.Show(v)
+	if err != nil {
+		return err
+	}
+	file := info.Up
+	if len(args) == 2 && args[1] == "down" {
+		file = info.Down
+	}
+	if file == nil {
+		return os.ErrNotExist
+	}
+	fmt.Fprintln(c.out, strings.TrimRight(string(file.Body), "\n"))
+	return nil
+}
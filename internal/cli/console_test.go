@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+func TestConsole(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"1_init.up.sql":     "CREATE 1",
+		"1_init.down.sql":   "DROP 1",
+		"2_users.up.sql":    "CREATE 2",
+		"3_orders.up.sql":   "CREATE 3",
+		"3_orders.down.sql": "DROP 3",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := migrate.New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	input := "status\nup 2\nlist\nshow 3\nshow 1 down\nforce 3\nstatus\nup\ndown\nbogus\nexit\nstatus\n"
+	var out bytes.Buffer
+	c := &console{m: m, guards: &guard{}, out: &out, lines: bufio.NewScanner(strings.NewReader(input))}
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `version: none
+pending: 3
+* 1 init
+* 2 users
+  3 orders
+CREATE 3
+DROP 1
+version: 3
+pending: 0
+error: no change
+error: selecting needs a terminal, give the version
+error: unknown command bogus, see help
+`
+	if out.String() != expected {
+		t.Errorf("expected output\n%v\ngot\n%v", expected, out.String())
+	}
+	out.Reset()
+	c.guards = &guard{rules: []*guardRule{{URL: "stub", Commands: []string{"force"}, url: regexp.MustCompile("stub")}}, databaseURL: "stub://"}
+	c.lines = bufio.NewScanner(strings.NewReader("force 1\nstatus\n"))
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+	expected = "error: force is blocked on this database by guard rule \"stub\", give -break-glass REASON to override\nversion: 3\npending: 0\n"
+	if out.String() != expected {
+		t.Errorf("expected blocked force\n%v\ngot\n%v", expected, out.String())
+	}
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// commandDecrypter decrypts migrations by piping them through
+// an external command, e.g. `age --decrypt -i key.txt`.
+type commandDecrypter struct {
+	args []string
+}
+
+func newCommandDecrypter(command string) (*commandDecrypter, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty decrypt command")
+	}
+	return &commandDecrypter{args: args}, nil
+}
+
+func (d *commandDecrypter) Decrypt(ciphertext io.Reader) (io.Reader, error) {
+	var plain bytes.Buffer
+	cmd := exec.Command(d.args[0], d.args[1:]...)
+	cmd.Stdin = ciphertext
+	cmd.Stdout = &plain
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("decrypt command %q: %v", strings.Join(d.args, " "), err)
+	}
+	return &plain, nil
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/lock"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// Status of a diagnosis
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "fail"
+	statusSkip = "skip"
+)
+
+// diagnosis is one item of the doctor checklist
+type diagnosis struct {
+	check   string
+	status  string
+	message string
+	// hint tells how to fix a failure
+	hint string
+}
+
+func (d diagnosis) String() string {
+	s := fmt.Sprintf("%-6s %v: %v", "["+d.status+"]", d.check, d.message)
+	if d.hint != "" {
+		s += "\n       " + d.hint
+	}
+	return s
+}
+
+// diagnose checks the source and database configuration step by step.
+// Steps which depend on a failed one are skipped.
+func diagnose(sourceURL, databaseURL string, lockStrategy string, lockTimeout time.Duration) []diagnosis {
+	var ds []diagnosis
+	ok := func(check, format string, v ...interface{}) {
+		ds = append(ds, diagnosis{check: check, status: statusOK, message: fmt.Sprintf(format, v...)})
+	}
+	warn := func(check, message, hint string) {
+		ds = append(ds, diagnosis{check: check, status: statusWarn, message: message, hint: hint})
+	}
+	fail := func(check string, err error, hint string) {
+		ds = append(ds, diagnosis{check: check, status: statusFail, message: err.Error(), hint: hint})
+	}
+	skip := func(checks ...string) {
+		for _, check := range checks {
+			ds = append(ds, diagnosis{check: check, status: statusSkip, message: "depends on a failed check"})
+		}
+	}
+
+	versions, err := diagnoseSource(sourceURL)
+	if err != nil {
+		fail("source", err, "check -source or -path: the location must exist, be readable and contain "+
+			"migrations named {version}_{title}.up.{extension} and {version}_{title}.down.{extension}")
+	} else {
+		ok("source", "%v versions readable", len(versions))
+	}
+
+	db, err := database.Open(databaseURL)
+	if err != nil {
+		fail("database", err, "check -database: driver name, host, port, credentials and database name, "+
+			"and that the database accepts connections from this host")
+		skip("version table", "lock", "version table write", "transactional DDL")
+		return ds
+	}
+	defer db.Close()
+	ok("database", "connected")
+
+	version, dirty, versionErr := db.Version()
+	switch {
+	case versionErr != nil:
+		fail("version table", versionErr, "the database user needs permission to create and read the version table")
+	case dirty:
+		warn("version table", fmt.Sprintf("dirty at version %v", version),
+			"a migration failed halfway: fix the database manually, then run `force` with the last clean version")
+	case version != database.NilVersion && versions != nil && !versions[uint(version)]:
+		warn("version table", fmt.Sprintf("version %v has no migration in the source", version),
+			"check that -source points to the migrations of this database")
+	case version == database.NilVersion:
+		ok("version table", "readable, no version applied yet")
+	default:
+		ok("version table", "readable, version %v", version)
+	}
+
+	var locker database.Locker
+	if isLockURL(lockStrategy) {
+		l, err := lock.Open(lockStrategy)
+		if err != nil {
+			fail("lock", err, "check -lock: driver name and address of the lock provider")
+			skip("version table write", "transactional DDL")
+			return ds
+		}
+		defer l.Close()
+		locker = l
+	} else if locker, err = database.NewLocker(lockStrategy, db); err != nil {
+		fail("lock", err, "use -lock advisory, table, none or the URL of a lock provider")
+		skip("version table write", "transactional DDL")
+		return ds
+	}
+	if err := lockWithTimeout(locker, lockTimeout); err != nil {
+		fail("lock", err, "another migrate process might hold the lock: wait for it to finish or raise -lock-timeout")
+		skip("version table write", "transactional DDL")
+		return ds
+	}
+	defer locker.Unlock()
+	ok("lock", "acquired")
+
+	if versionErr != nil {
+		skip("version table write")
+	} else if err := db.SetVersion(version, dirty); err != nil {
+		fail("version table write", err, "the database user needs permission to write the version table")
+	} else {
+		ok("version table write", "rewrote version %v", version)
+	}
+
+	if t, isTransactional := db.(database.Transactional); !isTransactional {
+		warn("transactional DDL", "not supported by the database driver",
+			"-atomic-batch is unavailable and a failed migration leaves the database dirty")
+	} else if err := t.Begin(); err != nil {
+		fail("transactional DDL", err, "the database user needs permission to start transactions")
+	} else if err := t.Rollback(); err != nil {
+		fail("transactional DDL", err, "the database user needs permission to roll back transactions")
+	} else {
+		ok("transactional DDL", "supported")
+	}
+	return ds
+}
+
+// diagnoseSource reads every migration of the source and returns its versions
+func diagnoseSource(url string) (map[uint]bool, error) {
+	src, err := source.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	versions := make(map[uint]bool)
+	version, err := src.First()
+	for err == nil {
+		versions[version] = true
+		if err := readable(src.ReadUp(version)); err != nil {
+			return nil, err
+		}
+		if err := readable(src.ReadDown(version)); err != nil {
+			return nil, err
+		}
+		version, err = src.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no migrations found in %v", url)
+	}
+	return versions, nil
+}
+
+// readable closes the body of a migration, a missing migration is fine
+func readable(r io.ReadCloser, identifier string, err error) error {
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.Close()
+}
+
+// isLockURL reports whether the -lock option is the URL of a lock provider
+// instead of a lock strategy
+func isLockURL(s string) bool {
+	return strings.Contains(s, "://")
+}
+
+// lockWithTimeout acquires the database lock, giving up after timeout.
+// A lock acquired after the timeout is released again.
+func lockWithTimeout(db database.Locker, timeout time.Duration) error {
+	errchan := make(chan error, 1)
+	go func() {
+		errchan <- db.Lock()
+	}()
+
+	select {
+	case err := <-errchan:
+		return err
+	case <-time.After(timeout):
+		go func() {
+			if err := <-errchan; err == nil {
+				db.Unlock()
+			}
+		}()
+		return fmt.Errorf("can't acquire lock within %v", timeout)
+	}
+}
+
+// doctorCmd (meant to be called via a CLI command) prints a checklist
+// of the source and database configuration, failing if a check fails
+func doctorCmd(sourceURL, databaseURL string, lockStrategy string, lockTimeout time.Duration) {
+	failed := false
+	for _, d := range diagnose(sourceURL, databaseURL, lockStrategy, lockTimeout) {
+		fmt.Println(d)
+		failed = failed || d.status == statusFail
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiagnose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "1_init.up.sql"), []byte("CREATE 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		sourceURL   string
+		databaseURL string
+		expected    []string
+	}{
+		{"ok", "file://" + dir, "stub://", []string{statusOK, statusOK, statusOK, statusOK, statusOK, statusOK}},
+		{"no migrations", "file://" + filepath.Join(dir, "missing"), "stub://", []string{statusFail, statusOK, statusOK, statusOK, statusOK, statusOK}},
+		{"unknown database", "file://" + dir, "unknown://", []string{statusOK, statusFail, statusSkip, statusSkip, statusSkip, statusSkip}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ds := diagnose(c.sourceURL, c.databaseURL, "", time.Second)
+			if len(ds) != len(c.expected) {
+				t.Fatalf("expected %v checks, got %v", len(c.expected), ds)
+			}
+			for i, d := range ds {
+				if d.status != c.expected[i] {
+					t.Errorf("expected %v, got %v", c.expected[i], d)
+				}
+			}
+		})
+	}
+}
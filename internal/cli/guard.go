@@ -0,0 +1,369 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// defaultGuardsFile is the config file of the guard rules, used if it exists
+const defaultGuardsFile = "migrate.guards.json"
+
+// destructiveClass blocks all destructiveStatements in a guard rule
+const destructiveClass = "destructive"
+
+// guardRule blocks commands and statements on databases whose URL matches
+type guardRule struct {
+	URL string `json:"url"`
+	// Commands are the blocked commands, e.g. drop or force
+	Commands []string `json:"commands"`
+	// Statements are the blocked classes of destructiveStatements, e.g.
+	// TRUNCATE, or destructive for all of them
+	Statements []string `json:"statements"`
+
+	url *regexp.Regexp
+}
+
+func (r *guardRule) blocksStatement(flag string) bool {
+	for _, s := range r.Statements {
+		if s == destructiveClass || strings.EqualFold(s, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// readGuards reads the guard rules of config file, e.g.
+//  {"rules": [
+//    {"url": "\\.prod\\.", "commands": ["drop", "force"], "statements": ["destructive"]}
+//  ]}
+// A missing file has no rules, unless it was given explicitly.
+func readGuards(file string, explicit bool) ([]*guardRule, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Rules []*guardRule `json:"rules"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", file, err)
+	}
+
+	classes := map[string]bool{destructiveClass: true}
+	for _, s := range destructiveStatements {
+		classes[strings.ToLower(s.flag)] = true
+	}
+	for i, r := range config.Rules {
+		if r.url, err = regexp.Compile(r.URL); err != nil || r.URL == "" {
+			return nil, fmt.Errorf("rule %v of %v: invalid url %q: %v", i+1, file, r.URL, err)
+		}
+		for _, s := range r.Statements {
+			if !classes[strings.ToLower(s)] {
+				return nil, fmt.Errorf("rule %v of %v: unknown statement class %q", i+1, file, s)
+			}
+		}
+	}
+	return config.Rules, nil
+}
+
+// guard enforces the guard rules on the database of a command, unless
+// breakGlass gives a reason to override them
+type guard struct {
+	rules       []*guardRule
+	databaseURL string
+	breakGlass  string
+}
+
+// matching returns the rules matching the database URL
+func (g *guard) matching() []*guardRule {
+	var rules []*guardRule
+	for _, r := range g.rules {
+		if r.url.MatchString(g.databaseURL) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// guardedAs are the commands blocked by the rules of other commands, as
+// they do what those do and more, e.g. fresh drops the database
+var guardedAs = map[string][]string{
+	"fresh": {"drop"},
+	"reset": {"down"},
+}
+
+// blocksCommand tells whether r blocks command, or a command it is guarded
+// as
+func (r *guardRule) blocksCommand(command string) bool {
+	for _, c := range r.Commands {
+		if c == command {
+			return true
+		}
+		for _, as := range guardedAs[command] {
+			if c == as {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// command fails if a rule blocks command, or records breaking the glass
+func (g *guard) command(m *migrate.Migrate, command string) {
+	if err := g.checkCommand(m, command); err != nil {
+		log.fatal("error: " + err.Error())
+	}
+}
+
+// checkCommand is command returning an error, for commands which keep
+// running, e.g. the console
+func (g *guard) checkCommand(m *migrate.Migrate, command string) error {
+	for _, r := range g.matching() {
+		if r.blocksCommand(command) {
+			return g.override(m, command, fmt.Sprintf("%v is blocked on this database by guard rule %q", command, r.URL))
+		}
+	}
+	return nil
+}
+
+// planMigration heads a migration in a plan, see migrate.Migrate.Plan
+var planMigration = regexp.MustCompile(`(?m)^-- (\d+/[ud] .*)$`)
+
+// planNotSQL describes a migration of a plan which doesn't run SQL, e.g.
+// an exec migration, whose statements can't be checked
+var planNotSQL = regexp.MustCompile(`(?m)^-- .*, not SQL$`)
+
+// notSQLFlag is reported for the migrations of a plan which don't run SQL,
+// blocked by any rule blocking statements
+const notSQLFlag = "not SQL"
+
+// dropFlag is the statement class of dropping everything in the database,
+// e.g. by drop and fresh
+const dropFlag = "DROP TABLE"
+
+// statements fails if a rule blocks a statement of the migrations command
+// would run, or records breaking the glass. run runs the command, which
+// only writes the plan of its migrations here.
+func (g *guard) statements(m *migrate.Migrate, command string, run func() error) {
+	if m.Plan != nil {
+		return
+	}
+	if err := g.checkStatements(m, command, run); err != nil {
+		log.fatal("error: " + err.Error())
+	}
+}
+
+// checkStatements is statements returning an error, for commands which keep
+// running, e.g. the console
+func (g *guard) checkStatements(m *migrate.Migrate, command string, run func() error) error {
+	blocked, err := g.blocked(m, run)
+	if err != nil {
+		return g.override(m, command, fmt.Sprintf("the statements %v would run can't be checked against the guard rules: %v",
+			command, err))
+	}
+	if len(blocked) > 0 {
+		return g.override(m, command, fmt.Sprintf("%v would run statements blocked on this database by guard rules: %v",
+			command, strings.Join(blocked, "; ")))
+	}
+	return nil
+}
+
+// check checks both command and the statements of run, see checkCommand and
+// checkStatements
+func (g *guard) check(m *migrate.Migrate, command string, run func() error) error {
+	if err := g.checkCommand(m, command); err != nil {
+		return err
+	}
+	return g.checkStatements(m, command, run)
+}
+
+// blocked returns the migrations run would apply with statements blocked
+// by a rule, see blockedStatements. run only writes the plan of its
+// migrations here. If the plan can't be written, it returns the error, as
+// the statements can't be checked.
+func (g *guard) blocked(m *migrate.Migrate, run func() error) ([]string, error) {
+	rules := g.matching()
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	var plan bytes.Buffer
+	m.Plan = &plan
+	err := run()
+	m.Plan = nil
+	if err == migrate.ErrNoChange {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return blockedStatements(rules, plan.Bytes()), nil
+}
+
+// plan fails if a rule blocks a statement of plan, e.g. a change script, or
+// records breaking the glass
+func (g *guard) plan(m *migrate.Migrate, command string, plan []byte) {
+	if blocked := blockedStatements(g.matching(), plan); len(blocked) > 0 {
+		g.block(m, command, fmt.Sprintf("%v would run statements blocked on this database by guard rules: %v",
+			command, strings.Join(blocked, "; ")))
+	}
+}
+
+// body fails if a rule blocks a statement of body, which isn't a plan of
+// migrations but runs as a whole, e.g. the snapshot name, or records
+// breaking the glass
+func (g *guard) body(m *migrate.Migrate, command string, name string, body []byte) {
+	if flags := blockedFlags(g.matching(), body); len(flags) > 0 {
+		g.block(m, command, fmt.Sprintf("%v would run statements blocked on this database by guard rules: %v: %v",
+			command, name, strings.Join(flags, ", ")))
+	}
+}
+
+// fixtures fails if a rule blocks a statement of loading the fixture set
+// in dir, or records breaking the glass
+func (g *guard) fixtures(m *migrate.Migrate, dir, set string) {
+	if len(g.matching()) == 0 {
+		return
+	}
+	var plan bytes.Buffer
+	m.Plan = &plan
+	err := m.LoadFixtures(dir, set)
+	m.Plan = nil
+	if err != nil {
+		g.block(m, "fixtures", fmt.Sprintf("the statements of fixture set %v can't be checked against the guard rules: %v", set, err))
+		return
+	}
+	g.body(m, "fixtures", "fixture set "+set, plan.Bytes())
+}
+
+// drops fails if a rule blocks dropping tables, as command drops everything
+// in the database, or records breaking the glass
+func (g *guard) drops(m *migrate.Migrate, command string) {
+	for _, r := range g.matching() {
+		if r.blocksStatement(dropFlag) {
+			g.block(m, command, fmt.Sprintf("%v drops every table, which is blocked on this database by guard rule %q",
+				command, r.URL))
+			return
+		}
+	}
+}
+
+// blockedStatements returns the migrations of plan with statements blocked
+// by rules, e.g. "2/u drop_users: DROP TABLE". Migrations which don't run
+// SQL are blocked by any rule blocking statements, as theirs are unknown.
+func blockedStatements(rules []*guardRule, plan []byte) []string {
+	var blocked []string
+	headings := planMigration.FindAllSubmatchIndex(plan, -1)
+	for i, h := range headings {
+		end := len(plan)
+		if i+1 < len(headings) {
+			end = headings[i+1][0]
+		}
+		if flags := blockedFlags(rules, plan[h[1]:end]); len(flags) > 0 {
+			blocked = append(blocked, fmt.Sprintf("%s: %v", plan[h[2]:h[3]], strings.Join(flags, ", ")))
+		}
+	}
+	return blocked
+}
+
+// blockedFlags returns the classes of the statements of body blocked by
+// rules, or notSQLFlag if body doesn't run SQL and a rule blocks statements
+func blockedFlags(rules []*guardRule, body []byte) []string {
+	if planNotSQL.Match(body) {
+		for _, r := range rules {
+			if len(r.Statements) > 0 {
+				return []string{notSQLFlag}
+			}
+		}
+		return nil
+	}
+	var flags []string
+	for _, flag := range destructive(body) {
+		for _, r := range rules {
+			if r.blocksStatement(flag) {
+				flags = append(flags, flag)
+				break
+			}
+		}
+	}
+	return flags
+}
+
+// block fails with msg, unless the glass is broken, which is recorded in
+// the audit table
+func (g *guard) block(m *migrate.Migrate, command string, msg string) {
+	if err := g.override(m, command, msg); err != nil {
+		log.fatal("error: " + err.Error())
+	}
+}
+
+// override returns an error with msg, unless the glass is broken, which is
+// recorded in the audit table
+func (g *guard) override(m *migrate.Migrate, command string, msg string) error {
+	if g.breakGlass == "" {
+		return errors.New(msg + ", give -break-glass REASON to override")
+	}
+	if m == nil {
+		return errors.New(msg + ", breaking the glass needs a database to record it in the audit table")
+	}
+	log.Println("Breaking the glass:", msg)
+	if m.AuditTable == "" {
+		m.AuditTable = database.DefaultAuditTable
+	}
+	return m.AuditEvent("break-glass", command, g.breakGlass)
+}
+
+// planState is the version a plan is written from, see atVersion
+type planState int
+
+func (s planState) Version() (int, bool, error) {
+	return int(s), false, nil
+}
+
+func (s planState) SetVersion(version int, dirty bool) error {
+	return nil
+}
+
+// atVersion returns run running as if the database was at version, so that
+// the plan of e.g. fresh has the migrations applied after the drop
+func atVersion(m *migrate.Migrate, version int, run func() error) func() error {
+	return func() error {
+		state := m.State
+		m.State = planState(version)
+		defer func() {
+			m.State = state
+		}()
+		return run()
+	}
+}
+
+// fromScratch returns run running as if no migration was applied, see
+// atVersion
+func fromScratch(m *migrate.Migrate, run func() error) func() error {
+	return atVersion(m, database.NilVersion, run)
+}
+
+// lastVersion returns the version m is at once all migrations are applied
+func lastVersion(m *migrate.Migrate) (int, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) > 0 {
+		return int(pending[len(pending)-1]), nil
+	}
+	version, _, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return database.NilVersion, nil
+	}
+	return int(version), err
+}
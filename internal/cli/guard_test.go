@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestReadGuards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, defaultGuardsFile)
+	if rules, err := readGuards(file, false); err != nil || rules != nil {
+		t.Fatalf("expected no rules without file, got %v, %v", rules, err)
+	}
+	if _, err := readGuards(file, true); !os.IsNotExist(err) {
+		t.Fatalf("expected missing explicit file to fail, got %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		config string
+		valid  bool
+	}{
+		{"valid", `{"rules": [{"url": "\\.prod\\.", "commands": ["drop"], "statements": ["destructive", "truncate"]}]}`, true},
+		{"invalid url", `{"rules": [{"url": "("}]}`, false},
+		{"empty url", `{"rules": [{"commands": ["drop"]}]}`, false},
+		{"unknown statement", `{"rules": [{"url": "prod", "statements": ["create table"]}]}`, false},
+		{"invalid json", `{"rules": [`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := ioutil.WriteFile(file, []byte(c.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readGuards(file, false); (err == nil) != c.valid {
+				t.Errorf("expected valid %v, got %v", c.valid, err)
+			}
+		})
+	}
+}
+
+func TestBlockedStatements(t *testing.T) {
+	rules := []*guardRule{{URL: "prod", Statements: []string{"TRUNCATE", "drop table"}}}
+	plan := "-- 1/u create_users\nCREATE TABLE users (id int);\n\n" +
+		"-- 2/u cleanup\nTRUNCATE logs;\nDELETE FROM sessions;\n\n" +
+		"-- 2/d cleanup\n-- no migration, only sets the version\n\n" +
+		"-- 1/d create_users\nDROP TABLE users;\n"
+	expected := []string{"2/u cleanup: TRUNCATE", "1/d create_users: DROP TABLE"}
+	if blocked := blockedStatements(rules, []byte(plan)); !reflect.DeepEqual(blocked, expected) {
+		t.Errorf("expected %v, got %v", expected, blocked)
+	}
+
+	rules = []*guardRule{{URL: "prod", Statements: []string{destructiveClass}}}
+	expected = []string{"2/u cleanup: TRUNCATE, DELETE", "1/d create_users: DROP TABLE"}
+	if blocked := blockedStatements(rules, []byte(plan)); !reflect.DeepEqual(blocked, expected) {
+		t.Errorf("expected %v, got %v", expected, blocked)
+	}
+
+	// the statements of commands and scripts are unknown
+	plan = "-- 3/u export\n-- runs command ./export.sh, not SQL\n\n" +
+		"-- 4/u lowercase_emails\n-- backfills in batches (table=users)\nDELETE FROM users WHERE {batch};\n\n" +
+		"-- 5/u countries\n-- loads data into countries, only inserts rows\n\n"
+	expected = []string{"3/u export: not SQL", "4/u lowercase_emails: DELETE"}
+	if blocked := blockedStatements(rules, []byte(plan)); !reflect.DeepEqual(blocked, expected) {
+		t.Errorf("expected %v, got %v", expected, blocked)
+	}
+	rules = []*guardRule{{URL: "prod", Commands: []string{"drop"}}}
+	if blocked := blockedStatements(rules, []byte(plan)); len(blocked) > 0 {
+		t.Errorf("expected nothing blocked by a rule without statements, got %v", blocked)
+	}
+}
+
+func TestGuardCommand(t *testing.T) {
+	g := &guard{rules: []*guardRule{{URL: "prod", Commands: []string{"drop"}, url: regexp.MustCompile("prod")}},
+		databaseURL: "postgres://db.prod"}
+	for _, command := range []string{"drop", "fresh"} {
+		if err := g.checkCommand(nil, command); err == nil {
+			t.Errorf("expected %v blocked", command)
+		}
+	}
+	if err := g.checkCommand(nil, "reset"); err != nil {
+		t.Errorf("expected reset not blocked, got %v", err)
+	}
+}
+
+func TestGuardBlocked(t *testing.T) {
+	s, closeServer := newTestServer(t)
+	defer closeServer()
+	g := &guard{rules: []*guardRule{{URL: "stub", Statements: []string{destructiveClass}, url: regexp.MustCompile("stub")}},
+		databaseURL: "stub://"}
+
+	// a plan which can't be written blocks the run
+	if _, err := g.blocked(s.m, func() error { return errors.New("no plan") }); err == nil {
+		t.Error("expected the error of the plan")
+	}
+	if err := g.checkStatements(s.m, "up", func() error { return errors.New("no plan") }); err == nil {
+		t.Error("expected the run blocked")
+	}
+
+	if err := s.m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if blocked, err := g.blocked(s.m, s.m.Up); err != nil || len(blocked) > 0 {
+		t.Errorf("expected nothing blocked without change, got %v, %v", blocked, err)
+	}
+	// the plan of fresh has every migration
+	var plan bytes.Buffer
+	s.m.Plan = &plan
+	err := fromScratch(s.m, s.m.Up)()
+	s.m.Plan = nil
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan.String(), "-- 1/u init") || !strings.Contains(plan.String(), "-- 2/u users") {
+		t.Errorf("expected migrations 1 and 2 planned, got\n%v", plan.String())
+	}
+	if v, _, err := s.m.Version(); err != nil || v != 2 {
+		t.Errorf("expected version 2 after the plan, got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// historyEntry is an applied migration printed by historyCmd
+type historyEntry struct {
+	Version    uint   `json:"version"`
+	Direction  string `json:"direction"`
+	Identifier string `json:"identifier"`
+	User       string `json:"user"`
+	Hostname   string `json:"hostname"`
+	Applied    string `json:"applied"`
+	DurationMs int64  `json:"duration_ms"`
+	Checksum   string `json:"checksum"`
+	// ChecksumStatus compares the checksum with the migration file, see
+	// checksumStatus
+	ChecksumStatus string `json:"checksum_status"`
+}
+
+// checksumStatus compares the checksum of the applied migration r with its
+// file in src: "ok", "changed" if the file was edited afterwards, "missing"
+// if the file is gone, or "" if no checksum was recorded.
+func checksumStatus(src source.Driver, r database.HistoryRecord) string {
+	if r.Checksum == "" {
+		return ""
+	}
+	meta, err := source.Describe(src, r.Version, source.Direction(r.Direction))
+	if os.IsNotExist(err) {
+		return "missing"
+	} else if err != nil {
+		return "error: " + err.Error()
+	}
+	if meta.Checksum != r.Checksum {
+		return "changed"
+	}
+	return "ok"
+}
+
+// newHistoryEntries returns the entries of records, comparing their
+// checksums with the files of src
+func newHistoryEntries(src source.Driver, records []database.HistoryRecord) []historyEntry {
+	entries := make([]historyEntry, 0, len(records))
+	for _, r := range records {
+		entries = append(entries, historyEntry{
+			Version:        r.Version,
+			Direction:      r.Direction,
+			Identifier:     r.Identifier,
+			User:           r.User,
+			Hostname:       r.Hostname,
+			Applied:        r.Applied.Format(time.RFC3339),
+			DurationMs:     int64(r.Duration / time.Millisecond),
+			Checksum:       r.Checksum,
+			ChecksumStatus: checksumStatus(src, r),
+		})
+	}
+	return entries
+}
+
+// historyCmd (meant to be called via a CLI command) prints the last limit
+// (all if 0) migrations recorded with -history, the latest first
+func historyCmd(m *migrate.Migrate, src source.Driver, limit int, asJSON bool) {
+	records, err := m.History()
+	if err != nil {
+		log.fatal(fmt.Sprintf("error: reading the history failed, were migrations applied with -history? %v", err))
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	// the latest first
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	entries := newHistoryEntries(src, records)
+
+	if asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(entries); err != nil {
+			log.fatalErr(err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APPLIED\tVERSION\tDIRECTION\tNAME\tDURATION\tUSER\tHOST\tCHECKSUM")
+	for i, e := range entries {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", records[i].Applied.Local().Format("2006-01-02 15:04:05"),
+			e.Version, e.Direction, e.Identifier, time.Duration(e.DurationMs)*time.Millisecond, e.User, e.Hostname, e.ChecksumStatus)
+	}
+	if err := w.Flush(); err != nil {
+		log.fatalErr(err)
+	}
+}
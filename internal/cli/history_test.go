@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+)
+
+func TestChecksumStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "1_init.up.sql"), []byte("CREATE 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := source.Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	cases := []struct {
+		name     string
+		record   database.HistoryRecord
+		expected string
+	}{
+		{"ok", database.HistoryRecord{Version: 1, Direction: "up", Checksum: manifest.Checksum([]byte("CREATE 1"))}, "ok"},
+		{"changed", database.HistoryRecord{Version: 1, Direction: "up", Checksum: manifest.Checksum([]byte("CREATE 0"))}, "changed"},
+		{"missing", database.HistoryRecord{Version: 1, Direction: "down", Checksum: manifest.Checksum([]byte("DROP 1"))}, "missing"},
+		{"not recorded", database.HistoryRecord{Version: 1, Direction: "down"}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if status := checksumStatus(src, c.record); status != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/lint"
+)
+
+// newLinter returns a linter with the severities of rules set by
+// -severity name=level
+func newLinter(severities map[string]string) (*lint.Linter, error) {
+	l := &lint.Linter{}
+	for name, level := range severities {
+		severity, err := lint.ParseSeverity(level)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.SetSeverity(name, severity); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// lintCmd (meant to be called via a CLI command) prints the findings in the
+// up migrations of versions of src, or all of them if versions is nil, and
+// fails if there are errors
+func lintCmd(src source.Driver, versions []uint, l *lint.Linter) {
+	findings, err := l.Source(src, versions)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	errors, warnings := 0, 0
+	for _, f := range findings {
+		fmt.Println(f)
+		if f.Severity == lint.Error {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	if errors > 0 {
+		log.fatal(fmt.Sprintf("error: %v errors and %v warnings", errors, warnings))
+	}
+	if warnings > 0 {
+		log.Printf("%v warnings\n", warnings)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	logpkg "log"
 	"os"
+	"strings"
 )
 
 type Log struct {
 	verbose bool
+
+	// onFatal is called with the message before exiting on a fatal error
+	onFatal func(msg string)
 }
 
 func (l *Log) Printf(format string, v ...interface{}) {
@@ -32,6 +36,11 @@ func (l *Log) Verbose() bool {
 
 func (l *Log) fatal(args ...interface{}) {
 	l.Println(args...)
+	if l.onFatal != nil {
+		onFatal := l.onFatal
+		l.onFatal = nil
+		onFatal(strings.TrimSpace(fmt.Sprintln(args...)))
+	}
 	os.Exit(1)
 }
 
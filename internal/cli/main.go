@@ -3,6 +3,9 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -12,22 +15,126 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/lock"
+	"github.com/golang-migrate/migrate/v4/proxy"
+	"github.com/golang-migrate/migrate/v4/script"
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/approval"
+	"github.com/golang-migrate/migrate/v4/state"
+	"github.com/golang-migrate/migrate/v4/wasm"
 )
 
 const defaultTimeFormat = "20060102150405"
 
+// defaultApprovalDir is the directory of approve without -require-approval
+const defaultApprovalDir = "approvals"
+
 // set main log
 var log = &Log{}
 
+// varsFlag collects repeated -var name=value flags
+type varsFlag map[string]string
+
+func (v varsFlag) String() string {
+	return fmt.Sprint(map[string]string(v))
+}
+
+func (v varsFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 1 {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	v[s[:i]] = s[i+1:]
+	return nil
+}
+
+// globsFlag collects repeated -include and -exclude flags
+type globsFlag []string
+
+func (g *globsFlag) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globsFlag) Set(s string) error {
+	*g = append(*g, s)
+	return nil
+}
+
+// migraterFunc creates a Migrate configured by the flags, see Main
+type migraterFunc func(sourceURL, databaseURL, stateURL string) (m *migrate.Migrate, close func(), err error)
+
+// stateStore is a database or state driver keeping the version
+type stateStore interface {
+	database.StateStore
+	Close() error
+}
+
+// isStateURL reports whether url has the scheme of a state driver
+func isStateURL(url string) bool {
+	for _, name := range state.List() {
+		if strings.HasPrefix(url, name+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// openState opens url with the state driver of its scheme, if there is one,
+// or with the database driver otherwise.
+func openState(url string) (stateStore, error) {
+	if isStateURL(url) {
+		return state.Open(url)
+	}
+	return database.Open(url)
+}
+
 func Main(version string) {
 	helpPtr := flag.Bool("help", false, "")
 	versionPtr := flag.Bool("version", false, "")
 	verbosePtr := flag.Bool("verbose", false, "")
 	prefetchPtr := flag.Uint("prefetch", 10, "")
+	prefetchWorkersPtr := flag.Uint("prefetch-workers", 4, "")
 	lockTimeoutPtr := flag.Uint("lock-timeout", 15, "")
+	lockPtr := flag.String("lock", database.LockAdvisory, "")
+	targetMaxPtr := flag.Uint("target-max", 0, "")
+	strictOrderPtr := flag.Bool("strict-order", false, "")
+	requireDownPtr := flag.Bool("require-down", false, "")
+	strictEmptyPtr := flag.Bool("strict-empty", false, "")
+	sleepBetweenPtr := flag.Duration("sleep-between", 0, "")
+	lagQueryPtr := flag.String("replication-lag-query", "", "")
+	maxLagPtr := flag.Duration("max-replication-lag", 0, "")
+	atomicBatchPtr := flag.Bool("atomic-batch", false, "")
+	dryRunModePtr := flag.String("dry-run", "", "")
+	continueOnErrorPtr := flag.Bool("continue-on-error", false, "")
+	formatPtr := flag.String("format", formatText, "")
+	auditPtr := flag.Bool("audit", false, "")
+	fingerprintPtr := flag.Bool("fingerprint", false, "")
+	historyPtr := flag.Bool("history", false, "")
+	notifyURLPtr := flag.String("notify-url", "", "")
+	notifyTemplatePtr := flag.String("notify-template", "", "")
+	progressListenPtr := flag.String("progress-listen", "", "")
+	decryptCommandPtr := flag.String("decrypt-command", "", "")
+	manifestPtr := flag.String("manifest", "migrations.manifest", "")
+	verifySignaturePtr := flag.String("verify-signature", "", "")
+	requireApprovalPtr := flag.String("require-approval", "", "")
+	approvalKeysPtr := flag.String("approval-keys", "", "")
+	allowExecPtr := flag.Bool("allow-exec", false, "")
+	dependencyOrderPtr := flag.Bool("dependency-order", false, "")
+	var include, exclude globsFlag
+	flag.Var(&include, "include", "")
+	flag.Var(&exclude, "exclude", "")
+	noExpandEnvPtr := flag.Bool("no-expand-env", false, "")
+	pluginDirPtr := flag.String("plugin-dir", os.Getenv("MIGRATE_PLUGIN_DIR"), "")
+	proxyPtr := flag.String("proxy", "", "")
+	readOnlyPtr := flag.Bool("read-only", false, "")
+	guardsPtr := flag.String("guards", defaultGuardsFile, "")
+	breakGlassPtr := flag.String("break-glass", "", "")
+	vars := make(varsFlag)
+	flag.Var(vars, "var", "")
 	pathPtr := flag.String("path", "", "")
 	databasePtr := flag.String("database", "", "")
+	stateURLPtr := flag.String("state-url", "", "")
+	namespacePtr := flag.String("namespace", "", "")
 	sourcePtr := flag.String("source", "", "")
 
 	flag.Usage = func() {
@@ -39,26 +146,226 @@ Options:
   -source          Location of the migrations (driver://url)
   -path            Shorthand for -source=file://path
   -database        Run migrations against this database (driver://url)
+  -state-url       Keep the version, the lock and migrate's tables in this database (driver://url)
+                   instead, e.g. when -database is append-only or analytical like ClickHouse,
+                   or only the version in a state store, e.g. consul://host:8500 or dynamodb://table
+  -namespace NAME  Use the migrations in subdirectory NAME of -source and the version table
+                   schema_migrations_NAME, so that several services sharing a database can
+                   have independent migration streams
   -prefetch N      Number of migrations to load in advance before executing (default 10)
+  -prefetch-workers N
+                   Number of migrations to download at the same time while prefetching,
+                   which hides the latency of remote sources like s3:// (default 4)
   -lock-timeout N  Allow N seconds to acquire database lock (default 15)
+  -lock S          Lock with strategy S: advisory (the driver's locking, default), table
+                   (a row in table schema_lock, for drivers without locking), none,
+                   or the URL of a lock provider, e.g. redis://host:6379, etcd://host:2379
+                   or dynamodb://table
+  -target-max V    Never apply migrations above version V with up and goto, e.g. the last
+                   migration of the release being deployed
+  -strict-order    Refuse to run up, down and goto if versions are missing in sequentially numbered
+                   migrations, or, with -history, if a migration below the current version wasn't applied
+  -require-down    Refuse to run up and goto, and fail lint, if a migration to apply (or lint)
+                   has no down migration or an empty one
+  -strict-empty    Refuse to apply a migration which is empty or consists of comments only,
+                   instead of recording it as applied without running it
+  -sleep-between D Pause for duration D (e.g. 5s) between applied migrations
+  -replication-lag-query Q
+                   Between applied migrations, wait until query Q (returning the
+                   replication lag in seconds) reports at most -max-replication-lag
+  -max-replication-lag D
+                   Highest replication lag tolerated by -replication-lag-query (default 0s)
+  -audit           Record every run (user, host, command, result, ...) in table schema_migrations_audit
+  -fingerprint     After every successful goto, up and down, store a fingerprint of the schema
+                   in table schema_migrations_fingerprint, see the drift command
+  -history         Record every applied migration (checksum, user, host, time, duration)
+                   in table schema_migrations_history, see the history and tui commands
+  -atomic-batch    Apply all migrations of one run in a single transaction
+                   (requires a database with transactional DDL, not for exec migrations)
+  -dry-run transaction
+                   Run goto, up and down in a single transaction which is rolled back, to report
+                   errors and timing without changing the database, e.g. a replica of production
+                   (requires a database with transactional DDL)
+  -continue-on-error
+                   Go on with the next migration if one fails, e.g. for idempotent data migrations,
+                   report the failed ones at the end and exit with 1. Requires -history, which records
+                   the failed migrations to retry them with up -skipped
+  -format F        Format of the summary printed after goto, up and down: text (default) or json,
+                   which prints the applied, skipped and failed migrations with their durations,
+                   the lock wait time and the resulting version to stdout
+  -decrypt-command C
+                   Decrypt encrypted migrations by piping them through command C,
+                   e.g. "age --decrypt -i key.txt"
+  -manifest F      Signed manifest of the migrations (default migrations.manifest)
+  -verify-signature K
+                   Verify the signature of -manifest with SSH public key file K and
+                   refuse to apply migrations which aren't covered by it
+  -require-approval D
+                   Refuse to apply up migrations without approval in directory D, signed by
+                   one of the keys of -approval-keys, see the approve command
+  -approval-keys F Public SSH keys of the approvers, in the format of authorized_keys
+  -allow-exec      Allow migrations with the exec pragma, which run commands, see MIGRATIONS.md
+  -dependency-order
+                   Order migrations by their depends-on pragmas instead of their versions
+  -include G       Apply only the migrations whose name (VERSION_NAME) matches glob G,
+                   e.g. 'billing_*', can be repeated
+  -exclude G       Leave out the migrations whose name matches glob G, e.g. '*_bigdata*',
+                   can be repeated
+  -var NAME=VALUE  Set a variable for the conditions of migrations (-- migrate:if env == "dev"),
+                   can be repeated
+  -no-expand-env   Don't replace ${NAME} in -source and -database with environment variable NAME
+  -notify-url U    Post a summary of goto, up, down, rollback, apply-bundle, drop, fresh and force (applied migrations, duration,
+                   failure details) to webhook URL U, e.g. of Slack or Teams, as {"text": "..."}
+  -notify-template F
+                   Post the result of Go template file F instead, see cmd/migrate/README.md
+  -progress-listen A
+                   Stream the progress of goto, up, down, rollback, apply-bundle and fresh as server-sent
+                   events on address A, e.g. :8081, see cmd/migrate/README.md
+  -plugin-dir D    Load the Go plugins (*.so) in directory D (default $MIGRATE_PLUGIN_DIR),
+                   which register additional drivers, see cmd/migrate/README.md
+  -proxy U         Connect to the database and remote sources through SOCKS5 or HTTP proxy U,
+                   e.g. socks5://localhost:1080 (default $ALL_PROXY), see cmd/migrate/README.md
+  -read-only       Never write to the database: don't create the version table, don't lock,
+                   and fail commands which would write, e.g. for version, check and lock-status
+                   with read-only credentials (postgres, mysql and sqlite3)
+  -guards F        Guard rules in config file F (default migrate.guards.json, if it exists) blocking
+                   commands and destructive statements on databases whose URL matches, see cmd/migrate/README.md
+  -break-glass REASON
+                   Override the guard rules, recording REASON in table schema_migrations_audit
   -verbose         Print verbose logging
   -version         Print version
   -help            Print usage
 
 Commands:
-  create [-ext E] [-dir D] [-seq] [-digits N] [-format] NAME
+  create [-ext E] [-dir D] [-seq] [-digits N] [-format] [-semver V] [-ulid] [-up-only|-down-only] [-require-down] [-down-template F]
+         [-edit] [-editor E] [-max-length L] NAME
 			   Create a set of timestamped up/down migrations titled NAME, in directory D with extension E.
 			   Use -seq option to generate sequential up/down migrations with N digits.
 			   Use -format option to specify a Go time format string.
-  goto V       Migrate to version V
-  up [N]       Apply all or N up migrations
-  down [N]     Apply all or N down migrations
+			   Use -semver to prefix the migrations with release V and the next index within it, e.g. v1.4.2_001.
+			   Use -ulid to prefix the migrations with a ULID, which neither collide nor need renumbering.
+			   Without -seq, -digits, -format, -semver and -ulid, the convention of the existing migrations is continued.
+			   Use -up-only or -down-only to create only one of the files.
+			   Use -down-template to fill the down migration with the content of file F,
+			   -require-down refuses to create a migration with an empty down migration.
+			   Use -edit to open the created files in $VISUAL or $EDITOR, or -editor to name the editor.
+			   -require-down is checked after the editor is closed.
+			   NAME is turned into a file name friendly slug, which must not be used by another migration.
+			   File names are limited to L characters (default 255).
+  goto [-out F] V
+               Migrate to version V. Versions can be given by their alias in the aliases.yaml
+               of the source, e.g. goto pre-sharding, here and in force, show and approve
+  up [-from-snapshot F] [-out F] [N]
+               Apply all or N up migrations. With -from-snapshot, a fresh database is initialized
+               from snapshot file F first, so only the migrations after the snapshot are applied.
+               With -out, goto, up and down write the SQL they would run to file F instead,
+               split into statements with a comment per migration, e.g. for a review by a DBA
+  up [-tags S] [-skipped]
+               With -tags, apply only the migrations whose tags pragma (-- migrate:tags billing,slow)
+               is selected by S, e.g. '!slow' skips the migrations tagged slow. With -history, skipped
+               migrations are recorded and applied later with -skipped, which applies the skipped
+               migrations selected by -tags now without changing the version
+  up -all-modules [-modules F] [-two-phase]
+               Apply the modules listed in config file F (default migrate.modules.json) in order,
+               each with its own version table and lock, and print a summary, see cmd/migrate/README.md.
+               With -two-phase, commit the modules only once all succeeded, else roll all back
+  console      Open an interactive prompt to inspect the state, apply or revert migrations selected
+               with the arrow keys, view a migration and force a version, with one connection
+  tui          Browse the migrations with their state, checksum and applied time, preview their SQL
+               and apply or roll back to the selected one, needs -history for checksums and times
+  serve [-listen A] [-tls-cert F -tls-key F] [-client-ca F]
+               Serve a web dashboard on address A (default localhost:8080) with the version, history,
+               pending migrations and their SQL and the schema drift, and buttons to apply all or roll
+               back one migration, behind basic authentication with $MIGRATE_SERVE_TOKEN, and a REST API
+               under /api/v1 for clients with the token or a certificate of CA file F, see
+               cmd/migrate/README.md
+  watch [-delay D]
+               Apply new migrations of -path whenever they are written, for development databases.
+               Empty migrations, e.g. just created ones, are applied once they have content
+  down [-out F] [N]
+               Apply all or N down migrations
   drop         Drop everything inside database
+  tag [NAME]   Record the current version under tag NAME, e.g. a release of the application,
+               or list the tags without NAME
+  rollback -tag NAME
+               Migrate down to the version of tag NAME
+  fresh [-f]   Drop everything inside database, then apply all up migrations. -f skips the confirmation
+  reset [-f]   Revert all migrations one by one and apply them again, and report migrations without
+               down migration and tables left after reverting all. -f skips the confirmation
   force V      Set version V but don't run migration (ignores dirty state)
   version      Print current migration version
+  check [-max-pending N] [-json]
+               Fail if the database is dirty or more than N (default 0) migrations are pending,
+               -json prints the details as JSON
+  show V       Print the up and down migration of version V as they would run, with their pragmas
+               and checksums, and whether V is applied
+  pending [-count]
+               Print the migrations up would apply in order, with the size and destructive statements
+               (DROP TABLE, DROP COLUMN, DROP SCHEMA, TRUNCATE, DELETE) of their decoded body, or only
+               their number with -count
+  lint [-severity RULE=LEVEL]... [-pending] [-syntax D]
+               Check the up migrations, or only the pending ones, for operations unsafe under rolling
+               deploys (drop-column, rename-column, not-null-without-default, change-column-type,
+               blocking-index), set a rule to error, warning or off with -severity, see cmd/migrate/README.md
+               -syntax checks the SQL of dialect D (postgres, mysql or sqlite3) without a database
+  history [-limit N] [-json]
+               Print the last N (default all) migrations recorded with -history, the latest first,
+               with who applied them when, their duration and whether their file changed since
+  stats [-limit N] [-json]
+               Print the N (default 10) slowest migrations recorded with -history, with their last,
+               mean and longest duration, and the time it takes to apply all applied migrations
+  script [-out F]
+               Write the SQL of the pending migrations as change script F (default stdout) for a review,
+               headed by the current version and a checksum of the SQL
+  apply-script F
+               Run change script F written by script, failing if it was modified or the version of the
+               database changed since. Each migration of the script sets the version as usual
+  snapshot [-out F]
+               Write the schema of the database as SQL statements to file F (default stdout),
+               for reviewing diffs of the schema or as baseline
+  drift        Fail if the schema differs from the fingerprint stored by the last run with -fingerprint,
+               e.g. after manual changes
+  lock-status  Print who holds the lock (host, pid, user and since when)
+  unlock -force
+               Release the lock, even if it is held by someone else, e.g. a crashed process
+  test [-drop]  On an empty scratch database, apply, revert and apply again every migration,
+               then revert and apply all of them, and report irreversible and order dependent
+               migrations. -drop drops everything inside the database afterwards
+  fixtures load -set S [-dir D]
+               Empty the tables of fixture set S in directory D (default fixtures) and load
+               its CSV, JSON lines and SQL files, see MIGRATIONS.md
+  sign -key K  Write the checksums of all migrations to -manifest, signed with SSH private key file K
+  approve -key K [-dir D] V
+               Approve the up migration of version V for -require-approval, signed with SSH private
+               key file K, in directory D (default -require-approval or approvals)
+  bundle -out F -key K [-name N]
+               Package all migrations and their manifest, signed with SSH private key file K,
+               as release bundle F named N (default F without extension)
+  apply-bundle -key K F
+               Apply all up migrations of bundle F, after verifying its signature
+               with SSH public key file K
+  checksum [-lock F] write|verify
+               Write the checksums of all migrations to lock file F (default migrations.lock),
+               or fail if the migrations differ from it
+  renumber [-lock F] [-dry-run]
+               Rename the migrations in -path whose version is taken, e.g. after merging branches,
+               to the next free versions and print the renames. With -lock, the migrations recorded
+               in lock file F keep their version, others below its last version move as well, and
+               the moved migrations are recorded in F
+  graph [-dot] Print the migrations in dependency order, or their dependency graph in DOT format
+  doctor       Check the source, the database connection, the permissions on the version table,
+               locking and transactional DDL support, and print what needs to be fixed
+  ping [-timeout D]
+               Only connect to the database, failing after duration D (default 5s) with
+               the kind of error (dns, tls, auth, network or timeout)
+  wait-for-db [-timeout D] [-interval I]
+               Retry connecting to the database every I (default 1s) until it accepts
+               the credentials, failing after duration D (default 1m)
 
 Source drivers: `+strings.Join(source.List(), ", ")+`
-Database drivers: `+strings.Join(database.List(), ", ")+"\n")
+Database drivers: `+strings.Join(database.List(), ", ")+`
+Lock drivers: `+strings.Join(lock.List(), ", ")+`
+State drivers: `+strings.Join(state.List(), ", ")+"\n")
 	}
 
 	flag.Parse()
@@ -66,6 +373,22 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 	// initialize logger
 	log.verbose = *verbosePtr
 
+	if *formatPtr != formatText && *formatPtr != formatJSON {
+		log.fatal(fmt.Sprintf("error: unknown format %q, expected text or json", *formatPtr))
+	}
+
+	// load plugins before showing help, so that -help lists their drivers;
+	// -h and invalid flags print the usage while parsing, without them
+	if *pluginDirPtr != "" {
+		plugins, err := loadPlugins(*pluginDirPtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		if log.verbose {
+			log.Println("Loaded plugins", plugins)
+		}
+	}
+
 	// show cli version
 	if *versionPtr {
 		fmt.Fprintln(os.Stderr, version)
@@ -78,27 +401,215 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 		os.Exit(0)
 	}
 
+	if err := proxy.Set(*proxyPtr); err != nil {
+		log.fatalErr(err)
+	}
+	// remote sources send their requests with the default transport
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.Proxy = proxy.HTTP
+	}
+
 	// translate -path into -source if given
 	if *sourcePtr == "" && *pathPtr != "" {
 		*sourcePtr = fmt.Sprintf("file://%v", *pathPtr)
 	}
 
+	if !*noExpandEnvPtr {
+		for _, u := range []*string{sourcePtr, databasePtr, stateURLPtr} {
+			expanded, err := expandEnv(*u)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			*u = expanded
+		}
+	}
+
+	if *namespacePtr != "" {
+		if !namespaceName.MatchString(*namespacePtr) {
+			log.fatal("error: -namespace may only contain letters, digits and _")
+		}
+		if *sourcePtr != "" {
+			*sourcePtr = namespaceSource(*sourcePtr, *namespacePtr)
+		}
+		for _, u := range []*string{databasePtr, stateURLPtr} {
+			if *u == "" || isStateURL(*u) {
+				continue
+			}
+			namespaced, err := namespaceDatabase(*u, *namespacePtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			*u = namespaced
+		}
+	}
+
+	if *dependencyOrderPtr {
+		u, err := setQuery(*sourcePtr, "x-dependency-order", "true")
+		if err != nil {
+			log.fatalErr(err)
+		}
+		*sourcePtr = u
+	}
+
+	for _, g := range include {
+		*sourcePtr = addQuery(*sourcePtr, "x-include", g)
+	}
+	for _, g := range exclude {
+		*sourcePtr = addQuery(*sourcePtr, "x-exclude", g)
+	}
+
+	if *readOnlyPtr && *databasePtr != "" {
+		*databasePtr = addQuery(*databasePtr, database.ParamReadOnly, "true")
+	}
+	if *readOnlyPtr && *stateURLPtr != "" {
+		*stateURLPtr = addQuery(*stateURLPtr, database.ParamReadOnly, "true")
+	}
+
+	// ping and wait-for-db must not access the version table,
+	// which opening the database for migrate does
+	if flag.Arg(0) == "ping" {
+		pingFlagSet := flag.NewFlagSet("ping", flag.ExitOnError)
+		timeoutPtr := pingFlagSet.Duration("timeout", 5*time.Second, "Give up after this duration")
+		if err := pingFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		pingCmd(*databasePtr, *timeoutPtr)
+		return
+	}
+	if flag.Arg(0) == "wait-for-db" {
+		waitFlagSet := flag.NewFlagSet("wait-for-db", flag.ExitOnError)
+		timeoutPtr := waitFlagSet.Duration("timeout", time.Minute, "Give up after this duration")
+		intervalPtr := waitFlagSet.Duration("interval", time.Second, "Pause between attempts")
+		if err := waitFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		waitForDBCmd(*databasePtr, *timeoutPtr, *intervalPtr)
+		return
+	}
+
+	// apply-bundle reads the migrations from the bundle, verifying it
+	// when the source is opened
+	if flag.Arg(0) == "apply-bundle" {
+		applyFlagSet := flag.NewFlagSet("apply-bundle", flag.ExitOnError)
+		keyPtr := applyFlagSet.String("key", "", "SSH public key file")
+		if err := applyFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		if *keyPtr == "" {
+			log.fatal("error: -key flag must be specified")
+		}
+		if applyFlagSet.NArg() != 1 {
+			log.fatal("error: please specify the bundle file")
+		}
+		*sourcePtr = addQuery("bundle://"+applyFlagSet.Arg(0), "x-public-key", *keyPtr)
+	}
+
+	// newMigrater creates a Migrate configured by the flags. close closes it
+	// along with the state store and lock provider opened for it.
+	newMigrater := func(sourceURL, databaseURL, stateURL string) (m *migrate.Migrate, close func(), err error) {
+		m, err = migrate.New(sourceURL, databaseURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		var closers []io.Closer
+		close = func() {
+			if _, err := m.Close(); err != nil {
+				log.Println(err)
+			}
+			for _, c := range closers {
+				c.Close()
+			}
+		}
+		m.Log = log
+		m.PrefetchMigrations = *prefetchPtr
+		m.PrefetchWorkers = *prefetchWorkersPtr
+		m.LockTimeout = time.Duration(int64(*lockTimeoutPtr)) * time.Second
+		if stateURL != "" {
+			store, err := openState(stateURL)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			closers = append(closers, store)
+			m.State = store
+		}
+		if isLockURL(*lockPtr) {
+			locker, err := lock.Open(*lockPtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			closers = append(closers, locker)
+			m.Locker = locker
+		} else {
+			m.LockStrategy = *lockPtr
+		}
+		m.TargetMax = *targetMaxPtr
+		m.StrictOrder = *strictOrderPtr
+		m.RequireDown = *requireDownPtr
+		m.StrictEmpty = *strictEmptyPtr
+		m.SleepBetween = *sleepBetweenPtr
+		m.ReplicationLagQuery = *lagQueryPtr
+		m.MaxReplicationLag = *maxLagPtr
+		m.AtomicBatch = *atomicBatchPtr
+		m.ContinueOnError = *continueOnErrorPtr
+		switch *dryRunModePtr {
+		case "":
+		case "transaction":
+			m.DryRun = true
+		default:
+			log.fatal(fmt.Sprintf("error: unknown dry run mode %q, expected transaction", *dryRunModePtr))
+		}
+		m.AllowExec = *allowExecPtr
+		m.ReadOnly = *readOnlyPtr
+		m.Wasm = wasm.New()
+		m.Scripts = script.New()
+		if *auditPtr {
+			m.AuditTable = database.DefaultAuditTable
+			m.AuditClient = "migrate CLI " + version
+		}
+		if *fingerprintPtr {
+			m.FingerprintTable = database.DefaultFingerprintTable
+		}
+		if *historyPtr {
+			m.HistoryTable = database.DefaultHistoryTable
+		}
+		m.Variables = vars
+		if *decryptCommandPtr != "" {
+			decrypter, err := newCommandDecrypter(*decryptCommandPtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			m.Decrypter = decrypter
+		}
+		if *verifySignaturePtr != "" {
+			manifest, err := readSignedManifest(*manifestPtr, *verifySignaturePtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			m.Manifest = manifest
+		}
+		if *requireApprovalPtr != "" {
+			if *approvalKeysPtr == "" {
+				log.fatal("error: -require-approval needs -approval-keys")
+			}
+			keys, err := approval.ReadKeys(*approvalKeysPtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			m.Approvals = &approval.Dir{Path: *requireApprovalPtr, Keys: keys}
+		}
+		return m, close, nil
+	}
+
 	// initialize migrate
 	// don't catch migraterErr here and let each command decide
 	// how it wants to handle the error
-	migrater, migraterErr := migrate.New(*sourcePtr, *databasePtr)
+	migrater, closeMigrater, migraterErr := newMigrater(*sourcePtr, *databasePtr, *stateURLPtr)
 	defer func() {
 		if migraterErr == nil {
-			if _, err := migrater.Close(); err != nil {
-				log.Println(err)
-			}
+			closeMigrater()
 		}
 	}()
 	if migraterErr == nil {
-		migrater.Log = log
-		migrater.PrefetchMigrations = *prefetchPtr
-		migrater.LockTimeout = time.Duration(int64(*lockTimeoutPtr)) * time.Second
-
 		// handle Ctrl+c
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, syscall.SIGINT)
@@ -111,8 +622,66 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 		}()
 	}
 
+	explicitGuards := false
+	flag.Visit(func(f *flag.Flag) {
+		explicitGuards = explicitGuards || f.Name == "guards"
+	})
+	rules, err := readGuards(*guardsPtr, explicitGuards)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	guards := &guard{rules: rules, databaseURL: *databasePtr, breakGlass: *breakGlassPtr}
+	guards.command(migrater, flag.Arg(0))
+
 	startTime := time.Now()
 
+	var notify *notifier
+	if *notifyURLPtr != "" && notifyCommands[flag.Arg(0)] {
+		var err error
+		notify, err = newNotifier(*notifyURLPtr, *notifyTemplatePtr, flag.Arg(0), *sourcePtr, *databasePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		log.onFatal = func(msg string) {
+			if err := notify.notify(msg); err != nil {
+				log.Println("error:", err)
+			}
+		}
+		if migraterErr == nil {
+			migrater.OnApplied = notify.applied
+		}
+	}
+
+	var progress *progressServer
+	if *progressListenPtr != "" && progressCommands[flag.Arg(0)] && migraterErr == nil {
+		var err error
+		if progress, err = newProgressServer(*progressListenPtr); err != nil {
+			log.fatalErr(err)
+		}
+		if log.verbose {
+			log.Println("Streaming the progress on", progress.addr)
+		}
+		onFatal := log.onFatal
+		log.onFatal = func(msg string) {
+			progress.done(msg)
+			if onFatal != nil {
+				onFatal(msg)
+			}
+		}
+		onApplied := migrater.OnApplied
+		migrater.OnApplied = func(migr *migrate.Migration) {
+			progress.applied(migr)
+			if onApplied != nil {
+				onApplied(migr)
+			}
+		}
+		migrater.OnStart = progress.start
+		// up knows its total once N is read
+		if flag.Arg(0) != "up" {
+			progress.run(0)
+		}
+	}
+
 	switch flag.Arg(0) {
 	case "create":
 		args := flag.Args()[1:]
@@ -125,6 +694,15 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 		formatPtr := createFlagSet.String("format", defaultTimeFormat, `The Go time format string to use. If the string "unix" or "unixNano" is specified, then the seconds or nanoseconds since January 1, 1970 UTC respectively will be used. Caution, due to the behavior of time.Time.Format(), invalid format strings will not error`)
 		createFlagSet.BoolVar(&seq, "seq", seq, "Use sequential numbers instead of timestamps (default: false)")
 		createFlagSet.IntVar(&seqDigits, "digits", seqDigits, "The number of digits to use in sequences (default: 6)")
+		ulidPtr := createFlagSet.Bool("ulid", false, "Prefix the migration with a ULID, unique and ordered by time")
+		semverPtr := createFlagSet.String("semver", "", "Prefix the migration with this release and the next index within it, e.g. v1.4.2_001")
+		upOnlyPtr := createFlagSet.Bool("up-only", false, "Only create the up migration")
+		downOnlyPtr := createFlagSet.Bool("down-only", false, "Only create the down migration")
+		requireDownPtr := createFlagSet.Bool("require-down", false, "Refuse to create a migration with an empty down migration")
+		downTemplatePtr := createFlagSet.String("down-template", "", "File whose content is written into the down migration")
+		editPtr := createFlagSet.Bool("edit", false, "Open the created migrations in $VISUAL or $EDITOR")
+		editorPtr := createFlagSet.String("editor", "", "Open the created migrations in this editor")
+		maxLengthPtr := createFlagSet.Int("max-length", 255, "The maximum length of file names, 0 for no limit")
 		if err := createFlagSet.Parse(args); err != nil {
 			log.Println(err)
 		}
@@ -139,48 +717,214 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 		}
 		*extPtr = "." + strings.TrimPrefix(*extPtr, ".")
 
-		createCmd(*dirPtr, startTime, *formatPtr, name, *extPtr, seq, seqDigits)
+		// continue the naming convention of existing migrations,
+		// unless it is given explicitly
+		explicit := false
+		createFlagSet.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "seq", "digits", "format", "semver", "ulid":
+				explicit = true
+			}
+		})
+		if !explicit {
+			naming, err := detectNaming(cleanDir(*dirPtr), *extPtr, namingConvention{seq: seq, seqDigits: seqDigits, format: *formatPtr})
+			if err != nil {
+				log.fatalErr(err)
+			}
+			seq, seqDigits, *formatPtr = naming.seq, naming.seqDigits, naming.format
+		}
+
+		policy := filePolicy{up: !*downOnlyPtr, down: !*upOnlyPtr, requireDown: *requireDownPtr}
+		if *downTemplatePtr != "" {
+			body, err := ioutil.ReadFile(*downTemplatePtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			policy.downTemplate = body
+		}
+
+		var edit func(files []string) error
+		if *editPtr || *editorPtr != "" {
+			edit = editFiles(editor(*editorPtr))
+		}
+
+		createCmd(*dirPtr, startTime, *formatPtr, name, *extPtr, seq, seqDigits, *semverPtr, *ulidPtr, *maxLengthPtr, policy, edit)
 
 	case "goto":
 		if migraterErr != nil {
 			log.fatalErr(migraterErr)
 		}
 
-		if flag.Arg(1) == "" {
+		gotoFlagSet := flag.NewFlagSet("goto", flag.ExitOnError)
+		outPtr := gotoFlagSet.String("out", "", "Write the SQL to this file instead of running it")
+		if err := gotoFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		if gotoFlagSet.Arg(0) == "" {
 			log.fatal("error: please specify version argument V")
 		}
 
-		v, err := strconv.ParseUint(flag.Arg(1), 10, 64)
+		v, err := migrater.ResolveVersion(gotoFlagSet.Arg(0))
 		if err != nil {
-			log.fatal("error: can't read version argument V")
+			log.fatalErr(err)
 		}
 
-		gotoCmd(migrater, uint(v))
+		closePlan := func() {}
+		if *outPtr != "" {
+			closePlan = planCmd(migrater, *outPtr)
+		}
+		guards.statements(migrater, "goto", func() error {
+			return migrater.Migrate(v)
+		})
+		gotoCmd(migrater, v, *formatPtr)
+		closePlan()
 
 		if log.verbose {
 			log.Println("Finished after", time.Since(startTime))
 		}
 
 	case "up":
+		upFlagSet := flag.NewFlagSet("up", flag.ExitOnError)
+		fromSnapshotPtr := upFlagSet.String("from-snapshot", "", "Initialize a fresh database from this snapshot first")
+		allModulesPtr := upFlagSet.Bool("all-modules", false, "Apply every module of -modules in order")
+		modulesPtr := upFlagSet.String("modules", defaultModulesFile, "Config file listing the modules")
+		twoPhasePtr := upFlagSet.Bool("two-phase", false, "With -all-modules, commit the modules only once all succeeded")
+		outPtr := upFlagSet.String("out", "", "Write the SQL to this file instead of running it")
+		tagsPtr := upFlagSet.String("tags", "", "Apply only the migrations whose tags are selected, e.g. '!slow'")
+		skippedPtr := upFlagSet.Bool("skipped", false, "Apply the migrations skipped by an earlier -tags")
+		if err := upFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		if *twoPhasePtr && !*allModulesPtr {
+			log.fatal("error: -two-phase needs -all-modules")
+		}
+		if *allModulesPtr {
+			if upFlagSet.NArg() > 0 || *fromSnapshotPtr != "" || *namespacePtr != "" || *outPtr != "" || *tagsPtr != "" || *skippedPtr {
+				log.fatal("error: -all-modules can't be combined with N, -from-snapshot, -namespace, -out, -tags or -skipped")
+			}
+			modules, err := readModules(*modulesPtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			var onApplied func(migr *migrate.Migration)
+			if notify != nil {
+				onApplied = notify.applied
+			}
+			upModulesCmd(modules, *databasePtr, *stateURLPtr, !*noExpandEnvPtr, *twoPhasePtr, newMigrater, onApplied, guards)
+			if log.verbose {
+				log.Println("Finished after", time.Since(startTime))
+			}
+			break
+		}
+
 		if migraterErr != nil {
 			log.fatalErr(migraterErr)
 		}
 
+		migrater.SelectTags = *tagsPtr
+		if *skippedPtr {
+			if upFlagSet.NArg() > 0 || *fromSnapshotPtr != "" || *outPtr != "" {
+				log.fatal("error: -skipped can't be combined with N, -from-snapshot or -out")
+			}
+			guards.statements(migrater, "up", migrater.ApplySkipped)
+			if progress != nil {
+				progress.run(0)
+			}
+			applySkippedCmd(migrater, *formatPtr)
+			if log.verbose {
+				log.Println("Finished after", time.Since(startTime))
+			}
+			break
+		}
+
 		limit := -1
-		if flag.Arg(1) != "" {
-			n, err := strconv.ParseUint(flag.Arg(1), 10, 64)
+		if upFlagSet.Arg(0) != "" {
+			n, err := strconv.ParseUint(upFlagSet.Arg(0), 10, 64)
 			if err != nil {
 				log.fatal("error: can't read limit argument N")
 			}
 			limit = int(n)
 		}
 
-		upCmd(migrater, limit)
+		if *fromSnapshotPtr != "" {
+			if *outPtr != "" {
+				log.fatal("error: -from-snapshot can't be combined with -out")
+			}
+			loadSnapshotCmd(migrater, *fromSnapshotPtr, guards)
+		}
+		closePlan := func() {}
+		if *outPtr != "" {
+			closePlan = planCmd(migrater, *outPtr)
+		}
+		guards.statements(migrater, "up", func() error {
+			if limit >= 0 {
+				return migrater.Steps(limit)
+			}
+			return migrater.Up()
+		})
+		if progress != nil {
+			progress.run(pendingTotal(migrater, limit))
+		}
+		upCmd(migrater, limit, *formatPtr)
+		closePlan()
 
 		if log.verbose {
 			log.Println("Finished after", time.Since(startTime))
 		}
 
+	case "console":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+		consoleCmd(migrater, guards)
+
+	case "tui":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+		tuiCmd(migrater, *sourcePtr, guards)
+
+	case "serve":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		serveFlagSet := flag.NewFlagSet("serve", flag.ExitOnError)
+		listenPtr := serveFlagSet.String("listen", "localhost:8080", "Address to serve the dashboard on")
+		tlsCertPtr := serveFlagSet.String("tls-cert", "", "Certificate file to serve over TLS with")
+		tlsKeyPtr := serveFlagSet.String("tls-key", "", "Key file of -tls-cert")
+		clientCAPtr := serveFlagSet.String("client-ca", "", "CA certificates file authenticating API clients by their certificate")
+		if err := serveFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		tlsConfig, err := serveTLSConfig(*tlsCertPtr, *tlsKeyPtr, *clientCAPtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		serveCmd(migrater, src, guards, *listenPtr, os.Getenv(serveTokenEnv), tlsConfig)
+
+	case "watch":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		watchFlagSet := flag.NewFlagSet("watch", flag.ExitOnError)
+		delayPtr := watchFlagSet.Duration("delay", 500*time.Millisecond, "Apply once the directory was quiet for this duration")
+		if err := watchFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		watchCmd(*sourcePtr, *delayPtr, guards, func() (*migrate.Migrate, func(), error) {
+			return newMigrater(*sourcePtr, *databasePtr, *stateURLPtr)
+		})
+
 	case "down":
 		if migraterErr != nil {
 			log.fatalErr(migraterErr)
@@ -188,6 +932,7 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 
 		downFlagSet := flag.NewFlagSet("down", flag.ExitOnError)
 		applyAll := downFlagSet.Bool("all", false, "Apply all down migrations")
+		outPtr := downFlagSet.String("out", "", "Write the SQL to this file instead of running it")
 
 		args := flag.Args()[1:]
 		if err := downFlagSet.Parse(args); err != nil {
@@ -199,7 +944,8 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 		if err != nil {
 			log.fatalErr(err)
 		}
-		if needsConfirm {
+		// writing the SQL of all down migrations is harmless
+		if needsConfirm && *outPtr == "" {
 			log.Println("Are you sure you want to apply all down migrations? [y/N]")
 			var response string
 			fmt.Scanln(&response)
@@ -212,7 +958,18 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 			}
 		}
 
-		downCmd(migrater, num)
+		closePlan := func() {}
+		if *outPtr != "" {
+			closePlan = planCmd(migrater, *outPtr)
+		}
+		guards.statements(migrater, "down", func() error {
+			if num >= 0 {
+				return migrater.Steps(-num)
+			}
+			return migrater.Down()
+		})
+		downCmd(migrater, num, *formatPtr)
+		closePlan()
 
 		if log.verbose {
 			log.Println("Finished after", time.Since(startTime))
@@ -223,12 +980,106 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 			log.fatalErr(migraterErr)
 		}
 
+		guards.drops(migrater, "drop")
 		dropCmd(migrater)
 
 		if log.verbose {
 			log.Println("Finished after", time.Since(startTime))
 		}
 
+	case "tag":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+		tagCmd(migrater, flag.Arg(1))
+
+	case "rollback":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		rollbackFlagSet := flag.NewFlagSet("rollback", flag.ExitOnError)
+		tagPtr := rollbackFlagSet.String("tag", "", "Migrate down to the version of this tag")
+		if err := rollbackFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		if *tagPtr == "" {
+			log.fatal("error: please specify the tag with -tag")
+		}
+
+		guards.statements(migrater, "rollback", func() error {
+			return migrater.RollbackToTag(*tagPtr)
+		})
+		rollbackCmd(migrater, *tagPtr)
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
+	case "fresh":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		freshFlagSet := flag.NewFlagSet("fresh", flag.ExitOnError)
+		forcePtr := freshFlagSet.Bool("f", false, "Don't ask for confirmation")
+		if err := freshFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		if !*forcePtr {
+			log.Println("Are you sure you want to drop everything inside the database and apply all up migrations? [y/N]")
+			var response string
+			fmt.Scanln(&response)
+			response = strings.ToLower(strings.TrimSpace(response))
+
+			if response != "y" {
+				log.fatal("Not dropping the database")
+			}
+		}
+
+		guards.drops(migrater, "fresh")
+		guards.statements(migrater, "fresh", fromScratch(migrater, migrater.Up))
+		freshCmd(migrater)
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
+	case "reset":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		resetFlagSet := flag.NewFlagSet("reset", flag.ExitOnError)
+		forcePtr := resetFlagSet.Bool("f", false, "Don't ask for confirmation")
+		if err := resetFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		if !*forcePtr {
+			log.Println("Are you sure you want to revert all migrations and apply them again? [y/N]")
+			var response string
+			fmt.Scanln(&response)
+			response = strings.ToLower(strings.TrimSpace(response))
+
+			if response != "y" {
+				log.fatal("Not resetting the database")
+			}
+		}
+
+		guards.statements(migrater, "reset", func() error {
+			if err := migrater.Down(); err != nil && err != migrate.ErrNoChange {
+				return err
+			}
+			return fromScratch(migrater, migrater.Up)()
+		})
+		resetCmd(migrater)
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
 	case "force":
 		if migraterErr != nil {
 			log.fatalErr(migraterErr)
@@ -240,7 +1091,11 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 
 		v, err := strconv.ParseInt(flag.Arg(1), 10, 64)
 		if err != nil {
-			log.fatal("error: can't read version argument V")
+			alias, err := migrater.ResolveVersion(flag.Arg(1))
+			if err != nil {
+				log.fatalErr(err)
+			}
+			v = int64(alias)
 		}
 
 		if v < -1 {
@@ -260,6 +1115,381 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 
 		versionCmd(migrater)
 
+	case "check":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		checkFlagSet := flag.NewFlagSet("check", flag.ExitOnError)
+		maxPendingPtr := checkFlagSet.Int("max-pending", 0, "Number of pending migrations tolerated")
+		jsonPtr := checkFlagSet.Bool("json", false, "Print the details as JSON")
+		if err := checkFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		checkCmd(migrater, *maxPendingPtr, *jsonPtr)
+
+	case "show":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if flag.Arg(1) == "" {
+			log.fatal("error: please specify version argument V")
+		}
+
+		v, err := migrater.ResolveVersion(flag.Arg(1))
+		if err != nil {
+			log.fatalErr(err)
+		}
+
+		showCmd(migrater, v)
+
+	case "pending":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		pendingFlagSet := flag.NewFlagSet("pending", flag.ExitOnError)
+		countPtr := pendingFlagSet.Bool("count", false, "Print only the number of pending migrations")
+		if err := pendingFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		pendingCmd(migrater, *countPtr)
+
+	case "lint":
+		lintFlagSet := flag.NewFlagSet("lint", flag.ExitOnError)
+		severities := varsFlag{}
+		lintFlagSet.Var(severities, "severity", "Set the severity of a rule, as rule=error, warning or off")
+		pendingPtr := lintFlagSet.Bool("pending", false, "Lint only the pending migrations of -database")
+		syntaxPtr := lintFlagSet.String("syntax", "", "Check the syntax of migrations for dialect D, postgres, mysql or sqlite3")
+		if err := lintFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		linter, err := newLinter(severities)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		linter.RequireDown = *requireDownPtr
+		if *syntaxPtr != "" {
+			if err := linter.SetDialect(*syntaxPtr); err != nil {
+				log.fatalErr(err)
+			}
+		}
+
+		var versions []uint
+		if *pendingPtr {
+			if migraterErr != nil {
+				log.fatalErr(migraterErr)
+			}
+			if versions, err = migrater.Pending(); err != nil {
+				log.fatalErr(err)
+			}
+			if len(versions) == 0 {
+				break
+			}
+		}
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		lintCmd(src, versions, linter)
+		if err := src.Close(); err != nil {
+			log.Println(err)
+		}
+
+	case "history":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		historyFlagSet := flag.NewFlagSet("history", flag.ExitOnError)
+		limitPtr := historyFlagSet.Int("limit", 0, "Number of migrations printed, 0 for all")
+		jsonPtr := historyFlagSet.Bool("json", false, "Print the migrations as JSON")
+		if err := historyFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		historyCmd(migrater, src, *limitPtr, *jsonPtr)
+		if err := src.Close(); err != nil {
+			log.Println(err)
+		}
+
+	case "stats":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		statsFlagSet := flag.NewFlagSet("stats", flag.ExitOnError)
+		limitPtr := statsFlagSet.Int("limit", 10, "Number of migrations printed, 0 for all")
+		jsonPtr := statsFlagSet.Bool("json", false, "Print the stats as JSON")
+		if err := statsFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		statsCmd(migrater, *limitPtr, *jsonPtr)
+
+	case "script":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		scriptFlagSet := flag.NewFlagSet("script", flag.ExitOnError)
+		outPtr := scriptFlagSet.String("out", "", "File to write the change script to, stdout if empty")
+		if err := scriptFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		scriptCmd(migrater, *outPtr)
+
+	case "apply-script":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if flag.Arg(1) == "" {
+			log.fatal("error: please specify the change script F")
+		}
+
+		script, err := ioutil.ReadFile(flag.Arg(1))
+		if err != nil {
+			log.fatalErr(err)
+		}
+		guards.plan(migrater, "apply-script", script)
+		applyScriptCmd(migrater, flag.Arg(1))
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
+	case "snapshot":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		snapshotFlagSet := flag.NewFlagSet("snapshot", flag.ExitOnError)
+		outPtr := snapshotFlagSet.String("out", "", "Write the snapshot to this file instead of stdout")
+		if err := snapshotFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		snapshotCmd(migrater, *outPtr)
+
+	case "drift":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+		driftCmd(migrater)
+
+	case "lock-status":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+		lockStatusCmd(migrater)
+
+	case "unlock":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		unlockFlagSet := flag.NewFlagSet("unlock", flag.ExitOnError)
+		forcePtr := unlockFlagSet.Bool("force", false, "Release the lock, even if it is held by someone else")
+		if err := unlockFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		if !*forcePtr {
+			log.fatal("error: the lock might be held by a running migration, use -force to release it anyway")
+		}
+
+		unlockCmd(migrater)
+
+	case "test":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
+		dropPtr := testFlagSet.Bool("drop", false, "Drop everything inside the database afterwards")
+		if err := testFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		if *dropPtr {
+			guards.drops(migrater, "test")
+		}
+		// the migrations are applied, reverted and applied again
+		guards.statements(migrater, "test", func() error {
+			if err := fromScratch(migrater, migrater.Up)(); err != nil && err != migrate.ErrNoChange {
+				return err
+			}
+			last, err := lastVersion(migrater)
+			if err != nil {
+				return err
+			}
+			return atVersion(migrater, last, migrater.Down)()
+		})
+		testCmd(migrater, *dropPtr)
+
+	case "fixtures":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		fixturesFlagSet := flag.NewFlagSet("fixtures", flag.ExitOnError)
+		setPtr := fixturesFlagSet.String("set", "", "Name of the fixture set")
+		dirPtr := fixturesFlagSet.String("dir", migrate.DefaultFixturesDir, "Directory of the fixture sets")
+		if len(flag.Args()) < 2 || flag.Arg(1) != "load" {
+			log.fatal("error: please specify load")
+		}
+		if err := fixturesFlagSet.Parse(flag.Args()[2:]); err != nil {
+			log.fatalErr(err)
+		}
+		if *setPtr == "" {
+			log.fatal("error: -set flag must be specified")
+		}
+
+		guards.fixtures(migrater, *dirPtr, *setPtr)
+		fixturesLoadCmd(migrater, *dirPtr, *setPtr)
+
+	case "sign":
+		signFlagSet := flag.NewFlagSet("sign", flag.ExitOnError)
+		keyPtr := signFlagSet.String("key", "", "SSH private key file")
+		if err := signFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		if *keyPtr == "" {
+			log.fatal("error: -key flag must be specified")
+		}
+
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		signCmd(src, *keyPtr, *manifestPtr)
+		if err := src.Close(); err != nil {
+			log.Println(err)
+		}
+
+	case "approve":
+		approveFlagSet := flag.NewFlagSet("approve", flag.ExitOnError)
+		keyPtr := approveFlagSet.String("key", "", "SSH private key file of the approver")
+		dir := *requireApprovalPtr
+		if dir == "" {
+			dir = defaultApprovalDir
+		}
+		dirPtr := approveFlagSet.String("dir", dir, "Directory of the approvals")
+		if err := approveFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		if *keyPtr == "" {
+			log.fatal("error: -key flag must be specified")
+		}
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		v, err := source.ResolveVersion(src, approveFlagSet.Arg(0))
+		if err != nil {
+			log.fatalErr(err)
+		}
+		approveCmd(src, v, *keyPtr, *dirPtr)
+		if err := src.Close(); err != nil {
+			log.Println(err)
+		}
+
+	case "bundle":
+		bundleFlagSet := flag.NewFlagSet("bundle", flag.ExitOnError)
+		outPtr := bundleFlagSet.String("out", "", "Bundle file")
+		keyPtr := bundleFlagSet.String("key", "", "SSH private key file")
+		namePtr := bundleFlagSet.String("name", "", "Name of the bundle, e.g. the release")
+		if err := bundleFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		if *outPtr == "" || *keyPtr == "" {
+			log.fatal("error: -out and -key flags must be specified")
+		}
+
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		bundleCmd(src, *keyPtr, *outPtr, *namePtr, "migrate CLI "+version)
+		if err := src.Close(); err != nil {
+			log.Println(err)
+		}
+
+	case "apply-bundle":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		guards.statements(migrater, "apply-bundle", migrater.Up)
+		upCmd(migrater, -1, *formatPtr)
+
+		if log.verbose {
+			log.Println("Finished after", time.Since(startTime))
+		}
+
+	case "checksum":
+		checksumFlagSet := flag.NewFlagSet("checksum", flag.ExitOnError)
+		lockPtr := checksumFlagSet.String("lock", "migrations.lock", "Lock file")
+		if err := checksumFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		action := checksumFlagSet.Arg(0)
+		if action != "write" && action != "verify" {
+			log.fatal("error: please specify write or verify")
+		}
+
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		if action == "write" {
+			checksumWriteCmd(src, *lockPtr)
+		} else {
+			checksumVerifyCmd(src, *lockPtr)
+		}
+		if err := src.Close(); err != nil {
+			log.Println(err)
+		}
+
+	case "renumber":
+		renumberFlagSet := flag.NewFlagSet("renumber", flag.ExitOnError)
+		lockPtr := renumberFlagSet.String("lock", "", "Lock file recording the migrations which keep their version")
+		dryRunPtr := renumberFlagSet.Bool("dry-run", false, "Print the renames without renaming")
+		if err := renumberFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+		if *pathPtr == "" {
+			log.fatal("error: -path flag must be specified")
+		}
+		renumberCmd(*pathPtr, *lockPtr, *dryRunPtr)
+
+	case "graph":
+		graphFlagSet := flag.NewFlagSet("graph", flag.ExitOnError)
+		dotPtr := graphFlagSet.Bool("dot", false, "Print the dependency graph in Graphviz DOT format")
+		if err := graphFlagSet.Parse(flag.Args()[1:]); err != nil {
+			log.fatalErr(err)
+		}
+
+		src, err := source.Open(*sourcePtr)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		graphCmd(src, *dotPtr)
+		if err := src.Close(); err != nil {
+			log.Println(err)
+		}
+
+	case "doctor":
+		doctorCmd(*sourcePtr, *databasePtr, *lockPtr, time.Duration(int64(*lockTimeoutPtr))*time.Second)
+
 	default:
 		flag.Usage()
 
@@ -267,4 +1497,13 @@ Database drivers: `+strings.Join(database.List(), ", ")+"\n")
 		// of flag.Parse() with flag.ExitOnError when parsing an invalid flag.
 		os.Exit(2)
 	}
+
+	if notify != nil {
+		if err := notify.notify(""); err != nil {
+			log.Println("error:", err)
+		}
+	}
+	if progress != nil {
+		progress.done("")
+	}
 }
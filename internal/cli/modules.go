@@ -0,0 +1,372 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// defaultModulesFile is the config file of up -all-modules
+const defaultModulesFile = "migrate.modules.json"
+
+// module is a directory of migrations applied by up -all-modules
+type module struct {
+	// Path is the directory of the migrations, relative to the config file
+	Path string `json:"path"`
+	// Namespace suffixes the version table, like -namespace
+	Namespace string `json:"namespace"`
+	// Database is the URL of the database, -database if empty
+	Database string `json:"database"`
+}
+
+// name identifies the module in the summary
+func (mod module) name() string {
+	if mod.Namespace != "" {
+		return mod.Namespace
+	}
+	return mod.Path
+}
+
+// readModules reads the modules of config file, e.g.
+//  {"modules": [
+//    {"path": "billing/migrations", "namespace": "billing"},
+//    {"path": "search/migrations", "database": "postgres://search-db:5432/search"}
+//  ]}
+func readModules(file string) ([]module, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Modules []module `json:"modules"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", file, err)
+	}
+	if len(config.Modules) == 0 {
+		return nil, fmt.Errorf("%v lists no modules", file)
+	}
+
+	// modules sharing a database must not share a version table
+	tables := make(map[string]string)
+	for i, mod := range config.Modules {
+		if mod.Path == "" {
+			return nil, fmt.Errorf("module %v of %v has no path", i+1, file)
+		}
+		if mod.Namespace != "" && !namespaceName.MatchString(mod.Namespace) {
+			return nil, fmt.Errorf("namespace %q of module %v may only contain letters, digits and _", mod.Namespace, mod.Path)
+		}
+		table := mod.Database + "\n" + mod.Namespace
+		if other, ok := tables[table]; ok {
+			return nil, fmt.Errorf("modules %v and %v share a version table, give them different namespaces", other, mod.Path)
+		}
+		tables[table] = mod.Path
+		if !filepath.IsAbs(mod.Path) {
+			config.Modules[i].Path = filepath.Join(filepath.Dir(file), mod.Path)
+		}
+	}
+	return config.Modules, nil
+}
+
+// moduleRun is the result of a module, a line of the summary
+type moduleRun struct {
+	module   module
+	from, to string
+	applied  int
+	duration time.Duration
+	err      error
+	skipped  bool
+	// rolledBack is set for a module of -two-phase which was rolled back
+	// as another module failed
+	rolledBack bool
+}
+
+func (r *moduleRun) result() string {
+	switch {
+	case r.skipped:
+		return "skipped"
+	case r.rolledBack:
+		return "rolled back"
+	case r.err != nil:
+		return "failed: " + r.err.Error()
+	case r.applied == 0:
+		return "no change"
+	}
+	return "ok"
+}
+
+// moduleURLs returns the source, database and state URLs of mod. The
+// database and state of mod default to databaseURL and stateURL.
+func moduleURLs(mod module, databaseURL, stateURL string, expand bool) (string, string, string, error) {
+	db := mod.Database
+	if db == "" {
+		db = databaseURL
+	} else if expand {
+		expanded, err := expandEnv(db)
+		if err != nil {
+			return "", "", "", err
+		}
+		db = expanded
+	}
+	if db == "" {
+		return "", "", "", fmt.Errorf("module %v has no database and -database isn't set", mod.Path)
+	}
+	st := stateURL
+	if mod.Namespace != "" {
+		var err error
+		if db, err = namespaceDatabase(db, mod.Namespace); err != nil {
+			return "", "", "", err
+		}
+		if st != "" && !isStateURL(st) {
+			if st, err = namespaceDatabase(st, mod.Namespace); err != nil {
+				return "", "", "", err
+			}
+		}
+	}
+	return "file://" + mod.Path, db, st, nil
+}
+
+// upModulesCmd applies the modules in order with a Migrate of their own,
+// so each module is locked while it's applied. It stops at the first
+// failed module and prints a summary of all modules. With twoPhase, see
+// upModulesTwoPhase, the modules are committed only once all succeeded.
+// The guard rules of the modules' databases are checked before any is
+// applied.
+func upModulesCmd(modules []module, databaseURL, stateURL string, expand, twoPhase bool,
+	newMigrater migraterFunc, onApplied func(migr *migrate.Migration), guards *guard) {
+
+	for _, mod := range modules {
+		guardModule(mod, databaseURL, stateURL, expand, newMigrater, guards)
+	}
+
+	var mu sync.Mutex
+	var current *migrate.Migrate
+	stopped := false
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT)
+	defer signal.Stop(signals)
+	go func() {
+		for range signals {
+			log.Println("Stopping after this running migration ...")
+			mu.Lock()
+			stopped = true
+			if current != nil {
+				current.GracefulStop <- true
+			}
+			mu.Unlock()
+			return
+		}
+	}()
+
+	started := func(m *migrate.Migrate) {
+		mu.Lock()
+		current = m
+		mu.Unlock()
+	}
+	isStopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return stopped
+	}
+
+	var runs []*moduleRun
+	var failed error
+	if twoPhase {
+		if runs, failed = upModulesTwoPhase(modules, databaseURL, stateURL, expand, started, isStopped, newMigrater, onApplied); runs == nil {
+			log.fatalErr(failed)
+		}
+	} else {
+		runs = make([]*moduleRun, len(modules))
+		for i, mod := range modules {
+			run := &moduleRun{module: mod}
+			runs[i] = run
+			if failed != nil || isStopped() {
+				run.skipped = true
+				continue
+			}
+
+			log.Printf("Applying module %v\n", mod.name())
+			start := time.Now()
+			run.err = upModule(run, databaseURL, stateURL, expand, started, newMigrater, onApplied)
+			run.duration = time.Since(start)
+			failed = run.err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tFROM\tTO\tAPPLIED\tDURATION\tRESULT")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", run.module.name(), run.from, run.to,
+			run.applied, run.duration.Round(time.Millisecond), run.result())
+	}
+	if err := w.Flush(); err != nil {
+		log.fatalErr(err)
+	}
+	if failed != nil {
+		log.fatalErr(failed)
+	}
+}
+
+// preparedModule is a module of upModulesTwoPhase whose migrations were
+// applied in a transaction, which waits for the decision to commit
+type preparedModule struct {
+	run   *moduleRun
+	start time.Time
+	// decision commits the transaction if nil, and rolls it back otherwise
+	decision chan error
+	// done is the result of the module once its transaction ended
+	done chan error
+}
+
+// upModulesTwoPhase applies the modules in two phases, so that a failure
+// doesn't leave some databases migrated and others not. First, the modules
+// are prepared in order: their migrations are applied in a transaction,
+// see migrate.Migrate.AtomicBatch, which stays open. If every module was
+// prepared, they are committed in order, otherwise all are rolled back. If
+// a commit fails, the modules after it are still rolled back. The modules
+// need databases of their own, as each holds its lock until the end, and
+// drivers with transactions. It returns the runs, or nil if it couldn't
+// start, and the error of the failed module, if any.
+func upModulesTwoPhase(modules []module, databaseURL, stateURL string, expand bool, started func(m *migrate.Migrate),
+	stopped func() bool, newMigrater migraterFunc, onApplied func(migr *migrate.Migration)) ([]*moduleRun, error) {
+
+	databases := make(map[string]string)
+	for _, mod := range modules {
+		if other, ok := databases[mod.Database]; ok {
+			return nil, fmt.Errorf("modules %v and %v share a database, whose lock they can't both hold with -two-phase", other, mod.name())
+		}
+		databases[mod.Database] = mod.name()
+	}
+
+	runs := make([]*moduleRun, len(modules))
+	var prepared []*preparedModule
+	var failed error
+	for i, mod := range modules {
+		run := &moduleRun{module: mod}
+		runs[i] = run
+		if failed != nil || stopped() {
+			run.skipped = true
+			continue
+		}
+
+		log.Printf("Preparing module %v\n", mod.name())
+		p := &preparedModule{run: run, start: time.Now(), decision: make(chan error, 1), done: make(chan error, 1)}
+		ready := make(chan struct{})
+		go func() {
+			p.done <- upModule(run, databaseURL, stateURL, expand, func(m *migrate.Migrate) {
+				m.AtomicBatch = true
+				m.BeforeCommit = func() error {
+					close(ready)
+					return <-p.decision
+				}
+				started(m)
+			}, newMigrater, onApplied)
+		}()
+		select {
+		case <-ready:
+			prepared = append(prepared, p)
+		case err := <-p.done:
+			// failed, or nothing to commit
+			run.duration = time.Since(p.start)
+			run.err = err
+			failed = err
+		}
+	}
+
+	abort := failed
+	if abort == nil && stopped() {
+		abort = errors.New("stopped")
+		failed = abort
+	}
+	for _, p := range prepared {
+		if abort == nil {
+			log.Printf("Committing module %v\n", p.run.module.name())
+		}
+		p.decision <- abort
+		err := <-p.done
+		p.run.duration = time.Since(p.start)
+		if abort != nil {
+			p.run.rolledBack, p.run.applied = true, 0
+			continue
+		}
+		if err != nil {
+			p.run.err = err
+			failed = err
+			// roll back the modules which aren't committed yet
+			abort = fmt.Errorf("module %v failed to commit", p.run.module.name())
+		}
+	}
+	return runs, failed
+}
+
+// upModule applies the migrations of run.module, calling started with its
+// Migrate before, and records the versions before and after in run.
+func upModule(run *moduleRun, databaseURL, stateURL string, expand bool, started func(m *migrate.Migrate),
+	newMigrater migraterFunc, onApplied func(migr *migrate.Migration)) error {
+
+	sourceURL, databaseURL, stateURL, err := moduleURLs(run.module, databaseURL, stateURL, expand)
+	if err != nil {
+		return err
+	}
+	m, close, err := newMigrater(sourceURL, databaseURL, stateURL)
+	if err != nil {
+		return err
+	}
+	defer close()
+	m.OnApplied = func(migr *migrate.Migration) {
+		run.applied++
+		if onApplied != nil {
+			onApplied(migr)
+		}
+	}
+	started(m)
+
+	run.from = moduleVersion(m)
+	err = m.Up()
+	run.to = moduleVersion(m)
+	if err == migrate.ErrNoChange {
+		return nil
+	}
+	return err
+}
+
+// guardModule fails if the rules of guards block applying mod on its
+// database, or records breaking the glass
+func guardModule(mod module, databaseURL, stateURL string, expand bool, newMigrater migraterFunc, guards *guard) {
+	sourceURL, databaseURL, stateURL, err := moduleURLs(mod, databaseURL, stateURL, expand)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	m, close, err := newMigrater(sourceURL, databaseURL, stateURL)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	defer close()
+	g := &guard{rules: guards.rules, databaseURL: databaseURL, breakGlass: guards.breakGlass}
+	g.command(m, "up")
+	g.statements(m, "up -all-modules "+mod.name(), m.Up)
+}
+
+// moduleVersion formats the version of m for the summary
+func moduleVersion(m *migrate.Migrate) string {
+	version, dirty, err := m.Version()
+	switch {
+	case err == migrate.ErrNilVersion:
+		return "-"
+	case err != nil:
+		return "?"
+	case dirty:
+		return fmt.Sprintf("%v (dirty)", version)
+	}
+	return fmt.Sprint(version)
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+func TestReadModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	cases := []struct {
+		name     string
+		config   string
+		expected []module
+	}{
+		{"relative and absolute paths", `{"modules": [
+			{"path": "billing", "namespace": "billing"},
+			{"path": "/srv/search", "database": "postgres://search/db"}]}`,
+			[]module{{Path: filepath.Join(dir, "billing"), Namespace: "billing"},
+				{Path: "/srv/search", Database: "postgres://search/db"}}},
+		{"no modules", `{"modules": []}`, nil},
+		{"no path", `{"modules": [{"namespace": "billing"}]}`, nil},
+		{"invalid namespace", `{"modules": [{"path": "billing", "namespace": "bill-ing"}]}`, nil},
+		{"shared version table", `{"modules": [{"path": "billing"}, {"path": "orders"}]}`, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(dir, "migrate.modules.json")
+			if err := ioutil.WriteFile(file, []byte(c.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			modules, err := readModules(file)
+			if c.expected == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", modules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(modules, c.expected) {
+				t.Errorf("expected %+v, got %+v", c.expected, modules)
+			}
+		})
+	}
+}
+
+func TestModuleURLs(t *testing.T) {
+	src, db, st, err := moduleURLs(module{Path: "billing", Namespace: "billing"},
+		"postgres://localhost/app", "postgres://localhost/ops", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src != "file://billing" ||
+		db != "postgres://localhost/app?x-migrations-table=schema_migrations_billing" ||
+		st != "postgres://localhost/ops?x-migrations-table=schema_migrations_billing" {
+		t.Errorf("unexpected urls %v, %v, %v", src, db, st)
+	}
+
+	if _, _, _, err := moduleURLs(module{Path: "billing"}, "", "", false); err == nil {
+		t.Error("expected an error without database")
+	}
+}
+
+func TestUpModulesTwoPhase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	for _, name := range []string{"billing", "orders"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name, "1_init.up.sql"), []byte("CREATE"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var dbs map[string]*dStub.Stub
+	newMigrater := func(sourceURL, databaseURL, stateURL string) (*migrate.Migrate, func(), error) {
+		if databaseURL == "stub://unreachable" {
+			return nil, nil, errors.New("connection refused")
+		}
+		db, err := (&dStub.Stub{}).Open("stub://")
+		if err != nil {
+			return nil, nil, err
+		}
+		dbs[databaseURL] = db.(*dStub.Stub)
+		m, err := migrate.NewWithDatabaseInstance(sourceURL, "stub", db)
+		return m, func() {}, err
+	}
+	billing := module{Path: filepath.Join(dir, "billing"), Database: "stub://billing"}
+	orders := module{Path: filepath.Join(dir, "orders"), Database: "stub://orders"}
+	unreachable := module{Path: filepath.Join(dir, "orders"), Database: "stub://unreachable"}
+	notStopped := func() bool { return false }
+
+	cases := []struct {
+		name    string
+		modules []module
+		results []string
+		version int
+	}{
+		{"all prepared", []module{billing, orders}, []string{"ok", "ok"}, 1},
+		{"one failed", []module{billing, unreachable, orders}, []string{"rolled back", "failed: connection refused", "skipped"}, -1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dbs = make(map[string]*dStub.Stub)
+			runs, err := upModulesTwoPhase(c.modules, "", "", false, func(*migrate.Migrate) {}, notStopped, newMigrater, nil)
+			if runs == nil {
+				t.Fatal(err)
+			}
+			var results []string
+			for _, run := range runs {
+				results = append(results, run.result())
+			}
+			if !reflect.DeepEqual(results, c.results) {
+				t.Errorf("expected %v, got %v", c.results, results)
+			}
+			if (err != nil) != (c.version < 0) {
+				t.Errorf("unexpected error %v", err)
+			}
+			for url, db := range dbs {
+				if db.IsInTx || db.CurrentVersion != c.version {
+					t.Errorf("expected %v at version %v, got %v, in a transaction: %v", url, c.version, db.CurrentVersion, db.IsInTx)
+				}
+			}
+		})
+	}
+
+	if runs, err := upModulesTwoPhase([]module{billing, {Path: billing.Path, Database: billing.Database, Namespace: "other"}},
+		"", "", false, func(*migrate.Migrate) {}, notStopped, newMigrater, nil); runs != nil || err == nil {
+		t.Error("expected an error for modules sharing a database")
+	}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	iurl "github.com/golang-migrate/migrate/v4/internal/url"
+)
+
+// notifyCommands are the commands notifications are sent for
+var notifyCommands = map[string]bool{"goto": true, "up": true, "down": true, "drop": true, "fresh": true, "force": true, "rollback": true, "apply-bundle": true}
+
+// runSummary is the data of a notification
+type runSummary struct {
+	Command  string `json:"command"`
+	Source   string `json:"source"`
+	Database string `json:"database"`
+	Hostname string `json:"hostname"`
+	// Applied are the applied migrations, e.g. "1/u create_users"
+	Applied  []string `json:"applied"`
+	Duration string   `json:"duration"`
+	Success  bool     `json:"success"`
+	Error    string   `json:"error,omitempty"`
+	// Text describes the run in one line
+	Text string `json:"text"`
+}
+
+// notifier posts a summary of a run to a webhook, e.g. of Slack or Teams.
+// Without template, the payload is {"text": "..."}, which both understand.
+type notifier struct {
+	url      string
+	template *template.Template
+	client   *http.Client
+	started  time.Time
+	summary  runSummary
+}
+
+func newNotifier(url, templateFile, command, sourceURL, databaseURL string) (*notifier, error) {
+	n := &notifier{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		started: time.Now(),
+		summary: runSummary{
+			Command:  command,
+			Source:   iurl.Redact(sourceURL),
+			Database: iurl.Redact(databaseURL),
+			Applied:  []string{},
+		},
+	}
+	n.summary.Hostname, _ = os.Hostname()
+	if templateFile != "" {
+		tmpl, err := template.New(filepath.Base(templateFile)).Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).ParseFiles(templateFile)
+		if err != nil {
+			return nil, err
+		}
+		n.template = tmpl
+	}
+	return n, nil
+}
+
+// applied records an applied migration, see migrate.Migrate.OnApplied
+func (n *notifier) applied(migr *migrate.Migration) {
+	n.summary.Applied = append(n.summary.Applied, migr.LogString())
+}
+
+// notify sends the summary of the run, which failed with errMsg unless it is empty
+func (n *notifier) notify(errMsg string) error {
+	s := n.summary
+	s.Duration = time.Since(n.started).Round(time.Millisecond).String()
+	s.Success = errMsg == ""
+	s.Error = errMsg
+
+	applied := "no migrations applied"
+	if len(s.Applied) > 0 {
+		applied = "applied " + strings.Join(s.Applied, ", ")
+	}
+	if s.Success {
+		s.Text = fmt.Sprintf("migrate %v on %v succeeded after %v, %v", s.Command, s.Hostname, s.Duration, applied)
+	} else {
+		s.Text = fmt.Sprintf("migrate %v on %v failed after %v, %v: %v", s.Command, s.Hostname, s.Duration, applied, s.Error)
+	}
+
+	var payload bytes.Buffer
+	if n.template != nil {
+		if err := n.template.Execute(&payload, s); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&payload).Encode(map[string]string{"text": s.Text}); err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", &payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("notification failed with %v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
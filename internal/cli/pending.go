@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// destructiveStatements are statements losing data, flagged by the
+// pending command
+var destructiveStatements = []struct {
+	flag string
+	re   *regexp.Regexp
+}{
+	{"DROP TABLE", regexp.MustCompile(`(?i)\bDROP\s+TABLE\b`)},
+	{"DROP COLUMN", regexp.MustCompile(`(?i)\bDROP\s+COLUMN\b`)},
+	{"DROP SCHEMA", regexp.MustCompile(`(?i)\bDROP\s+(SCHEMA|DATABASE)\b`)},
+	{"TRUNCATE", regexp.MustCompile(`(?i)\bTRUNCATE\b`)},
+	{"DELETE", regexp.MustCompile(`(?i)\bDELETE\s+FROM\b`)},
+}
+
+// destructive returns the flags of the destructive statements in the SQL
+// body, ignoring comments
+func destructive(body []byte) []string {
+	w := &destructiveWriter{}
+	w.Write(body)
+	return w.flags()
+}
+
+// destructiveWriter flags the destructive statements of the SQL written to
+// it line by line, ignoring comments, so that a body is checked without
+// holding it in memory. It counts the bytes written.
+type destructiveWriter struct {
+	size int64
+	// line is the incomplete last line
+	line []byte
+	// comment is true inside a block comment
+	comment bool
+	// last is the last word before line, for statements spanning lines
+	last  string
+	found map[string]bool
+}
+
+func (w *destructiveWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	w.size += int64(n)
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.line = append(w.line, p...)
+			return n, nil
+		}
+		w.line = append(w.line, p[:i]...)
+		w.scan()
+		p = p[i+1:]
+	}
+}
+
+// scan flags the statements of the line
+func (w *destructiveWriter) scan() {
+	line := w.strip(string(w.line))
+	w.line = w.line[:0]
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return
+	}
+	if w.found == nil {
+		w.found = make(map[string]bool)
+	}
+	text := w.last + "\n" + line
+	for _, s := range destructiveStatements {
+		if s.re.MatchString(text) {
+			w.found[s.flag] = true
+		}
+	}
+	w.last = words[len(words)-1]
+}
+
+// strip removes the comments of the line
+func (w *destructiveWriter) strip(line string) string {
+	var b strings.Builder
+	for line != "" {
+		if w.comment {
+			i := strings.Index(line, "*/")
+			if i < 0 {
+				break
+			}
+			line = line[i+2:]
+			w.comment = false
+			continue
+		}
+		dash, block := strings.Index(line, "--"), strings.Index(line, "/*")
+		if block >= 0 && (dash < 0 || block < dash) {
+			b.WriteString(line[:block])
+			line = line[block+2:]
+			w.comment = true
+			continue
+		}
+		if dash >= 0 {
+			line = line[:dash]
+		}
+		b.WriteString(line)
+		break
+	}
+	return b.String()
+}
+
+// flags returns the flags of the statements written, in the order of
+// destructiveStatements
+func (w *destructiveWriter) flags() []string {
+	w.scan()
+	var flags []string
+	for _, s := range destructiveStatements {
+		if w.found[s.flag] {
+			flags = append(flags, s.flag)
+		}
+	}
+	return flags
+}
+
+// pendingCmd (meant to be called via a CLI command) prints the pending
+// migrations in the order they would be applied, or only their number. The
+// size and destructive statements are those of the decoded body.
+func pendingCmd(m *migrate.Migrate, count bool) {
+	pending, err := m.Pending()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if count {
+		fmt.Println(len(pending))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSIZE\tDESTRUCTIVE")
+	for _, version := range pending {
+		r, identifier, err := m.ReadUp(version)
+		if os.IsNotExist(err) {
+			// only sets the version
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", version, "<no up migration>", 0, "-")
+			continue
+		} else if err != nil {
+			log.fatalErr(err)
+		}
+		body := &destructiveWriter{}
+		_, err = io.Copy(body, r)
+		r.Close()
+		if err != nil {
+			log.fatalErr(err)
+		}
+		flags := strings.Join(body.flags(), ", ")
+		if flags == "" {
+			flags = "-"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", version, identifier, body.size, flags)
+	}
+	if err := w.Flush(); err != nil {
+		log.fatalErr(err)
+	}
+}
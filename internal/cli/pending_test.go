@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDestructive(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{"none", "CREATE TABLE users (id int);", nil},
+		{"drop table", "drop table users;", []string{"DROP TABLE"}},
+		{"several", "ALTER TABLE users DROP COLUMN name;\nTRUNCATE logs;\nDELETE FROM sessions;",
+			[]string{"DROP COLUMN", "TRUNCATE", "DELETE"}},
+		{"database", "DROP DATABASE old;", []string{"DROP SCHEMA"}},
+		{"comments", "-- DROP TABLE users\n/* TRUNCATE\nlogs */ CREATE INDEX i ON users (id);", nil},
+		{"identifier", "CREATE TABLE deleted_from (truncated bool);", nil},
+		{"spanning lines", "DELETE\n  -- all of them\n\n  FROM sessions;", []string{"DELETE"}},
+		{"comment lines", "/* old\nDROP TABLE users;\n*/ ALTER TABLE users DROP\nCOLUMN name;", []string{"DROP COLUMN"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if flags := destructive([]byte(c.body)); !reflect.DeepEqual(flags, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, flags)
+			}
+		})
+	}
+}
+
+func TestDestructiveWriter(t *testing.T) {
+	body := "CREATE TABLE users (id int);\n/* cleanup */ DROP TABLE\nsessions;\nTRUNCATE logs"
+	w := &destructiveWriter{}
+	// written in pieces like by io.Copy
+	for i := range body {
+		if _, err := w.Write([]byte(body[i : i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected := []string{"DROP TABLE", "TRUNCATE"}; !reflect.DeepEqual(w.flags(), expected) {
+		t.Errorf("expected %v, got %v", expected, w.flags())
+	}
+	if w.size != int64(len(body)) {
+		t.Errorf("expected size %v, got %v", len(body), w.size)
+	}
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+)
+
+// loadPlugins opens the Go plugins (*.so) in dir, which register
+// additional database, source or lock drivers in their init functions.
+// The plugins must be built with the same Go version and versions of
+// this module as the CLI. Plugins run in the CLI's process, there's no
+// support for plugins in separate processes. It returns the paths of the
+// loaded plugins.
+func loadPlugins(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return nil, fmt.Errorf("loading plugin %v: %v", path, err)
+		}
+	}
+	return paths, nil
+}
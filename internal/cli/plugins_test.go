@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := loadPlugins(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing directory")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := loadPlugins(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 0 {
+		t.Errorf("expected no plugins, got %v", paths)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.so"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPlugins(dir); err == nil {
+		t.Error("expected error for invalid plugin")
+	}
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// progressCommands are the commands whose progress is streamed with
+// -progress-listen
+var progressCommands = map[string]bool{"goto": true, "up": true, "down": true, "fresh": true, "rollback": true, "apply-bundle": true}
+
+// progressEvent is an event streamed by progressServer
+type progressEvent struct {
+	// Event is "run" when the run starts, "start" before and "applied"
+	// after each migration, and "done" when the run is over
+	Event      string `json:"event"`
+	Version    uint   `json:"version,omitempty"`
+	Direction  string `json:"direction,omitempty"`
+	Identifier string `json:"identifier,omitempty"`
+	// Total is the number of migrations of the run, if known, for "run"
+	Total int `json:"total,omitempty"`
+	// Applied is the number of migrations applied so far
+	Applied   int    `json:"applied"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// progressServer streams the progress of a run as server-sent events, so
+// that e.g. a platform UI can show a progress bar for long migrations.
+// Clients connecting late get the events so far first.
+type progressServer struct {
+	server *http.Server
+	// addr is the address listened on, e.g. with a port picked by the system
+	addr    string
+	started time.Time
+
+	mu           sync.Mutex
+	events       [][]byte
+	clients      map[chan []byte]bool
+	appliedCount int
+	closed       bool
+}
+
+// newProgressServer listens on addr, e.g. :8081, for clients of the
+// progress stream.
+func newProgressServer(addr string) (*progressServer, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &progressServer{addr: l.Addr().String(), started: time.Now(), clients: make(map[chan []byte]bool)}
+	p.server = &http.Server{Handler: p}
+	go func() {
+		if err := p.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Println("error: progress server:", err)
+		}
+	}()
+	return p, nil
+}
+
+func (p *progressServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p.mu.Lock()
+	events := make(chan []byte, len(p.events)+16)
+	for _, e := range p.events {
+		events <- e
+	}
+	if p.closed {
+		close(events)
+	} else {
+		p.clients[events] = true
+	}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, events)
+		p.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// send streams e to the clients. A client which doesn't keep up is
+// dropped rather than holding up the run.
+func (p *progressServer) send(e progressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	e.Applied = p.appliedCount
+	e.ElapsedMs = int64(time.Since(p.started) / time.Millisecond)
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Println("error:", err)
+		return
+	}
+	p.events = append(p.events, b)
+	for client := range p.clients {
+		select {
+		case client <- b:
+		default:
+			delete(p.clients, client)
+			close(client)
+		}
+	}
+}
+
+// run sends the event starting a run of total migrations, 0 if unknown.
+func (p *progressServer) run(total int) {
+	p.send(progressEvent{Event: "run", Total: total})
+}
+
+// start is called before migr runs, see migrate.Migrate.OnStart
+func (p *progressServer) start(migr *migrate.Migration) {
+	p.send(migrationEvent("start", migr))
+}
+
+// applied is called after migr was applied, see migrate.Migrate.OnApplied
+func (p *progressServer) applied(migr *migrate.Migration) {
+	p.mu.Lock()
+	p.appliedCount++
+	p.mu.Unlock()
+	p.send(migrationEvent("applied", migr))
+}
+
+// done sends the event ending the run, which failed with errMsg unless
+// it is empty, ends the streams and stops the server.
+func (p *progressServer) done(errMsg string) {
+	p.send(progressEvent{Event: "done", Error: errMsg})
+	p.mu.Lock()
+	p.closed = true
+	for client := range p.clients {
+		close(client)
+	}
+	p.clients = nil
+	p.mu.Unlock()
+
+	// wait for the clients to receive the last events
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.server.Shutdown(ctx); err != nil {
+		log.Println("error: progress server:", err)
+	}
+}
+
+// pendingTotal returns the number of migrations up applies with limit N,
+// or all pending ones if limit is negative, 0 if it can't tell.
+func pendingTotal(m *migrate.Migrate, limit int) int {
+	pending, err := m.Pending()
+	if err != nil {
+		return 0
+	}
+	if limit >= 0 && limit < len(pending) {
+		return limit
+	}
+	return len(pending)
+}
+
+func migrationEvent(event string, migr *migrate.Migration) progressEvent {
+	direction := source.Up
+	if migr.TargetVersion < int(migr.Version) {
+		direction = source.Down
+	}
+	return progressEvent{Event: event, Version: migr.Version, Direction: string(direction), Identifier: migr.Identifier}
+}
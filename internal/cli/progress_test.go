@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+func TestProgressServer(t *testing.T) {
+	p, err := newProgressServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migr := &migrate.Migration{Version: 3, Identifier: "backfill", TargetVersion: 3}
+	p.run(2)
+	p.start(migr)
+
+	resp, err := http.Get("http://" + p.addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %v", ct)
+	}
+	events := make(chan progressEvent)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				var e progressEvent
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+					t.Error(err)
+				}
+				events <- e
+			}
+		}
+	}()
+
+	// the events before the client connected are replayed
+	var received []string
+	for _, expected := range []string{"run", "start"} {
+		e := <-events
+		received = append(received, e.Event)
+		if e.Event != expected {
+			t.Fatalf("expected %v, got %+v", expected, e)
+		}
+	}
+	p.applied(migr)
+	p.applied(&migrate.Migration{Version: 4, Identifier: "drop_column", TargetVersion: 3})
+	go p.done("")
+	var last progressEvent
+	for e := range events {
+		received = append(received, e.Event)
+		last = e
+	}
+	if expected := []string{"run", "start", "applied", "applied", "done"}; !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+	if last.Applied != 2 {
+		t.Errorf("expected 2 applied when done, got %+v", last)
+	}
+}
+
+func TestMigrationEvent(t *testing.T) {
+	up := migrationEvent("start", &migrate.Migration{Version: 3, Identifier: "backfill", TargetVersion: 3})
+	if expected := (progressEvent{Event: "start", Version: 3, Direction: "up", Identifier: "backfill"}); up != expected {
+		t.Errorf("expected %+v, got %+v", expected, up)
+	}
+	if down := migrationEvent("start", &migrate.Migration{Version: 1, TargetVersion: -1}); down.Direction != "down" {
+		t.Errorf("expected down, got %+v", down)
+	}
+}
@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+)
+
+// migrationFiles are the files of one migration, its up and down
+// migration and their dialect variants
+type migrationFiles struct {
+	version    uint
+	identifier string
+	// prefix is the version as written in the file names
+	prefix string
+	files  []string
+}
+
+// renumbering moves a migration to a free version
+type renumbering struct {
+	migration migrationFiles
+	to        uint
+	// renames maps the old to the new file names
+	renames map[string]string
+}
+
+func (r renumbering) String() string {
+	return fmt.Sprintf("%v_%v -> %v_%v", r.migration.prefix, r.migration.identifier,
+		formatVersion(r.to, r.migration.prefix), r.migration.identifier)
+}
+
+// formatVersion formats version with the zero padding of prefix
+func formatVersion(version uint, prefix string) string {
+	if strings.HasPrefix(prefix, "0") {
+		return fmt.Sprintf("%0*d", len(prefix), version)
+	}
+	return fmt.Sprint(version)
+}
+
+// readMigrationFiles groups the migration files in dir by migration,
+// ordered by version and identifier
+func readMigrationFiles(dir string) ([]migrationFiles, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ignore *source.Ignore
+	if f, err := os.Open(filepath.Join(dir, source.IgnoreFile)); err == nil {
+		ignore, err = source.ParseIgnore(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	index := make(map[string]int)
+	var migrations []migrationFiles
+	for _, fi := range infos {
+		if fi.IsDir() || ignore.Match(fi.Name(), false) {
+			continue
+		}
+		m, err := source.Parse(fi.Name())
+		if err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%v_%v", m.Version, m.Identifier)
+		i, ok := index[key]
+		if !ok {
+			i = len(migrations)
+			index[key] = i
+			migrations = append(migrations, migrationFiles{
+				version:    m.Version,
+				identifier: m.Identifier,
+				prefix:     fi.Name()[:strings.Index(fi.Name(), "_"+m.Identifier+".")],
+			})
+		}
+		migrations[i].files = append(migrations[i].files, fi.Name())
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		if migrations[i].version != migrations[j].version {
+			return migrations[i].version < migrations[j].version
+		}
+		return migrations[i].identifier < migrations[j].identifier
+	})
+	return migrations, nil
+}
+
+// lockEntry returns the checksums of the up and down migration of m, the
+// files without dialect
+func lockEntry(dir string, m migrationFiles) (manifest.Entry, error) {
+	e := manifest.Entry{Version: m.version}
+	for _, name := range m.files {
+		parsed, err := source.Parse(name)
+		if err != nil || parsed.Dialect != "" {
+			continue
+		}
+		body, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return e, err
+		}
+		if parsed.Direction == source.Up {
+			e.Up = manifest.Checksum(body)
+		} else {
+			e.Down = manifest.Checksum(body)
+		}
+	}
+	return e, nil
+}
+
+// planRenumber returns the migrations in dir which have to move to make
+// versions unique: of migrations sharing a version, the one recorded in
+// lock, or else the first by identifier, keeps it. With lock, migrations
+// missing from it below its last version are out of order and move as well.
+// Migrations move past the highest version, in order.
+func planRenumber(dir string, migrations []migrationFiles, lock *manifest.Manifest) ([]renumbering, error) {
+	var high uint
+	if lock != nil && len(lock.Entries) > 0 {
+		high = lock.Entries[len(lock.Entries)-1].Version
+	}
+
+	recorded := func(m migrationFiles) (bool, error) {
+		if lock == nil {
+			return false, nil
+		}
+		locked, ok := lock.Entry(m.version)
+		if !ok {
+			return false, nil
+		}
+		e, err := lockEntry(dir, m)
+		if err != nil {
+			return false, err
+		}
+		return e.Up == locked.Up && e.Down == locked.Down, nil
+	}
+
+	var moved []migrationFiles
+	for i := 0; i < len(migrations); {
+		j := i
+		for j < len(migrations) && migrations[j].version == migrations[i].version {
+			j++
+		}
+		group := migrations[i:j]
+		i = j
+
+		if lock != nil && group[0].version < high {
+			if _, ok := lock.Entry(group[0].version); !ok {
+				moved = append(moved, group...)
+				continue
+			}
+		}
+		keep := 0
+		for k, m := range group {
+			ok, err := recorded(m)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				keep = k
+				break
+			}
+		}
+		for k, m := range group {
+			if k != keep {
+				moved = append(moved, m)
+			}
+		}
+	}
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	next := high
+	if n := len(migrations); n > 0 && migrations[n-1].version > next {
+		next = migrations[n-1].version
+	}
+	plan := make([]renumbering, 0, len(moved))
+	for _, m := range moved {
+		if !source.Regex.MatchString(m.files[0]) {
+			return nil, fmt.Errorf("can't renumber %v_%v, only numeric versions can be renumbered", m.prefix, m.identifier)
+		}
+		next++
+		r := renumbering{migration: m, to: next, renames: make(map[string]string)}
+		for _, name := range m.files {
+			r.renames[name] = formatVersion(next, m.prefix) + strings.TrimPrefix(name, m.prefix)
+		}
+		plan = append(plan, r)
+	}
+	return plan, nil
+}
+
+// renumberCmd (meant to be called via a CLI command) renames the
+// migrations in dir colliding with others or out of order, see
+// planRenumber, and records them in lockFile, if given
+func renumberCmd(dir string, lockFile string, dryRun bool) {
+	var lock *manifest.Manifest
+	if lockFile != "" {
+		f, err := os.Open(lockFile)
+		if err != nil {
+			log.fatalErr(err)
+		}
+		lock, err = manifest.Read(f)
+		f.Close()
+		if err != nil {
+			log.fatalErr(err)
+		}
+		if lock.Signature != nil {
+			log.fatalErr(errors.New("The lock file is signed and can't be updated"))
+		}
+	}
+
+	migrations, err := readMigrationFiles(dir)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	plan, err := planRenumber(dir, migrations, lock)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if len(plan) == 0 {
+		log.Println("Versions are unique and in order")
+		return
+	}
+	for _, r := range plan {
+		for _, to := range r.renames {
+			if _, err := os.Stat(filepath.Join(dir, to)); err == nil {
+				log.fatalErr(fmt.Errorf("Can't rename to %v, the file exists", to))
+			}
+		}
+	}
+
+	for _, r := range plan {
+		log.Println(r)
+		if dryRun {
+			continue
+		}
+		for from, to := range r.renames {
+			if err := os.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+				log.fatalErr(err)
+			}
+		}
+		if lock != nil {
+			r.migration.files = r.migration.files[:0]
+			for _, to := range r.renames {
+				r.migration.files = append(r.migration.files, to)
+			}
+			r.migration.version = r.to
+			e, err := lockEntry(dir, r.migration)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			lock.Entries = append(lock.Entries, e)
+		}
+	}
+	if lock != nil && !dryRun {
+		writeManifest(lock, lockFile)
+	}
+}
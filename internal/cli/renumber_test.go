@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+)
+
+func writeMigrations(t *testing.T, dir string, files map[string]string) {
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(infos))
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPlanRenumber(t *testing.T) {
+	cases := []struct {
+		name     string
+		files    map[string]string
+		lock     *manifest.Manifest
+		expected []string
+	}{
+		{
+			name:  "unique",
+			files: map[string]string{"1_a.up.sql": "a", "2_b.up.sql": "b"},
+		},
+		{
+			name: "duplicate",
+			files: map[string]string{
+				"000001_a.up.sql": "a", "000002_b.up.sql": "b", "000002_b.down.sql": "-b",
+				"000002_c.up.sql": "c", "000002_c.postgres.up.sql": "pg c", "000003_d.up.sql": "d",
+			},
+			expected: []string{"000002_c -> 000004_c"},
+		},
+		{
+			name:  "duplicate recorded in lock",
+			files: map[string]string{"1_a.up.sql": "a", "2_b.up.sql": "b", "2_c.up.sql": "c"},
+			lock: &manifest.Manifest{Entries: []manifest.Entry{
+				{Version: 1, Up: manifest.Checksum([]byte("a"))},
+				{Version: 2, Up: manifest.Checksum([]byte("c"))},
+			}},
+			expected: []string{"2_b -> 3_b"},
+		},
+		{
+			name:  "out of order",
+			files: map[string]string{"1_a.up.sql": "a", "2_b.up.sql": "b", "3_c.up.sql": "c", "4_d.up.sql": "d"},
+			lock: &manifest.Manifest{Entries: []manifest.Entry{
+				{Version: 1, Up: manifest.Checksum([]byte("a"))},
+				{Version: 3, Up: manifest.Checksum([]byte("c"))},
+			}},
+			expected: []string{"2_b -> 5_b"},
+		},
+		{
+			name:  "changed migration keeps its version",
+			files: map[string]string{"1_a.up.sql": "changed", "2_b.up.sql": "b"},
+			lock: &manifest.Manifest{Entries: []manifest.Entry{
+				{Version: 1, Up: manifest.Checksum([]byte("a"))},
+				{Version: 2, Up: manifest.Checksum([]byte("b"))},
+			}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "renumber")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeMigrations(t, dir, c.files)
+
+			migrations, err := readMigrationFiles(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, err := planRenumber(dir, migrations, c.lock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var renames []string
+			for _, r := range plan {
+				renames = append(renames, r.String())
+			}
+			if !reflect.DeepEqual(renames, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, renames)
+			}
+		})
+	}
+}
+
+func TestRenumberCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renumber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeMigrations(t, dir, map[string]string{
+		"1_a.up.sql": "a", "2_b.up.sql": "b", "2_b.down.sql": "-b", "2_c.up.sql": "c", "2_c.down.sql": "-c",
+	})
+	lock := &manifest.Manifest{Entries: []manifest.Entry{
+		{Version: 1, Up: manifest.Checksum([]byte("a"))},
+		{Version: 2, Up: manifest.Checksum([]byte("b")), Down: manifest.Checksum([]byte("-b"))},
+	}}
+	lockFile := filepath.Join(dir, "migrations.lock")
+	writeManifest(lock, lockFile)
+
+	renumberCmd(dir, lockFile, true)
+	expected := []string{"1_a.up.sql", "2_b.down.sql", "2_b.up.sql", "2_c.down.sql", "2_c.up.sql", "migrations.lock"}
+	if names := listFiles(t, dir); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected dry run to keep %v, got %v", expected, names)
+	}
+
+	renumberCmd(dir, lockFile, false)
+	expected = []string{"1_a.up.sql", "2_b.down.sql", "2_b.up.sql", "3_c.down.sql", "3_c.up.sql", "migrations.lock"}
+	if names := listFiles(t, dir); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+
+	f, err := os.Open(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	updated, err := manifest.Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := updated.Entry(3)
+	if !ok || e.Up != manifest.Checksum([]byte("c")) || e.Down != manifest.Checksum([]byte("-c")) {
+		t.Errorf("expected the lock to record 3_c, got %+v", updated.Entries)
+	}
+}
@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// serveTokenEnv is the environment variable with the token of the serve
+// command, which enables its dashboard
+const serveTokenEnv = "MIGRATE_SERVE_TOKEN"
+
+// dashboardHistory is the number of history records the dashboard shows
+const dashboardHistory = 20
+
+// server serves the serve command: the dashboard, a web UI with the state
+// of the database and buttons to apply or roll back migrations, and the
+// REST API, see api.
+type server struct {
+	m      *migrate.Migrate
+	src    source.Driver
+	guards *guard
+	// token, if set, is the password of the basic authentication the
+	// dashboard is behind, without it the dashboard is disabled. API
+	// clients send it as bearer token.
+	token string
+	// certAuth authenticates API clients by their verified certificate,
+	// see -client-ca
+	certAuth bool
+
+	// running is 1 while a button or the API runs migrations, see tryRun
+	running int32
+
+	// mu serializes the use of m, which isn't safe for concurrent use
+	mu sync.Mutex
+	// status is the result of the last button, failed if it failed
+	status string
+	failed bool
+}
+
+// dashboardPage is rendered by dashboardTemplate
+type dashboardPage struct {
+	Version string
+	Pending []dashboardMigration
+	History []historyEntry
+	// NoHistory explains why History is empty
+	NoHistory string
+	Drift     string
+	Drifted   bool
+	// Status is the result of the last button, of any user
+	Status string
+	Failed bool
+}
+
+// dashboardMigration is a pending migration with its SQL
+type dashboardMigration struct {
+	Version    uint
+	Identifier string
+	SQL        string
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>migrate</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+.failed, .drifted { color: #b00; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<h1>Version {{.Version}}</h1>
+{{if .Status}}<p{{if .Failed}} class="failed"{{end}}>{{.Status}}</p>{{end}}
+<form method="post" action="up"><button>Apply all</button></form>
+<form method="post" action="down"><button>Roll back one</button></form>
+
+<h2>Schema drift</h2>
+<p{{if .Drifted}} class="drifted"{{end}}>{{.Drift}}</p>
+
+<h2>Pending</h2>
+{{range .Pending}}<details><summary>{{.Version}} {{.Identifier}}</summary><pre>{{.SQL}}</pre></details>
+{{else}}<p>No pending migrations.</p>
+{{end}}
+<h2>History</h2>
+{{if .NoHistory}}<p>{{.NoHistory}}</p>{{else}}<table>
+<tr><th>Applied</th><th>Version</th><th>Direction</th><th>Name</th><th>Duration</th><th>User</th><th>Host</th><th>Checksum</th></tr>
+{{range .History}}<tr><td>{{.Applied}}</td><td>{{.Version}}</td><td>{{.Direction}}</td><td>{{.Identifier}}</td><td>{{.DurationMs}}ms</td><td>{{.User}}</td><td>{{.Hostname}}</td><td>{{.ChecksumStatus}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+// serveCmd (meant to be called via a CLI command) serves the dashboard and
+// the API on addr, over TLS if tlsConfig is set, until it fails. It refuses
+// to serve without a way to authenticate.
+func serveCmd(m *migrate.Migrate, src source.Driver, guards *guard, addr string, token string, tlsConfig *tls.Config) {
+	s := &server{m: m, src: src, guards: guards, token: token, certAuth: tlsConfig != nil && tlsConfig.ClientCAs != nil}
+	if token == "" && !s.certAuth {
+		log.fatal("error: serve needs $" + serveTokenEnv + " or -client-ca to authenticate its users")
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		l, scheme = tls.NewListener(l, tlsConfig), "https"
+	}
+	log.Println("Serving the dashboard on " + scheme + "://" + l.Addr().String())
+	if token == "" {
+		log.Println("The dashboard is disabled, set $" + serveTokenEnv + " to enable it")
+	}
+	if err := http.Serve(l, s.handler()); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+// serveTLSConfig returns the TLS configuration of the serve command with the
+// certificate certFile and its key keyFile, if given, verifying the
+// certificates of clients which send one with the CAs of clientCAFile.
+func serveTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" && clientCAFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("serving over TLS needs -tls-cert and -tls-key")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %v", clientCAFile)
+		}
+		// the dashboard authenticates its users with the token
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// handler returns the routes of the dashboard behind its authentication,
+// and of the API, which authenticates its clients itself
+func (s *server) handler() http.Handler {
+	dashboard := http.NewServeMux()
+	dashboard.HandleFunc("/", s.page)
+	dashboard.HandleFunc("/up", s.action(s.m.Up))
+	dashboard.HandleFunc("/down", s.action(func() error {
+		return s.m.Steps(-1)
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/", s.api())
+	mux.Handle("/", s.authenticate(dashboard))
+	return mux
+}
+
+// tryRun marks that a run is in progress, unless one already is. endRun
+// marks its end.
+func (s *server) tryRun() bool {
+	return atomic.CompareAndSwapInt32(&s.running, 0, 1)
+}
+
+func (s *server) endRun() {
+	atomic.StoreInt32(&s.running, 0)
+}
+
+// authenticate requires the token as password of basic authentication,
+// with any user. Without a token, every page is forbidden.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token == "" {
+			http.Error(w, "the dashboard is disabled, set $"+serveTokenEnv, http.StatusForbidden)
+			return
+		}
+		_, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="migrate"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	page, err := s.load()
+	page.Status, page.Failed = s.status, s.failed
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, page)
+}
+
+// action returns the handler of a button, which runs run and redirects to
+// the page showing its result
+func (s *server) action(run func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// a form of another site can't use the credentials of the browser
+		if origin := r.Header.Get("Origin"); origin != "" && !sameHost(origin, r.Host) {
+			http.Error(w, "cross-origin request", http.StatusForbidden)
+			return
+		}
+
+		if !s.tryRun() {
+			http.Error(w, "a run is already in progress", http.StatusConflict)
+			return
+		}
+		s.mu.Lock()
+		s.status, s.failed = s.run(run)
+		s.mu.Unlock()
+		s.endRun()
+		http.Redirect(w, r, "./", http.StatusSeeOther)
+	}
+}
+
+// run runs the run of a button unless guard rules block its statements,
+// and returns the status line and whether it failed
+func (s *server) run(run func() error) (string, bool) {
+	blocked, err := s.guards.blocked(s.m, run)
+	if err != nil {
+		return "error: the statements can't be checked against the guard rules: " + err.Error(), true
+	}
+	if len(blocked) > 0 {
+		return "error: blocked on this database by guard rules: " + strings.Join(blocked, "; "), true
+	}
+	err = run()
+	if err == migrate.ErrNoChange {
+		return "No change", false
+	}
+	var b strings.Builder
+	if errWrite := writeReport(&b, formatText, newRunReport(s.m, err)); errWrite != nil {
+		return "error: " + errWrite.Error(), true
+	}
+	status := strings.TrimSpace(b.String())
+	if err != nil {
+		return status + ", error: " + err.Error(), true
+	}
+	return status, false
+}
+
+// load reads the state of the database for the page
+func (s *server) load() (dashboardPage, error) {
+	var page dashboardPage
+	version, dirty, err := s.m.Version()
+	switch {
+	case err == migrate.ErrNilVersion:
+		page.Version = "none"
+	case err != nil:
+		return page, err
+	case dirty:
+		page.Version = fmt.Sprintf("%v (dirty)", version)
+	default:
+		page.Version = fmt.Sprint(version)
+	}
+
+	pending, err := s.m.Pending()
+	if err != nil {
+		return page, err
+	}
+	for _, v := range pending {
+		migr := dashboardMigration{Version: v}
+		// decoded and rendered as it would run
+		info, err := s.m.Show(v)
+		switch {
+		case err != nil:
+			migr.SQL = "error: " + err.Error()
+		case info.Up == nil:
+			migr.Identifier = "<no up migration>"
+		default:
+			migr.Identifier, migr.SQL = info.Up.Identifier, string(info.Up.Body)
+		}
+		page.Pending = append(page.Pending, migr)
+	}
+
+	if records, err := s.m.History(); err != nil {
+		page.NoHistory = "No history of applied migrations, see -history."
+	} else {
+		if len(records) > dashboardHistory {
+			records = records[len(records)-dashboardHistory:]
+		}
+		// the latest first
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+		page.History = newHistoryEntries(s.src, records)
+	}
+
+	drift, err := s.m.Drift()
+	switch {
+	case err == database.ErrNoFingerprint:
+		page.Drift = "No fingerprint stored, run migrations with -fingerprint."
+	case err != nil:
+		page.Drift = "error: " + err.Error()
+	case drift.Drifted():
+		page.Drift, page.Drifted = "The schema was changed since the last run.", true
+	default:
+		page.Drift = "The schema matches the last run."
+	}
+	return page, nil
+}
+
+func (s *server) render(w http.ResponseWriter, page dashboardPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, page); err != nil {
+		log.Println("error:", err)
+	}
+}
+
+// sameHost tells whether origin, e.g. http://localhost:8080, is on host
+func sameHost(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == host
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// newTestServer returns a server of a stub database and migrations 1 and 2,
+// which is compressed, and a function closing it
+func newTestServer(t *testing.T) (*server, func()) {
+	dir, err := ioutil.TempDir("", "migrate_serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte("CREATE <users>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"1_init.up.sql":   "CREATE 1",
+		"1_init.down.sql": "DROP 1",
+		"2_users.up.sql":  compressed.String(),
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := migrate.New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := source.Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server{m: m, src: src, guards: &guard{}}, func() {
+		src.Close()
+		m.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	s, closeServer := newTestServer(t)
+	defer closeServer()
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+	client := ts.Client()
+	do := func(method, path, password string, header http.Header) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+	expectPage := func(password string, expected ...string) {
+		t.Helper()
+		code, page := do("GET", "/", password, nil)
+		if code != http.StatusOK {
+			t.Fatalf("expected 200, got %v: %v", code, page)
+		}
+		for _, e := range expected {
+			if !strings.Contains(page, e) {
+				t.Errorf("expected the page to contain %q, got\n%v", e, page)
+			}
+		}
+	}
+
+	// without token, the dashboard is disabled
+	for _, path := range []string{"/", "/up"} {
+		if code, _ := do("POST", path, "", nil); code != http.StatusForbidden {
+			t.Errorf("expected 403 for %v without token, got %v", path, code)
+		}
+	}
+
+	s.token = "secret"
+	for _, password := range []string{"", "wrong"} {
+		if code, _ := do("GET", "/", password, nil); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 with password %q, got %v", password, code)
+		}
+	}
+	// the pending migrations are shown decoded
+	expectPage("secret", "Version none", "1 init", "CREATE &lt;users&gt;", "No history")
+	if code, _ := do("GET", "/up", "secret", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET /up, got %v", code)
+	}
+	if code, _ := do("POST", "/up", "secret", http.Header{"Origin": {"https://evil.example"}}); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a cross-origin request, got %v", code)
+	}
+	if v, _, err := s.m.Version(); err != migrate.ErrNilVersion {
+		t.Fatalf("expected no version after refused requests, got %v, %v", v, err)
+	}
+
+	// the redirect after the button shows the page with its result
+	code, page := do("POST", "/up", "secret", http.Header{"Origin": {ts.URL}})
+	if code != http.StatusOK {
+		t.Fatalf("expected the page after the redirect, got %v: %v", code, page)
+	}
+	expectPage("secret", "Version 2", "Applied 2, skipped 0, failed 0 migrations", "No pending migrations")
+	do("POST", "/down", "secret", nil)
+	expectPage("secret", "Version 1", "Applied 1, skipped 0, failed 0 migrations", "2 users")
+}
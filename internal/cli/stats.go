@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// migrationStat is the timing of the up migration of a version, from the
+// records of -history, printed by statsCmd
+type migrationStat struct {
+	Version    uint   `json:"version"`
+	Identifier string `json:"identifier"`
+	// Runs is how often it was applied, e.g. again after migrating down
+	Runs   int   `json:"runs"`
+	LastMs int64 `json:"last_ms"`
+	MeanMs int64 `json:"mean_ms"`
+	MaxMs  int64 `json:"max_ms"`
+}
+
+// migrationStats is printed by statsCmd
+type migrationStats struct {
+	// Slowest are the migrations with the longest runs, the slowest first
+	Slowest []migrationStat `json:"slowest"`
+	// BootstrapMs is the sum of the last runs of the applied migrations,
+	// about the time it takes to migrate a new database
+	BootstrapMs         int64 `json:"bootstrap_ms"`
+	BootstrapMigrations int   `json:"bootstrap_migrations"`
+}
+
+// newMigrationStats computes the stats of the up migrations in records,
+// in the order they were applied, with the limit (all if 0) slowest.
+func newMigrationStats(records []database.HistoryRecord, limit int) migrationStats {
+	byVersion := make(map[uint]*migrationStat)
+	total := make(map[uint]time.Duration)
+	last := make(map[uint]string)
+	for _, r := range records {
+		last[r.Version] = r.Direction
+		if r.Direction != string(source.Up) {
+			continue
+		}
+		s, ok := byVersion[r.Version]
+		if !ok {
+			s = &migrationStat{Version: r.Version}
+			byVersion[r.Version] = s
+		}
+		s.Identifier = r.Identifier
+		s.Runs++
+		s.LastMs = int64(r.Duration / time.Millisecond)
+		if s.LastMs > s.MaxMs {
+			s.MaxMs = s.LastMs
+		}
+		total[r.Version] += r.Duration
+	}
+
+	stats := migrationStats{Slowest: make([]migrationStat, 0, len(byVersion))}
+	for v, s := range byVersion {
+		s.MeanMs = int64(total[v] / time.Duration(s.Runs) / time.Millisecond)
+		stats.Slowest = append(stats.Slowest, *s)
+		// a migration which was migrated down isn't part of a new database
+		if last[v] == string(source.Up) {
+			stats.BootstrapMs += s.LastMs
+			stats.BootstrapMigrations++
+		}
+	}
+	sort.Slice(stats.Slowest, func(i, j int) bool {
+		a, b := stats.Slowest[i], stats.Slowest[j]
+		if a.MaxMs != b.MaxMs {
+			return a.MaxMs > b.MaxMs
+		}
+		return a.Version < b.Version
+	})
+	if limit > 0 && len(stats.Slowest) > limit {
+		stats.Slowest = stats.Slowest[:limit]
+	}
+	return stats
+}
+
+// statsCmd (meant to be called via a CLI command) prints the limit (all if
+// 0) slowest migrations recorded with -history and the time it takes to
+// apply all applied migrations, e.g. to find the migrations worth squashing
+func statsCmd(m *migrate.Migrate, limit int, asJSON bool) {
+	records, err := m.History()
+	if err != nil {
+		log.fatal(fmt.Sprintf("error: reading the history failed, were migrations applied with -history? %v", err))
+	}
+	stats := newMigrationStats(records, limit)
+
+	if asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(stats); err != nil {
+			log.fatalErr(err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tRUNS\tLAST\tMEAN\tMAX")
+	for _, s := range stats.Slowest {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", s.Version, s.Identifier, s.Runs,
+			time.Duration(s.LastMs)*time.Millisecond, time.Duration(s.MeanMs)*time.Millisecond, time.Duration(s.MaxMs)*time.Millisecond)
+	}
+	if err := w.Flush(); err != nil {
+		log.fatalErr(err)
+	}
+	fmt.Printf("\nBootstrap: %v migrations in %v\n", stats.BootstrapMigrations, time.Duration(stats.BootstrapMs)*time.Millisecond)
+}
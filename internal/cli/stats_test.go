@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+func TestMigrationStats(t *testing.T) {
+	records := []database.HistoryRecord{
+		{Version: 1, Direction: "up", Identifier: "create_users", Duration: 10 * time.Millisecond},
+		{Version: 2, Direction: "up", Identifier: "backfill", Duration: 4 * time.Second},
+		{Version: 3, Direction: database.HistorySkip, Identifier: "seed"},
+		{Version: 4, Direction: "up", Identifier: "add_index", Duration: 300 * time.Millisecond},
+		{Version: 4, Direction: "down", Identifier: "add_index", Duration: 5 * time.Millisecond},
+		{Version: 2, Direction: "down", Identifier: "backfill", Duration: time.Second},
+		// applied again after migrating down
+		{Version: 2, Direction: "up", Identifier: "backfill", Duration: 2 * time.Second},
+	}
+
+	stats := newMigrationStats(records, 2)
+	expected := migrationStats{
+		Slowest: []migrationStat{
+			{Version: 2, Identifier: "backfill", Runs: 2, LastMs: 2000, MeanMs: 3000, MaxMs: 4000},
+			{Version: 4, Identifier: "add_index", Runs: 1, LastMs: 300, MeanMs: 300, MaxMs: 300},
+		},
+		// 4 was migrated down
+		BootstrapMs:         2010,
+		BootstrapMigrations: 2,
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+
+	if stats := newMigrationStats(records, 0); len(stats.Slowest) != 3 {
+		t.Errorf("expected all 3 up migrations, got %+v", stats.Slowest)
+	}
+	if stats := newMigrationStats(nil, 0); stats.Slowest == nil || stats.BootstrapMigrations != 0 {
+		t.Errorf("expected no stats, got %+v", stats)
+	}
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// Formats of the summary printed after a run, see -format.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// runReport is the summary of a run written by writeReport
+type runReport struct {
+	Applied    []reportMigration `json:"applied"`
+	Skipped    []reportMigration `json:"skipped"`
+	Failed     []reportMigration `json:"failed"`
+	DurationMs int64             `json:"duration_ms"`
+	LockWaitMs int64             `json:"lock_wait_ms"`
+	// Version is the resulting version, nil if there is none
+	Version *uint  `json:"version"`
+	Dirty   bool   `json:"dirty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// reportMigration is a migration of a runReport
+type reportMigration struct {
+	Version    uint   `json:"version"`
+	Direction  string `json:"direction"`
+	Identifier string `json:"identifier"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+func newReportMigrations(migrations []migrate.RunMigration) []reportMigration {
+	entries := make([]reportMigration, 0, len(migrations))
+	for _, migr := range migrations {
+		e := reportMigration{
+			Version:    migr.Version,
+			Direction:  string(migr.Direction),
+			Identifier: migr.Identifier,
+			DurationMs: int64(migr.Duration / time.Millisecond),
+		}
+		if migr.Err != nil {
+			e.Error = migr.Err.Error()
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// newRunReport reports the last run of m, which ended with err.
+func newRunReport(m *migrate.Migrate, err error) runReport {
+	s := m.LastRun()
+	if s == nil {
+		s = &migrate.RunSummary{}
+	}
+	report := runReport{
+		Applied:    newReportMigrations(s.Applied),
+		Skipped:    newReportMigrations(s.Skipped),
+		Failed:     newReportMigrations(s.Failed),
+		DurationMs: int64(s.Duration / time.Millisecond),
+		LockWaitMs: int64(s.LockWait / time.Millisecond),
+		Error:      errString(err),
+	}
+	if v, dirty, errVersion := m.Version(); errVersion == nil {
+		report.Version, report.Dirty = &v, dirty
+	}
+	return report
+}
+
+// runCmd calls run, a goto, up or down run of m, and prints the summary of
+// the run in format, see writeReport. A run which only wrote a plan with
+// -out isn't summarized.
+func runCmd(m *migrate.Migrate, format string, run func() error) {
+	err := run()
+	if m.Plan == nil {
+		report := newRunReport(m, err)
+		if format == formatJSON {
+			if errWrite := writeReport(os.Stdout, format, report); errWrite != nil {
+				log.Println(errWrite)
+			}
+		} else {
+			var b strings.Builder
+			if errWrite := writeReport(&b, format, report); errWrite != nil {
+				log.Println(errWrite)
+			} else if b.Len() > 0 {
+				log.Printf("%v", b.String())
+			}
+		}
+	}
+	if err != nil {
+		if err != migrate.ErrNoChange {
+			log.fatalErr(err)
+		} else {
+			log.Println(err)
+		}
+	}
+}
+
+// writeReport writes report to w in format: as JSON, or as a line of
+// text unless nothing changed. The durations of the migrations are only
+// written as JSON, as they are logged while they run.
+func writeReport(w io.Writer, format string, report runReport) error {
+	if format == formatJSON {
+		return json.NewEncoder(w).Encode(report)
+	}
+	if report.Error == migrate.ErrNoChange.Error() {
+		return nil
+	}
+	version := "none"
+	if report.Version != nil {
+		version = fmt.Sprint(*report.Version)
+		if report.Dirty {
+			version += " (dirty)"
+		}
+	}
+	_, err := fmt.Fprintf(w, "Applied %v, skipped %v, failed %v migrations in %v (lock wait %v), version: %v\n",
+		len(report.Applied), len(report.Skipped), len(report.Failed),
+		time.Duration(report.DurationMs)*time.Millisecond, time.Duration(report.LockWaitMs)*time.Millisecond, version)
+	return err
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+func TestWriteReport(t *testing.T) {
+	version := uint(4)
+	report := runReport{
+		Applied:    []reportMigration{{Version: 1, Direction: "up", Identifier: "create_users", DurationMs: 12}},
+		Skipped:    []reportMigration{},
+		Failed:     []reportMigration{{Version: 3, Direction: "up", Identifier: "backfill", Error: "deadlock"}},
+		DurationMs: 1500,
+		LockWaitMs: 20,
+		Version:    &version,
+	}
+
+	cases := []struct {
+		name     string
+		format   string
+		report   runReport
+		expected string
+	}{
+		{"text", formatText, report, "Applied 1, skipped 0, failed 1 migrations in 1.5s (lock wait 20ms), version: 4\n"},
+		{"json", formatJSON, report, `{"applied":[{"version":1,"direction":"up","identifier":"create_users","duration_ms":12}],` +
+			`"skipped":[],"failed":[{"version":3,"direction":"up","identifier":"backfill","duration_ms":0,"error":"deadlock"}],` +
+			`"duration_ms":1500,"lock_wait_ms":20,"version":4,"dirty":false}` + "\n"},
+		{"no version", formatText, runReport{}, "Applied 0, skipped 0, failed 0 migrations in 0s (lock wait 0s), version: none\n"},
+		{"no change", formatText, runReport{Error: migrate.ErrNoChange.Error()}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeReport(&b, c.format, c.report); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+const tuiKeys = "↑↓ move  tab up/down  u apply to here  d roll back to here  r reload  q quit"
+
+// tuiRow is a migration in the list of the tui command
+type tuiRow struct {
+	migration
+	dirty bool
+	// checksum compares the applied migration with its file, see
+	// checksumStatus
+	checksum  string
+	appliedAt time.Time
+}
+
+func (r tuiRow) state() string {
+	switch {
+	case r.dirty:
+		return "dirty"
+	case !r.applied:
+		return "pending"
+	}
+	return "applied"
+}
+
+// tui is the screen of the tui command: the migrations, a preview of the
+// selected one and a status line.
+type tui struct {
+	m      *migrate.Migrate
+	src    source.Driver
+	guards *guard
+
+	rows     []tuiRow
+	version  string
+	selected int
+	// offset is the first row shown
+	offset int
+	// down previews the down migration instead of the up migration
+	down   bool
+	status string
+	// confirm is run if the user answers the status with y
+	confirm func() error
+}
+
+func tuiCmd(m *migrate.Migrate, sourceURL string, guards *guard) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		log.fatal("error: tui needs a terminal")
+	}
+	src, err := source.Open(sourceURL)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	defer src.Close()
+
+	t := &tui{m: m, src: src, guards: guards}
+	if err := t.load(); err != nil {
+		log.fatalErr(err)
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	// alternate screen without cursor
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	err = t.run(os.Stdin, os.Stdout, func() (int, int) {
+		width, height, err := term.GetSize(fd)
+		if err != nil || width <= 0 || height <= 0 {
+			return 80, 24
+		}
+		return width, height
+	})
+	fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+	term.Restore(fd, state)
+	if err != nil {
+		log.fatalErr(err)
+	}
+}
+
+// load reads the migrations, their state and, if there is a history, when
+// they were applied and whether they changed since.
+func (t *tui) load() error {
+	migrations, err := listMigrations(t.m)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := t.m.Version()
+	switch {
+	case err == migrate.ErrNilVersion:
+		t.version = "none"
+	case err != nil:
+		return err
+	case dirty:
+		t.version = fmt.Sprintf("%v (dirty)", version)
+	default:
+		t.version = fmt.Sprint(version)
+	}
+
+	t.rows = make([]tuiRow, len(migrations))
+	for i, mig := range migrations {
+		t.rows[i] = tuiRow{migration: mig, dirty: dirty && mig.version == version}
+	}
+	history, err := t.m.History()
+	if err != nil {
+		t.status = "no history of applied migrations, see -history"
+		return nil
+	}
+	// the last record of a version wins, a down record means not applied
+	last := make(map[uint]int)
+	for i, r := range history {
+		last[r.Version] = i
+	}
+	for i := range t.rows {
+		row := &t.rows[i]
+		j, ok := last[row.version]
+		if !ok || history[j].Direction != string(source.Up) || !row.applied {
+			continue
+		}
+		row.appliedAt = history[j].Applied
+		row.checksum = checksumStatus(t.src, history[j])
+	}
+	return nil
+}
+
+func (t *tui) read(version uint, direction source.Direction) ([]byte, error) {
+	read := t.src.ReadUp
+	if direction == source.Down {
+		read = t.src.ReadDown
+	}
+	r, _, err := read(version)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// run handles keys read from in and draws to out until the user quits
+func (t *tui) run(in io.Reader, out io.Writer, size func() (int, int)) error {
+	buf := make([]byte, 8)
+	for {
+		width, height := size()
+		fmt.Fprint(out, "\x1b[H"+strings.Join(t.render(width, height), "\x1b[K\r\n")+"\x1b[K\x1b[J")
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		if !t.key(string(buf[:n]), height) {
+			return nil
+		}
+	}
+}
+
+// key handles a key press and returns false to quit
+func (t *tui) key(key string, height int) bool {
+	if t.confirm != nil {
+		confirm := t.confirm
+		t.confirm = nil
+		t.status = ""
+		if key == "y" {
+			t.status = t.apply(confirm)
+		}
+		return true
+	}
+
+	page := t.listHeight(height)
+	switch key {
+	case "q", "\x03":
+		return false
+	case "\x1b[A", "k":
+		t.move(-1)
+	case "\x1b[B", "j":
+		t.move(1)
+	case "\x1b[5~":
+		t.move(-page)
+	case "\x1b[6~":
+		t.move(page)
+	case "\t":
+		t.down = !t.down
+	case "r":
+		t.status = ""
+		if err := t.load(); err != nil {
+			t.status = "error: " + err.Error()
+		}
+	case "u", "d":
+		if len(t.rows) > 0 {
+			t.ask(key)
+		}
+	}
+	return true
+}
+
+func (t *tui) move(n int) {
+	t.selected += n
+	if t.selected >= len(t.rows) {
+		t.selected = len(t.rows) - 1
+	}
+	if t.selected < 0 {
+		t.selected = 0
+	}
+}
+
+// ask asks for confirmation to apply up to, or roll back, the selected
+// migration
+func (t *tui) ask(key string) {
+	row := t.rows[t.selected]
+	if key == "u" {
+		t.status = fmt.Sprintf("Apply up to and including %v? (y/n)", row.migration)
+		t.confirm = t.guarded("up", func() error {
+			return t.m.Migrate(row.version)
+		})
+		return
+	}
+	t.status = fmt.Sprintf("Roll back %v and everything after? (y/n)", row.migration)
+	if t.selected == 0 {
+		t.confirm = t.guarded("down", t.m.Down)
+		return
+	}
+	previous := t.rows[t.selected-1].version
+	t.confirm = t.guarded("down", func() error {
+		return t.m.Migrate(previous)
+	})
+}
+
+// guarded returns run of command, which fails if guard rules block it
+func (t *tui) guarded(command string, run func() error) func() error {
+	return func() error {
+		if err := t.guards.check(t.m, command, run); err != nil {
+			return err
+		}
+		return run()
+	}
+}
+
+// apply runs f quietly, as logging would garble the screen, and returns
+// its result for the status line
+func (t *tui) apply(f func() error) string {
+	logger, onApplied := t.m.Log, t.m.OnApplied
+	applied := 0
+	t.m.Log = nil
+	t.m.OnApplied = func(migr *migrate.Migration) {
+		applied++
+		if onApplied != nil {
+			onApplied(migr)
+		}
+	}
+	err := f()
+	t.m.Log, t.m.OnApplied = logger, onApplied
+
+	status := fmt.Sprintf("%v migrations applied", applied)
+	if err == migrate.ErrNoChange {
+		status = "no change"
+	} else if err != nil {
+		status = fmt.Sprintf("%v migrations applied, error: %v", applied, err)
+	}
+	if err := t.load(); err != nil {
+		return "error: " + err.Error()
+	}
+	return status
+}
+
+// listHeight is the number of rows shown, the list takes half of the
+// screen besides the title, header and status lines
+func (t *tui) listHeight(height int) int {
+	if h := (height - 3) / 2; h > 1 {
+		return h
+	}
+	return 1
+}
+
+// render returns the lines of the screen
+func (t *tui) render(width, height int) []string {
+	var lines []string
+	add := func(s string) {
+		if r := []rune(s); len(r) > width {
+			s = string(r[:width])
+		}
+		lines = append(lines, s)
+	}
+
+	pending := 0
+	for _, r := range t.rows {
+		if r.state() == "pending" {
+			pending++
+		}
+	}
+	add(fmt.Sprintf("migrate tui - version %v, %v migrations, %v pending", t.version, len(t.rows), pending))
+
+	listHeight := t.listHeight(height)
+	if t.selected < t.offset {
+		t.offset = t.selected
+	}
+	if t.selected >= t.offset+listHeight {
+		t.offset = t.selected - listHeight + 1
+	}
+	add(fmt.Sprintf("  %-14v %-30v %-8v %-8v %v", "VERSION", "NAME", "STATE", "CHECKSUM", "APPLIED"))
+	for i := t.offset; i < t.offset+listHeight; i++ {
+		if i >= len(t.rows) {
+			add("")
+			continue
+		}
+		r := t.rows[i]
+		cursor := "  "
+		if i == t.selected {
+			cursor = "> "
+		}
+		applied := ""
+		if !r.appliedAt.IsZero() {
+			applied = r.appliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		add(fmt.Sprintf("%v%-14v %-30v %-8v %-8v %v", cursor, r.version, r.name, r.state(), r.checksum, applied))
+	}
+
+	previewHeight := height - len(lines) - 2
+	if len(t.rows) > 0 && previewHeight > 0 {
+		direction := source.Up
+		if t.down {
+			direction = source.Down
+		}
+		r := t.rows[t.selected]
+		add(fmt.Sprintf("-- %v (%v) ", r.migration, direction) + strings.Repeat("-", width))
+		body, err := t.read(r.version, direction)
+		preview := strings.Split(strings.Replace(string(body), "\t", "    ", -1), "\n")
+		if os.IsNotExist(err) {
+			preview = []string{fmt.Sprintf("no %v migration", direction)}
+		} else if err != nil {
+			preview = []string{"error: " + err.Error()}
+		}
+		for i := 0; i < previewHeight; i++ {
+			if i < len(preview) {
+				add(strings.TrimRight(preview[i], "\r"))
+			} else {
+				add("")
+			}
+		}
+	}
+
+	for len(lines) < height-1 {
+		add("")
+	}
+	status := t.status
+	if status == "" {
+		status = tuiKeys
+	}
+	add(status)
+	return lines
+}
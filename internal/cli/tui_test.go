@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func TestTUI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_tui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"1_init.up.sql":     "CREATE 1",
+		"1_init.down.sql":   "DROP 1",
+		"2_users.up.sql":    "CREATE 2\nINDEX 2",
+		"3_orders.up.sql":   "CREATE 3",
+		"3_orders.down.sql": "DROP 3",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := migrate.New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	src, err := source.Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	ui := &tui{m: m, src: src, guards: &guard{}}
+	if err := ui.load(); err != nil {
+		t.Fatal(err)
+	}
+	screen := func() string {
+		return strings.Join(ui.render(60, 12), "\n")
+	}
+	expectScreen := func(expected ...string) {
+		t.Helper()
+		s := screen()
+		for _, e := range expected {
+			if !strings.Contains(s, e) {
+				t.Errorf("expected screen to contain %q, got\n%v", e, s)
+			}
+		}
+	}
+
+	// stub has no history
+	expectScreen("version none, 3 migrations, 3 pending", "> 1", "CREATE 1", "no history")
+
+	// move to 2, apply up to it
+	for _, key := range []string{"j", "\x1b[B", "k"} {
+		ui.key(key, 12)
+	}
+	expectScreen("> 2", "CREATE 2\nINDEX 2")
+	ui.key("u", 12)
+	expectScreen("Apply up to and including 2 users? (y/n)")
+	ui.key("y", 12)
+	expectScreen("version 2, 3 migrations, 1 pending", "2 migrations applied")
+
+	// roll back 2, which has no down migration
+	ui.key("\t", 12)
+	expectScreen("(down)", "no down migration")
+	ui.key("d", 12)
+	expectScreen("Roll back 2 users and everything after? (y/n)")
+	ui.key("n", 12)
+	expectScreen("version 2, 3 migrations, 1 pending")
+	ui.key("d", 12)
+	ui.key("y", 12)
+	expectScreen("version 1, 3 migrations, 2 pending", "1 migrations applied")
+
+	// rolling back the first migration reverts everything
+	ui.key("\x1b[5~", 12)
+	ui.key("r", 12)
+	ui.key("d", 12)
+	ui.key("y", 12)
+	if _, _, err := m.Version(); err != migrate.ErrNilVersion {
+		t.Errorf("expected no version after rolling back 1, got %v", err)
+	}
+
+	if ui.key("q", 12) {
+		t.Error("expected q to quit")
+	}
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// fileSourceDir returns the directory of a file source URL
+func fileSourceDir(sourceURL string) (string, error) {
+	if !strings.HasPrefix(sourceURL, "file://") {
+		return "", errors.New("watch needs migrations in a directory, set -path")
+	}
+	dir := strings.TrimPrefix(sourceURL, "file://")
+	if i := strings.IndexByte(dir, '?'); i >= 0 {
+		dir = dir[:i]
+	}
+	return dir, nil
+}
+
+// watchCmd applies new migrations of the file source sourceURL whenever
+// migrations in its directory are created or written, until interrupted.
+// Changes are applied once the directory was quiet for delay, as editors
+// write files in several steps.
+func watchCmd(sourceURL string, delay time.Duration, guards *guard, open func() (*migrate.Migrate, func(), error)) {
+	dir, err := fileSourceDir(sourceURL)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(dir); err != nil {
+		log.fatalErr(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	log.Println("Watching", dir, "for new migrations, press Ctrl+C to stop")
+	watchApply(sourceURL, guards, open)
+	var quiet <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+				continue
+			}
+			// skip other files, e.g. swap files of editors
+			if _, err := source.Parse(filepath.Base(event.Name)); err != nil {
+				continue
+			}
+			quiet = time.After(delay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("error:", err)
+		case <-quiet:
+			quiet = nil
+			watchApply(sourceURL, guards, open)
+		case <-signals:
+			return
+		}
+	}
+}
+
+// watchApply applies the pending migrations up to the first empty one,
+// which was likely just created and isn't written yet. Errors are logged,
+// so that watching continues once the migration is fixed, as are migrations
+// blocked by guards.
+func watchApply(sourceURL string, guards *guard, open func() (*migrate.Migrate, func(), error)) {
+	// open a new Migrate to read the current migrations of the directory
+	m, close, err := open()
+	if err != nil {
+		log.Println("error:", err)
+		return
+	}
+	defer close()
+	// Pending ignores a failed migration, which must be fixed by hand
+	if version, dirty, err := m.Version(); err == nil && dirty {
+		log.Println("error:", migrate.ErrDirty{Version: int(version)})
+		return
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		log.Println("error:", err)
+		return
+	}
+
+	src, err := source.Open(sourceURL)
+	if err != nil {
+		log.Println("error:", err)
+		return
+	}
+	defer src.Close()
+	n := 0
+	for _, version := range pending {
+		empty, err := emptyUp(src, version)
+		if err != nil {
+			log.Println("error:", err)
+			return
+		}
+		if empty {
+			log.Printf("Waiting for migration %v to be written\n", version)
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	apply := func() error {
+		return m.Steps(n)
+	}
+	if err := guards.check(m, "up", apply); err != nil {
+		log.Println("error:", err)
+		return
+	}
+	if err := apply(); err != nil && err != migrate.ErrNoChange {
+		log.Println("error:", err)
+	}
+}
+
+// emptyUp reports whether the up migration of version has no content
+func emptyUp(src source.Driver, version uint) (bool, error) {
+	r, _, err := src.ReadUp(version)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	return len(bytes.TrimSpace(body)) == 0, nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+func TestFileSourceDir(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"file://migrations", "migrations"},
+		{"file:///abs/migrations?x-dependency-order=true", "/abs/migrations"},
+	}
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			dir, err := fileSourceDir(c.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dir != c.expected {
+				t.Error("Incorrect dir: " + dir + " != " + c.expected)
+			}
+		})
+	}
+
+	if _, err := fileSourceDir("s3://bucket/migrations"); err == nil {
+		t.Error("expected an error for s3")
+	}
+}
+
+func TestEmptyUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	files := map[string]string{
+		"1_written.up.sql": "CREATE TABLE t (id int);",
+		"2_created.up.sql": "\n",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := source.Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for version, expected := range map[uint]bool{1: false, 2: true} {
+		empty, err := emptyUp(src, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if empty != expected {
+			t.Errorf("expected empty %v for version %v, got %v", expected, version, empty)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package url
 
 import (
 	"errors"
+	nurl "net/url"
 	"strings"
 )
 
@@ -23,3 +24,18 @@ func SchemeFromURL(url string) (string, error) {
 
 	return url[0:i], nil
 }
+
+// Redact returns the URL string with its password replaced by xxxxx.
+// Unparsable URLs are reduced to their scheme.
+func Redact(url string) string {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		scheme, _ := SchemeFromURL(url)
+		return scheme + "://xxxxx"
+	}
+	if _, ok := u.User.Password(); !ok {
+		return url
+	}
+	u.User = nurl.UserPassword(u.User.Username(), "xxxxx")
+	return u.String()
+}
@@ -0,0 +1,171 @@
+package migrate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// ErrLoadUnsupported is returned when running a migration with the `load`
+// pragma with a database driver not implementing database.Loader.
+var ErrLoadUnsupported = errors.New("database driver can't load data")
+
+// LoadProgressInterval is the number of rows after which the progress
+// of migrations with the `load` pragma is logged.
+var LoadProgressInterval int64 = 10000
+
+// load runs a migration with the `load` pragma, e.g. `# migrate:load countries csv`.
+// The migration body following the pragmas is the data, CSV with a header
+// naming the columns or JSON lines, which the database driver bulk loads
+// into the table.
+func (m *Migrate) load(migr *Migration, spec string, body io.Reader) error {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("%v: invalid load pragma %q, expected TABLE [csv|jsonl]", migr.LogString(), spec)
+	}
+	table, format := fields[0], "csv"
+	if len(fields) == 2 {
+		format = fields[1]
+	}
+
+	return m.loadTable(migr.LogString(), table, format, pragma.Body(body))
+}
+
+// loadTable bulk loads the rows of data in format csv or jsonl into table.
+// name identifies data in logs and errors.
+func (m *Migrate) loadTable(name, table, format string, data io.Reader) error {
+	var columns []string
+	var next func() ([]interface{}, error)
+	var err error
+	switch format {
+	case "csv":
+		columns, next, err = csvRows(data)
+	case "jsonl":
+		columns, next, err = jsonRows(data)
+	default:
+		return fmt.Errorf("%v: unknown load format %q, expected csv or jsonl", name, format)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	if len(columns) == 0 {
+		m.logPrintf("%v: no rows to load into %v\n", name, table)
+		return nil
+	}
+
+	var read int64
+	progress := func() ([]interface{}, error) {
+		row, err := next()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("%v: row %v: %v", name, read+1, err)
+			}
+			return nil, err
+		}
+		read++
+		if LoadProgressInterval > 0 && read%LoadProgressInterval == 0 {
+			m.logPrintf("%v: read %v rows\n", name, read)
+		}
+		return row, nil
+	}
+	loaded, err := m.databaseDrv.(database.Loader).Load(table, columns, progress)
+	if err != nil {
+		return err
+	}
+	m.logPrintf("%v: loaded %v rows into %v\n", name, loaded, table)
+	return nil
+}
+
+// csvRows returns the columns named by the header of r and a function
+// returning its rows. Empty values are loaded as NULL.
+func csvRows(r io.Reader) ([]string, func() ([]interface{}, error), error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, func() ([]interface{}, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(record))
+		for i, v := range record {
+			if v != "" {
+				row[i] = v
+			}
+		}
+		return row, nil
+	}, nil
+}
+
+// jsonRows returns the columns named by the keys of the first object in r,
+// in alphabetical order, and a function returning its rows. Missing keys are
+// loaded as NULL, nested objects and arrays as JSON text.
+func jsonRows(r io.Reader) ([]string, func() ([]interface{}, error), error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var first map[string]interface{}
+	if err := decoder.Decode(&first); err == io.EOF {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, 0, len(first))
+	index := make(map[string]int, len(first))
+	for c := range first {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	for i, c := range columns {
+		index[c] = i
+	}
+
+	object := first
+	return columns, func() ([]interface{}, error) {
+		if object == nil {
+			if err := decoder.Decode(&object); err != nil {
+				return nil, err
+			}
+		}
+		row := make([]interface{}, len(columns))
+		for k, v := range object {
+			i, ok := index[k]
+			if !ok {
+				return nil, fmt.Errorf("unknown column %q", k)
+			}
+			value, err := jsonValue(v)
+			if err != nil {
+				return nil, err
+			}
+			row[i] = value
+		}
+		object = nil
+		return row, nil
+	}, nil
+}
+
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		return string(b), err
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+// loadStub is a stub database implementing database.Loader,
+// loaded rows are added to its migration sequence
+type loadStub struct {
+	*dStub.Stub
+}
+
+func (l *loadStub) Load(table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	var loaded int64
+	for {
+		row, err := next()
+		if err == io.EOF {
+			return loaded, nil
+		}
+		if err != nil {
+			return loaded, err
+		}
+		l.MigrationSequence = append(l.MigrationSequence, fmt.Sprint(table, columns, row))
+		loaded++
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up,
+		Identifier: "# migrate:load countries\ncode,name\nDE,Germany\n\"FR\",\"France, \"\"la\"\"\"\nXX,\n"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up,
+		Identifier: "-- migrate:load users jsonl\n{\"id\": 1, \"admin\": false, \"name\": \"ann\", \"tags\": [\"a\"]}\n{\"id\": 2.5, \"admin\": true}\n"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Up,
+		Identifier: "-- migrate:load users jsonl\n{\"id\": 1}\n{\"name\": \"bob\"}\n"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != ErrLoadUnsupported {
+		t.Fatalf("expected ErrLoadUnsupported, got %v", err)
+	}
+	if v, dirty, _ := m.Version(); v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v, %v", v, dirty)
+	}
+
+	db := &loadStub{Stub: dbDrv.(*dStub.Stub)}
+	m, err = NewWithInstance("stub", srcDrv, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"CREATE 1",
+		"countries[code name] [DE Germany]",
+		`countries[code name] [FR France, "la"]`,
+		"countries[code name] [XX <nil>]",
+		"users[admin id name tags] [false 1 ann [\"a\"]]",
+		"users[admin id name tags] [true 2.5 <nil> <nil>]",
+	}
+	if !reflect.DeepEqual(db.MigrationSequence, expected) {
+		t.Errorf("expected %q, got %q", expected, db.MigrationSequence)
+	}
+
+	// columns are those of the first object
+	if err := m.Up(); err == nil || err.Error() != `4/u 4.up.stub: row 2: unknown column "name"` {
+		t.Errorf("expected unknown column error, got %v", err)
+	}
+}
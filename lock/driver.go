@@ -0,0 +1,188 @@
+// Package lock provides the Lock interface for external lock providers.
+// They lock databases whose own locking is weak or impossible, e.g.
+// ClickHouse or Cassandra, with a service shared by all migrate runners.
+// All lock drivers must implement this interface, register themselves
+// and pass the tests in package lock/testing.
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	nurl "net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+var driversMu sync.RWMutex
+var drivers = make(map[string]Driver)
+
+// DefaultTTL is the time after which a lock expires unless it is refreshed,
+// so that the lock of a crashed runner is released eventually.
+var DefaultTTL = 30 * time.Second
+
+// Driver is the interface every lock driver must implement.
+// A Driver is a database.Locker and can be set as migrate.Migrate.Locker.
+//
+// How to implement a lock driver?
+//   1. Implement this interface.
+//   2. Add a test that calls lock/testing.go:Test()
+//   3. Call Register in init().
+//
+// Guidelines:
+//   * Locks should expire after a TTL (see DefaultTTL) and be refreshed
+//     while they are held, e.g. with Refresh.
+//   * Unlock must only release a lock acquired by the same instance.
+//   * Record the Holder of a lock and implement database.LockReporter
+//     and database.ForceUnlocker, so that stale locks can be inspected
+//     and released.
+type Driver interface {
+	// Open returns a new driver instance configured with parameters
+	// coming from the URL string.
+	Open(url string) (Driver, error)
+
+	// Close closes the connection to the lock provider.
+	Close() error
+
+	// Lock acquires the lock. If it is held by someone else,
+	// Lock should return database.ErrLocked.
+	Lock() error
+
+	// Unlock releases the lock.
+	Unlock() error
+}
+
+// Open returns a new driver instance.
+func Open(url string) (Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("lock driver: invalid URL scheme")
+	}
+
+	driversMu.RLock()
+	d, ok := drivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("lock driver: unknown driver %v (forgotten import?)", u.Scheme)
+	}
+
+	return d.Open(url)
+}
+
+// Register globally registers a driver.
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("Register called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// List lists the registered drivers
+func List() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for n := range drivers {
+		names = append(names, n)
+	}
+	return names
+}
+
+// TTL returns the `ttl` query parameter of u, or DefaultTTL.
+func TTL(u *nurl.URL) (time.Duration, error) {
+	s := u.Query().Get("ttl")
+	if s == "" {
+		return DefaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if ttl < time.Second {
+		return 0, fmt.Errorf("lock driver: ttl %v is shorter than a second", ttl)
+	}
+	return ttl, nil
+}
+
+// NewToken returns a random token identifying the holder of a lock.
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Holder describes the holder of a lock, drivers store it as the value of a lock.
+type Holder struct {
+	// Token identifies the driver instance holding the lock
+	Token string `json:"token"`
+	database.LockInfo
+}
+
+// NewHolder returns the Holder of a lock acquired now by this process.
+func NewHolder() (Holder, error) {
+	token, err := NewToken()
+	if err != nil {
+		return Holder{}, err
+	}
+	return Holder{Token: token, LockInfo: database.NewLockInfo()}, nil
+}
+
+// Encode returns h as JSON.
+func (h Holder) Encode() (string, error) {
+	b, err := json.Marshal(h)
+	return string(b), err
+}
+
+// DecodeHolder decodes a Holder encoded by Encode.
+func DecodeHolder(s string) (Holder, error) {
+	var h Holder
+	err := json.Unmarshal([]byte(s), &h)
+	return h, err
+}
+
+// Refresher calls a refresh function periodically while a lock is held.
+type Refresher struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Refresh calls refresh every third of ttl until Stop is called.
+// A failed refresh is retried with the next one, if the lock
+// expired in the meantime, it can't be refreshed anymore.
+func Refresh(ttl time.Duration, refresh func() error) *Refresher {
+	r := &Refresher{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				_ = refresh()
+			}
+		}
+	}()
+	return r
+}
+
+// Stop stops refreshing and waits for a running refresh to return.
+func (r *Refresher) Stop() {
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,216 @@
+// Package dynamodb locks with an item of a DynamoDB table, written with
+// conditional writes. The table needs a string partition key named LockID.
+// Items of crashed runners are taken over once they expired, enable
+// DynamoDB's Time to Live on the Expires attribute to clean them up.
+//
+// URL: dynamodb://table[?key=migrate-lock&ttl=30s]
+// Credentials and region are read from the environment like the AWS CLI does.
+package dynamodb
+
+import (
+	"errors"
+	nurl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/lock"
+)
+
+func init() {
+	lock.Register("dynamodb", &DynamoDB{})
+}
+
+// DefaultKey is the LockID of the lock item.
+var DefaultKey = "migrate-lock"
+
+type Config struct {
+	Table string
+	Key   string
+	TTL   time.Duration
+}
+
+type DynamoDB struct {
+	client dynamodbiface.DynamoDBAPI
+	config *Config
+
+	token     string
+	refresher *lock.Refresher
+}
+
+func (d *DynamoDB) Open(url string) (lock.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := lock.TTL(u)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Query().Get("key")
+	if key == "" {
+		key = DefaultKey
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, err
+	}
+	return WithInstance(dynamodb.New(sess), &Config{Table: u.Host, Key: key, TTL: ttl})
+}
+
+// WithInstance returns a lock using an existing DynamoDB client.
+func WithInstance(client dynamodbiface.DynamoDBAPI, config *Config) (lock.Driver, error) {
+	if config == nil || config.Table == "" || config.Key == "" || config.TTL <= 0 {
+		return nil, errors.New("dynamodb: config needs a table, key and ttl")
+	}
+	return &DynamoDB{client: client, config: config}, nil
+}
+
+func (d *DynamoDB) Close() error {
+	return nil
+}
+
+func (d *DynamoDB) Lock() error {
+	holder, err := lock.NewHolder()
+	if err != nil {
+		return err
+	}
+	token := holder.Token
+	now := time.Now()
+	_, err = d.client.PutItem(&dynamodb.PutItemInput{
+		TableName: d.config.table(),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockID":   {S: aws.String(d.config.Key)},
+			"Token":    {S: aws.String(token)},
+			"Expires":  unix(now.Add(d.config.TTL)),
+			"Hostname": {S: aws.String(holder.Hostname)},
+			"PID":      {N: aws.String(strconv.Itoa(holder.PID))},
+			"User":     {S: aws.String(holder.User)},
+			"Since":    {S: aws.String(holder.Since.Format(time.RFC3339))},
+		},
+		// a missing or expired lock, attribute names avoid reserved words
+		ConditionExpression:      aws.String("attribute_not_exists(#id) OR #expires < :now"),
+		ExpressionAttributeNames: map[string]*string{"#id": aws.String("LockID"), "#expires": aws.String("Expires")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": unix(now),
+		},
+	})
+	if isConditionFailed(err) {
+		return database.ErrLocked
+	}
+	if err != nil {
+		return err
+	}
+
+	d.token = token
+	d.refresher = lock.Refresh(d.config.TTL, func() error {
+		_, err := d.client.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:                d.config.table(),
+			Key:                      d.config.key(),
+			UpdateExpression:         aws.String("SET #expires = :expires"),
+			ConditionExpression:      aws.String("#token = :token"),
+			ExpressionAttributeNames: map[string]*string{"#token": aws.String("Token"), "#expires": aws.String("Expires")},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":expires": unix(time.Now().Add(d.config.TTL)),
+				":token":   {S: aws.String(token)},
+			},
+		})
+		return err
+	})
+	return nil
+}
+
+func (d *DynamoDB) Unlock() error {
+	if d.token == "" {
+		return nil
+	}
+	d.refresher.Stop()
+	_, err := d.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                d.config.table(),
+		Key:                      d.config.key(),
+		ConditionExpression:      aws.String("#token = :token"),
+		ExpressionAttributeNames: map[string]*string{"#token": aws.String("Token")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":token": {S: aws.String(d.token)},
+		},
+	})
+	d.token = ""
+	// the lock expired and was taken over by someone else
+	if isConditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+func (d *DynamoDB) LockHolder() (*database.LockInfo, error) {
+	output, err := d.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      d.config.table(),
+		Key:            d.config.key(),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	item := output.Item
+	if item == nil || item["Expires"] == nil {
+		return nil, nil
+	}
+	expires, err := strconv.ParseInt(aws.StringValue(item["Expires"].N), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if expires < time.Now().Unix() {
+		return nil, nil
+	}
+
+	info := &database.LockInfo{}
+	if v := item["Hostname"]; v != nil {
+		info.Hostname = aws.StringValue(v.S)
+	}
+	if v := item["User"]; v != nil {
+		info.User = aws.StringValue(v.S)
+	}
+	if v := item["PID"]; v != nil {
+		info.PID, _ = strconv.Atoi(aws.StringValue(v.N))
+	}
+	if v := item["Since"]; v != nil {
+		info.Since, _ = time.Parse(time.RFC3339, aws.StringValue(v.S))
+	}
+	return info, nil
+}
+
+func (d *DynamoDB) ForceUnlock() error {
+	if d.token != "" {
+		d.refresher.Stop()
+		d.token = ""
+	}
+	_, err := d.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: d.config.table(),
+		Key:       d.config.key(),
+	})
+	return err
+}
+
+func (c *Config) table() *string {
+	return aws.String(c.Table)
+}
+
+func (c *Config) key() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"LockID": {S: aws.String(c.Key)}}
+}
+
+func unix(t time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.Unix(), 10))}
+}
+
+func isConditionFailed(err error) bool {
+	e, ok := err.(awserr.Error)
+	return ok && e.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
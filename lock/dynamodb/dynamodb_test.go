@@ -0,0 +1,99 @@
+package dynamodb
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	lt "github.com/golang-migrate/migrate/v4/lock/testing"
+)
+
+// fakeDynamoDB evaluates the conditions used by the lock
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	mu    sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+var errConditionFailed = awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+
+func (f *fakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := *input.Item["LockID"].S
+	if item, ok := f.items[id]; ok {
+		expires, _ := strconv.ParseInt(*item["Expires"].N, 10, 64)
+		now, _ := strconv.ParseInt(*input.ExpressionAttributeValues[":now"].N, 10, 64)
+		if expires >= now {
+			return nil, errConditionFailed
+		}
+	}
+	f.items[id] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, ok := f.items[*input.Key["LockID"].S]
+	if !ok || *item["Token"].S != *input.ExpressionAttributeValues[":token"].S {
+		return nil, errConditionFailed
+	}
+	item["Expires"] = input.ExpressionAttributeValues[":expires"]
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: f.items[*input.Key["LockID"].S]}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := *input.Key["LockID"].S
+	item, ok := f.items[id]
+	if input.ConditionExpression != nil && (!ok || *item["Token"].S != *input.ExpressionAttributeValues[":token"].S) {
+		return nil, errConditionFailed
+	}
+	delete(f.items, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func Test(t *testing.T) {
+	client := &fakeDynamoDB{items: make(map[string]map[string]*dynamodb.AttributeValue)}
+	config := &Config{Table: "locks", Key: "test-lock", TTL: 3 * time.Second}
+	d1, err := WithInstance(client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := WithInstance(client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt.Test(t, d1, d2)
+}
+
+func TestExpiredLock(t *testing.T) {
+	client := &fakeDynamoDB{items: make(map[string]map[string]*dynamodb.AttributeValue)}
+	client.items["test-lock"] = map[string]*dynamodb.AttributeValue{
+		"Token":   {S: new(string)},
+		"Expires": unix(time.Now().Add(-time.Minute)),
+	}
+	d, err := WithInstance(client, &Config{Table: "locks", Key: "test-lock", TTL: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
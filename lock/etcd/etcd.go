@@ -0,0 +1,211 @@
+// Package etcd locks with an etcd key attached to a lease, through the
+// JSON API of etcd v3.4 or later. The key is deleted when the lease expires.
+//
+// URL: etcd://host:2379[?key=migrate-lock&ttl=30s&tls=true]
+package etcd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/lock"
+)
+
+func init() {
+	lock.Register("etcd", &Etcd{})
+}
+
+// DefaultKey is the key of the lock.
+var DefaultKey = "migrate-lock"
+
+type Config struct {
+	// Endpoint is the URL of an etcd server, e.g. http://localhost:2379
+	Endpoint string
+	Key      string
+	TTL      time.Duration
+}
+
+type Etcd struct {
+	client *http.Client
+	config *Config
+
+	lease     string
+	refresher *lock.Refresher
+}
+
+func (e *Etcd) Open(url string) (lock.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := lock.TTL(u)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Query().Get("key")
+	if key == "" {
+		key = DefaultKey
+	}
+	scheme := "http"
+	if u.Query().Get("tls") == "true" {
+		scheme = "https"
+	}
+
+	return WithInstance(&http.Client{Timeout: 10 * time.Second}, &Config{
+		Endpoint: scheme + "://" + u.Host,
+		Key:      key,
+		TTL:      ttl,
+	})
+}
+
+// WithInstance returns a lock using client to talk to etcd.
+func WithInstance(client *http.Client, config *Config) (lock.Driver, error) {
+	if config == nil || config.Endpoint == "" || config.Key == "" || config.TTL <= 0 {
+		return nil, errors.New("etcd: config needs an endpoint, key and ttl")
+	}
+	return &Etcd{client: client, config: config}, nil
+}
+
+func (e *Etcd) Close() error {
+	return nil
+}
+
+func (e *Etcd) Lock() error {
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	seconds := int64(e.config.TTL / time.Second)
+	if err := e.post("/v3/lease/grant", map[string]interface{}{"TTL": seconds}, &grant); err != nil {
+		return err
+	}
+
+	holder, err := lock.NewHolder()
+	if err != nil {
+		return err
+	}
+	value, err := holder.Encode()
+	if err != nil {
+		return err
+	}
+	key := e.key()
+	// put the key, unless it exists
+	txn := map[string]interface{}{
+		"compare": []interface{}{map[string]interface{}{
+			"key": key, "result": "EQUAL", "target": "CREATE", "create_revision": "0",
+		}},
+		"success": []interface{}{map[string]interface{}{
+			"request_put": map[string]interface{}{
+				"key": key, "value": base64.StdEncoding.EncodeToString([]byte(value)), "lease": grant.ID,
+			},
+		}},
+	}
+	var result struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := e.post("/v3/kv/txn", txn, &result); err != nil {
+		return err
+	}
+	if !result.Succeeded {
+		if err := e.revoke(grant.ID); err != nil {
+			return err
+		}
+		return database.ErrLocked
+	}
+
+	e.lease = grant.ID
+	e.refresher = lock.Refresh(e.config.TTL, func() error {
+		return e.post("/v3/lease/keepalive", map[string]interface{}{"ID": grant.ID}, nil)
+	})
+	return nil
+}
+
+func (e *Etcd) Unlock() error {
+	if e.lease == "" {
+		return nil
+	}
+	e.refresher.Stop()
+	// revoking the lease deletes the key
+	err := e.revoke(e.lease)
+	e.lease = ""
+	return err
+}
+
+func (e *Etcd) LockHolder() (*database.LockInfo, error) {
+	var result struct {
+		Kvs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := e.post("/v3/kv/range", map[string]interface{}{"key": e.key()}, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Kvs) == 0 {
+		return nil, nil
+	}
+	value, err := base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	holder, err := lock.DecodeHolder(string(value))
+	if err != nil {
+		return nil, err
+	}
+	return &holder.LockInfo, nil
+}
+
+func (e *Etcd) ForceUnlock() error {
+	if e.lease != "" {
+		return e.Unlock()
+	}
+	// the lease of the holder expires on its own
+	return e.post("/v3/kv/deleterange", map[string]interface{}{"key": e.key()}, nil)
+}
+
+// key returns the key of the lock as encoded by the JSON API
+func (e *Etcd) key() string {
+	return base64.StdEncoding.EncodeToString([]byte(e.config.Key))
+}
+
+func (e *Etcd) revoke(lease string) error {
+	return e.post("/v3/lease/revoke", map[string]interface{}{"ID": lease}, nil)
+}
+
+// post sends req as JSON to the endpoint at path and decodes the response into resp
+func (e *Etcd) post(path string, req interface{}, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := e.client.Post(e.config.Endpoint+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("etcd: %v", apiErr.Message)
+		}
+		return fmt.Errorf("etcd: %v %v", r.StatusCode, strconv.Quote(string(b)))
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(b, resp)
+}
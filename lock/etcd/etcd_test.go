@@ -0,0 +1,102 @@
+package etcd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	lt "github.com/golang-migrate/migrate/v4/lock/testing"
+)
+
+// fakeEtcd serves the lease, kv and txn API used by the lock
+type fakeEtcd struct {
+	mu     sync.Mutex
+	leases int
+	// keys maps keys to their lease and value
+	keys map[string]fakeKey
+}
+
+type fakeKey struct {
+	lease, value string
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var req struct {
+		ID      string
+		Key     string `json:"key"`
+		Compare []struct {
+			Key string `json:"key"`
+		} `json:"compare"`
+		Success []struct {
+			RequestPut struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+				Lease string `json:"lease"`
+			} `json:"request_put"`
+		} `json:"success"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.leases++
+		w.Write([]byte(`{"ID":"` + strconv.Itoa(f.leases) + `","TTL":"3"}`))
+	case "/v3/lease/keepalive":
+		w.Write([]byte(`{"result":{"ID":"` + req.ID + `","TTL":"3"}}`))
+	case "/v3/lease/revoke":
+		for k, lease := range f.keys {
+			if lease.lease == req.ID {
+				delete(f.keys, k)
+			}
+		}
+		w.Write([]byte(`{}`))
+	case "/v3/kv/range":
+		if k, ok := f.keys[req.Key]; ok {
+			w.Write([]byte(`{"kvs":[{"value":"` + k.value + `"}]}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	case "/v3/kv/deleterange":
+		delete(f.keys, req.Key)
+		w.Write([]byte(`{}`))
+	case "/v3/kv/txn":
+		if _, ok := f.keys[req.Compare[0].Key]; ok {
+			w.Write([]byte(`{}`))
+			return
+		}
+		put := req.Success[0].RequestPut
+		f.keys[put.Key] = fakeKey{lease: put.Lease, value: put.Value}
+		w.Write([]byte(`{"succeeded":true}`))
+	default:
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}
+}
+
+func Test(t *testing.T) {
+	s := httptest.NewServer(&fakeEtcd{keys: make(map[string]fakeKey)})
+	defer s.Close()
+
+	addr := "etcd://" + strings.TrimPrefix(s.URL, "http://") + "?key=test-lock&ttl=3s"
+	e := &Etcd{}
+	d1, err := e.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d1.Close()
+	d2, err := e.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+	lt.Test(t, d1, d2)
+}
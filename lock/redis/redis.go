@@ -0,0 +1,232 @@
+// Package redis locks with a Redis key, set with SET NX and an expiry.
+//
+// URL: redis://[[user]:password@]host:port[/db][?key=migrate-lock&ttl=30s],
+// rediss:// connects with TLS.
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/lock"
+)
+
+func init() {
+	r := Redis{}
+	lock.Register("redis", &r)
+	lock.Register("rediss", &r)
+}
+
+// DefaultKey is the key of the lock.
+var DefaultKey = "migrate-lock"
+
+// compare and delete, so that only the holder releases the lock
+const unlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// compare and expire, so that only the holder refreshes the lock
+const refreshScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+type Config struct {
+	Key string
+	TTL time.Duration
+}
+
+type Redis struct {
+	// mu serializes the commands of the connection
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	config *Config
+
+	// value of the lock held by this instance
+	value     string
+	refresher *lock.Refresher
+}
+
+func (r *Redis) Open(url string) (lock.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := lock.TTL(u)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Query().Get("key")
+	if key == "" {
+		key = DefaultKey
+	}
+
+	var conn net.Conn
+	if u.Scheme == "rediss" {
+		conn, err = tls.Dial("tcp", u.Host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = net.Dial("tcp", u.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rx, err := newRedis(conn, &Config{Key: key, TTL: ttl})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if password, ok := u.User.Password(); ok {
+		args := []string{"AUTH", password}
+		if user := u.User.Username(); user != "" {
+			// Redis 6 ACL user
+			args = []string{"AUTH", user, password}
+		}
+		if _, err := rx.do(args...); err != nil {
+			rx.Close()
+			return nil, err
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := rx.do("SELECT", db); err != nil {
+			rx.Close()
+			return nil, err
+		}
+	}
+	return rx, nil
+}
+
+// WithInstance returns a lock using an established connection to Redis.
+func WithInstance(conn net.Conn, config *Config) (lock.Driver, error) {
+	return newRedis(conn, config)
+}
+
+func newRedis(conn net.Conn, config *Config) (*Redis, error) {
+	if config == nil || config.Key == "" || config.TTL <= 0 {
+		return nil, errors.New("redis: config needs a key and ttl")
+	}
+	return &Redis{conn: conn, reader: bufio.NewReader(conn), config: config}, nil
+}
+
+func (r *Redis) Close() error {
+	return r.conn.Close()
+}
+
+func (r *Redis) Lock() error {
+	holder, err := lock.NewHolder()
+	if err != nil {
+		return err
+	}
+	value, err := holder.Encode()
+	if err != nil {
+		return err
+	}
+	reply, err := r.do("SET", r.config.Key, value, "NX", "PX", r.ttlMillis())
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return database.ErrLocked
+	}
+
+	r.value = value
+	r.refresher = lock.Refresh(r.config.TTL, func() error {
+		_, err := r.do("EVAL", refreshScript, "1", r.config.Key, value, r.ttlMillis())
+		return err
+	})
+	return nil
+}
+
+func (r *Redis) Unlock() error {
+	if r.value == "" {
+		return nil
+	}
+	r.refresher.Stop()
+	_, err := r.do("EVAL", unlockScript, "1", r.config.Key, r.value)
+	r.value = ""
+	return err
+}
+
+func (r *Redis) LockHolder() (*database.LockInfo, error) {
+	reply, err := r.do("GET", r.config.Key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected value %v of %v", reply, r.config.Key)
+	}
+	holder, err := lock.DecodeHolder(value)
+	if err != nil {
+		return nil, err
+	}
+	return &holder.LockInfo, nil
+}
+
+func (r *Redis) ForceUnlock() error {
+	if r.value != "" {
+		r.refresher.Stop()
+		r.value = ""
+	}
+	_, err := r.do("DEL", r.config.Key)
+	return err
+}
+
+func (r *Redis) ttlMillis() string {
+	return strconv.FormatInt(int64(r.config.TTL/time.Millisecond), 10)
+}
+
+// do sends a command and returns its reply, nil for a nil reply.
+// Only the reply types used by the lock are supported.
+func (r *Redis) do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := r.conn.Write([]byte(cmd.String())); err != nil {
+		return nil, err
+	}
+
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %v", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r.reader, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	default:
+		return nil, fmt.Errorf("redis: unsupported reply %q", line)
+	}
+}
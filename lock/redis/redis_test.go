@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	lt "github.com/golang-migrate/migrate/v4/lock/testing"
+)
+
+// fakeRedis serves the commands used by the lock
+type fakeRedis struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func (f *fakeRedis) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		fmt.Fprint(conn, f.exec(args))
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		if _, ok := f.keys[args[1]]; ok {
+			return "$-1\r\n"
+		}
+		f.keys[args[1]] = args[2]
+		return "+OK\r\n"
+	case "GET":
+		v, ok := f.keys[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "DEL":
+		delete(f.keys, args[1])
+		return ":1\r\n"
+	case "EVAL":
+		if f.keys[args[3]] != args[4] {
+			return ":0\r\n"
+		}
+		if args[1] == unlockScript {
+			delete(f.keys, args[3])
+		}
+		return ":1\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func Test(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go (&fakeRedis{keys: make(map[string]string)}).serve(l)
+
+	addr := fmt.Sprintf("redis://:secret@%v/1?key=test-lock&ttl=3s", l.Addr())
+	p := &Redis{}
+	d1, err := p.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d1.Close()
+	d2, err := p.Open(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+	lt.Test(t, d1, d2)
+}
+
+func TestOpenInvalidTTL(t *testing.T) {
+	p := &Redis{}
+	if _, err := p.Open("redis://localhost:6379?ttl=1ms"); err == nil {
+		t.Error("expected error for ttl shorter than a second")
+	}
+}
@@ -0,0 +1,95 @@
+// Package testing has the lock driver tests.
+// All lock drivers must pass the Test function.
+// This lives in it's own package so it stays a test dependency.
+package testing
+
+import (
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/lock"
+)
+
+// Test runs tests against lock implementations.
+// d1 and d2 must be two instances of the same lock.
+func Test(t *testing.T, d1, d2 lock.Driver) {
+	TestLockAndUnlock(t, d1, d2)
+	TestLockHolder(t, d1, d2)
+	TestForceUnlock(t, d1, d2)
+}
+
+func TestLockAndUnlock(t *testing.T, d1, d2 lock.Driver) {
+	if err := d1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	// a lock held by someone else
+	if err := d2.Lock(); err != database.ErrLocked {
+		t.Fatalf("Lock: expected ErrLocked, got %v", err)
+	}
+	// must not be released by someone else
+	if err := d2.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := d2.Lock(); err != database.ErrLocked {
+		t.Fatalf("Lock: expected ErrLocked after foreign Unlock, got %v", err)
+	}
+
+	if err := d1.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := d2.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := d2.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
+
+// TestLockHolder tests drivers implementing database.LockReporter
+func TestLockHolder(t *testing.T, d1, d2 lock.Driver) {
+	reporter, ok := d2.(database.LockReporter)
+	if !ok {
+		return
+	}
+	if holder, err := reporter.LockHolder(); err != nil || holder != nil {
+		t.Fatalf("LockHolder: expected no holder, got %v, %v", holder, err)
+	}
+
+	if err := d1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer d1.Unlock()
+	holder, err := reporter.LockHolder()
+	if err != nil {
+		t.Fatalf("LockHolder: %v", err)
+	}
+	expected := database.NewLockInfo()
+	if holder == nil || holder.PID != expected.PID || holder.Hostname != expected.Hostname {
+		t.Fatalf("LockHolder: expected %v, got %v", expected, holder)
+	}
+}
+
+// TestForceUnlock tests drivers implementing database.ForceUnlocker
+func TestForceUnlock(t *testing.T, d1, d2 lock.Driver) {
+	unlocker, ok := d2.(database.ForceUnlocker)
+	if !ok {
+		return
+	}
+	if err := d1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := unlocker.ForceUnlock(); err != nil {
+		t.Fatalf("ForceUnlock: %v", err)
+	}
+	if err := d2.Lock(); err != nil {
+		t.Fatalf("Lock after ForceUnlock: %v", err)
+	}
+	if err := d2.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	// the lock was released already
+	if err := d1.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
@@ -5,17 +5,29 @@
 package migrate
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	nurl "net/url"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqltemplate"
 	iurl "github.com/golang-migrate/migrate/v4/internal/url"
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/approval"
+	"github.com/golang-migrate/migrate/v4/source/filter"
+	"github.com/golang-migrate/migrate/v4/source/graph"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
 )
 
 // DefaultPrefetchMigrations sets the number of migrations to pre-read
@@ -25,15 +37,54 @@ import (
 // since each pre-read migration is buffered in memory. See DefaultBufferSize.
 var DefaultPrefetchMigrations = uint(10)
 
+// pragmaPeekSize is the number of bytes at the start of a migration
+// which are searched for pragmas evaluated by Migrate.
+const pragmaPeekSize = 4096
+
 // DefaultLockTimeout sets the max time a database driver has to acquire a lock.
 var DefaultLockTimeout = 15 * time.Second
 
+// DefaultReplicationLagInterval sets how often the replication lag is checked
+// while waiting for it to drop below MaxReplicationLag.
+var DefaultReplicationLagInterval = 1 * time.Second
+
 var (
 	ErrNoChange       = errors.New("no change")
 	ErrNilVersion     = errors.New("no migration")
 	ErrInvalidVersion = errors.New("version must be >= -1")
 	ErrLocked         = errors.New("database locked")
 	ErrLockTimeout    = errors.New("timeout: can't acquire database lock")
+	ErrLagUnsupported = errors.New("database driver can't check replication lag")
+	ErrTxUnsupported  = errors.New("database driver doesn't support transactions")
+
+	ErrLockStatusUnsupported  = errors.New("lock can't report its holder")
+	ErrForceUnlockUnsupported = errors.New("lock can't be released forcibly")
+
+	// ErrReadOnly is returned by every method which would write, if
+	// Migrate is read-only, see ReadOnly.
+	ErrReadOnly = errors.New("read-only: migrate doesn't write")
+
+	// ErrNoDatabaseURL is returned by Fresh if Migrate wasn't created
+	// from a database URL.
+	ErrNoDatabaseURL = errors.New("no database URL to reopen the database with")
+
+	// ErrStateTx is returned if AtomicBatch is set along with State.
+	ErrStateTx = errors.New("the version in State can't be set in the transaction of AtomicBatch")
+
+	// ErrExecDryRun is returned for a migration with the exec pragma in a
+	// DryRun.
+	ErrExecDryRun = errors.New("migrations running commands can't be rolled back by a dry run")
+
+	// ErrExecAtomicBatch is returned for a migration with the exec pragma
+	// with AtomicBatch.
+	ErrExecAtomicBatch = errors.New("migrations running commands can't be rolled back by an atomic batch")
+
+	// ErrNoAuditTable is returned by AuditEvent if AuditTable isn't set.
+	ErrNoAuditTable = errors.New("no audit table to record the event in")
+
+	// ErrAboveTargetMax is returned by Migrate for a version above
+	// TargetMax.
+	ErrAboveTargetMax = errors.New("version is above the maximum target version")
 )
 
 // ErrShortLimit is an error returned when not enough migrations
@@ -61,6 +112,9 @@ type Migrate struct {
 	databaseName string
 	databaseDrv  database.Driver
 
+	// sourceID identifies the source in audit records
+	sourceID string
+
 	// Log accepts a Logger interface
 	Log Logger
 
@@ -73,13 +127,214 @@ type Migrate struct {
 	isGracefulStop bool
 	isLocked       bool
 
+	// strategyLocker is the Locker of strategy, see locker
+	strategyLocker database.Locker
+	strategy       string
+
 	// PrefetchMigrations defaults to DefaultPrefetchMigrations,
 	// but can be set per Migrate instance.
 	PrefetchMigrations uint
 
+	// PrefetchWorkers defaults to DefaultPrefetchWorkers,
+	// but can be set per Migrate instance.
+	PrefetchWorkers uint
+
 	// LockTimeout defaults to DefaultLockTimeout,
 	// but can be set per Migrate instance.
 	LockTimeout time.Duration
+
+	// LockStrategy is one of the database.Lock constants, defaults to
+	// database.LockAdvisory, the locking of the database driver.
+	// database.LockTable locks databases whose driver doesn't lock.
+	LockStrategy string
+
+	// Locker, if set, is used instead of LockStrategy,
+	// e.g. an external lock provider of package lock.
+	Locker database.Locker
+
+	// SleepBetween pauses between two applied migrations.
+	// Defaults to 0, meaning no pause.
+	SleepBetween time.Duration
+
+	// ReplicationLagQuery is an optional query returning the current
+	// replication lag in seconds. If set, migrate waits between two applied
+	// migrations until the lag dropped to MaxReplicationLag or below.
+	// The database driver must implement database.LagChecker.
+	ReplicationLagQuery string
+
+	// MaxReplicationLag is the highest replication lag tolerated
+	// before the next migration is applied. See ReplicationLagQuery.
+	MaxReplicationLag time.Duration
+
+	// ReplicationLagInterval defaults to DefaultReplicationLagInterval,
+	// but can be set per Migrate instance.
+	ReplicationLagInterval time.Duration
+
+	// AtomicBatch wraps all migrations of one run in a single transaction,
+	// which is only committed if every migration succeeded.
+	// The database driver must implement database.Transactional. Migrations
+	// running commands with the exec pragma fail with ErrExecAtomicBatch,
+	// as the commands aren't part of the transaction.
+	AtomicBatch bool
+
+	// BeforeCommit, if set, is called with AtomicBatch once every migration
+	// succeeded, before the transaction is committed. If it fails, the
+	// transaction is rolled back and the run fails with its error, e.g. to
+	// apply to several databases in two phases: prepare all, then commit
+	// all or none.
+	BeforeCommit func() error
+
+	// DryRun runs Migrate, Steps, Up and Down like AtomicBatch in a single
+	// transaction, but rolls it back even if every migration succeeded, to
+	// validate migrations, e.g. against a replica of production, without
+	// changing the database. Errors are returned and timings are logged as
+	// usual. Migrations running commands with the exec pragma fail with
+	// ErrExecDryRun, as the commands aren't part of the transaction.
+	DryRun bool
+
+	// ContinueOnError goes on with the next migration if one fails, e.g.
+	// for idempotent data migrations which may fail on a flaky statement.
+	// The failed migration is logged, recorded as failed in HistoryTable,
+	// which is required, so ApplySkipped retries it, and its version set
+	// clean. Once the others are applied, *ErrMigrationsFailed lists the
+	// failures. It can't be combined with AtomicBatch and DryRun.
+	ContinueOnError bool
+
+	// Encoding of the migration files, one of the Encoding constants.
+	// Migrations are transcoded to UTF-8 and byte order marks are stripped
+	// before they are run. Defaults to EncodingAuto, which detects UTF-16
+	// and UTF-8 with byte order mark. New and NewWithDatabaseInstance take
+	// it from the `x-encoding` query of the source URL.
+	Encoding string
+
+	// Decrypter decrypts encrypted migrations. Reading an encrypted
+	// migration fails with ErrNoDecrypter if it isn't set.
+	Decrypter Decrypter
+
+	// Manifest, if set, must cover every migration which is read with a
+	// matching checksum. Otherwise the migration fails with
+	// manifest.ErrUnverified before it is run. Verify the signature of the
+	// manifest before setting it.
+	Manifest *manifest.Manifest
+
+	// Approvals, if set, must hold a signed approval of every up migration
+	// which is read, matching its checksum. Otherwise the migration fails
+	// with approval.ErrUnapproved before it is run, which aborts the run.
+	Approvals *approval.Dir
+
+	// Variables are evaluated by the `if` pragma of migrations, e.g.
+	// `-- migrate:if env == "staging"`. Migrations whose condition isn't met
+	// are skipped, but their version is applied. The `dialect` variable
+	// defaults to the dialect of the database driver, see source.DialectOf.
+	// Variables are also the data of migrations with the `template` pragma.
+	Variables map[string]string
+
+	// TargetMax, if set, is the highest version Up and Steps apply, e.g. the
+	// last migration of the release being deployed, so that migrations of
+	// the next release in the same source aren't applied by accident. Up
+	// stops before the first migration above it, Migrate fails with
+	// ErrAboveTargetMax for a version above it.
+	TargetMax uint
+
+	// SelectTags, if set, selects migrations by the tags of their tags
+	// pragma, e.g. `!slow` skips migrations with `-- migrate:tags slow`,
+	// see pragma.SelectTags. Skipped migrations apply their version like
+	// migrations whose condition isn't met, but are recorded in
+	// HistoryTable, so that ApplySkipped can apply them later.
+	SelectTags string
+
+	// StrictOrder refuses to run Migrate, Steps, Up and Down, with ErrGap, if
+	// versions are missing in a sequentially numbered source, or, with
+	// ErrOutOfOrder, if a migration below the current version wasn't
+	// applied according to HistoryTable.
+	StrictOrder bool
+
+	// RequireDown refuses to run Migrate, Steps and Up, with ErrNoDown, if
+	// a migration they would apply has no down migration or an empty one,
+	// for rollbacks which rely on every migration being reversible.
+	RequireDown bool
+
+	// StrictEmpty refuses to apply, with ErrEmptyMigration, a migration
+	// which is empty or consists of comments only. Otherwise such migrations
+	// are recorded as applied without running them, which is logged.
+	StrictEmpty bool
+
+	// AuditTable, if set, is the table a row is written to for every run of
+	// Migrate, Steps, Up, Down, Drop and Force, see database.AuditTable.
+	// Runs fail if the row can't be written.
+	AuditTable string
+
+	// AuditClient identifies the program running migrations in AuditTable,
+	// e.g. its name and version.
+	AuditClient string
+
+	// FingerprintTable, if set, is the table the fingerprint of the schema is
+	// stored in after every successful run of Migrate, Steps, Up and Down,
+	// see Drift. The database driver must implement database.Introspector.
+	FingerprintTable string
+
+	// TagTable is the table tags are recorded in, see Tag. Defaults to
+	// database.DefaultTagTable.
+	TagTable string
+
+	// HistoryTable, if set, is the table a row is written to for every
+	// applied migration, with its checksum and duration, see History and
+	// database.HistoryTable. Runs fail if the row can't be written.
+	HistoryTable string
+
+	// AllowExec allows migrations with the `exec` pragma, which run
+	// commands, e.g. shell scripts. See MIGRATIONS.md.
+	AllowExec bool
+
+	// Wasm runs migrations compiled to WebAssembly, see package wasm.
+	// Running them fails with ErrNoWasmRuntime if it isn't set.
+	Wasm WasmRuntime
+
+	// Scripts runs migrations with the `starlark` pragma, see package script.
+	// Running them fails with ErrNoScriptRuntime if it isn't set.
+	Scripts ScriptRuntime
+
+	// DatabaseURL is passed to the commands of exec migrations, see
+	// EnvDatabaseURL. New and NewWithSourceInstance set it.
+	DatabaseURL string
+
+	// Plan, if set, makes Migrate, Steps, Up, Down, ApplySkipped and
+	// LoadFixtures write the SQL they would run to Plan instead of running
+	// it, e.g. for a review by a DBA.
+	// Templates are rendered and the statements are split, every migration
+	// is headed by a comment. Migrations which don't run SQL, e.g. exec
+	// migrations, are described by a comment ending in "not SQL" instead.
+	// Neither the database nor the version is changed, and the database
+	// isn't locked.
+	Plan io.Writer
+	// planSQLOnly makes writing Plan fail for migrations which aren't SQL,
+	// see WriteChangeScript.
+	planSQLOnly bool
+
+	// OnStart, if set, is called before each migration runs, e.g. to show
+	// the progress of long migrations.
+	OnStart func(migr *Migration)
+
+	// OnApplied, if set, is called after each applied migration.
+	// With AtomicBatch, the migration isn't committed yet.
+	OnApplied func(migr *Migration)
+
+	// ReadOnly makes every method which would write, e.g. Up, Force or
+	// ForceUnlock, fail with ErrReadOnly before it locks. Version, Pending
+	// and LockStatus still work. Migrate is also read-only if the database
+	// driver or State was opened read-only, see database.ReadOnlyDriver.
+	ReadOnly bool
+
+	// State, if set, keeps the version instead of the database driver, e.g.
+	// in a small transactional database when the migrated database is
+	// append-only or analytical, like ClickHouse, or in an external store of
+	// package state. If State is a database.Driver, it also keeps the lock
+	// and the audit, tag and fingerprint tables. Migrations still run
+	// against the database driver. Close doesn't close State.
+	State database.StateStore
+
+	// lastRun summarizes the last run, see LastRun
+	lastRun *RunSummary
 }
 
 // New returns a new Migrate instance from a source URL and a database URL.
@@ -92,14 +347,20 @@ func New(sourceURL, databaseURL string) (*Migrate, error) {
 		return nil, err
 	}
 	m.sourceName = sourceName
+	m.sourceID = iurl.Redact(sourceURL)
+
+	if m.Encoding, err = encodingFromURL(sourceURL); err != nil {
+		return nil, err
+	}
 
 	databaseName, err := iurl.SchemeFromURL(databaseURL)
 	if err != nil {
 		return nil, err
 	}
 	m.databaseName = databaseName
+	m.DatabaseURL = databaseURL
 
-	sourceDrv, err := source.Open(sourceURL)
+	sourceDrv, err := openSource(sourceURL, databaseName)
 	if err != nil {
 		return nil, err
 	}
@@ -126,10 +387,15 @@ func NewWithDatabaseInstance(sourceURL string, databaseName string, databaseInst
 		return nil, err
 	}
 	m.sourceName = sourceName
+	m.sourceID = iurl.Redact(sourceURL)
+
+	if m.Encoding, err = encodingFromURL(sourceURL); err != nil {
+		return nil, err
+	}
 
 	m.databaseName = databaseName
 
-	sourceDrv, err := source.Open(sourceURL)
+	sourceDrv, err := openSource(sourceURL, databaseName)
 	if err != nil {
 		return nil, err
 	}
@@ -152,8 +418,10 @@ func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, data
 		return nil, err
 	}
 	m.databaseName = databaseName
+	m.DatabaseURL = databaseURL
 
 	m.sourceName = sourceName
+	m.sourceID = sourceName
 
 	databaseDrv, err := database.Open(databaseURL)
 	if err != nil {
@@ -162,6 +430,7 @@ func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, data
 	m.databaseDrv = databaseDrv
 
 	m.sourceDrv = sourceInstance
+	selectDialect(sourceInstance, databaseName)
 
 	return m, nil
 }
@@ -174,20 +443,71 @@ func NewWithInstance(sourceName string, sourceInstance source.Driver, databaseNa
 	m := newCommon()
 
 	m.sourceName = sourceName
+	m.sourceID = sourceName
 	m.databaseName = databaseName
 
 	m.sourceDrv = sourceInstance
 	m.databaseDrv = databaseInstance
+	selectDialect(sourceInstance, databaseName)
 
 	return m, nil
 }
 
+// openSource opens the source driver of url and selects the migrations
+// written for databaseName. With the `x-dependency-order` query set to true,
+// migrations are ordered by their depends-on pragmas, see package source/graph.
+// The `x-include` and `x-exclude` queries, which may be repeated, select
+// migrations by glob patterns of their names, see package source/filter.
+func openSource(url string, databaseName string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	dependencyOrder := false
+	if s := u.Query().Get("x-dependency-order"); s != "" {
+		if dependencyOrder, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("x-dependency-order: %v", err)
+		}
+	}
+
+	sourceDrv, err := source.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	selectDialect(sourceDrv, databaseName)
+	if include, exclude := u.Query()["x-include"], u.Query()["x-exclude"]; len(include) > 0 || len(exclude) > 0 {
+		f, err := filter.New(sourceDrv, include, exclude)
+		if err != nil {
+			return nil, multierror.Append(err, sourceDrv.Close())
+		}
+		sourceDrv = f
+	}
+	if !dependencyOrder {
+		return sourceDrv, nil
+	}
+	g, err := graph.New(sourceDrv)
+	if err != nil {
+		return nil, multierror.Append(err, sourceDrv.Close())
+	}
+	return g, nil
+}
+
+// selectDialect makes the source prefer the migrations written for
+// the database driver, if it supports source.DialectSelector.
+func selectDialect(sourceDrv source.Driver, databaseName string) {
+	if d, ok := sourceDrv.(source.DialectSelector); ok {
+		d.SelectDialect(source.DialectOf(databaseName))
+	}
+}
+
 func newCommon() *Migrate {
 	return &Migrate{
-		GracefulStop:       make(chan bool, 1),
-		PrefetchMigrations: DefaultPrefetchMigrations,
-		LockTimeout:        DefaultLockTimeout,
-		isLockedMu:         &sync.Mutex{},
+		GracefulStop:           make(chan bool, 1),
+		PrefetchMigrations:     DefaultPrefetchMigrations,
+		PrefetchWorkers:        DefaultPrefetchWorkers,
+		LockTimeout:            DefaultLockTimeout,
+		ReplicationLagInterval: DefaultReplicationLagInterval,
+		isLockedMu:             &sync.Mutex{},
 	}
 }
 
@@ -211,111 +531,226 @@ func (m *Migrate) Close() (source error, database error) {
 
 // Migrate looks at the currently active migration version,
 // then migrates either up or down to the specified version.
-func (m *Migrate) Migrate(version uint) error {
-	if err := m.lock(); err != nil {
+func (m *Migrate) Migrate(version uint) (err error) {
+	// a plan changes nothing
+	if m.Plan == nil {
+		defer m.audit("goto", strconv.FormatUint(uint64(version), 10), time.Now(), &err)
+		defer m.fingerprint(&err)
+	}
+
+	if err := m.lockRun(); err != nil {
 		return err
 	}
 
-	curVersion, dirty, err := m.databaseDrv.Version()
+	curVersion, dirty, err := m.state().Version()
 	if err != nil {
-		return m.unlockErr(err)
+		return m.unlockRunErr(err)
 	}
 
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockRunErr(ErrDirty{curVersion})
+	}
+
+	if m.aboveTargetMax(version) && int(version) > curVersion {
+		return m.unlockRunErr(ErrAboveTargetMax)
+	}
+
+	if err := m.checkOrder(curVersion); err != nil {
+		return m.unlockRunErr(err)
+	}
+
+	if int(version) > curVersion {
+		if err := m.listFrom(curVersion); err != nil {
+			return m.unlockRunErr(err)
+		}
+		if err := m.checkDowns(curVersion, func(v uint, _ int) bool { return v == version }); err != nil {
+			return m.unlockRunErr(err)
+		}
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
-	go m.read(curVersion, int(version), ret)
+	done := make(chan struct{})
+	go m.read(curVersion, int(version), ret, done)
 
-	return m.unlockErr(m.runMigrations(ret))
+	err = m.runMigrations(ret)
+	stopReading(ret, done)
+	return m.unlockRunErr(err)
 }
 
 // Steps looks at the currently active migration version.
 // It will migrate up if n > 0, and down if n < 0.
-func (m *Migrate) Steps(n int) error {
+func (m *Migrate) Steps(n int) (err error) {
+	// a plan changes nothing
+	if m.Plan == nil {
+		defer m.audit("steps", strconv.Itoa(n), time.Now(), &err)
+		defer m.fingerprint(&err)
+	}
+
 	if n == 0 {
 		return ErrNoChange
 	}
 
-	if err := m.lock(); err != nil {
+	if err := m.lockRun(); err != nil {
 		return err
 	}
 
-	curVersion, dirty, err := m.databaseDrv.Version()
+	curVersion, dirty, err := m.state().Version()
 	if err != nil {
-		return m.unlockErr(err)
+		return m.unlockRunErr(err)
 	}
 
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockRunErr(ErrDirty{curVersion})
+	}
+
+	if err := m.checkOrder(curVersion); err != nil {
+		return m.unlockRunErr(err)
+	}
+
+	if n > 0 {
+		if err := m.listFrom(curVersion); err != nil {
+			return m.unlockRunErr(err)
+		}
+		if err := m.checkDowns(curVersion, func(_ uint, i int) bool { return i == n-1 }); err != nil {
+			return m.unlockRunErr(err)
+		}
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
+	done := make(chan struct{})
 
 	if n > 0 {
-		go m.readUp(curVersion, n, ret)
+		go m.readUp(curVersion, n, ret, done)
 	} else {
-		go m.readDown(curVersion, -n, ret)
+		go m.readDown(curVersion, -n, ret, done)
 	}
 
-	return m.unlockErr(m.runMigrations(ret))
+	err = m.runMigrations(ret)
+	stopReading(ret, done)
+	return m.unlockRunErr(err)
 }
 
 // Up looks at the currently active migration version
 // and will migrate all the way up (applying all up migrations).
-func (m *Migrate) Up() error {
-	if err := m.lock(); err != nil {
+func (m *Migrate) Up() (err error) {
+	// a plan changes nothing
+	if m.Plan == nil {
+		defer m.audit("up", "", time.Now(), &err)
+		defer m.fingerprint(&err)
+	}
+
+	if err := m.lockRun(); err != nil {
 		return err
 	}
 
-	curVersion, dirty, err := m.databaseDrv.Version()
+	curVersion, dirty, err := m.state().Version()
 	if err != nil {
-		return m.unlockErr(err)
+		return m.unlockRunErr(err)
 	}
 
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockRunErr(ErrDirty{curVersion})
+	}
+
+	if err := m.checkOrder(curVersion); err != nil {
+		return m.unlockRunErr(err)
+	}
+
+	if err := m.listFrom(curVersion); err != nil {
+		return m.unlockRunErr(err)
+	}
+	if err := m.checkDowns(curVersion, nil); err != nil {
+		return m.unlockRunErr(err)
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
+	done := make(chan struct{})
 
-	go m.readUp(curVersion, -1, ret)
-	return m.unlockErr(m.runMigrations(ret))
+	go m.readUp(curVersion, -1, ret, done)
+	err = m.runMigrations(ret)
+	stopReading(ret, done)
+	return m.unlockRunErr(err)
 }
 
 // Down looks at the currently active migration version
 // and will migrate all the way down (applying all down migrations).
-func (m *Migrate) Down() error {
-	if err := m.lock(); err != nil {
+func (m *Migrate) Down() (err error) {
+	// a plan changes nothing
+	if m.Plan == nil {
+		defer m.audit("down", "", time.Now(), &err)
+		defer m.fingerprint(&err)
+	}
+
+	if err := m.lockRun(); err != nil {
 		return err
 	}
 
-	curVersion, dirty, err := m.databaseDrv.Version()
+	curVersion, dirty, err := m.state().Version()
 	if err != nil {
-		return m.unlockErr(err)
+		return m.unlockRunErr(err)
 	}
 
 	if dirty {
-		return m.unlockErr(ErrDirty{curVersion})
+		return m.unlockRunErr(ErrDirty{curVersion})
+	}
+
+	if err := m.checkOrder(curVersion); err != nil {
+		return m.unlockRunErr(err)
 	}
 
 	ret := make(chan interface{}, m.PrefetchMigrations)
-	go m.readDown(curVersion, -1, ret)
-	return m.unlockErr(m.runMigrations(ret))
+	done := make(chan struct{})
+	go m.readDown(curVersion, -1, ret, done)
+	err = m.runMigrations(ret)
+	stopReading(ret, done)
+	return m.unlockRunErr(err)
 }
 
 // Drop deletes everything in the database.
-func (m *Migrate) Drop() error {
+func (m *Migrate) Drop() (err error) {
+	defer m.audit("drop", "", time.Now(), &err)
+
 	if err := m.lock(); err != nil {
 		return err
 	}
 	if err := m.databaseDrv.Drop(); err != nil {
 		return m.unlockErr(err)
 	}
+	if m.State != nil {
+		if err := m.State.SetVersion(database.NilVersion, false); err != nil {
+			return m.unlockErr(err)
+		}
+	}
 	return m.unlock()
 }
 
+// Fresh drops everything in the database and applies all up migrations,
+// i.e. Drop followed by Up. As drivers drop their version table too, the
+// database driver is opened again from DatabaseURL in between, so Migrate
+// must be created by New or NewWithSourceInstance.
+func (m *Migrate) Fresh() error {
+	if m.DatabaseURL == "" {
+		return ErrNoDatabaseURL
+	}
+	if err := m.Drop(); err != nil {
+		return err
+	}
+
+	m.logVerbosePrintf("Reopening database\n")
+	if err := m.databaseDrv.Close(); err != nil {
+		return err
+	}
+	databaseDrv, err := database.Open(m.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	m.databaseDrv = databaseDrv
+	// the Locker of LockStrategy may be the closed driver
+	m.strategyLocker = nil
+
+	return m.Up()
+}
+
 // Run runs any migration provided by you against the database.
 // It does not check any currently active version in database.
 // Usually you don't need this function at all. Use Migrate,
@@ -325,11 +760,20 @@ func (m *Migrate) Run(migration ...*Migration) error {
 		return ErrNoChange
 	}
 
+	m.startRun()
+	defer m.finishRun()
+	if err := m.checkContinue(); err != nil {
+		return err
+	}
+	if _, err := m.lagChecker(); err != nil {
+		return err
+	}
 	if err := m.lock(); err != nil {
 		return err
 	}
+	m.lockAcquired()
 
-	curVersion, dirty, err := m.databaseDrv.Version()
+	curVersion, dirty, err := m.state().Version()
 	if err != nil {
 		return m.unlockErr(err)
 	}
@@ -364,7 +808,9 @@ func (m *Migrate) Run(migration ...*Migration) error {
 // Force sets a migration version.
 // It does not check any currently active version in database.
 // It resets the dirty state to false.
-func (m *Migrate) Force(version int) error {
+func (m *Migrate) Force(version int) (err error) {
+	defer m.audit("force", strconv.Itoa(version), time.Now(), &err)
+
 	if version < -1 {
 		return ErrInvalidVersion
 	}
@@ -373,7 +819,7 @@ func (m *Migrate) Force(version int) error {
 		return err
 	}
 
-	if err := m.databaseDrv.SetVersion(version, false); err != nil {
+	if err := m.state().SetVersion(version, false); err != nil {
 		return m.unlockErr(err)
 	}
 
@@ -383,7 +829,7 @@ func (m *Migrate) Force(version int) error {
 // Version returns the currently active migration version.
 // If no migration has been applied, yet, it will return ErrNilVersion.
 func (m *Migrate) Version() (version uint, dirty bool, err error) {
-	v, d, err := m.databaseDrv.Version()
+	v, d, err := m.state().Version()
 	if err != nil {
 		return 0, false, err
 	}
@@ -395,17 +841,74 @@ func (m *Migrate) Version() (version uint, dirty bool, err error) {
 	return suint(v), d, nil
 }
 
+// aboveTargetMax returns true if version is above TargetMax, if it is set.
+func (m *Migrate) aboveTargetMax(version uint) bool {
+	return m.TargetMax > 0 && version > m.TargetMax
+}
+
+// listFrom lets the source list only the migrations from curVersion on,
+// if it supports source.RangeLister, as running up reads none before.
+func (m *Migrate) listFrom(curVersion int) error {
+	if l, ok := m.sourceDrv.(source.RangeLister); ok && curVersion != database.NilVersion {
+		return l.ListFrom(suint(curVersion))
+	}
+	return nil
+}
+
+// ResolveVersion returns the version s, either a number or an alias of the
+// source, see source.AliasFile.
+func (m *Migrate) ResolveVersion(s string) (uint, error) {
+	return source.ResolveVersion(m.sourceDrv, s)
+}
+
+// Pending returns the versions Up would apply, in order.
+func (m *Migrate) Pending() ([]uint, error) {
+	curVersion, _, err := m.state().Version()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.listFrom(curVersion); err != nil {
+		return nil, err
+	}
+	return m.pendingFrom(curVersion)
+}
+
+// pendingFrom returns the versions Up would apply from curVersion on.
+func (m *Migrate) pendingFrom(curVersion int) ([]uint, error) {
+	var next uint
+	var err error
+	if curVersion == database.NilVersion {
+		next, err = m.sourceDrv.First()
+	} else {
+		if err := m.versionExists(suint(curVersion)); err != nil {
+			return nil, err
+		}
+		next, err = m.sourceDrv.Next(suint(curVersion))
+	}
+
+	pending := make([]uint, 0)
+	for err == nil && !m.aboveTargetMax(next) {
+		pending = append(pending, next)
+		next, err = m.sourceDrv.Next(next)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return pending, nil
+}
+
 // read reads either up or down migrations from source `from` to `to`.
 // Each migration is then written to the ret channel.
 // If an error occurs during reading, that error is written to the ret channel, too.
 // Once read is done reading it will close the ret channel.
-func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
-	defer close(ret)
+func (m *Migrate) read(from int, to int, ret chan<- interface{}, done <-chan struct{}) {
+	p := m.prefetch(ret, done)
+	defer p.close()
 
 	// check if from version exists
 	if from >= 0 {
 		if err := m.versionExists(suint(from)); err != nil {
-			ret <- err
+			p.send(err)
 			return
 		}
 	}
@@ -413,75 +916,59 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 	// check if to version exists
 	if to >= 0 {
 		if err := m.versionExists(suint(to)); err != nil {
-			ret <- err
+			p.send(err)
 			return
 		}
 	}
 
 	// no change?
 	if from == to {
-		ret <- ErrNoChange
+		p.send(ErrNoChange)
 		return
 	}
 
-	if from < to {
+	// compare positions, the source may not be ordered by version
+	toPos := m.position(to)
+	if m.position(from) < toPos {
 		// it's going up
 		// apply first migration if from is nil version
 		if from == -1 {
 			firstVersion, err := m.sourceDrv.First()
 			if err != nil {
-				ret <- err
+				p.send(err)
 				return
 			}
 
-			migr, err := m.newMigration(firstVersion, int(firstVersion))
-			if err != nil {
-				ret <- err
+			if !p.add(firstVersion, int(firstVersion)) {
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
-
 			from = int(firstVersion)
 		}
 
 		// run until we reach target ...
-		for from < to {
+		for m.position(from) < toPos {
 			if m.stop() {
 				return
 			}
 
 			next, err := m.sourceDrv.Next(suint(from))
 			if err != nil {
-				ret <- err
+				p.send(err)
 				return
 			}
 
-			migr, err := m.newMigration(next, int(next))
-			if err != nil {
-				ret <- err
+			if !p.add(next, int(next)) {
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
-
 			from = int(next)
 		}
 
 	} else {
 		// it's going down
 		// run until we reach target ...
-		for from > to && from >= 0 {
+		for from >= 0 && m.position(from) > toPos {
 			if m.stop() {
 				return
 			}
@@ -489,61 +976,59 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 			prev, err := m.sourceDrv.Prev(suint(from))
 			if os.IsNotExist(err) && to == -1 {
 				// apply nil migration
-				migr, err := m.newMigration(suint(from), -1)
-				if err != nil {
-					ret <- err
+				if !p.add(suint(from), -1) {
 					return
 				}
-				ret <- migr
-				go func() {
-					if err := migr.Buffer(); err != nil {
-						m.logErr(err)
-					}
-				}()
 
 				return
 
 			} else if err != nil {
-				ret <- err
+				p.send(err)
 				return
 			}
 
-			migr, err := m.newMigration(suint(from), int(prev))
-			if err != nil {
-				ret <- err
+			if !p.add(suint(from), int(prev)) {
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
-
 			from = int(prev)
 		}
 	}
 }
 
+// position returns the position of version in the order of migrations,
+// which is the version itself unless the source implements source.Orderer.
+func (m *Migrate) position(version int) int {
+	if version < 0 {
+		return version
+	}
+	if o, ok := m.sourceDrv.(source.Orderer); ok {
+		if i, err := o.Index(suint(version)); err == nil {
+			return i
+		}
+	}
+	return version
+}
+
 // readUp reads up migrations from `from` limitted by `limit`.
 // limit can be -1, implying no limit and reading until there are no more migrations.
 // Each migration is then written to the ret channel.
 // If an error occurs during reading, that error is written to the ret channel, too.
 // Once readUp is done reading it will close the ret channel.
-func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
-	defer close(ret)
+func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}, done <-chan struct{}) {
+	p := m.prefetch(ret, done)
+	defer p.close()
 
 	// check if from version exists
 	if from >= 0 {
 		if err := m.versionExists(suint(from)); err != nil {
-			ret <- err
+			p.send(err)
 			return
 		}
 	}
 
 	if limit == 0 {
-		ret <- ErrNoChange
+		p.send(ErrNoChange)
 		return
 	}
 
@@ -557,22 +1042,22 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 		if from == -1 {
 			firstVersion, err := m.sourceDrv.First()
 			if err != nil {
-				ret <- err
+				p.send(err)
 				return
 			}
 
-			migr, err := m.newMigration(firstVersion, int(firstVersion))
-			if err != nil {
-				ret <- err
+			if m.aboveTargetMax(firstVersion) {
+				if limit == -1 {
+					p.send(ErrNoChange)
+				} else {
+					p.send(os.ErrNotExist)
+				}
 				return
 			}
 
-			ret <- migr
-			go func() {
-				if err := migr.Buffer(); err != nil {
-					m.logErr(err)
-				}
-			}()
+			if !p.add(firstVersion, int(firstVersion)) {
+				return
+			}
 			from = int(firstVersion)
 			count++
 			continue
@@ -580,10 +1065,14 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 
 		// apply next migration
 		next, err := m.sourceDrv.Next(suint(from))
+		if err == nil && m.aboveTargetMax(next) {
+			// the migrations from here on are for later
+			err = os.ErrNotExist
+		}
 		if os.IsNotExist(err) {
 			// no limit, but no migrations applied?
 			if limit == -1 && count == 0 {
-				ret <- ErrNoChange
+				p.send(ErrNoChange)
 				return
 			}
 
@@ -594,33 +1083,24 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 
 			// reached end, and didn't apply any migrations
 			if limit > 0 && count == 0 {
-				ret <- os.ErrNotExist
+				p.send(os.ErrNotExist)
 				return
 			}
 
 			// applied less migrations than limit?
 			if count < limit {
-				ret <- ErrShortLimit{suint(limit - count)}
+				p.send(ErrShortLimit{suint(limit - count)})
 				return
 			}
 		}
 		if err != nil {
-			ret <- err
+			p.send(err)
 			return
 		}
 
-		migr, err := m.newMigration(next, int(next))
-		if err != nil {
-			ret <- err
+		if !p.add(next, int(next)) {
 			return
 		}
-
-		ret <- migr
-		go func() {
-			if err := migr.Buffer(); err != nil {
-				m.logErr(err)
-			}
-		}()
 		from = int(next)
 		count++
 	}
@@ -631,31 +1111,32 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 // Each migration is then written to the ret channel.
 // If an error occurs during reading, that error is written to the ret channel, too.
 // Once readDown is done reading it will close the ret channel.
-func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
-	defer close(ret)
+func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}, done <-chan struct{}) {
+	p := m.prefetch(ret, done)
+	defer p.close()
 
 	// check if from version exists
 	if from >= 0 {
 		if err := m.versionExists(suint(from)); err != nil {
-			ret <- err
+			p.send(err)
 			return
 		}
 	}
 
 	if limit == 0 {
-		ret <- ErrNoChange
+		p.send(ErrNoChange)
 		return
 	}
 
 	// no change if already at nil version
 	if from == -1 && limit == -1 {
-		ret <- ErrNoChange
+		p.send(ErrNoChange)
 		return
 	}
 
 	// can't go over limit if already at nil version
 	if from == -1 && limit > 0 {
-		ret <- os.ErrNotExist
+		p.send(os.ErrNotExist)
 		return
 	}
 
@@ -671,62 +1152,127 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 			if limit == -1 || limit-count > 0 {
 				firstVersion, err := m.sourceDrv.First()
 				if err != nil {
-					ret <- err
+					p.send(err)
 					return
 				}
 
-				migr, err := m.newMigration(firstVersion, -1)
-				if err != nil {
-					ret <- err
+				if !p.add(firstVersion, -1) {
 					return
 				}
-				ret <- migr
-				go func() {
-					if err := migr.Buffer(); err != nil {
-						m.logErr(err)
-					}
-				}()
 				count++
 			}
 
 			if count < limit {
-				ret <- ErrShortLimit{suint(limit - count)}
+				p.send(ErrShortLimit{suint(limit - count)})
 			}
 			return
 		}
 		if err != nil {
-			ret <- err
+			p.send(err)
 			return
 		}
 
-		migr, err := m.newMigration(suint(from), int(prev))
-		if err != nil {
-			ret <- err
+		if !p.add(suint(from), int(prev)) {
 			return
 		}
-
-		ret <- migr
-		go func() {
-			if err := migr.Buffer(); err != nil {
-				m.logErr(err)
-			}
-		}()
 		from = int(prev)
 		count++
 	}
 }
 
-// runMigrations reads *Migration and error from a channel. Any other type
+// runMigrations runs the migrations received on ret, see applyMigrations.
+// If AtomicBatch is set, all of them are applied within a single transaction,
+// which DryRun rolls back.
+// If Plan is set, they are written to Plan instead, see writePlan.
+func (m *Migrate) runMigrations(ret <-chan interface{}) error {
+	if m.Plan != nil {
+		return m.writePlan(ret)
+	}
+	if !m.AtomicBatch && !m.DryRun {
+		if err := m.createHistoryTable(); err != nil {
+			return err
+		}
+		return m.applyMigrations(ret)
+	}
+	if m.ContinueOnError {
+		return ErrContinueTx
+	}
+
+	if m.State != nil {
+		return ErrStateTx
+	}
+	tx, ok := m.databaseDrv.(database.Transactional)
+	if !ok {
+		return ErrTxUnsupported
+	}
+
+	// created outside the transaction, where creating an existing table
+	// would abort it, except by a dry run, which leaves no table behind
+	if !m.DryRun {
+		if err := m.createHistoryTable(); err != nil {
+			return err
+		}
+	}
+	m.logVerbosePrintf("Begin transaction\n")
+	started := time.Now()
+	if err := tx.Begin(); err != nil {
+		return err
+	}
+	if m.DryRun {
+		if err := m.createHistoryTable(); err != nil {
+			if errRollback := tx.Rollback(); errRollback != nil {
+				return multierror.Append(err, errRollback)
+			}
+			return err
+		}
+	}
+
+	if err := m.applyMigrations(ret); err != nil {
+		m.logVerbosePrintf("Rollback transaction\n")
+		if errRollback := tx.Rollback(); errRollback != nil {
+			return multierror.Append(err, errRollback)
+		}
+		return err
+	}
+
+	if m.DryRun {
+		m.logPrintf("Rolling back the dry run (%v)\n", time.Since(started))
+		return tx.Rollback()
+	}
+	if m.BeforeCommit != nil {
+		if err := m.BeforeCommit(); err != nil {
+			m.logVerbosePrintf("Rollback transaction\n")
+			if errRollback := tx.Rollback(); errRollback != nil {
+				return multierror.Append(err, errRollback)
+			}
+			return err
+		}
+	}
+	m.logVerbosePrintf("Commit transaction\n")
+	return tx.Commit()
+}
+
+// applyMigrations reads *Migration and error from a channel. Any other type
 // sent on this channel will result in a panic. Each migration is then
 // proxied to the database driver and run against the database.
 // Before running a newly received migration it will check if it's supposed
 // to stop execution because it might have received a stop signal on the
-// GracefulStop channel.
-func (m *Migrate) runMigrations(ret <-chan interface{}) error {
+// GracefulStop channel. With ContinueOnError, a failed migration is
+// skipped, see skipFailed.
+func (m *Migrate) applyMigrations(ret <-chan interface{}) error {
+	applied := 0
+	var failures []MigrationFailure
+	// done returns the failures of ContinueOnError, if any
+	done := func() error {
+		if len(failures) > 0 {
+			return &ErrMigrationsFailed{Failures: failures}
+		}
+		return nil
+	}
 	for r := range ret {
 
 		if m.stop() {
-			return nil
+			return done()
 		}
 
 		switch r := r.(type) {
@@ -736,20 +1282,156 @@ func (m *Migrate) runMigrations(ret <-chan interface{}) error {
 		case *Migration:
 			migr := r
 
+			// throttle between migrations
+			if applied > 0 {
+				if err := m.wait(); err != nil {
+					return err
+				}
+				if m.stop() {
+					return done()
+				}
+			}
+
+			var body *bufio.Reader
+			var pragmas pragma.Pragmas
+			wasm, empty := false, false
+			if migr.Body != nil {
+				body = bufio.NewReaderSize(migr.BufferedBody, pragmaPeekSize)
+				var err error
+				if pragmas, err = peekPragmas(body); err != nil {
+					return err
+				}
+				head, err := body.Peek(len(wasmMagic))
+				if err != nil && err != io.EOF {
+					return err
+				}
+				wasm = isWasm(head)
+				// refuse before the database is dirty
+				if pragmas.Has(pragma.Exec) && !m.AllowExec {
+					return ErrExecNotAllowed
+				}
+				if pragmas.Has(pragma.Exec) && m.DryRun {
+					return ErrExecDryRun
+				}
+				if pragmas.Has(pragma.Exec) && m.AtomicBatch {
+					return ErrExecAtomicBatch
+				}
+				if wasm && m.Wasm == nil {
+					return ErrNoWasmRuntime
+				}
+				if pragmas.Has(pragma.Starlark) {
+					if m.Scripts == nil {
+						return ErrNoScriptRuntime
+					}
+					if _, ok := m.databaseDrv.(database.Querier); !ok {
+						return ErrQueryUnsupported
+					}
+				}
+				if pragmas.Has(pragma.Load) {
+					if _, ok := m.databaseDrv.(database.Loader); !ok {
+						return ErrLoadUnsupported
+					}
+				}
+				if pragmas.Has(pragma.Backfill) {
+					if _, ok := m.databaseDrv.(database.Querier); !ok {
+						return ErrQueryUnsupported
+					}
+				}
+				if !wasm && !pragmas.Has(pragma.Exec) && !pragmas.Has(pragma.Starlark) &&
+					!pragmas.Has(pragma.Load) && !pragmas.Has(pragma.Backfill) {
+					if empty, err = peekEmpty(body); err != nil {
+						return err
+					}
+					if empty && m.StrictEmpty {
+						return ErrEmptyMigration{Migration: migr.LogString()}
+					}
+				}
+			}
+
+			if m.OnStart != nil {
+				m.OnStart(migr)
+			}
+
 			// set version with dirty state
-			if err := m.databaseDrv.SetVersion(migr.TargetVersion, true); err != nil {
+			if err := m.state().SetVersion(migr.TargetVersion, true); err != nil {
 				return err
 			}
 
-			if migr.Body != nil {
-				m.logVerbosePrintf("Read and execute %v\n", migr.LogString())
-				if err := m.databaseDrv.Run(migr.BufferedBody); err != nil {
+			deselected, skipped := false, false
+			if body != nil {
+				run, err := m.shouldRun(pragmas)
+				if err != nil {
 					return err
 				}
+				if run {
+					if run, err = pragma.SelectTags(m.SelectTags, pragmas.Tags()); err != nil {
+						return err
+					}
+					deselected = !run
+				}
+				skipped = !run
+				if run && empty {
+					m.logPrintf("Recorded %v as applied (empty)\n", migr.LogString())
+					if _, err := io.Copy(ioutil.Discard, body); err != nil {
+						return err
+					}
+				} else if run {
+					var r io.Reader = body
+					if pragmas.Has(pragma.Template) {
+						if r, err = m.render(body); err != nil {
+							return err
+						}
+					} else if migr.Size >= 0 {
+						// drivers can tell large migrations, see
+						// database.ReadMigration
+						r = source.WithSize(ioutil.NopCloser(body), migr.Size)
+					}
+					m.logVerbosePrintf("Read and execute %v\n", migr.LogString())
+					if command, ok := pragmas.Get(pragma.Exec); ok {
+						err = m.exec(migr, command, r)
+					} else if wasm {
+						err = m.runWasm(migr, r)
+					} else if pragmas.Has(pragma.Starlark) {
+						err = m.runScript(migr, r)
+					} else if spec, ok := pragmas.Get(pragma.Load); ok {
+						err = m.load(migr, spec, r)
+					} else if spec, ok := pragmas.Get(pragma.Backfill); ok {
+						err = m.backfill(migr, spec, r)
+					} else {
+						err = m.databaseDrv.Run(r)
+					}
+					if err == ErrBackfillStopped && !migr.late {
+						m.summarize(migr, false, err)
+						if errVersion := m.backfillStopped(migr); errVersion != nil {
+							return multierror.Append(err, errVersion)
+						}
+						return err
+					} else if err != nil && m.ContinueOnError {
+						failures = append(failures, MigrationFailure{Migration: migr.LogString(), Err: err})
+						m.summarize(migr, false, err)
+						if err := m.skipFailed(migr, body, err); err != nil {
+							return err
+						}
+						applied++
+						continue
+					} else if err != nil {
+						m.summarize(migr, false, err)
+						return err
+					}
+				} else {
+					if deselected {
+						m.logPrintf("Skipping %v, its tags aren't selected\n", migr.LogString())
+					} else {
+						m.logPrintf("Skipping %v, its condition isn't met\n", migr.LogString())
+					}
+					if _, err := io.Copy(ioutil.Discard, body); err != nil {
+						return err
+					}
+				}
 			}
 
 			// set clean state
-			if err := m.databaseDrv.SetVersion(migr.TargetVersion, false); err != nil {
+			if err := m.state().SetVersion(migr.TargetVersion, false); err != nil {
 				return err
 			}
 
@@ -765,14 +1447,140 @@ func (m *Migrate) runMigrations(ret <-chan interface{}) error {
 					m.logPrintf("%v (%v)\n", migr.LogString(), readTime+runTime)
 				}
 			}
+			if deselected {
+				// a migration applied late is still skipped
+				if !migr.late {
+					if err := m.recordSkipped(migr); err != nil {
+						return err
+					}
+				}
+			} else if err := m.recordHistory(migr, endTime.Sub(migr.StartedBuffering)); err != nil {
+				return err
+			}
+			m.summarize(migr, skipped, nil)
+			applied++
+			if m.OnApplied != nil {
+				m.OnApplied(migr)
+			}
 
 		default:
 			return fmt.Errorf("unknown type: %T with value: %+v", r, r)
 		}
 	}
+	return done()
+}
+
+// peekPragmas returns the pragmas of a migration body without consuming it.
+func peekPragmas(body *bufio.Reader) (pragma.Pragmas, error) {
+	head, err := body.Peek(pragmaPeekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if len(head) == pragmaPeekSize {
+		// ignore a partially peeked line
+		if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+			head = head[:i]
+		}
+	}
+	return pragma.Parse(head), nil
+}
+
+// variables returns Variables, with the `dialect` variable
+// defaulting to the dialect of the database driver.
+func (m *Migrate) variables() map[string]string {
+	vars := map[string]string{"dialect": source.DialectOf(m.databaseName)}
+	for k, v := range m.Variables {
+		vars[k] = v
+	}
+	return vars
+}
+
+// shouldRun evaluates the if pragmas of a migration against Variables.
+func (m *Migrate) shouldRun(pragmas pragma.Pragmas) (bool, error) {
+	conditions := pragmas.All(pragma.If)
+	if len(conditions) == 0 {
+		return true, nil
+	}
+	vars := m.variables()
+	for _, condition := range conditions {
+		ok, err := pragma.Eval(condition, vars)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// render renders a migration with the template pragma for the dialect
+// of the database driver, see package database/sqltemplate.
+func (m *Migrate) render(body io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	vars := m.variables()
+	rendered, err := sqltemplate.Render(b, vars["dialect"], vars)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(rendered), nil
+}
+
+// wait pauses for SleepBetween and then, if ReplicationLagQuery is set,
+// blocks until the replication lag dropped to MaxReplicationLag or below.
+// It returns early if a stop signal was received.
+func (m *Migrate) wait() error {
+	if m.SleepBetween > 0 {
+		m.logVerbosePrintf("Sleeping %v\n", m.SleepBetween)
+		m.sleep(m.SleepBetween)
+	}
+
+	checker, err := m.lagChecker()
+	if checker == nil || err != nil {
+		return err
+	}
+
+	for !m.stop() {
+		lag, err := checker.ReplicationLag(m.ReplicationLagQuery)
+		if err != nil {
+			return err
+		}
+		if lag <= m.MaxReplicationLag {
+			return nil
+		}
+		m.logPrintf("Replication lag %v exceeds %v, waiting ...\n", lag, m.MaxReplicationLag)
+		m.sleep(m.ReplicationLagInterval)
+	}
 	return nil
 }
 
+// lagChecker returns the database driver checking the replication lag if
+// ReplicationLagQuery is set, or ErrLagUnsupported if the driver can't.
+// Runs check it before they lock, rather than failing after their first
+// migration.
+func (m *Migrate) lagChecker() (database.LagChecker, error) {
+	if m.ReplicationLagQuery == "" {
+		return nil, nil
+	}
+	checker, ok := m.databaseDrv.(database.LagChecker)
+	if !ok {
+		return nil, ErrLagUnsupported
+	}
+	return checker, nil
+}
+
+// sleep pauses for d, or until a stop signal is received, see stop.
+func (m *Migrate) sleep(d time.Duration) {
+	if m.stop() {
+		return
+	}
+	select {
+	case <-m.GracefulStop:
+		m.isGracefulStop = true
+	case <-time.After(d):
+	}
+}
+
 // versionExists checks the source if either the up or down migration for
 // the specified migration version exists.
 func (m *Migrate) versionExists(version uint) (result error) {
@@ -833,8 +1641,8 @@ func (m *Migrate) stop() bool {
 func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, error) {
 	var migr *Migration
 
-	if targetVersion >= int(version) {
-		r, identifier, err := m.sourceDrv.ReadUp(version)
+	if m.position(targetVersion) >= m.position(int(version)) {
+		r, identifier, err := m.readUpBody(version)
 		if os.IsNotExist(err) {
 			// create "empty" migration
 			migr, err = NewMigration(nil, "", version, targetVersion)
@@ -851,10 +1659,11 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 			if err != nil {
 				return nil, err
 			}
+			migr.checksum = r.raw.Checksum
 		}
 
 	} else {
-		r, identifier, err := m.sourceDrv.ReadDown(version)
+		r, identifier, err := m.readDownBody(version)
 		if os.IsNotExist(err) {
 			// create "empty" migration
 			migr, err = NewMigration(nil, "", version, targetVersion)
@@ -871,6 +1680,7 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 			if err != nil {
 				return nil, err
 			}
+			migr.checksum = r.raw.Checksum
 		}
 	}
 
@@ -883,9 +1693,78 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 	return migr, nil
 }
 
+// readUpBody reads the up migration of version from the source
+// and decodes it according to Encoding and Decrypter.
+func (m *Migrate) readUpBody(version uint) (*migrationBody, string, error) {
+	r, identifier, err := m.sourceDrv.ReadUp(version)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := m.readBody(version, source.Up, r)
+	return body, identifier, err
+}
+
+// readDownBody reads the down migration of version from the source
+// and decodes it according to Encoding and Decrypter.
+func (m *Migrate) readDownBody(version uint) (*migrationBody, string, error) {
+	r, identifier, err := m.sourceDrv.ReadDown(version)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := m.readBody(version, source.Down, r)
+	return body, identifier, err
+}
+
+// migrationBody is a decoded migration body, see readBody.
+type migrationBody struct {
+	io.ReadCloser
+	// raw is the body as read from the source
+	raw *checksumReader
+}
+
+// readBody verifies a migration body against Manifest and Approvals and
+// decodes it, computing the checksum of the body read for the history.
+// It closes r on error.
+func (m *Migrate) readBody(version uint, direction source.Direction, r io.ReadCloser) (*migrationBody, error) {
+	// a plan only shows unapproved migrations
+	approve := m.Approvals != nil && direction == source.Up && m.Plan == nil
+	if m.Manifest != nil || approve {
+		// the body is run from a copy, so that it can't change after
+		// it was verified
+		body := &spool{}
+		checksum, err := manifest.ChecksumReader(io.TeeReader(r, body))
+		if err == nil && m.Manifest != nil {
+			err = m.Manifest.VerifyChecksum(version, direction, checksum)
+		}
+		if err == nil && approve {
+			err = m.Approvals.VerifyChecksum(version, checksum)
+		}
+		if err != nil {
+			return nil, multierror.Append(err, r.Close(), body.Close())
+		}
+		if err := r.Close(); err != nil {
+			return nil, multierror.Append(err, body.Close())
+		}
+		if r, err = body.reader(); err != nil {
+			return nil, multierror.Append(err, body.Close())
+		}
+	}
+
+	raw := newChecksumReader(r)
+	dr, err := newDecodingReader(raw, m.Encoding, m.Decrypter)
+	if err != nil {
+		return nil, multierror.Append(err, r.Close())
+	}
+	return &migrationBody{ReadCloser: dr, raw: raw}, nil
+}
+
 // lock is a thread safe helper function to lock the database.
 // It should be called as late as possible when running migrations.
 func (m *Migrate) lock() error {
+	if m.readOnly() {
+		return ErrReadOnly
+	}
+
 	m.isLockedMu.Lock()
 	defer m.isLockedMu.Unlock()
 
@@ -893,6 +1772,24 @@ func (m *Migrate) lock() error {
 		return ErrLocked
 	}
 
+	locker, err := m.locker()
+	if err != nil {
+		return err
+	}
+	if l, ok := locker.(*database.TableLock); ok {
+		// waits for the lock until the timeout itself, so that it can't
+		// insert the lock row after lock gave up
+		l.Timeout = m.LockTimeout
+		err := l.Lock()
+		if err == database.ErrLocked {
+			return ErrLockTimeout
+		} else if err != nil {
+			return err
+		}
+		m.isLocked = true
+		return nil
+	}
+
 	// create done channel, used in the timeout goroutine
 	done := make(chan bool, 1)
 	defer func() {
@@ -918,7 +1815,7 @@ func (m *Migrate) lock() error {
 
 	// now try to acquire the lock
 	go func() {
-		if err := m.databaseDrv.Lock(); err != nil {
+		if err := locker.Lock(); err != nil {
 			errchan <- err
 		} else {
 			errchan <- nil
@@ -926,13 +1823,144 @@ func (m *Migrate) lock() error {
 	}()
 
 	// wait until we either receive ErrLockTimeout or error from Lock operation
-	err := <-errchan
+	err = <-errchan
 	if err == nil {
 		m.isLocked = true
 	}
 	return err
 }
 
+// readOnly reports whether Migrate or its database driver is read-only.
+func (m *Migrate) readOnly() bool {
+	if m.ReadOnly {
+		return true
+	}
+	for _, d := range []interface{}{m.databaseDrv, m.State} {
+		if r, ok := d.(database.ReadOnlyDriver); ok && r.ReadOnly() {
+			return true
+		}
+	}
+	return false
+}
+
+// state returns the store keeping the version, State or the database driver.
+func (m *Migrate) state() database.StateStore {
+	if m.State != nil {
+		return m.State
+	}
+	return m.databaseDrv
+}
+
+// stateDriver returns the driver keeping the lock and migrate's tables,
+// State if it is a database.Driver or the database driver.
+func (m *Migrate) stateDriver() database.Driver {
+	if d, ok := m.State.(database.Driver); ok {
+		return d
+	}
+	return m.databaseDrv
+}
+
+// locker returns the Locker of the database according to Locker and LockStrategy.
+func (m *Migrate) locker() (database.Locker, error) {
+	if m.Locker != nil {
+		return m.Locker, nil
+	}
+	// a Locker may remember the lock it acquired
+	if m.strategyLocker == nil || m.strategy != m.LockStrategy {
+		locker, err := database.NewLocker(m.LockStrategy, m.stateDriver())
+		if err != nil {
+			return nil, err
+		}
+		m.strategyLocker, m.strategy = locker, m.LockStrategy
+	}
+	return m.strategyLocker, nil
+}
+
+// LockStatus returns the holder of the lock, or nil if it isn't held.
+// The Locker must implement database.LockReporter.
+func (m *Migrate) LockStatus() (*database.LockInfo, error) {
+	locker, err := m.locker()
+	if err != nil {
+		return nil, err
+	}
+	reporter, ok := locker.(database.LockReporter)
+	if !ok {
+		return nil, ErrLockStatusUnsupported
+	}
+	return reporter.LockHolder()
+}
+
+// ForceUnlock releases the lock, even if it is held by someone else,
+// e.g. a runner which crashed. The Locker must implement database.ForceUnlocker.
+func (m *Migrate) ForceUnlock() error {
+	if m.readOnly() {
+		return ErrReadOnly
+	}
+	locker, err := m.locker()
+	if err != nil {
+		return err
+	}
+	unlocker, ok := locker.(database.ForceUnlocker)
+	if !ok {
+		return ErrForceUnlockUnsupported
+	}
+	return unlocker.ForceUnlock()
+}
+
+// AuditEvent records an event which isn't a run in AuditTable, e.g. that a
+// safety check was overridden, with a note as result. It fails if AuditTable
+// isn't set.
+func (m *Migrate) AuditEvent(command, target, note string) error {
+	if m.AuditTable == "" {
+		return ErrNoAuditTable
+	}
+	info := database.NewLockInfo()
+	auditor := &database.AuditTable{Driver: m.stateDriver(), Table: m.AuditTable}
+	return auditor.Record(database.AuditRecord{
+		User:     info.User,
+		Hostname: info.Hostname,
+		Client:   m.AuditClient,
+		Source:   m.sourceID,
+		Command:  command,
+		Target:   target,
+		Result:   note,
+		Started:  time.Now(),
+	})
+}
+
+// audit records a run of command in AuditTable, if it is set and Migrate
+// isn't read-only or a dry run. err is the result of the run, it is set if the record
+// fails.
+func (m *Migrate) audit(command, target string, started time.Time, err *error) {
+	if m.AuditTable == "" || m.readOnly() || m.DryRun {
+		return
+	}
+	info := database.NewLockInfo()
+	record := database.AuditRecord{
+		User:     info.User,
+		Hostname: info.Hostname,
+		Client:   m.AuditClient,
+		Source:   m.sourceID,
+		Command:  command,
+		Target:   target,
+		Result:   "ok",
+		Started:  started,
+		Duration: time.Since(started),
+	}
+	if *err == ErrNoChange {
+		record.Result = "no change"
+	} else if *err != nil {
+		record.Result = (*err).Error()
+	}
+	auditor := &database.AuditTable{Driver: m.stateDriver(), Table: m.AuditTable}
+	if auditErr := auditor.Record(record); auditErr != nil {
+		m.logErr(auditErr)
+		if *err == nil || *err == ErrNoChange {
+			*err = auditErr
+		}
+	}
+}
+
 // unlock is a thread safe helper function to unlock the database.
 // It should be called as early as possible when no more migrations are
 // expected to be executed.
@@ -940,7 +1968,11 @@ func (m *Migrate) unlock() error {
 	m.isLockedMu.Lock()
 	defer m.isLockedMu.Unlock()
 
-	if err := m.databaseDrv.Unlock(); err != nil {
+	locker, err := m.locker()
+	if err != nil {
+		return err
+	}
+	if err := locker.Unlock(); err != nil {
 		// BUG: Can potentially create a deadlock. Add a timeout.
 		return err
 	}
@@ -949,6 +1981,38 @@ func (m *Migrate) unlock() error {
 	return nil
 }
 
+// lockRun locks the database for Migrate, Steps, Up and Down, unless they
+// only write Plan.
+func (m *Migrate) lockRun() error {
+	m.startRun()
+	if m.Plan != nil {
+		return nil
+	}
+	if err := m.checkContinue(); err != nil {
+		m.finishRun()
+		return err
+	}
+	if _, err := m.lagChecker(); err != nil {
+		m.finishRun()
+		return err
+	}
+	if err := m.lock(); err != nil {
+		m.finishRun()
+		return err
+	}
+	m.lockAcquired()
+	return nil
+}
+
+// unlockRunErr unlocks the database after lockRun, see unlockErr.
+func (m *Migrate) unlockRunErr(prevErr error) error {
+	defer m.finishRun()
+	if m.Plan != nil {
+		return prevErr
+	}
+	return m.unlockErr(prevErr)
+}
+
 // unlockErr calls unlock and returns a combined error
 // if a prevErr is not nil.
 func (m *Migrate) unlockErr(prevErr error) error {
@@ -2,18 +2,30 @@ package migrate
 
 import (
 	"bytes"
+	"crypto/rand"
 	"database/sql"
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 import (
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/golang-migrate/migrate/v4/database"
 	dStub "github.com/golang-migrate/migrate/v4/database/stub"
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/approval"
+	"github.com/golang-migrate/migrate/v4/source/graph"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
 	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
 )
 
 // sourceStubMigrations hold the following migrations:
@@ -945,6 +957,332 @@ func TestVersion(t *testing.T) {
 	}
 }
 
+func TestLockStrategy(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	m.LockStrategy = "unknown"
+	if err := m.Steps(1); err == nil {
+		t.Fatal("expected error for unknown lock strategy")
+	}
+
+	m.LockStrategy = database.LockNone
+	if err := dbDrv.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.IsLocked {
+		t.Error("expected the lock of the driver to be untouched")
+	}
+
+	// a held external lock
+	locker, _ := (&dStub.Stub{}).Open("stub://")
+	if err := locker.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	m.Locker = locker
+	if err := m.Steps(1); err != database.ErrLocked {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+}
+
+func TestLockStatus(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if holder, err := m.LockStatus(); err != nil || holder != nil {
+		t.Fatalf("expected no holder, got %v, %v", holder, err)
+	}
+
+	// a lock left behind by a crashed process
+	if err := dbDrv.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	holder, err := m.LockStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder == nil {
+		t.Fatal("expected a holder")
+	}
+	if err := m.ForceUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.IsLocked {
+		t.Error("expected the lock to be released")
+	}
+
+	m.LockStrategy = database.LockNone
+	if _, err := m.LockStatus(); err != ErrLockStatusUnsupported {
+		t.Errorf("expected ErrLockStatusUnsupported, got %v", err)
+	}
+	if err := m.ForceUnlock(); err != ErrForceUnlockUnsupported {
+		t.Errorf("expected ErrForceUnlockUnsupported, got %v", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	if err := dbDrv.SetVersion(1, false); err != nil {
+		t.Fatal(err)
+	}
+	m.ReadOnly = true
+	m.AuditTable = "audit"
+
+	writes := []struct {
+		name string
+		run  func() error
+	}{
+		{"up", m.Up},
+		{"down", m.Down},
+		{"steps", func() error { return m.Steps(1) }},
+		{"migrate", func() error { return m.Migrate(3) }},
+		{"force", func() error { return m.Force(3) }},
+		{"drop", m.Drop},
+		{"run", func() error { return m.Run(M(5)) }},
+		{"force unlock", m.ForceUnlock},
+	}
+	for _, w := range writes {
+		if err := w.run(); err != ErrReadOnly {
+			t.Errorf("%v: expected ErrReadOnly, got %v", w.name, err)
+		}
+	}
+	if dbDrv.IsLocked || len(dbDrv.MigrationSequence) != 0 {
+		t.Errorf("expected no lock and no writes, got %v", dbDrv.MigrationSequence)
+	}
+
+	if v, _, err := m.Version(); err != nil || v != 1 {
+		t.Errorf("expected version 1, got %v, %v", v, err)
+	}
+	if pending, err := m.Pending(); err != nil || !reflect.DeepEqual(pending, []uint{3, 4, 5, 7}) {
+		t.Errorf("expected pending [3 4 5 7], got %v, %v", pending, err)
+	}
+	if _, err := m.LockStatus(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDumpSchemaUnsupported(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	if err := m.DumpSchema(ioutil.Discard); err != ErrDumpUnsupported {
+		t.Errorf("expected ErrDumpUnsupported, got %v", err)
+	}
+}
+
+func TestFresh(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	dropped := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Fresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !dropped.EqualSequence([]string{"CREATE 1", "CREATE 3", "CREATE 4", "CREATE 7", dStub.DROP}) {
+		t.Errorf("expected the database to be dropped, got %v", dropped.MigrationSequence)
+	}
+	reopened := m.databaseDrv.(*dStub.Stub)
+	if reopened == dropped {
+		t.Fatal("expected the database to be reopened")
+	}
+	if !reopened.EqualSequence([]string{"CREATE 1", "CREATE 3", "CREATE 4", "CREATE 7"}) {
+		t.Errorf("expected all migrations to be applied, got %v", reopened.MigrationSequence)
+	}
+
+	m, _ = NewWithInstance("stub", m.sourceDrv, "stub", reopened)
+	if err := m.Fresh(); err != ErrNoDatabaseURL {
+		t.Errorf("expected ErrNoDatabaseURL, got %v", err)
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.LoadSnapshot(strings.NewReader("CREATE TABLE t")); err != ErrNoSnapshotVersion {
+		t.Fatalf("expected ErrNoSnapshotVersion, got %v", err)
+	}
+	if err := m.LoadSnapshot(strings.NewReader("-- migrate:snapshot-version 2\n\nCREATE TABLE t")); !os.IsNotExist(err) {
+		t.Fatalf("expected an unknown version to fail, got %v", err)
+	}
+
+	snapshot := "-- migrate:snapshot-version 4\n\nCREATE TABLE t"
+	if err := m.LoadSnapshot(strings.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{snapshot}) {
+		t.Errorf("expected the snapshot to be run, got %v", dbDrv.MigrationSequence)
+	}
+	if v, dirty, err := m.Version(); err != nil || dirty || v != 4 {
+		t.Errorf("expected version 4, got %v, %v, %v", v, dirty, err)
+	}
+	if err := m.LoadSnapshot(strings.NewReader(snapshot)); err != ErrNotFresh {
+		t.Errorf("expected ErrNotFresh, got %v", err)
+	}
+}
+
+func TestAuditTable(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.AuditTable = "audit"
+	m.AuditClient = "test"
+
+	tt := []struct {
+		run            func() error
+		expectedRecord string
+	}{
+		{run: m.Up, expectedRecord: "'test', 'stub://', 'up', '', 'ok'"},
+		{run: m.Up, expectedRecord: "'test', 'stub://', 'up', '', 'no change'"},
+		{run: func() error { return m.Steps(-2) }, expectedRecord: "'test', 'stub://', 'steps', '-2', 'ok'"},
+		{run: func() error { return m.Migrate(2) }, expectedRecord: "'test', 'stub://', 'goto', '2', 'file does not exist'"},
+		{run: func() error { return m.Force(4) }, expectedRecord: "'test', 'stub://', 'force', '4', 'ok'"},
+	}
+	for i, v := range tt {
+		_ = v.run()
+		record := string(dbDrv.LastRunMigration)
+		if !strings.HasPrefix(record, "INSERT INTO audit ") || !strings.Contains(record, v.expectedRecord) {
+			t.Errorf("run %v: expected record with %v, got %v", i, v.expectedRecord, record)
+		}
+	}
+}
+
+func TestAuditEvent(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	if err := m.AuditEvent("break-glass", "drop", "cleanup"); err != ErrNoAuditTable {
+		t.Fatalf("expected ErrNoAuditTable, got %v", err)
+	}
+	m.AuditTable = "audit"
+	if err := m.AuditEvent("break-glass", "drop", "cleanup"); err != nil {
+		t.Fatal(err)
+	}
+	record := string(dbDrv.LastRunMigration)
+	if !strings.HasPrefix(record, "INSERT INTO audit ") || !strings.Contains(record, "'stub://', 'break-glass', 'drop', 'cleanup'") {
+		t.Errorf("expected break-glass record, got %v", record)
+	}
+}
+
+func TestPending(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		version         int
+		expectedPending []uint
+		expectErr       bool
+	}{
+		{version: database.NilVersion, expectedPending: []uint{1, 3, 4, 5, 7}},
+		{version: 4, expectedPending: []uint{5, 7}},
+		{version: 7, expectedPending: []uint{}},
+		{version: 2, expectErr: true},
+	}
+	for _, v := range tt {
+		if err := dbDrv.SetVersion(v.version, false); err != nil {
+			t.Fatal(err)
+		}
+		pending, err := m.Pending()
+		if (err != nil) != v.expectErr {
+			t.Fatalf("version %v: unexpected error %v", v.version, err)
+		}
+		if !reflect.DeepEqual(pending, v.expectedPending) && !v.expectErr {
+			t.Errorf("version %v: expected pending %v, got %v", v.version, v.expectedPending, pending)
+		}
+	}
+}
+
+func TestTargetMax(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.TargetMax = 4
+
+	if err := m.Migrate(5); err != ErrAboveTargetMax {
+		t.Fatalf("expected ErrAboveTargetMax, got %v", err)
+	}
+	if pending, err := m.Pending(); err != nil || !reflect.DeepEqual(pending, []uint{1, 3, 4}) {
+		t.Fatalf("expected 1, 3 and 4 pending, got %v, %v", pending, err)
+	}
+	if err := m.Steps(4); err != (ErrShortLimit{1}) {
+		t.Fatalf("expected ErrShortLimit, got %v", err)
+	}
+	equalDbSeq(t, 0, migrationSequence{mr("CREATE 1"), mr("CREATE 3"), mr("CREATE 4")}, dbDrv)
+	if err := m.Up(); err != ErrNoChange {
+		t.Fatalf("expected ErrNoChange, got %v", err)
+	}
+
+	// a version above doesn't move further up, but down
+	if err := dbDrv.SetVersion(5, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != ErrNoChange {
+		t.Fatalf("expected ErrNoChange, got %v", err)
+	}
+	if err := m.Migrate(4); err != nil {
+		t.Fatal(err)
+	}
+
+	m.TargetMax = 0
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := m.Version(); err != nil || v != 7 {
+		t.Fatalf("expected version 7, got %v, %v", v, err)
+	}
+}
+
+// rangeSource records the versions its migrations were listed from.
+type rangeSource struct {
+	*sStub.Stub
+	from []uint
+}
+
+func (s *rangeSource) ListFrom(version uint) error {
+	s.from = append(s.from, version)
+	return nil
+}
+
+func TestListFrom(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	src := &rangeSource{Stub: srcDrv.(*sStub.Stub)}
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+	m, err := NewWithInstance("stub", src, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing to skip from the start
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	// running down reads earlier versions
+	if err := m.Migrate(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Migrate(4); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(src.from, []uint{1, 1}) {
+		t.Errorf("expected listings from 1 twice, got %v", src.from)
+	}
+}
+
 func TestRun(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 
@@ -1140,7 +1478,7 @@ func TestRead(t *testing.T) {
 
 	for i, v := range tt {
 		ret := make(chan interface{})
-		go m.read(v.from, v.to, ret)
+		go m.read(v.from, v.to, ret, nil)
 		migrations, err := migrationsFromChannel(ret)
 
 		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
@@ -1217,7 +1555,7 @@ func TestReadUp(t *testing.T) {
 
 	for i, v := range tt {
 		ret := make(chan interface{})
-		go m.readUp(v.from, v.limit, ret)
+		go m.readUp(v.from, v.limit, ret, nil)
 		migrations, err := migrationsFromChannel(ret)
 
 		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
@@ -1294,7 +1632,7 @@ func TestReadDown(t *testing.T) {
 
 	for i, v := range tt {
 		ret := make(chan interface{})
-		go m.readDown(v.from, v.limit, ret)
+		go m.readDown(v.from, v.limit, ret, nil)
 		migrations, err := migrationsFromChannel(ret)
 
 		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
@@ -1319,6 +1657,312 @@ func TestLock(t *testing.T) {
 	}
 }
 
+func TestSleepBetween(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.SleepBetween = 10 * time.Millisecond
+
+	start := time.Now()
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 5 migrations, 4 pauses in between
+	if d := time.Since(start); d < 4*m.SleepBetween {
+		t.Errorf("expected to take at least %v, took %v", 4*m.SleepBetween, d)
+	}
+}
+
+func TestReplicationLag(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.ReplicationLagQuery = "SELECT lag"
+	m.MaxReplicationLag = time.Second
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// checked between each of the 5 migrations
+	if len(dbDrv.LagQueries) != 4 {
+		t.Errorf("expected 4 lag checks, got %v", dbDrv.LagQueries)
+	}
+}
+
+// noLagStub is a stub database which can't check the replication lag
+type noLagStub struct {
+	database.Driver
+}
+
+func TestReplicationLagUnsupported(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.databaseDrv = noLagStub{dbDrv}
+	m.ReplicationLagQuery = "SELECT lag"
+
+	// fails before applying any migration
+	if err := m.Up(); err != ErrLagUnsupported {
+		t.Fatalf("expected ErrLagUnsupported, got %v", err)
+	}
+	if dbDrv.CurrentVersion != database.NilVersion || len(dbDrv.MigrationSequence) != 0 {
+		t.Errorf("expected no migration applied, got version %v", dbDrv.CurrentVersion)
+	}
+}
+
+func TestSleepBetweenStop(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.SleepBetween = time.Hour
+	m.OnApplied = func(migr *Migration) {
+		m.GracefulStop <- true
+	}
+
+	start := time.Now()
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Minute {
+		t.Errorf("expected the stop to end the pause, took %v", d)
+	}
+}
+
+func TestAtomicBatch(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.AtomicBatch = true
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.IsInTx {
+		t.Error("expected transaction to be committed")
+	}
+	equalDbSeq(t, 0, migrationSequence{
+		mr("CREATE 1"),
+		mr("CREATE 3"),
+		mr("CREATE 4"),
+		mr("CREATE 7"),
+	}, dbDrv)
+
+	// version 2 doesn't exist, nothing is applied
+	if err := m.Migrate(2); !os.IsNotExist(err) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+	if dbDrv.IsInTx {
+		t.Error("expected transaction to be rolled back")
+	}
+	if dbDrv.CurrentVersion != 7 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 7, got %v (dirty %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	mf, err := manifest.Build(m.sourceDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// drop version 4 from the manifest
+	mf.Entries = append(mf.Entries[:2], mf.Entries[3:]...)
+	m.Manifest = mf
+
+	err = m.Up()
+	merr, ok := err.(*multierror.Error)
+	if !ok || len(merr.Errors) == 0 {
+		t.Fatalf("expected manifest.ErrUnverified, got %v", err)
+	}
+	expected := manifest.ErrUnverified{Version: 4, Direction: source.Up, Missing: true}
+	if merr.Errors[0] != expected {
+		t.Fatalf("expected %v, got %v", expected, merr.Errors[0])
+	}
+	equalDbSeq(t, 0, migrationSequence{
+		mr("CREATE 1"),
+		mr("CREATE 3"),
+	}, dbDrv)
+}
+
+func TestApprovals(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	dir, err := ioutil.TempDir("", "migrate_approvals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// approve 1 and 3, but not 4
+	for version, body := range map[uint]string{1: "CREATE 1", 3: "CREATE 3"} {
+		a := approval.New(version, []byte(body), "ana")
+		if err := a.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if _, err := a.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(approval.Path(dir, version), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Approvals = &approval.Dir{Path: dir, Keys: []ssh.PublicKey{signer.PublicKey()}}
+
+	err = m.Up()
+	merr, ok := err.(*multierror.Error)
+	if !ok || len(merr.Errors) == 0 {
+		t.Fatalf("expected approval.ErrUnapproved, got %v", err)
+	}
+	expected := approval.ErrUnapproved{Version: 4}
+	if merr.Errors[0] != expected {
+		t.Fatalf("expected %v, got %v", expected, merr.Errors[0])
+	}
+	equalDbSeq(t, 0, migrationSequence{
+		mr("CREATE 1"),
+		mr("CREATE 3"),
+	}, dbDrv)
+
+	// down migrations need no approval
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDependencyOrder(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "-- migrate:depends-on 2\nCREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	g, err := graph.New(m.sourceDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.sourceDrv = g
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	// order is 2, 1, 3
+	if err := m.Migrate(1); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{
+		mr("CREATE 2"),
+		mr("-- migrate:depends-on 2\nCREATE 1"),
+	}, dbDrv)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Migrate(2); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 1, migrationSequence{
+		mr("CREATE 2"),
+		mr("-- migrate:depends-on 2\nCREATE 1"),
+		mr("CREATE 3"),
+		mr("DROP 3"),
+		mr("DROP 1"),
+	}, dbDrv)
+}
+
+func TestConditionalMigrations(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "-- migrate:if env == \"production\"\nCREATE 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "-- migrate:if env == \"staging\"\nCREATE 3"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "-- migrate:if dialect == \"stub\"\nCREATE 4"})
+	migrations.Append(&source.Migration{Version: 5, Direction: source.Up, Identifier: "-- migrate:if env = staging\nCREATE 5"})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.Variables = map[string]string{"env": "staging"}
+
+	if err := m.Steps(4); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{
+		mr("CREATE 1"),
+		mr("-- migrate:if env == \"staging\"\nCREATE 3"),
+		mr("-- migrate:if dialect == \"stub\"\nCREATE 4"),
+	}, dbDrv)
+	if dbDrv.CurrentVersion != 4 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 4, got %v (dirty %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+
+	// invalid condition
+	if err := m.Up(); err == nil {
+		t.Error("expected error for invalid condition")
+	}
+}
+
+func TestDialectMigrations(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1 postgres", Dialect: "postgres"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2 mysql", Dialect: "mysql"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "postgresql", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{
+		mr("CREATE 1 postgres"),
+		mr("CREATE 3"),
+	}, dbDrv.(*dStub.Stub))
+}
+
+func TestTemplateMigrations(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "-- migrate:template\nCREATE TABLE t (id {{ autoincrement }}, env {{ text_type }} DEFAULT '{{ .env }}')"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE {{ now_func }}"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "-- migrate:template\nCREATE {{ unknown }}"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "postgres", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Variables = map[string]string{"env": "dev"}
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{
+		mr("-- migrate:template\nCREATE TABLE t (id SERIAL PRIMARY KEY, env TEXT DEFAULT 'dev')"),
+		mr("CREATE {{ now_func }}"),
+	}, dbDrv.(*dStub.Stub))
+
+	// invalid template
+	if err := m.Up(); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
+
 func migrationsFromChannel(ret chan interface{}) ([]*Migration, error) {
 	slice := make([]*Migration, 0)
 	for r := range ret {
@@ -1414,3 +2058,108 @@ func equalDbSeq(t *testing.T, i int, expected migrationSequence, got *dStub.Stub
 		t.Fatalf("\nexpected sequence %v,\ngot               %v, in %v", bs, got.MigrationSequence, i)
 	}
 }
+
+func TestState(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	state, err := database.Open("stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.State = state
+	stateDrv := state.(*dStub.Stub)
+
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := m.Version(); err != nil || v != 3 {
+		t.Fatalf("expected version 3, got %v, %v", v, err)
+	}
+	if stateDrv.CurrentVersion != 3 || dbDrv.CurrentVersion != database.NilVersion {
+		t.Errorf("expected version 3 in State only, got %v and %v", stateDrv.CurrentVersion, dbDrv.CurrentVersion)
+	}
+	if len(dbDrv.MigrationSequence) != 2 || len(stateDrv.MigrationSequence) != 0 {
+		t.Errorf("expected migrations to run against the database, got %v and %v",
+			dbDrv.MigrationSequence, stateDrv.MigrationSequence)
+	}
+
+	m.AtomicBatch = true
+	if err := m.Up(); err != ErrStateTx {
+		t.Errorf("expected ErrStateTx, got %v", err)
+	}
+	m.AtomicBatch = false
+
+	if err := m.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Version(); err != ErrNilVersion {
+		t.Errorf("expected ErrNilVersion after Drop, got %v", err)
+	}
+}
+
+func TestBeforeCommit(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.AtomicBatch = true
+
+	errAbort := errors.New("abort")
+	calls := 0
+	m.BeforeCommit = func() error {
+		calls++
+		if !dbDrv.IsInTx || dbDrv.CurrentVersion != 3 {
+			t.Errorf("expected version 3 in the transaction, got %v (in transaction %v)", dbDrv.CurrentVersion, dbDrv.IsInTx)
+		}
+		return errAbort
+	}
+	if err := m.Steps(2); err != errAbort {
+		t.Fatalf("expected the error of BeforeCommit, got %v", err)
+	}
+	if dbDrv.IsInTx || dbDrv.CurrentVersion != database.NilVersion || len(dbDrv.MigrationSequence) != 0 {
+		t.Errorf("expected the transaction to be rolled back, got version %v and %v", dbDrv.CurrentVersion, dbDrv.MigrationSequence)
+	}
+
+	m.BeforeCommit = func() error {
+		calls++
+		return nil
+	}
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.IsInTx || dbDrv.CurrentVersion != 3 {
+		t.Errorf("expected version 3 to be committed, got %v", dbDrv.CurrentVersion)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %v", calls)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.DryRun = true
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.IsInTx {
+		t.Error("expected transaction to be rolled back")
+	}
+	if len(dbDrv.MigrationSequence) != 0 || dbDrv.CurrentVersion != database.NilVersion {
+		t.Errorf("expected nothing applied, got %v at version %v", dbDrv.MigrationSequence, dbDrv.CurrentVersion)
+	}
+
+	m.DryRun = false
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	m.DryRun = true
+	if err := m.Migrate(2); !os.IsNotExist(err) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+	if dbDrv.CurrentVersion != 1 || dbDrv.IsDirty {
+		t.Errorf("expected clean version 1, got %v (dirty %v)", dbDrv.CurrentVersion, dbDrv.IsDirty)
+	}
+}
@@ -0,0 +1,151 @@
+// Package migratetest provides helpers for bringing a database schema up in
+// the tests of applications, e.g.
+//
+//	func TestUsers(t *testing.T) {
+//		databaseURL := migratetest.FreshDB(t)
+//		m := migratetest.ApplyAll(t, "file://migrations", databaseURL)
+//		defer m.Close()
+//		...
+//		migratetest.AssertGolden(t, databaseURL, "SELECT * FROM users ORDER BY id", "testdata/users.golden")
+//	}
+//
+// The drivers of the database and source URLs must be imported by the tests.
+package migratetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+)
+
+// Environment variables read by the helpers.
+const (
+	// EnvDatabaseURL is the URL of the scratch database used by FreshDB.
+	EnvDatabaseURL = "MIGRATE_TEST_DATABASE_URL"
+	// EnvUpdateGolden makes AssertGolden write golden files instead of
+	// comparing them if set to a non-empty value.
+	EnvUpdateGolden = "MIGRATE_UPDATE_GOLDEN"
+)
+
+// FreshDB returns the URL of the scratch database in EnvDatabaseURL after
+// dropping everything inside it. It skips the test if EnvDatabaseURL isn't set.
+func FreshDB(t testing.TB) string {
+	t.Helper()
+	databaseURL := os.Getenv(EnvDatabaseURL)
+	if databaseURL == "" {
+		t.Skipf("%v isn't set", EnvDatabaseURL)
+	}
+	d, err := database.Open(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	return databaseURL
+}
+
+// ApplyAll applies all up migrations of sourceURL to the database at
+// databaseURL and returns the Migrate instance, which the caller must close.
+func ApplyAll(t testing.TB, sourceURL, databaseURL string) *migrate.Migrate {
+	t.Helper()
+	m, err := migrate.New(sourceURL, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up(t, m)
+	return m
+}
+
+// ApplyAllFS is ApplyAll for the migrations in directory path of fs,
+// e.g. http.Dir("..") or a file system embedded in the test binary.
+func ApplyAllFS(t testing.TB, fs http.FileSystem, path, databaseURL string) *migrate.Migrate {
+	t.Helper()
+	src, err := httpfs.New(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithSourceInstance("httpfs", src, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up(t, m)
+	return m
+}
+
+func up(t testing.TB, m *migrate.Migrate) {
+	t.Helper()
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		if _, errClose := m.Close(); errClose != nil {
+			t.Error(errClose)
+		}
+		t.Fatal(err)
+	}
+}
+
+// AssertVersion fails the test unless the database of m is at version
+// and not dirty.
+func AssertVersion(t testing.TB, m *migrate.Migrate, version uint) {
+	t.Helper()
+	v, dirty, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != version || dirty {
+		t.Errorf("expected clean version %v, got %v (dirty: %v)", version, v, dirty)
+	}
+}
+
+// AssertGolden fails the test unless the rows returned by query on the
+// database at databaseURL match the golden file, which holds one JSON object
+// per row. With EnvUpdateGolden set, the golden file is written instead.
+// The database driver must implement database.Querier.
+func AssertGolden(t testing.TB, databaseURL, query, golden string) {
+	t.Helper()
+	d, err := database.Open(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	querier, ok := d.(database.Querier)
+	if !ok {
+		t.Fatalf("database driver %T can't run queries", d)
+	}
+	rows, err := querier.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	for _, row := range rows {
+		// maps are encoded with sorted keys
+		b, err := json.Marshal(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.Write(b)
+		got.WriteByte('\n')
+	}
+
+	if os.Getenv(EnvUpdateGolden) != "" {
+		if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v, set %v to write it", err, EnvUpdateGolden)
+	}
+	if !bytes.Equal(got.Bytes(), expected) {
+		t.Errorf("rows of %q don't match %v:\nexpected:\n%s\ngot:\n%s", query, golden, expected, got.Bytes())
+	}
+}
@@ -0,0 +1,82 @@
+package migratetest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+func TestHelpers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migratetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"1_users.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);",
+		"1_users.down.sql": "DROP TABLE users;",
+		"2_ann.up.sql":     "INSERT INTO users (name) VALUES ('ann');",
+		"2_ann.down.sql":   "DELETE FROM users;",
+	}
+	if err := os.Mkdir(filepath.Join(dir, "migrations"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, "migrations", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer os.Unsetenv(EnvDatabaseURL)
+	defer os.Unsetenv(EnvUpdateGolden)
+	if err := os.Setenv(EnvDatabaseURL, "sqlite3://"+filepath.Join(dir, "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	databaseURL := FreshDB(t)
+	m := ApplyAll(t, "file://"+filepath.Join(dir, "migrations"), databaseURL)
+	AssertVersion(t, m, 2)
+	if _, err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join(dir, "users.golden")
+	if err := os.Setenv(EnvUpdateGolden, "1"); err != nil {
+		t.Fatal(err)
+	}
+	AssertGolden(t, databaseURL, "SELECT * FROM users", golden)
+	b, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{\"id\":1,\"name\":\"ann\"}\n"; string(b) != expected {
+		t.Errorf("expected golden file %q, got %q", expected, b)
+	}
+	if err := os.Unsetenv(EnvUpdateGolden); err != nil {
+		t.Fatal(err)
+	}
+	AssertGolden(t, databaseURL, "SELECT * FROM users", golden)
+
+	// a fresh database is empty again
+	databaseURL = FreshDB(t)
+	m = ApplyAllFS(t, http.Dir(dir), "migrations", databaseURL)
+	defer m.Close()
+	AssertVersion(t, m, 2)
+}
+
+func TestFreshDBSkips(t *testing.T) {
+	if os.Getenv(EnvDatabaseURL) != "" {
+		t.Skipf("%v is set", EnvDatabaseURL)
+	}
+	skipped := t.Run("fresh", func(t *testing.T) {
+		FreshDB(t)
+		t.Error("expected FreshDB to skip the test")
+	})
+	if !skipped {
+		t.Error("expected skipped test to pass")
+	}
+}
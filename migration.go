@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
 )
 
 // DefaultBufferSize sets the in memory buffer size (in Bytes) for every
@@ -33,6 +35,10 @@ type Migration struct {
 	// BufferedBody holds an buffered io.Reader to the underlying Body.
 	BufferedBody io.Reader
 
+	// Size is the size hint of Body in bytes, as stored in the source,
+	// see source.Size. It is -1 if the source doesn't know it.
+	Size int64
+
 	// BufferSize defaults to DefaultBufferSize
 	BufferSize uint
 
@@ -40,6 +46,20 @@ type Migration struct {
 	// It's an *Closer for flow control.
 	bufferWriter io.WriteCloser
 
+	// buffered, if set, is closed once Buffer pre-read BufferSize bytes
+	// or failed to, see prefetcher.
+	buffered chan struct{}
+
+	// checksum returns the checksum of the body as read from the source,
+	// see checksumReader. It is nil if the migration wasn't read from the
+	// source.
+	checksum func() string
+
+	// late is set for a skipped up migration which is applied after the
+	// version moved past it, see Migrate.ApplySkipped. TargetVersion is the
+	// current version then, which the migration doesn't change.
+	late bool
+
 	// Scheduled is the time when the migration was scheduled/ queued.
 	Scheduled time.Time
 
@@ -96,6 +116,7 @@ func NewMigration(body io.ReadCloser, identifier string,
 
 	br, bw := io.Pipe()
 	m.Body = body // want to simulate low latency? newSlowReader(body)
+	m.Size = source.Size(body)
 	m.BufferSize = DefaultBufferSize
 	m.BufferedBody = br
 	m.bufferWriter = bw
@@ -110,16 +131,22 @@ func (m *Migration) String() string {
 // LogString returns a string describing this migration to humans.
 func (m *Migration) LogString() string {
 	directionStr := "u"
-	if m.TargetVersion < int(m.Version) {
+	if m.down() {
 		directionStr = "d"
 	}
 	return fmt.Sprintf("%v/%v %v", m.Version, directionStr, m.Identifier)
 }
 
+// down returns true for a down migration, which migrates below its version.
+func (m *Migration) down() bool {
+	return m.TargetVersion < int(m.Version) && !m.late
+}
+
 // Buffer buffers Body up to BufferSize.
 // Calling this function blocks. Call with goroutine.
 func (m *Migration) Buffer() error {
 	if m.Body == nil {
+		m.finishBuffering()
 		return nil
 	}
 
@@ -130,10 +157,12 @@ func (m *Migration) Buffer() error {
 	// start reading from body, peek won't move the read pointer though
 	// poor man's solution?
 	if _, err := b.Peek(int(m.BufferSize)); err != nil && err != io.EOF {
+		m.finishBuffering()
 		return err
 	}
 
 	m.FinishedBuffering = time.Now()
+	m.finishBuffering()
 
 	// write to bufferWriter, this will block until
 	// something starts reading from m.Buffer
@@ -158,3 +187,9 @@ func (m *Migration) Buffer() error {
 
 	return nil
 }
+
+func (m *Migration) finishBuffering() {
+	if m.buffered != nil {
+		close(m.buffered)
+	}
+}
@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// maxSequentialVersion is the highest version of a sequentially numbered
+// source, sources with higher versions use timestamps or another scheme
+// whose versions aren't expected to be consecutive.
+const maxSequentialVersion = 999999999
+
+// ErrGap is returned with StrictOrder if versions are missing between two
+// migrations of a sequentially numbered source, e.g. a lost or renamed file.
+type ErrGap struct {
+	After  uint
+	Before uint
+}
+
+func (e ErrGap) Error() string {
+	if e.Before-e.After == 2 {
+		return fmt.Sprintf("version %v is missing between %v and %v", e.After+1, e.After, e.Before)
+	}
+	return fmt.Sprintf("versions %v to %v are missing between %v and %v", e.After+1, e.Before-1, e.After, e.Before)
+}
+
+// ErrOutOfOrder is returned with StrictOrder for a migration below the
+// current version of the database which was never applied, e.g. one merged
+// after later migrations were applied already.
+type ErrOutOfOrder struct {
+	Version uint
+	Current int
+}
+
+func (e ErrOutOfOrder) Error() string {
+	return fmt.Sprintf("migration %v is pending below the current version %v", e.Version, e.Current)
+}
+
+// checkOrder returns ErrGap or ErrOutOfOrder with StrictOrder. Migrations
+// below the current version count as applied unless the history table,
+// if any, tells otherwise.
+func (m *Migrate) checkOrder(curVersion int) error {
+	if !m.StrictOrder {
+		return nil
+	}
+
+	var versions []uint
+	v, err := m.sourceDrv.First()
+	for err == nil {
+		versions = append(versions, v)
+		v, err = m.sourceDrv.Next(v)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	if versions[len(versions)-1] <= maxSequentialVersion {
+		for i := 1; i < len(versions); i++ {
+			// versions in dependency order may go back
+			if prev := versions[i-1]; versions[i] > prev+1 {
+				return ErrGap{After: prev, Before: versions[i]}
+			}
+		}
+	}
+
+	if m.HistoryTable == "" || curVersion == database.NilVersion {
+		return nil
+	}
+	records, err := m.History()
+	if err != nil {
+		// e.g. the table doesn't exist yet, as -history was just turned on
+		m.logVerbosePrintf("Not checking for migrations out of order, the history can't be read: %v\n", err)
+		return nil
+	}
+	if v, ok := unappliedBelow(versions, records, curVersion); ok {
+		return ErrOutOfOrder{Version: v, Current: curVersion}
+	}
+	return nil
+}
+
+// unappliedBelow returns the first of versions up to curVersion without a
+// record. Versions below the first recorded one were applied before the
+// history was recorded.
+func unappliedBelow(versions []uint, records []database.HistoryRecord, curVersion int) (uint, bool) {
+	if len(records) == 0 {
+		return 0, false
+	}
+	recorded := make(map[uint]bool, len(records))
+	first := records[0].Version
+	for _, r := range records {
+		recorded[r.Version] = true
+		if r.Version < first {
+			first = r.Version
+		}
+	}
+	for _, v := range versions {
+		if v >= first && int(v) <= curVersion && !recorded[v] {
+			return v, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestStrictOrder(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.StrictOrder = true
+
+	if err := m.Up(); err != (ErrGap{After: 1, Before: 3}) {
+		t.Fatalf("expected ErrGap, got %v", err)
+	}
+	if err := m.Migrate(4); err != (ErrGap{After: 1, Before: 3}) {
+		t.Fatalf("expected ErrGap, got %v", err)
+	}
+	if v, _, err := m.Version(); err != ErrNilVersion {
+		t.Fatalf("expected no version, got %v, %v", v, err)
+	}
+
+	m.StrictOrder = false
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErrGap(t *testing.T) {
+	if err := (ErrGap{After: 1, Before: 3}); err.Error() != "version 2 is missing between 1 and 3" {
+		t.Errorf("unexpected error %q", err)
+	}
+	if err := (ErrGap{After: 4, Before: 7}); err.Error() != "versions 5 to 6 are missing between 4 and 7" {
+		t.Errorf("unexpected error %q", err)
+	}
+}
+
+func TestUnappliedBelow(t *testing.T) {
+	versions := []uint{1, 2, 3, 4, 5, 6}
+	records := []database.HistoryRecord{
+		{Version: 3, Direction: "up"},
+		{Version: 5, Direction: "up"},
+		{Version: 6, Direction: "up"},
+	}
+	// 1 and 2 were applied before the history, 4 was merged late
+	if v, ok := unappliedBelow(versions, records, 6); !ok || v != 4 {
+		t.Errorf("expected 4 unapplied, got %v, %v", v, ok)
+	}
+	if v, ok := unappliedBelow(versions, records, 3); ok {
+		t.Errorf("expected none unapplied below 3, got %v", v)
+	}
+	if v, ok := unappliedBelow(versions, nil, 6); ok {
+		t.Errorf("expected none unapplied without history, got %v", v)
+	}
+}
@@ -0,0 +1,111 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang-migrate/migrate/v4/database/multistmt"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// writePlan writes the migrations received on ret to Plan instead of
+// running them, see Plan. Every migration is headed by a comment, e.g.
+// `-- 2/u add_users`, followed by its statements.
+func (m *Migrate) writePlan(ret <-chan interface{}) error {
+	for r := range ret {
+		switch r := r.(type) {
+		case error:
+			return r
+
+		case *Migration:
+			if err := m.writePlanMigration(r); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown type: %T with value: %+v", r, r)
+		}
+	}
+	return nil
+}
+
+func (m *Migrate) writePlanMigration(migr *Migration) error {
+	if _, err := fmt.Fprintf(m.Plan, "-- %v\n", migr.LogString()); err != nil {
+		return err
+	}
+	if migr.Body == nil {
+		_, err := fmt.Fprint(m.Plan, "-- no migration, only sets the version\n\n")
+		return err
+	}
+	body, err := ioutil.ReadAll(migr.BufferedBody)
+	if err != nil {
+		return err
+	}
+	pragmas := pragma.Parse(body)
+	run, err := m.shouldRun(pragmas)
+	if err != nil {
+		return err
+	}
+	var comment string
+	switch {
+	case !run:
+		comment = "skipped, its condition isn't met"
+	case pragmas.Has(pragma.Exec):
+		command, _ := pragmas.Get(pragma.Exec)
+		comment = "runs command " + command + ", not SQL"
+	case isWasm(body):
+		comment = "runs WebAssembly, not SQL"
+	case pragmas.Has(pragma.Starlark):
+		comment = "runs a Starlark script, not SQL"
+	case pragmas.Has(pragma.Load):
+		spec, _ := pragmas.Get(pragma.Load)
+		if m.planSQLOnly {
+			return fmt.Errorf("%v loads data into %v, not SQL", migr.LogString(), spec)
+		}
+		_, err := fmt.Fprintf(m.Plan, "-- loads data into %v, only inserts rows\n\n", spec)
+		return err
+	case pragmas.Has(pragma.Backfill):
+		spec, _ := pragmas.Get(pragma.Backfill)
+		if m.planSQLOnly {
+			return fmt.Errorf("%v backfills in batches, not SQL", migr.LogString())
+		}
+		stmt, err := ioutil.ReadAll(pragma.Body(bytes.NewReader(body)))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(m.Plan, "-- backfills in batches (%v)\n%s;\n\n", spec, bytes.TrimRight(bytes.TrimSpace(stmt), ";"))
+		return err
+	}
+	if comment != "" {
+		if run && m.planSQLOnly {
+			return fmt.Errorf("%v %v", migr.LogString(), comment)
+		}
+		_, err := fmt.Fprintf(m.Plan, "-- %v\n\n", comment)
+		return err
+	}
+
+	if pragmas.Has(pragma.Template) {
+		rendered, err := m.render(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if body, err = ioutil.ReadAll(rendered); err != nil {
+			return err
+		}
+	}
+	delimiter := multistmt.Delimiter(body, multistmt.DefaultDelimiter)
+	split := multistmt.Split
+	if source.DialectOf(m.databaseName) == "mysql" {
+		split = multistmt.SplitMySQL
+	}
+	for _, stmt := range split(body, delimiter) {
+		if _, err := fmt.Fprintf(m.Plan, "%s%s\n", stmt, delimiter); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(m.Plan, "\n")
+	return err
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"bytes"
+	"testing"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestPlan(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1; INSERT 1;"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up,
+		Identifier: "-- migrate:if env == \"staging\"\nCREATE 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Up,
+		Identifier: "-- migrate:delimiter $$\nCREATE FUNCTION f() BEGIN; END$$\nCREATE 4$$"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan bytes.Buffer
+	m.Plan = &plan
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `-- 1/u 1.up.stub
+CREATE 1;
+INSERT 1;
+
+-- 2/u 2.up.stub
+-- skipped, its condition isn't met
+
+-- 3/u <empty>
+-- no migration, only sets the version
+
+-- 4/u 4.up.stub
+-- migrate:delimiter $$
+CREATE FUNCTION f() BEGIN; END$$
+CREATE 4$$
+
+`
+	if plan.String() != expected {
+		t.Errorf("expected plan\n%v\ngot\n%v", expected, plan.String())
+	}
+	if _, _, err := m.Version(); err != ErrNilVersion {
+		t.Errorf("expected no version after writing the plan, got %v", err)
+	}
+	if len(dbDrv.(*dStub.Stub).MigrationSequence) != 0 {
+		t.Errorf("expected no migrations run, got %v", dbDrv.(*dStub.Stub).MigrationSequence)
+	}
+}
+
+func TestPlanNotSQL(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up,
+		Identifier: "-- migrate:backfill table=users batch=100\nUPDATE users SET email = lower(email) WHERE {batch};\n"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up,
+		Identifier: "-- migrate:load countries\ncode,name\nde,Germany\n"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up,
+		Identifier: "-- migrate:exec ./export.sh\n"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan bytes.Buffer
+	m.Plan = &plan
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `-- 1/u 1.up.stub
+-- backfills in batches (table=users batch=100)
+UPDATE users SET email = lower(email) WHERE {batch};
+
+-- 2/u 2.up.stub
+-- loads data into countries, only inserts rows
+
+-- 3/u 3.up.stub
+-- runs command ./export.sh, not SQL
+
+`
+	if plan.String() != expected {
+		t.Errorf("expected plan\n%v\ngot\n%v", expected, plan.String())
+	}
+}
@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"sync/atomic"
+)
+
+// DefaultPrefetchWorkers sets the number of migrations opened and
+// pre-read from the source at the same time, see DefaultPrefetchMigrations.
+// Downloading several migrations of a remote source at once hides the
+// latency of each request.
+var DefaultPrefetchWorkers = uint(4)
+
+// prefetcher opens and buffers up to PrefetchWorkers migrations at the
+// same time, while the migrations, and errors, are sent to ret in the
+// order they were added. Closing done stops it, see stopReading.
+type prefetcher struct {
+	m    *Migrate
+	done <-chan struct{}
+
+	// workers holds a token per migration being opened or buffered
+	workers chan struct{}
+
+	// queue holds the pending results, a *Migration or an error each,
+	// up to PrefetchMigrations of them
+	queue chan chan interface{}
+
+	// failed is set once a migration couldn't be opened
+	failed int32
+}
+
+// prefetch returns a prefetcher sending to ret. Close it to close ret.
+func (m *Migrate) prefetch(ret chan<- interface{}, done <-chan struct{}) *prefetcher {
+	workers := m.PrefetchWorkers
+	if workers == 0 {
+		workers = 1
+	}
+	p := &prefetcher{
+		m:       m,
+		done:    done,
+		workers: make(chan struct{}, workers),
+		queue:   make(chan chan interface{}, m.PrefetchMigrations),
+	}
+	go p.forward(ret)
+	return p
+}
+
+// forward sends the results to ret in order. Nothing is sent after an
+// error, as running migrations stops there.
+func (p *prefetcher) forward(ret chan<- interface{}) {
+	defer close(ret)
+	failed := false
+	for result := range p.queue {
+		r := <-result
+		if failed {
+			continue
+		}
+		if _, ok := r.(error); ok {
+			failed = true
+		}
+		ret <- r
+	}
+}
+
+// add opens the migration of version to targetVersion and starts buffering
+// it, once a worker is free. It returns false if an earlier migration
+// couldn't be opened, so there is no point in adding more, or if the
+// prefetcher was stopped.
+func (p *prefetcher) add(version uint, targetVersion int) bool {
+	if atomic.LoadInt32(&p.failed) != 0 {
+		return false
+	}
+	select {
+	case p.workers <- struct{}{}:
+	case <-p.done:
+		return false
+	}
+	result := make(chan interface{}, 1)
+	select {
+	case p.queue <- result:
+	case <-p.done:
+		<-p.workers
+		return false
+	}
+	go func() {
+		migr, err := p.m.newMigration(version, targetVersion)
+		if err != nil {
+			atomic.StoreInt32(&p.failed, 1)
+			<-p.workers
+			result <- err
+			return
+		}
+		buffered := make(chan struct{})
+		migr.buffered = buffered
+		result <- migr
+		go func() {
+			if err := migr.Buffer(); err != nil {
+				p.m.logErr(err)
+			}
+		}()
+		// the worker is free once the migration is pre-read, the rest
+		// is read while it runs
+		<-buffered
+		<-p.workers
+	}()
+	return true
+}
+
+// send sends r after the migrations added so far.
+func (p *prefetcher) send(r interface{}) {
+	result := make(chan interface{}, 1)
+	result <- r
+	select {
+	case p.queue <- result:
+	case <-p.done:
+	}
+}
+
+// close closes ret once the results added so far are sent.
+func (p *prefetcher) close() {
+	close(p.queue)
+}
+
+// stopReading stops reading the migrations sent to ret by closing done,
+// e.g. after a migration failed, and waits until the source isn't read
+// anymore.
+func stopReading(ret <-chan interface{}, done chan<- struct{}) {
+	close(done)
+	for range ret {
+	}
+}
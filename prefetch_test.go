@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+// slowSource is a source whose ReadUp takes a while, like a request to a
+// remote source, and which records how many of them were in progress at
+// once.
+type slowSource struct {
+	*sStub.Stub
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (s *slowSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	s.mu.Lock()
+	s.current++
+	if s.current > s.max {
+		s.max = s.current
+	}
+	s.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	s.mu.Lock()
+	s.current--
+	s.mu.Unlock()
+	return s.Stub.ReadUp(version)
+}
+
+func TestPrefetchWorkers(t *testing.T) {
+	migrations := source.NewMigrations()
+	for v := uint(1); v <= 8; v++ {
+		migrations.Append(&source.Migration{Version: v, Direction: source.Up, Identifier: fmt.Sprintf("CREATE %v", v)})
+	}
+
+	for _, workers := range []uint{1, 4} {
+		srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+		srcDrv.(*sStub.Stub).Migrations = migrations
+		src := &slowSource{Stub: srcDrv.(*sStub.Stub)}
+		dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+		m, err := NewWithInstance("stub", src, "stub", dbDrv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.PrefetchWorkers = workers
+
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+		equalDbSeq(t, int(workers), migrationSequence{
+			mr("CREATE 1"), mr("CREATE 2"), mr("CREATE 3"), mr("CREATE 4"),
+			mr("CREATE 5"), mr("CREATE 6"), mr("CREATE 7"), mr("CREATE 8"),
+		}, dbDrv.(*dStub.Stub))
+		if src.max > int(workers) || workers > 1 && src.max < 2 {
+			t.Errorf("expected up to %v migrations opened at once, got %v", workers, src.max)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment variables and returns a function restoring them
+func setenv(t *testing.T, env map[string]string) func() {
+	old := make(map[string]*string)
+	for k, v := range env {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	defer Set("")
+	for _, url := range []string{"https://proxy:3128", "socks5://", "proxy:1080"} {
+		if err := Set(url); err == nil {
+			t.Errorf("Set(%q): expected error", url)
+		}
+	}
+	if Enabled() {
+		t.Fatal("expected no proxy after failed Set")
+	}
+	if err := Set("socks5h://proxy:1080"); err != nil {
+		t.Fatal(err)
+	}
+	if !Enabled() {
+		t.Fatal("expected proxy")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	defer setenv(t, map[string]string{
+		"HTTP_PROXY": "", "http_proxy": "", "HTTPS_PROXY": "", "https_proxy": "", "all_proxy": "",
+		"ALL_PROXY": "socks5://proxy:1080",
+		"NO_PROXY":  "internal.example",
+	})()
+
+	cases := map[string]string{
+		"https://api.github.com/repos":   "socks5://proxy:1080",
+		"http://bucket.s3.amazonaws.com": "socks5://proxy:1080",
+		"https://internal.example/m":     "",
+	}
+	for url, expected := range cases {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := HTTP(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (u == nil && expected != "") || (u != nil && u.String() != expected) {
+			t.Errorf("%v: expected proxy %q, got %v", url, expected, u)
+		}
+	}
+
+	defer Set("")
+	if err := Set("http://corp:3128"); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/repos", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := HTTP(req); err != nil || u.String() != "http://corp:3128" {
+		t.Fatalf("expected the explicit proxy, got %v, %v", u, err)
+	}
+}
+
+func TestDialHTTP(t *testing.T) {
+	defer setenv(t, map[string]string{"NO_PROXY": "", "no_proxy": ""})()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			errs <- err
+			return
+		}
+		if req.Method != http.MethodConnect || req.Host != "db.example:3306" {
+			errs <- fmt.Errorf("unexpected request %v %v", req.Method, req.Host)
+			return
+		}
+		if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+			errs <- fmt.Errorf("unexpected Proxy-Authorization %q", req.Header.Get("Proxy-Authorization"))
+			return
+		}
+		// answer and send a server greeting in one write
+		_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\ngreeting"))
+		errs <- err
+	}()
+
+	defer Set("")
+	if err := Set("http://user:secret@" + l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := DialContext(ctx, "tcp", "db.example:3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	greeting, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(greeting) != "greeting" {
+		t.Fatalf("expected greeting, got %q", greeting)
+	}
+}
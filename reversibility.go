@@ -0,0 +1,214 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// ErrDatabaseNotEmpty is returned by CheckReversibility if migrations
+// were already applied to the database.
+var ErrDatabaseNotEmpty = errors.New("database isn't empty, checking reversibility needs a scratch database")
+
+// Problems found by CheckReversibility.
+const (
+	// NoDownMigration means a migration can't be reverted.
+	NoDownMigration = "no down migration"
+	// DownFailed means the down migration failed right after the up migration.
+	DownFailed = "down migration failed"
+	// UpFailedAfterDown means the down migration doesn't revert everything
+	// the up migration did, so applying it again failed.
+	UpFailedAfterDown = "up migration failed after down migration"
+	// OrderDependent means a migration failed when reverting all migrations
+	// and applying them again, after each one could be reverted on its own.
+	OrderDependent = "order dependent"
+	// LeftoverObjects means tables were left after Reset reverted all
+	// migrations. The version is that of the first migration.
+	LeftoverObjects = "tables left after reverting all migrations"
+)
+
+// ErrNoDown is returned with RequireDown for a migration without down
+// migration, or with an empty one.
+type ErrNoDown struct {
+	Version uint
+	Empty   bool
+}
+
+func (e ErrNoDown) Error() string {
+	if e.Empty {
+		return fmt.Sprintf("the down migration of %v is empty", e.Version)
+	}
+	return fmt.Sprintf("migration %v has no down migration", e.Version)
+}
+
+// checkDowns returns ErrNoDown with RequireDown for the first of the
+// migrations pending from curVersion on, up to the one last returns true
+// for, given the version and its index, or all with last nil, which has no
+// down migration or an empty one.
+func (m *Migrate) checkDowns(curVersion int, last func(version uint, i int) bool) error {
+	if !m.RequireDown {
+		return nil
+	}
+	pending, err := m.pendingFrom(curVersion)
+	if err != nil {
+		return err
+	}
+	for i, v := range pending {
+		r, _, err := m.readDownBody(v)
+		if os.IsNotExist(err) {
+			return ErrNoDown{Version: v}
+		} else if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			return ErrNoDown{Version: v, Empty: true}
+		}
+		if last != nil && last(v, i) {
+			break
+		}
+	}
+	return nil
+}
+
+// ReversibilityProblem is a problem of a migration found by CheckReversibility.
+type ReversibilityProblem struct {
+	Version uint
+	Problem string
+	Err     error
+}
+
+func (p ReversibilityProblem) String() string {
+	if p.Err == nil {
+		return fmt.Sprintf("%v: %v", p.Version, p.Problem)
+	}
+	return fmt.Sprintf("%v: %v: %v", p.Version, p.Problem, p.Err)
+}
+
+// CheckReversibility applies every migration to an empty scratch database,
+// reverts it and applies it again. Afterwards, it reverts all migrations and
+// applies them again, unless problems were found already. A failed migration
+// leaves the database dirty and stops the check. Errors unrelated to the
+// reversibility of migrations, e.g. a failing up migration, are returned as
+// error.
+func (m *Migrate) CheckReversibility() ([]ReversibilityProblem, error) {
+	if _, _, err := m.Version(); err == nil {
+		return nil, ErrDatabaseNotEmpty
+	} else if err != ErrNilVersion {
+		return nil, err
+	}
+
+	problems := make([]ReversibilityProblem, 0)
+	for {
+		if err := m.Steps(1); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return problems, err
+		}
+		version, _, err := m.Version()
+		if err != nil {
+			return problems, err
+		}
+
+		r, _, err := m.sourceDrv.ReadDown(version)
+		if os.IsNotExist(err) {
+			problems = append(problems, ReversibilityProblem{Version: version, Problem: NoDownMigration})
+			continue
+		} else if err != nil {
+			return problems, err
+		}
+		r.Close()
+
+		if err := m.Steps(-1); err != nil {
+			return append(problems, ReversibilityProblem{Version: version, Problem: DownFailed, Err: err}), nil
+		}
+		if err := m.Steps(1); err != nil {
+			return append(problems, ReversibilityProblem{Version: version, Problem: UpFailedAfterDown, Err: err}), nil
+		}
+	}
+	if len(problems) > 0 {
+		return problems, nil
+	}
+
+	for _, run := range []func() error{m.Down, m.Up} {
+		if err := run(); err != nil && err != ErrNoChange {
+			version, _, _ := m.Version()
+			return append(problems, ReversibilityProblem{Version: version, Problem: OrderDependent, Err: err}), nil
+		}
+	}
+	return problems, nil
+}
+
+// Reset reverts all migrations one by one and applies them again, to check
+// locally that the migrations applied to a database are reversible.
+// Migrations without down migration are reported as NoDownMigration. If the
+// database driver implements database.Introspector, the database must be
+// empty after reverting all migrations, tables left are reported as
+// LeftoverObjects. Errors of migrations are returned as error.
+func (m *Migrate) Reset() ([]ReversibilityProblem, error) {
+	problems := make([]ReversibilityProblem, 0)
+	reverted := false
+	var first uint
+	for {
+		version, _, err := m.Version()
+		if err == ErrNilVersion {
+			break
+		} else if err != nil {
+			return problems, err
+		}
+
+		r, _, err := m.sourceDrv.ReadDown(version)
+		if os.IsNotExist(err) {
+			problems = append(problems, ReversibilityProblem{Version: version, Problem: NoDownMigration})
+		} else if err != nil {
+			return problems, err
+		} else {
+			r.Close()
+		}
+
+		if err := m.Steps(-1); err != nil {
+			return problems, err
+		}
+		reverted, first = true, version
+	}
+
+	if _, ok := m.databaseDrv.(database.Introspector); ok && reverted {
+		objects, err := m.schema()
+		if err != nil {
+			return problems, err
+		}
+		if tables := tableNames(objects); len(tables) > 0 {
+			problems = append(problems, ReversibilityProblem{Version: first, Problem: LeftoverObjects,
+				Err: errors.New(strings.Join(tables, ", "))})
+		}
+	}
+
+	if err := m.Up(); err != nil && err != ErrNoChange {
+		return problems, err
+	}
+	return problems, nil
+}
+
+// tableNames returns the sorted tables of objects.
+func tableNames(objects []database.SchemaObject) []string {
+	seen := make(map[string]bool)
+	tables := make([]string, 0)
+	for _, o := range objects {
+		if !seen[o.Table] {
+			seen[o.Table] = true
+			tables = append(tables, o.Table)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
@@ -0,0 +1,156 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+// failStub is a stub database failing a migration
+// after it succeeded the given number of times
+type failStub struct {
+	*dStub.Stub
+	failAfter map[string]int
+	// history are the queries on the history table, which aren't migrations
+	history []string
+}
+
+func (f *failStub) Run(migration io.Reader) error {
+	body, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(body, []byte(database.DefaultHistoryTable)) {
+		f.history = append(f.history, string(body))
+		return nil
+	}
+	if n, ok := f.failAfter[string(body)]; ok {
+		if n == 0 {
+			return errors.New("failed " + string(body))
+		}
+		f.failAfter[string(body)] = n - 1
+	}
+	return f.Stub.Run(bytes.NewReader(body))
+}
+
+func TestCheckReversibility(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+
+	cases := []struct {
+		name      string
+		noDown    uint
+		failAfter map[string]int
+		expected  []ReversibilityProblem
+		sequence  []string
+	}{
+		{name: "reversible", sequence: []string{
+			"CREATE 1", "DROP 1", "CREATE 1", "CREATE 2", "DROP 2", "CREATE 2", "CREATE 3", "DROP 3", "CREATE 3",
+			"DROP 3", "DROP 2", "DROP 1", "CREATE 1", "CREATE 2", "CREATE 3"}},
+		{name: "no down", noDown: 2, expected: []ReversibilityProblem{{Version: 2, Problem: NoDownMigration}},
+			sequence: []string{"CREATE 1", "DROP 1", "CREATE 1", "CREATE 2", "CREATE 3", "DROP 3", "CREATE 3"}},
+		{name: "down failed", failAfter: map[string]int{"DROP 2": 0},
+			expected: []ReversibilityProblem{{Version: 2, Problem: DownFailed}},
+			sequence: []string{"CREATE 1", "DROP 1", "CREATE 1", "CREATE 2"}},
+		{name: "up failed after down", failAfter: map[string]int{"CREATE 2": 1},
+			expected: []ReversibilityProblem{{Version: 2, Problem: UpFailedAfterDown}},
+			sequence: []string{"CREATE 1", "DROP 1", "CREATE 1", "CREATE 2", "DROP 2"}},
+		{name: "order dependent", failAfter: map[string]int{"CREATE 1": 2},
+			expected: []ReversibilityProblem{{Version: 1, Problem: OrderDependent}},
+			sequence: []string{
+				"CREATE 1", "DROP 1", "CREATE 1", "CREATE 2", "DROP 2", "CREATE 2", "CREATE 3", "DROP 3", "CREATE 3",
+				"DROP 3", "DROP 2", "DROP 1"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+			srcMigrations := source.NewMigrations()
+			for _, v := range []uint{1, 2, 3} {
+				up, _ := migrations.Up(v)
+				srcMigrations.Append(up)
+				if v != c.noDown {
+					down, _ := migrations.Down(v)
+					srcMigrations.Append(down)
+				}
+			}
+			srcDrv.(*sStub.Stub).Migrations = srcMigrations
+			dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+			db := &failStub{Stub: dbDrv.(*dStub.Stub), failAfter: c.failAfter}
+
+			m, err := NewWithInstance("stub", srcDrv, "stub", db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			problems, err := m.CheckReversibility()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range problems {
+				problems[i].Err = nil
+			}
+			if len(c.expected) == 0 {
+				c.expected = []ReversibilityProblem{}
+			}
+			if !reflect.DeepEqual(problems, c.expected) {
+				t.Errorf("expected problems %v, got %v", c.expected, problems)
+			}
+			if !reflect.DeepEqual(db.MigrationSequence, c.sequence) {
+				t.Errorf("expected sequence %v, got %v", c.sequence, db.MigrationSequence)
+			}
+
+			if _, err := m.CheckReversibility(); err != ErrDatabaseNotEmpty {
+				t.Errorf("expected ErrDatabaseNotEmpty, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRequireDown(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.RequireDown = true
+
+	if err := m.Up(); err != (ErrNoDown{Version: 3}) {
+		t.Fatalf("expected ErrNoDown, got %v", err)
+	}
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(2); err != (ErrNoDown{Version: 3}) {
+		t.Fatalf("expected ErrNoDown, got %v", err)
+	}
+	if err := m.Migrate(3); err != (ErrNoDown{Version: 3}) {
+		t.Fatalf("expected ErrNoDown, got %v", err)
+	}
+	if v, _, err := m.Version(); err != nil || v != 1 {
+		t.Fatalf("expected version 1, got %v, %v", v, err)
+	}
+
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: " \n"})
+	m, _ = New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.RequireDown = true
+	if err := m.Up(); err != (ErrNoDown{Version: 2, Empty: true}) {
+		t.Fatalf("expected ErrNoDown, got %v", err)
+	}
+	if err := m.Migrate(1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,36 @@
+package migrate
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// ErrNoScriptRuntime is returned when running a migration with the
+// `starlark` pragma while Migrate.Scripts isn't set.
+var ErrNoScriptRuntime = errors.New("migration is a script, but no script runtime is set")
+
+// ErrQueryUnsupported is returned when running a script migration
+// with a database driver not implementing database.Querier.
+var ErrQueryUnsupported = errors.New("database driver can't run script migrations")
+
+// ScriptRuntime runs migrations with the `starlark` pragma.
+// Package script implements it with an embedded Starlark interpreter.
+type ScriptRuntime interface {
+	// Run runs script, which is named name in error messages,
+	// against db. Messages of the script are logged with log.
+	Run(name string, script []byte, db database.Querier, log func(msg string)) error
+}
+
+// runScript runs a migration with the `starlark` pragma.
+func (m *Migrate) runScript(migr *Migration, body io.Reader) error {
+	script, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return m.Scripts.Run(migr.LogString(), script, m.databaseDrv.(database.Querier), func(msg string) {
+		m.logPrintf("%v: %v\n", migr.LogString(), msg)
+	})
+}
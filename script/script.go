@@ -0,0 +1,203 @@
+// Package script runs migrations written in Starlark (https://github.com/bazelbuild/starlark),
+// a dialect of Python, see migrate.Migrate.Scripts. Scripts have no access to the
+// file system or network, only to the database through the predeclared module db:
+//
+//	db.query(sql, *args)     returns the rows of a query as list of dicts
+//	db.exec(sql, *args)      runs a statement, returns the number of affected rows
+//	db.exec_many(sql, rows)  runs a statement once per tuple of arguments in rows,
+//	                         returns the number of affected rows
+//
+// print logs a message, fail aborts the migration.
+package script
+
+import (
+	"fmt"
+	"time"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+func init() {
+	// Scripts are top-level code, so allow loops and conditions outside of
+	// functions. while and recursion stay disabled, loops are bounded.
+	resolve.AllowGlobalReassign = true
+	resolve.AllowFloat = true
+	resolve.AllowLambda = true
+	resolve.AllowNestedDef = true
+	resolve.AllowSet = true
+}
+
+// Runtime implements migrate.ScriptRuntime.
+type Runtime struct{}
+
+// New returns a Runtime.
+func New() *Runtime {
+	return &Runtime{}
+}
+
+func (r *Runtime) Run(name string, script []byte, db database.Querier, log func(msg string)) error {
+	thread := &starlark.Thread{
+		Name:  name,
+		Print: func(_ *starlark.Thread, msg string) { log(msg) },
+	}
+	module := &starlarkstruct.Module{
+		Name: "db",
+		Members: starlark.StringDict{
+			"query":     starlark.NewBuiltin("query", query(db)),
+			"exec":      starlark.NewBuiltin("exec", exec(db)),
+			"exec_many": starlark.NewBuiltin("exec_many", execMany(db)),
+		},
+	}
+	_, err := starlark.ExecFile(thread, name, script, starlark.StringDict{"db": module})
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%v", evalErr.Backtrace())
+	}
+	return err
+}
+
+type builtin func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error)
+
+func query(db database.Querier) builtin {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		sql, sqlArgs, err := unpackStatement(b, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := db.Query(sql, sqlArgs...)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]starlark.Value, 0, len(rows))
+		for _, row := range rows {
+			dict := starlark.NewDict(len(row))
+			for column, value := range row {
+				if err := dict.SetKey(starlark.String(column), toStarlark(value)); err != nil {
+					return nil, err
+				}
+			}
+			list = append(list, dict)
+		}
+		return starlark.NewList(list), nil
+	}
+}
+
+func exec(db database.Querier) builtin {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		sql, sqlArgs, err := unpackStatement(b, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		affected, err := db.Exec(sql, sqlArgs...)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.MakeInt64(affected), nil
+	}
+}
+
+func execMany(db database.Querier) builtin {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var sql string
+		var rows starlark.Iterable
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &sql, &rows); err != nil {
+			return nil, err
+		}
+		var total int64
+		iter := rows.Iterate()
+		defer iter.Done()
+		var row starlark.Value
+		for iter.Next(&row) {
+			tuple, ok := row.(starlark.Indexable)
+			if !ok {
+				return nil, fmt.Errorf("%v: got %v, want tuple or list of arguments", b.Name(), row.Type())
+			}
+			sqlArgs := make([]interface{}, tuple.Len())
+			for i := range sqlArgs {
+				arg, err := fromStarlark(tuple.Index(i))
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", b.Name(), err)
+				}
+				sqlArgs[i] = arg
+			}
+			affected, err := db.Exec(sql, sqlArgs...)
+			if err != nil {
+				return nil, err
+			}
+			total += affected
+		}
+		return starlark.MakeInt64(total), nil
+	}
+}
+
+// unpackStatement returns the statement and arguments of query and exec
+func unpackStatement(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (string, []interface{}, error) {
+	if len(kwargs) > 0 {
+		return "", nil, fmt.Errorf("%v: unexpected keyword arguments", b.Name())
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%v: missing statement", b.Name())
+	}
+	sql, ok := starlark.AsString(args[0])
+	if !ok {
+		return "", nil, fmt.Errorf("%v: got %v, want string", b.Name(), args[0].Type())
+	}
+	sqlArgs := make([]interface{}, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		v, err := fromStarlark(arg)
+		if err != nil {
+			return "", nil, fmt.Errorf("%v: %v", b.Name(), err)
+		}
+		sqlArgs = append(sqlArgs, v)
+	}
+	return sql, sqlArgs, nil
+}
+
+// fromStarlark converts arguments of statements
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("int %v out of range", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported argument type %v", v.Type())
+	}
+}
+
+// toStarlark converts values of rows
+func toStarlark(v interface{}) starlark.Value {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(v)
+	case int64:
+		return starlark.MakeInt64(v)
+	case int:
+		return starlark.MakeInt(v)
+	case float64:
+		return starlark.Float(v)
+	case string:
+		return starlark.String(v)
+	case []byte:
+		return starlark.String(v)
+	case time.Time:
+		return starlark.String(v.Format(time.RFC3339Nano))
+	default:
+		return starlark.String(fmt.Sprint(v))
+	}
+}
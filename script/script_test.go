@@ -0,0 +1,75 @@
+package script
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// fakeDB returns the rows of users for every query and records statements
+type fakeDB struct {
+	users      []database.Row
+	statements []string
+}
+
+func (f *fakeDB) Query(query string, args ...interface{}) ([]database.Row, error) {
+	if strings.Contains(query, "broken") {
+		return nil, fmt.Errorf("syntax error")
+	}
+	return f.users, nil
+}
+
+func (f *fakeDB) Exec(query string, args ...interface{}) (int64, error) {
+	f.statements = append(f.statements, fmt.Sprint(query, args))
+	return 1, nil
+}
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name       string
+		script     string
+		expectErr  string
+		statements []string
+		logs       []string
+	}{
+		{name: "query and exec", script: `
+for r in db.query("SELECT id, name FROM users"):
+    db.exec("UPDATE users SET slug = ? WHERE id = ?", r["name"].lower(), r["id"])
+print("done")
+`, statements: []string{"UPDATE users SET slug = ? WHERE id = ?[ann 1]", "UPDATE users SET slug = ? WHERE id = ?[bob <nil>]"},
+			logs: []string{"done"}},
+		{name: "exec many", script: `
+n = db.exec_many("INSERT INTO t VALUES (?, ?)", [(1, True), [2.5, None]])
+print(n)
+`, statements: []string{"INSERT INTO t VALUES (?, ?)[1 true]", "INSERT INTO t VALUES (?, ?)[2.5 <nil>]"},
+			logs: []string{"2"}},
+		{name: "fail", script: `fail("boom")`, expectErr: "boom"},
+		{name: "query error", script: `db.query("broken")`, expectErr: "syntax error"},
+		{name: "unsupported argument", script: `db.exec("DELETE", {})`, expectErr: "exec: unsupported argument type dict"},
+		{name: "no load", script: `load("x.star", "y")`, expectErr: "load not implemented"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := &fakeDB{users: []database.Row{{"id": int64(1), "name": "Ann"}, {"id": nil, "name": "Bob"}}}
+			logs := []string{}
+			err := New().Run("1_test.up.star", []byte(c.script), db, func(msg string) {
+				logs = append(logs, msg)
+			})
+			if c.expectErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if c.expectErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectErr)) {
+				t.Fatalf("expected error %q, got %v", c.expectErr, err)
+			}
+			if c.statements != nil && !reflect.DeepEqual(db.statements, c.statements) {
+				t.Errorf("expected statements %q, got %q", c.statements, db.statements)
+			}
+			if c.expectErr == "" && !reflect.DeepEqual(logs, c.logs) {
+				t.Errorf("expected logs %q, got %q", c.logs, logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+// queryStub is a stub database implementing database.Querier,
+// statements are added to its migration sequence
+type queryStub struct {
+	*dStub.Stub
+}
+
+func (q *queryStub) Query(query string, args ...interface{}) ([]database.Row, error) {
+	return nil, nil
+}
+
+func (q *queryStub) Exec(query string, args ...interface{}) (int64, error) {
+	q.MigrationSequence = append(q.MigrationSequence, query)
+	return 1, nil
+}
+
+// fakeScripts runs every script as one statement
+type fakeScripts struct {
+	names []string
+}
+
+func (f *fakeScripts) Run(name string, script []byte, db database.Querier, log func(msg string)) error {
+	f.names = append(f.names, name)
+	log("running")
+	_, err := db.Exec("CREATE 2")
+	return err
+}
+
+func TestScriptMigrations(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "# migrate:starlark\ndb.exec('CREATE 2')"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != ErrNoScriptRuntime {
+		t.Fatalf("expected ErrNoScriptRuntime, got %v", err)
+	}
+	m.Scripts = &fakeScripts{}
+	if err := m.Up(); err != ErrQueryUnsupported {
+		t.Fatalf("expected ErrQueryUnsupported, got %v", err)
+	}
+	if v, dirty, _ := m.Version(); v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v, %v", v, dirty)
+	}
+
+	db := &queryStub{Stub: dbDrv.(*dStub.Stub)}
+	m, err = NewWithInstance("stub", srcDrv, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scripts := &fakeScripts{}
+	m.Scripts = scripts
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{mr("CREATE 1"), mr("CREATE 2")}, db.Stub)
+	if len(scripts.names) != 1 || scripts.names[0] != "2/u 2.up.stub" {
+		t.Errorf("expected script 2/u 2.up.stub, got %q", scripts.names)
+	}
+}
@@ -0,0 +1,211 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// MigrationFile is the up or down migration of a MigrationInfo.
+type MigrationFile struct {
+	Identifier string
+	// Name is the name of the file, see source.Metadata.
+	Name string
+	// Body is decoded according to Encoding and Decrypter and, with the
+	// template pragma, rendered as it would run.
+	Body    []byte
+	Pragmas pragma.Pragmas
+	// Checksum is the SHA-256 of the file, see source.Checksum.
+	Checksum string
+	// Skipped is true if an if pragma isn't met, see Variables.
+	Skipped bool
+}
+
+// MigrationInfo describes a migration of the source, see Show.
+type MigrationInfo struct {
+	Version uint
+	// Up and Down are nil if the migration has no such file.
+	Up, Down *MigrationFile
+	// Applied is true if the current version is version or after it.
+	Applied bool
+	// Dirty is true if the current version is version and dirty.
+	Dirty bool
+}
+
+// Show returns the up and down migration of version with their pragmas,
+// checksums and whether version is applied, e.g. to inspect a migration of
+// a remote source. It fails with os.ErrNotExist if the source has no
+// migration of version.
+func (m *Migrate) Show(version uint) (*MigrationInfo, error) {
+	info := &MigrationInfo{Version: version}
+	var err error
+	if info.Up, err = m.showFile(version, source.Up); err != nil {
+		return nil, err
+	}
+	if info.Down, err = m.showFile(version, source.Down); err != nil {
+		return nil, err
+	}
+	if info.Up == nil && info.Down == nil {
+		return nil, os.ErrNotExist
+	}
+
+	current, dirty, err := m.state().Version()
+	if err != nil {
+		return nil, err
+	}
+	if current != database.NilVersion {
+		info.Applied = m.position(int(version)) <= m.position(current)
+		info.Dirty = dirty && suint(current) == version
+	}
+	return info, nil
+}
+
+// MigrationState is a migration of the source, see Migrations.
+type MigrationState struct {
+	Version uint
+	// Identifier is the one of the up migration, or of the down migration
+	// if there is none.
+	Identifier string
+	// Applied is true if the migration is the current version or before
+	// it, in the order of the source, and wasn't skipped, see Skipped.
+	Applied bool
+}
+
+// Migrations returns the migrations of the source in the order Up applies
+// them, marking the applied ones. Their bodies aren't read if the source
+// driver is a source.Identifier.
+func (m *Migrate) Migrations() ([]MigrationState, error) {
+	current, _, err := m.state().Version()
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[uint]bool)
+	if current != database.NilVersion && m.HistoryTable != "" {
+		versions, err := m.Skipped()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			skipped[v] = true
+		}
+	}
+
+	var migrations []MigrationState
+	version, err := m.sourceDrv.First()
+	for err == nil {
+		migr := MigrationState{
+			Version: version,
+			Applied: current != database.NilVersion && m.position(int(version)) <= m.position(current) && !skipped[version],
+		}
+		migr.Identifier, err = source.Identify(m.sourceDrv, version, source.Up)
+		if os.IsNotExist(err) {
+			migr.Identifier, err = source.Identify(m.sourceDrv, version, source.Down)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		migrations = append(migrations, migr)
+		version, err = m.sourceDrv.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// ReadUp reads the up migration of version from the source, decoded
+// according to Encoding and Decrypter, e.g. to inspect a pending migration
+// without holding it in memory. Unlike Up, it doesn't verify the body
+// against Manifest and Approvals or render templates.
+func (m *Migrate) ReadUp(version uint) (io.ReadCloser, string, error) {
+	return m.readDecoded(version, source.Up)
+}
+
+// Describe returns the metadata of the migration of version in direction,
+// see source.Describe, with the pragmas and tags of the body decoded
+// according to Encoding and Decrypter, rather than of the bytes stored in
+// the source. Name, Checksum and Size describe the file as stored.
+func (m *Migrate) Describe(version uint, direction source.Direction) (source.Metadata, error) {
+	meta, err := source.Describe(m.sourceDrv, version, direction)
+	if err != nil {
+		return source.Metadata{}, err
+	}
+	r, _, err := m.readDecoded(version, direction)
+	if err != nil {
+		return source.Metadata{}, err
+	}
+	defer r.Close()
+	if meta.Pragmas, err = peekPragmas(bufio.NewReaderSize(r, pragmaPeekSize)); err != nil {
+		return source.Metadata{}, err
+	}
+	meta.Tags = meta.Pragmas.Tags()
+	return meta, nil
+}
+
+// readDecoded reads the migration of version in direction from the source
+// and decodes it, see ReadUp.
+func (m *Migrate) readDecoded(version uint, direction source.Direction) (io.ReadCloser, string, error) {
+	read := m.sourceDrv.ReadUp
+	if direction == source.Down {
+		read = m.sourceDrv.ReadDown
+	}
+	r, identifier, err := read(version)
+	if err != nil {
+		return nil, "", err
+	}
+	dr, err := newDecodingReader(r, m.Encoding, m.Decrypter)
+	if err != nil {
+		return nil, "", multierror.Append(err, r.Close())
+	}
+	return dr, identifier, nil
+}
+
+// showFile reads the migration of version in direction for Show, or
+// returns nil if there is none.
+func (m *Migrate) showFile(version uint, direction source.Direction) (*MigrationFile, error) {
+	read := m.readUpBody
+	if direction == source.Down {
+		read = m.readDownBody
+	}
+	r, identifier, err := read(version)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &MigrationFile{Identifier: identifier, Body: body, Pragmas: pragma.Parse(body)}
+	run, err := m.shouldRun(f.Pragmas)
+	if err != nil {
+		return nil, err
+	}
+	f.Skipped = !run
+	if f.Pragmas.Has(pragma.Template) {
+		rendered, err := m.render(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if f.Body, err = ioutil.ReadAll(rendered); err != nil {
+			return nil, err
+		}
+	}
+	meta, err := source.Describe(m.sourceDrv, version, direction)
+	if err != nil {
+		return nil, err
+	}
+	f.Name, f.Checksum = meta.Name, meta.Checksum
+	return f, nil
+}
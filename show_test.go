@@ -0,0 +1,146 @@
+package migrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/graph"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestShow(t *testing.T) {
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up,
+		Identifier: "-- migrate:if env == \"staging\"\n-- migrate:no-transaction\nCREATE 2"})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Migrate(1); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := m.Show(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Applied || info.Dirty || info.Up == nil || info.Down == nil {
+		t.Fatalf("expected applied version 1 with up and down migration, got %+v", info)
+	}
+	if string(info.Down.Body) != "DROP 1" || info.Down.Checksum != manifest.Checksum([]byte("DROP 1")) {
+		t.Errorf("unexpected down migration %+v", info.Down)
+	}
+
+	info, err = m.Show(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Applied || info.Down != nil {
+		t.Fatalf("expected pending version 2 without down migration, got %+v", info)
+	}
+	if !info.Up.Skipped || !info.Up.Pragmas.Has("no-transaction") {
+		t.Errorf("expected skipped up migration with no-transaction pragma, got %+v", info.Up)
+	}
+	m.Variables = map[string]string{"env": "staging"}
+	if info, err = m.Show(2); err != nil || info.Up.Skipped {
+		t.Errorf("expected up migration to run in staging, got %+v, %v", info, err)
+	}
+
+	if _, err := m.Show(3); err != os.ErrNotExist {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "-- migrate:depends-on 2\nCREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	g, err := graph.New(m.sourceDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.sourceDrv = g
+
+	// order is 2, 1, 3
+	if err := m.Migrate(2); err != nil {
+		t.Fatal(err)
+	}
+	states, err := m.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []MigrationState{
+		{Version: 2, Identifier: "2.up.stub", Applied: true},
+		{Version: 1, Identifier: "1.up.stub"},
+		{Version: 3, Identifier: "3.down.stub"},
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("expected %+v, got %+v", expected, states)
+	}
+}
+
+func TestReadUpDecoded(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "INSERT INTO t VALUES ('caf\xe9')"})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.Encoding = "latin1"
+
+	r, identifier, err := m.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identifier != "1.up.stub" || string(body) != "INSERT INTO t VALUES ('café')" {
+		t.Errorf("expected decoded migration, got %v %q", identifier, body)
+	}
+	if _, _, err := m.ReadUp(2); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestDescribeDecoded(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte("-- migrate:tags seed\nINSERT 1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := New("stub://", "stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: compressed.String()})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+
+	meta, err := m.Describe(1, source.Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(meta.Tags, []string{"seed"}) || meta.Checksum != manifest.Checksum(compressed.Bytes()) {
+		t.Errorf("expected the tags of the decoded body and the checksum of the stored one, got %+v", meta)
+	}
+	if _, err := m.Describe(1, source.Down); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"errors"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// ErrNoHistoryTable is returned by Skipped and ApplySkipped without
+// HistoryTable, which records the skipped migrations.
+var ErrNoHistoryTable = errors.New("no history table to find skipped migrations in")
+
+// Skipped returns the versions of the up migrations which were skipped as
+// their tags weren't selected, see SelectTags, or failed in a run with
+// ContinueOnError, and haven't been applied since, in order.
+func (m *Migrate) Skipped() ([]uint, error) {
+	if m.HistoryTable == "" {
+		return nil, ErrNoHistoryTable
+	}
+	curVersion, _, err := m.state().Version()
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.History()
+	if err != nil {
+		return nil, err
+	}
+	return skippedVersions(records, curVersion), nil
+}
+
+// skippedVersions returns the versions up to curVersion whose last record
+// is a skip or failure.
+func skippedVersions(records []database.HistoryRecord, curVersion int) []uint {
+	last := make(map[uint]string)
+	versions := make([]uint, 0)
+	for _, r := range records {
+		if _, ok := last[r.Version]; !ok {
+			versions = append(versions, r.Version)
+		}
+		last[r.Version] = r.Direction
+	}
+	skipped := make([]uint, 0)
+	for _, v := range versions {
+		if (last[v] == database.HistorySkip || last[v] == database.HistoryFailed) && int(v) <= curVersion {
+			skipped = append(skipped, v)
+		}
+	}
+	return skipped
+}
+
+// ApplySkipped applies the skipped up migrations, see Skipped, whose tags
+// are selected now, without changing the version. Migrations which are
+// still not selected stay skipped.
+func (m *Migrate) ApplySkipped() error {
+	if m.HistoryTable == "" {
+		return ErrNoHistoryTable
+	}
+	m.startRun()
+	defer m.finishRun()
+	if _, err := m.lagChecker(); err != nil {
+		return err
+	}
+	if err := m.lock(); err != nil {
+		return err
+	}
+	m.lockAcquired()
+
+	curVersion, dirty, err := m.state().Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if dirty {
+		return m.unlockErr(ErrDirty{curVersion})
+	}
+	records, err := m.History()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	versions := skippedVersions(records, curVersion)
+	if len(versions) == 0 {
+		return m.unlockErr(ErrNoChange)
+	}
+
+	ret := make(chan interface{}, m.PrefetchMigrations)
+	done := make(chan struct{})
+	go func() {
+		defer close(ret)
+		for _, v := range versions {
+			migr, err := m.newMigration(v, int(v))
+			if err != nil {
+				select {
+				case ret <- err:
+				case <-done:
+				}
+				return
+			}
+			// the version stays where it is
+			migr.TargetVersion = curVersion
+			migr.late = true
+			select {
+			case ret <- migr:
+			case <-done:
+				return
+			}
+			go func(migr *Migration) {
+				if err := migr.Buffer(); err != nil {
+					m.logErr(err)
+				}
+			}(migr)
+		}
+	}()
+
+	err = m.runMigrations(ret)
+	stopReading(ret, done)
+	return m.unlockErr(err)
+}
@@ -0,0 +1,32 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+func TestSkippedVersions(t *testing.T) {
+	records := []database.HistoryRecord{
+		{Version: 1, Direction: "up"},
+		{Version: 2, Direction: database.HistorySkip},
+		{Version: 3, Direction: database.HistorySkip},
+		{Version: 4, Direction: database.HistorySkip},
+		{Version: 5, Direction: "up"},
+		// applied later
+		{Version: 3, Direction: "up"},
+	}
+	if skipped := skippedVersions(records, 5); !reflect.DeepEqual(skipped, []uint{2, 4}) {
+		t.Errorf("expected 2 and 4 skipped, got %v", skipped)
+	}
+	// migrated down below 4
+	if skipped := skippedVersions(records, 3); !reflect.DeepEqual(skipped, []uint{2}) {
+		t.Errorf("expected 2 skipped, got %v", skipped)
+	}
+	// failed with ContinueOnError
+	records = append(records, database.HistoryRecord{Version: 6, Direction: database.HistoryFailed})
+	if skipped := skippedVersions(records, 6); !reflect.DeepEqual(skipped, []uint{2, 4, 6}) {
+		t.Errorf("expected 2, 4 and 6 skipped, got %v", skipped)
+	}
+}
@@ -0,0 +1,102 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// ErrDumpUnsupported is returned by DumpSchema if the database driver doesn't
+// implement database.Dumper.
+var ErrDumpUnsupported = errors.New("database driver can't dump the schema")
+
+// ErrNotFresh is returned by LoadSnapshot if migrations were already applied
+// to the database.
+var ErrNotFresh = errors.New("database isn't fresh, a snapshot can only be loaded into a database without migrations")
+
+// ErrNoSnapshotVersion is returned by LoadSnapshot for a snapshot without
+// the snapshot-version pragma.
+var ErrNoSnapshotVersion = errors.New("snapshot without snapshot-version pragma")
+
+// DumpSchema writes a snapshot of the schema to w: the SQL statements
+// creating it, preceded by the snapshot-version pragma with the current
+// version, e.g. `-- migrate:snapshot-version 42`. migrate's own tables are
+// left out. The database must not be dirty.
+func (m *Migrate) DumpSchema(w io.Writer) error {
+	dumper, ok := m.databaseDrv.(database.Dumper)
+	if !ok {
+		return ErrDumpUnsupported
+	}
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return ErrDirty{int(version)}
+	}
+	if _, err := fmt.Fprintf(w, "-- %v%v %v\n\n", pragma.Prefix, pragma.SnapshotVersion, version); err != nil {
+		return err
+	}
+	return dumper.DumpSchema(w, m.ownTables())
+}
+
+// LoadSnapshot initializes a fresh database from a snapshot written by
+// DumpSchema and sets the version of the snapshot, as if all migrations up to
+// it were applied. Up then only applies the migrations after the snapshot.
+// The version of the snapshot must be a migration of the source.
+func (m *Migrate) LoadSnapshot(snapshot io.Reader) (err error) {
+	body, err := ioutil.ReadAll(snapshot)
+	if err != nil {
+		return err
+	}
+	v, ok := pragma.Parse(body).Get(pragma.SnapshotVersion)
+	if !ok {
+		return ErrNoSnapshotVersion
+	}
+	version, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot-version %q: %v", v, err)
+	}
+
+	defer m.audit("snapshot", v, time.Now(), &err)
+	defer m.fingerprint(&err)
+
+	if err := m.lock(); err != nil {
+		return err
+	}
+
+	curVersion, dirty, err := m.state().Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if dirty {
+		return m.unlockErr(ErrDirty{curVersion})
+	}
+	if curVersion != database.NilVersion {
+		return m.unlockErr(ErrNotFresh)
+	}
+	if err := m.versionExists(uint(version)); err != nil {
+		return m.unlockErr(err)
+	}
+
+	// dirty until the snapshot is loaded completely, like a migration
+	if err := m.state().SetVersion(int(version), true); err != nil {
+		return m.unlockErr(err)
+	}
+	started := time.Now()
+	if err := m.databaseDrv.Run(bytes.NewReader(body)); err != nil {
+		return m.unlockErr(err)
+	}
+	if err := m.state().SetVersion(int(version), false); err != nil {
+		return m.unlockErr(err)
+	}
+	m.logPrintf("Loaded snapshot at version %v (%v)\n", version, time.Since(started))
+	return m.unlock()
+}
@@ -0,0 +1,61 @@
+package source
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AliasFile is the file in the root of a source which maps names to
+// versions, so that runbooks can name versions, e.g.
+//  pre-sharding: 20230110083000
+// It is read from drivers implementing FileReader.
+const AliasFile = "aliases.yaml"
+
+// Aliases maps names to versions.
+type Aliases map[string]uint
+
+// ReadAliases reads the AliasFile of src. It returns no aliases if there is
+// none, or if src doesn't implement FileReader.
+func ReadAliases(src Driver) (Aliases, error) {
+	aliases := make(Aliases)
+	fr, ok := src.(FileReader)
+	if !ok {
+		return aliases, nil
+	}
+	r, err := fr.ReadFile(AliasFile)
+	if os.IsNotExist(err) {
+		return aliases, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(b, &aliases); err != nil {
+		return nil, fmt.Errorf("%v: %v", AliasFile, err)
+	}
+	return aliases, nil
+}
+
+// ResolveVersion returns the version s, which is either a number or an
+// alias of the AliasFile of src.
+func ResolveVersion(src Driver, s string) (uint, error) {
+	if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return uint(v), nil
+	}
+	aliases, err := ReadAliases(src)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := aliases[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown version %q, neither a number nor an alias in %v", s, AliasFile)
+	}
+	return v, nil
+}
@@ -0,0 +1,229 @@
+// Package approval records that a migration was approved for protected
+// environments, e.g. by a DBA after a review. An approval is a file signed
+// with the SSH key of the approver, e.g.
+//  # migrate approval
+//  version 44
+//  checksum 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//  approver ana@dev-1
+//  approved 2020-01-02T15:04:05Z
+//  signature AAAAC3NzaC1lZDI1NTE5AAAAI...
+// The checksum is that of the up migration, see manifest.Checksum, so a
+// migration changed after its approval isn't approved anymore.
+package approval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	header          = "# migrate approval"
+	signaturePrefix = "signature "
+)
+
+// Ext is the extension of approval files, which are named by the version
+// they approve, e.g. 44.approval.
+const Ext = ".approval"
+
+var (
+	ErrNotSigned        = errors.New("approval is not signed")
+	ErrInvalidSignature = errors.New("approval signature is invalid")
+)
+
+// ErrUnapproved is returned for a migration without valid approval.
+type ErrUnapproved struct {
+	Version uint
+	// Reason is empty if there is no approval.
+	Reason string
+}
+
+func (e ErrUnapproved) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("migration %v is not approved", e.Version)
+	}
+	return fmt.Sprintf("migration %v is not approved: %v", e.Version, e.Reason)
+}
+
+// Approval approves the up migration of a version.
+type Approval struct {
+	Version uint
+	// Checksum of the approved up migration.
+	Checksum string
+	Approver string
+	Approved time.Time
+
+	// Signature of the approval, nil if it isn't signed.
+	Signature *ssh.Signature
+}
+
+// New returns an unsigned approval of the up migration body of version.
+func New(version uint, body []byte, approver string) *Approval {
+	return &Approval{
+		Version:  version,
+		Checksum: manifest.Checksum(body),
+		Approver: approver,
+		Approved: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// content returns the encoded approval without signature, which is the
+// signed content.
+func (a *Approval) content() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "version %v\nchecksum %v\napprover %v\napproved %v\n",
+		a.Version, a.Checksum, a.Approver, a.Approved.UTC().Format(time.RFC3339))
+	return buf.Bytes()
+}
+
+// Sign signs the approval.
+func (a *Approval) Sign(signer ssh.Signer) error {
+	sig, err := signer.Sign(nil, a.content())
+	if err != nil {
+		return err
+	}
+	a.Signature = sig
+	return nil
+}
+
+// VerifySignature returns nil if the approval is signed by one of keys.
+func (a *Approval) VerifySignature(keys []ssh.PublicKey) error {
+	if a.Signature == nil {
+		return ErrNotSigned
+	}
+	for _, key := range keys {
+		if key.Verify(a.content(), a.Signature) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// WriteTo writes the approval to w.
+func (a *Approval) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header + "\n")
+	buf.Write(a.content())
+	if a.Signature != nil {
+		buf.WriteString(signaturePrefix + base64.StdEncoding.EncodeToString(ssh.Marshal(a.Signature)) + "\n")
+	}
+	return buf.WriteTo(w)
+}
+
+// Read parses an approval written by WriteTo.
+func Read(r io.Reader) (*Approval, error) {
+	a := &Approval{}
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		kv := strings.SplitN(text, " ", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("approval line %v: expected a name and a value", line)
+		}
+		fields[kv[0]] = kv[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	version, err := strconv.ParseUint(fields["version"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("approval: invalid version: %v", err)
+	}
+	a.Version = uint(version)
+	a.Checksum = fields["checksum"]
+	a.Approver = fields["approver"]
+	if a.Approved, err = time.Parse(time.RFC3339, fields["approved"]); err != nil {
+		return nil, fmt.Errorf("approval: invalid approved time: %v", err)
+	}
+	if sig, ok := fields["signature"]; ok {
+		blob, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			return nil, fmt.Errorf("approval: invalid signature: %v", err)
+		}
+		a.Signature = &ssh.Signature{}
+		if err := ssh.Unmarshal(blob, a.Signature); err != nil {
+			return nil, fmt.Errorf("approval: invalid signature: %v", err)
+		}
+	}
+	return a, nil
+}
+
+// Path returns the file of the approval of version in dir.
+func Path(dir string, version uint) string {
+	return filepath.Join(dir, strconv.FormatUint(uint64(version), 10)+Ext)
+}
+
+// Dir holds the approvals of migrations, signed by one of Keys.
+type Dir struct {
+	Path string
+	Keys []ssh.PublicKey
+}
+
+// Verify returns ErrUnapproved unless Path holds an approval of the up
+// migration body of version, signed by one of Keys.
+func (d *Dir) Verify(version uint, body []byte) error {
+	return d.VerifyChecksum(version, manifest.Checksum(body))
+}
+
+// VerifyChecksum is like Verify, given the checksum of the body.
+func (d *Dir) VerifyChecksum(version uint, checksum string) error {
+	b, err := ioutil.ReadFile(Path(d.Path, version))
+	if os.IsNotExist(err) {
+		return ErrUnapproved{Version: version}
+	} else if err != nil {
+		return err
+	}
+	a, err := Read(bytes.NewReader(b))
+	if err != nil {
+		return ErrUnapproved{Version: version, Reason: err.Error()}
+	}
+	if err := a.VerifySignature(d.Keys); err != nil {
+		return ErrUnapproved{Version: version, Reason: err.Error()}
+	}
+	if a.Version != version {
+		return ErrUnapproved{Version: version, Reason: fmt.Sprintf("the approval is for version %v", a.Version)}
+	}
+	if a.Checksum != checksum {
+		return ErrUnapproved{Version: version, Reason: "the migration changed after it was approved"}
+	}
+	return nil
+}
+
+// ReadKeys reads the public keys of approvers from a file in the format of
+// authorized_keys, one key per line.
+func ReadKeys(file string) ([]ssh.PublicKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(b)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", file, err)
+		}
+		keys = append(keys, key)
+		b = rest
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%v contains no keys", file)
+	}
+	return keys, nil
+}
@@ -0,0 +1,108 @@
+package approval
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestSignReadVerify(t *testing.T) {
+	signer := newSigner(t)
+	a := New(44, []byte("CREATE 44"), "ana@dev-1")
+	if err := a.VerifySignature([]ssh.PublicKey{signer.PublicKey()}); err != ErrNotSigned {
+		t.Fatalf("expected ErrNotSigned, got %v", err)
+	}
+	if err := a.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := a.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != 44 || read.Approver != "ana@dev-1" || !read.Approved.Equal(a.Approved) {
+		t.Fatalf("expected %+v, got %+v", a, read)
+	}
+	other := newSigner(t)
+	if err := read.VerifySignature([]ssh.PublicKey{other.PublicKey(), signer.PublicKey()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := read.VerifySignature([]ssh.PublicKey{other.PublicKey()}); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	read.Approver = "bob@dev-2"
+	if err := read.VerifySignature([]ssh.PublicKey{signer.PublicKey()}); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature for a modified approval, got %v", err)
+	}
+}
+
+func TestDirVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	signer := newSigner(t)
+	write := func(a *Approval, version uint) {
+		if err := a.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if _, err := a.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(Path(dir, version), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(New(1, []byte("CREATE 1"), "ana"), 1)
+	// copied from the approval of 1
+	write(New(1, []byte("CREATE 2"), "ana"), 2)
+
+	d := &Dir{Path: dir, Keys: []ssh.PublicKey{signer.PublicKey()}}
+	cases := []struct {
+		name     string
+		version  uint
+		body     string
+		expected error
+	}{
+		{"approved", 1, "CREATE 1", nil},
+		{"changed", 1, "CREATE 1; DROP 0", ErrUnapproved{Version: 1, Reason: "the migration changed after it was approved"}},
+		{"other version", 2, "CREATE 2", ErrUnapproved{Version: 2, Reason: "the approval is for version 1"}},
+		{"missing", 3, "CREATE 3", ErrUnapproved{Version: 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := d.Verify(c.version, []byte(c.body)); err != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+
+	d.Keys = []ssh.PublicKey{newSigner(t).PublicKey()}
+	expected := ErrUnapproved{Version: 1, Reason: ErrInvalidSignature.Error()}
+	if err := d.Verify(1, []byte("CREATE 1")); err != expected {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+}
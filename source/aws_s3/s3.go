@@ -6,13 +6,16 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/cache"
 )
 
 func init() {
@@ -23,11 +26,36 @@ type s3Driver struct {
 	s3client   s3iface.S3API
 	config     *Config
 	migrations *source.Migrations
+
+	// cache is set if config.CacheDir is, etags holds the ETags of the
+	// listed objects by name then
+	cache *cache.Cache
+	etags map[string]string
+
+	// mu guards the listing, which config.VersionDigits defers until
+	// ListFrom or the first call needing it. from is the version the
+	// migrations were listed from, 0 once all of them are.
+	mu      sync.Mutex
+	listed  bool
+	from    uint
+	dialect string
 }
 
 type Config struct {
 	Bucket string
 	Prefix string
+
+	// CacheDir, if set, keeps the migrations in this directory by their
+	// ETag, so that they are only downloaded again once they changed,
+	// see package source/cache.
+	CacheDir string
+
+	// VersionDigits, if set, is the number of digits of the versions in
+	// the names of the migrations, which are zero-padded to it, e.g. 14 for
+	// timestamps. As S3 lists keys in lexical order, running up then only
+	// lists the migrations from the version of the database on, see
+	// source.RangeLister.
+	VersionDigits int
 }
 
 func (s *s3Driver) Open(folder string) (source.Driver, error) {
@@ -49,10 +77,20 @@ func WithInstance(s3client s3iface.S3API, config *Config) (source.Driver, error)
 		config:     config,
 		s3client:   s3client,
 		migrations: source.NewMigrations(),
+		etags:      make(map[string]string),
+	}
+	if config.CacheDir != "" {
+		c, err := cache.Open(config.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		driver.cache = c
 	}
 
-	if err := driver.loadMigrations(); err != nil {
-		return nil, err
+	if config.VersionDigits == 0 {
+		if err := driver.listAll(); err != nil {
+			return nil, err
+		}
 	}
 
 	return driver, nil
@@ -69,31 +107,99 @@ func parseURI(uri string) (*Config, error) {
 		prefix += "/"
 	}
 
-	return &Config{
-		Bucket: u.Host,
-		Prefix: prefix,
-	}, nil
+	config := &Config{
+		Bucket:   u.Host,
+		Prefix:   prefix,
+		CacheDir: u.Query().Get(cache.Param),
+	}
+	if s := u.Query().Get("x-version-digits"); s != "" {
+		if config.VersionDigits, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("x-version-digits: %v", err)
+		}
+	}
+	return config, nil
 }
 
-func (s *s3Driver) loadMigrations() error {
-	output, err := s.s3client.ListObjects(&s3.ListObjectsInput{
+// loadMigrations lists the migrations with keys after marker, all of them
+// if marker is empty.
+func (s *s3Driver) loadMigrations(marker string) error {
+	migrations := source.NewMigrations()
+	migrations.SelectDialect(s.dialect)
+	input := &s3.ListObjectsInput{
 		Bucket:    aws.String(s.config.Bucket),
 		Prefix:    aws.String(s.config.Prefix),
 		Delimiter: aws.String("/"),
-	})
-	if err != nil {
-		return err
 	}
-	for _, object := range output.Contents {
-		_, fileName := path.Split(aws.StringValue(object.Key))
-		m, err := source.DefaultParse(fileName)
+	if marker != "" {
+		input.Marker = aws.String(marker)
+	}
+	for {
+		output, err := s.s3client.ListObjects(input)
 		if err != nil {
-			continue
+			return err
+		}
+		for _, object := range output.Contents {
+			_, fileName := path.Split(aws.StringValue(object.Key))
+			m, err := source.DefaultParse(fileName)
+			if err != nil {
+				continue
+			}
+			if err := migrations.Add(m); err != nil {
+				return err
+			}
+			s.etags[fileName] = aws.StringValue(object.ETag)
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		// NextMarker is only returned with a delimiter
+		next := aws.StringValue(output.NextMarker)
+		if next == "" && len(output.Contents) > 0 {
+			next = aws.StringValue(output.Contents[len(output.Contents)-1].Key)
 		}
-		if !s.migrations.Append(m) {
-			return fmt.Errorf("unable to parse file %v", aws.StringValue(object.Key))
+		if next == "" {
+			break
 		}
+		input.Marker = aws.String(next)
+	}
+	s.migrations = migrations
+	return nil
+}
+
+func (s *s3Driver) listAll() error {
+	if err := s.loadMigrations(""); err != nil {
+		return err
+	}
+	s.listed, s.from = true, 0
+	return nil
+}
+
+// list makes sure the migrations needed to answer for version are listed,
+// listing all of them if version is before those listed from s.from on.
+func (s *s3Driver) list(version uint) error {
+	if s.listed && version >= s.from {
+		return nil
+	}
+	return s.listAll()
+}
+
+// ListFrom implements source.RangeLister. Without config.VersionDigits,
+// all migrations are listed in WithInstance already.
+func (s *s3Driver) ListFrom(version uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listed {
+		return nil
+	}
+	from := fmt.Sprintf("%0*d", s.config.VersionDigits, version)
+	if len(from) > s.config.VersionDigits {
+		return s.listAll()
+	}
+	// the keys of version itself come after the bare version
+	if err := s.loadMigrations(s.config.Prefix + from); err != nil {
+		return err
 	}
+	s.listed, s.from = true, version
 	return nil
 }
 
@@ -101,7 +207,19 @@ func (s *s3Driver) Close() error {
 	return nil
 }
 
+func (s *s3Driver) SelectDialect(dialect string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dialect = dialect
+	s.migrations.SelectDialect(dialect)
+}
+
 func (s *s3Driver) First() (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.list(0); err != nil {
+		return 0, err
+	}
 	v, ok := s.migrations.First()
 	if !ok {
 		return 0, os.ErrNotExist
@@ -110,7 +228,19 @@ func (s *s3Driver) First() (uint, error) {
 }
 
 func (s *s3Driver) Prev(version uint) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.list(version); err != nil {
+		return 0, err
+	}
 	v, ok := s.migrations.Prev(version)
+	if !ok && s.from > 0 {
+		// the previous version may not be listed yet
+		if err := s.listAll(); err != nil {
+			return 0, err
+		}
+		v, ok = s.migrations.Prev(version)
+	}
 	if !ok {
 		return 0, os.ErrNotExist
 	}
@@ -118,6 +248,11 @@ func (s *s3Driver) Prev(version uint) (uint, error) {
 }
 
 func (s *s3Driver) Next(version uint) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.list(version); err != nil {
+		return 0, err
+	}
 	v, ok := s.migrations.Next(version)
 	if !ok {
 		return 0, os.ErrNotExist
@@ -126,21 +261,65 @@ func (s *s3Driver) Next(version uint) (uint, error) {
 }
 
 func (s *s3Driver) ReadUp(version uint) (io.ReadCloser, string, error) {
-	if m, ok := s.migrations.Up(version); ok {
-		return s.open(m)
-	}
-	return nil, "", os.ErrNotExist
+	return s.read(version, source.Up)
 }
 
 func (s *s3Driver) ReadDown(version uint) (io.ReadCloser, string, error) {
-	if m, ok := s.migrations.Down(version); ok {
-		return s.open(m)
+	return s.read(version, source.Down)
+}
+
+func (s *s3Driver) read(version uint, direction source.Direction) (io.ReadCloser, string, error) {
+	s.mu.Lock()
+	if err := s.list(version); err != nil {
+		s.mu.Unlock()
+		return nil, "", err
 	}
-	return nil, "", os.ErrNotExist
+	var m *source.Migration
+	var ok bool
+	if direction == source.Up {
+		m, ok = s.migrations.Up(version)
+	} else {
+		m, ok = s.migrations.Down(version)
+	}
+	var etag string
+	if ok {
+		etag = s.etags[m.Raw]
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, "", os.ErrNotExist
+	}
+	return s.open(m, etag)
 }
 
-func (s *s3Driver) open(m *source.Migration) (io.ReadCloser, string, error) {
+// Identify implements source.Identifier from the listed keys, without
+// downloading the migration.
+func (s *s3Driver) Identify(version uint, direction source.Direction) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.list(version); err != nil {
+		return "", err
+	}
+	m, ok := s.migrations.Up(version)
+	if direction == source.Down {
+		m, ok = s.migrations.Down(version)
+	}
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return m.Identifier, nil
+}
+
+// open downloads m, whose listing held etag.
+func (s *s3Driver) open(m *source.Migration, etag string) (io.ReadCloser, string, error) {
 	key := path.Join(s.config.Prefix, m.Raw)
+	cacheKey := "s3 " + s.config.Bucket + "/" + key + " " + etag
+	if s.cache != nil && etag != "" {
+		if r, ok := s.cache.Get(cacheKey); ok {
+			return r, m.Identifier, nil
+		}
+	}
+
 	object, err := s.s3client.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(s.config.Bucket),
 		Key:    aws.String(key),
@@ -148,5 +327,13 @@ func (s *s3Driver) open(m *source.Migration) (io.ReadCloser, string, error) {
 	if err != nil {
 		return nil, "", err
 	}
-	return object.Body, m.Identifier, nil
+	body := object.Body
+	if object.ContentLength != nil {
+		body = source.WithSize(body, *object.ContentLength)
+	}
+	// the object may have changed since it was listed
+	if s.cache != nil && etag != "" && aws.StringValue(object.ETag) == etag {
+		body = s.cache.Put(cacheKey, body)
+	}
+	return body, m.Identifier, nil
 }
@@ -1,13 +1,18 @@
 package awss3
 
 import (
+	"crypto/md5"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"sort"
 	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang-migrate/migrate/v4/source"
 	st "github.com/golang-migrate/migrate/v4/source/testing"
 	"github.com/stretchr/testify/assert"
 )
@@ -40,6 +45,126 @@ func Test(t *testing.T) {
 	st.Test(t, driver)
 }
 
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s3Client := fakeS3{
+		bucket: "some-bucket",
+		objects: map[string]string{
+			"prod/1_foobar.up.sql": "1 up",
+			"prod/3_foobar.up.sql": "3 up",
+		},
+	}
+	read := func(version uint) string {
+		driver, err := WithInstance(&s3Client, &Config{Bucket: "some-bucket", Prefix: "prod/", CacheDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _, err := driver.ReadUp(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if body := read(1); body != "1 up" || s3Client.gets != 1 {
+		t.Fatalf("expected 1 up downloaded, got %q after %v downloads", body, s3Client.gets)
+	}
+	if body := read(1); body != "1 up" || s3Client.gets != 1 {
+		t.Fatalf("expected 1 up from the cache, got %q after %v downloads", body, s3Client.gets)
+	}
+	// a changed object has another ETag
+	s3Client.objects["prod/1_foobar.up.sql"] = "1 up changed"
+	if body := read(1); body != "1 up changed" || s3Client.gets != 2 {
+		t.Fatalf("expected the changed 1 up downloaded, got %q after %v downloads", body, s3Client.gets)
+	}
+}
+
+func TestListFrom(t *testing.T) {
+	s3Client := fakeS3{
+		bucket:   "some-bucket",
+		pageSize: 2,
+		objects: map[string]string{
+			"prod/001_foobar.up.sql": "1 up",
+			"prod/003_foobar.up.sql": "3 up",
+			"prod/004_foobar.up.sql": "4 up",
+			"prod/009_foobar.up.sql": "9 up",
+			"prod/010_foobar.up.sql": "10 up",
+			"prod/120_foobar.up.sql": "120 up",
+		},
+	}
+	driver, err := WithInstance(&s3Client, &Config{Bucket: "some-bucket", Prefix: "prod/", VersionDigits: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s3Client.listed != 0 {
+		t.Fatalf("expected no listing before ListFrom, got %v keys listed", s3Client.listed)
+	}
+	if err := driver.(source.RangeLister).ListFrom(4); err != nil {
+		t.Fatal(err)
+	}
+	if s3Client.listed != 4 {
+		t.Fatalf("expected the keys from 4 on listed, got %v keys listed", s3Client.listed)
+	}
+	versions := []uint{4}
+	for v, err := driver.Next(4); err == nil; v, err = driver.Next(v) {
+		versions = append(versions, v)
+	}
+	assert.Equal(t, []uint{4, 9, 10, 120}, versions)
+	if s3Client.listed != 4 {
+		t.Fatalf("expected no more listing, got %v keys listed", s3Client.listed)
+	}
+
+	// versions before are listed once asked for
+	if prev, err := driver.Prev(4); err != nil || prev != 3 {
+		t.Fatalf("expected previous version 3, got %v, %v", prev, err)
+	}
+	if s3Client.listed != 10 {
+		t.Fatalf("expected all keys listed, got %v keys listed", s3Client.listed)
+	}
+	if first, err := driver.First(); err != nil || first != 1 {
+		t.Fatalf("expected first version 1, got %v, %v", first, err)
+	}
+}
+
+func TestListFromBehaves(t *testing.T) {
+	s3Client := fakeS3{
+		bucket:   "some-bucket",
+		pageSize: 3,
+		objects: map[string]string{
+			"prod/migrations/1_foobar.up.sql":   "1 up",
+			"prod/migrations/1_foobar.down.sql": "1 down",
+			"prod/migrations/3_foobar.up.sql":   "3 up",
+			"prod/migrations/4_foobar.up.sql":   "4 up",
+			"prod/migrations/4_foobar.down.sql": "4 down",
+			"prod/migrations/5_foobar.down.sql": "5 down",
+			"prod/migrations/7_foobar.up.sql":   "7 up",
+			"prod/migrations/7_foobar.down.sql": "7 down",
+		},
+	}
+	driver, err := WithInstance(&s3Client, &Config{
+		Bucket:        "some-bucket",
+		Prefix:        "prod/migrations/",
+		VersionDigits: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.(source.RangeLister).ListFrom(4); err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, driver)
+}
+
 func TestParseURI(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -76,6 +201,24 @@ func TestParseURI(t *testing.T) {
 				Bucket: "migration-bucket",
 			},
 		},
+		{
+			"with cache",
+			"s3://migration-bucket/production?x-cache-dir=/var/cache/migrate",
+			&Config{
+				Bucket:   "migration-bucket",
+				Prefix:   "production/",
+				CacheDir: "/var/cache/migrate",
+			},
+		},
+		{
+			"with version digits",
+			"s3://migration-bucket/production?x-version-digits=14",
+			&Config{
+				Bucket:        "migration-bucket",
+				Prefix:        "production/",
+				VersionDigits: 14,
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -92,6 +235,15 @@ type fakeS3 struct {
 	s3.S3
 	bucket  string
 	objects map[string]string
+	gets    int
+
+	// pageSize limits the keys listed at once, listed counts them
+	pageSize int
+	listed   int
+}
+
+func etag(data string) *string {
+	return aws.String(fmt.Sprintf(`"%x"`, md5.Sum([]byte(data))))
 }
 
 func (s *fakeS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
@@ -101,16 +253,30 @@ func (s *fakeS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput,
 	}
 	prefix := aws.StringValue(input.Prefix)
 	delimiter := aws.StringValue(input.Delimiter)
-	var output s3.ListObjectsOutput
+	marker := aws.StringValue(input.Marker)
+	names := make([]string, 0, len(s.objects))
 	for name := range s.objects {
-		if strings.HasPrefix(name, prefix) {
-			if delimiter == "" || !strings.Contains(strings.Replace(name, prefix, "", 1), delimiter) {
-				output.Contents = append(output.Contents, &s3.Object{
-					Key: aws.String(name),
-				})
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var output s3.ListObjectsOutput
+	for _, name := range names {
+		if name <= marker || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if delimiter == "" || !strings.Contains(strings.Replace(name, prefix, "", 1), delimiter) {
+			if s.pageSize > 0 && len(output.Contents) == s.pageSize {
+				output.IsTruncated = aws.Bool(true)
+				output.NextMarker = output.Contents[len(output.Contents)-1].Key
+				break
 			}
+			output.Contents = append(output.Contents, &s3.Object{
+				Key:  aws.String(name),
+				ETag: etag(s.objects[name]),
+			})
 		}
 	}
+	s.listed += len(output.Contents)
 	return &output, nil
 }
 
@@ -120,8 +286,9 @@ func (s *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error
 		return nil, errors.New("bucket not found")
 	}
 	if data, ok := s.objects[aws.StringValue(input.Key)]; ok {
+		s.gets++
 		body := ioutil.NopCloser(strings.NewReader(data))
-		return &s3.GetObjectOutput{Body: body}, nil
+		return &s3.GetObjectOutput{Body: body, ETag: etag(data)}, nil
 	}
 	return nil, errors.New("object not found")
 }
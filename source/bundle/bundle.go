@@ -0,0 +1,302 @@
+// Package bundle packages migrations into a single release archive, which
+// can be applied on hosts without access to the repository of the
+// migrations. A bundle is a gzip compressed tar archive holding
+//  metadata.json         name and creation time of the bundle
+//  manifest              signed checksums of the migrations, see package manifest
+//  migrations/1_name.up.migration
+//  migrations/1_name.down.migration
+//  ...
+// Reading a bundle verifies every migration against the manifest.
+//
+// The driver reads bundles from files:
+//  bundle:///absolute/path/rel-1.42.mbundle
+//  bundle://relative/path/rel-1.42.mbundle?x-public-key=/path/to/key.pub
+// With x-public-key, the signature of the manifest is verified with the SSH
+// public key (in authorized_keys format) in that file.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nurl "net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	"golang.org/x/crypto/ssh"
+)
+
+func init() {
+	source.Register("bundle", &Bundle{})
+}
+
+const (
+	metadataName  = "metadata.json"
+	manifestName  = "manifest"
+	migrationsDir = "migrations/"
+	extension     = "migration"
+)
+
+// Metadata describes a bundle. It isn't covered by the signature.
+type Metadata struct {
+	// Name of the bundle, e.g. the release it belongs to.
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	// Creator is the tool which wrote the bundle.
+	Creator string `json:"creator,omitempty"`
+}
+
+// Write reads all migrations of src and writes them, along with meta and
+// their manifest signed by signer, as bundle to w.
+func Write(w io.Writer, src source.Driver, meta Metadata, signer ssh.Signer) error {
+	type file struct {
+		name string
+		body []byte
+	}
+	var files []file
+	m := &manifest.Manifest{}
+
+	version, err := src.First()
+	for err == nil {
+		e := manifest.Entry{Version: version}
+		for _, direction := range []source.Direction{source.Up, source.Down} {
+			read := src.ReadUp
+			if direction == source.Down {
+				read = src.ReadDown
+			}
+			body, identifier, err := readAll(read(version))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if direction == source.Up {
+				e.Up = manifest.Checksum(body)
+			} else {
+				e.Down = manifest.Checksum(body)
+			}
+			name := fmt.Sprintf("%v%v_%v.%v.%v", migrationsDir, version, identifier, direction, extension)
+			files = append(files, file{name: name, body: body})
+		}
+		m.Entries = append(m.Entries, e)
+		version, err = src.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err := m.Sign(signer); err != nil {
+		return err
+	}
+
+	metaBody, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	var manifestBody bytes.Buffer
+	if _, err := m.WriteTo(&manifestBody); err != nil {
+		return err
+	}
+	files = append([]file{{name: metadataName, body: metaBody}, {name: manifestName, body: manifestBody.Bytes()}}, files...)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), ModTime: meta.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.body); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func readAll(r io.ReadCloser, identifier string, err error) ([]byte, string, error) {
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	return body, identifier, err
+}
+
+// Bundle is a source driver reading migrations from a bundle.
+type Bundle struct {
+	Metadata Metadata
+	// Manifest covers every migration of the bundle.
+	Manifest *manifest.Manifest
+
+	url        string
+	migrations *source.Migrations
+	bodies     map[string][]byte
+}
+
+// Read reads a bundle written by Write and verifies its migrations against
+// its manifest, but not the signature of the manifest, see VerifySignature.
+func Read(r io.Reader) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	b := &Bundle{migrations: source.NewMigrations(), bodies: make(map[string][]byte)}
+	var migrations []*source.Migration
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case hdr.Name == metadataName:
+			if err := json.Unmarshal(body, &b.Metadata); err != nil {
+				return nil, fmt.Errorf("invalid %v: %v", metadataName, err)
+			}
+		case hdr.Name == manifestName:
+			if b.Manifest, err = manifest.Read(bytes.NewReader(body)); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(hdr.Name, migrationsDir):
+			m, err := source.Parse(path.Base(hdr.Name))
+			if err != nil {
+				return nil, fmt.Errorf("invalid migration %v in bundle", hdr.Name)
+			}
+			if !b.migrations.Append(m) {
+				return nil, fmt.Errorf("duplicate migration %v in bundle", hdr.Name)
+			}
+			migrations = append(migrations, m)
+			b.bodies[m.Raw] = body
+		}
+	}
+
+	if b.Manifest == nil {
+		return nil, fmt.Errorf("bundle has no %v", manifestName)
+	}
+	covered := 0
+	for _, e := range b.Manifest.Entries {
+		if e.Up != "" {
+			covered++
+		}
+		if e.Down != "" {
+			covered++
+		}
+	}
+	if covered != len(migrations) {
+		return nil, fmt.Errorf("migrations of the bundle don't match its manifest")
+	}
+	for _, m := range migrations {
+		if err := b.Manifest.Verify(m.Version, m.Direction, b.bodies[m.Raw]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// VerifySignature returns nil if the manifest of the bundle is signed by key.
+func (b *Bundle) VerifySignature(key ssh.PublicKey) error {
+	return b.Manifest.VerifySignature(key)
+}
+
+// Open reads the bundle file of url.
+func (b *Bundle) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	// concat host and path to restore full path, like the file driver
+	p := u.Opaque
+	if len(p) == 0 {
+		p = u.Host + u.Path
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	nb, err := Read(f)
+	if err != nil {
+		return nil, err
+	}
+	nb.url = url
+
+	if keyFile := u.Query().Get("x-public-key"); keyFile != "" {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := nb.VerifySignature(pub); err != nil {
+			return nil, err
+		}
+	}
+	return nb, nil
+}
+
+// Close is part of source.Driver interface implementation. This is a no-op.
+func (b *Bundle) Close() error {
+	return nil
+}
+
+// First is part of source.Driver interface implementation.
+func (b *Bundle) First() (version uint, err error) {
+	if v, ok := b.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: b.url, Err: os.ErrNotExist}
+}
+
+// Prev is part of source.Driver interface implementation.
+func (b *Bundle) Prev(version uint) (prevVersion uint, err error) {
+	if v, ok := b.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: b.url, Err: os.ErrNotExist}
+}
+
+// Next is part of source.Driver interface implementation.
+func (b *Bundle) Next(version uint) (nextVersion uint, err error) {
+	if v, ok := b.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: b.url, Err: os.ErrNotExist}
+}
+
+// ReadUp is part of source.Driver interface implementation.
+func (b *Bundle) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := b.migrations.Up(version); ok {
+		return ioutil.NopCloser(bytes.NewReader(b.bodies[m.Raw])), m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read up for version %v", version), Path: b.url, Err: os.ErrNotExist}
+}
+
+// ReadDown is part of source.Driver interface implementation.
+func (b *Bundle) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := b.migrations.Down(version); ok {
+		return ioutil.NopCloser(bytes.NewReader(b.bodies[m.Raw])), m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read down for version %v", version), Path: b.url, Err: os.ErrNotExist}
+}
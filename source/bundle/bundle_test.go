@@ -0,0 +1,167 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/manifest"
+	st "github.com/golang-migrate/migrate/v4/source/testing"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// writeBundle writes a bundle of migrations which meet the driver test
+// requirements to the returned file.
+func writeBundle(t *testing.T, dir string, signer ssh.Signer) string {
+	migrations := filepath.Join(dir, "migrations")
+	if err := os.Mkdir(migrations, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"1_foobar.up.sql":   "1 up",
+		"1_foobar.down.sql": "1 down",
+		"3_foobar.up.sql":   "3 up",
+		"4_foobar.up.sql":   "4 up",
+		"4_foobar.down.sql": "4 down",
+		"5_foobar.down.sql": "5 down",
+		"7_foobar.up.sql":   "7 up",
+		"7_foobar.down.sql": "7 down",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(migrations, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := source.Open("file://" + migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	var buf bytes.Buffer
+	meta := Metadata{Name: "rel-1.42", Created: time.Now().UTC().Truncate(time.Second)}
+	if err := Write(&buf, src, meta, signer); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(dir, "rel-1.42.mbundle")
+	if err := ioutil.WriteFile(fname, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func Test(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	fname := writeBundle(t, dir, newSigner(t))
+	d, err := (&Bundle{}).Open("bundle://" + fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := d.(*Bundle); b.Metadata.Name != "rel-1.42" || len(b.Manifest.Entries) != 5 {
+		t.Errorf("unexpected metadata %+v or manifest %+v", b.Metadata, b.Manifest)
+	}
+	st.Test(t, d)
+}
+
+func TestOpenVerifySignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	signer := newSigner(t)
+	fname := writeBundle(t, dir, signer)
+	keyFile := filepath.Join(dir, "key.pub")
+	if err := ioutil.WriteFile(keyFile, ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Bundle{}).Open("bundle://" + fname + "?x-public-key=" + keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	otherFile := filepath.Join(dir, "other.pub")
+	if err := ioutil.WriteFile(otherFile, ssh.MarshalAuthorizedKey(newSigner(t).PublicKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Bundle{}).Open("bundle://" + fname + "?x-public-key=" + otherFile); err != manifest.ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestReadTampered(t *testing.T) {
+	m := &manifest.Manifest{Entries: []manifest.Entry{{Version: 1, Up: manifest.Checksum([]byte("1 up"))}}}
+	var manifestBody bytes.Buffer
+	if _, err := m.WriteTo(&manifestBody); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"changed", map[string]string{"migrations/1_foobar.up.migration": "1 changed"}},
+		{"added", map[string]string{"migrations/1_foobar.up.migration": "1 up", "migrations/1_foobar.down.migration": "1 down"}},
+		{"removed", map[string]string{}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			tc.files[manifestName] = manifestBody.String()
+			for name, body := range tc.files {
+				if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tw.Write([]byte(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := gz.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Read(&buf); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
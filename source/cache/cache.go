@@ -0,0 +1,110 @@
+// Package cache keeps the listings and migration bodies of remote source
+// drivers on disk, so that repeated runs don't download them again.
+//
+// Bodies are stored under a key which changes with their content, e.g. the
+// ETag of an object in a bucket, so an entry is valid as long as its key is.
+// HTTP responses are revalidated with conditional requests, see Transport.
+// Entries are never removed, remove the directory to clear the cache.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// Param is the URL query parameter of the source drivers which cache in
+// the directory it is set to.
+const Param = "x-cache-dir"
+
+// Cache is a cache in a directory.
+type Cache struct {
+	Dir string
+}
+
+// Open returns the cache in dir, which is created if it doesn't exist.
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: dir}, nil
+}
+
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns a reader of the entry of key, with its size as hint, see
+// source.Sizer. It returns false if there is no entry.
+func (c *Cache) Get(key string) (io.ReadCloser, bool) {
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return f, true
+}
+
+// Put returns a reader of r, which stores what is read as the entry of
+// key once r is read to the end. An entry read partially isn't stored.
+func (c *Cache) Put(key string, r io.ReadCloser) io.ReadCloser {
+	f, err := ioutil.TempFile(c.Dir, ".put-")
+	if err != nil {
+		// reading still works without the cache
+		return r
+	}
+	return &put{ReadCloser: r, file: f, path: c.path(key), size: source.Size(r)}
+}
+
+type put struct {
+	io.ReadCloser
+	file *os.File
+	path string
+	size int64
+	err  error
+}
+
+func (p *put) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	if p.file == nil {
+		return n, err
+	}
+	if _, errWrite := p.file.Write(b[:n]); errWrite != nil && p.err == nil {
+		p.err = errWrite
+	}
+	if err == io.EOF {
+		p.store()
+	}
+	return n, err
+}
+
+// store moves the complete entry into place, unless writing it failed.
+func (p *put) store() {
+	err := p.file.Close()
+	if err == nil && p.err == nil {
+		err = os.Rename(p.file.Name(), p.path)
+	}
+	if err != nil || p.err != nil {
+		os.Remove(p.file.Name())
+	}
+	p.file = nil
+}
+
+// Size implements source.Sizer.
+func (p *put) Size() int64 {
+	return p.size
+}
+
+func (p *put) Close() error {
+	if p.file != nil {
+		p.file.Close()
+		os.Remove(p.file.Name())
+		p.file = nil
+	}
+	return p.ReadCloser.Close()
+}
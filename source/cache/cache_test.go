@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func tempCache(t *testing.T) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func TestPut(t *testing.T) {
+	c, cleanup := tempCache(t)
+	defer cleanup()
+
+	if _, ok := c.Get("1"); ok {
+		t.Fatal("expected no entry")
+	}
+
+	// read partially, not stored
+	r := c.Put("1", ioutil.NopCloser(strings.NewReader("CREATE 1")))
+	if _, err := r.Read(make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("1"); ok {
+		t.Fatal("expected no entry after reading partially")
+	}
+
+	r = c.Put("1", ioutil.NopCloser(strings.NewReader("CREATE 1")))
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != "CREATE 1" {
+		t.Fatalf("expected CREATE 1, got %q, %v", b, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cached, ok := c.Get("1")
+	if !ok {
+		t.Fatal("expected an entry")
+	}
+	defer cached.Close()
+	if size := source.Size(cached); size != 8 {
+		t.Fatalf("expected size 8, got %v", size)
+	}
+	if b, err := ioutil.ReadAll(cached); err != nil || string(b) != "CREATE 1" {
+		t.Fatalf("expected CREATE 1, got %q, %v", b, err)
+	}
+
+	// no temporary files are left behind
+	files, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %v", len(files))
+	}
+}
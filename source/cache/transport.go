@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// Transport is an http.RoundTripper which keeps the responses of GET
+// requests with an ETag in Cache. Cached responses are revalidated with a
+// conditional request and served from the cache if the server answers
+// 304 Not Modified, which e.g. doesn't count against GitHub's rate limit.
+type Transport struct {
+	Cache *Cache
+
+	// Base is the transport making the requests, http.DefaultTransport
+	// if nil.
+	Base http.RoundTripper
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base().RoundTrip(req)
+	}
+	key := responseKey(req)
+
+	cached, etag := t.cached(key, req)
+	if etag != "" {
+		// the request must not be modified
+		r := new(http.Request)
+		*r = *req
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		r.Header.Set("If-None-Match", etag)
+		req = r
+	}
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		return cached, nil
+	}
+	if cached != nil {
+		cached.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+		return resp, nil
+	}
+	return t.store(key, req, resp)
+}
+
+// responseKey is the key of the response to req. Credentials are part of
+// the key, as they may see different responses.
+func responseKey(req *http.Request) string {
+	auth := sha256.Sum256([]byte(req.Header.Get("Authorization")))
+	return "http " + req.URL.String() + " " + hex.EncodeToString(auth[:])
+}
+
+// cached returns the cached response of key and its ETag, if any.
+func (t *Transport) cached(key string, req *http.Request) (*http.Response, string) {
+	f, ok := t.Cache.Get(key)
+	if !ok {
+		return nil, ""
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(f), req)
+	if err != nil {
+		f.Close()
+		return nil, ""
+	}
+	resp.Body = fileBody{resp.Body, f}
+	return resp, resp.Header.Get("ETag")
+}
+
+// fileBody is the body of a cached response, read from file.
+type fileBody struct {
+	io.ReadCloser
+	file io.Closer
+}
+
+func (b fileBody) Close() error {
+	b.ReadCloser.Close()
+	return b.file.Close()
+}
+
+// store writes resp to the cache and returns it read from there.
+func (t *Transport) store(key string, req *http.Request, resp *http.Response) (*http.Response, error) {
+	defer resp.Body.Close()
+	f, err := ioutil.TempFile(t.Cache.Dir, ".response-")
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.Write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), t.Cache.path(key)); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	cached, _ := t.cached(key, req)
+	if cached == nil {
+		return nil, os.ErrNotExist
+	}
+	return cached, nil
+}
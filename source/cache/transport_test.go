@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	c, cleanup := tempCache(t)
+	defer cleanup()
+
+	body := "listing 1"
+	var ok, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + body + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		ok++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{Cache: c}}
+	get := func(auth string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/contents", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", auth)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %v", resp.StatusCode)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if b := get("token a"); b != "listing 1" || ok != 1 {
+		t.Fatalf("expected listing 1 downloaded, got %q, %v downloads", b, ok)
+	}
+	if b := get("token a"); b != "listing 1" || ok != 1 || notModified != 1 {
+		t.Fatalf("expected listing 1 revalidated, got %q, %v downloads, %v not modified", b, ok, notModified)
+	}
+	// other credentials don't share the cache
+	if b := get("token b"); b != "listing 1" || ok != 2 {
+		t.Fatalf("expected listing 1 downloaded, got %q, %v downloads", b, ok)
+	}
+	body = "listing 2"
+	if b := get("token a"); b != "listing 2" || ok != 3 {
+		t.Fatalf("expected listing 2 downloaded, got %q, %v downloads", b, ok)
+	}
+	if b := get("token a"); b != "listing 2" || notModified != 2 {
+		t.Fatalf("expected listing 2 revalidated, got %q, %v not modified", b, notModified)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	nurl "net/url"
+	"os"
 	"sync"
 )
 
@@ -72,6 +73,106 @@ type Driver interface {
 	ReadDown(version uint) (r io.ReadCloser, identifier string, err error)
 }
 
+// Orderer is implemented by drivers whose migrations aren't ordered by
+// version number, i.e. First, Prev and Next follow another order.
+type Orderer interface {
+	// Index returns the position of version in the order of migrations.
+	// If version isn't available, it must return os.ErrNotExist.
+	Index(version uint) (int, error)
+}
+
+// DialectSelector is implemented by drivers which support migrations
+// written for a specific database driver, e.g. 1_name.postgres.up.sql.
+// Migrate selects the dialect of its database driver.
+type DialectSelector interface {
+	// SelectDialect makes the driver prefer the migrations written for
+	// dialect, falling back to generic migrations.
+	SelectDialect(dialect string)
+}
+
+// RangeLister is implemented by drivers which can list only the migrations
+// from a version on, e.g. remote sources with many migrations, which would
+// otherwise list all of them up front. Before running up, Migrate calls
+// ListFrom with the version of the database, as no earlier migration is read
+// then. The driver must still answer for earlier versions afterwards, e.g. by
+// listing all migrations once asked for one.
+type RangeLister interface {
+	// ListFrom lists the migrations from version on, including version.
+	ListFrom(version uint) error
+}
+
+// FileReader is implemented by drivers which can read files other than
+// migrations from the root of the source, e.g. AliasFile.
+type FileReader interface {
+	// ReadFile returns the file name in the root of the source.
+	// If there is no such file, it must return os.ErrNotExist.
+	ReadFile(name string) (io.ReadCloser, error)
+}
+
+// Identifier is implemented by drivers which know the identifiers of their
+// migrations without reading them, e.g. from the names of their files, so
+// listing the migrations of a remote source doesn't download them.
+type Identifier interface {
+	// Identify returns the identifier of the migration of version in
+	// direction. If there is no such migration, it must return
+	// os.ErrNotExist.
+	Identify(version uint, direction Direction) (string, error)
+}
+
+// Identify returns the identifier of the migration of version in direction,
+// from the driver if it is an Identifier, or else by opening the migration
+// with ReadUp or ReadDown.
+func Identify(d Driver, version uint, direction Direction) (string, error) {
+	if identifier, ok := d.(Identifier); ok {
+		return identifier.Identify(version, direction)
+	}
+	read := d.ReadUp
+	if direction == Down {
+		read = d.ReadDown
+	}
+	r, identifier, err := read(version)
+	if err != nil {
+		return "", err
+	}
+	return identifier, r.Close()
+}
+
+// Sizer is optionally implemented by the readers returned by ReadUp and
+// ReadDown, which know the size of the migration body without reading it,
+// e.g. from the metadata of an object in a bucket.
+type Sizer interface {
+	// Size returns the size of the body in bytes.
+	Size() int64
+}
+
+// Size returns the size hint of a migration body r, either from Sizer or,
+// for files, from Stat. It returns -1 if the size is unknown.
+func Size(r io.Reader) int64 {
+	switch r := r.(type) {
+	case Sizer:
+		return r.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return -1
+}
+
+// WithSize returns r with the size hint size, see Sizer.
+func WithSize(r io.ReadCloser, size int64) io.ReadCloser {
+	return sized{r, size}
+}
+
+type sized struct {
+	io.ReadCloser
+	size int64
+}
+
+func (s sized) Size() int64 {
+	return s.size
+}
+
 // Open returns a new driver instance.
 func Open(url string) (Driver, error) {
 	u, err := nurl.Parse(url)
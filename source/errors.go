@@ -1,15 +1,33 @@
 package source
 
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
 // ErrDuplicateMigration is an error type for reporting duplicate migration
 // files.
 type ErrDuplicateMigration struct {
 	Migration
 	os.FileInfo
+
+	// Other is the migration which has the version already, if known.
+	Other *Migration
 }
 
 // Error implements error interface.
 func (e ErrDuplicateMigration) Error() string {
-	return "duplicate migration file: " + e.Name()
+	name := e.Raw
+	if e.FileInfo != nil {
+		name = e.Name()
+	}
+	if e.Other != nil {
+		// in order, as drivers may list files in any order
+		first, second := e.Other.Raw, name
+		if second < first {
+			first, second = second, first
+		}
+		return fmt.Sprintf("duplicate migration version %v: %v and %v", e.Version, first, second)
+	}
+	return "duplicate migration file: " + name
 }
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/golang-migrate/migrate/v4/source"
 	st "github.com/golang-migrate/migrate/v4/source/testing"
 )
 
@@ -161,6 +162,102 @@ func TestOpenWithDuplicateVersion(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected err")
 	}
+	if expected := "duplicate migration version 1: 1_bar.up.sql and 1_foo.up.sql"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err)
+	}
+}
+
+func TestOpenWithDuplicateVersionOtherDirection(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenWithDuplicateVersionOtherDirection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	mustWriteFile(t, tmpDir, "1_bar.down.sql", "")
+	mustWriteFile(t, tmpDir, "1_foo.up.sql", "")
+
+	f := &File{}
+	if _, err = f.Open("file://" + tmpDir); err == nil {
+		t.Fatal("expected err")
+	}
+	if expected := "duplicate migration version 1: 1_bar.down.sql and 1_foo.up.sql"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err)
+	}
+}
+
+func TestOpenWithIgnoreFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenWithIgnoreFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	mustWriteFile(t, tmpDir, ".migrateignore", "*_wip.*\n")
+	mustWriteFile(t, tmpDir, "1_foo.up.sql", "")
+	mustWriteFile(t, tmpDir, "2_bar.up.sql", "")
+	mustWriteFile(t, tmpDir, "2_bar_wip.up.sql", "") // would be a duplicate
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ident, err := d.ReadUp(2); err != nil || ident != "bar" {
+		t.Fatalf("expected 2_bar, got %v, %v", ident, err)
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestResolveVersion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	mustWriteFile(t, tmpDir, "20230110083000_shard.up.sql", "")
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.ResolveVersion(d, "pre-sharding"); err == nil {
+		t.Fatal("expected unknown alias without aliases.yaml")
+	}
+
+	mustWriteFile(t, tmpDir, "aliases.yaml", "pre-sharding: 20230110083000\n")
+	tt := []struct {
+		version   string
+		expected  uint
+		expectErr bool
+	}{
+		{"pre-sharding", 20230110083000, false},
+		{"42", 42, false},
+		{"post-sharding", 0, true},
+	}
+	for _, tc := range tt {
+		v, err := source.ResolveVersion(d, tc.version)
+		if (err != nil) != tc.expectErr || v != tc.expected {
+			t.Errorf("%v: expected %v, got %v, %v", tc.version, tc.expected, v, err)
+		}
+	}
+
+	mustWriteFile(t, tmpDir, "aliases.yaml", "pre-sharding: soon\n")
+	if _, err := source.ResolveVersion(d, "pre-sharding"); err == nil {
+		t.Error("expected error for invalid version")
+	}
 }
 
 func TestClose(t *testing.T) {
@@ -0,0 +1,169 @@
+// Package filter applies a subset of the migrations of a source driver, so
+// that a shared tree of migrations can be applied to a particular target.
+//
+// Migrations are selected by glob patterns matching their name, the version
+// and the identifier of the migration joined by _, e.g. 12_bigdata_load for
+// the file 12_bigdata_load.up.sql. Patterns are globs, see
+// source.CompileGlob, ** matches / for identifiers with a path.
+package filter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// Filter wraps a source driver, leaving out the migrations whose names
+// don't match its patterns.
+type Filter struct {
+	src      source.Driver
+	versions []uint
+	index    map[uint]int
+}
+
+// New lists the migrations of src and keeps the ones whose names match one
+// of include, or all if include is empty, and none of exclude.
+func New(src source.Driver, include, exclude []string) (*Filter, error) {
+	includes, err := compile(include)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := compile(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{src: src, index: make(map[uint]int)}
+	version, err := src.First()
+	for err == nil {
+		var identifier string
+		if identifier, err = readIdentifier(src, version); err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%v_%v", version, identifier)
+		if (len(includes) == 0 || matchAny(includes, name)) && !matchAny(excludes, name) {
+			f.index[version] = len(f.versions)
+			f.versions = append(f.versions, version)
+		}
+		version, err = src.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return f, nil
+}
+
+// readIdentifier returns the identifier of the up migration of version,
+// or of the down migration if there is none.
+func readIdentifier(src source.Driver, version uint) (string, error) {
+	r, identifier, err := src.ReadUp(version)
+	if os.IsNotExist(err) {
+		r, identifier, err = src.ReadDown(version)
+	}
+	if err != nil {
+		return "", err
+	}
+	return identifier, r.Close()
+}
+
+// compile translates glob patterns to regular expressions.
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := source.CompileGlob(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAny(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Versions returns the versions of the migrations kept, in order.
+func (f *Filter) Versions() []uint {
+	return append([]uint{}, f.versions...)
+}
+
+// Open isn't supported, wrap an opened source driver with New instead.
+func (f *Filter) Open(url string) (source.Driver, error) {
+	return nil, fmt.Errorf("filter: Open is not supported, use New")
+}
+
+func (f *Filter) Close() error {
+	return f.src.Close()
+}
+
+func (f *Filter) First() (version uint, err error) {
+	if len(f.versions) == 0 {
+		return 0, &os.PathError{Op: "first", Path: "filter", Err: os.ErrNotExist}
+	}
+	return f.versions[0], nil
+}
+
+func (f *Filter) Prev(version uint) (prevVersion uint, err error) {
+	i, ok := f.index[version]
+	if !ok || i == 0 {
+		return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: "filter", Err: os.ErrNotExist}
+	}
+	return f.versions[i-1], nil
+}
+
+func (f *Filter) Next(version uint) (nextVersion uint, err error) {
+	i, ok := f.index[version]
+	if !ok || i == len(f.versions)-1 {
+		return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: "filter", Err: os.ErrNotExist}
+	}
+	return f.versions[i+1], nil
+}
+
+func (f *Filter) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if _, ok := f.index[version]; !ok {
+		return nil, "", &os.PathError{Op: fmt.Sprintf("read up for version %v", version), Path: "filter", Err: os.ErrNotExist}
+	}
+	return f.src.ReadUp(version)
+}
+
+func (f *Filter) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if _, ok := f.index[version]; !ok {
+		return nil, "", &os.PathError{Op: fmt.Sprintf("read down for version %v", version), Path: "filter", Err: os.ErrNotExist}
+	}
+	return f.src.ReadDown(version)
+}
+
+// Describe implements source.Describer with the metadata of the wrapped
+// driver.
+func (f *Filter) Describe(version uint, direction source.Direction) (source.Metadata, error) {
+	if _, ok := f.index[version]; !ok {
+		return source.Metadata{}, &os.PathError{Op: fmt.Sprintf("describe %v for version %v", direction, version), Path: "filter", Err: os.ErrNotExist}
+	}
+	return source.Describe(f.src, version, direction)
+}
+
+// Identify implements source.Identifier with the identifiers of the
+// wrapped driver.
+func (f *Filter) Identify(version uint, direction source.Direction) (string, error) {
+	if _, ok := f.index[version]; !ok {
+		return "", &os.PathError{Op: fmt.Sprintf("identify %v for version %v", direction, version), Path: "filter", Err: os.ErrNotExist}
+	}
+	return source.Identify(f.src, version, direction)
+}
+
+// ReadFile implements source.FileReader, if the wrapped driver does.
+func (f *Filter) ReadFile(name string) (io.ReadCloser, error) {
+	if fr, ok := f.src.(source.FileReader); ok {
+		return fr.ReadFile(name)
+	}
+	return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+}
@@ -0,0 +1,127 @@
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/file"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{
+		"1_init.up.sql", "1_init.down.sql",
+		"2_billing_invoices.up.sql", "2_billing_invoices.down.sql",
+		"3_billing_bigdata_load.up.sql",
+		"4_orders.down.sql",
+		"5_billing_refunds.up.sql",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []uint
+	}{
+		{name: "all", expected: []uint{1, 2, 3, 4, 5}},
+		{name: "include", include: []string{"*_billing_*"}, expected: []uint{2, 3, 5}},
+		{name: "several includes", include: []string{"*_billing_*", "?_init"}, expected: []uint{1, 2, 3, 5}},
+		{name: "exclude", exclude: []string{"*_bigdata*"}, expected: []uint{1, 2, 4, 5}},
+		{name: "include and exclude", include: []string{"*_billing_*"}, exclude: []string{"*_bigdata*"}, expected: []uint{2, 5}},
+		{name: "down only", include: []string{"[4-9]_*"}, expected: []uint{4, 5}},
+		{name: "nothing", include: []string{"billing/**"}, expected: []uint{}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := (&file.File{}).Open("file://" + dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := New(src, tc.include, tc.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(f.Versions(), tc.expected) {
+				t.Fatalf("expected versions %v, got %v", tc.expected, f.Versions())
+			}
+
+			versions := []uint{}
+			for v, err := f.First(); err == nil; v, err = f.Next(v) {
+				versions = append(versions, v)
+			}
+			if !reflect.DeepEqual(versions, tc.expected) {
+				t.Errorf("expected to iterate %v, got %v", tc.expected, versions)
+			}
+		})
+	}
+}
+
+func TestReadLeftOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"1_init.up.sql", "2_bigdata.up.sql", "3_users.up.sql"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src, err := (&file.File{}).Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(src, nil, []string{"*_bigdata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.ReadUp(2); !os.IsNotExist(err) {
+		t.Errorf("expected left out migration not to exist, got %v", err)
+	}
+	if next, err := f.Next(1); err != nil || next != 3 {
+		t.Errorf("expected 3 after 1, got %v, %v", next, err)
+	}
+	if prev, err := f.Prev(3); err != nil || prev != 1 {
+		t.Errorf("expected 1 before 3, got %v, %v", prev, err)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tt := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*_users", "12_users", true},
+		{"*_users", "12_users_index", false},
+		{"*", "12_billing/users", false},
+		{"**", "12_billing/users", true},
+		{"12_?sers", "12_users", true},
+		{"[!1]*", "12_users", false},
+		{"12\\_users", "12_users", true},
+		{"1.2", "112", false},
+	}
+	for _, tc := range tt {
+		res, err := compile([]string{tc.pattern})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match := matchAny(res, tc.name); match != tc.match {
+			t.Errorf("expected %q matching %q to be %v", tc.pattern, tc.name, tc.match)
+		}
+	}
+	if _, err := compile([]string{"[a-"}); err == nil {
+		t.Error("expected error for unterminated [")
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 import (
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/cache"
 	"github.com/google/go-github/github"
 )
 
@@ -61,6 +62,14 @@ func (g *Github) Open(url string) (source.Driver, error) {
 		Username: u.User.Username(),
 		Password: password,
 	}
+	if dir := u.Query().Get(cache.Param); dir != "" {
+		c, err := cache.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		// revalidated responses don't count against the rate limit
+		tr.Transport = &cache.Transport{Cache: c}
+	}
 
 	gn := &Github{
 		client:     github.NewClient(tr.Client()),
@@ -126,8 +135,8 @@ func (g *Github) readDirectory() error {
 		if err != nil {
 			continue // ignore files that we can't parse
 		}
-		if !g.migrations.Append(m) {
-			return fmt.Errorf("unable to parse file %v", *fi.Name)
+		if err := g.migrations.Add(m); err != nil {
+			return err
 		}
 	}
 
@@ -144,6 +153,10 @@ func (g *Github) Close() error {
 	return nil
 }
 
+func (g *Github) SelectDialect(dialect string) {
+	g.migrations.SelectDialect(dialect)
+}
+
 func (g *Github) First() (version uint, er error) {
 	g.ensureFields()
 
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/golang-migrate/migrate/v4/proxy"
 	"github.com/golang-migrate/migrate/v4/source"
 	gh "github.com/golang-migrate/migrate/v4/source/github"
 	"github.com/google/go-github/github"
@@ -71,11 +72,19 @@ func (g *GithubEE) Open(url string) (source.Driver, error) {
 	return &GithubEE{Driver: i}, nil
 }
 
+// SelectDialect is passed on to the embedded github driver.
+func (g *GithubEE) SelectDialect(dialect string) {
+	if d, ok := g.Driver.(source.DialectSelector); ok {
+		d.SelectDialect(dialect)
+	}
+}
+
 func (g *GithubEE) createGithubClient(host, username, password string, verifyTLS bool) (*github.Client, error) {
 	tr := &github.BasicAuthTransport{
 		Username: username,
 		Password: password,
 		Transport: &http.Transport{
+			Proxy:           proxy.HTTP,
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: !verifyTLS},
 		},
 	}
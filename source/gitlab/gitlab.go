@@ -128,8 +128,8 @@ func (g *Gitlab) readDirectory() error {
 			continue
 		}
 
-		if !g.migrations.Append(m) {
-			return fmt.Errorf("unable to parse file %v", nodes[i].Name)
+		if err := g.migrations.Add(m); err != nil {
+			return err
 		}
 	}
 
@@ -157,6 +157,10 @@ func (g *Gitlab) Close() error {
 	return nil
 }
 
+func (g *Gitlab) SelectDialect(dialect string) {
+	g.migrations.SelectDialect(dialect)
+}
+
 func (g *Gitlab) First() (version uint, er error) {
 	if v, ok := g.migrations.First(); !ok {
 		return 0, &os.PathError{Op: "first", Path: g.path, Err: os.ErrNotExist}
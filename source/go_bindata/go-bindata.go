@@ -60,8 +60,8 @@ func WithInstance(instance interface{}) (source.Driver, error) {
 			continue // ignore files that we can't parse
 		}
 
-		if !bn.migrations.Append(m) {
-			return nil, fmt.Errorf("unable to parse file %v", fi)
+		if err := bn.migrations.Add(m); err != nil {
+			return nil, err
 		}
 	}
 
@@ -72,6 +72,10 @@ func (b *Bindata) Close() error {
 	return nil
 }
 
+func (b *Bindata) SelectDialect(dialect string) {
+	b.migrations.SelectDialect(dialect)
+}
+
 func (b *Bindata) First() (version uint, err error) {
 	if v, ok := b.migrations.First(); !ok {
 		return 0, &os.PathError{Op: "first", Path: b.path, Err: os.ErrNotExist}
@@ -1,7 +1,6 @@
 package googlecloudstorage
 
 import (
-	"fmt"
 	"io"
 	"net/url"
 	"os"
@@ -57,8 +56,8 @@ func (g *gcs) loadMigrations() error {
 		if parseErr != nil {
 			continue
 		}
-		if !g.migrations.Append(m) {
-			return fmt.Errorf("unable to parse file %v", object.Name)
+		if err := g.migrations.Add(m); err != nil {
+			return err
 		}
 	}
 	if err != iterator.Done {
@@ -71,6 +70,10 @@ func (g *gcs) Close() error {
 	return nil
 }
 
+func (g *gcs) SelectDialect(dialect string) {
+	g.migrations.SelectDialect(dialect)
+}
+
 func (g *gcs) First() (uint, error) {
 	v, ok := g.migrations.First()
 	if !ok {
@@ -0,0 +1,233 @@
+// Package graph orders migrations by their dependencies instead of purely
+// by version number. Dependencies are declared with the depends-on pragma
+// of the up migration, e.g.
+//  -- migrate:depends-on 3 5
+// The dependencies form a directed acyclic graph, which is sorted
+// topologically. Of all migrations whose dependencies are met,
+// the one with the lowest version comes first, so the order is
+// deterministic and migrations without dependencies keep their
+// numeric order.
+package graph
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// ErrCycle is returned if the dependencies of migrations form a cycle.
+type ErrCycle struct {
+	Versions []uint
+}
+
+func (e ErrCycle) Error() string {
+	versions := make([]string, 0, len(e.Versions))
+	for _, v := range e.Versions {
+		versions = append(versions, strconv.FormatUint(uint64(v), 10))
+	}
+	return fmt.Sprintf("dependency cycle between migrations %v", strings.Join(versions, ", "))
+}
+
+// ErrMissingDependency is returned if a migration depends
+// on a version which doesn't exist.
+type ErrMissingDependency struct {
+	Version    uint
+	Dependency uint
+}
+
+func (e ErrMissingDependency) Error() string {
+	return fmt.Sprintf("migration %v depends on missing migration %v", e.Version, e.Dependency)
+}
+
+// Graph wraps a source driver, ordering its migrations by their dependencies.
+type Graph struct {
+	src   source.Driver
+	deps  map[uint][]uint
+	order []uint
+	index map[uint]int
+}
+
+// New reads the dependencies of all migrations of src and sorts them.
+func New(src source.Driver) (*Graph, error) {
+	g := &Graph{src: src, deps: make(map[uint][]uint)}
+
+	versions := make([]uint, 0)
+	version, err := src.First()
+	for err == nil {
+		versions = append(versions, version)
+		if g.deps[version], err = readDependencies(src, version); err != nil {
+			return nil, err
+		}
+		version, err = src.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if g.order, err = sortTopologically(versions, g.deps); err != nil {
+		return nil, err
+	}
+	g.index = make(map[uint]int, len(g.order))
+	for i, v := range g.order {
+		g.index[v] = i
+	}
+	return g, nil
+}
+
+// readDependencies returns the versions listed by
+// the depends-on pragmas of the up migration of version.
+func readDependencies(src source.Driver, version uint) ([]uint, error) {
+	r, _, err := src.ReadUp(version)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make([]uint, 0)
+	for _, value := range pragma.Parse(body).All(pragma.DependsOn) {
+		for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			dep, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("migration %v: invalid dependency %q", version, field)
+			}
+			deps = append(deps, uint(dep))
+		}
+	}
+	return deps, nil
+}
+
+// sortTopologically orders versions so that every version comes after its
+// dependencies, preferring lower versions among the ones that are ready.
+func sortTopologically(versions []uint, deps map[uint][]uint) ([]uint, error) {
+	pending := make(map[uint]int, len(versions))
+	dependents := make(map[uint][]uint)
+	for _, v := range versions {
+		pending[v] = 0
+	}
+	for _, v := range versions {
+		for _, dep := range deps[v] {
+			if _, ok := pending[dep]; !ok {
+				return nil, ErrMissingDependency{Version: v, Dependency: dep}
+			}
+			pending[v]++
+			dependents[dep] = append(dependents[dep], v)
+		}
+	}
+
+	ready := make([]uint, 0)
+	for _, v := range versions {
+		if pending[v] == 0 {
+			ready = append(ready, v)
+		}
+	}
+
+	order := make([]uint, 0, len(versions))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return ready[i] < ready[j] })
+		v := ready[0]
+		ready = ready[1:]
+		order = append(order, v)
+		for _, d := range dependents[v] {
+			if pending[d]--; pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if len(order) < len(versions) {
+		cycle := make([]uint, 0)
+		for _, v := range versions {
+			if pending[v] > 0 {
+				cycle = append(cycle, v)
+			}
+		}
+		return nil, ErrCycle{Versions: cycle}
+	}
+	return order, nil
+}
+
+// Order returns all versions in the order they are applied.
+func (g *Graph) Order() []uint {
+	return append([]uint{}, g.order...)
+}
+
+// Dependencies returns the versions version depends on.
+func (g *Graph) Dependencies(version uint) []uint {
+	return append([]uint{}, g.deps[version]...)
+}
+
+// Open isn't supported, wrap an opened source driver with New instead.
+func (g *Graph) Open(url string) (source.Driver, error) {
+	return nil, fmt.Errorf("graph: Open is not supported, use New")
+}
+
+func (g *Graph) Close() error {
+	return g.src.Close()
+}
+
+func (g *Graph) First() (version uint, err error) {
+	if len(g.order) == 0 {
+		return 0, &os.PathError{Op: "first", Path: "graph", Err: os.ErrNotExist}
+	}
+	return g.order[0], nil
+}
+
+func (g *Graph) Prev(version uint) (prevVersion uint, err error) {
+	i, ok := g.index[version]
+	if !ok || i == 0 {
+		return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: "graph", Err: os.ErrNotExist}
+	}
+	return g.order[i-1], nil
+}
+
+func (g *Graph) Next(version uint) (nextVersion uint, err error) {
+	i, ok := g.index[version]
+	if !ok || i == len(g.order)-1 {
+		return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: "graph", Err: os.ErrNotExist}
+	}
+	return g.order[i+1], nil
+}
+
+// Index implements source.Orderer.
+func (g *Graph) Index(version uint) (int, error) {
+	i, ok := g.index[version]
+	if !ok {
+		return 0, &os.PathError{Op: fmt.Sprintf("index for version %v", version), Path: "graph", Err: os.ErrNotExist}
+	}
+	return i, nil
+}
+
+func (g *Graph) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	return g.src.ReadUp(version)
+}
+
+func (g *Graph) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	return g.src.ReadDown(version)
+}
+
+// Identify implements source.Identifier with the identifiers of the
+// wrapped driver.
+func (g *Graph) Identify(version uint, direction source.Direction) (string, error) {
+	return source.Identify(g.src, version, direction)
+}
+
+// ReadFile implements source.FileReader, if the wrapped driver does.
+func (g *Graph) ReadFile(name string) (io.ReadCloser, error) {
+	if fr, ok := g.src.(source.FileReader); ok {
+		return fr.ReadFile(name)
+	}
+	return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+}
@@ -0,0 +1,110 @@
+package graph
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestSortTopologically(t *testing.T) {
+	tt := []struct {
+		name      string
+		versions  []uint
+		deps      map[uint][]uint
+		expected  []uint
+		expectErr error
+	}{
+		{
+			name:     "no dependencies",
+			versions: []uint{1, 2, 3},
+			expected: []uint{1, 2, 3},
+		},
+		{
+			name:     "dependency on higher version",
+			versions: []uint{1, 2, 3},
+			deps:     map[uint][]uint{1: {3}},
+			expected: []uint{2, 3, 1},
+		},
+		{
+			name:     "diamond",
+			versions: []uint{1, 2, 3, 4, 5},
+			deps:     map[uint][]uint{1: {4}, 2: {4, 5}, 3: {1, 2}},
+			expected: []uint{4, 1, 5, 2, 3},
+		},
+		{
+			name:      "cycle",
+			versions:  []uint{1, 2, 3, 4},
+			deps:      map[uint][]uint{2: {3}, 3: {4}, 4: {2}},
+			expectErr: ErrCycle{Versions: []uint{2, 3, 4}},
+		},
+		{
+			name:      "missing dependency",
+			versions:  []uint{1, 2},
+			deps:      map[uint][]uint{2: {7}},
+			expectErr: ErrMissingDependency{Version: 2, Dependency: 7},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			order, err := sortTopologically(tc.versions, tc.deps)
+			if !reflect.DeepEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err == nil && !reflect.DeepEqual(order, tc.expected) {
+				t.Errorf("expected order %v, got %v", tc.expected, order)
+			}
+		})
+	}
+}
+
+func TestGraph(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "-- migrate:depends-on 3\nCREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "-- migrate:depends-on 2\nCREATE 3"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Down, Identifier: "DROP 4"})
+
+	src, err := (&stub.Stub{}).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.(*stub.Stub).Migrations = migrations
+
+	g, err := New(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := g.Order(); !reflect.DeepEqual(order, []uint{2, 3, 1, 4}) {
+		t.Fatalf("expected order [2 3 1 4], got %v", order)
+	}
+	if deps := g.Dependencies(1); !reflect.DeepEqual(deps, []uint{3}) {
+		t.Errorf("expected dependencies [3], got %v", deps)
+	}
+
+	if v, err := g.First(); err != nil || v != 2 {
+		t.Errorf("expected first 2, got %v (%v)", v, err)
+	}
+	if v, err := g.Next(3); err != nil || v != 1 {
+		t.Errorf("expected next 1, got %v (%v)", v, err)
+	}
+	if v, err := g.Prev(1); err != nil || v != 3 {
+		t.Errorf("expected prev 3, got %v (%v)", v, err)
+	}
+	if _, err := g.Next(4); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+	if _, err := g.Prev(2); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+	if i, err := g.Index(1); err != nil || i != 2 {
+		t.Errorf("expected index 2, got %v (%v)", i, err)
+	}
+	if _, err := g.Index(5); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
@@ -23,7 +23,8 @@ type PartialDriver struct {
 }
 
 // Init prepares not initialized PartialDriver instance to read migrations from a
-// http.FileSystem instance and a relative path.
+// http.FileSystem instance and a relative path. Files matched by the
+// source.IgnoreFile in path are left out.
 func (p *PartialDriver) Init(fs http.FileSystem, path string) error {
 	root, err := fs.Open(path)
 	if err != nil {
@@ -39,9 +40,14 @@ func (p *PartialDriver) Init(fs http.FileSystem, path string) error {
 		return err
 	}
 
+	ignore, err := readIgnore(fs, path)
+	if err != nil {
+		return err
+	}
+
 	ms := source.NewMigrations()
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() || ignore.Match(file.Name(), false) {
 			continue
 		}
 
@@ -50,11 +56,10 @@ func (p *PartialDriver) Init(fs http.FileSystem, path string) error {
 			continue // ignore files that we can't parse
 		}
 
-		if !ms.Append(m) {
-			return source.ErrDuplicateMigration{
-				Migration: *m,
-				FileInfo:  file,
-			}
+		if err := ms.Add(m); err != nil {
+			dup := err.(source.ErrDuplicateMigration)
+			dup.FileInfo = file
+			return dup
 		}
 	}
 
@@ -64,11 +69,28 @@ func (p *PartialDriver) Init(fs http.FileSystem, path string) error {
 	return nil
 }
 
+// readIgnore reads the source.IgnoreFile in dir, if there is one.
+func readIgnore(fs http.FileSystem, dir string) (*source.Ignore, error) {
+	f, err := fs.Open(path.Join(dir, source.IgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return source.ParseIgnore(f)
+}
+
 // Close is part of source.Driver interface implementation. This is a no-op.
 func (p *PartialDriver) Close() error {
 	return nil
 }
 
+// SelectDialect is part of source.DialectSelector interface implementation.
+func (p *PartialDriver) SelectDialect(dialect string) {
+	p.migrations.SelectDialect(dialect)
+}
+
 // First is part of source.Driver interface implementation.
 func (p *PartialDriver) First() (version uint, err error) {
 	if version, ok := p.migrations.First(); ok {
@@ -136,3 +158,46 @@ func (p *PartialDriver) ReadDown(version uint) (r io.ReadCloser, identifier stri
 		Err:  os.ErrNotExist,
 	}
 }
+
+// Describe is part of source.Describer interface implementation, naming
+// the migration file.
+func (p *PartialDriver) Describe(version uint, direction source.Direction) (source.Metadata, error) {
+	m, ok := p.migrations.Up(version)
+	if direction == source.Down {
+		m, ok = p.migrations.Down(version)
+	}
+	if !ok {
+		return source.Metadata{}, &os.PathError{
+			Op:   "describe " + string(direction) + " for version " + strconv.FormatUint(uint64(version), 10),
+			Path: p.path,
+			Err:  os.ErrNotExist,
+		}
+	}
+	f, err := p.fs.Open(path.Join(p.path, m.Raw))
+	if err != nil {
+		return source.Metadata{}, err
+	}
+	defer f.Close()
+	return source.ReadMetadata(m, f)
+}
+
+// Identify is part of source.Identifier interface implementation.
+func (p *PartialDriver) Identify(version uint, direction source.Direction) (string, error) {
+	m, ok := p.migrations.Up(version)
+	if direction == source.Down {
+		m, ok = p.migrations.Down(version)
+	}
+	if !ok {
+		return "", &os.PathError{
+			Op:   "identify " + string(direction) + " for version " + strconv.FormatUint(uint64(version), 10),
+			Path: p.path,
+			Err:  os.ErrNotExist,
+		}
+	}
+	return m.Identifier, nil
+}
+
+// ReadFile is part of source.FileReader interface implementation.
+func (p *PartialDriver) ReadFile(name string) (io.ReadCloser, error) {
+	return p.fs.Open(path.Join(p.path, name))
+}
@@ -0,0 +1,149 @@
+package source
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile is the file in the root of a source listing the files which
+// aren't migrations, e.g. scratch files, editor backups or migrations still
+// being written, in the syntax of .gitignore.
+const IgnoreFile = ".migrateignore"
+
+// Ignore holds the patterns of an IgnoreFile.
+type Ignore struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ParseIgnore reads the patterns of an IgnoreFile: one per line, empty lines
+// and lines starting with # are skipped. A pattern prefixed with ! includes
+// files again, a pattern ending with / matches only directories. A pattern
+// with a / other than at its end is relative to the root, otherwise it
+// matches files in every directory. Patterns are globs, see CompileGlob.
+func ParseIgnore(r io.Reader) (*Ignore, error) {
+	ignore := &Ignore{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			// \# and \! escape the first character
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		line = strings.TrimPrefix(line, "/")
+		re, err := CompileGlob(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", IgnoreFile, err)
+		}
+		p.re = re
+		ignore.patterns = append(ignore.patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ignore, nil
+}
+
+// Match reports whether the file at name, a path relative to the root of the
+// source separated by /, is ignored. Files in ignored directories are
+// ignored as well. A nil Ignore matches nothing.
+func (i *Ignore) Match(name string, isDir bool) bool {
+	if i == nil {
+		return false
+	}
+	name = strings.Trim(name, "/")
+	if dir := path.Dir(name); dir != "." && i.Match(dir, true) {
+		return true
+	}
+	ignored := false
+	for _, p := range i.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(name) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// CompileGlob translates a glob pattern into a regular expression matching
+// whole paths. Patterns have the syntax of path.Match, i.e. *, ? and [...]
+// don't match /, and ** matches any number of directories: **/ at the start
+// and /**/ match zero or more directories, /** at the end everything within
+// a directory, and ** elsewhere anything.
+func CompileGlob(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				atStart := i == 0 || pattern[i-1] == '/'
+				switch {
+				case atStart && i+2 < len(pattern) && pattern[i+2] == '/':
+					expr.WriteString("(?:.*/)?")
+					i += 2
+				case atStart && i+2 == len(pattern) && i > 0:
+					// the directory itself doesn't match dir/**
+					expr.WriteString(".+")
+					i++
+				default:
+					expr.WriteString(".*")
+					i++
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid pattern %q: unterminated [", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,81 @@
+package source
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnore(t *testing.T) {
+	ignore, err := ParseIgnore(strings.NewReader(`# scratch files
+*.swp
+*~
+scratch/
+/9_*
+!9_keep.up.sql
+\#notes
+wip/**
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name    string
+		isDir   bool
+		ignored bool
+	}{
+		{"1_init.up.sql", false, false},
+		{".1_init.up.sql.swp", false, true},
+		{"1_init.up.sql~", false, true},
+		{"sub/1_init.up.sql~", false, true},
+		{"scratch", true, true},
+		{"scratch", false, false},
+		{"scratch/1_init.up.sql", false, true},
+		{"9_wip.up.sql", false, true},
+		{"sub/9_wip.up.sql", false, false},
+		{"9_keep.up.sql", false, false},
+		{"#notes", false, true},
+		{"wip", true, false},
+		{"wip/a/1_init.up.sql", false, true},
+	}
+	for _, tc := range tt {
+		if ignored := ignore.Match(tc.name, tc.isDir); ignored != tc.ignored {
+			t.Errorf("%v: expected ignored %v, got %v", tc.name, tc.ignored, ignored)
+		}
+	}
+
+	if (*Ignore)(nil).Match("1_init.up.sql", false) {
+		t.Error("expected nil Ignore to match nothing")
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	tt := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.sql", "1_init.up.sql", true},
+		{"*.sql", "a/1_init.up.sql", false},
+		{"**/*.sql", "1_init.up.sql", true},
+		{"**/*.sql", "a/b/1_init.up.sql", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**", "a", false},
+		{"a/**", "a/x/y", true},
+		{"[!a]*", "b", true},
+		{"[!a]*", "a", false},
+	}
+	for _, tc := range tt {
+		re, err := CompileGlob(tc.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match := re.MatchString(tc.name); match != tc.match {
+			t.Errorf("expected %q matching %q to be %v", tc.pattern, tc.name, tc.match)
+		}
+	}
+	if _, err := CompileGlob("[a-"); err == nil {
+		t.Error("expected error for unterminated [")
+	}
+}
@@ -0,0 +1,103 @@
+package lint
+
+import (
+	"regexp"
+	"strings"
+)
+
+// clause is a statement, or an action of a statement with several, e.g.
+// ALTER TABLE t ADD COLUMN a int, DROP COLUMN b
+type clause struct {
+	text string
+	line int
+	// table is the table changed by the statement
+	table string
+	// created is the table created by the statement
+	created string
+}
+
+var (
+	// blanked are comments, strings and dollar quoted bodies
+	blanked = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/|'(?:[^']|'')*'|\$\$.*?\$\$`)
+
+	tableName   = `([\w."` + "`" + `\[\]]+)`
+	alterTable  = regexp.MustCompile(`(?i)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + tableName)
+	indexTable  = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\b.*?\bON\s+(?:ONLY\s+)?` + tableName)
+	createTable = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + tableName)
+)
+
+// splitClauses splits the SQL body into clauses. A statement ends at a
+// semicolon and its clauses at commas, outside of parentheses and quoted
+// names. Comments and strings are blanked.
+func splitClauses(body string) []clause {
+	// keep the offsets of lines
+	body = blanked.ReplaceAllStringFunc(body, func(c string) string {
+		return strings.Map(func(r rune) rune {
+			if r == '\n' {
+				return r
+			}
+			return ' '
+		}, c)
+	})
+
+	var clauses []clause
+	table := ""
+	start, depth := 0, 0
+	var quote string
+	add := func(end int, last bool) {
+		text := body[start:end]
+		if strings.TrimSpace(text) != "" {
+			// the line of the first word
+			offset := start + len(text) - len(strings.TrimLeft(text, " \t\r\n"))
+			c := clause{text: text, line: strings.Count(body[:offset], "\n") + 1}
+			if table == "" {
+				if m := alterTable.FindStringSubmatch(text); m != nil {
+					table = unquote(m[1])
+				} else if m := indexTable.FindStringSubmatch(text); m != nil {
+					table = unquote(m[1])
+				} else if m := createTable.FindStringSubmatch(text); m != nil {
+					c.created = unquote(m[1])
+				}
+			}
+			c.table = table
+			clauses = append(clauses, c)
+		}
+		start = end + 1
+		if last {
+			table = ""
+		}
+	}
+	for i := 0; i < len(body); i++ {
+		if quote != "" {
+			if string(body[i]) == quote {
+				quote = ""
+			}
+			continue
+		}
+		switch c := body[i]; c {
+		case '"', '`':
+			quote = string(c)
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(i, false)
+			}
+		case ';':
+			if depth == 0 {
+				add(i, true)
+			}
+		}
+	}
+	if start < len(body) {
+		add(len(body), true)
+	}
+	return clauses
+}
+
+// unquote returns the lower case name of a table or column without quotes
+func unquote(name string) string {
+	return strings.ToLower(strings.Trim(name, "\"`[]"))
+}
@@ -0,0 +1,293 @@
+// Package lint checks up migrations for operations which are unsafe under
+// rolling deploys, where the previous release of the application keeps
+// running against the migrated schema until it is replaced. Such changes
+// are split into an expand migration, compatible with both releases, and a
+// contract migration applied once the previous release is gone.
+//
+// Every rule has a severity, which can be changed. Changes to tables
+// created by the same migration are never flagged. A migration which is
+// deliberately a contract step suppresses rules with the lint-ignore
+// pragma, e.g.
+//  -- migrate:lint-ignore drop-column rename-column
+// Without rule names, the pragma suppresses all rules.
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// Severity is how serious a finding of a rule is.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	// Off disables a rule.
+	Off Severity = "off"
+)
+
+// ParseSeverity parses the name of a Severity.
+func ParseSeverity(s string) (Severity, error) {
+	switch severity := Severity(strings.ToLower(s)); severity {
+	case Error, Warning, Off:
+		return severity, nil
+	}
+	return "", fmt.Errorf("unknown severity %q, expected error, warning or off", s)
+}
+
+// Rule flags an unsafe operation in a clause of a statement.
+type Rule struct {
+	Name     string
+	Severity Severity
+	Message  string
+	match    func(c clause) bool
+}
+
+var (
+	dropColumn   = regexp.MustCompile(`(?i)\bDROP\s+COLUMN\b`)
+	renameColumn = regexp.MustCompile(`(?i)\bRENAME\s+COLUMN\b`)
+	// changeColumn is the CHANGE clause of MySQL, which renames a column
+	// if the names differ
+	changeColumn = regexp.MustCompile(`(?i)\bCHANGE\s+(?:COLUMN\s+)?([\w"` + "`" + `]+)\s+([\w"` + "`" + `]+)`)
+	alterType    = regexp.MustCompile(`(?i)\bALTER\s+(?:COLUMN\s+)?[\w"` + "`" + `]+\s+(?:SET\s+DATA\s+)?TYPE\b|\bMODIFY\s+(?:COLUMN\s+)?[\w"` + "`" + `]+\s+\w`)
+	addColumn    = regexp.MustCompile(`(?i)\bADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?([\w"` + "`" + `]+)`)
+	notNull      = regexp.MustCompile(`(?i)\bNOT\s+NULL\b`)
+	defaultValue = regexp.MustCompile(`(?i)\bDEFAULT\b|\bGENERATED\b|\bAUTO_INCREMENT\b|\bSERIAL\b`)
+	createIndex  = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\b`)
+	nonBlocking  = regexp.MustCompile(`(?i)\bCONCURRENTLY\b|\bLOCK\s*=\s*NONE\b|\bONLINE\b`)
+
+	// addNoColumn are the keywords following ADD which don't add a column
+	addNoColumn = map[string]bool{"constraint": true, "index": true, "key": true, "primary": true, "unique": true,
+		"foreign": true, "check": true, "fulltext": true, "spatial": true, "partition": true}
+)
+
+// Rules are the rules with their default severity.
+var Rules = []Rule{
+	{
+		Name:     "drop-column",
+		Severity: Error,
+		Message:  "dropping a column breaks the previous release still using it, stop using it in a release first",
+		match: func(c clause) bool {
+			return dropColumn.MatchString(c.text)
+		},
+	},
+	{
+		Name:     "rename-column",
+		Severity: Error,
+		Message:  "renaming a column breaks the previous release using the old name, add a new column and copy the data instead",
+		match: func(c clause) bool {
+			if renameColumn.MatchString(c.text) {
+				return true
+			}
+			m := changeColumn.FindStringSubmatch(c.text)
+			return m != nil && unquote(m[1]) != unquote(m[2])
+		},
+	},
+	{
+		Name:     "not-null-without-default",
+		Severity: Error,
+		Message:  "adding a NOT NULL column without DEFAULT breaks inserts of the previous release, add a DEFAULT or make it nullable first",
+		match: func(c clause) bool {
+			m := addColumn.FindStringSubmatch(c.text)
+			if m == nil || addNoColumn[strings.ToLower(m[1])] {
+				return false
+			}
+			return notNull.MatchString(c.text) && !defaultValue.MatchString(c.text)
+		},
+	},
+	{
+		Name:     "change-column-type",
+		Severity: Error,
+		Message:  "changing the type of a column in place rewrites the table under lock and may break the previous release, add a new column instead",
+		match: func(c clause) bool {
+			if alterType.MatchString(c.text) {
+				return true
+			}
+			m := changeColumn.FindStringSubmatch(c.text)
+			return m != nil && unquote(m[1]) == unquote(m[2])
+		},
+	},
+	{
+		Name:     "blocking-index",
+		Severity: Warning,
+		Message:  "building an index locks writes to the table, use CREATE INDEX CONCURRENTLY (postgres) or LOCK=NONE (mysql)",
+		match: func(c clause) bool {
+			return createIndex.MatchString(c.text) && !nonBlocking.MatchString(c.text)
+		},
+	},
+}
+
+// Finding is an unsafe operation found by a rule.
+type Finding struct {
+	Version    uint
+	Identifier string
+	// Line is the line of the operation in the migration, starting at 1,
+	// or 0 for findings about the whole migration
+	Line     int
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%v %v: %v: %v (%v)", f.Version, f.Identifier, f.Severity, f.Message, f.Rule)
+	}
+	return fmt.Sprintf("%v/u %v:%v: %v: %v (%v)", f.Version, f.Identifier, f.Line, f.Severity, f.Message, f.Rule)
+}
+
+// Linter checks migrations with Rules.
+type Linter struct {
+	// Severities overrides the severity of rules by their name.
+	Severities map[string]Severity
+	// RequireDown flags migrations without down migration, or with an empty
+	// one, as errors of the rule RequireDownRule.
+	RequireDown bool
+	// Dialect enables the syntax check for the dialect, see SetDialect.
+	Dialect string
+}
+
+// RequireDownRule is the rule name of findings of Linter.RequireDown.
+const RequireDownRule = "require-down"
+
+// SetSeverity overrides the severity of the rule name.
+func (l *Linter) SetSeverity(name string, severity Severity) error {
+	for _, r := range Rules {
+		if r.Name == name {
+			if l.Severities == nil {
+				l.Severities = make(map[string]Severity)
+			}
+			l.Severities[name] = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown lint rule %q", name)
+}
+
+func (l *Linter) severity(r Rule) Severity {
+	if s, ok := l.Severities[r.Name]; ok {
+		return s
+	}
+	return r.Severity
+}
+
+// Migration returns the findings in the SQL body of an up migration, in
+// order of their line. Version and Identifier of the findings are unset.
+func (l *Linter) Migration(body []byte) []Finding {
+	pragmas := pragma.Parse(body)
+	ignored := make(map[string]bool)
+	for _, value := range pragmas.All(pragma.LintIgnore) {
+		names := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(names) == 0 {
+			return nil
+		}
+		for _, name := range names {
+			ignored[name] = true
+		}
+	}
+
+	clauses := splitClauses(string(body))
+	created := make(map[string]bool)
+	for _, c := range clauses {
+		if c.created != "" {
+			created[c.created] = true
+		}
+	}
+
+	var findings []Finding
+	for _, c := range clauses {
+		if c.table != "" && created[c.table] {
+			continue
+		}
+		for _, r := range Rules {
+			severity := l.severity(r)
+			if severity == Off || ignored[r.Name] || !r.match(c) {
+				continue
+			}
+			findings = append(findings, Finding{Line: c.line, Rule: r.Name, Severity: severity, Message: r.Message})
+		}
+	}
+	if g, ok := grammars[l.Dialect]; ok && !ignored[SyntaxRule] && !skipSyntax(body, pragmas) {
+		findings = append(findings, g.check(string(body))...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// Source returns the findings in the up migrations of versions of src, or
+// of all its migrations if versions is nil. With Dialect, src prefers the
+// migrations written for it.
+func (l *Linter) Source(src source.Driver, versions []uint) ([]Finding, error) {
+	if d, ok := src.(source.DialectSelector); ok && l.Dialect != "" {
+		d.SelectDialect(l.Dialect)
+	}
+	if versions == nil {
+		version, err := src.First()
+		for err == nil {
+			versions = append(versions, version)
+			version, err = src.Next(version)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	var findings []Finding
+	for _, version := range versions {
+		r, identifier, err := src.ReadUp(version)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range l.Migration(body) {
+			f.Version, f.Identifier = version, identifier
+			findings = append(findings, f)
+		}
+		if l.RequireDown {
+			f, err := requireDown(src, version)
+			if err != nil {
+				return nil, err
+			}
+			if f != nil {
+				f.Version, f.Identifier = version, identifier
+				findings = append(findings, *f)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// requireDown returns a finding if version of src has no down migration or
+// an empty one.
+func requireDown(src source.Driver, version uint) (*Finding, error) {
+	r, _, err := src.ReadDown(version)
+	if os.IsNotExist(err) {
+		return &Finding{Rule: RequireDownRule, Severity: Error, Message: "the migration has no down migration"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return &Finding{Rule: RequireDownRule, Severity: Error, Message: "the down migration is empty"}, nil
+	}
+	return nil, nil
+}
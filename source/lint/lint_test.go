@@ -0,0 +1,149 @@
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestMigration(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{"safe", "ALTER TABLE users ADD COLUMN email text;\nCREATE INDEX CONCURRENTLY users_email ON users (email);", nil},
+		{"drop column", "ALTER TABLE users DROP COLUMN email;", []string{"1 drop-column error"}},
+		{"rename column", "ALTER TABLE users RENAME COLUMN email TO mail;", []string{"1 rename-column error"}},
+		{"mysql change", "ALTER TABLE users CHANGE email mail text;\nALTER TABLE users CHANGE COLUMN name name varchar(100);",
+			[]string{"1 rename-column error", "2 change-column-type error"}},
+		{"not null", "ALTER TABLE users\n  ADD COLUMN email text,\n  ADD COLUMN verified bool NOT NULL;",
+			[]string{"3 not-null-without-default error"}},
+		{"not null with default", "ALTER TABLE users ADD COLUMN verified bool NOT NULL DEFAULT false;", nil},
+		{"constraint", "ALTER TABLE users ADD CONSTRAINT email_not_null CHECK (email IS NOT NULL);", nil},
+		{"column type", "ALTER TABLE users ALTER COLUMN id TYPE bigint;\nALTER TABLE users MODIFY name varchar(200);",
+			[]string{"1 change-column-type error", "2 change-column-type error"}},
+		{"blocking index", "-- an index\nCREATE UNIQUE INDEX users_email ON users (email);", []string{"2 blocking-index warning"}},
+		{"created table", "CREATE TABLE users (id int, email text);\nCREATE INDEX users_email ON users (email);\nALTER TABLE users ADD COLUMN verified bool NOT NULL;", nil},
+		{"comments and strings", "-- DROP COLUMN email\nINSERT INTO logs VALUES ('ALTER TABLE users DROP COLUMN email; x');", nil},
+		{"ignored", "-- migrate:lint-ignore drop-column\nALTER TABLE users DROP COLUMN email, RENAME COLUMN name TO full_name;",
+			[]string{"2 rename-column error"}},
+		{"all ignored", "-- migrate:lint-ignore\nALTER TABLE users DROP COLUMN email;", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var found []string
+			for _, f := range (&Linter{}).Migration([]byte(c.body)) {
+				found = append(found, fmt.Sprintf("%v %v %v", f.Line, f.Rule, f.Severity))
+			}
+			if !reflect.DeepEqual(found, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, found)
+			}
+		})
+	}
+}
+
+func TestSeverities(t *testing.T) {
+	l := &Linter{}
+	if err := l.SetSeverity("blocking-index", Error); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetSeverity("drop-column", Off); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetSeverity("drop-table", Off); err == nil {
+		t.Error("expected unknown rule to fail")
+	}
+	findings := l.Migration([]byte("CREATE INDEX users_email ON users (email);\nALTER TABLE users DROP COLUMN name;"))
+	if len(findings) != 1 || findings[0].Rule != "blocking-index" || findings[0].Severity != Error {
+		t.Errorf("expected blocking-index error, got %v", findings)
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("expected unknown severity to fail")
+	}
+}
+
+func TestRequireDown(t *testing.T) {
+	src := &stub.Stub{Migrations: source.NewMigrations()}
+	src.Migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE TABLE a (id int);"})
+	src.Migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP TABLE a;"})
+	src.Migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE TABLE b (id int);"})
+	src.Migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE TABLE c (id int);"})
+	src.Migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "\n"})
+
+	findings, err := (&Linter{}).Source(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no findings, got %v", findings)
+	}
+
+	findings, err = (&Linter{RequireDown: true}).Source(src, []uint{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, f := range findings {
+		found = append(found, fmt.Sprintf("%v %v %v", f.Version, f.Rule, f.Message))
+	}
+	expected := []string{
+		"2 require-down the migration has no down migration",
+		"3 require-down the down migration is empty",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+}
+
+func TestSyntax(t *testing.T) {
+	cases := []struct {
+		name     string
+		dialect  string
+		body     string
+		expected []string
+	}{
+		{"valid", "postgres", "CREATE TABLE users (id int, name text);\nCREATE UNIQUE INDEX CONCURRENTLY users_name ON users (name);", nil},
+		{"typo", "postgres", "CREATE TABLE a (id int);\n\nCRATE TABLE b (id int);", []string{"3 unknown statement CRATE, did you mean CREATE?"}},
+		{"unknown object", "postgres", "CREATE OR REPLACE VEIW v AS SELECT 1;", []string{"1 unknown CREATE VEIW, did you mean VIEW?"}},
+		{"unclosed parenthesis", "postgres", "CREATE TABLE a (\n  id int,\n  name text;", []string{"1 unclosed parenthesis"}},
+		{"extra parenthesis", "postgres", "SELECT (1));", []string{"1 unexpected closing parenthesis"}},
+		{"unterminated string", "postgres", "INSERT INTO a VALUES (1);\nINSERT INTO a VALUES ('x);", []string{"2 unterminated string"}},
+		{"escape string", "postgres", `INSERT INTO a VALUES (E'it\'s');`, nil},
+		{"dollar quoted", "postgres", "CREATE FUNCTION f() RETURNS int AS $body$\n  SELECT 1; ) ELECT\n$body$ LANGUAGE sql;\nDO $$ BEGIN END $$;", nil},
+		{"unterminated dollar quote", "postgres", "DO $$ BEGIN\nEND;", []string{"1 unterminated $$ quoted string"}},
+		{"unterminated comment", "postgres", "SELECT 1;\n/* SELECT 2;", []string{"2 unterminated comment"}},
+		{"mysql", "mysql", "# comment\nCREATE TABLE `a` (id int, name varchar(10) DEFAULT \"it\\\"s\");\nCREATE DEFINER=`root`@`%` TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN\n  IF NEW.id < 0 THEN SET NEW.id = 0;\n  END IF;\nEND;", nil},
+		{"mysql quoted name", "mysql", "ALTER TABLE `a ADD COLUMN b int;", []string{"1 unterminated quoted name"}},
+		{"sqlite", "sqlite3", "CREATE VIRTUAL TABLE [docs] USING fts5(body);\nPRAGMA foreign_keys = ON;", nil},
+		{"sqlite statement", "sqlite3", "TRUNCATE TABLE a;", []string{"1 unknown statement TRUNCATE"}},
+		{"ignored", "postgres", "-- migrate:lint-ignore syntax\nCRATE TABLE a (id int);", nil},
+		{"template", "postgres", "-- migrate:template\nCREATE TABLE {{ .Table }} (;", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := &Linter{}
+			if err := l.SetDialect(c.dialect); err != nil {
+				t.Fatal(err)
+			}
+			var found []string
+			for _, f := range l.Migration([]byte(c.body)) {
+				found = append(found, fmt.Sprintf("%v %v", f.Line, f.Message))
+			}
+			if !reflect.DeepEqual(found, c.expected) {
+				t.Errorf("expected %q, got %q", c.expected, found)
+			}
+		})
+	}
+
+	if err := (&Linter{}).SetDialect("cassandra"); err == nil {
+		t.Error("expected unknown dialect to fail")
+	}
+	l := &Linter{}
+	if err := l.SetDialect("postgresql"); err != nil || l.Dialect != "postgres" {
+		t.Errorf("expected postgres, got %q, %v", l.Dialect, err)
+	}
+}
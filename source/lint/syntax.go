@@ -0,0 +1,359 @@
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// SyntaxRule is the rule name of findings of the syntax check, see
+// Linter.SetDialect.
+const SyntaxRule = "syntax"
+
+// grammar is what the syntax check knows of a dialect: how names, strings
+// and comments are quoted, and the keywords statements start with. It
+// catches typos and truncated migrations, it isn't a full parser.
+type grammar struct {
+	// statements are the keywords statements start with
+	statements []string
+	// objects are the kinds of objects CREATE, ALTER and DROP take
+	objects []string
+	// modifiers may precede the object of CREATE, ALTER and DROP
+	modifiers []string
+	// backticks quote names
+	backticks bool
+	// brackets quote names
+	brackets bool
+	// doubleQuotedStrings are strings instead of names
+	doubleQuotedStrings bool
+	// backslashes escape characters in strings
+	backslashes bool
+	// escapeStrings are strings prefixed with E, in which backslashes
+	// escape characters
+	escapeStrings bool
+	// hashComments start with # and end with the line
+	hashComments bool
+	// dollarQuotes are strings quoted with $$ or $tag$
+	dollarQuotes bool
+}
+
+var (
+	postgres = &grammar{
+		statements: []string{"ABORT", "ALTER", "ANALYZE", "BEGIN", "CALL", "CHECKPOINT", "CLOSE", "CLUSTER",
+			"COMMENT", "COMMIT", "COPY", "CREATE", "DEALLOCATE", "DECLARE", "DELETE", "DISCARD", "DO", "DROP",
+			"END", "EXECUTE", "EXPLAIN", "FETCH", "GRANT", "IMPORT", "INSERT", "LISTEN", "LOAD", "LOCK", "MERGE",
+			"MOVE", "NOTIFY", "PREPARE", "REASSIGN", "REFRESH", "REINDEX", "RELEASE", "RESET", "REVOKE",
+			"ROLLBACK", "SAVEPOINT", "SECURITY", "SELECT", "SET", "SHOW", "START", "TABLE", "TRUNCATE",
+			"UNLISTEN", "UPDATE", "VACUUM", "VALUES", "WITH"},
+		objects: []string{"ACCESS", "AGGREGATE", "CAST", "COLLATION", "CONVERSION", "DATABASE", "DEFAULT",
+			"DOMAIN", "EVENT", "EXTENSION", "FOREIGN", "FUNCTION", "GROUP", "INDEX", "LANGUAGE", "LARGE",
+			"OPERATOR", "OWNED", "POLICY", "PROCEDURE", "PUBLICATION", "ROLE", "ROUTINE", "RULE", "SCHEMA",
+			"SEQUENCE", "SERVER", "STATISTICS", "SUBSCRIPTION", "SYSTEM", "TABLE", "TABLESPACE", "TEXT",
+			"TRANSFORM", "TRIGGER", "TYPE", "USER", "VIEW"},
+		modifiers: []string{"CONSTRAINT", "GLOBAL", "LOCAL", "MATERIALIZED", "OR", "PROCEDURAL", "RECURSIVE",
+			"REPLACE", "TEMP", "TEMPORARY", "TRUSTED", "UNIQUE", "UNLOGGED"},
+		escapeStrings: true,
+		dollarQuotes:  true,
+	}
+
+	mysql = &grammar{
+		statements: []string{"ALTER", "ANALYZE", "BEGIN", "CALL", "CASE", "CHANGE", "CHECK", "CLOSE", "COMMIT",
+			"CREATE", "DEALLOCATE", "DECLARE", "DELETE", "DESC", "DESCRIBE", "DO", "DROP", "ELSE", "ELSEIF",
+			"END", "EXECUTE", "EXPLAIN", "FETCH", "FLUSH", "GRANT", "HANDLER", "IF", "INSERT", "INSTALL",
+			"ITERATE", "KILL", "LEAVE", "LOAD", "LOCK", "LOOP", "OPEN", "OPTIMIZE", "PREPARE", "PURGE",
+			"RELEASE", "RENAME", "REPAIR", "REPEAT", "REPLACE", "RESET", "RESIGNAL", "RETURN", "REVOKE",
+			"ROLLBACK", "SAVEPOINT", "SELECT", "SET", "SHOW", "SIGNAL", "START", "TABLE", "TRUNCATE",
+			"UNINSTALL", "UNLOCK", "UNTIL", "UPDATE", "USE", "VALUES", "WHEN", "WHILE", "WITH", "XA"},
+		objects: []string{"DATABASE", "EVENT", "FUNCTION", "INDEX", "INSTANCE", "LOGFILE", "PROCEDURE",
+			"RESOURCE", "ROLE", "SCHEMA", "SERVER", "TABLE", "TABLESPACE", "TRIGGER", "USER", "VIEW"},
+		modifiers: []string{"AGGREGATE", "ALGORITHM", "CURRENT_USER", "DEFINER", "FULLTEXT", "IGNORE",
+			"INVOKER", "MERGE", "OFFLINE", "ONLINE", "OR", "REPLACE", "SECURITY", "SPATIAL", "SQL",
+			"TEMPORARY", "TEMPTABLE", "UNDEFINED", "UNDO", "UNIQUE"},
+		backticks:           true,
+		doubleQuotedStrings: true,
+		backslashes:         true,
+		hashComments:        true,
+	}
+
+	sqlite = &grammar{
+		statements: []string{"ALTER", "ANALYZE", "ATTACH", "BEGIN", "COMMIT", "CREATE", "DELETE", "DETACH",
+			"DROP", "END", "EXPLAIN", "INSERT", "PRAGMA", "REINDEX", "RELEASE", "REPLACE", "ROLLBACK",
+			"SAVEPOINT", "SELECT", "UPDATE", "VACUUM", "VALUES", "WITH"},
+		objects:   []string{"INDEX", "TABLE", "TRIGGER", "VIEW"},
+		modifiers: []string{"TEMP", "TEMPORARY", "UNIQUE", "VIRTUAL"},
+		backticks: true,
+		brackets:  true,
+	}
+
+	// grammars maps dialects to their grammar, postgres covers the
+	// databases speaking its dialect
+	grammars = map[string]*grammar{
+		"cockroachdb": postgres,
+		"mysql":       mysql,
+		"postgres":    postgres,
+		"redshift":    postgres,
+		"sqlite":      sqlite,
+		"sqlite3":     sqlite,
+	}
+
+	dollarQuote = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z_0-9]*)?\$`)
+)
+
+// SetDialect enables the syntax check of migrations for dialect, a
+// dialect of source.Dialects or the name of a database driver, e.g.
+// postgres, mysql or sqlite3.
+func (l *Linter) SetDialect(dialect string) error {
+	dialect = source.DialectOf(dialect)
+	if _, ok := grammars[dialect]; !ok {
+		return fmt.Errorf("no syntax check for dialect %q, expected postgres, cockroachdb, redshift, mysql or sqlite3", dialect)
+	}
+	l.Dialect = dialect
+	return nil
+}
+
+// statement is the start of a statement seen by the syntax check.
+type statement struct {
+	line int
+	// words are the first words, upper case, if the statement starts with one
+	words []string
+	empty bool
+}
+
+// check returns the syntax errors in the SQL body, in order of their line.
+// Checking ends at an unterminated string, name or comment.
+func (g *grammar) check(body string) []Finding {
+	var findings []Finding
+	add := func(line int, format string, args ...interface{}) {
+		findings = append(findings, Finding{Line: line, Rule: SyntaxRule, Severity: Error, Message: fmt.Sprintf(format, args...)})
+	}
+
+	line := 1
+	// parens are the lines of the open parentheses
+	var parens []int
+	stmt := statement{empty: true}
+	end := func() {
+		if len(parens) > 0 {
+			add(parens[len(parens)-1], "unclosed parenthesis")
+		}
+		if !stmt.empty {
+			if msg := g.checkWords(stmt.words); msg != "" {
+				add(stmt.line, "%v", msg)
+			}
+		}
+		parens = parens[:0]
+		stmt = statement{empty: true}
+	}
+	// token starts a token of the current statement
+	token := func(word string) {
+		if stmt.empty {
+			stmt.empty, stmt.line = false, line
+			if word == "" {
+				// e.g. a parenthesized SELECT
+				stmt.words = nil
+				return
+			}
+			stmt.words = []string{}
+		}
+		if word != "" && stmt.words != nil && len(stmt.words) < 8 {
+			stmt.words = append(stmt.words, strings.ToUpper(word))
+		}
+	}
+	// skip skips a quoted token from i to the closing quote, returns the
+	// index after it, or -1 if it is unterminated
+	skip := func(i int, closing string, doubled, escapes bool) int {
+		for j := i; j < len(body); j++ {
+			switch {
+			case escapes && body[j] == '\\':
+				j++
+			case strings.HasPrefix(body[j:], closing):
+				if doubled && strings.HasPrefix(body[j+len(closing):], closing) {
+					j += len(closing)
+					continue
+				}
+				return j + len(closing)
+			}
+		}
+		return -1
+	}
+
+	for i := 0; i < len(body); {
+		c := body[i]
+		start := line
+		next := i + 1
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case strings.HasPrefix(body[i:], "--") || (g.hashComments && c == '#'):
+			next = strings.IndexByte(body[i:], '\n')
+			if next < 0 {
+				next = len(body)
+			} else {
+				next += i
+			}
+		case strings.HasPrefix(body[i:], "/*"):
+			next = skip(i+2, "*/", false, false)
+			if next < 0 {
+				add(start, "unterminated comment")
+				return findings
+			}
+		case c == '\'':
+			token("")
+			escapes := g.backslashes || g.escapeStrings && i > 0 && (body[i-1] == 'E' || body[i-1] == 'e') &&
+				(i == 1 || !isWordByte(body[i-2]))
+			if next = skip(i+1, "'", true, escapes); next < 0 {
+				add(start, "unterminated string")
+				return findings
+			}
+		case c == '"':
+			token("")
+			if next = skip(i+1, `"`, true, g.doubleQuotedStrings && g.backslashes); next < 0 {
+				if g.doubleQuotedStrings {
+					add(start, "unterminated string")
+				} else {
+					add(start, "unterminated quoted name")
+				}
+				return findings
+			}
+		case c == '`' && g.backticks:
+			token("")
+			if next = skip(i+1, "`", true, false); next < 0 {
+				add(start, "unterminated quoted name")
+				return findings
+			}
+		case c == '[' && g.brackets:
+			token("")
+			if next = skip(i+1, "]", false, false); next < 0 {
+				add(start, "unterminated quoted name")
+				return findings
+			}
+		case c == '$' && g.dollarQuotes && dollarQuote.MatchString(body[i:]) && (i == 0 || !isWordByte(body[i-1])):
+			tag := dollarQuote.FindString(body[i:])
+			token("")
+			if next = skip(i+len(tag), tag, false, false); next < 0 {
+				add(start, "unterminated %v quoted string", tag)
+				return findings
+			}
+		case c == '(':
+			token("")
+			parens = append(parens, line)
+		case c == ')':
+			token("")
+			if len(parens) == 0 {
+				add(line, "unexpected closing parenthesis")
+			} else {
+				parens = parens[:len(parens)-1]
+			}
+		case c == ';':
+			end()
+		case isWordByte(c) && (c < '0' || c > '9'):
+			for next < len(body) && (isWordByte(body[next]) || body[next] == '$') {
+				next++
+			}
+			token(body[i:next])
+		default:
+			token("")
+		}
+		line += strings.Count(body[i:next], "\n")
+		i = next
+	}
+	end()
+	return findings
+}
+
+// checkWords returns what is wrong with a statement starting with words,
+// or an empty string.
+func (g *grammar) checkWords(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	if !contains(g.statements, words[0]) {
+		return "unknown statement " + words[0] + suggest(g.statements, words[0])
+	}
+	switch words[0] {
+	case "CREATE", "ALTER", "DROP":
+	default:
+		return ""
+	}
+	for _, w := range words[1:] {
+		if contains(g.modifiers, w) {
+			continue
+		}
+		if !contains(g.objects, w) {
+			return fmt.Sprintf("unknown %v %v%v", words[0], w, suggest(g.objects, w))
+		}
+		return ""
+	}
+	return ""
+}
+
+// suggest returns the keyword closest to a misspelled word, as a question,
+// if there is one within two edits.
+func suggest(keywords []string, word string) string {
+	best, distance := "", 3
+	for _, k := range keywords {
+		if d := editDistance(k, word); d < distance {
+			best, distance = k, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return ", did you mean " + best + "?"
+}
+
+// editDistance returns the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// wasmMagic starts WebAssembly migrations, which aren't SQL
+var wasmMagic = []byte("\x00asm")
+
+// skipSyntax returns true for migrations which aren't plain SQL: templates,
+// scripts, commands, loads, backfills and WebAssembly modules.
+func skipSyntax(body []byte, p pragma.Pragmas) bool {
+	return bytes.HasPrefix(body, wasmMagic) || p.Has(pragma.Template) || p.Has(pragma.Exec) ||
+		p.Has(pragma.Starlark) || p.Has(pragma.Load) || p.Has(pragma.Backfill)
+}
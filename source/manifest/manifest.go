@@ -0,0 +1,290 @@
+// Package manifest records the checksums of a set of migrations, e.g.
+//  # migrate manifest
+//  1 9f86d081884c7d65...15b0f00a08 2c26b46b68ffc68f...6b9c2e7ae
+//  2 fcde2b2edba56bf4...9c1b86f8f -
+// Each line holds a version and the hex encoded SHA-256 checksums of its up
+// and down migration (shortened above), `-` marks a missing migration.
+// A manifest can be signed with an SSH key, the signature is stored
+// on a trailing `signature` line. Unsigned, a manifest serves as lock file
+// to detect changed migrations, see Diff.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	header          = "# migrate manifest"
+	missing         = "-"
+	signaturePrefix = "signature "
+)
+
+var (
+	ErrNotSigned        = errors.New("manifest is not signed")
+	ErrInvalidSignature = errors.New("manifest signature is invalid")
+)
+
+// ErrUnverified is returned for a migration which is missing
+// from the manifest or whose checksum differs from the manifest.
+type ErrUnverified struct {
+	Version   uint
+	Direction source.Direction
+	Missing   bool
+}
+
+func (e ErrUnverified) Error() string {
+	if e.Missing {
+		return fmt.Sprintf("migration %v.%v is not covered by the manifest", e.Version, e.Direction)
+	}
+	return fmt.Sprintf("migration %v.%v doesn't match the checksum of the manifest", e.Version, e.Direction)
+}
+
+// Entry holds the checksums of the migrations of one version.
+// A checksum is empty if the migration doesn't exist.
+type Entry struct {
+	Version uint
+	Up      string
+	Down    string
+}
+
+// Manifest holds the checksums of a set of migrations.
+type Manifest struct {
+	// Entries are sorted by version.
+	Entries []Entry
+
+	// Signature of the entries, nil if the manifest isn't signed.
+	Signature *ssh.Signature
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of a migration body,
+// see source.Checksum.
+func Checksum(body []byte) string {
+	return source.Checksum(body)
+}
+
+// ChecksumReader returns the checksum of the migration body read from r,
+// see source.ChecksumReader.
+func ChecksumReader(r io.Reader) (string, error) {
+	return source.ChecksumReader(r)
+}
+
+// Build reads all migrations of a source and returns their manifest.
+func Build(src source.Driver) (*Manifest, error) {
+	m := &Manifest{}
+	version, err := src.First()
+	for err == nil {
+		e := Entry{Version: version}
+		if e.Up, err = checksum(src.ReadUp(version)); err != nil {
+			return nil, err
+		}
+		if e.Down, err = checksum(src.ReadDown(version)); err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, e)
+		version, err = src.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return m, nil
+}
+
+func checksum(r io.ReadCloser, identifier string, err error) (string, error) {
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	return ChecksumReader(r)
+}
+
+// Entry returns the entry of version.
+func (m *Manifest) Entry(version uint) (Entry, bool) {
+	i := sort.Search(len(m.Entries), func(i int) bool { return m.Entries[i].Version >= version })
+	if i < len(m.Entries) && m.Entries[i].Version == version {
+		return m.Entries[i], true
+	}
+	return Entry{}, false
+}
+
+// Verify returns ErrUnverified unless the manifest covers the migration
+// of version and direction with the checksum of body.
+func (m *Manifest) Verify(version uint, direction source.Direction, body []byte) error {
+	return m.VerifyChecksum(version, direction, Checksum(body))
+}
+
+// VerifyChecksum is like Verify, given the checksum of the body.
+func (m *Manifest) VerifyChecksum(version uint, direction source.Direction, checksum string) error {
+	e, _ := m.Entry(version)
+	sum := e.Up
+	if direction == source.Down {
+		sum = e.Down
+	}
+	if sum == "" {
+		return ErrUnverified{Version: version, Direction: direction, Missing: true}
+	}
+	if sum != checksum {
+		return ErrUnverified{Version: version, Direction: direction}
+	}
+	return nil
+}
+
+// Difference is a migration whose checksum differs between two manifests.
+// Expected or Actual is empty if the migration is missing on that side.
+type Difference struct {
+	Version   uint
+	Direction source.Direction
+	Expected  string
+	Actual    string
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Expected == "":
+		return fmt.Sprintf("%v.%v added", d.Version, d.Direction)
+	case d.Actual == "":
+		return fmt.Sprintf("%v.%v removed", d.Version, d.Direction)
+	default:
+		return fmt.Sprintf("%v.%v changed", d.Version, d.Direction)
+	}
+}
+
+// Diff returns the differences between the expected and actual manifest,
+// ordered by version.
+func Diff(expected, actual *Manifest) []Difference {
+	var diffs []Difference
+	add := func(version uint, e, a Entry) {
+		if e.Up != a.Up {
+			diffs = append(diffs, Difference{Version: version, Direction: source.Up, Expected: e.Up, Actual: a.Up})
+		}
+		if e.Down != a.Down {
+			diffs = append(diffs, Difference{Version: version, Direction: source.Down, Expected: e.Down, Actual: a.Down})
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(expected.Entries) || j < len(actual.Entries) {
+		switch {
+		case j == len(actual.Entries) || i < len(expected.Entries) && expected.Entries[i].Version < actual.Entries[j].Version:
+			add(expected.Entries[i].Version, expected.Entries[i], Entry{})
+			i++
+		case i == len(expected.Entries) || actual.Entries[j].Version < expected.Entries[i].Version:
+			add(actual.Entries[j].Version, Entry{}, actual.Entries[j])
+			j++
+		default:
+			add(expected.Entries[i].Version, expected.Entries[i], actual.Entries[j])
+			i++
+			j++
+		}
+	}
+	return diffs
+}
+
+// Sign signs the entries of the manifest.
+func (m *Manifest) Sign(signer ssh.Signer) error {
+	sig, err := signer.Sign(nil, m.entries())
+	if err != nil {
+		return err
+	}
+	m.Signature = sig
+	return nil
+}
+
+// VerifySignature returns nil if the manifest is signed by key.
+func (m *Manifest) VerifySignature(key ssh.PublicKey) error {
+	if m.Signature == nil {
+		return ErrNotSigned
+	}
+	if err := key.Verify(m.entries(), m.Signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// entries returns the encoded entries, which is the signed content.
+func (m *Manifest) entries() []byte {
+	var buf bytes.Buffer
+	for _, e := range m.Entries {
+		fmt.Fprintf(&buf, "%v %v %v\n", e.Version, orMissing(e.Up), orMissing(e.Down))
+	}
+	return buf.Bytes()
+}
+
+func orMissing(sum string) string {
+	if sum == "" {
+		return missing
+	}
+	return sum
+}
+
+// WriteTo writes the manifest to w.
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header + "\n")
+	buf.Write(m.entries())
+	if m.Signature != nil {
+		buf.WriteString(signaturePrefix + base64.StdEncoding.EncodeToString(ssh.Marshal(m.Signature)) + "\n")
+	}
+	return buf.WriteTo(w)
+}
+
+// Read parses a manifest written by WriteTo.
+func Read(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+			continue
+		case strings.HasPrefix(text, signaturePrefix):
+			blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(text, signaturePrefix))
+			if err != nil {
+				return nil, fmt.Errorf("manifest line %v: %v", line, err)
+			}
+			sig := &ssh.Signature{}
+			if err := ssh.Unmarshal(blob, sig); err != nil {
+				return nil, fmt.Errorf("manifest line %v: %v", line, err)
+			}
+			m.Signature = sig
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("manifest line %v: expected version and two checksums", line)
+		}
+		version, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("manifest line %v: %v", line, err)
+		}
+		e := Entry{Version: uint(version)}
+		if fields[1] != missing {
+			e.Up = fields[1]
+		}
+		if fields[2] != missing {
+			e.Down = fields[2]
+		}
+		if n := len(m.Entries); n > 0 && m.Entries[n-1].Version >= e.Version {
+			return nil, fmt.Errorf("manifest line %v: versions must be ascending", line)
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,150 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"golang.org/x/crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/stub"
+	"golang.org/x/crypto/ssh"
+)
+
+func stubSource(t *testing.T) source.Driver {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+
+	src, err := (&stub.Stub{}).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.(*stub.Stub).Migrations = migrations
+	return src
+}
+
+func TestBuild(t *testing.T) {
+	m, err := Build(stubSource(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Version: 1, Up: Checksum([]byte("CREATE 1")), Down: Checksum([]byte("DROP 1"))},
+		{Version: 3, Up: Checksum([]byte("CREATE 3"))},
+	}
+	if len(m.Entries) != len(expected) {
+		t.Fatalf("expected %v entries, got %v", len(expected), len(m.Entries))
+	}
+	for i, e := range expected {
+		if m.Entries[i] != e {
+			t.Errorf("expected entry %+v, got %+v", e, m.Entries[i])
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m, err := Build(stubSource(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		version   uint
+		direction source.Direction
+		body      string
+		expectErr error
+	}{
+		{1, source.Up, "CREATE 1", nil},
+		{1, source.Down, "DROP 1", nil},
+		{1, source.Up, "CREATE 2", ErrUnverified{Version: 1, Direction: source.Up}},
+		{3, source.Down, "DROP 3", ErrUnverified{Version: 3, Direction: source.Down, Missing: true}},
+		{4, source.Up, "CREATE 4", ErrUnverified{Version: 4, Direction: source.Up, Missing: true}},
+	}
+	for _, tc := range tt {
+		if err := m.Verify(tc.version, tc.direction, []byte(tc.body)); err != tc.expectErr {
+			t.Errorf("%v.%v: expected %v, got %v", tc.version, tc.direction, tc.expectErr, err)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	expected := &Manifest{Entries: []Entry{
+		{Version: 1, Up: "a", Down: "b"},
+		{Version: 2, Up: "c", Down: "d"},
+		{Version: 4, Up: "e"},
+	}}
+	actual := &Manifest{Entries: []Entry{
+		{Version: 1, Up: "a", Down: "b"},
+		{Version: 3, Up: "f"},
+		{Version: 4, Up: "g", Down: "h"},
+	}}
+
+	diffs := Diff(expected, actual)
+	got := make([]string, 0, len(diffs))
+	for _, d := range diffs {
+		got = append(got, d.String())
+	}
+	want := []string{"2.up removed", "2.down removed", "3.up added", "4.up changed", "4.down added"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if diffs := Diff(expected, expected); len(diffs) != 0 {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+}
+
+func TestSignReadVerify(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Build(stubSource(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifySignature(signer.PublicKey()); err != ErrNotSigned {
+		t.Fatalf("expected ErrNotSigned, got %v", err)
+	}
+	if err := m.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := read.VerifySignature(signer.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+
+	read.Entries[0].Up = Checksum([]byte("DROP TABLE users"))
+	if err := read.VerifySignature(signer.PublicKey()); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tt := []string{
+		"1 abc",
+		"x abc def",
+		"2 abc def\n1 abc def",
+		"signature !!!",
+	}
+	for _, tc := range tt {
+		if _, err := Read(bytes.NewReader([]byte(tc))); err == nil {
+			t.Errorf("expected error for %q", tc)
+		}
+	}
+}
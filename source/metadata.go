@@ -0,0 +1,149 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source/pragma"
+)
+
+// Metadata describes the up or down migration of a version, see Describe.
+type Metadata struct {
+	Version   uint
+	Direction Direction
+
+	// Identifier is the identifier returned by ReadUp and ReadDown.
+	Identifier string
+
+	// Name is the name of the migration file, e.g. 1_create_users.up.sql,
+	// or the identifier if the driver doesn't know it.
+	Name string
+
+	// Description is the identifier in words, e.g. "create users".
+	Description string
+
+	// Checksum is the SHA-256 of the body, see Checksum.
+	Checksum string
+
+	// Size is the size of the body in bytes.
+	Size int64
+
+	// Pragmas are the pragmas of the body and Tags the tags of its tags
+	// pragmas, see package pragma. They are parsed from the body as
+	// stored, so migrate.Migrate.Describe parses them from the decoded
+	// body of an encoded, compressed or encrypted migration.
+	Pragmas pragma.Pragmas
+	Tags    []string
+}
+
+// Describer is implemented by drivers which describe their migrations
+// themselves, e.g. with the file name or from an index which has the
+// checksums, rather than Describe reading the migration. The drivers built
+// on httpfs, e.g. file, and filter implement it.
+type Describer interface {
+	// Describe returns the metadata of the migration of version in
+	// direction. If there is no such migration, it must return
+	// os.ErrNotExist.
+	Describe(version uint, direction Direction) (Metadata, error)
+}
+
+// Describe returns the metadata of the migration of version in direction,
+// from the driver if it is a Describer, or else from the body read with
+// ReadUp or ReadDown. It returns os.ErrNotExist if there is no such
+// migration.
+func Describe(d Driver, version uint, direction Direction) (Metadata, error) {
+	if describer, ok := d.(Describer); ok {
+		return describer.Describe(version, direction)
+	}
+	read := d.ReadUp
+	if direction == Down {
+		read = d.ReadDown
+	}
+	r, identifier, err := read(version)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer r.Close()
+	return ReadMetadata(&Migration{Version: version, Direction: direction, Identifier: identifier}, r)
+}
+
+// ReadMetadata returns the metadata of migration m with the body read from
+// r, e.g. for the Describe of a driver, without reading the body into
+// memory: the pragmas are searched for in its first metadataHeadSize bytes.
+// Name is the base of m.Raw, if set.
+func ReadMetadata(m *Migration, r io.Reader) (Metadata, error) {
+	name := m.Identifier
+	if m.Raw != "" {
+		name = m.Raw[strings.LastIndex(m.Raw, "/")+1:]
+	}
+	body := bufio.NewReaderSize(r, metadataHeadSize)
+	head, err := body.Peek(metadataHeadSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return Metadata{}, err
+	}
+	if len(head) == metadataHeadSize {
+		// ignore a partially read line
+		if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+			head = head[:i]
+		}
+	}
+	// parsed before reading on, which reuses head
+	pragmas := pragma.Parse(head)
+
+	var size sizeCounter
+	checksum, err := ChecksumReader(io.TeeReader(body, &size))
+	if err != nil {
+		return Metadata{}, err
+	}
+	return Metadata{
+		Version:     m.Version,
+		Direction:   m.Direction,
+		Identifier:  m.Identifier,
+		Name:        name,
+		Description: Description(m.Identifier),
+		Checksum:    checksum,
+		Size:        int64(size),
+		Pragmas:     pragmas,
+		Tags:        pragmas.Tags(),
+	}, nil
+}
+
+// metadataHeadSize is the number of bytes at the start of a migration
+// which ReadMetadata searches for pragmas, as migrate.Migrate does.
+const metadataHeadSize = 4096
+
+// sizeCounter counts the bytes written to it
+type sizeCounter int64
+
+func (c *sizeCounter) Write(p []byte) (int, error) {
+	*c += sizeCounter(len(p))
+	return len(p), nil
+}
+
+// Description returns identifier in words, with its underscores and dashes
+// replaced by spaces, e.g. "create users" for create_users.
+func Description(identifier string) string {
+	return strings.Join(strings.FieldsFunc(identifier, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' '
+	}), " ")
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of a migration body.
+func Checksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// ChecksumReader returns the checksum of the migration body read from r,
+// see Checksum, without reading the body into memory.
+func ChecksumReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,46 @@
+package source
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadMetadata(t *testing.T) {
+	body := []byte("-- migrate:tags billing, slow\n-- migrate:no-transaction\nCREATE INDEX ...")
+	m := &Migration{Version: 3, Direction: Up, Identifier: "add_orders-index", Raw: "billing/3_add_orders-index.up.sql"}
+	meta, err := ReadMetadata(m, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Version != 3 || meta.Direction != Up || meta.Identifier != "add_orders-index" {
+		t.Errorf("unexpected migration %+v", meta)
+	}
+	if meta.Name != "3_add_orders-index.up.sql" {
+		t.Errorf("expected the file name, got %v", meta.Name)
+	}
+	if meta.Description != "add orders index" {
+		t.Errorf("expected the description add orders index, got %v", meta.Description)
+	}
+	if meta.Checksum != Checksum(body) || meta.Size != int64(len(body)) {
+		t.Errorf("unexpected checksum %v and size %v", meta.Checksum, meta.Size)
+	}
+	if len(meta.Pragmas) != 2 || !reflect.DeepEqual(meta.Tags, []string{"billing", "slow"}) {
+		t.Errorf("unexpected pragmas %v and tags %v", meta.Pragmas, meta.Tags)
+	}
+
+	// without a file, the identifier names the migration
+	if meta, err := ReadMetadata(&Migration{Version: 3, Direction: Up, Identifier: "CREATE 3"}, bytes.NewReader(nil)); err != nil || meta.Name != "CREATE 3" {
+		t.Errorf("expected the identifier as name, got %v, %v", meta.Name, err)
+	}
+
+	// a body larger than the head searched for pragmas
+	body = []byte("-- migrate:tags slow\n" + strings.Repeat("INSERT INTO t VALUES (1);\n", 1000))
+	if meta, err = ReadMetadata(m, bytes.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Checksum != Checksum(body) || meta.Size != int64(len(body)) || !reflect.DeepEqual(meta.Tags, []string{"slow"}) {
+		t.Errorf("unexpected checksum %v, size %v and tags %v", meta.Checksum, meta.Size, meta.Tags)
+	}
+}
@@ -26,6 +26,10 @@ type Migration struct {
 	// Direction is either Up or Down.
 	Direction Direction
 
+	// Dialect is the database driver this migration is written for,
+	// or empty if it is generic. See Dialects.
+	Dialect string
+
 	// Raw holds the raw location path to this migration in source.
 	// ReadUp and ReadDown will use this.
 	Raw string
@@ -35,34 +39,74 @@ type Migration struct {
 // to keep track of Migration order.
 type Migrations struct {
 	index      uintSlice
-	migrations map[uint]map[Direction]*Migration
+	migrations map[uint]map[Direction]map[string]*Migration
+	dialect    string
 }
 
 func NewMigrations() *Migrations {
 	return &Migrations{
 		index:      make(uintSlice, 0),
-		migrations: make(map[uint]map[Direction]*Migration),
+		migrations: make(map[uint]map[Direction]map[string]*Migration),
 	}
 }
 
+// SelectDialect makes Up and Down prefer the migrations written for dialect
+// over generic ones.
+func (i *Migrations) SelectDialect(dialect string) {
+	i.dialect = dialect
+}
+
+// Append adds m unless there is a migration of the same version, direction
+// and dialect already.
 func (i *Migrations) Append(m *Migration) (ok bool) {
 	if m == nil {
 		return false
 	}
-
-	if i.migrations[m.Version] == nil {
-		i.migrations[m.Version] = make(map[Direction]*Migration)
+	if _, dup := i.migrations[m.Version][m.Direction][m.Dialect]; dup {
+		return false
 	}
+	i.insert(m)
+	return true
+}
 
-	// reject duplicate versions
-	if _, dup := i.migrations[m.Version][m.Direction]; dup {
-		return false
+// Add is like Append for migrations read from files, whose identifier is
+// part of their name, and returns ErrDuplicateMigration naming both files
+// if the version is taken: by a migration of the same direction and
+// dialect, or of another identifier.
+func (i *Migrations) Add(m *Migration) error {
+	if other := i.conflict(m); other != nil {
+		return ErrDuplicateMigration{Migration: *m, Other: other}
 	}
+	i.insert(m)
+	return nil
+}
 
-	i.migrations[m.Version][m.Direction] = m
+func (i *Migrations) insert(m *Migration) {
+	if i.migrations[m.Version] == nil {
+		i.migrations[m.Version] = make(map[Direction]map[string]*Migration)
+	}
+	if i.migrations[m.Version][m.Direction] == nil {
+		i.migrations[m.Version][m.Direction] = make(map[string]*Migration)
+	}
+	i.migrations[m.Version][m.Direction][m.Dialect] = m
 	i.buildIndex()
+}
 
-	return true
+// conflict returns the migration whose version m would share.
+func (i *Migrations) conflict(m *Migration) *Migration {
+	if other, dup := i.migrations[m.Version][m.Direction][m.Dialect]; dup {
+		return other
+	}
+	var conflict *Migration
+	for _, dialects := range i.migrations[m.Version] {
+		for _, other := range dialects {
+			// the first by name, to report the same one every time
+			if other.Identifier != m.Identifier && (conflict == nil || other.Raw < conflict.Raw) {
+				conflict = other
+			}
+		}
+	}
+	return conflict
 }
 
 func (i *Migrations) buildIndex() {
@@ -97,17 +141,23 @@ func (i *Migrations) Next(version uint) (nextVersion uint, ok bool) {
 }
 
 func (i *Migrations) Up(version uint) (m *Migration, ok bool) {
-	if _, ok := i.migrations[version]; ok {
-		if mx, ok := i.migrations[version][Up]; ok {
-			return mx, true
-		}
-	}
-	return nil, false
+	return i.find(version, Up)
 }
 
 func (i *Migrations) Down(version uint) (m *Migration, ok bool) {
+	return i.find(version, Down)
+}
+
+// find returns the migration for the selected dialect,
+// falling back to the generic migration.
+func (i *Migrations) find(version uint, direction Direction) (m *Migration, ok bool) {
 	if _, ok := i.migrations[version]; ok {
-		if mx, ok := i.migrations[version][Down]; ok {
+		if i.dialect != "" {
+			if mx, ok := i.migrations[version][direction][i.dialect]; ok {
+				return mx, true
+			}
+		}
+		if mx, ok := i.migrations[version][direction][""]; ok {
 			return mx, true
 		}
 	}
@@ -12,6 +12,37 @@ func TestAppend(t *testing.T) {
 	// TODO
 }
 
+func TestAdd(t *testing.T) {
+	m := NewMigrations()
+	for _, migr := range []*Migration{
+		{Version: 1, Direction: Up, Identifier: "users", Raw: "1_users.up.sql"},
+		{Version: 1, Direction: Down, Identifier: "users", Raw: "1_users.down.sql"},
+		{Version: 1, Direction: Up, Identifier: "users", Dialect: "mysql", Raw: "1_users.mysql.up.sql"},
+	} {
+		if err := m.Add(migr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		migration *Migration
+		other     string
+	}{
+		{&Migration{Version: 1, Direction: Up, Identifier: "users", Raw: "1_users_copy.up.sql"}, "1_users.up.sql"},
+		{&Migration{Version: 1, Direction: Up, Identifier: "orders", Dialect: "postgres", Raw: "1_orders.postgres.up.sql"}, "1_users.down.sql"},
+	}
+	for _, tc := range tt {
+		err := m.Add(tc.migration)
+		dup, ok := err.(ErrDuplicateMigration)
+		if !ok {
+			t.Fatalf("expected ErrDuplicateMigration for %v, got %v", tc.migration.Raw, err)
+		}
+		if dup.Other.Raw != tc.other {
+			t.Errorf("expected %v to collide with %v, got %v", tc.migration.Raw, tc.other, dup.Other.Raw)
+		}
+	}
+}
+
 func TestBuildIndex(t *testing.T) {
 	// TODO
 }
@@ -28,6 +59,48 @@ func TestUp(t *testing.T) {
 	// TODO
 }
 
+func TestDialect(t *testing.T) {
+	m := NewMigrations()
+	m.Append(&Migration{Version: 1, Direction: Up, Identifier: "generic"})
+	m.Append(&Migration{Version: 1, Direction: Up, Identifier: "postgres", Dialect: "postgres"})
+	m.Append(&Migration{Version: 1, Direction: Down, Identifier: "generic"})
+	m.Append(&Migration{Version: 2, Direction: Up, Identifier: "mysql", Dialect: "mysql"})
+	if m.Append(&Migration{Version: 1, Direction: Up, Identifier: "postgres", Dialect: "postgres"}) {
+		t.Error("expected duplicate dialect migration to be rejected")
+	}
+
+	tt := []struct {
+		dialect   string
+		version   uint
+		direction Direction
+		expected  string
+	}{
+		{"", 1, Up, "generic"},
+		{"postgres", 1, Up, "postgres"},
+		{"postgres", 1, Down, "generic"},
+		{"mysql", 1, Up, "generic"},
+		{"mysql", 2, Up, "mysql"},
+		{"postgres", 2, Up, ""},
+	}
+	for _, tc := range tt {
+		m.SelectDialect(tc.dialect)
+		migr, ok := m.find(tc.version, tc.direction)
+		if tc.expected == "" {
+			if ok {
+				t.Errorf("%v %v.%v: expected no migration, got %v", tc.dialect, tc.version, tc.direction, migr.Identifier)
+			}
+			continue
+		}
+		if !ok || migr.Identifier != tc.expected {
+			t.Errorf("%v %v.%v: expected %v, got %v", tc.dialect, tc.version, tc.direction, tc.expected, migr)
+		}
+	}
+
+	if v, ok := m.Next(1); !ok || v != 2 {
+		t.Errorf("expected version 2 to be indexed, got %v", v)
+	}
+}
+
 func TestDown(t *testing.T) {
 	// TODO
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 var (
@@ -20,7 +21,33 @@ var (
 //  123_name.down.ext
 var Regex = regexp.MustCompile(`^([0-9]+)_(.*)\.(` + string(Down) + `|` + string(Up) + `)\.(.*)$`)
 
-// Parse returns Migration for matching Regex pattern.
+// Dialects are the names of the database drivers which migrations can be
+// written for, by adding the name in front of the direction:
+//  123_name.postgres.up.ext
+var Dialects = []string{
+	"cassandra", "clickhouse", "cockroachdb", "firebird", "mongodb", "mysql", "neo4j",
+	"postgres", "ql", "redshift", "spanner", "sqlite3", "sqlserver",
+}
+
+// dialectAliases maps the names under which database drivers
+// are registered to their dialect.
+var dialectAliases = map[string]string{
+	"postgresql":    "postgres",
+	"cockroach":     "cockroachdb",
+	"crdb-postgres": "cockroachdb",
+	"firebirdsql":   "firebird",
+}
+
+// DialectOf returns the dialect of a database driver name.
+func DialectOf(databaseName string) string {
+	if dialect, ok := dialectAliases[databaseName]; ok {
+		return dialect
+	}
+	return databaseName
+}
+
+// Parse returns Migration for matching Regex pattern, SemverRegex or
+// ULIDRegex.
 func Parse(raw string) (*Migration, error) {
 	m := Regex.FindStringSubmatch(raw)
 	if len(m) == 5 {
@@ -28,12 +55,31 @@ func Parse(raw string) (*Migration, error) {
 		if err != nil {
 			return nil, err
 		}
+		identifier, dialect := parseDialect(m[2])
 		return &Migration{
 			Version:    uint(versionUint64),
-			Identifier: m[2],
+			Identifier: identifier,
 			Direction:  Direction(m[3]),
+			Dialect:    dialect,
 			Raw:        raw,
 		}, nil
 	}
-	return nil, ErrParse
+	if m, err := parseSemver(raw); err != ErrParse {
+		return m, err
+	}
+	return parseULID(raw)
+}
+
+// parseDialect splits a trailing dialect off the identifier.
+func parseDialect(identifier string) (string, string) {
+	i := strings.LastIndex(identifier, ".")
+	if i < 0 {
+		return identifier, ""
+	}
+	for _, dialect := range Dialects {
+		if identifier[i+1:] == dialect {
+			return identifier[:i], dialect
+		}
+	}
+	return identifier, ""
 }
@@ -1,7 +1,12 @@
 package source
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestParse(t *testing.T) {
@@ -60,6 +65,58 @@ func TestParse(t *testing.T) {
 				Raw:        "20170412214116_date_foobar.up.sql",
 			},
 		},
+		{
+			name:      "1_foobar.postgres.up.sql",
+			expectErr: nil,
+			expectMigration: &Migration{
+				Version:    1,
+				Identifier: "foobar",
+				Direction:  Up,
+				Dialect:    "postgres",
+				Raw:        "1_foobar.postgres.up.sql",
+			},
+		},
+		{
+			name:      "1_foo.bar.up.sql",
+			expectErr: nil,
+			expectMigration: &Migration{
+				Version:    1,
+				Identifier: "foo.bar",
+				Direction:  Up,
+				Raw:        "1_foo.bar.up.sql",
+			},
+		},
+		{
+			name:      "v1.4.2_001_foobar.up.sql",
+			expectErr: nil,
+			expectMigration: &Migration{
+				Version:    1000040000200001,
+				Identifier: "foobar",
+				Direction:  Up,
+				Raw:        "v1.4.2_001_foobar.up.sql",
+			},
+		},
+		{
+			name:      "v1.4.2_001_foobar.postgres.down.sql",
+			expectErr: nil,
+			expectMigration: &Migration{
+				Version:    1000040000200001,
+				Identifier: "foobar",
+				Direction:  Down,
+				Dialect:    "postgres",
+				Raw:        "v1.4.2_001_foobar.postgres.down.sql",
+			},
+		},
+		{
+			name:            "v1.4_001_foobar.up.sql",
+			expectErr:       ErrParse,
+			expectMigration: nil,
+		},
+		{
+			name:            "v1.4.2_foobar.up.sql",
+			expectErr:       ErrParse,
+			expectMigration: nil,
+		},
 		{
 			name:            "-1_foobar.up.sql",
 			expectErr:       ErrParse,
@@ -104,3 +161,87 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestSemverVersion(t *testing.T) {
+	ordered := [][4]uint64{
+		{0, 0, 1, 1},
+		{1, 4, 2, 1},
+		{1, 4, 2, 2},
+		{1, 4, 2, 10},
+		{1, 9, 3, 17},
+		{1, 10, 0, 1},
+		{2, 0, 0, 1},
+	}
+	var prev uint
+	for i, p := range ordered {
+		v, err := SemverVersion(p[0], p[1], p[2], p[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && v <= prev {
+			t.Errorf("expected v%v.%v.%v_%v after %v", p[0], p[1], p[2], p[3], FormatSemver(prev))
+		}
+		if expected := fmt.Sprintf("v%v.%v.%v_%v", p[0], p[1], p[2], p[3]); FormatSemver(v) != expected {
+			t.Errorf("expected %v, got %v", expected, FormatSemver(v))
+		}
+		prev = v
+	}
+
+	if strconv.IntSize == 64 {
+		v, err := SemverVersion(9222, 99999, 99999, 99999)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(v) > math.MaxInt64 {
+			t.Errorf("expected %v to fit int64", FormatSemver(v))
+		}
+	}
+
+	for _, p := range [][4]uint64{{1, 100000, 0, 1}, {1, 0, 0, 100000}, {9223, 0, 0, 0}, {18446, 0, 0, 1}} {
+		if _, err := SemverVersion(p[0], p[1], p[2], p[3]); err == nil {
+			t.Errorf("expected v%v.%v.%v_%v to be out of range", p[0], p[1], p[2], p[3])
+		}
+	}
+}
+
+func TestULID(t *testing.T) {
+	ts := time.Date(2023, 3, 2, 12, 0, 0, 0, time.UTC)
+	entropy := bytes.NewReader([]byte{0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0})
+	id, err := NewULID(ts, entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 26 || !ULIDRegex.MatchString(id+"_foobar.up.sql") {
+		t.Fatalf("invalid ULID %v", id)
+	}
+	v, err := ULIDVersion(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := uint(ts.UnixNano() / int64(time.Millisecond))
+	if expected := ms<<16 | 0xffff; v != expected {
+		t.Errorf("expected version %v, got %v", expected, v)
+	}
+
+	later, err := NewULID(ts.Add(time.Millisecond), bytes.NewReader(make([]byte, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lv, err := ULIDVersion(later); err != nil || lv <= v || later <= id {
+		t.Errorf("expected %v to be ordered after %v", later, id)
+	}
+
+	for _, invalid := range []string{"81ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FA", "01ARZ3NDEKTSV4RRFFQ69G5FAI"} {
+		if _, err := ULIDVersion(invalid); err == nil {
+			t.Errorf("expected %v to be invalid", invalid)
+		}
+	}
+
+	m, err := Parse("01ARZ3NDEKTSV4RRFFQ69G5FAV_foo.postgres.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Identifier != "foo" || m.Dialect != "postgres" || m.Direction != Up {
+		t.Errorf("unexpected migration %+v", *m)
+	}
+}
@@ -0,0 +1,61 @@
+package pragma
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Eval evaluates the condition of an `if` pragma, e.g.
+//  env == "staging" || env == "dev"
+// A condition consists of comparisons with `==` or `!=`, combined with
+// `&&` and `||` (which binds weaker). Operands are quoted strings or the
+// names of variables, undefined variables are empty.
+func Eval(condition string, vars map[string]string) (bool, error) {
+	if strings.TrimSpace(condition) == "" {
+		return false, fmt.Errorf("empty condition")
+	}
+	for _, or := range strings.Split(condition, "||") {
+		result := true
+		for _, and := range strings.Split(or, "&&") {
+			ok, err := compare(and, vars)
+			if err != nil {
+				return false, err
+			}
+			result = result && ok
+		}
+		if result {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compare(comparison string, vars map[string]string) (bool, error) {
+	for _, op := range []string{"==", "!="} {
+		i := strings.Index(comparison, op)
+		if i < 0 {
+			continue
+		}
+		lhs, err := operand(comparison[:i], vars)
+		if err != nil {
+			return false, err
+		}
+		rhs, err := operand(comparison[i+len(op):], vars)
+		if err != nil {
+			return false, err
+		}
+		return (lhs == rhs) == (op == "=="), nil
+	}
+	return false, fmt.Errorf("invalid comparison %q, expected == or !=", strings.TrimSpace(comparison))
+}
+
+func operand(s string, vars map[string]string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], nil
+	}
+	if s == "" || strings.ContainsAny(s, " \t\"'=!&|") {
+		return "", fmt.Errorf("invalid operand %q", s)
+	}
+	return vars[s], nil
+}
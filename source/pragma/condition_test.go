@@ -0,0 +1,42 @@
+package pragma
+
+import (
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]string{"env": "staging", "dialect": "postgres"}
+	tt := []struct {
+		condition string
+		expected  bool
+		expectErr bool
+	}{
+		{condition: `env == "staging"`, expected: true},
+		{condition: `env == 'staging'`, expected: true},
+		{condition: `env == "production"`, expected: false},
+		{condition: `env != "production"`, expected: true},
+		{condition: `"staging" == env`, expected: true},
+		{condition: `env == "staging" && dialect == "mysql"`, expected: false},
+		{condition: `env == "dev" || dialect == "postgres"`, expected: true},
+		{condition: `env == "dev" || env == "staging" && dialect == "postgres"`, expected: true},
+		{condition: `region == ""`, expected: true},
+		{condition: `env == dialect`, expected: false},
+		{condition: ``, expectErr: true},
+		{condition: `env`, expectErr: true},
+		{condition: `env = "staging"`, expectErr: true},
+		{condition: `env == "staging`, expectErr: true},
+		{condition: `env == `, expectErr: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.condition, func(t *testing.T) {
+			result, err := Eval(tc.condition, vars)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Package pragma parses the comment pragmas found at the top of migration
+// files, e.g.
+//  -- migrate:no-transaction
+//  -- migrate:delimiter $$
+// A pragma is a line comment (`--`, `#` or `//`) starting with `migrate:`,
+// followed by the pragma name and an optional value.
+// Only the leading block of empty and comment lines is searched for pragmas.
+package pragma
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Prefix introduces a pragma within a comment.
+const Prefix = "migrate:"
+
+// Names of the well known pragmas.
+const (
+	Transaction      = "transaction"
+	NoTransaction    = "no-transaction"
+	Delimiter        = "delimiter"
+	DependsOn        = "depends-on"
+	If               = "if"
+	Template         = "template"
+	Exec             = "exec"
+	Starlark         = "starlark"
+	Load             = "load"
+	Backfill         = "backfill"
+	StatementTimeout = "statement-timeout"
+	LintIgnore       = "lint-ignore"
+	Tags             = "tags"
+
+	// SnapshotVersion heads schema snapshots, see migrate.Migrate.DumpSchema.
+	SnapshotVersion = "snapshot-version"
+
+	// ChangeScriptFrom and ChangeScriptChecksum head change scripts, see
+	// migrate.Migrate.WriteChangeScript.
+	ChangeScriptFrom     = "change-script-from"
+	ChangeScriptChecksum = "change-script-checksum"
+)
+
+var commentMarkers = []string{"--", "#", "//"}
+
+// Pragma is a single pragma.
+type Pragma struct {
+	Name  string
+	Value string
+}
+
+// Pragmas holds the pragmas of a migration in order of appearance.
+type Pragmas []Pragma
+
+// Has returns true if a pragma with the given name is present.
+func (p Pragmas) Has(name string) bool {
+	_, ok := p.Get(name)
+	return ok
+}
+
+// Get returns the value of the last pragma with the given name.
+func (p Pragmas) Get(name string) (value string, ok bool) {
+	for _, x := range p {
+		if x.Name == name {
+			value, ok = x.Value, true
+		}
+	}
+	return value, ok
+}
+
+// All returns the values of all pragmas with the given name.
+func (p Pragmas) All(name string) []string {
+	values := make([]string, 0)
+	for _, x := range p {
+		if x.Name == name {
+			values = append(values, x.Value)
+		}
+	}
+	return values
+}
+
+// Parse returns the pragmas found in the leading comment block of body.
+// Lines are split on the body itself, so there's no limit on their length.
+func Parse(body []byte) Pragmas {
+	pragmas := make(Pragmas, 0)
+	for len(body) > 0 {
+		var line string
+		if i := bytes.IndexByte(body, '\n'); i >= 0 {
+			line, body = string(body[:i]), body[i+1:]
+		} else {
+			line, body = string(body), nil
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		comment, ok := trimCommentMarker(line)
+		if !ok {
+			break
+		}
+		if p, ok := parseLine(comment); ok {
+			pragmas = append(pragmas, p)
+		}
+	}
+	return pragmas
+}
+
+// Body returns a reader of body following its leading block of empty and
+// comment lines, e.g. the data of a migration with the `load` pragma.
+func Body(body io.Reader) io.Reader {
+	r := bufio.NewReader(body)
+	for {
+		line, err := r.ReadString('\n')
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			if _, ok := trimCommentMarker(trimmed); !ok {
+				return io.MultiReader(strings.NewReader(line), r)
+			}
+		}
+		if err == io.EOF {
+			return strings.NewReader("")
+		}
+		if err != nil {
+			return errReader{err}
+		}
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// trimCommentMarker returns the comment text of a line comment.
+func trimCommentMarker(line string) (string, bool) {
+	for _, marker := range commentMarkers {
+		if strings.HasPrefix(line, marker) {
+			return strings.TrimSpace(strings.TrimPrefix(line, marker)), true
+		}
+	}
+	return "", false
+}
+
+func parseLine(comment string) (Pragma, bool) {
+	if !strings.HasPrefix(comment, Prefix) {
+		return Pragma{}, false
+	}
+	comment = strings.TrimPrefix(comment, Prefix)
+	if comment == "" {
+		return Pragma{}, false
+	}
+	name := comment
+	value := ""
+	if i := strings.IndexAny(comment, " \t"); i >= 0 {
+		name = comment[:i]
+		value = strings.TrimSpace(comment[i:])
+	}
+	return Pragma{Name: name, Value: value}, true
+}
@@ -0,0 +1,119 @@
+package pragma
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name     string
+		body     string
+		expected Pragmas
+	}{
+		{"empty", "", Pragmas{}},
+		{"no pragmas", "CREATE TABLE t (id int);", Pragmas{}},
+		{"single", "-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY i ON t (id);",
+			Pragmas{{Name: NoTransaction}}},
+		{"value", "-- migrate:delimiter $$\n", Pragmas{{Name: "delimiter", Value: "$$"}}},
+		{"markers", "#migrate:a 1\n// migrate:b 2\n--  migrate:c   3 4  \n",
+			Pragmas{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3 4"}}},
+		{"comments and empty lines", "-- a comment\n\n-- migrate:transaction\n",
+			Pragmas{{Name: Transaction}}},
+		{"stops at first statement", "SELECT 1;\n-- migrate:no-transaction\n", Pragmas{}},
+		{"empty name", "-- migrate:\n", Pragmas{}},
+		{"long comment line", "-- " + strings.Repeat("x", 100*1024) + "\n-- migrate:no-transaction\n",
+			Pragmas{{Name: NoTransaction}}},
+		{"crlf", "-- migrate:a 1\r\n-- migrate:b\r\n", Pragmas{{Name: "a", Value: "1"}, {Name: "b"}}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p := Parse([]byte(tc.body))
+			if !reflect.DeepEqual(p, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, p)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	p := Pragmas{{Name: "a", Value: "1"}, {Name: "b"}, {Name: "a", Value: "2"}}
+	if v, ok := p.Get("a"); !ok || v != "2" {
+		t.Errorf("expected 2, got %v", v)
+	}
+	if !p.Has("b") {
+		t.Error("expected b")
+	}
+	if p.Has("c") {
+		t.Error("didn't expect c")
+	}
+	if v := p.All("a"); !reflect.DeepEqual(v, []string{"1", "2"}) {
+		t.Errorf("expected [1 2], got %v", v)
+	}
+}
+
+func TestBody(t *testing.T) {
+	tt := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"no pragmas", "code,name\nDE,Germany\n", "code,name\nDE,Germany\n"},
+		{"pragmas", "# migrate:load countries\n\n-- a comment\n  code,name\nDE,Germany", "  code,name\nDE,Germany"},
+		{"only pragmas", "# migrate:load countries\n", ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := ioutil.ReadAll(Body(strings.NewReader(tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, b)
+			}
+		})
+	}
+}
+
+func TestSelectTags(t *testing.T) {
+	tt := []struct {
+		selection string
+		tags      []string
+		expected  bool
+		expectErr bool
+	}{
+		{"", nil, true, false},
+		{"", []string{"slow"}, true, false},
+		{"!slow", []string{"billing", "slow"}, false, false},
+		{"!slow", []string{"billing"}, true, false},
+		{"!slow", nil, true, false},
+		{"billing", []string{"billing", "slow"}, true, false},
+		{"billing", nil, false, false},
+		{"billing, orders", []string{"orders"}, true, false},
+		{"billing,!slow", []string{"billing", "slow"}, false, false},
+		{"!", nil, false, true},
+		{"!!slow", nil, false, true},
+	}
+
+	for _, tc := range tt {
+		selected, err := SelectTags(tc.selection, tc.tags)
+		if (err != nil) != tc.expectErr {
+			t.Fatalf("%q: unexpected error %v", tc.selection, err)
+		}
+		if selected != tc.expected {
+			t.Errorf("%q of %v: expected %v, got %v", tc.selection, tc.tags, tc.expected, selected)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	p := Parse([]byte("-- migrate:tags billing,slow\n-- migrate:tags  orders\n"))
+	if tags := p.Tags(); !reflect.DeepEqual(tags, []string{"billing", "slow", "orders"}) {
+		t.Errorf("expected tags billing, slow and orders, got %v", tags)
+	}
+}
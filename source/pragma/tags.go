@@ -0,0 +1,50 @@
+package pragma
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tags returns the tags of the tags pragmas, e.g.
+//  -- migrate:tags billing,slow
+// Tags are separated by commas or spaces.
+func (p Pragmas) Tags() []string {
+	tags := make([]string, 0)
+	for _, value := range p.All(Tags) {
+		tags = append(tags, splitTags(value)...)
+	}
+	return tags
+}
+
+func splitTags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+}
+
+// SelectTags evaluates the tag selection selection against the tags of a
+// migration, e.g.
+//  billing,!slow
+// A selection is a list of tags separated by commas or spaces, of which the
+// migration needs at least one, and of tags prefixed with `!`, of which it
+// must have none. An empty selection selects every migration.
+func SelectTags(selection string, tags []string) (bool, error) {
+	has := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		has[tag] = true
+	}
+	included, wanted := false, false
+	for _, term := range splitTags(selection) {
+		tag := strings.TrimPrefix(term, "!")
+		if tag == "" || strings.HasPrefix(tag, "!") {
+			return false, fmt.Errorf("invalid tag selection %q", selection)
+		}
+		if tag != term {
+			if has[tag] {
+				return false, nil
+			}
+			continue
+		}
+		wanted = true
+		included = included || has[tag]
+	}
+	return included || !wanted, nil
+}
@@ -0,0 +1,77 @@
+package source
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// SemverRegex matches migrations versioned by a release and an index within
+// the release:
+//  v1.4.2_001_name.up.ext
+//  v1.4.2_001_name.down.ext
+var SemverRegex = regexp.MustCompile(`^v([0-9]+)\.([0-9]+)\.([0-9]+)_([0-9]+)_(.*)\.(` + string(Down) + `|` + string(Up) + `)\.(.*)$`)
+
+// semverBase is the factor between the parts of a semver version, so the
+// minor, patch and index parts have at most 5 digits. The major part is
+// limited so that every version of it fits an int64, as the databases store
+// versions in signed columns, e.g. BIGINT.
+const (
+	semverBase     = 100000
+	maxSemverMajor = math.MaxInt64/(semverBase*semverBase*semverBase) - 1
+)
+
+// SemverVersion returns the version of the migration with the index in the
+// release major.minor.patch. Versions are ordered by release, then index, so
+// v1.10.0_001 comes after v1.9.3_017.
+func SemverVersion(major, minor, patch, index uint64) (uint, error) {
+	if major > maxSemverMajor || minor >= semverBase || patch >= semverBase || index >= semverBase {
+		return 0, fmt.Errorf("semver version v%v.%v.%v_%v out of range", major, minor, patch, index)
+	}
+	v := ((major*semverBase+minor)*semverBase+patch)*semverBase + index
+	if uint64(uint(v)) != v {
+		return 0, fmt.Errorf("semver version v%v.%v.%v_%v out of range", major, minor, patch, index)
+	}
+	return uint(v), nil
+}
+
+// FormatSemver returns the release and index of a version returned by
+// SemverVersion, e.g. v1.4.2_1.
+func FormatSemver(version uint) string {
+	v := uint64(version)
+	index := v % semverBase
+	v /= semverBase
+	patch := v % semverBase
+	v /= semverBase
+	minor := v % semverBase
+	return fmt.Sprintf("v%v.%v.%v_%v", v/semverBase, minor, patch, index)
+}
+
+// parseSemver returns the migration of raw if it matches SemverRegex.
+func parseSemver(raw string) (*Migration, error) {
+	m := SemverRegex.FindStringSubmatch(raw)
+	if len(m) != 8 {
+		return nil, ErrParse
+	}
+	parts := make([]uint64, 4)
+	for i := range parts {
+		n, err := strconv.ParseUint(m[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = n
+	}
+	version, err := SemverVersion(parts[0], parts[1], parts[2], parts[3])
+	if err != nil {
+		return nil, err
+	}
+	identifier, dialect := parseDialect(m[5])
+	return &Migration{
+		Version:    version,
+		Identifier: identifier,
+		Direction:  Direction(m[6]),
+		Dialect:    dialect,
+		Raw:        raw,
+	}, nil
+}
@@ -46,6 +46,10 @@ func (s *Stub) Close() error {
 	return nil
 }
 
+func (s *Stub) SelectDialect(dialect string) {
+	s.Migrations.SelectDialect(dialect)
+}
+
 func (s *Stub) First() (version uint, err error) {
 	if v, ok := s.Migrations.First(); !ok {
 		return 0, &os.PathError{Op: "first", Path: s.Url, Err: os.ErrNotExist} // TODO: s.Url can be empty when called with WithInstance
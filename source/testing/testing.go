@@ -24,6 +24,7 @@ func Test(t *testing.T, d source.Driver) {
 	TestNext(t, d)
 	TestReadUp(t, d)
 	TestReadDown(t, d)
+	TestDescribe(t, d)
 }
 
 func TestFirst(t *testing.T, d source.Driver) {
@@ -167,3 +168,34 @@ func TestReadDown(t *testing.T, d source.Driver) {
 		}
 	}
 }
+
+// TestDescribe checks that source.Describe, e.g. of a source.Describer,
+// agrees with ReadUp and ReadDown.
+func TestDescribe(t *testing.T, d source.Driver) {
+	for _, direction := range []source.Direction{source.Up, source.Down} {
+		read := d.ReadUp
+		if direction == source.Down {
+			read = d.ReadDown
+		}
+		for version := uint(0); version <= 8; version++ {
+			meta, err := source.Describe(d, version, direction)
+			r, identifier, readErr := read(version)
+			if readErr != nil {
+				if !os.IsNotExist(err) {
+					t.Errorf("Describe: expected %v, got %v, for %v %v", readErr, err, version, direction)
+				}
+				continue
+			}
+			checksum, readErr := source.ChecksumReader(r)
+			r.Close()
+			if readErr != nil {
+				t.Errorf("Describe: %v, for %v %v", readErr, version, direction)
+			} else if err != nil {
+				t.Errorf("Describe: expected err to be nil, got %v, for %v %v", err, version, direction)
+			} else if meta.Version != version || meta.Direction != direction || meta.Identifier != identifier ||
+				meta.Checksum != checksum || meta.Name == "" {
+				t.Errorf("Describe: unexpected %+v, for %v %v", meta, version, direction)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ULIDRegex matches migrations prefixed with a ULID, see
+// https://github.com/ulid/spec:
+//  01ARZ3NDEKTSV4RRFFQ69G5FAV_name.up.ext
+//  01ARZ3NDEKTSV4RRFFQ69G5FAV_name.down.ext
+var ULIDRegex = regexp.MustCompile(`^([0-7][0-9A-HJKMNP-TV-Z]{25})_(.*)\.(` + string(Down) + `|` + string(Up) + `)\.(.*)$`)
+
+// crockford is the alphabet of ULIDs, Crockford's base32.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID of the time t, with randomness read from entropy.
+func NewULID(t time.Time, entropy io.Reader) (string, error) {
+	var b [16]byte
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> uint(40-8*i))
+	}
+	if _, err := io.ReadFull(entropy, b[6:]); err != nil {
+		return "", err
+	}
+
+	var hi, lo uint64
+	for i := 0; i < 8; i++ {
+		hi = hi<<8 | uint64(b[i])
+		lo = lo<<8 | uint64(b[i+8])
+	}
+	// 26 characters of 5 bits hold the 128 bits, the first character has 3
+	id := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		id[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id), nil
+}
+
+// ULIDVersion returns the version of a migration prefixed with ulid: its
+// first 64 bits, the 48 bit timestamp and 16 bits of its randomness. The
+// versions are ordered like the ULIDs, two ULIDs of the same millisecond
+// share a version with a chance of 1 in 65536.
+func ULIDVersion(ulid string) (uint, error) {
+	if len(ulid) != 26 {
+		return 0, fmt.Errorf("invalid ULID %q", ulid)
+	}
+	var hi, lo uint64
+	for i := 0; i < len(ulid); i++ {
+		n := strings.IndexByte(crockford, ulid[i])
+		if n < 0 || (i == 0 && n > 7) {
+			return 0, fmt.Errorf("invalid ULID %q", ulid)
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(n)
+	}
+	if uint64(uint(hi)) != hi {
+		return 0, fmt.Errorf("ULID %q out of range", ulid)
+	}
+	return uint(hi), nil
+}
+
+// parseULID returns the migration of raw if it matches ULIDRegex.
+func parseULID(raw string) (*Migration, error) {
+	m := ULIDRegex.FindStringSubmatch(raw)
+	if len(m) != 5 {
+		return nil, ErrParse
+	}
+	version, err := ULIDVersion(m[1])
+	if err != nil {
+		return nil, err
+	}
+	identifier, dialect := parseDialect(m[2])
+	return &Migration{
+		Version:    version,
+		Identifier: identifier,
+		Direction:  Direction(m[3]),
+		Dialect:    dialect,
+		Raw:        raw,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// spool holds a copy of a migration body written to it. Up to
+// DefaultBufferSize bytes are kept in memory, larger bodies are written
+// to a temporary file, so that large migrations don't take up memory.
+type spool struct {
+	buf  bytes.Buffer
+	file *os.File
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	if s.file == nil && s.buf.Len()+len(p) <= int(DefaultBufferSize) {
+		return s.buf.Write(p)
+	}
+	if s.file == nil {
+		f, err := ioutil.TempFile("", "migrate-")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+		if _, err := s.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+	return s.file.Write(p)
+}
+
+// reader returns a reader of the copy, which removes the temporary file
+// on Close.
+func (s *spool) reader() (io.ReadCloser, error) {
+	if s.file == nil {
+		return source.WithSize(ioutil.NopCloser(&s.buf), int64(s.buf.Len())), nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *spool) Read(p []byte) (int, error) {
+	return s.file.Read(p)
+}
+
+// Size implements source.Sizer.
+func (s *spool) Size() int64 {
+	return source.Size(s.file)
+}
+
+// Close removes the temporary file, if any.
+func (s *spool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if errRemove := os.Remove(s.file.Name()); err == nil {
+		err = errRemove
+	}
+	s.file = nil
+	return err
+}
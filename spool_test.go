@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+func TestSpool(t *testing.T) {
+	defer func(size uint) { DefaultBufferSize = size }(DefaultBufferSize)
+	DefaultBufferSize = 8
+
+	for _, body := range []string{"SELECT 1", "SELECT 1; SELECT 2"} {
+		t.Run(body, func(t *testing.T) {
+			s := &spool{}
+			if _, err := io.Copy(s, strings.NewReader(body)); err != nil {
+				t.Fatal(err)
+			}
+			if inFile := s.file != nil; inFile != (len(body) > 8) {
+				t.Fatalf("expected a temporary file %v, got %v", len(body) > 8, inFile)
+			}
+			r, err := s.reader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := source.Size(r); size != int64(len(body)) {
+				t.Fatalf("expected size %v, got %v", len(body), size)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != body {
+				t.Fatalf("expected %q, got %q", body, b)
+			}
+
+			var name string
+			if s.file != nil {
+				name = s.file.Name()
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if name != "" {
+				if _, err := os.Stat(name); !os.IsNotExist(err) {
+					t.Fatalf("expected the temporary file to be removed, got %v", err)
+				}
+			}
+		})
+	}
+}
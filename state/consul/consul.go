@@ -0,0 +1,142 @@
+// Package consul keeps the version in a key of Consul's KV store, through
+// its HTTP API.
+//
+// URL: consul://host:8500[?key=migrate-state&tls=true&token=secret]
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/state"
+)
+
+func init() {
+	state.Register("consul", &Consul{})
+}
+
+// DefaultKey is the key of the version.
+var DefaultKey = "migrate-state"
+
+type Config struct {
+	// Endpoint is the URL of a Consul agent, e.g. http://localhost:8500
+	Endpoint string
+	Key      string
+	// Token is the ACL token, if ACLs are enabled.
+	Token string
+}
+
+type Consul struct {
+	client *http.Client
+	config *Config
+}
+
+// value is the JSON stored in the key
+type value struct {
+	Version int       `json:"version"`
+	Dirty   bool      `json:"dirty"`
+	Updated time.Time `json:"updated"`
+}
+
+func (c *Consul) Open(url string) (state.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Query().Get("key")
+	if key == "" {
+		key = DefaultKey
+	}
+	scheme := "http"
+	if u.Query().Get("tls") == "true" {
+		scheme = "https"
+	}
+
+	return WithInstance(&http.Client{Timeout: 10 * time.Second}, &Config{
+		Endpoint: scheme + "://" + u.Host,
+		Key:      key,
+		Token:    u.Query().Get("token"),
+	})
+}
+
+// WithInstance returns a state store using client to talk to Consul.
+func WithInstance(client *http.Client, config *Config) (state.Driver, error) {
+	if config == nil || config.Endpoint == "" || config.Key == "" {
+		return nil, errors.New("consul: config needs an endpoint and key")
+	}
+	return &Consul{client: client, config: config}, nil
+}
+
+func (c *Consul) Close() error {
+	return nil
+}
+
+func (c *Consul) Version() (version int, dirty bool, err error) {
+	b, status, err := c.do(http.MethodGet, "?raw", nil)
+	if err != nil {
+		return 0, false, err
+	}
+	if status == http.StatusNotFound {
+		return database.NilVersion, false, nil
+	}
+	var v value
+	if err := json.Unmarshal(b, &v); err != nil {
+		return 0, false, fmt.Errorf("consul: invalid value of key %v: %v", c.config.Key, err)
+	}
+	return v.Version, v.Dirty, nil
+}
+
+func (c *Consul) SetVersion(version int, dirty bool) error {
+	if version == database.NilVersion {
+		_, _, err := c.do(http.MethodDelete, "", nil)
+		return err
+	}
+	body, err := json.Marshal(value{Version: version, Dirty: dirty, Updated: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	b, _, err := c.do(http.MethodPut, "", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(b)) != "true" {
+		return fmt.Errorf("consul: failed to put key %v", c.config.Key)
+	}
+	return nil
+}
+
+// do sends a request for the key and returns the body and status of the
+// response. A 404 isn't an error.
+func (c *Consul) do(method, query string, body io.Reader) ([]byte, int, error) {
+	req, err := http.NewRequest(method, c.config.Endpoint+"/v1/kv/"+c.config.Key+query, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+	r, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusNotFound {
+		return nil, 0, fmt.Errorf("consul: %v %v", r.StatusCode, strconv.Quote(string(b)))
+	}
+	return b, r.StatusCode, nil
+}
@@ -0,0 +1,83 @@
+package consul
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	st "github.com/golang-migrate/migrate/v4/state/testing"
+)
+
+// fakeConsul serves the KV API used by the state store
+type fakeConsul struct {
+	mu    sync.Mutex
+	token string
+	keys  map[string][]byte
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-Consul-Token") != f.token {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/kv/") {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	switch r.Method {
+	case http.MethodGet:
+		v, ok := f.keys[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(v)
+	case http.MethodPut:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.keys[key] = b
+		w.Write([]byte("true"))
+	case http.MethodDelete:
+		delete(f.keys, key)
+		w.Write([]byte("true"))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func Test(t *testing.T) {
+	s := httptest.NewServer(&fakeConsul{token: "secret", keys: make(map[string][]byte)})
+	defer s.Close()
+
+	d, err := (&Consul{}).Open("consul://" + strings.TrimPrefix(s.URL, "http://") + "?key=test-state&token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	st.Test(t, d)
+}
+
+func TestToken(t *testing.T) {
+	s := httptest.NewServer(&fakeConsul{token: "secret", keys: make(map[string][]byte)})
+	defer s.Close()
+
+	d, err := (&Consul{}).Open("consul://" + strings.TrimPrefix(s.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, _, err := d.Version(); err == nil {
+		t.Fatal("expected an error without token")
+	}
+}
@@ -0,0 +1,92 @@
+// Package state provides the Driver interface for external state stores.
+// They keep the version of databases without reliable transactional tables,
+// e.g. Elasticsearch or Kafka-like systems, outside of them.
+// All state drivers must implement this interface, register themselves
+// and pass the tests in package state/testing.
+package state
+
+import (
+	"fmt"
+	nurl "net/url"
+	"sync"
+)
+
+var driversMu sync.RWMutex
+var drivers = make(map[string]Driver)
+
+// Driver is the interface every state driver must implement.
+// A Driver is a database.StateStore and can be set as migrate.Migrate.State.
+//
+// How to implement a state driver?
+//   1. Implement this interface.
+//   2. Add a test that calls state/testing.go:Test()
+//   3. Call Register in init().
+//
+// Guidelines:
+//   * Version must return database.NilVersion if no version was set.
+//   * SetVersion must be atomic, a failed write must not lose the
+//     previous version.
+//   * State drivers don't lock, combine them with a lock provider of
+//     package lock if the database can't lock itself.
+type Driver interface {
+	// Open returns a new driver instance configured with parameters
+	// coming from the URL string.
+	Open(url string) (Driver, error)
+
+	// Close closes the connection to the store.
+	Close() error
+
+	// Version returns the current version and whether it is dirty,
+	// or database.NilVersion if no version was set.
+	Version() (version int, dirty bool, err error)
+
+	// SetVersion records version, or database.NilVersion,
+	// and whether it is dirty.
+	SetVersion(version int, dirty bool) error
+}
+
+// Open returns a new driver instance.
+func Open(url string) (Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("state driver: invalid URL scheme")
+	}
+
+	driversMu.RLock()
+	d, ok := drivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("state driver: unknown driver %v (forgotten import?)", u.Scheme)
+	}
+
+	return d.Open(url)
+}
+
+// Register globally registers a driver.
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("Register called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// List lists the registered drivers
+func List() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for n := range drivers {
+		names = append(names, n)
+	}
+	return names
+}
+
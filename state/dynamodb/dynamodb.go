@@ -0,0 +1,119 @@
+// Package dynamodb keeps the version in an item of a DynamoDB table.
+// The table needs a string partition key named StateID.
+//
+// URL: dynamodb://table[?key=migrate-state]
+// Credentials and region are read from the environment like the AWS CLI does.
+package dynamodb
+
+import (
+	"errors"
+	nurl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/state"
+)
+
+func init() {
+	state.Register("dynamodb", &DynamoDB{})
+}
+
+// DefaultKey is the StateID of the version item.
+var DefaultKey = "migrate-state"
+
+type Config struct {
+	Table string
+	Key   string
+}
+
+type DynamoDB struct {
+	client dynamodbiface.DynamoDBAPI
+	config *Config
+}
+
+func (d *DynamoDB) Open(url string) (state.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Query().Get("key")
+	if key == "" {
+		key = DefaultKey
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, err
+	}
+	return WithInstance(dynamodb.New(sess), &Config{Table: u.Host, Key: key})
+}
+
+// WithInstance returns a state store using an existing DynamoDB client.
+func WithInstance(client dynamodbiface.DynamoDBAPI, config *Config) (state.Driver, error) {
+	if config == nil || config.Table == "" || config.Key == "" {
+		return nil, errors.New("dynamodb: config needs a table and key")
+	}
+	return &DynamoDB{client: client, config: config}, nil
+}
+
+func (d *DynamoDB) Close() error {
+	return nil
+}
+
+func (d *DynamoDB) Version() (version int, dirty bool, err error) {
+	output, err := d.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      d.config.table(),
+		Key:            d.config.key(),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	item := output.Item
+	if item == nil || item["Version"] == nil {
+		return database.NilVersion, false, nil
+	}
+	version, err = strconv.Atoi(aws.StringValue(item["Version"].N))
+	if err != nil {
+		return 0, false, err
+	}
+	if v := item["Dirty"]; v != nil {
+		dirty = aws.BoolValue(v.BOOL)
+	}
+	return version, dirty, nil
+}
+
+func (d *DynamoDB) SetVersion(version int, dirty bool) error {
+	if version == database.NilVersion {
+		_, err := d.client.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: d.config.table(),
+			Key:       d.config.key(),
+		})
+		return err
+	}
+	// a single put replaces the item atomically
+	_, err := d.client.PutItem(&dynamodb.PutItemInput{
+		TableName: d.config.table(),
+		Item: map[string]*dynamodb.AttributeValue{
+			"StateID": {S: aws.String(d.config.Key)},
+			"Version": {N: aws.String(strconv.Itoa(version))},
+			"Dirty":   {BOOL: aws.Bool(dirty)},
+			"Updated": {S: aws.String(time.Now().UTC().Format(time.RFC3339))},
+		},
+	})
+	return err
+}
+
+func (c *Config) table() *string {
+	return aws.String(c.Table)
+}
+
+func (c *Config) key() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"StateID": {S: aws.String(c.Key)}}
+}
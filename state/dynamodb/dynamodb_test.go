@@ -0,0 +1,47 @@
+package dynamodb
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	st "github.com/golang-migrate/migrate/v4/state/testing"
+)
+
+// fakeDynamoDB stores the items written by the state store
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	mu    sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[*input.Item["StateID"].S] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: f.items[*input.Key["StateID"].S]}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.items, *input.Key["StateID"].S)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func Test(t *testing.T) {
+	client := &fakeDynamoDB{items: make(map[string]map[string]*dynamodb.AttributeValue)}
+	d, err := WithInstance(client, &Config{Table: "state", Key: "test-state"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
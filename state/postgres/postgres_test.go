@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/dhui/dktest"
+
+	"github.com/golang-migrate/migrate/v4/dktesting"
+	st "github.com/golang-migrate/migrate/v4/state/testing"
+)
+
+const pgPassword = "postgres"
+
+var (
+	opts = dktest.Options{
+		Env:          map[string]string{"POSTGRES_PASSWORD": pgPassword},
+		PortRequired: true, ReadyFunc: isReady}
+	// ON CONFLICT needs Postgres 9.5 or later
+	specs = []dktesting.ContainerSpec{
+		{ImageName: "postgres:9.5", Options: opts},
+		{ImageName: "postgres:12", Options: opts},
+	}
+)
+
+func connectionString(scheme, host, port string) string {
+	return fmt.Sprintf("%s://postgres:%s@%s:%s/postgres?sslmode=disable", scheme, pgPassword, host, port)
+}
+
+func isReady(ctx context.Context, c dktest.ContainerInfo) bool {
+	ip, port, err := c.FirstPort()
+	if err != nil {
+		return false
+	}
+	db, err := sql.Open("postgres", connectionString("postgres", ip, port))
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	return db.PingContext(ctx) == nil
+}
+
+func Test(t *testing.T) {
+	dktesting.ParallelTest(t, specs, func(t *testing.T, c dktest.ContainerInfo) {
+		ip, port, err := c.FirstPort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := (&Postgres{}).Open(connectionString("postgres-state", ip, port) + "&x-state-key=test-state")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		st.Test(t, d)
+	})
+}
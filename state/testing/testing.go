@@ -0,0 +1,51 @@
+// Package testing has the state driver tests.
+// All state drivers must pass the Test function.
+// This lives in it's own package so it stays a test dependency.
+package testing
+
+import (
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/state"
+)
+
+// Test runs tests against state implementations.
+// d must be a driver instance with an empty store.
+func Test(t *testing.T, d state.Driver) {
+	TestVersion(t, d)
+}
+
+func TestVersion(t *testing.T, d state.Driver) {
+	version, dirty, err := d.Version()
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if version != database.NilVersion || dirty {
+		t.Fatalf("Version: expected NilVersion of an empty store, got %v, %v", version, dirty)
+	}
+
+	tt := []struct {
+		version int
+		dirty   bool
+	}{
+		{1, true},
+		{1, false},
+		{3, true},
+		{3, false},
+		{2, false},
+		{database.NilVersion, false},
+	}
+	for _, v := range tt {
+		if err := d.SetVersion(v.version, v.dirty); err != nil {
+			t.Fatalf("SetVersion(%v, %v): %v", v.version, v.dirty, err)
+		}
+		version, dirty, err := d.Version()
+		if err != nil {
+			t.Fatalf("Version: %v", err)
+		}
+		if version != v.version || dirty != v.dirty {
+			t.Errorf("Version: expected %v, %v, got %v, %v", v.version, v.dirty, version, dirty)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// RunSummary describes the last run of Migrate, Steps, Up, Down or
+// ApplySkipped, see LastRun.
+type RunSummary struct {
+	// Applied, Skipped and Failed are the migrations of the run by outcome,
+	// in the order they ran. Skipped migrations are those whose tags aren't
+	// selected or whose condition isn't met. With AtomicBatch or DryRun,
+	// the applied migrations are rolled back if the run fails.
+	Applied []RunMigration
+	Skipped []RunMigration
+	Failed  []RunMigration
+
+	// Duration is the time of the whole run, including LockWait, the time
+	// spent acquiring the lock.
+	Duration time.Duration
+	LockWait time.Duration
+
+	started time.Time
+}
+
+// RunMigration is a migration of a RunSummary.
+type RunMigration struct {
+	Version    uint
+	Identifier string
+	Direction  source.Direction
+	// Duration is the time from buffering the migration to finishing it
+	Duration time.Duration
+	// Err is set for failed migrations
+	Err error
+}
+
+// LastRun returns the summary of the last run, or nil before the first.
+// A run which is still going on is summarized up to now.
+func (m *Migrate) LastRun() *RunSummary {
+	return m.lastRun
+}
+
+// startRun starts the summary of a run, before the lock is acquired.
+func (m *Migrate) startRun() {
+	m.lastRun = &RunSummary{started: time.Now()}
+}
+
+// lockAcquired records the time waited for the lock in the summary of the
+// run started with startRun.
+func (m *Migrate) lockAcquired() {
+	m.lastRun.LockWait = time.Since(m.lastRun.started)
+}
+
+// finishRun records the duration of the run started with startRun.
+func (m *Migrate) finishRun() {
+	m.lastRun.Duration = time.Since(m.lastRun.started)
+}
+
+// summarize adds migr to the migrations of the current run: to the failed
+// ones if err is set, to the skipped ones if skipped is set, to the applied
+// ones otherwise.
+func (m *Migrate) summarize(migr *Migration, skipped bool, err error) {
+	if m.lastRun == nil {
+		return
+	}
+	direction := source.Up
+	if migr.down() {
+		direction = source.Down
+	}
+	var duration time.Duration
+	if !migr.StartedBuffering.IsZero() {
+		duration = time.Since(migr.StartedBuffering)
+	}
+	run := RunMigration{
+		Version:    migr.Version,
+		Identifier: migr.Identifier,
+		Direction:  direction,
+		Duration:   duration,
+		Err:        err,
+	}
+	switch {
+	case err != nil:
+		m.lastRun.Failed = append(m.lastRun.Failed, run)
+	case skipped:
+		m.lastRun.Skipped = append(m.lastRun.Skipped, run)
+	default:
+		m.lastRun.Applied = append(m.lastRun.Applied, run)
+	}
+}
@@ -0,0 +1,72 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+func TestLastRun(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "-- migrate:tags slow\nCREATE 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "CREATE 4"})
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+	db := &failStub{Stub: dbDrv.(*dStub.Stub), failAfter: map[string]int{"CREATE 3": 0}}
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.LastRun() != nil {
+		t.Error("expected no summary before the first run")
+	}
+	m.ContinueOnError = true
+	m.HistoryTable = database.DefaultHistoryTable
+	m.SelectTags = "!slow"
+
+	if err := m.Up(); err == nil {
+		t.Fatal("expected the failure of 3")
+	}
+	s := m.LastRun()
+	versions := func(migrations []RunMigration) []uint {
+		var versions []uint
+		for _, migr := range migrations {
+			if migr.Direction != source.Up {
+				t.Errorf("expected %v up, got %v", migr.Version, migr.Direction)
+			}
+			versions = append(versions, migr.Version)
+		}
+		return versions
+	}
+	if applied := versions(s.Applied); !reflect.DeepEqual(applied, []uint{1, 4}) {
+		t.Errorf("expected 1 and 4 applied, got %v", applied)
+	}
+	if skipped := versions(s.Skipped); !reflect.DeepEqual(skipped, []uint{2}) {
+		t.Errorf("expected 2 skipped, got %v", skipped)
+	}
+	if failed := versions(s.Failed); !reflect.DeepEqual(failed, []uint{3}) || s.Failed[0].Err == nil {
+		t.Errorf("expected 3 failed with its error, got %+v", s.Failed)
+	}
+	if s.Duration <= 0 || s.LockWait > s.Duration {
+		t.Errorf("expected a duration including the lock wait, got %v and %v", s.Duration, s.LockWait)
+	}
+
+	// a new run starts a new summary
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+	s = m.LastRun()
+	if len(s.Applied) != 1 || s.Applied[0].Version != 4 || s.Applied[0].Direction != source.Down ||
+		len(s.Skipped) != 0 || len(s.Failed) != 0 {
+		t.Errorf("expected only 4 applied down, got %+v", s)
+	}
+}
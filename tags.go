@@ -0,0 +1,66 @@
+package migrate
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// ErrTagAhead is returned by RollbackToTag if the version of the tag is
+// above the current version.
+var ErrTagAhead = errors.New("tag is ahead of the current version, rollback only migrates down")
+
+// Tag records the current version under name, e.g. the version of a release
+// of the application, in TagTable. Tags can't be moved.
+func (m *Migrate) Tag(name string) error {
+	if err := m.lock(); err != nil {
+		return err
+	}
+
+	version, dirty, err := m.state().Version()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if dirty {
+		return m.unlockErr(ErrDirty{version})
+	}
+	if version == database.NilVersion {
+		return m.unlockErr(ErrNilVersion)
+	}
+
+	tag := database.Tag{Name: name, Version: version, Created: time.Now()}
+	if err := m.tagTable().Add(tag); err != nil {
+		return m.unlockErr(err)
+	}
+	return m.unlock()
+}
+
+// Tags returns the tags recorded by Tag, ordered by version.
+func (m *Migrate) Tags() ([]database.Tag, error) {
+	return m.tagTable().List()
+}
+
+// RollbackToTag migrates down to the version of tag name, see Tag.
+func (m *Migrate) RollbackToTag(name string) error {
+	tag, err := m.tagTable().Get(name)
+	if err != nil {
+		return err
+	}
+	curVersion, _, err := m.state().Version()
+	if err != nil {
+		return err
+	}
+	if tag.Version > curVersion {
+		return ErrTagAhead
+	}
+	return m.Migrate(uint(tag.Version))
+}
+
+func (m *Migrate) tagTable() *database.TagTable {
+	table := m.TagTable
+	if table == "" {
+		table = database.DefaultTagTable
+	}
+	return &database.TagTable{Driver: m.stateDriver(), Table: table}
+}
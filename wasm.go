@@ -0,0 +1,42 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// wasmMagic starts every WebAssembly module.
+var wasmMagic = []byte{0x00, 'a', 's', 'm'}
+
+// ErrNoWasmRuntime is returned when running a WebAssembly migration
+// while Migrate.Wasm isn't set.
+var ErrNoWasmRuntime = errors.New("migration is a WebAssembly module, but no runtime is set")
+
+// WasmRuntime runs migrations compiled to WebAssembly, which are detected by
+// their header. Package wasm implements it with an embedded runtime.
+type WasmRuntime interface {
+	// Run instantiates module and calls its exported migrate function.
+	// The host functions of the module execute statements with exec
+	// and log messages with log.
+	Run(module []byte, exec func(statement []byte) error, log func(msg string)) error
+}
+
+// isWasm reports whether a migration starting with head is a WebAssembly module.
+func isWasm(head []byte) bool {
+	return bytes.HasPrefix(head, wasmMagic)
+}
+
+// runWasm runs a WebAssembly migration, whose statements are run by the database driver.
+func (m *Migrate) runWasm(migr *Migration, body io.Reader) error {
+	module, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return m.Wasm.Run(module, func(statement []byte) error {
+		return m.databaseDrv.Run(bytes.NewReader(statement))
+	}, func(msg string) {
+		m.logPrintf("%v: %v\n", migr.LogString(), msg)
+	})
+}
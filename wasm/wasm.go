@@ -0,0 +1,101 @@
+// Package wasm runs migrations compiled to WebAssembly in an embedded
+// runtime, see migrate.Migrate.Wasm. Modules get no access to the system,
+// only to the host functions of the `migrate` module, so they run
+// deterministically:
+//
+//	exec(ptr, len i32)   executes the statement in memory[ptr:ptr+len], aborts on error
+//	log(ptr, len i32)    logs the message in memory[ptr:ptr+len]
+//	fail(ptr, len i32)   aborts the migration with the message in memory[ptr:ptr+len]
+//
+// A module must have a memory and export a function `migrate` without
+// parameters and results, which is called once.
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// HostModule is the name of the module providing the host functions.
+const HostModule = "migrate"
+
+// Entrypoint is the function a module must export.
+const Entrypoint = "migrate"
+
+// ErrNoEntrypoint is returned for modules not exporting Entrypoint.
+var ErrNoEntrypoint = errors.New("wasm: module doesn't export function " + Entrypoint)
+
+// Runtime implements migrate.WasmRuntime with wazero.
+type Runtime struct {
+	// MemoryLimitPages limits the memory of a module in pages of 64 KiB.
+	// Zero is the limit of wazero, 4 GiB.
+	MemoryLimitPages uint32
+}
+
+// New returns a Runtime.
+func New() *Runtime {
+	return &Runtime{}
+}
+
+func (r *Runtime) Run(module []byte, exec func(statement []byte) error, log func(msg string)) (err error) {
+	ctx := context.Background()
+	config := wazero.NewRuntimeConfig()
+	if r.MemoryLimitPages > 0 {
+		config = config.WithMemoryLimitPages(r.MemoryLimitPages)
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	defer func() {
+		if closeErr := runtime.Close(ctx); err == nil {
+			err = closeErr
+		}
+	}()
+
+	// the error aborting the module, wazero wraps panics of host functions
+	var aborted error
+	read := func(m api.Module, ptr, size uint32) []byte {
+		b, ok := m.Memory().Read(ptr, size)
+		if !ok {
+			aborted = fmt.Errorf("wasm: read of %v bytes at %v out of memory range", size, ptr)
+			panic(aborted)
+		}
+		return b
+	}
+	_, err = runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		if err := exec(read(m, ptr, size)); err != nil {
+			aborted = err
+			panic(aborted)
+		}
+	}).Export("exec").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		log(string(read(m, ptr, size)))
+	}).Export("log").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		aborted = fmt.Errorf("wasm: %s", read(m, ptr, size))
+		panic(aborted)
+	}).Export("fail").
+		Instantiate(ctx)
+	if err != nil {
+		return err
+	}
+
+	mod, err := runtime.InstantiateWithConfig(ctx, module, wazero.NewModuleConfig().WithStartFunctions())
+	if err != nil {
+		return err
+	}
+	migrate := mod.ExportedFunction(Entrypoint)
+	if migrate == nil {
+		return ErrNoEntrypoint
+	}
+	if _, err := migrate.Call(ctx); err != nil {
+		if aborted != nil {
+			return aborted
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package wasm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// section encodes a module section, contents must be shorter than 128 bytes
+func section(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+func name(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+// testModule assembles a module whose migrate function runs body. Its memory
+// holds "CREATE 1" at 0 and "boom" at 16.
+func testModule(body ...byte) []byte {
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	// type 0: (i32, i32) -> (), type 1: () -> ()
+	module = append(module, section(1, 0x02, 0x60, 0x02, 0x7f, 0x7f, 0x00, 0x60, 0x00, 0x00)...)
+	imports := []byte{0x03}
+	for _, f := range []string{"exec", "log", "fail"} {
+		imports = append(imports, name(HostModule)...)
+		imports = append(imports, name(f)...)
+		imports = append(imports, 0x00, 0x00)
+	}
+	module = append(module, section(2, imports...)...)
+	module = append(module, section(3, 0x01, 0x01)...)
+	module = append(module, section(5, 0x01, 0x00, 0x01)...)
+	exports := append([]byte{0x01}, name(Entrypoint)...)
+	module = append(module, section(7, append(exports, 0x00, 0x03)...)...)
+	code := append([]byte{0x00}, body...)
+	code = append(code, 0x0b)
+	module = append(module, section(10, append([]byte{0x01, byte(len(code))}, code...)...)...)
+	data := []byte{0x02, 0x00, 0x41, 0x00, 0x0b}
+	data = append(data, name("CREATE 1")...)
+	data = append(data, 0x00, 0x41, 0x10, 0x0b)
+	data = append(data, name("boom")...)
+	return append(module, section(11, data...)...)
+}
+
+// call returns the instructions calling the host function with index f
+// with the memory at offset and size
+func call(f, offset, size byte) []byte {
+	return []byte{0x41, offset, 0x41, size, 0x10, f}
+}
+
+func TestRun(t *testing.T) {
+	errExec := errors.New("exec failed")
+	cases := []struct {
+		name       string
+		module     []byte
+		execErr    error
+		expectErr  string
+		statements []string
+		logs       []string
+	}{
+		{name: "exec and log", module: testModule(append(call(0, 0, 8), call(1, 16, 4)...)...),
+			statements: []string{"CREATE 1"}, logs: []string{"boom"}},
+		{name: "fail", module: testModule(append(call(2, 16, 4), call(0, 0, 8)...)...),
+			expectErr: "wasm: boom"},
+		{name: "exec error", module: testModule(append(call(0, 0, 8), call(0, 0, 8)...)...),
+			execErr: errExec, expectErr: errExec.Error(), statements: []string{"CREATE 1"}},
+		{name: "out of range", module: testModule(0x41, 0x3f, 0x41, 0x80, 0x80, 0x04, 0x10, 0x00),
+			expectErr: "wasm: read of 65536 bytes at 63 out of memory range"},
+		{name: "invalid", module: []byte{0x00, 'a', 's', 'm'}, expectErr: "invalid version header"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			statements := []string{}
+			logs := []string{}
+			err := New().Run(c.module, func(statement []byte) error {
+				statements = append(statements, string(statement))
+				return c.execErr
+			}, func(msg string) {
+				logs = append(logs, msg)
+			})
+			if c.expectErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if c.expectErr != "" && (err == nil || err.Error() != c.expectErr) {
+				t.Fatalf("expected error %q, got %v", c.expectErr, err)
+			}
+			if c.statements != nil && !reflect.DeepEqual(statements, c.statements) {
+				t.Errorf("expected statements %v, got %v", c.statements, statements)
+			}
+			if c.logs != nil && !reflect.DeepEqual(logs, c.logs) {
+				t.Errorf("expected logs %v, got %v", c.logs, logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"bytes"
+	"testing"
+
+	dStub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	sStub "github.com/golang-migrate/migrate/v4/source/stub"
+)
+
+// fakeWasm runs every module as two statements
+type fakeWasm struct {
+	modules [][]byte
+}
+
+func (f *fakeWasm) Run(module []byte, exec func(statement []byte) error, log func(msg string)) error {
+	f.modules = append(f.modules, module)
+	log("running")
+	if err := exec([]byte("CREATE 2a")); err != nil {
+		return err
+	}
+	return exec([]byte("CREATE 2b"))
+}
+
+func TestWasmMigrations(t *testing.T) {
+	module := "\x00asm\x01\x00\x00\x00\xff\xfe"
+	srcDrv, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: module})
+	srcDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv, _ := (&dStub.Stub{}).Open("stub://")
+
+	m, err := NewWithInstance("stub", srcDrv, "stub", dbDrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != ErrNoWasmRuntime {
+		t.Fatalf("expected ErrNoWasmRuntime, got %v", err)
+	}
+	if v, dirty, _ := m.Version(); v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v, %v", v, dirty)
+	}
+
+	runtime := &fakeWasm{}
+	m.Wasm = runtime
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, migrationSequence{mr("CREATE 1"), mr("CREATE 2a"), mr("CREATE 2b")}, dbDrv.(*dStub.Stub))
+	// the module isn't transcoded
+	if len(runtime.modules) != 1 || !bytes.Equal(runtime.modules[0], []byte(module)) {
+		t.Errorf("expected module %q, got %q", module, runtime.modules)
+	}
+}